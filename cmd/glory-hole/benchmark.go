@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultBenchmarkDomains is the query mix when no --domains file is given:
+// two names that cache well and one that never does.
+var defaultBenchmarkDomains = []string{"example.com", "cloudflare.com", "*.example.com"}
+
+// benchQuery is one entry of the query mix. A random query gets a fresh
+// label prepended each time, so it always misses the server's cache.
+type benchQuery struct {
+	name   string
+	qtype  uint16
+	random bool
+}
+
+// benchmarkOptions configures a load test.
+type benchmarkOptions struct {
+	server   string
+	network  string // "udp" or "tcp"
+	qps      int    // 0 = as fast as the workers go
+	duration time.Duration
+	workers  int
+	timeout  time.Duration
+	queries  []benchQuery
+}
+
+// benchmarkResult aggregates what the workers saw.
+type benchmarkResult struct {
+	Elapsed   time.Duration
+	Sent      int64
+	Completed int64
+	Timeouts  int64
+	Errors    int64
+	Rcodes    map[string]int64
+	latencies []time.Duration // sorted ascending
+}
+
+// benchmarkReport is the --json output.
+type benchmarkReport struct {
+	Server     string             `json:"server"`
+	Network    string             `json:"network"`
+	DurationMs int64              `json:"duration_ms"`
+	Sent       int64              `json:"sent"`
+	Completed  int64              `json:"completed"`
+	Timeouts   int64              `json:"timeouts"`
+	Errors     int64              `json:"errors"`
+	QPS        float64            `json:"qps"`
+	ErrorRate  float64            `json:"error_rate"`
+	LatencyMs  map[string]float64 `json:"latency_ms"`
+	Rcodes     map[string]int64   `json:"rcodes"`
+}
+
+// runBenchmark fires DNS queries at a server for a fixed time and reports
+// throughput, latency percentiles and error rates.
+func runBenchmark(args []string) {
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	server := fs.String("server", "127.0.0.1:53", "DNS server to load (host:port)")
+	qps := fs.Int("qps", 1000, "Target queries per second (0 = unlimited)")
+	duration := fs.Duration("duration", 30*time.Second, "How long to run")
+	domainsFile := fs.String("domains", "", "File with one domain per line, optionally followed by a query type (default: built-in mix)")
+	workers := fs.Int("workers", 64, "Concurrent clients, each with its own connection")
+	timeout := fs.Duration("timeout", 2*time.Second, "Per-query timeout")
+	qtypeName := fs.String("type", "A", "Query type for lines that don't name one")
+	useTCP := fs.Bool("tcp", false, "Query over TCP instead of UDP")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole benchmark [OPTIONS]\n\n")
+		fmt.Fprintf(os.Stderr, "Load-test a DNS server and report QPS, latency percentiles and error rates.\n\n")
+		fmt.Fprintf(os.Stderr, "Domains file format (one query per line, # starts a comment):\n")
+		fmt.Fprintf(os.Stderr, "  example.com            cached after the first query\n")
+		fmt.Fprintf(os.Stderr, "  example.com AAAA       explicit query type\n")
+		fmt.Fprintf(os.Stderr, "  *.example.com          random label each time, always a cache miss\n")
+		fmt.Fprintf(os.Stderr, "  ads.doubleclick.net    a blocked name exercises the block path\n")
+		fmt.Fprintf(os.Stderr, "Repeat a line to weight it; lines are queried round-robin.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole benchmark --server 127.0.0.1:53 --qps 10000 --duration 30s --domains mix.txt\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole benchmark --qps 0 --workers 256 --tcp --json\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(*qtypeName)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown query type %q\n", *qtypeName)
+		os.Exit(1)
+	}
+	if *qps < 0 || *workers < 1 || *duration <= 0 || *timeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --qps must be >= 0, --workers >= 1, --duration and --timeout > 0\n")
+		os.Exit(1)
+	}
+
+	var queries []benchQuery
+	var err error
+	if *domainsFile != "" {
+		queries, err = loadBenchmarkQueries(*domainsFile, qtype)
+	} else {
+		queries, err = parseBenchmarkQueries(strings.NewReader(strings.Join(defaultBenchmarkDomains, "\n")), qtype)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := benchmarkOptions{
+		server:   *server,
+		network:  "udp",
+		qps:      *qps,
+		duration: *duration,
+		workers:  *workers,
+		timeout:  *timeout,
+		queries:  queries,
+	}
+	if *useTCP {
+		opts.network = "tcp"
+	}
+
+	// Ctrl-C stops early but still prints what was measured.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !*asJSON {
+		rate := "unlimited"
+		if opts.qps > 0 {
+			rate = fmt.Sprintf("%d qps", opts.qps)
+		}
+		fmt.Printf("Benchmarking %s over %s: %s for %s with %d workers, %d distinct queries\n",
+			opts.server, opts.network, rate, opts.duration, opts.workers, len(opts.queries))
+	}
+
+	res, err := benchmark(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := res.report(opts)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		return
+	}
+	printBenchmarkReport(report)
+}
+
+// loadBenchmarkQueries reads a domains file; see parseBenchmarkQueries.
+func loadBenchmarkQueries(path string, defaultType uint16) ([]benchQuery, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return parseBenchmarkQueries(f, defaultType)
+}
+
+// parseBenchmarkQueries parses "domain [TYPE]" lines. Blank lines and
+// comments are skipped; a leading "*." marks a name that gets a random label
+// on every query.
+func parseBenchmarkQueries(r io.Reader, defaultType uint16) ([]benchQuery, error) {
+	var queries []benchQuery
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected \"domain [type]\"", line)
+		}
+
+		q := benchQuery{name: fields[0], qtype: defaultType}
+		if rest, ok := strings.CutPrefix(q.name, "*."); ok {
+			q.name, q.random = rest, true
+		}
+		if _, ok := dns.IsDomainName(q.name); !ok || q.name == "" {
+			return nil, fmt.Errorf("line %d: invalid domain %q", line, fields[0])
+		}
+		q.name = dns.Fqdn(q.name)
+		if len(fields) == 2 {
+			qtype, ok := dns.StringToType[strings.ToUpper(fields[1])]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown query type %q", line, fields[1])
+			}
+			q.qtype = qtype
+		}
+		queries = append(queries, q)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, errors.New("no domains to query")
+	}
+	return queries, nil
+}
+
+// benchmark runs the load test until opts.duration passes or ctx is done.
+func benchmark(ctx context.Context, opts benchmarkOptions) (*benchmarkResult, error) {
+	if len(opts.queries) == 0 {
+		return nil, errors.New("no domains to query")
+	}
+	// Fail fast on an unreachable target instead of timing out every worker.
+	probe, err := net.DialTimeout(opts.network, opts.server, opts.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach %s: %w", opts.server, err)
+	}
+	_ = probe.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.duration)
+	defer cancel()
+
+	// With a rate, a pacer hands out one token per query; without, workers
+	// loop freely. The buffer lets workers absorb short stalls.
+	var tokens chan struct{}
+	if opts.qps > 0 {
+		tokens = make(chan struct{}, opts.workers)
+		go paceQueries(ctx, opts.qps, tokens)
+	}
+
+	var (
+		next    atomic.Uint64
+		wg      sync.WaitGroup
+		res     = &benchmarkResult{Rcodes: make(map[string]int64)}
+		workers = make([]*benchWorker, opts.workers)
+	)
+	start := time.Now()
+	for i := range workers {
+		w := &benchWorker{
+			client: &dns.Client{Net: opts.network, Timeout: opts.timeout},
+			server: opts.server,
+			rcodes: make(map[string]int64),
+		}
+		workers[i] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx, tokens, func() benchQuery {
+				return opts.queries[(next.Add(1)-1)%uint64(len(opts.queries))]
+			})
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+
+	for _, w := range workers {
+		res.Sent += w.sent
+		res.Completed += w.completed
+		res.Timeouts += w.timeouts
+		res.Errors += w.errors
+		for rcode, n := range w.rcodes {
+			res.Rcodes[rcode] += n
+		}
+		res.latencies = append(res.latencies, w.latencies...)
+	}
+	slices.Sort(res.latencies)
+	return res, nil
+}
+
+// paceQueries sends qps tokens per second until ctx is done. It tops up every
+// millisecond based on elapsed time, so rates well above 1000 qps are met
+// without a timer per query. Tokens the workers can't take are dropped:
+// the report then shows the server (or client) could not keep up.
+func paceQueries(ctx context.Context, qps int, tokens chan<- struct{}) {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	var issued int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due := int64(now.Sub(start).Seconds() * float64(qps))
+			for ; issued < due; issued++ {
+				select {
+				case tokens <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// benchWorker is one client. Its counters are only touched by its own
+// goroutine and read after it exits.
+type benchWorker struct {
+	client    *dns.Client
+	server    string
+	conn      *dns.Conn
+	sent      int64
+	completed int64
+	timeouts  int64
+	errors    int64
+	rcodes    map[string]int64
+	latencies []time.Duration
+}
+
+func (w *benchWorker) run(ctx context.Context, tokens <-chan struct{}, nextQuery func() benchQuery) {
+	defer func() {
+		if w.conn != nil {
+			_ = w.conn.Close()
+		}
+	}()
+	msg := new(dns.Msg)
+	for {
+		if tokens != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tokens:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		q := nextQuery()
+		name := q.name
+		if q.random {
+			name = fmt.Sprintf("%08x.%s", rand.Uint32(), q.name)
+		}
+		msg.SetQuestion(name, q.qtype)
+		msg.Id = dns.Id()
+		w.exchange(msg)
+	}
+}
+
+// exchange sends one query on the worker's connection, redialing after any
+// error since a UDP socket may have a late reply queued and a TCP stream is
+// left mid-message.
+func (w *benchWorker) exchange(msg *dns.Msg) {
+	if w.conn == nil {
+		conn, err := w.client.Dial(w.server)
+		if err != nil {
+			w.sent++
+			w.errors++
+			return
+		}
+		w.conn = conn
+	}
+
+	w.sent++
+	resp, rtt, err := w.client.ExchangeWithConn(msg, w.conn)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			w.timeouts++
+		} else {
+			w.errors++
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+		return
+	}
+	w.completed++
+	w.rcodes[dns.RcodeToString[resp.Rcode]]++
+	w.latencies = append(w.latencies, rtt)
+}
+
+// percentile returns the p-th percentile (0-100) latency, or 0 with no samples.
+func (r *benchmarkResult) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies)-1) * p / 100)
+	return r.latencies[i]
+}
+
+func (r *benchmarkResult) report(opts benchmarkOptions) benchmarkReport {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	rep := benchmarkReport{
+		Server:     opts.server,
+		Network:    opts.network,
+		DurationMs: r.Elapsed.Milliseconds(),
+		Sent:       r.Sent,
+		Completed:  r.Completed,
+		Timeouts:   r.Timeouts,
+		Errors:     r.Errors,
+		Rcodes:     r.Rcodes,
+		LatencyMs: map[string]float64{
+			"p50": ms(r.percentile(50)),
+			"p90": ms(r.percentile(90)),
+			"p99": ms(r.percentile(99)),
+			"max": ms(r.percentile(100)),
+		},
+	}
+	if secs := r.Elapsed.Seconds(); secs > 0 {
+		rep.QPS = float64(r.Completed) / secs
+	}
+	if r.Sent > 0 {
+		rep.ErrorRate = float64(r.Timeouts+r.Errors) / float64(r.Sent)
+	}
+	return rep
+}
+
+func printBenchmarkReport(rep benchmarkReport) {
+	fmt.Printf("\nDuration:    %.1fs\n", float64(rep.DurationMs)/1000)
+	fmt.Printf("Queries:     %d sent, %d answered, %d timeouts, %d errors (%.2f%% failed)\n",
+		rep.Sent, rep.Completed, rep.Timeouts, rep.Errors, rep.ErrorRate*100)
+	fmt.Printf("Throughput:  %.0f qps\n", rep.QPS)
+	fmt.Printf("Latency:     p50 %.2fms  p90 %.2fms  p99 %.2fms  max %.2fms\n",
+		rep.LatencyMs["p50"], rep.LatencyMs["p90"], rep.LatencyMs["p99"], rep.LatencyMs["max"])
+
+	rcodes := make([]string, 0, len(rep.Rcodes))
+	for rcode := range rep.Rcodes {
+		rcodes = append(rcodes, rcode)
+	}
+	sort.Slice(rcodes, func(i, j int) bool { return rep.Rcodes[rcodes[i]] > rep.Rcodes[rcodes[j]] })
+	parts := make([]string, 0, len(rcodes))
+	for _, rcode := range rcodes {
+		parts = append(parts, fmt.Sprintf("%s %d", rcode, rep.Rcodes[rcode]))
+	}
+	if len(parts) > 0 {
+		fmt.Printf("Rcodes:      %s\n", strings.Join(parts, ", "))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseBenchmarkQueries(t *testing.T) {
+	queries, err := parseBenchmarkQueries(strings.NewReader(`
+# query mix
+example.com
+example.com AAAA   # explicit type
+*.example.net
+`), dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []benchQuery{
+		{name: "example.com.", qtype: dns.TypeA},
+		{name: "example.com.", qtype: dns.TypeAAAA},
+		{name: "example.net.", qtype: dns.TypeA, random: true},
+	}
+	if len(queries) != len(want) {
+		t.Fatalf("got %d queries, want %d", len(queries), len(want))
+	}
+	for i := range want {
+		if queries[i] != want[i] {
+			t.Errorf("query %d = %+v, want %+v", i, queries[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"", "# only comments\n", "example.com BOGUS", "a b c", "bad..name"} {
+		if _, err := parseBenchmarkQueries(strings.NewReader(bad), dns.TypeA); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if strings.HasSuffix(r.Question[0].Name, "blocked.test.") {
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	opts := benchmarkOptions{
+		server:   pc.LocalAddr().String(),
+		network:  "udp",
+		qps:      500,
+		duration: 400 * time.Millisecond,
+		workers:  4,
+		timeout:  time.Second,
+		queries: []benchQuery{
+			{name: "example.com.", qtype: dns.TypeA},
+			{name: "blocked.test.", qtype: dns.TypeA, random: true},
+		},
+	}
+	res, err := benchmark(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Completed == 0 || res.Timeouts+res.Errors != 0 {
+		t.Fatalf("completed=%d timeouts=%d errors=%d", res.Completed, res.Timeouts, res.Errors)
+	}
+	// The pacer caps the rate: 500 qps for 0.4s is 200 queries.
+	if res.Sent > 220 {
+		t.Errorf("sent %d queries, expected the rate limit to hold it near 200", res.Sent)
+	}
+	if res.Rcodes["NOERROR"] == 0 || res.Rcodes["NXDOMAIN"] == 0 {
+		t.Errorf("expected both NOERROR and NXDOMAIN answers, got %v", res.Rcodes)
+	}
+	rep := res.report(opts)
+	if rep.QPS <= 0 || rep.LatencyMs["p50"] > rep.LatencyMs["p99"] || rep.LatencyMs["p99"] > rep.LatencyMs["max"] {
+		t.Errorf("inconsistent report %+v", rep)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/pattern"
 	"glory-hole/pkg/storage"
 
 	"gopkg.in/yaml.v3"
@@ -647,13 +648,14 @@ func piholeDomainListsToPolicyRules(whitelist, blacklist []string) []config.Poli
 func domainEntryToLogicAndName(entry, verb string) (logic, name string) {
 	switch {
 	case strings.HasPrefix(entry, "*."):
-		baseDomain := strings.TrimPrefix(entry, "*.")
+		baseDomain := pattern.NormalizeDomain(strings.TrimPrefix(entry, "*."))
 		logic = fmt.Sprintf(`Domain == %q || DomainEndsWith(Domain, %q)`, baseDomain, "."+baseDomain)
 		name = fmt.Sprintf("%s *.%s (imported)", verb, baseDomain)
 	case strings.ContainsAny(entry, "()[]{}^$|\\+?"):
 		logic = fmt.Sprintf(`DomainMatches(Domain, %q)`, entry)
 		name = fmt.Sprintf("%s pattern %s (imported)", verb, entry)
 	default:
+		entry = pattern.NormalizeDomain(entry)
 		logic = fmt.Sprintf(`Domain == %q`, entry)
 		name = fmt.Sprintf("%s %s (imported)", verb, entry)
 	}
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -18,16 +20,20 @@ import (
 	"glory-hole/pkg/blocklist"
 	"glory-hole/pkg/cache"
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/discovery"
 	"glory-hole/pkg/dns"
 	"glory-hole/pkg/forwarder"
 	"glory-hole/pkg/localrecords"
 	"glory-hole/pkg/logging"
+	"glory-hole/pkg/notify"
+	"glory-hole/pkg/pattern"
 	"glory-hole/pkg/policy"
 	"glory-hole/pkg/resolver"
 	"glory-hole/pkg/storage"
 	"glory-hole/pkg/telemetry"
 	"glory-hole/pkg/unbound"
 
+	mdns "github.com/miekg/dns"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -35,8 +41,13 @@ var (
 	configPath     = flag.String("config", "config.yml", "Path to configuration file")
 	showVersion    = flag.Bool("version", false, "Show version information and exit")
 	validateConfig = flag.Bool("validate-config", false, "Validate configuration file and exit")
+	selfTestMode   = flag.Bool("self-test", false, "Validate configuration, resolve through each upstream, download each blocklist and open the database, then exit")
+	selfTestName   = flag.String("self-test-domain", selfTestDomain, "Domain --self-test resolves through each upstream")
 	healthCheck    = flag.Bool("health-check", false, "Perform health check and exit (for Docker HEALTHCHECK)")
 	apiAddress     = flag.String("api-address", "", "Override API address for health check (default: from config)")
+	healthDetailed = flag.Bool("health-detailed", false, "Make --health-check use /api/health/detailed (fails if a critical component is down)")
+	healthDNS      = flag.Bool("health-dns", false, "Make --health-check also resolve server.health_name over UDP (checks the DNS path)")
+	allowDebug     = flag.Bool("allow-debug", false, "Permit server.debug options (development only)")
 
 	// Build-time variables set via ldflags
 	// Example: go build -ldflags "-X main.version=$(git describe --tags) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
@@ -107,13 +118,14 @@ func migrateWhitelistToPolicies(cfg *config.Config, stor storage.Storage, config
 		var name string
 
 		if strings.HasPrefix(entry, "*.") {
-			baseDomain := strings.TrimPrefix(entry, "*.")
+			baseDomain := pattern.NormalizeDomain(strings.TrimPrefix(entry, "*."))
 			logic = fmt.Sprintf(`Domain == "%s" || DomainEndsWith(Domain, ".%s")`, baseDomain, baseDomain)
 			name = fmt.Sprintf("Allow *.%s (migrated)", baseDomain)
 		} else if strings.ContainsAny(entry, "()[]{}^$|\\+?") {
 			logic = fmt.Sprintf(`DomainMatches(Domain, "%s")`, entry)
 			name = fmt.Sprintf("Allow pattern %s (migrated)", entry)
 		} else {
+			entry = pattern.NormalizeDomain(entry)
 			logic = fmt.Sprintf(`Domain == "%s"`, entry)
 			name = fmt.Sprintf("Allow %s (migrated)", entry)
 		}
@@ -368,10 +380,32 @@ func main() {
 		case "hash-password":
 			runHashPassword(os.Args[2:])
 			return
+		case "export-config":
+			runExportConfig(os.Args[2:])
+			return
+		case "export-records":
+			runExportRecords(os.Args[2:])
+			return
+		case "import-records":
+			runImportRecords(os.Args[2:])
+			return
+		case "enable-record":
+			runSetRecordEnabled("enable-record", os.Args[2:], true)
+			return
+		case "disable-record":
+			runSetRecordEnabled("disable-record", os.Args[2:], false)
+			return
+		case "reload-blocklists":
+			runReloadBlocklists(os.Args[2:])
+			return
+		case "benchmark":
+			runBenchmark(os.Args[2:])
+			return
 		}
 	}
 
 	flag.Parse()
+	config.SetAllowDebug(*allowDebug)
 
 	// Handle --version flag
 	if *showVersion {
@@ -393,9 +427,33 @@ func main() {
 		return
 	}
 
+	// Handle --self-test flag
+	if *selfTestMode {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration invalid: %v\n", err)
+			os.Exit(1)
+		}
+		// Only errors: the PASS/FAIL lines are the report
+		logger, err := logging.New(&config.LoggingConfig{Level: "error", Format: "text", Output: "stderr"})
+		if err != nil {
+			logger = logging.NewDefault()
+		}
+		logging.SetGlobal(logger)
+		results := selfTest(context.Background(), cfg, logger, selfTestOptions{
+			domain:          *selfTestName,
+			upstreamTimeout: 3 * time.Second,
+			downloadTimeout: 30 * time.Second,
+		})
+		if printSelfTest(os.Stdout, results) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Handle --health-check flag
 	if *healthCheck {
-		os.Exit(performHealthCheck(*apiAddress, *configPath))
+		os.Exit(performHealthCheck(*apiAddress, *configPath, *healthDetailed, *healthDNS))
 	}
 
 	// Create context for application lifecycle
@@ -481,6 +539,39 @@ func main() {
 	// Create DNS handler
 	handler := dns.NewHandler()
 	handler.SetDecisionTrace(cfg.Server.DecisionTrace)
+	handler.SetBlockExplainTXT(cfg.Server.BlockExplainTXT)
+	handler.SetExtendedDNSErrors(cfg.Server.ExtendedDNSErrors, cfg.Server.StripUpstreamEDE)
+	handler.SetSlowQueryThreshold(cfg.Server.SlowQueryThreshold)
+	handler.SetQueryLogSampleRate(cfg.Database.SampleRate)
+	handler.SetQueryLogPreserveCase(cfg.Database.PreserveDomainCase)
+	handler.SetWhitelistAlwaysWins(cfg.Policy.WhitelistAlwaysWins)
+	handler.SetAnomalyDetection(cfg.Server.AnomalyDetection)
+	handler.SetQueryQuota(cfg.Server.QueryQuota)
+	handler.SetRebindProtection(cfg.Server.RebindProtection)
+	handler.SetSpecialUseNames(cfg.Server.SpecialUseNames)
+	handler.SetShuffleAnswers(cfg.Forwarder.ShuffleAnswers)
+	handler.SetForwardClientSubnet(cfg.Forwarder.ForwardClientSubnet)
+	handler.SetCacheByClientGroup(cfg.Cache.PerClientGroupEnabled())
+	handler.SetFlattenCNAME(cfg.Forwarder.FlattenCNAME)
+	handler.SetMaxCNAMEDepth(cfg.LocalRecords.MaxCNAMEDepth)
+	handler.SetAnyQueryMode(cfg.Server.AnyQuery)
+	handler.SetStaticAnswers(cfg.StaticAnswers)
+	handler.SetRefusedTypes(cfg.Server.RefusedTypes)
+	handler.SetMalformedQueries(cfg.Server.MalformedQueries)
+	handler.SetZoneTransfer(cfg.Server.ZoneTransfer)
+	handler.SetPrivateReverse(cfg.Server.PrivateReverse)
+	handler.SetHealthName(cfg.Server.HealthName)
+	handler.SetAllowedTypes(cfg.Server.AllowedTypes)
+	handler.SetMaxUDPSize(cfg.Server.MaxUDPSize)
+	handler.SetCompressResponses(cfg.Server.CompressResponsesEnabled())
+	handler.SetOverrideTTL(cfg.Server.OverrideTTL)
+	handler.SetBlockedTTLBySource(cfg.Cache.BlockedTTLBySource)
+	handler.SetBlocklistCategories(cfg.BlocklistCategories)
+	handler.SetBlocklistRedirects(cfg.BlocklistRedirects)
+	handler.SetDebug(cfg.Server.Debug)
+	if cfg.Server.Debug.InjectLatency > 0 {
+		logger.Warn("DEBUG: injecting artificial latency into every DNS response", "latency", cfg.Server.Debug.InjectLatency)
+	}
 	if cfg.BlockPage.Enabled && cfg.BlockPage.BlockIP != "" {
 		handler.SetBlockPageIP(cfg.BlockPage.BlockIP)
 		logger.Info("Block page enabled", "block_ip", cfg.BlockPage.BlockIP)
@@ -489,6 +580,14 @@ func main() {
 	// Set config watcher for kill-switch feature (hot-reload access)
 	handler.SetConfigWatcher(cfgWatcher)
 
+	// Webhook notifications for operational events (notifications.webhooks)
+	notifier := notify.New(cfg.Notifications, logger)
+	defer notifier.Close()
+	handler.SetUpstreamsDownHook(func(upstreams []string) {
+		notifier.Notify(config.EventUpstreamsDown, "All upstream DNS servers are unreachable",
+			map[string]string{"upstreams": strings.Join(upstreams, ", ")})
+	})
+
 	// Initialize blocklist manager (create early so handler can reference it,
 	// but defer download until after Unbound is ready to avoid DNS resolution failures)
 	var blocklistMgr *blocklist.Manager
@@ -496,8 +595,13 @@ func main() {
 	if len(cfg.Blocklists) > 0 {
 		logger.Info("Initializing blocklist manager", "sources", len(cfg.Blocklists))
 		blocklistMgr = blocklist.NewManager(cfg, logger, metrics, httpClient)
+		blocklistMgr.SetOnUpdateFailure(func(err error) {
+			notifier.Notify(config.EventBlocklistUpdateFailed, "Blocklist update failed",
+				map[string]string{"error": err.Error()})
+		})
 		blocklistMgr.UpdateConfig(cfg)
 		handler.SetBlocklistManager(blocklistMgr)
+		handler.SetStartup(cfg.Startup)
 		// Download deferred to after Unbound startup (see below)
 	}
 
@@ -548,6 +652,24 @@ func main() {
 				logger.Info("Retention cleanup scheduled", "retention_days", retentionDays, "interval", "1h")
 			}
 
+			// Start client hostname discovery (DHCP leases / PTR)
+			if cfg.ClientDiscovery.Enabled {
+				// Routed like a client query, so policy FORWARD rules and
+				// server.private_reverse apply to the PTR lookups too
+				exchange := func(ctx context.Context, m *mdns.Msg) (*mdns.Msg, error) {
+					if handler.GetForwarder() == nil {
+						return nil, discovery.ErrNoForwarder
+					}
+					return handler.ExchangeInternal(ctx, m)
+				}
+				go discovery.New(cfg.ClientDiscovery, stor, exchange, logger).Run(ctx)
+				logger.Info("Client discovery started",
+					"leases_file", cfg.ClientDiscovery.LeasesFile,
+					"ptr_lookups", cfg.ClientDiscovery.PTRLookupsEnabled(),
+					"interval", cfg.ClientDiscovery.Interval,
+				)
+			}
+
 			// Initialize query logger worker pool (if enabled)
 			if cfg.Server.QueryLogger.Enabled || (cfg.Server.QueryLogger.BufferSize == 0 && cfg.Server.QueryLogger.Workers == 0) {
 				// Apply defaults if not configured
@@ -769,6 +891,7 @@ func main() {
 
 			// Apply wildcard flag
 			record.Wildcard = entry.Wildcard
+			record.Enabled = entry.IsEnabled()
 
 			// Add record to manager
 			if addErr := localMgr.AddRecord(record); addErr != nil {
@@ -813,8 +936,10 @@ func main() {
 					Logic:      entry.Logic,
 					Action:     entry.Action,
 					ActionData: entry.ActionData,
+					Category:   entry.Category,
 					Enabled:    entry.Enabled,
 					SortOrder:  i,
+					Priority:   entry.Priority,
 				})
 				if seedErr != nil {
 					logger.Error("Failed to seed policy rule",
@@ -831,6 +956,8 @@ func main() {
 				Logic:      r.Logic,
 				Action:     r.Action,
 				ActionData: r.ActionData,
+				Category:   r.Category,
+				Priority:   r.Priority,
 				Enabled:    r.Enabled,
 			}
 			if addErr := policyEngine.AddRule(rule); addErr != nil {
@@ -846,6 +973,8 @@ func main() {
 				Logic:      entry.Logic,
 				Action:     entry.Action,
 				ActionData: entry.ActionData,
+				Category:   entry.Category,
+				Priority:   entry.Priority,
 				Enabled:    entry.Enabled,
 			}
 			if addErr := policyEngine.AddRule(rule); addErr != nil {
@@ -870,6 +999,7 @@ func main() {
 			"error", err)
 	}
 	policy.SetClientGroupResolver(clientGroupResolver)
+	warnUnknownAllowedTypesGroups(ctx, stor, cfg.Server.AllowedTypes, logger)
 
 	// Load allowed_clients from SQLite (fallback to YAML for first boot)
 	if stor != nil {
@@ -892,6 +1022,11 @@ func main() {
 	// Set metrics collector for Prometheus metrics recording
 	handler.SetMetrics(metrics)
 
+	// Per-query spans only when tracing is on; a nil tracer skips span setup entirely
+	if cfg.Telemetry.Enabled && cfg.Telemetry.TracingEnabled {
+		handler.SetTracer(telem.TracerProvider().Tracer("glory-hole/dns"))
+	}
+
 	// Set logger for enhanced visibility into DNS operations
 	handler.SetLogger(logger)
 
@@ -903,6 +1038,10 @@ func main() {
 	// hold upstream answers for domains that should now be blocked.
 	// The closure captures dnsCache by reference — reassignments in OnChange
 	// (cache reload) are observed via the variable, so we re-check on each call.
+	killSwitch.SetOnDisable(func(feature string, until time.Time) {
+		notifier.Notify(config.EventKillSwitchEngaged, "Kill-switch engaged: "+feature+" temporarily disabled",
+			map[string]string{"feature": feature, "until": until.UTC().Format(time.RFC3339)})
+	})
 	killSwitch.SetOnReEnable(func() {
 		if dnsCache != nil {
 			dnsCache.ClearBlocklistDecisions()
@@ -1023,8 +1162,41 @@ func main() {
 		)
 
 		apiServer.SetAuthConfig(newCfg.Auth)
+		notifier.SetConfig(newCfg.Notifications)
 
 		handler.SetDecisionTrace(newCfg.Server.DecisionTrace)
+		handler.SetBlockExplainTXT(newCfg.Server.BlockExplainTXT)
+		handler.SetExtendedDNSErrors(newCfg.Server.ExtendedDNSErrors, newCfg.Server.StripUpstreamEDE)
+		handler.SetSlowQueryThreshold(newCfg.Server.SlowQueryThreshold)
+		handler.SetQueryLogSampleRate(newCfg.Database.SampleRate)
+		handler.SetQueryLogPreserveCase(newCfg.Database.PreserveDomainCase)
+		handler.SetWhitelistAlwaysWins(newCfg.Policy.WhitelistAlwaysWins)
+		handler.SetAnomalyDetection(newCfg.Server.AnomalyDetection)
+		handler.SetQueryQuota(newCfg.Server.QueryQuota)
+		handler.SetRebindProtection(newCfg.Server.RebindProtection)
+		handler.SetSpecialUseNames(newCfg.Server.SpecialUseNames)
+		handler.SetShuffleAnswers(newCfg.Forwarder.ShuffleAnswers)
+		handler.SetForwardClientSubnet(newCfg.Forwarder.ForwardClientSubnet)
+		handler.SetCacheByClientGroup(newCfg.Cache.PerClientGroupEnabled())
+		handler.SetFlattenCNAME(newCfg.Forwarder.FlattenCNAME)
+		handler.SetMaxCNAMEDepth(newCfg.LocalRecords.MaxCNAMEDepth)
+		handler.SetAnyQueryMode(newCfg.Server.AnyQuery)
+		handler.SetStaticAnswers(newCfg.StaticAnswers)
+		handler.SetRefusedTypes(newCfg.Server.RefusedTypes)
+		handler.SetMalformedQueries(newCfg.Server.MalformedQueries)
+		handler.SetZoneTransfer(newCfg.Server.ZoneTransfer)
+		handler.SetPrivateReverse(newCfg.Server.PrivateReverse)
+		handler.SetHealthName(newCfg.Server.HealthName)
+		handler.SetStartup(newCfg.Startup)
+		handler.SetAllowedTypes(newCfg.Server.AllowedTypes)
+		warnUnknownAllowedTypesGroups(context.Background(), stor, newCfg.Server.AllowedTypes, logger)
+		handler.SetMaxUDPSize(newCfg.Server.MaxUDPSize)
+		handler.SetCompressResponses(newCfg.Server.CompressResponsesEnabled())
+		handler.SetOverrideTTL(newCfg.Server.OverrideTTL)
+		handler.SetBlockedTTLBySource(newCfg.Cache.BlockedTTLBySource)
+		handler.SetBlocklistCategories(newCfg.BlocklistCategories)
+		handler.SetBlocklistRedirects(newCfg.BlocklistRedirects)
+		handler.SetDebug(newCfg.Server.Debug)
 
 		// NOTE: Policy rules and allowed_clients are now in SQLite.
 		// They are NOT hot-reloaded from YAML — the API/UI writes directly to the DB.
@@ -1058,6 +1230,9 @@ func main() {
 					logger.Info("Blocklists reloaded", "domains", blocklistMgr.Size())
 				}
 			}()
+		} else if blocklistMgr != nil {
+			// Match modes and load settings apply without re-downloading
+			blocklistMgr.UpdateConfig(newCfg)
 		}
 
 		if !equalCacheConfig(&cfg.Cache, &newCfg.Cache) {
@@ -1221,6 +1396,7 @@ func main() {
 							record.TTL = entry.TTL
 						}
 						record.Wildcard = entry.Wildcard
+						record.Enabled = entry.IsEnabled()
 						if err := localMgr.AddRecord(record); err != nil {
 							logger.Error("Failed to add local record during hot-reload",
 								"domain", entry.Domain,
@@ -1282,6 +1458,9 @@ func main() {
 		// Update the cfg reference for next comparison
 		cfg = newCfg
 
+		notifier.Notify(config.EventConfigReloaded, "Configuration reloaded",
+			map[string]string{"path": *configPath})
+
 		// Note: Some config changes still require server restart:
 		// - ListenAddress (DNS/API bind addresses)
 		// - Database settings (connection strings)
@@ -1329,16 +1508,22 @@ func main() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer shutdownCancel()
 
-		// Shutdown DNS server
+		// Shutdown DNS server: stop accepting queries and wait for in-flight ones
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			logger.Error("Error during DNS server shutdown", "error", err)
 		}
 
-		// Shutdown API server
+		// Shutdown API server (also stops DoH)
 		if err := apiServer.Shutdown(shutdownCtx); err != nil {
 			logger.Error("Error during API server shutdown", "error", err)
 		}
 
+		// Wait for any remaining queries and flush the query log buffer while
+		// storage is still open
+		if err := handler.Drain(shutdownCtx); err != nil {
+			logger.Warn("Query drain did not finish before shutdown timeout; recent query logs may be lost", "error", err)
+		}
+
 		// Shutdown Unbound resolver
 		if unboundSupervisor != nil {
 			logger.Info("Stopping Unbound resolver")
@@ -1359,7 +1544,7 @@ func main() {
 			}
 		}
 
-		// Shutdown storage (query logger defer runs before this via deferred stack)
+		// Shutdown storage (flushes its own write buffer)
 		if stor != nil {
 			if err := stor.Close(); err != nil {
 				logger.Error("Error during storage shutdown", "error", err)
@@ -1433,9 +1618,17 @@ func equalStringSlice(a, b []string) bool {
 	return true
 }
 
+// equalUint32Ptr compares two optional values
+func equalUint32Ptr(a, b *uint32) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // equalLocalRecordsConfig compares two local records configurations
 func equalLocalRecordsConfig(a, b *config.LocalRecordsConfig) bool {
-	if a.Enabled != b.Enabled || len(a.Records) != len(b.Records) {
+	if a.Enabled != b.Enabled || a.SOASerial != b.SOASerial || len(a.Records) != len(b.Records) {
 		return false
 	}
 	for i := range a.Records {
@@ -1444,6 +1637,8 @@ func equalLocalRecordsConfig(a, b *config.LocalRecordsConfig) bool {
 			a.Records[i].Target != b.Records[i].Target ||
 			a.Records[i].TTL != b.Records[i].TTL ||
 			a.Records[i].Wildcard != b.Records[i].Wildcard ||
+			a.Records[i].IsEnabled() != b.Records[i].IsEnabled() ||
+			!equalUint32Ptr(a.Records[i].Serial, b.Records[i].Serial) ||
 			!equalStringSlice(a.Records[i].IPs, b.Records[i].IPs) {
 			return false
 		}
@@ -1451,23 +1646,114 @@ func equalLocalRecordsConfig(a, b *config.LocalRecordsConfig) bool {
 	return true
 }
 
+// apiBaseURL turns server.web_ui_address into a URL for local API calls.
+// warnUnknownAllowedTypesGroups logs a warning for each server.allowed_types
+// group that is not defined in storage. Groups live in SQLite rather than the
+// config, so a typo there can't fail validation and would otherwise restrict
+// nobody without a word. It returns the unknown names, sorted.
+func warnUnknownAllowedTypesGroups(ctx context.Context, stor storage.Storage, groups map[string][]string, logger *logging.Logger) []string {
+	if stor == nil || len(groups) == 0 {
+		return nil
+	}
+	defined, err := stor.GetClientGroups(ctx)
+	if err != nil {
+		logger.Warn("Could not check server.allowed_types groups", "error", err)
+		return nil
+	}
+	known := make(map[string]bool, len(defined))
+	for _, g := range defined {
+		known[g.Name] = true
+	}
+	var unknown []string
+	for name := range groups {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		logger.Warn("server.allowed_types references a client group that does not exist", "group", name)
+	}
+	return unknown
+}
+
+func apiBaseURL(addr string) string {
+	if addr != "" && addr[0] == ':' {
+		return "http://localhost" + addr
+	}
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return "http://" + addr
+	}
+	return addr
+}
+
+// dnsProbeAddress turns server.listen_address into an address for local DNS
+// queries: wildcard hosts become loopback.
+func dnsProbeAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return net.JoinHostPort("127.0.0.1", "53")
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// checkHealthName resolves server.health_name against the local DNS
+// listener and checks it comes back NOERROR with the configured address.
+func checkHealthName(cfg *config.Config) error {
+	hn := cfg.Server.HealthName
+	if !hn.IsEnabled() {
+		return fmt.Errorf("server.health_name is disabled")
+	}
+	qtype := mdns.TypeA
+	if ip := net.ParseIP(hn.IP); ip != nil && ip.To4() == nil {
+		qtype = mdns.TypeAAAA
+	}
+	m := new(mdns.Msg)
+	m.SetQuestion(mdns.Fqdn(hn.Name), qtype)
+	listen := cfg.Server.ListenAddress
+	if cfg.Server.UDPListenAddress != "" {
+		listen = cfg.Server.UDPListenAddress
+	} else if len(cfg.Server.ListenAddresses) > 0 {
+		listen = cfg.Server.ListenAddresses[0]
+	}
+	client := &mdns.Client{Net: "udp", Timeout: 2 * time.Second}
+	resp, _, err := client.Exchange(m, dnsProbeAddress(listen))
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != mdns.RcodeSuccess || len(resp.Answer) == 0 {
+		return fmt.Errorf("%s answered %s with %d records", hn.Name, mdns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	return nil
+}
+
 // performHealthCheck performs a health check against the API server
-// Returns exit code 0 if healthy, 1 if unhealthy
-func performHealthCheck(apiAddr, configPath string) int {
+// Returns exit code 0 if healthy, 1 if unhealthy. With detailed set it queries
+// /api/health/detailed, which returns 503 when the DNS listener or every
+// upstream is down. With dnsProbe set it also resolves server.health_name
+// through the DNS listener.
+func performHealthCheck(apiAddr, configPath string, detailed, dnsProbe bool) int {
 	// If API address not provided, try to load from config
-	if apiAddr == "" {
+	if apiAddr == "" || dnsProbe {
 		cfg, err := config.Load(configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Health check failed: cannot load config: %v\n", err)
 			return 1
 		}
-		apiAddr = cfg.Server.WebUIAddress
-
-		// If WebUIAddress doesn't have http:// prefix, add it
-		if apiAddr != "" && apiAddr[0] == ':' {
-			apiAddr = "http://localhost" + apiAddr
-		} else if !strings.HasPrefix(apiAddr, "http://") && !strings.HasPrefix(apiAddr, "https://") {
-			apiAddr = "http://" + apiAddr
+		if apiAddr == "" {
+			apiAddr = apiBaseURL(cfg.Server.WebUIAddress)
+		}
+		if dnsProbe {
+			if err := checkHealthName(cfg); err != nil {
+				fmt.Fprintf(os.Stderr, "Health check failed: DNS: %v\n", err)
+				return 1
+			}
 		}
 	}
 
@@ -1477,6 +1763,9 @@ func performHealthCheck(apiAddr, configPath string) int {
 	}
 
 	healthURL := apiAddr + "/api/health"
+	if detailed {
+		healthURL += "/detailed"
+	}
 	resp, err := client.Get(healthURL)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
@@ -1559,6 +1848,193 @@ func runImportPihole(args []string) {
 	}
 }
 
+// runExportConfig prints the effective configuration: the config file after
+// defaults and environment overrides, as the server would load it.
+func runExportConfig(args []string) {
+	fs := flag.NewFlagSet("export-config", flag.ExitOnError)
+	path := fs.String("config", "config.yml", "Path to configuration file")
+	redact := fs.Bool("redact", false, "Mask secrets (API key, passwords, password hash, API tokens)")
+	allowDebugOpts := fs.Bool("allow-debug", false, "Permit server.debug options (development only)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole export-config [OPTIONS]\n\n")
+		fmt.Fprintf(os.Stderr, "Print the fully-resolved configuration (defaults and env overrides applied) as YAML.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole export-config --config /etc/glory-hole/config.yml\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole export-config --redact > effective-config.yml\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+	config.SetAllowDebug(*allowDebugOpts)
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *redact {
+		if cfg, err = cfg.Redacted(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	data, err := config.Marshal(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(data)
+}
+
+// runExportRecords prints local_records.records as JSON or a zone file.
+func runExportRecords(args []string) {
+	fs := flag.NewFlagSet("export-records", flag.ExitOnError)
+	path := fs.String("config", "config.yml", "Path to configuration file")
+	format := fs.String("format", config.LocalRecordsFormatJSON, "Output format: json or zone")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole export-records [OPTIONS]\n\n")
+		fmt.Fprintf(os.Stderr, "Print the configured local DNS records and static answers for backup or another instance.\n")
+		fmt.Fprintf(os.Stderr, "Zone output holds the records only.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole export-records --config /etc/glory-hole/config.yml > records.json\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole export-records --format zone > records.zone\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := config.ExportLocalRecords(cfg.LocalRecords.Records, cfg.StaticAnswers, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	_, _ = os.Stdout.Write(data)
+}
+
+// runImportRecords merges (or with --replace, swaps in) local records and
+// static answers from an export-records file and writes them back to the
+// config file. A running server picks the change up through its config
+// watcher.
+func runImportRecords(args []string) {
+	fs := flag.NewFlagSet("import-records", flag.ExitOnError)
+	path := fs.String("config", "config.yml", "Path to configuration file")
+	replace := fs.Bool("replace", false, "Replace all local records (and static answers, if the file has them) instead of merging")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole import-records [OPTIONS] FILE\n\n")
+		fmt.Fprintf(os.Stderr, "Import local DNS records (JSON or zone file, \"-\" for stdin) into the config file.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole import-records --config /etc/glory-hole/config.yml records.json\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole import-records --replace records.zone\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	doc, err := config.ImportLocalRecords(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	added, answersAdded := cfg.ApplyLocalRecordsImport(doc, *replace)
+	if err := config.Save(*path, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d records (%d added, %d total) and %d static answers (%d added)\n",
+		len(doc.Records), added, len(cfg.LocalRecords.Records), len(doc.StaticAnswers), answersAdded)
+}
+
+func runSetRecordEnabled(name string, args []string, enabled bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	path := fs.String("config", "config.yml", "Path to configuration file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole %s [OPTIONS] DOMAIN TYPE\n\n", name)
+		if enabled {
+			fmt.Fprintf(os.Stderr, "Serve a disabled local DNS record again.\n\n")
+		} else {
+			fmt.Fprintf(os.Stderr, "Stop serving a local DNS record without removing it from the config.\n\n")
+		}
+		fmt.Fprintf(os.Stderr, "A running server picks up the change through config hot-reload.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole %s --config /etc/glory-hole/config.yml nas.local A\n\n", name)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	domain, recordType := fs.Arg(0), fs.Arg(1)
+	n := config.SetLocalRecordEnabled(cfg.LocalRecords.Records, domain, recordType, enabled)
+	if n == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no %s record for %s\n", strings.ToUpper(recordType), domain)
+		os.Exit(1)
+	}
+	if err := config.Save(*path, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	state := "Disabled"
+	if enabled {
+		state = "Enabled"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d %s record(s) for %s\n", state, n, strings.ToUpper(recordType), domain)
+}
+
 func runHashPassword(args []string) {
 	fs := flag.NewFlagSet("hash-password", flag.ExitOnError)
 	cost := fs.Int("cost", 12, "Bcrypt cost parameter (10-14 recommended, higher = more secure but slower)")
@@ -1625,3 +2101,96 @@ func runHashPassword(args []string) {
 	fmt.Printf("\n# IMPORTANT: Remove the plaintext 'password' field when using password_hash!\n")
 	fmt.Printf("# The password_hash field takes precedence over password.\n")
 }
+
+// runReloadBlocklists asks a running server to re-download its blocklists via
+// POST /api/blocklist/reload?wait=true and prints the per-source results. The
+// API address and key come from the config file unless given as flags.
+func runReloadBlocklists(args []string) {
+	fs := flag.NewFlagSet("reload-blocklists", flag.ExitOnError)
+	path := fs.String("config", "config.yml", "Path to configuration file (for the API address and key)")
+	apiAddr := fs.String("api", "", "API base URL (default: from server.web_ui_address)")
+	apiKey := fs.String("api-key", "", "API key (default: auth.api_key or GLORYHOLE_API_KEY)")
+	asJSON := fs.Bool("json", false, "Print the raw JSON response")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: glory-hole reload-blocklists [OPTIONS]\n\n")
+		fmt.Fprintf(os.Stderr, "Force a running server to re-download all blocklists now.\n\n")
+		fmt.Fprintf(os.Stderr, "Examples:\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole reload-blocklists --config /etc/glory-hole/config.yml\n")
+		fmt.Fprintf(os.Stderr, "  glory-hole reload-blocklists --api http://10.0.0.53:8080 --api-key $KEY --json\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse flags: %v\n", err)
+		os.Exit(1)
+	}
+
+	base, key := *apiAddr, *apiKey
+	if base == "" || key == "" {
+		cfg, err := config.Load(*path)
+		if err != nil && base == "" {
+			fmt.Fprintf(os.Stderr, "Error: cannot load config (use --api): %v\n", err)
+			os.Exit(1)
+		}
+		if cfg != nil {
+			if base == "" {
+				base = apiBaseURL(cfg.Server.WebUIAddress)
+			}
+			if key == "" {
+				key = cfg.Auth.APIKey
+			}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(base, "/")+"/api/blocklist/reload?wait=true", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := (&http.Client{Timeout: 6 * time.Minute}).Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Reload failed: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		os.Exit(1)
+	}
+	if *asJSON {
+		_, _ = os.Stdout.Write(body)
+		return
+	}
+
+	var result api.BlocklistsReloadResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: unexpected response: %v\n", err)
+		os.Exit(1)
+	}
+	for _, src := range result.Sources {
+		label := src.URL
+		if src.Name != "" {
+			label = src.Name + " <" + src.URL + ">"
+		}
+		if src.Error != "" {
+			fmt.Printf("FAIL  %s: %s\n", label, src.Error)
+		} else {
+			fmt.Printf("OK    %s (%d domains)\n", label, src.Domains)
+		}
+	}
+	fmt.Printf("Blocklists reloaded: %d domains in %dms (%s)\n", result.Domains, result.DurationMs, result.Status)
+	if result.Status != "ok" {
+		os.Exit(2)
+	}
+}
@@ -171,6 +171,30 @@ func TestMigrateWhitelistToPolicies_NoStorage_AppendsToConfig(t *testing.T) {
 	}
 }
 
+// TestMigrateWhitelistToPolicies_NormalizesIDN checks Unicode whitelist entries
+// become punycode rules, since that's the form queries arrive in.
+func TestMigrateWhitelistToPolicies_NormalizesIDN(t *testing.T) {
+	logger := logging.NewDefault()
+	cfg := &config.Config{Whitelist: []string{"München.de", "*.köln.de"}}
+	cfgPath := writeConfigFile(t, cfg)
+
+	if !migrateWhitelistToPolicies(cfg, nil, cfgPath, logger) {
+		t.Fatal("expected migration to run with no storage")
+	}
+	want := []string{
+		`Domain == "xn--mnchen-3ya.de"`,
+		`Domain == "xn--kln-sna.de" || DomainEndsWith(Domain, ".xn--kln-sna.de")`,
+	}
+	if len(cfg.Policy.Rules) != len(want) {
+		t.Fatalf("want %d rules, got %d", len(want), len(cfg.Policy.Rules))
+	}
+	for i, w := range want {
+		if cfg.Policy.Rules[i].Logic != w {
+			t.Errorf("rule %d logic = %q, want %q", i, cfg.Policy.Rules[i].Logic, w)
+		}
+	}
+}
+
 // TestMigrateWhitelistToPolicies_PersistFailureNonFatal ensures a read-only
 // config path doesn't cause a panic / abort — the sentinel + UNIQUE index
 // keep idempotency even when YAML can't be rewritten.
@@ -420,3 +444,35 @@ func TestBuildPolicyLogicFromCFRule_Permutations(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSProbeAddress(t *testing.T) {
+	tests := map[string]string{
+		":53":            "127.0.0.1:53",
+		"0.0.0.0:5353":   "127.0.0.1:5353",
+		"[::]:53":        "[::1]:53",
+		"192.168.1.2:53": "192.168.1.2:53",
+		"not-an-address": "127.0.0.1:53",
+	}
+	for listen, want := range tests {
+		if got := dnsProbeAddress(listen); got != want {
+			t.Errorf("dnsProbeAddress(%q) = %q, want %q", listen, got, want)
+		}
+	}
+}
+
+func TestWarnUnknownAllowedTypesGroups(t *testing.T) {
+	stor, _ := newTestStorage(t)
+	ctx := context.Background()
+	if err := stor.UpsertClientGroup(ctx, &storage.ClientGroup{Name: "kids"}); err != nil {
+		t.Fatalf("UpsertClientGroup: %v", err)
+	}
+
+	unknown := warnUnknownAllowedTypesGroups(ctx, stor, map[string][]string{
+		"kids":   {"A", "AAAA"},
+		"guests": {"A"},
+		"iot":    {"A"},
+	}, logging.NewDefault())
+	if len(unknown) != 2 || unknown[0] != "guests" || unknown[1] != "iot" {
+		t.Errorf("unknown = %v, want [guests iot]", unknown)
+	}
+}
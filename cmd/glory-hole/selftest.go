@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/resolver"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+// selfTestDomain is resolved through every upstream by --self-test.
+const selfTestDomain = "example.com"
+
+// selfTestOptions bounds the checks so a dead upstream or list host fails
+// the test instead of hanging it.
+type selfTestOptions struct {
+	domain          string
+	upstreamTimeout time.Duration
+	downloadTimeout time.Duration
+}
+
+// selfTestResult is the outcome of one check.
+type selfTestResult struct {
+	kind   string // "upstream", "blocklist" or "database"
+	target string
+	detail string
+	err    error
+}
+
+// selfTest checks the components a config depends on before it goes live:
+// each upstream resolves opts.domain, each blocklist downloads and parses,
+// and the query log database opens. Upstreams and blocklists are built with
+// the same constructors the server uses; the database is only opened
+// read-only, so the check never migrates it or applies a staged restore. A
+// managed Unbound isn't started, so the configured upstream_dns_servers are
+// tested as written.
+func selfTest(ctx context.Context, cfg *config.Config, logger *logging.Logger, opts selfTestOptions) []selfTestResult {
+	var results []selfTestResult
+
+	fwd := forwarder.NewForwarder(cfg, logger, nil)
+	fwd.SetTimeout(opts.upstreamTimeout)
+	for _, upstream := range fwd.Upstreams() {
+		results = append(results, selfTestUpstream(ctx, fwd, upstream, opts.domain))
+	}
+
+	if len(cfg.Blocklists) > 0 {
+		httpClient := resolver.New(cfg.UpstreamDNSServers, logger).NewHTTPClient(opts.downloadTimeout)
+		downloader := blocklist.NewDownloader(logger, httpClient)
+		for _, url := range cfg.Blocklists {
+			res := selfTestResult{kind: "blocklist", target: url}
+			list, err := downloader.DownloadListAuth(ctx, url, cfg.BlocklistAuth[url])
+			switch {
+			case err != nil:
+				res.err = err
+			case len(list.Domains) == 0:
+				res.err = fmt.Errorf("no domains parsed")
+			default:
+				res.detail = fmt.Sprintf("%d domains", len(list.Domains))
+			}
+			results = append(results, res)
+		}
+	}
+
+	if cfg.Database.Enabled {
+		res := selfTestResult{kind: "database", target: cfg.Database.SQLite.Path}
+		res.detail, res.err = storage.CheckSQLite(ctx, &cfg.Database)
+		results = append(results, res)
+	}
+
+	return results
+}
+
+// selfTestUpstream resolves domain through a single upstream and expects a
+// NOERROR answer.
+func selfTestUpstream(ctx context.Context, fwd *forwarder.Forwarder, upstream, domain string) selfTestResult {
+	res := selfTestResult{kind: "upstream", target: upstream}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	start := time.Now()
+	resp, err := fwd.ForwardWithUpstreams(ctx, m, []string{upstream})
+	switch {
+	case err != nil:
+		res.err = err
+	case resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0:
+		res.err = fmt.Errorf("%s answered %s with %d records", domain, dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	default:
+		res.detail = fmt.Sprintf("%s in %s", domain, time.Since(start).Round(time.Millisecond))
+	}
+	return res
+}
+
+// printSelfTest writes one line per check and a summary, returning the
+// number of failed checks.
+func printSelfTest(w io.Writer, results []selfTestResult) int {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "FAIL  %-9s  %s: %v\n", r.kind, r.target, r.err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "PASS  %-9s  %s (%s)\n", r.kind, r.target, r.detail)
+	}
+	if failed > 0 {
+		_, _ = fmt.Fprintf(w, "Self-test failed: %d of %d checks failed.\n", failed, len(results))
+	} else {
+		_, _ = fmt.Fprintf(w, "Self-test passed: %d checks.\n", len(results))
+	}
+	return failed
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+func TestSelfTest(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+		m.Answer = append(m.Answer, rr)
+		_ = w.WriteMsg(m)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	// A port nothing answers on: bind one and close it again.
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := dead.LocalAddr().String()
+	_ = dead.Close()
+
+	lists := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ads.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "0.0.0.0 ads.example.com")
+		_, _ = fmt.Fprintln(w, "0.0.0.0 tracker.example.com")
+	}))
+	t.Cleanup(lists.Close)
+
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{pc.LocalAddr().String(), deadAddr},
+		Blocklists:         []string{lists.URL + "/ads.txt", lists.URL + "/missing.txt"},
+		Database:           storage.DefaultConfig(),
+	}
+	cfg.Database.Enabled = true
+	cfg.Database.SQLite.Path = filepath.Join(t.TempDir(), "gh.db")
+
+	results := selfTest(context.Background(), cfg, logging.NewDefault(), selfTestOptions{
+		domain:          "example.com",
+		upstreamTimeout: 500 * time.Millisecond,
+		downloadTimeout: 5 * time.Second,
+	})
+
+	want := map[string]bool{
+		"upstream " + pc.LocalAddr().String():     true,
+		"upstream " + deadAddr:                    false,
+		"blocklist " + lists.URL + "/ads.txt":     true,
+		"blocklist " + lists.URL + "/missing.txt": false,
+		"database " + cfg.Database.SQLite.Path:    true,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for _, r := range results {
+		key := r.kind + " " + r.target
+		pass, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected check %q", key)
+			continue
+		}
+		if pass != (r.err == nil) {
+			t.Errorf("%s: err = %v, want pass = %v", key, r.err, pass)
+		}
+	}
+
+	var out strings.Builder
+	if failed := printSelfTest(&out, results); failed != 2 {
+		t.Errorf("printSelfTest reported %d failures, want 2", failed)
+	}
+	if !strings.Contains(out.String(), "Self-test failed: 2 of 5 checks failed.") {
+		t.Errorf("missing summary in output:\n%s", out.String())
+	}
+}
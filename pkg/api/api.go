@@ -46,6 +46,9 @@ type Server struct {
 	version           string
 	configPath        string         // Path to config file for persistence
 	allowedOrigins    []string       // Allowed CORS origins
+	dohPath           string         // DoH endpoint path ("" = config.DefaultDoHPath)
+	dohOrigins        []string       // Extra CORS origins allowed on the DoH endpoint only
+	acmeChallenge     http.Handler   // DoT autocert HTTP-01 responder (nil unless tls.autocert.http01_via_api)
 	blockPageEnabled  atomic.Bool    // Serve block page for unrecognized hosts
 	trustedProxies    []*net.IPNet   // CIDRs whose proxy headers (X-Forwarded-For) are trusted
 	bgWg              sync.WaitGroup // Tracks background goroutines for clean shutdown
@@ -111,6 +114,9 @@ func New(cfg *Config) *Server {
 		} else {
 			cfg.Logger.Info("CORS configured", "allowed_origins", s.allowedOrigins)
 		}
+		s.dohPath = cfg.InitialConfig.Server.DoH.Path
+		s.dohOrigins = cfg.InitialConfig.Server.DoH.CORSAllowedOrigins
+		s.acmeChallenge = dns.AutocertChallengeHandler(&cfg.InitialConfig.Server)
 
 		// Parse trusted proxy CIDRs for X-Forwarded-For / X-Real-IP
 		for _, entry := range cfg.InitialConfig.Server.TrustedProxies {
@@ -140,12 +146,14 @@ func New(cfg *Config) *Server {
 	mux := http.NewServeMux()
 
 	// DNS-over-HTTPS (DoH) endpoint - RFC 8484 compatible
-	mux.HandleFunc("/dns-query", s.handleDNSQuery)
+	mux.HandleFunc(s.dohPathOrDefault(), s.handleDNSQuery)
+	mux.HandleFunc(strings.TrimSuffix(s.dohPathOrDefault(), "/")+"/{token}", s.handleDNSQuery) // per-tenant tokens (server.doh.tokens)
 
 	// Health checks
-	mux.HandleFunc("/api/health", s.handleHealth) // Detailed health with uptime/version
-	mux.HandleFunc("/health", s.handleLiveness)   // Simple liveness check
-	mux.HandleFunc("/ready", s.handleReadiness)   // Readiness check with components
+	mux.HandleFunc("/api/health", s.handleHealth)                  // Basic health with uptime/version
+	mux.HandleFunc("/api/health/detailed", s.handleHealthDetailed) // Per-component status, 503 if a critical one is down
+	mux.HandleFunc("/health", s.handleLiveness)                    // Simple liveness check
+	mux.HandleFunc("/ready", s.handleReadiness)                    // Readiness check with components
 
 	// CSRF token (auth-required, GET only). Frontend fetches once after login,
 	// then sends X-CSRF-Token on all mutating /api/* calls.
@@ -154,16 +162,20 @@ func New(cfg *Config) *Server {
 	// Statistics
 	mux.HandleFunc("/api/stats", s.handleStats)
 	mux.HandleFunc("/api/stats/timeseries", s.handleStatsTimeSeries)
+	mux.HandleFunc("GET /api/stats/timeseries/{domain}", s.handleDomainTimeSeries)
 	mux.HandleFunc("/api/stats/query-types", s.handleQueryTypes)
+	mux.HandleFunc("GET /api/stats/upstreams", s.handleUpstreamLatency)
 
 	// Trace statistics
 	mux.HandleFunc("/api/traces/stats", s.handleTraceStatistics)
 
 	// Queries
 	mux.HandleFunc("/api/queries", s.handleQueries)
+	mux.HandleFunc("GET /api/queries/blocked", s.handleRecentBlocked)
 
 	// Top domains
 	mux.HandleFunc("/api/top-domains", s.handleTopDomains)
+	mux.HandleFunc("GET /api/top-clients", s.handleTopClients)
 
 	// Blocklist management
 	mux.HandleFunc("POST /api/blocklist/reload", s.handleBlocklistReload)
@@ -172,6 +184,10 @@ func New(cfg *Config) *Server {
 	mux.HandleFunc("POST /api/cache/purge", s.handleCachePurge)
 	mux.HandleFunc("POST /api/storage/reset", s.handleStorageReset)
 
+	// Database backup and restore
+	mux.HandleFunc("GET /api/admin/backup", s.handleBackup)
+	mux.HandleFunc("POST /api/admin/restore", s.handleRestore)
+
 	// Policy management
 	mux.HandleFunc("GET /api/policies", s.handleGetPolicies)
 	mux.HandleFunc("POST /api/policies", s.handleAddPolicy)
@@ -179,12 +195,18 @@ func New(cfg *Config) *Server {
 	mux.HandleFunc("PUT /api/policies/{id}", s.handleUpdatePolicy)
 	mux.HandleFunc("DELETE /api/policies/{id}", s.handleDeletePolicy)
 	mux.HandleFunc("GET /api/policies/export", s.handleExportPolicies)
+	mux.HandleFunc("GET /api/policies/stats", s.handleGetPolicyStats)
 	mux.HandleFunc("POST /api/policies/test", s.handleTestPolicy)
+	mux.HandleFunc("POST /api/policies/validate", s.handleValidatePolicy)
 
 	// Local Records management
 	mux.HandleFunc("GET /api/localrecords", s.handleGetLocalRecords)
 	mux.HandleFunc("POST /api/localrecords", s.handleAddLocalRecord)
 	mux.HandleFunc("DELETE /api/localrecords/{id}", s.handleRemoveLocalRecord)
+	mux.HandleFunc("POST /api/localrecords/{id}/enable", s.handleEnableLocalRecord)
+	mux.HandleFunc("POST /api/localrecords/{id}/disable", s.handleDisableLocalRecord)
+	mux.HandleFunc("GET /api/localrecords/export", s.handleExportLocalRecords)
+	mux.HandleFunc("POST /api/localrecords/import", s.handleImportLocalRecords)
 
 	// Conditional Forwarding — removed in v0.27, 410-Gone stub points at /api/policies
 	mux.HandleFunc("GET /api/conditionalforwarding", s.handleConditionalForwardingGone)
@@ -200,6 +222,8 @@ func New(cfg *Config) *Server {
 	mux.HandleFunc("POST /api/features/blocklist/enable", s.handleEnableBlocklist)
 	mux.HandleFunc("POST /api/features/policies/disable", s.handleDisablePolicies)
 	mux.HandleFunc("POST /api/features/policies/enable", s.handleEnablePolicies)
+	mux.HandleFunc("POST /api/features/logging/pause", s.handlePauseLogging)
+	mux.HandleFunc("POST /api/features/logging/resume", s.handleResumeLogging)
 
 	// Configuration surface
 	mux.HandleFunc("GET /api/config", s.handleGetConfig)
@@ -211,6 +235,8 @@ func New(cfg *Config) *Server {
 	mux.HandleFunc("PUT /api/config/allowed-clients", s.handleUpdateAllowedClients)
 
 	// UI page routes (Astro pre-rendered)
+	// Routes outside /api/ must be listed in config's reservedHTTPPaths, so
+	// a server.doh.path that would collide with them fails validation.
 	mux.HandleFunc("GET /queries", s.handleQueriesPage)
 	mux.HandleFunc("GET /policies", s.handlePoliciesPage)
 	mux.HandleFunc("GET /localrecords", s.handleLocalRecordsPage)
@@ -229,14 +255,20 @@ func New(cfg *Config) *Server {
 	// Client management APIs
 	mux.HandleFunc("GET /api/clients", s.handleGetClients)
 	mux.HandleFunc("PUT /api/clients/{client}", s.handleUpdateClient)
+	mux.HandleFunc("GET /api/clients/{client}/timeseries", s.handleClientTimeSeries)
 	mux.HandleFunc("GET /api/client-groups", s.handleGetClientGroups)
 	mux.HandleFunc("POST /api/client-groups", s.handleCreateClientGroup)
 	mux.HandleFunc("PUT /api/client-groups/{group}", s.handleUpdateClientGroup)
 	mux.HandleFunc("DELETE /api/client-groups/{group}", s.handleDeleteClientGroup)
+	mux.HandleFunc("GET /api/client-groups/{group}/members", s.handleGetClientGroupMembers)
+	mux.HandleFunc("PUT /api/client-groups/{group}/members/{client}", s.handleAddClientGroupMember)
+	mux.HandleFunc("DELETE /api/client-groups/{group}/members/{client}", s.handleRemoveClientGroupMember)
 
 	// Blocklist summary APIs
 	mux.HandleFunc("GET /api/blocklists", s.handleGetBlocklists)
 	mux.HandleFunc("GET /api/blocklists/check", s.handleCheckBlocklist)
+	mux.HandleFunc("GET /api/blocklist/lookup", s.handleBlocklistLookup)
+	mux.HandleFunc("POST /api/check", s.handleDomainCheck)
 	mux.HandleFunc("PUT /api/config/blocklists", s.handleUpdateBlocklistSources)
 
 	// Unbound resolver management
@@ -254,6 +286,11 @@ func New(cfg *Config) *Server {
 	mux.HandleFunc("GET /api/unbound/queries", s.handleGetUnboundQueries)
 	mux.HandleFunc("GET /api/unbound/query-stats", s.handleGetUnboundQueryStats)
 
+	// ACME HTTP-01 challenges for the DoT certificate (tls.autocert.http01_via_api)
+	if s.acmeChallenge != nil {
+		mux.Handle("GET "+acmeChallengePrefix, s.acmeChallenge)
+	}
+
 	// Astro build output: serve /_astro/* assets and /favicon.svg from dist/
 	if distFS, err := getAstroDistFS(); err == nil {
 		astroFileServer := http.FileServer(http.FS(distFS))
@@ -445,13 +482,33 @@ func (s *Server) writeJSON(w http.ResponseWriter, statusCode int, data interface
 	}
 }
 
-// writeError writes an error response
+// writeError writes an error response, coded after the HTTP status
 func (s *Server) writeError(w http.ResponseWriter, statusCode int, message string) {
-	s.writeJSON(w, statusCode, ErrorResponse{
-		Error:   http.StatusText(statusCode),
-		Code:    statusCode,
-		Message: message,
-	})
+	s.writeJSON(w, statusCode, newErrorResponse(errorCode(statusCode), message))
+}
+
+func newErrorResponse(code, message string) ErrorResponse {
+	return ErrorResponse{Error: ErrorDetail{Code: code, Message: message}}
+}
+
+// errorCode turns an HTTP status into an error code: 404 -> "not_found".
+func errorCode(statusCode int) string {
+	text := http.StatusText(statusCode)
+	if text == "" {
+		return "error"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		case r == '\'':
+			return -1
+		default:
+			return '_'
+		}
+	}, text)
 }
 
 // parseDuration parses a duration string with default value
@@ -8,9 +8,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"glory-hole/pkg/config"
 	"glory-hole/pkg/policy"
 	"glory-hole/pkg/storage"
 )
@@ -147,6 +149,23 @@ func TestWriteJSON_Error(t *testing.T) {
 	}
 }
 
+func TestErrorCode(t *testing.T) {
+	tests := map[int]string{
+		http.StatusBadRequest:            "bad_request",
+		http.StatusNotFound:              "not_found",
+		http.StatusTooManyRequests:       "too_many_requests",
+		http.StatusServiceUnavailable:    "service_unavailable",
+		http.StatusRequestEntityTooLarge: "request_entity_too_large",
+		http.StatusTeapot:                "im_a_teapot",
+		599:                              "error",
+	}
+	for status, want := range tests {
+		if got := errorCode(status); got != want {
+			t.Errorf("errorCode(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
 func TestGetUptime_Various(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 
@@ -400,6 +419,66 @@ func TestCORSMiddleware_Preflight(t *testing.T) {
 	}
 }
 
+func TestDoH_CustomPathAndCORS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	cfg := config.LoadWithDefaults()
+	cfg.Auth.Enabled = true
+	cfg.Auth.APIKey = "secret"
+	cfg.Server.CORSAllowedOrigins = []string{"https://ui.example.com"}
+	cfg.Server.DoH.Path = "/resolve"
+	cfg.Server.DoH.CORSAllowedOrigins = []string{"chrome-extension://abcdef"}
+
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Logger:        logger,
+		Version:       "test",
+		InitialConfig: cfg,
+	})
+
+	// The endpoint moves to the configured path and stays public.
+	req := httptest.NewRequest(http.MethodHead, "/resolve", nil)
+	w := httptest.NewRecorder()
+	server.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HEAD /resolve: expected 200 without auth, got %d", w.Code)
+	}
+
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, origin := range []string{"chrome-extension://abcdef", "https://ui.example.com"} {
+		w := preflight("/resolve", origin)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: preflight expected 200, got %d", origin, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: expected Allow-Origin echoed, got %q", origin, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Content-Type") {
+			t.Errorf("%s: expected Content-Type in Allow-Headers, got %q", origin, got)
+		}
+		if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+			t.Errorf("%s: DoH CORS should not allow credentials", origin)
+		}
+	}
+
+	// DoH-only origins get nothing on the rest of the API.
+	if got := preflight("/api/stats", "chrome-extension://abcdef").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("DoH-only origin should not be allowed on /api/, got Allow-Origin %q", got)
+	}
+	if got := preflight("/resolve", "https://evil.example.com").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("unlisted origin should not be allowed, got Allow-Origin %q", got)
+	}
+}
+
 func TestHandleUpdatePolicy_NameChange(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
 
@@ -453,3 +532,39 @@ func TestHandleUpdatePolicy_NameChange(t *testing.T) {
 		t.Errorf("Expected name 'New Name', got %s", rules[0].Name)
 	}
 }
+
+func TestACMEChallengeViaAPI(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	newServer := func(viaAPI bool) *Server {
+		cfg := config.LoadWithDefaults()
+		cfg.Auth.Enabled = true
+		cfg.Auth.APIKey = "secret"
+		cfg.Server.DotEnabled = true
+		cfg.Server.TLS.Autocert.Enabled = true
+		cfg.Server.TLS.Autocert.Hosts = []string{"dot.example.com"}
+		cfg.Server.TLS.Autocert.CacheDir = t.TempDir()
+		cfg.Server.TLS.Autocert.HTTP01ViaAPI = viaAPI
+		return New(&Config{
+			ListenAddress: ":8080",
+			Logger:        logger,
+			Version:       "test",
+			InitialConfig: cfg,
+		})
+	}
+	challenge := func(s *Server) int {
+		req := httptest.NewRequest(http.MethodGet, "http://dot.example.com/.well-known/acme-challenge/token123", nil)
+		w := httptest.NewRecorder()
+		s.handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Served without auth; an unknown token is a plain 404 from the responder.
+	if code := challenge(newServer(true)); code != http.StatusNotFound {
+		t.Errorf("via API: expected 404 for unknown token, got %d", code)
+	}
+	// Without the option the path is just another authenticated page.
+	if code := challenge(newServer(false)); code != http.StatusFound {
+		t.Errorf("standalone listener: expected login redirect on the API server, got %d", code)
+	}
+}
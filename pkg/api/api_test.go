@@ -23,7 +23,10 @@ type mockStorage struct {
 	timeseries  []*storage.TimeSeriesPoint
 	queryTypes  []*storage.QueryTypeStats
 	filtered    []*storage.QueryLog
+	clients     []*storage.ClientSummary
 	lastFilter  storage.QueryFilter
+	lastDomain  string
+	lastClient  string
 	resetErr    error
 	resetCalled bool
 }
@@ -39,6 +42,23 @@ func (m *mockStorage) GetRecentQueries(ctx context.Context, limit, offset int) (
 	return m.queries, nil
 }
 
+func (m *mockStorage) GetRecentBlocked(ctx context.Context, limit, offset int) ([]*storage.QueryLog, error) {
+	var blocked []*storage.QueryLog
+	for _, q := range m.queries {
+		if q.Blocked {
+			blocked = append(blocked, q)
+		}
+	}
+	if offset >= len(blocked) {
+		return nil, nil
+	}
+	blocked = blocked[offset:]
+	if len(blocked) > limit {
+		blocked = blocked[:limit]
+	}
+	return blocked, nil
+}
+
 func (m *mockStorage) GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*storage.QueryLog, error) {
 	return nil, nil
 }
@@ -64,6 +84,16 @@ func (m *mockStorage) GetTopDomains(ctx context.Context, limit int, blocked bool
 	return result, nil
 }
 
+func (m *mockStorage) CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error) {
+	var count int64
+	for _, d := range m.domains {
+		if d.Blocked == blocked {
+			count++
+		}
+	}
+	return count, nil
+}
+
 func (m *mockStorage) GetBlockedCount(ctx context.Context, since time.Time) (int64, error) {
 	return 0, nil
 }
@@ -83,6 +113,13 @@ func (m *mockStorage) GetQueriesFiltered(ctx context.Context, filter storage.Que
 	return []*storage.QueryLog{}, nil
 }
 
+func (m *mockStorage) CountQueriesFiltered(ctx context.Context, filter storage.QueryFilter, limit int) (int64, error) {
+	if len(m.filtered) > 0 {
+		return int64(len(m.filtered)), nil
+	}
+	return int64(len(m.queries)), nil
+}
+
 func (m *mockStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
 	if len(m.timeseries) == 0 {
 		return []*storage.TimeSeriesPoint{}, nil
@@ -90,6 +127,16 @@ func (m *mockStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Durati
 	return m.timeseries, nil
 }
 
+func (m *mockStorage) GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	m.lastDomain = domain
+	return m.GetTimeSeriesStats(ctx, bucket, points)
+}
+
+func (m *mockStorage) GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	m.lastClient = clientIP
+	return m.GetTimeSeriesStats(ctx, bucket, points)
+}
+
 func (m *mockStorage) GetTraceStatistics(ctx context.Context, since time.Time) (*storage.TraceStatistics, error) {
 	return &storage.TraceStatistics{
 		Since:    since,
@@ -133,8 +180,39 @@ func (m *mockStorage) ListClientProfiles(ctx context.Context) ([]*storage.Client
 	return nil, nil
 }
 
-func (m *mockStorage) GetClientSummaries(ctx context.Context, limit, offset int) ([]*storage.ClientSummary, error) {
-	return []*storage.ClientSummary{}, nil
+func (m *mockStorage) GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*storage.ClientSummary, error) {
+	if offset >= len(m.clients) {
+		return []*storage.ClientSummary{}, nil
+	}
+	clients := m.clients[offset:]
+	if len(clients) > limit {
+		clients = clients[:limit]
+	}
+	return clients, nil
+}
+
+func (m *mockStorage) CountClientSummaries(ctx context.Context, since time.Time) (int64, error) {
+	return int64(len(m.clients)), nil
+}
+
+func (m *mockStorage) GetTopClients(ctx context.Context, limit int, since time.Time) ([]*storage.ClientSummary, error) {
+	clients := m.clients
+	if limit > 0 && limit < len(clients) {
+		clients = clients[:limit]
+	}
+	return clients, nil
+}
+
+func (m *mockStorage) SetClientGroup(ctx context.Context, clientIP, groupName string) error {
+	return nil
+}
+
+func (m *mockStorage) SetClientHostname(ctx context.Context, clientIP, hostname string) error {
+	return nil
+}
+
+func (m *mockStorage) ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
 }
 
 func (m *mockStorage) UpdateClientProfile(ctx context.Context, profile *storage.ClientProfile) error {
@@ -311,6 +389,62 @@ func TestHandleStats(t *testing.T) {
 	}
 }
 
+// latencyStorage adds upstream latency summaries to mockStorage.
+type latencyStorage struct {
+	*mockStorage
+	since     time.Time
+	upstreams []*storage.UpstreamLatency
+}
+
+func (m *latencyStorage) GetUpstreamLatency(ctx context.Context, since time.Time) ([]*storage.UpstreamLatency, error) {
+	m.since = since
+	return m.upstreams, nil
+}
+
+func TestHandleUpstreamLatency(t *testing.T) {
+	mock := &latencyStorage{
+		mockStorage: &mockStorage{},
+		upstreams: []*storage.UpstreamLatency{
+			{Upstream: "1.1.1.1:53", Queries: 100, AvgMs: 12.5, P50Ms: 10, P95Ms: 30, P99Ms: 80},
+		},
+	}
+	server := New(&Config{ListenAddress: ":8080", Storage: mock})
+
+	w := httptest.NewRecorder()
+	server.handleUpstreamLatency(w, httptest.NewRequest(http.MethodGet, "/api/stats/upstreams?window=15m", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if age := time.Since(mock.since); age < 15*time.Minute || age > 16*time.Minute {
+		t.Errorf("window 15m queried since %v ago", age)
+	}
+
+	var resp struct {
+		Window    string                     `json:"window"`
+		Upstreams []*storage.UpstreamLatency `json:"upstreams"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Window != "15m0s" || len(resp.Upstreams) != 1 || resp.Upstreams[0].P99Ms != 80 {
+		t.Fatalf("unexpected response payload: %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleUpstreamLatency(w, httptest.NewRequest(http.MethodGet, "/api/stats/upstreams?window=-1h", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("negative window: status %d, want 400", w.Code)
+	}
+
+	// Backends without latency support report 501.
+	plain := New(&Config{ListenAddress: ":8080", Storage: &mockStorage{}})
+	w = httptest.NewRecorder()
+	plain.handleUpstreamLatency(w, httptest.NewRequest(http.MethodGet, "/api/stats/upstreams", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("unsupported backend: status %d, want 501", w.Code)
+	}
+}
+
 func TestHandleQueryTypes(t *testing.T) {
 	mock := &mockStorage{
 		queryTypes: []*storage.QueryTypeStats{
@@ -364,6 +498,30 @@ func TestHandleStats_NoStorage(t *testing.T) {
 	}
 }
 
+func TestHandleStats_ReportsSampleRate(t *testing.T) {
+	for _, tc := range []struct {
+		rate float64
+		want float64
+	}{{rate: 0.25, want: 0.25}, {rate: 1, want: 0}} {
+		server := New(&Config{
+			ListenAddress: ":8080",
+			Storage:       &mockStorage{},
+			InitialConfig: &config.Config{Database: storage.Config{SampleRate: tc.rate}},
+		})
+
+		w := httptest.NewRecorder()
+		server.handleStats(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+		var resp StatsResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.SampleRate != tc.want {
+			t.Errorf("sample_rate %v: expected %v in response, got %v", tc.rate, tc.want, resp.SampleRate)
+		}
+	}
+}
+
 func TestHandleGetConfig(t *testing.T) {
 	initial := &config.Config{
 		Server: config.ServerConfig{
@@ -496,6 +654,74 @@ func TestHandleStatsTimeSeries(t *testing.T) {
 	}
 }
 
+func TestHandleDomainTimeSeries(t *testing.T) {
+	mock := &mockStorage{
+		timeseries: []*storage.TimeSeriesPoint{
+			{Timestamp: time.Now().UTC(), TotalQueries: 7},
+		},
+	}
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats/timeseries/example.com.?period=hour&points=24", nil)
+	w := httptest.NewRecorder()
+	server.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if mock.lastDomain != "example.com" {
+		t.Errorf("storage queried for %q, want example.com", mock.lastDomain)
+	}
+
+	var response TimeSeriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Domain != "example.com" || response.Period != "hour" || response.Points != 24 {
+		t.Errorf("unexpected response metadata: %+v", response)
+	}
+	if len(response.Data) != 1 || response.Data[0].TotalQueries != 7 {
+		t.Errorf("unexpected data: %+v", response.Data)
+	}
+}
+
+func TestHandleClientTimeSeries(t *testing.T) {
+	mock := &mockStorage{
+		timeseries: []*storage.TimeSeriesPoint{
+			{Timestamp: time.Now().UTC(), TotalQueries: 9, BlockedQueries: 4},
+		},
+	}
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/clients/fd00::1/timeseries?period=day&points=7", nil)
+	w := httptest.NewRecorder()
+	server.handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if mock.lastClient != "fd00::1" {
+		t.Errorf("storage queried for %q, want fd00::1", mock.lastClient)
+	}
+
+	var response TimeSeriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Client != "fd00::1" || response.Period != "day" || response.Points != 7 {
+		t.Errorf("unexpected response metadata: %+v", response)
+	}
+	if len(response.Data) != 1 || response.Data[0].BlockedQueries != 4 || response.Data[0].TotalQueries != 9 {
+		t.Errorf("unexpected data: %+v", response.Data)
+	}
+}
+
 func TestHandleQueries(t *testing.T) {
 	now := time.Now()
 	mock := &mockStorage{
@@ -624,6 +850,60 @@ func TestHandleTopDomains(t *testing.T) {
 	}
 }
 
+func TestHandleTopClients(t *testing.T) {
+	mock := &mockStorage{
+		clients: []*storage.ClientSummary{
+			{ClientIP: "192.168.1.10", DisplayName: "Laptop", TotalQueries: 300, BlockedQueries: 40},
+			{ClientIP: "192.168.1.20", DisplayName: "192.168.1.20", TotalQueries: 120, BlockedQueries: 5},
+			{ClientIP: "192.168.1.30", DisplayName: "TV", TotalQueries: 80},
+		},
+	}
+
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/top-clients?limit=2&since=24h", nil)
+	w := httptest.NewRecorder()
+
+	server.handleTopClients(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var response TopClientsResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(response.Clients) != 2 || response.Limit != 2 {
+		t.Fatalf("expected 2 clients with limit 2, got %d (limit %d)", len(response.Clients), response.Limit)
+	}
+	if response.Clients[0].DisplayName != "Laptop" || response.Clients[0].BlockedQueries != 40 {
+		t.Errorf("unexpected first client: %+v", response.Clients[0])
+	}
+	if response.Since == nil {
+		t.Error("expected since to be echoed back")
+	}
+
+	// An unparseable window is rejected rather than read as 24h.
+	w = httptest.NewRecorder()
+	server.handleTopClients(w, httptest.NewRequest(http.MethodGet, "/api/top-clients?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status %d, want 400", w.Code)
+	}
+
+	// Backends that can't rank clients report 501.
+	plain := New(&Config{ListenAddress: ":8080", Storage: &mockStorageForHealth{}})
+	w = httptest.NewRecorder()
+	plain.handleTopClients(w, httptest.NewRequest(http.MethodGet, "/api/top-clients", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("unsupported backend: status %d, want 501", w.Code)
+	}
+}
+
 func TestHandleQueriesAppliesFilters(t *testing.T) {
 	mock := &mockStorage{
 		filtered: []*storage.QueryLog{},
@@ -657,6 +937,220 @@ func TestHandleQueriesAppliesFilters(t *testing.T) {
 	}
 }
 
+func TestHandleQueries_MatchedSourceDisplayName(t *testing.T) {
+	const malware = "https://lists.example.com/malware.txt"
+	mock := &mockStorage{
+		filtered: []*storage.QueryLog{
+			{ID: 1, Domain: "evil.example.com", Blocked: true, MatchedSource: malware, MatchedRule: "evil.example.com"},
+			{ID: 2, Domain: "social.example.com", Blocked: true, MatchedSource: "policy", MatchedRule: "no-social"},
+		},
+	}
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+		InitialConfig: &config.Config{
+			Blocklists:     []string{malware},
+			BlocklistNames: map[string]string{malware: "Malware"},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	server.handleQueries(w, httptest.NewRequest(http.MethodGet, "/api/queries?matched_source=Malware", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if mock.lastFilter.MatchedSource != malware {
+		t.Errorf("display name should filter on the list URL, got %q", mock.lastFilter.MatchedSource)
+	}
+
+	var resp QueriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if got := resp.Queries[0]; got.MatchedSource != "Malware" || got.MatchedURL != malware {
+		t.Errorf("list match: matched_source=%q url=%q, want Malware and the URL", got.MatchedSource, got.MatchedURL)
+	}
+	if got := resp.Queries[1]; got.MatchedSource != "policy" || got.MatchedURL != "" {
+		t.Errorf("policy match: matched_source=%q url=%q, want policy and no URL", got.MatchedSource, got.MatchedURL)
+	}
+}
+
+func TestHandleRecentBlocked(t *testing.T) {
+	now := time.Now()
+	mock := &mockStorage{
+		queries: []*storage.QueryLog{
+			{ID: 3, Timestamp: now, Domain: "ads.example.com", Blocked: true},
+			{ID: 2, Timestamp: now.Add(-time.Second), Domain: "example.com"},
+			{ID: 1, Timestamp: now.Add(-2 * time.Second), Domain: "tracker.example.com", Blocked: true},
+		},
+	}
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/queries/blocked?limit=10", nil)
+	w := httptest.NewRecorder()
+	server.handleRecentBlocked(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp QueriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Queries) != 2 || resp.Queries[0].Domain != "ads.example.com" || resp.Queries[1].Domain != "tracker.example.com" {
+		t.Fatalf("expected the two blocked queries newest first, got %+v", resp.Queries)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/queries/blocked?limit=1&offset=1", nil)
+	w = httptest.NewRecorder()
+	server.handleRecentBlocked(w, req)
+	resp = QueriesResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Queries) != 1 || resp.Queries[0].Domain != "tracker.example.com" || resp.Offset != 1 {
+		t.Errorf("expected second page with tracker.example.com, got %+v", resp)
+	}
+
+	server = New(&Config{ListenAddress: ":8080"})
+	w = httptest.NewRecorder()
+	server.handleRecentBlocked(w, httptest.NewRequest(http.MethodGet, "/api/queries/blocked", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without storage, got %d", w.Code)
+	}
+}
+
+func TestHandleQueriesCursor(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock := &mockStorage{
+		filtered: []*storage.QueryLog{
+			{ID: 42, Timestamp: ts, Domain: "a.example.com"},
+			{ID: 41, Timestamp: ts, Domain: "b.example.com"},
+		},
+	}
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       mock,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/queries?limit=2", nil)
+	w := httptest.NewRecorder()
+	server.handleQueries(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp QueriesResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.NextCursor == "" {
+		t.Fatal("expected next_cursor on a full page")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/queries?limit=2&offset=50&cursor="+resp.NextCursor, nil)
+	w = httptest.NewRecorder()
+	server.handleQueries(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	before := mock.lastFilter.Before
+	if before == nil || before.ID != 41 || !before.Timestamp.Equal(ts) {
+		t.Fatalf("expected cursor after id 41, got %+v", before)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/queries?limit=5", nil)
+	w = httptest.NewRecorder()
+	server.handleQueries(w, req)
+	resp = QueriesResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.NextCursor != "" {
+		t.Errorf("expected no next_cursor on a short page, got %q", resp.NextCursor)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/queries?cursor=not-a-cursor", nil)
+	w = httptest.NewRecorder()
+	server.handleQueries(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid cursor, got %d", w.Code)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock := &mockStorage{
+		filtered: []*storage.QueryLog{
+			{ID: 2, Timestamp: ts, Domain: "a.example.com"},
+			{ID: 1, Timestamp: ts, Domain: "b.example.com"},
+		},
+		domains: []*storage.DomainStats{
+			{Domain: "one.example.com", QueryCount: 30},
+			{Domain: "two.example.com", QueryCount: 20},
+			{Domain: "three.example.com", QueryCount: 10},
+		},
+		clients: []*storage.ClientSummary{
+			{ClientIP: "10.0.0.1"},
+			{ClientIP: "10.0.0.2"},
+			{ClientIP: "10.0.0.3"},
+		},
+	}
+	server := New(&Config{ListenAddress: ":8080", Storage: mock})
+
+	get := func(target string, out any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected status 200, got %d", target, w.Code)
+		}
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			t.Fatalf("GET %s: failed to decode response: %v", target, err)
+		}
+	}
+
+	var queries QueriesResponse
+	get("/api/queries?limit=5", &queries)
+	if want := (Pagination{Total: 2, Limit: 5, HasMore: false, TotalExact: true}); queries.Pagination != want {
+		t.Errorf("queries pagination = %+v, want %+v", queries.Pagination, want)
+	}
+
+	var domains TopDomainsResponse
+	get("/api/top-domains?limit=1&offset=1", &domains)
+	if len(domains.Domains) != 1 || domains.Domains[0].Domain != "two.example.com" {
+		t.Errorf("expected the second-ranked domain, got %+v", domains.Domains)
+	}
+	if want := (Pagination{Total: 3, Limit: 1, Offset: 1, HasMore: true, TotalExact: true}); domains.Pagination != want {
+		t.Errorf("top-domains pagination = %+v, want %+v", domains.Pagination, want)
+	}
+
+	var clients ClientsResponse
+	get("/api/clients?limit=2", &clients)
+	if len(clients.Clients) != 2 || !clients.HasMore || clients.Total != 3 {
+		t.Errorf("first client page = %d clients, %+v", len(clients.Clients), clients.Pagination)
+	}
+	clients = ClientsResponse{}
+	get("/api/clients?limit=2&offset=2", &clients)
+	if len(clients.Clients) != 1 || clients.HasMore {
+		t.Errorf("last client page = %d clients, %+v", len(clients.Clients), clients.Pagination)
+	}
+}
+
+func TestCountedPage(t *testing.T) {
+	// A capped total is a lower bound: a full page there still has more.
+	if page := countedPage(10, 0, 10, 10, false); !page.HasMore {
+		t.Errorf("expected more after a full page at the count cap, got %+v", page)
+	}
+	if page := countedPage(10, 0, 10, 10, true); page.HasMore {
+		t.Errorf("expected no more after an exact total, got %+v", page)
+	}
+	if page := uncountedPage(10, 20, 4); page.Total != 24 || page.HasMore || page.TotalExact {
+		t.Errorf("uncounted short page = %+v", page)
+	}
+}
+
 func TestHandleUpdateUpstreams_JSON(t *testing.T) {
 	server, configPath := newConfigTestServer(t, func(cfg *config.Config) {
 		cfg.UpstreamDNSServers = []string{"1.1.1.1:53"}
@@ -718,7 +1212,7 @@ func TestHandleUpdateCache_InvalidPayload(t *testing.T) {
 		t.Fatalf("failed to decode error response: %v", err)
 	}
 
-	if resp.Message == "" {
+	if resp.Error.Message == "" {
 		t.Fatal("expected validation error message")
 	}
 }
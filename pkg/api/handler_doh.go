@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,9 @@ import (
 	"strings"
 	"time"
 
+	"glory-hole/pkg/config"
+	dnspkg "glory-hole/pkg/dns"
+
 	"github.com/miekg/dns"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
@@ -19,14 +23,29 @@ import (
 // DNS-over-HTTPS (DoH) implementation
 // Compatible with Cloudflare's DNS-over-HTTPS API and RFC 8484
 
+const (
+	// dohDebugHeader on a DoH request asks for dohDecisionHeader on the
+	// response. It is honored only for callers the API would authenticate.
+	dohDebugHeader    = "X-GloryHole-Debug"
+	dohDecisionHeader = "X-GloryHole-Decision"
+)
+
 // dohResponseWriter captures DNS responses for HTTP conversion
 type dohResponseWriter struct {
 	msg      *dns.Msg
 	clientIP string
 }
 
+// dohAddr is the local address of a DoH query. Its network is "https" rather
+// than "tcp" because the writer keeps only one message, so the DNS handler
+// must not treat it as a stream connection (e.g. for zone transfers).
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "https" }
+func (dohAddr) String() string  { return "127.0.0.1:443" }
+
 func (w *dohResponseWriter) LocalAddr() net.Addr {
-	return &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443}
+	return dohAddr{}
 }
 
 func (w *dohResponseWriter) RemoteAddr() net.Addr {
@@ -93,12 +112,76 @@ type DNSJSONResponse struct {
 	EdnsClientSubnet string        `json:"edns_client_subnet,omitempty"`
 }
 
+// dohPathOrDefault returns the path the DoH endpoint is served on.
+func (s *Server) dohPathOrDefault() string {
+	if s.dohPath == "" {
+		return config.DefaultDoHPath
+	}
+	return s.dohPath
+}
+
+// dohPathToken splits a request path into the DoH endpoint and a tenant
+// token: the bare endpoint yields "", and <path>/<token> yields the token.
+// ok is false for paths that aren't the DoH endpoint.
+func (s *Server) dohPathToken(path string) (token string, ok bool) {
+	base := s.dohPathOrDefault()
+	if path == base {
+		return "", true
+	}
+	token, found := strings.CutPrefix(path, strings.TrimSuffix(base, "/")+"/")
+	if !found || token == "" || strings.Contains(token, "/") {
+		return "", false
+	}
+	return token, true
+}
+
+// isDoHPath reports whether path is served by the DoH endpoint.
+func (s *Server) isDoHPath(path string) bool {
+	_, ok := s.dohPathToken(path)
+	return ok
+}
+
+// redactDoHPath hides a tenant token in path so it doesn't reach the logs.
+func (s *Server) redactDoHPath(path string) string {
+	if token, ok := s.dohPathToken(path); ok && token != "" {
+		return strings.TrimSuffix(path, token) + "REDACTED"
+	}
+	return path
+}
+
+// dohClientGroup resolves the client group a DoH request is assigned by its
+// path token. The bare endpoint has no group and is refused only when
+// server.doh.require_token is set; unknown tokens are always refused.
+// Tokens are compared in constant time.
+func (s *Server) dohClientGroup(r *http.Request) (group string, allowed bool) {
+	token, _ := s.dohPathToken(r.URL.Path)
+	cfg := s.currentConfig()
+	if cfg == nil {
+		return "", token == ""
+	}
+	if token == "" {
+		return "", !cfg.Server.DoH.RequireToken
+	}
+	for _, t := range cfg.Server.DoH.Tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			group, allowed = t.Group, true
+		}
+	}
+	return group, allowed
+}
+
 // handleDNSQuery handles DNS-over-HTTPS requests
 // Supports GET (with query parameters), POST (wire format), and HEAD (health check)
 // Compatible with Cloudflare's DNS-over-HTTPS API
 func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
 	const transport = "doh"
 
+	group, allowed := s.dohClientGroup(r)
+	if !allowed {
+		s.handleDOHError(w, fmt.Errorf("unknown or missing DoH token"), http.StatusForbidden)
+		return
+	}
+
 	// HEAD request: Simple health check
 	if r.Method == http.MethodHead {
 		w.WriteHeader(http.StatusOK)
@@ -159,6 +242,18 @@ func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
 		dohWriter.msg = msg
 	} else {
 		ctx := r.Context()
+		if group != "" {
+			ctx = dnspkg.WithClientGroup(ctx, group)
+		}
+
+		var decision *dnspkg.Decision
+		var result dnspkg.QueryResult
+		if s.wantsDecisionHeader(r) {
+			q := dnsMsg.Question[0]
+			dec := s.dnsHandler.Explain(ctx, q.Name, clientIP, q.Qtype)
+			decision = &dec
+			ctx = dnspkg.WithQueryResult(ctx, &result)
+		}
 
 		// Observability parity with UDP/TCP path
 		start := time.Now()
@@ -185,15 +280,19 @@ func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
 			"domain", domain,
 			"type", queryTypeName,
 			"client", clientIP,
+			"group", group,
 		)
 
 		if metrics != nil {
 			attrs := []attribute.KeyValue{attribute.String("transport", transport)}
 			metrics.DNSQueriesTotal.Add(ctx, 1, metric.WithAttributes(attrs...))
-			metrics.DNSQueriesByType.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("type", queryTypeName))...))
+			metrics.DNSQueriesByType.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("type", metrics.QueryTypeLabel(queryTypeName)))...))
 		}
 
 		s.dnsHandler.ServeDNS(ctx, dohWriter, dnsMsg)
+		if decision != nil {
+			w.Header().Set(dohDecisionHeader, formatDecisionHeader(decision, &result))
+		}
 
 		dur := time.Since(start)
 		if metrics != nil {
@@ -236,6 +335,54 @@ func (s *Server) handleDNSQuery(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// wantsDecisionHeader reports whether a DoH request asked for the decision
+// header and may see it. DoH itself is unauthenticated, so with auth enabled
+// the caller must also present credentials the rest of the API accepts.
+func (s *Server) wantsDecisionHeader(r *http.Request) bool {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(dohDebugHeader))) {
+	case "1", "true", "yes":
+	default:
+		return false
+	}
+	return !s.isAuthenticationEnabled() || s.authorizeRequest(r)
+}
+
+// formatDecisionHeader renders the decision as "key=value" pairs, e.g.
+// `result=blocked; action=block; stage=policy; rule="Block ads"`. result is
+// what actually happened (including cache hits); the rest is the decision
+// /api/blocklist/lookup reports for the same query.
+func formatDecisionHeader(dec *dnspkg.Decision, res *dnspkg.QueryResult) string {
+	parts := make([]string, 0, 8)
+	add := func(key, value string) {
+		if value != "" {
+			parts = append(parts, key+"="+headerToken(value))
+		}
+	}
+	add("result", res.Outcome)
+	if res.Outcome != "" {
+		add("rcode", dns.RcodeToString[res.Rcode])
+	}
+	add("action", dec.Action)
+	add("stage", dec.Stage)
+	add("rule", dec.Rule)
+	add("category", dec.Category)
+	add("allow_overridden", dec.AllowOverridden)
+	add("upstream", res.Upstream)
+	add("detail", dec.Detail)
+	return strings.Join(parts, "; ")
+}
+
+// headerToken leaves simple values bare and quotes anything else as ASCII,
+// so rule names with spaces or non-ASCII characters stay a valid header.
+func headerToken(value string) string {
+	for _, c := range value {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`";\`, c) {
+			return strconv.QuoteToASCII(value)
+		}
+	}
+	return value
+}
+
 // parseDNSQueryGET parses DNS query from GET request query parameters
 func (s *Server) parseDNSQueryGET(r *http.Request) (*dns.Msg, error) {
 	query := r.URL.Query()
@@ -458,15 +605,5 @@ func (s *Server) handleDOHError(w http.ResponseWriter, err error, statusCode int
 	s.logger.Error("DoH request error", "error", err, "status", statusCode)
 
 	// Return generic error to clients — details are logged server-side above
-	response := map[string]interface{}{
-		"error":  http.StatusText(statusCode),
-		"status": statusCode,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		s.logger.Error("Failed to encode DoH error response", "error", err)
-	}
+	s.writeError(w, statusCode, http.StatusText(statusCode))
 }
@@ -9,8 +9,10 @@ import (
 	"strings"
 	"testing"
 
+	"glory-hole/pkg/config"
 	"glory-hole/pkg/dns"
 	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
 
 	mdns "github.com/miekg/dns"
 )
@@ -201,11 +203,9 @@ func TestHandleDNSQuery_POST_TooLarge(t *testing.T) {
 
 	// Verify error response is a valid JSON object with a generic error message
 	// (detailed error is logged server-side, not exposed to clients)
-	var errResp map[string]interface{}
-	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err == nil {
-		if _, ok := errResp["error"].(string); !ok {
-			t.Errorf("Expected error field in response, got: %v", errResp)
-		}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil || errResp.Error.Code != "bad_request" {
+		t.Errorf("Expected bad_request error envelope, got: %s", w.Body.String())
 	}
 }
 
@@ -385,6 +385,145 @@ func TestCalculateTTL(t *testing.T) {
 	}
 }
 
+func TestHandleDNSQuery_DecisionHeader(t *testing.T) {
+	server := createTestServerWithDNS()
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:    "Block ads",
+		Logic:   `Domain == "ads.test"`,
+		Action:  policy.ActionBlock,
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	server.dnsHandler.SetPolicyEngine(engine)
+
+	query := func(headers map[string]string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/dns-query?name=ads.test&type=A", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.handleDNSQuery(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		return w.Header().Get(dohDecisionHeader)
+	}
+
+	if got := query(nil); got != "" {
+		t.Errorf("expected no decision header without %s, got %q", dohDebugHeader, got)
+	}
+
+	got := query(map[string]string{dohDebugHeader: "1"})
+	for _, want := range []string{"result=blocked", "action=block", "stage=policy", `rule="Block ads"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("decision header %q missing %q", got, want)
+		}
+	}
+
+	// With auth on, the header is only for callers the API would accept.
+	server.authEnabled = true
+	server.apiKey = "secret"
+	server.authHeader = "X-API-Key"
+	if got := query(map[string]string{dohDebugHeader: "1"}); got != "" {
+		t.Errorf("expected no decision header for an unauthenticated caller, got %q", got)
+	}
+	if got := query(map[string]string{dohDebugHeader: "1", "X-API-Key": "secret"}); !strings.Contains(got, "result=blocked") {
+		t.Errorf("expected decision header for an authenticated caller, got %q", got)
+	}
+}
+
+func TestHandleDNSQuery_TokenClientGroup(t *testing.T) {
+	cfg := config.LoadWithDefaults()
+	cfg.Auth.Enabled = true
+	cfg.Auth.APIKey = "secret"
+	cfg.Server.DoH.Tokens = []config.DoHTokenConfig{{Token: "kids-7f3a", Group: "kids"}}
+
+	handler := dns.NewHandler()
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:       "No games for kids",
+		Logic:      `InClientGroup(ClientIP, "kids") && Domain == "games.test"`,
+		Action:     policy.ActionRedirect,
+		ActionData: "10.0.0.1",
+		Enabled:    true,
+	}); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	handler.SetPolicyEngine(engine)
+
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Logger:        logging.NewDefault().Logger,
+		Version:       "test",
+		InitialConfig: cfg,
+		DNSHandler:    handler,
+	})
+
+	query := func(path string) (int, DNSJSONResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path+"?name=games.test&type=A", nil)
+		req.Header.Set("Accept", "application/dns-json")
+		w := httptest.NewRecorder()
+		server.handler.ServeHTTP(w, req)
+		var resp DNSJSONResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: bad JSON: %v", path, err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// The token's group applies without auth; the bare path has no group.
+	code, resp := query("/dns-query/kids-7f3a")
+	if code != http.StatusOK {
+		t.Fatalf("token path: expected 200, got %d", code)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].Data != "10.0.0.1" {
+		t.Errorf("token path: expected the kids redirect, got %+v", resp.Answer)
+	}
+	if code, resp := query("/dns-query"); code != http.StatusOK || len(resp.Answer) != 0 {
+		t.Errorf("bare path: expected 200 and no redirect, got %d %+v", code, resp.Answer)
+	}
+
+	if code, _ := query("/dns-query/wrong"); code != http.StatusForbidden {
+		t.Errorf("unknown token: expected 403, got %d", code)
+	}
+	if code, _ := query("/dns-query/kids-7f3a/extra"); code == http.StatusOK {
+		t.Errorf("nested path: expected refusal, got 200")
+	}
+
+	cfg.Server.DoH.RequireToken = true
+	if code, _ := query("/dns-query"); code != http.StatusForbidden {
+		t.Errorf("bare path with require_token: expected 403, got %d", code)
+	}
+	if code, _ := query("/dns-query/kids-7f3a"); code != http.StatusOK {
+		t.Errorf("token path with require_token: expected 200, got %d", code)
+	}
+
+	if got := server.redactDoHPath("/dns-query/kids-7f3a"); got != "/dns-query/REDACTED" {
+		t.Errorf("redactDoHPath() = %q", got)
+	}
+}
+
+func TestHeaderToken(t *testing.T) {
+	tests := map[string]string{
+		"policy":     "policy",
+		"1.1.1.1:53": "1.1.1.1:53",
+		"Block ads":  `"Block ads"`,
+		`say "hi"`:   `"say \"hi\""`,
+		"r\u00e8gle": `"r\u00e8gle"`,
+	}
+	for in, want := range tests {
+		if got := headerToken(in); got != want {
+			t.Errorf("headerToken(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
 // Helper functions
 
 func createTestServer() *Server {
@@ -16,6 +16,14 @@ const (
 	statusOK            = "ok"
 	statusNotConfigured = "not_configured"
 	maxTimeSeriesPoints = 720
+
+	// maxListCount caps the count behind a list endpoint's total, so counting
+	// a filter that matches millions of rows costs no more than a deep page.
+	maxListCount = 100_000
+
+	// maxTopDomainsOffset bounds top-domains paging: the ranking has no
+	// keyset, so each page re-reads every row before it.
+	maxTopDomainsOffset = 1000
 )
 
 // handleHealth handles GET /api/health
@@ -155,6 +163,10 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 		response.TemperatureAvailable = true
 	}
 
+	if cfg := s.currentConfig(); cfg != nil && cfg.Database.SampleRate > 0 && cfg.Database.SampleRate < 1 {
+		response.SampleRate = cfg.Database.SampleRate
+	}
+
 	if stats != nil {
 		response.TotalQueries = stats.TotalQueries
 		response.BlockedQueries = stats.BlockedQueries
@@ -201,6 +213,43 @@ func (s *Server) handleStatsTimeSeries(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// handleDomainTimeSeries handles GET /api/stats/timeseries/{domain}: the
+// same buckets as /api/stats/timeseries, counting only queries for domain.
+func (s *Server) handleDomainTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+
+	domain := strings.TrimSuffix(strings.TrimSpace(r.PathValue("domain")), ".")
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	periodDuration, normalizedPeriod := parseTimeSeriesPeriod(r.URL.Query().Get("period"))
+	points := parseTimeSeriesPoints(r.URL.Query().Get("points"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	series, err := s.storage.GetDomainTimeSeries(ctx, domain, periodDuration, points)
+	if err != nil {
+		s.logger.Error("Failed to get domain time-series statistics", "domain", domain, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve time-series statistics")
+		return
+	}
+
+	response := TimeSeriesResponse{
+		Period: normalizedPeriod,
+		Points: points,
+		Domain: domain,
+		Data:   convertTimeSeriesPoints(series),
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
 // handleQueryTypes handles GET /api/stats/query-types
 func (s *Server) handleQueryTypes(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -242,6 +291,49 @@ func (s *Server) handleQueryTypes(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, response)
 }
 
+// handleUpstreamLatency handles GET /api/stats/upstreams. It reports
+// per-upstream p50/p95/p99 exchange times from the query log over ?window=
+// (default 1h).
+func (s *Server) handleUpstreamLatency(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+	reporter, ok := s.storage.(storage.UpstreamLatencyReporter)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, "Storage backend does not support upstream latency")
+		return
+	}
+
+	window := time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			s.writeError(w, http.StatusBadRequest, "window must be a positive duration (e.g. 15m, 1h, 24h)")
+			return
+		}
+		window = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	upstreams, err := reporter.GetUpstreamLatency(ctx, time.Now().Add(-window))
+	if err != nil {
+		s.logger.Error("Failed to get upstream latency", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve upstream latency")
+		return
+	}
+	if upstreams == nil {
+		upstreams = []*storage.UpstreamLatency{}
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"window":    window.String(),
+		"upstreams": upstreams,
+	})
+}
+
 // handleGetConfig handles GET /api/config
 func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -328,11 +420,23 @@ func (s *Server) handleQueries(w http.ResponseWriter, r *http.Request) {
 			s.writeError(w, http.StatusInternalServerError, "Failed to retrieve queries")
 			return
 		}
-		s.writeQueriesResponse(w, queries, limit, offset)
+		// Trace filters match inside block_trace and can't be counted.
+		s.writeQueriesResponse(w, queries, uncountedPage(limit, offset, len(queries)), "") // trace filters don't support cursors
 		return
 	}
 
 	filter := buildQueryFilterFromRequest(r)
+	filter.MatchedSource = s.matchedSourceURL(filter.MatchedSource)
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		before, err := storage.DecodeQueryCursor(cursor)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		filter.Before = before
+		offset = 0 // the cursor already marks the position
+	}
+
 	queries, err := s.storage.GetQueriesFiltered(ctx, filter, limit, offset)
 	if err != nil {
 		s.logger.Error("Failed to get queries", "error", err)
@@ -340,7 +444,53 @@ func (s *Server) handleQueries(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.writeQueriesResponse(w, queries, limit, offset)
+	nextCursor := ""
+	if len(queries) == limit {
+		nextCursor = storage.CursorAfter(queries[len(queries)-1]).Encode()
+	}
+
+	page := uncountedPage(limit, offset, len(queries))
+	if total, err := s.storage.CountQueriesFiltered(ctx, filter, maxListCount); err != nil {
+		// The page itself is fine; report it without a total.
+		s.logger.Warn("Failed to count queries", "error", err)
+	} else {
+		page = countedPage(limit, offset, len(queries), total, total < maxListCount)
+	}
+	if filter.Before != nil {
+		// The total spans the whole filter, not just the rows past the cursor.
+		page.HasMore = nextCursor != ""
+	}
+	s.writeQueriesResponse(w, queries, page, nextCursor)
+}
+
+// handleRecentBlocked handles GET /api/queries/blocked: the newest blocked
+// queries for the dashboard feed, served from the (blocked, timestamp) index
+// instead of filtering the full query log.
+func (s *Server) handleRecentBlocked(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		limit = l
+	}
+	offset := 0
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	queries, err := s.storage.GetRecentBlocked(ctx, limit, offset)
+	if err != nil {
+		s.logger.Error("Failed to get blocked queries", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve blocked queries")
+		return
+	}
+	s.writeQueriesResponse(w, queries, uncountedPage(limit, offset, len(queries)), "")
 }
 
 // handleTopDomains handles GET /api/top-domains
@@ -365,6 +515,11 @@ func (s *Server) handleTopDomains(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	offset := parseNonNegativeInt(r.URL.Query().Get("offset"), 0)
+	if offset > maxTopDomainsOffset {
+		offset = maxTopDomainsOffset
+	}
+
 	blockedParam := r.URL.Query().Get("blocked")
 	blocked := blockedParam == "true"
 
@@ -385,12 +540,26 @@ func (s *Server) handleTopDomains(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
 	defer cancel()
 
-	domains, err := s.storage.GetTopDomains(ctx, limit, blocked, sinceTime)
+	// The ranking sorts every domain anyway, so reading the rows before the
+	// page costs little beyond transferring them.
+	domains, err := s.storage.GetTopDomains(ctx, offset+limit, blocked, sinceTime)
 	if err != nil {
 		s.logger.Error("Failed to get top domains", "error", err)
 		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve top domains")
 		return
 	}
+	if offset < len(domains) {
+		domains = domains[offset:]
+	} else {
+		domains = nil
+	}
+
+	page := uncountedPage(limit, offset, len(domains))
+	if total, err := s.storage.CountDomains(ctx, blocked, sinceTime, maxListCount); err != nil {
+		s.logger.Warn("Failed to count domains", "error", err)
+	} else {
+		page = countedPage(limit, offset, len(domains), total, total < maxListCount)
+	}
 
 	// Convert to response format
 	domainResponses := make([]DomainStatsResponse, 0, len(domains))
@@ -399,8 +568,8 @@ func (s *Server) handleTopDomains(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := TopDomainsResponse{
-		Domains: domainResponses,
-		Limit:   limit,
+		Domains:    domainResponses,
+		Pagination: page,
 	}
 
 	s.writeJSON(w, http.StatusOK, response)
@@ -409,7 +578,8 @@ func (s *Server) handleTopDomains(w http.ResponseWriter, r *http.Request) {
 // handleBlocklistReload handles POST /api/blocklist/reload
 // The reload runs asynchronously — the API returns 202 Accepted immediately
 // and the blocklist update proceeds in the background. The frontend polls
-// GET /api/blocklists to detect when the reload completes.
+// GET /api/blocklists to detect when the reload completes. With ?wait=true
+// it instead waits and reports per-source results (reloadBlocklistsAndWait).
 func (s *Server) handleBlocklistReload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
@@ -421,6 +591,11 @@ func (s *Server) handleBlocklistReload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+		s.reloadBlocklistsAndWait(w, r)
+		return
+	}
+
 	// Run reload asynchronously so we don't hit WriteTimeout on large lists.
 	// Tracked by bgWg so Shutdown waits for completion.
 	s.bgWg.Add(1)
@@ -570,20 +745,67 @@ func (s *Server) currentConfig() *config.Config {
 	return s.configSnapshot
 }
 
-func (s *Server) writeQueriesResponse(w http.ResponseWriter, queries []*storage.QueryLog, limit, offset int) {
+func (s *Server) writeQueriesResponse(w http.ResponseWriter, queries []*storage.QueryLog, page Pagination, nextCursor string) {
+	var names map[string]string
+	if cfg := s.currentConfig(); cfg != nil {
+		names = cfg.BlocklistNames
+	}
 	queryResponses := make([]QueryResponse, 0, len(queries))
 	for _, q := range queries {
-		queryResponses = append(queryResponses, convertQueryLog(q))
+		resp := convertQueryLog(q)
+		// matched_source holds the list URL; show its current display name
+		if name := strings.TrimSpace(names[resp.MatchedSource]); name != "" {
+			resp.MatchedURL, resp.MatchedSource = resp.MatchedSource, name
+		}
+		queryResponses = append(queryResponses, resp)
 	}
 
 	response := QueriesResponse{
-		Queries: queryResponses,
-		Total:   len(queryResponses),
+		Queries:    queryResponses,
+		Pagination: page,
+		NextCursor: nextCursor,
+	}
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// countedPage describes a page of n rows out of total. An inexact total is a
+// lower bound, so a full page then always reports more to come.
+func countedPage(limit, offset, n int, total int64, exact bool) Pagination {
+	return Pagination{
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+		HasMore:    int64(offset+n) < total || (!exact && n == limit),
+		TotalExact: exact,
+	}
+}
+
+// uncountedPage describes a page whose result set wasn't counted: the total
+// covers only the rows up to this page, and a full page may have more.
+func uncountedPage(limit, offset, n int) Pagination {
+	return Pagination{
+		Total:   int64(offset + n),
 		Limit:   limit,
 		Offset:  offset,
+		HasMore: n == limit,
 	}
+}
 
-	s.writeJSON(w, http.StatusOK, response)
+// matchedSourceURL maps a blocklist display name given to the matched_source
+// filter back to the list URL the query log stores. Anything else (a URL,
+// "policy", "legacy") is returned as is.
+func (s *Server) matchedSourceURL(source string) string {
+	cfg := s.currentConfig()
+	if source == "" || cfg == nil {
+		return source
+	}
+	for url, name := range cfg.BlocklistNames {
+		if strings.TrimSpace(name) == source {
+			return url
+		}
+	}
+	return source
 }
 
 func buildQueryFilterFromRequest(r *http.Request) storage.QueryFilter {
@@ -606,6 +828,15 @@ func buildQueryFilterFromRequest(r *http.Request) storage.QueryFilter {
 		filter.Upstream = upstream
 	}
 
+	// Matched exactly as logged: policy names and list labels aren't trimmed
+	if source := values.Get("matched_source"); strings.TrimSpace(source) != "" {
+		filter.MatchedSource = source
+	}
+
+	if rule := values.Get("matched_rule"); strings.TrimSpace(rule) != "" {
+		filter.MatchedRule = rule
+	}
+
 	if responseCode := strings.TrimSpace(values.Get("response_code")); responseCode != "" {
 		if code, err := strconv.Atoi(responseCode); err == nil && code > 0 {
 			filter.ResponseCode = code
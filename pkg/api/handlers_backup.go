@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"glory-hole/pkg/storage"
+)
+
+// backupTimeout bounds how long a snapshot or restore upload may take; the
+// default 60s write timeout is too short for a large query database.
+const backupTimeout = 15 * time.Minute
+
+// backupStorage returns the storage backend as a Backupper, writing the error
+// response itself when backups are not possible.
+func (s *Server) backupStorage(w http.ResponseWriter) (storage.Backupper, bool) {
+	// The database holds every client's query history, so these endpoints are
+	// never served without authentication even though the rest of the API can be.
+	if !s.isAuthenticationEnabled() {
+		s.writeError(w, http.StatusForbidden, "Backup and restore require authentication to be enabled")
+		return nil, false
+	}
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return nil, false
+	}
+	b, ok := s.storage.(storage.Backupper)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, "Storage backend does not support backups")
+		return nil, false
+	}
+	return b, true
+}
+
+// handleBackup handles GET /api/admin/backup. It snapshots the database with
+// VACUUM INTO (consistent even while queries are being logged) and streams the
+// snapshot gzip-compressed.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.backupStorage(w)
+	if !ok {
+		return
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(backupTimeout))
+	ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+	defer cancel()
+
+	tmpDir, err := os.MkdirTemp("", "glory-hole-backup-")
+	if err != nil {
+		s.logger.Error("Failed to create backup directory", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	snapshot := filepath.Join(tmpDir, "glory-hole.db")
+	start := time.Now()
+	if err := b.Backup(ctx, snapshot); err != nil {
+		s.logger.Error("Database backup failed", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		s.logger.Error("Failed to open backup snapshot", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	filename := fmt.Sprintf("glory-hole-%s.db.gz", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	written, err := io.Copy(gz, bufio.NewReader(f))
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		// Headers are already sent; the client sees a truncated gzip stream.
+		s.logger.Warn("Backup stream interrupted", "error", err)
+		return
+	}
+	s.logger.Info("Database backup downloaded",
+		"bytes", written,
+		"duration_ms", time.Since(start).Milliseconds())
+}
+
+// maxRestoreBytes returns the restore size cap from database.max_restore_size.
+func (s *Server) maxRestoreBytes() int64 {
+	mb := storage.DefaultMaxRestoreSize
+	if cfg := s.currentConfig(); cfg != nil && cfg.Database.MaxRestoreSize > 0 {
+		mb = cfg.Database.MaxRestoreSize
+	}
+	return int64(mb) << 20
+}
+
+// handleRestore handles POST /api/admin/restore. The body is a gzip-compressed
+// database as produced by GET /api/admin/backup. The snapshot is verified and
+// staged next to the live database; it replaces it on the next restart.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.backupStorage(w)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(backupTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(backupTimeout))
+	ctx, cancel := context.WithTimeout(r.Context(), backupTimeout)
+	defer cancel()
+
+	// Bound both the upload and what it inflates to, so a small gzip bomb
+	// cannot fill the data disk.
+	limit := s.maxRestoreBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Request body must be a gzip-compressed database")
+		return
+	}
+	defer func() { _ = gz.Close() }()
+
+	// Write next to the database so staging is a rename, not a cross-device copy.
+	tmp, err := os.CreateTemp(b.RestoreStagingDir(), ".glory-hole-restore-*")
+	if err != nil {
+		s.logger.Error("Failed to create restore file", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to stage restore")
+		return
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }() // no-op once staged
+
+	n, err := io.Copy(tmp, io.LimitReader(gz, limit+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var maxBytesErr *http.MaxBytesError
+	if n > limit || errors.As(err, &maxBytesErr) {
+		_ = os.Remove(tmpPath)
+		s.writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Restore exceeds database.max_restore_size (%d MB)", limit>>20))
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read restore upload")
+		return
+	}
+
+	if err := b.StageRestore(ctx, tmpPath); err != nil {
+		if errors.Is(err, storage.ErrInvalidSnapshot) {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.Error("Failed to stage restore", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to stage restore")
+		return
+	}
+
+	s.logger.Warn("Database restore staged; restart to apply")
+	s.writeJSON(w, http.StatusAccepted, StorageRestoreResponse{
+		Status:          statusOK,
+		Message:         "Restore staged; restart glory-hole to apply it",
+		RestartRequired: true,
+	})
+}
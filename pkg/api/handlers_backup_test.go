@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+)
+
+func newBackupTestServer(t *testing.T, authEnabled bool) (*Server, string) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "glory-hole.db")
+	stor, err := storage.NewSQLiteStorage(&storage.Config{
+		Enabled:       true,
+		Backend:       storage.BackendSQLite,
+		SQLite:        storage.SQLiteConfig{Path: dbPath, WALMode: true, BusyTimeout: 5000, CacheSize: 1000},
+		BufferSize:    10,
+		FlushInterval: 50 * time.Millisecond,
+		BatchSize:     10,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = stor.Close() })
+
+	s := &Server{logger: testLogger(), storage: stor}
+	cfg := config.LoadWithDefaults()
+	cfg.Auth.Enabled = authEnabled
+	cfg.Auth.APIKey = "secret"
+	s.applyAuthConfig(cfg.Auth)
+	return s, dbPath
+}
+
+func TestHandleBackup_RequiresAuthentication(t *testing.T) {
+	s, _ := newBackupTestServer(t, false)
+
+	w := httptest.NewRecorder()
+	s.handleBackup(w, httptest.NewRequest(http.MethodGet, "/api/admin/backup", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("backup with auth disabled: status %d, want 403", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.handleRestore(w, httptest.NewRequest(http.MethodPost, "/api/admin/restore", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("restore with auth disabled: status %d, want 403", w.Code)
+	}
+}
+
+func TestHandleBackupAndRestore(t *testing.T) {
+	s, dbPath := newBackupTestServer(t, true)
+
+	w := httptest.NewRecorder()
+	s.handleBackup(w, httptest.NewRequest(http.MethodGet, "/api/admin/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("backup status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	backup := w.Body.Bytes()
+
+	gz, err := gzip.NewReader(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("backup is not gzip: %v", err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte("SQLite format 3\x00")) {
+		t.Fatal("decompressed backup is not a SQLite database")
+	}
+
+	w = httptest.NewRecorder()
+	s.handleRestore(w, httptest.NewRequest(http.MethodPost, "/api/admin/restore", bytes.NewReader(backup)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("restore status %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(dbPath + ".restore"); err != nil {
+		t.Errorf("restore was not staged: %v", err)
+	}
+}
+
+func TestHandleRestore_RejectsInvalidUploads(t *testing.T) {
+	s, dbPath := newBackupTestServer(t, true)
+
+	w := httptest.NewRecorder()
+	s.handleRestore(w, httptest.NewRequest(http.MethodPost, "/api/admin/restore", bytes.NewReader([]byte("plain"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-gzip upload: status %d, want 400", w.Code)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write([]byte("not a database"))
+	_ = gz.Close()
+	w = httptest.NewRecorder()
+	s.handleRestore(w, httptest.NewRequest(http.MethodPost, "/api/admin/restore", &buf))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("gzipped junk: status %d, want 400", w.Code)
+	}
+	if _, err := os.Stat(dbPath + ".restore"); !os.IsNotExist(err) {
+		t.Error("invalid upload must not be staged")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dbPath))
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "glory-hole.db") {
+			t.Errorf("leftover temp file %s", e.Name())
+		}
+	}
+}
+
+func TestHandleRestore_EnforcesSizeLimit(t *testing.T) {
+	s, dbPath := newBackupTestServer(t, true)
+	cfg := config.LoadWithDefaults()
+	cfg.Database.MaxRestoreSize = 1
+	s.configSnapshot = cfg
+
+	// A few KB of gzip that inflates past 1 MB.
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(make([]byte, 2<<20))
+	_ = gz.Close()
+
+	w := httptest.NewRecorder()
+	s.handleRestore(w, httptest.NewRequest(http.MethodPost, "/api/admin/restore", &buf))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized restore: status %d, want 413", w.Code)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dbPath))
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "glory-hole.db") || strings.HasSuffix(e.Name(), ".restore") {
+			t.Errorf("oversized restore left %s behind", e.Name())
+		}
+	}
+}
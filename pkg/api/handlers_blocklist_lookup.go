@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/dns"
+	"glory-hole/pkg/pattern"
+
+	mdns "github.com/miekg/dns"
+)
+
+type blocklistLookupResponse struct {
+	Domain       string        `json:"domain"`
+	Client       string        `json:"client,omitempty"`
+	QueryType    string        `json:"query_type"`
+	Listed       bool          `json:"listed"` // present in a loaded blocklist or blocklist pattern
+	MatchKind    string        `json:"match_kind,omitempty"`
+	MatchedEntry string        `json:"matched_entry,omitempty"`
+	Pattern      string        `json:"pattern,omitempty"`
+	Sources      []string      `json:"sources,omitempty"`
+	SourceNames  []string      `json:"source_names,omitempty"` // display name per entry in Sources
+	Blocked      bool          `json:"blocked"`                // effective outcome, after policies and toggles
+	Decision     *dns.Decision `json:"decision,omitempty"`
+}
+
+// handleBlocklistLookup handles GET /api/blocklist/lookup?domain=x[&client=ip][&type=A].
+// It reports which lists contain the domain and the decision ServeDNS would
+// make for it, including ALLOW rules that win or lose against the blocklist.
+func (s *Server) handleBlocklistLookup(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	domain := pattern.NormalizeDomain(strings.TrimSpace(q.Get("domain")))
+	if domain == "" {
+		s.writeError(w, http.StatusBadRequest, "Domain is required")
+		return
+	}
+
+	client := strings.TrimSpace(q.Get("client"))
+	if client != "" && net.ParseIP(client) == nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid client IP")
+		return
+	}
+
+	qtypeLabel, qtype, ok := parseLookupType(q.Get("type"))
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "Invalid query type")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.lookupDomain(r.Context(), domain, client, qtypeLabel, qtype))
+}
+
+// parseLookupType parses a query type name, defaulting to A.
+func parseLookupType(label string) (string, uint16, bool) {
+	label = strings.ToUpper(strings.TrimSpace(label))
+	if label == "" {
+		label = "A"
+	}
+	qtype, ok := mdns.StringToType[label]
+	return label, qtype, ok
+}
+
+// lookupDomain reports list membership for a normalized domain and, with a
+// DNS handler, the decision ServeDNS would make for it.
+func (s *Server) lookupDomain(ctx context.Context, domain, client, qtypeLabel string, qtype uint16) blocklistLookupResponse {
+	resp := blocklistLookupResponse{Domain: domain, Client: client, QueryType: qtypeLabel}
+
+	if s.dnsHandler != nil {
+		decision := s.dnsHandler.Explain(ctx, domain, client, qtype)
+		resp.Decision = &decision
+		resp.Blocked = decision.Action == dns.DecisionBlock
+		fillBlocklistMatch(&resp, decision.Blocklist)
+		return resp
+	}
+
+	// No DNS handler (tests, API-only deployments): report list membership.
+	if s.blocklistManager != nil {
+		match := s.blocklistManager.Match(domain)
+		fillBlocklistMatch(&resp, match)
+		resp.Blocked = match.Blocked
+	}
+	return resp
+}
+
+// maxCheckDomains bounds one POST /api/check batch.
+const maxCheckDomains = 1000
+
+type domainCheckRequest struct {
+	Domains []string `json:"domains"`
+	Client  string   `json:"client,omitempty"`
+	Type    string   `json:"type,omitempty"`
+}
+
+type domainCheckResponse struct {
+	Results []blocklistLookupResponse `json:"results"`
+	Total   int                       `json:"total"`
+	Blocked int                       `json:"blocked"`
+}
+
+// handleDomainCheck handles POST /api/check: the /api/blocklist/lookup
+// decision for each domain in a batch, in request order. The body is
+// {"domains": [...], "client": "ip", "type": "A"} or a bare array of domains.
+func (s *Server) handleDomainCheck(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1*1024*1024)
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var req domainCheckRequest
+	var err error
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &req.Domains)
+	} else {
+		err = json.Unmarshal(raw, &req)
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Domains) == 0 {
+		s.writeError(w, http.StatusBadRequest, "At least one domain is required")
+		return
+	}
+	if len(req.Domains) > maxCheckDomains {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("At most %d domains per request", maxCheckDomains))
+		return
+	}
+
+	client := strings.TrimSpace(req.Client)
+	if client != "" && net.ParseIP(client) == nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid client IP")
+		return
+	}
+	qtypeLabel, qtype, ok := parseLookupType(req.Type)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "Invalid query type")
+		return
+	}
+
+	resp := domainCheckResponse{Results: make([]blocklistLookupResponse, 0, len(req.Domains))}
+	for i, entry := range req.Domains {
+		domain := pattern.NormalizeDomain(strings.TrimSpace(entry))
+		if domain == "" {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Domain %d is empty", i))
+			return
+		}
+		result := s.lookupDomain(r.Context(), domain, client, qtypeLabel, qtype)
+		if result.Blocked {
+			resp.Blocked++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	resp.Total = len(resp.Results)
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func fillBlocklistMatch(resp *blocklistLookupResponse, match blocklist.MatchResult) {
+	resp.Listed = match.Blocked
+	resp.MatchKind = match.Kind
+	resp.MatchedEntry = match.Entry
+	resp.Pattern = match.Pattern
+	resp.Sources = match.Sources
+	resp.SourceNames = match.Names
+}
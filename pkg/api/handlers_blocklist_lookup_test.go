@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/dns"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLookupServer(t *testing.T, withHandler bool) *Server {
+	t.Helper()
+	logger := logging.NewDefault()
+	mgr := blocklist.NewManager(&config.Config{}, logger, nil, nil)
+	mgr.SetDomainsForTest([]string{"ads.example.com.", "tracker.net."})
+
+	server := &Server{
+		blocklistManager: mgr,
+		logger:           slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})),
+	}
+	if withHandler {
+		engine := policy.NewEngine(nil)
+		require.NoError(t, engine.AddRule(&policy.Rule{
+			Name:    "allow-cdn",
+			Logic:   `Domain == "cdn.tracker.net"`,
+			Action:  policy.ActionAllow,
+			Enabled: true,
+		}))
+		h := dns.NewHandler()
+		h.SetBlocklistManager(mgr)
+		h.SetPolicyEngine(engine)
+		server.dnsHandler = h
+	}
+	return server
+}
+
+func lookup(t *testing.T, server *Server, query string) (int, blocklistLookupResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/blocklist/lookup?"+query, nil)
+	w := httptest.NewRecorder()
+	server.handleBlocklistLookup(w, req)
+
+	var resp blocklistLookupResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w.Code, resp
+}
+
+func TestHandleBlocklistLookup(t *testing.T) {
+	server := newLookupServer(t, true)
+
+	code, resp := lookup(t, server, "domain=img.ads.example.com.")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Listed)
+	assert.True(t, resp.Blocked)
+	assert.Equal(t, "subdomain", resp.MatchKind)
+	assert.Equal(t, "ads.example.com", resp.MatchedEntry)
+	require.NotNil(t, resp.Decision)
+	assert.Equal(t, dns.DecisionBlock, resp.Decision.Action)
+
+	// Listed, but an exact ALLOW rule is more specific than the parent entry.
+	code, resp = lookup(t, server, "domain=CDN.tracker.net&client=192.168.1.10")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Listed)
+	assert.False(t, resp.Blocked)
+	assert.Equal(t, "cdn.tracker.net", resp.Domain)
+	assert.Equal(t, dns.DecisionAllow, resp.Decision.Action)
+	assert.Equal(t, "allow-cdn", resp.Decision.Rule)
+
+	code, resp = lookup(t, server, "domain=example.org&type=AAAA")
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, resp.Listed)
+	assert.Equal(t, "AAAA", resp.QueryType)
+	assert.Equal(t, dns.DecisionForward, resp.Decision.Action)
+}
+
+func TestHandleBlocklistLookup_WithoutDNSHandler(t *testing.T) {
+	server := newLookupServer(t, false)
+
+	code, resp := lookup(t, server, "domain=ads.example.com")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Blocked)
+	assert.Nil(t, resp.Decision)
+}
+
+func TestHandleBlocklistLookup_BadRequest(t *testing.T) {
+	server := newLookupServer(t, false)
+
+	for _, query := range []string{"", "domain=a.com&client=nope", "domain=a.com&type=BOGUS"} {
+		code, _ := lookup(t, server, query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func check(t *testing.T, server *Server, body string) (int, domainCheckResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/check", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.handleDomainCheck(w, req)
+
+	var resp domainCheckResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return w.Code, resp
+}
+
+func TestHandleDomainCheck(t *testing.T) {
+	server := newLookupServer(t, true)
+
+	code, resp := check(t, server, `{"domains": ["img.ads.example.com", "CDN.tracker.net", "example.org"], "client": "192.168.1.10", "type": "AAAA"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, 3, resp.Total)
+	assert.Equal(t, 1, resp.Blocked)
+
+	assert.Equal(t, "img.ads.example.com", resp.Results[0].Domain)
+	assert.True(t, resp.Results[0].Blocked)
+	assert.Equal(t, "AAAA", resp.Results[0].QueryType)
+
+	// Listed, but allowed by a policy rule.
+	assert.True(t, resp.Results[1].Listed)
+	assert.False(t, resp.Results[1].Blocked)
+	assert.Equal(t, "allow-cdn", resp.Results[1].Decision.Rule)
+
+	assert.False(t, resp.Results[2].Listed)
+	assert.Equal(t, dns.DecisionForward, resp.Results[2].Decision.Action)
+
+	// A bare array works too.
+	code, resp = check(t, server, `["ads.example.com", "example.org"]`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, resp.Total)
+	assert.Equal(t, 1, resp.Blocked)
+	assert.Equal(t, "A", resp.Results[0].QueryType)
+}
+
+func TestHandleDomainCheck_BadRequest(t *testing.T) {
+	server := newLookupServer(t, false)
+
+	tooMany := make([]string, maxCheckDomains+1)
+	for i := range tooMany {
+		tooMany[i] = "example.com"
+	}
+	tooManyBody, err := json.Marshal(tooMany)
+	require.NoError(t, err)
+
+	for _, body := range []string{
+		``,
+		`not json`,
+		`[]`,
+		`{"domains": []}`,
+		`["a.com", ""]`,
+		`{"domains": ["a.com"], "client": "nope"}`,
+		`{"domains": ["a.com"], "type": "BOGUS"}`,
+		string(tooManyBody),
+	} {
+		code, _ := check(t, server, body)
+		assert.Equal(t, http.StatusBadRequest, code, body)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"glory-hole/pkg/blocklist"
+
 	"github.com/miekg/dns"
 )
 
@@ -18,9 +20,23 @@ type blocklistSummaryResponse struct {
 	UpdateInterval string         `json:"update_interval"`
 	TotalDomains   int            `json:"total_domains"`
 	ExactDomains   int            `json:"exact_domains"`
+	Exceptions     int            `json:"exceptions"`
 	PatternStats   map[string]int `json:"pattern_stats"`
 	LastUpdated    string         `json:"last_updated,omitempty"`
 	Sources        []string       `json:"sources"`
+
+	// SourceDetails repeats Sources with each list's configured name,
+	// description and category.
+	SourceDetails []blocklist.SourceInfo `json:"source_details"`
+
+	// Figures for the last successful load, omitted before the first one
+	LoadDuration      string `json:"load_duration,omitempty"`
+	LoadPeakHeapBytes uint64 `json:"load_peak_heap_bytes,omitempty"`
+
+	// Total bytes fetched by the last load and the average rate in bytes
+	// per second while fetching
+	LoadDownloadedBytes int64 `json:"load_downloaded_bytes,omitempty"`
+	LoadDownloadRate    int64 `json:"load_download_bytes_per_second,omitempty"`
 }
 
 func (s *Server) handleBlocklistsPage(w http.ResponseWriter, r *http.Request) {
@@ -70,8 +86,9 @@ func (s *Server) handleCheckBlocklist(w http.ResponseWriter, r *http.Request) {
 func (s *Server) buildBlocklistSummary(ctx context.Context) blocklistSummaryResponse {
 	cfg := s.currentConfig()
 	summary := blocklistSummaryResponse{
-		PatternStats: make(map[string]int),
-		Sources:      []string{},
+		PatternStats:  make(map[string]int),
+		Sources:       []string{},
+		SourceDetails: []blocklist.SourceInfo{},
 	}
 
 	if cfg != nil {
@@ -81,12 +98,14 @@ func (s *Server) buildBlocklistSummary(ctx context.Context) blocklistSummaryResp
 			summary.UpdateInterval = cfg.UpdateInterval.String()
 		}
 		summary.Sources = append(summary.Sources, cfg.Blocklists...)
+		summary.SourceDetails = blocklist.SourceInfos(cfg)
 	}
 
 	if s.blocklistManager != nil {
 		stats := s.blocklistManager.Stats()
 		summary.ExactDomains = stats["exact"]
 		summary.TotalDomains = stats["total"]
+		summary.Exceptions = stats["exceptions"]
 		summary.PatternStats["exact"] = stats["pattern_exact"]
 		summary.PatternStats["wildcard"] = stats["pattern_wildcard"]
 		summary.PatternStats["regex"] = stats["pattern_regex"]
@@ -94,11 +113,61 @@ func (s *Server) buildBlocklistSummary(ctx context.Context) blocklistSummaryResp
 		if ts := s.blocklistManager.LastUpdated(); !ts.IsZero() {
 			summary.LastUpdated = ts.UTC().Format(time.RFC3339)
 		}
+		if load := s.blocklistManager.LastLoad(); load.Duration > 0 {
+			summary.LoadDuration = load.Duration.Round(time.Millisecond).String()
+			summary.LoadPeakHeapBytes = load.PeakHeapBytes
+			summary.LoadDownloadedBytes = load.DownloadedBytes
+			summary.LoadDownloadRate = load.DownloadRate()
+		}
 	}
 
 	return summary
 }
 
+// blocklistsReloadTimeout bounds a synchronous reload. The response write
+// deadline is extended past the server's WriteTimeout to cover it.
+const blocklistsReloadTimeout = 5 * time.Minute
+
+// reloadBlocklistsAndWait serves POST /api/blocklist/reload?wait=true: it
+// re-downloads every source now, waits for the result, and reports
+// per-source outcomes. Concurrent calls share one download, so retrying is
+// safe.
+func (s *Server) reloadBlocklistsAndWait(w http.ResponseWriter, r *http.Request) {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(blocklistsReloadTimeout + 10*time.Second))
+	ctx, cancel := context.WithTimeout(r.Context(), blocklistsReloadTimeout)
+	defer cancel()
+
+	start := time.Now()
+	results, err := s.blocklistManager.Reload(ctx)
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Blocklist reload failed: %v", err))
+		return
+	}
+
+	// Clear cached blocklist decisions so the new lists take effect immediately
+	if s.cache != nil {
+		s.cache.ClearBlocklistDecisions()
+	}
+
+	resp := BlocklistsReloadResponse{
+		Status:     "ok",
+		Domains:    s.blocklistManager.Size(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Sources:    results,
+	}
+	if resp.Sources == nil {
+		resp.Sources = []blocklist.SourceResult{}
+	}
+	for _, src := range resp.Sources {
+		if src.Error != "" {
+			resp.Status = "partial"
+			break
+		}
+	}
+	s.logger.Info("Blocklists reloaded via API", "domains", resp.Domains, "status", resp.Status)
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
 // handleUpdateBlocklistSources handles PUT /api/config/blocklists
 func (s *Server) handleUpdateBlocklistSources(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
@@ -146,6 +215,7 @@ func (s *Server) handleUpdateBlocklistSources(w http.ResponseWriter, r *http.Req
 
 	updated := *cfg
 	updated.Blocklists = sources
+	updated.PruneBlocklistSettings()
 
 	if !s.persistConfigSection(w, r, &updated, "", "", cfg) {
 		return
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+)
+
+func TestHandleBlocklistReload_Wait(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.com\n"))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer bad.Close()
+
+	cfg := &config.Config{Blocklists: []string{good.URL, bad.URL}}
+	server := New(&Config{
+		ListenAddress:    ":8080",
+		BlocklistManager: blocklist.NewManager(cfg, logging.NewDefault(), nil, nil),
+		Logger:           slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})),
+		Version:          "test",
+	})
+
+	for i := 0; i < 2; i++ { // repeat calls give the same result
+		w := httptest.NewRecorder()
+		server.handleBlocklistReload(w, httptest.NewRequest(http.MethodPost, "/api/blocklist/reload?wait=true", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("call %d: status %d: %s", i+1, w.Code, w.Body.String())
+		}
+
+		var resp BlocklistsReloadResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Status != "partial" || resp.Domains != 2 {
+			t.Errorf("call %d: status=%q domains=%d, want partial/2", i+1, resp.Status, resp.Domains)
+		}
+		if len(resp.Sources) != 2 || resp.Sources[0].Domains != 2 || resp.Sources[0].Error != "" || resp.Sources[1].Error == "" {
+			t.Errorf("call %d: unexpected sources %+v", i+1, resp.Sources)
+		}
+	}
+}
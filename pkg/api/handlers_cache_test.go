@@ -99,10 +99,8 @@ func TestHandleCachePurge_NoCacheAvailable(t *testing.T) {
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
 
-	// Check either Error or Message field contains the expected text
-	assert.True(t,
-		response.Error == "Cache not available" || response.Message == "Cache not available",
-		"Expected error message about cache not available, got: %+v", response)
+	assert.Equal(t, "service_unavailable", response.Error.Code)
+	assert.Equal(t, "Cache not available", response.Error.Message)
 }
 
 func TestHandleCachePurge_Integration(t *testing.T) {
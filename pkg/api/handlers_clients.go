@@ -29,6 +29,19 @@ type clientGroupRequest struct {
 	Color       string `json:"color"`
 }
 
+// clientGroupResponse is a group as listed by GET /api/client-groups.
+type clientGroupResponse struct {
+	*storage.ClientGroup
+	MemberCount int `json:"member_count"`
+}
+
+// clientGroupMember is one client assigned to a group.
+type clientGroupMember struct {
+	ClientIP    string `json:"client_ip"`
+	DisplayName string `json:"display_name,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+}
+
 func (s *Server) handleClientsPage(w http.ResponseWriter, r *http.Request) {
 	s.serveAstroPage(w, r, "clients/index.html")
 }
@@ -47,7 +60,14 @@ func (s *Server) handleGetClients(w http.ResponseWriter, r *http.Request) {
 	limit := parsePositiveInt(r.URL.Query().Get("limit"), defaultClientPageSize, maxClientPageSize)
 	offset := parseNonNegativeInt(r.URL.Query().Get("offset"), 0)
 
-	// Reads from pre-aggregated client_stats table — fast even on large databases.
+	// Optional 'since' window (e.g. 24h). Without it, lifetime totals are read
+	// from the pre-aggregated client_stats table — fast even on large databases.
+	sinceTime, err := parseClientWindow(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
@@ -55,17 +75,120 @@ func (s *Server) handleGetClients(w http.ResponseWriter, r *http.Request) {
 		ctx = storage.WithClientSearch(ctx, search)
 	}
 
-	clients, err := s.storage.GetClientSummaries(ctx, limit, offset)
+	clients, err := s.storage.GetClientSummaries(ctx, limit, offset, sinceTime)
 	if err != nil {
 		s.logger.Error("Failed to list clients", "error", err)
 		s.writeError(w, http.StatusInternalServerError, "Failed to list clients")
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, map[string]any{
-		"clients": clients,
-		"limit":   limit,
-		"offset":  offset,
+	if clients == nil {
+		clients = []*storage.ClientSummary{}
+	}
+	resp := ClientsResponse{
+		Clients:    clients,
+		Pagination: uncountedPage(limit, offset, len(clients)),
+	}
+	if total, err := s.storage.CountClientSummaries(ctx, sinceTime); err != nil {
+		s.logger.Warn("Failed to count clients", "error", err)
+	} else {
+		resp.Pagination = countedPage(limit, offset, len(clients), total, true)
+	}
+	if !sinceTime.IsZero() {
+		resp.Since = &sinceTime
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// parseClientWindow returns the start of the window named by the since query
+// parameter (e.g. 24h), or the zero time for lifetime totals when it is
+// absent. An unparseable window is an error rather than a silent default.
+func parseClientWindow(r *http.Request) (time.Time, error) {
+	sinceParam := strings.TrimSpace(r.URL.Query().Get("since"))
+	if sinceParam == "" {
+		return time.Time{}, nil
+	}
+	d, err := parseDurationField(sinceParam, "since")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
+
+// handleTopClients handles GET /api/top-clients: the noisiest clients by
+// query volume, with their blocked counts and display names.
+func (s *Server) handleTopClients(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+	reporter, ok := s.storage.(storage.TopClientsReporter)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, "Storage backend does not support top clients")
+		return
+	}
+
+	limit := parsePositiveInt(r.URL.Query().Get("limit"), 10, 100)
+
+	// Optional 'since' window, as for /api/clients; lifetime totals otherwise.
+	sinceTime, err := parseClientWindow(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	clients, err := reporter.GetTopClients(ctx, limit, sinceTime)
+	if err != nil {
+		s.logger.Error("Failed to get top clients", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve top clients")
+		return
+	}
+	if clients == nil {
+		clients = []*storage.ClientSummary{}
+	}
+
+	resp := TopClientsResponse{Clients: clients, Limit: limit}
+	if !sinceTime.IsZero() {
+		resp.Since = &sinceTime
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleClientTimeSeries handles GET /api/clients/{client}/timeseries: the
+// same buckets as /api/stats/timeseries, counting only one client's queries.
+func (s *Server) handleClientTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+
+	clientIP, err := url.PathUnescape(strings.TrimSpace(r.PathValue("client")))
+	if err != nil || clientIP == "" {
+		s.writeError(w, http.StatusBadRequest, "Client identifier is required")
+		return
+	}
+
+	periodDuration, normalizedPeriod := parseTimeSeriesPeriod(r.URL.Query().Get("period"))
+	points := parseTimeSeriesPoints(r.URL.Query().Get("points"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	series, err := s.storage.GetClientTimeSeries(ctx, clientIP, periodDuration, points)
+	if err != nil {
+		s.logger.Error("Failed to get client time-series statistics", "client", clientIP, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to retrieve time-series statistics")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, TimeSeriesResponse{
+		Period: normalizedPeriod,
+		Points: points,
+		Client: clientIP,
+		Data:   convertTimeSeriesPoints(series),
 	})
 }
 
@@ -140,12 +263,161 @@ func (s *Server) handleGetClientGroups(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusInternalServerError, "Failed to list client groups")
 		return
 	}
+	profiles, err := s.storage.ListClientProfiles(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list client profiles", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list client groups")
+		return
+	}
+
+	counts := make(map[string]int, len(groups))
+	for _, p := range profiles {
+		if p.GroupName != "" {
+			counts[p.GroupName]++
+		}
+	}
+	resp := make([]clientGroupResponse, 0, len(groups))
+	for _, g := range groups {
+		resp = append(resp, clientGroupResponse{ClientGroup: g, MemberCount: counts[g.Name]})
+	}
 
 	s.writeJSON(w, http.StatusOK, map[string]any{
-		"groups": groups,
+		"groups": resp,
 	})
 }
 
+// handleGetClientGroupMembers handles GET /api/client-groups/{group}/members.
+func (s *Server) handleGetClientGroupMembers(w http.ResponseWriter, r *http.Request) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	name, ok := s.lookupClientGroup(ctx, w, r)
+	if !ok {
+		return
+	}
+	profiles, err := s.storage.ListClientProfiles(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list client profiles", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list group members")
+		return
+	}
+
+	members := []clientGroupMember{}
+	for _, p := range profiles {
+		if p.GroupName == name {
+			members = append(members, clientGroupMember{ClientIP: p.ClientIP, DisplayName: p.DisplayName, Notes: p.Notes})
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"group":   name,
+		"members": members,
+	})
+}
+
+// handleAddClientGroupMember handles PUT
+// /api/client-groups/{group}/members/{client}, moving the client into the
+// group. A client is in at most one group, so this replaces any previous
+// membership; its display name and notes are kept.
+func (s *Server) handleAddClientGroupMember(w http.ResponseWriter, r *http.Request) {
+	s.setClientGroupMember(w, r, true)
+}
+
+// handleRemoveClientGroupMember handles DELETE
+// /api/client-groups/{group}/members/{client}.
+func (s *Server) handleRemoveClientGroupMember(w http.ResponseWriter, r *http.Request) {
+	s.setClientGroupMember(w, r, false)
+}
+
+func (s *Server) setClientGroupMember(w http.ResponseWriter, r *http.Request, add bool) {
+	if s.storage == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Storage not available")
+		return
+	}
+	setter, ok := s.storage.(storage.ClientGroupSetter)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, "Storage backend does not support group membership changes")
+		return
+	}
+
+	clientID, err := url.PathUnescape(strings.TrimSpace(r.PathValue("client")))
+	if err != nil || clientID == "" {
+		s.writeError(w, http.StatusBadRequest, "Client identifier is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	name, ok := s.lookupClientGroup(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	target := name
+	if !add {
+		profiles, err := s.storage.ListClientProfiles(ctx)
+		if err != nil {
+			s.logger.Error("Failed to list client profiles", "error", err)
+			s.writeError(w, http.StatusInternalServerError, "Failed to update group members")
+			return
+		}
+		member := false
+		for _, p := range profiles {
+			if p.ClientIP == clientID && p.GroupName == name {
+				member = true
+				break
+			}
+		}
+		if !member {
+			s.writeError(w, http.StatusNotFound, "Client is not in this group")
+			return
+		}
+		target = ""
+	}
+
+	if err := setter.SetClientGroup(ctx, clientID, target); err != nil {
+		s.logger.Error("Failed to set client group", "client", clientID, "group", name, "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to update group members")
+		return
+	}
+
+	// Membership changed — refresh the policy resolver cache.
+	s.reloadClientGroupCache(ctx)
+
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"status": "ok",
+	})
+}
+
+// lookupClientGroup resolves the {group} path value to an existing group,
+// writing a 400 or 404 when it doesn't name one.
+func (s *Server) lookupClientGroup(ctx context.Context, w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := strings.TrimSpace(r.PathValue("group"))
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Group name is required")
+		return "", false
+	}
+	groups, err := s.storage.GetClientGroups(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list client groups", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to list client groups")
+		return "", false
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return name, true
+		}
+	}
+	s.writeError(w, http.StatusNotFound, "Group not found")
+	return "", false
+}
+
 func (s *Server) handleCreateClientGroup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
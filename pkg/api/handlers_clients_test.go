@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/storage"
+)
+
+func newClientGroupTestServer(t *testing.T) (*Server, storage.Storage) {
+	t.Helper()
+	stor, err := storage.NewSQLiteStorage(&storage.Config{
+		Enabled:       true,
+		Backend:       storage.BackendSQLite,
+		SQLite:        storage.SQLiteConfig{Path: filepath.Join(t.TempDir(), "glory-hole.db"), WALMode: true, BusyTimeout: 5000, CacheSize: 1000},
+		BufferSize:    10,
+		FlushInterval: 50 * time.Millisecond,
+		BatchSize:     10,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = stor.Close() })
+	return &Server{logger: testLogger(), storage: stor}, stor
+}
+
+func TestClientGroupMembers(t *testing.T) {
+	s, stor := newClientGroupTestServer(t)
+	ctx := context.Background()
+
+	reloads := 0
+	s.SetClientGroupReloader(func(context.Context) error {
+		reloads++
+		return nil
+	})
+
+	// do calls h directly, as the mux would for /api/client-groups/{group}/members/{client}.
+	do := func(h http.HandlerFunc, method, group, client, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/client-groups", strings.NewReader(body))
+		req.SetPathValue("group", group)
+		req.SetPathValue("client", client)
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	if w := do(s.handleCreateClientGroup, http.MethodPost, "", "", `{"name":"kids","color":"#ff0000"}`); w.Code != http.StatusOK {
+		t.Fatalf("create group: status %d: %s", w.Code, w.Body)
+	}
+	if err := stor.UpdateClientProfile(ctx, &storage.ClientProfile{ClientIP: "10.0.0.5", DisplayName: "Tablet"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do(s.handleAddClientGroupMember, http.MethodPut, "kids", "10.0.0.5", ""); w.Code != http.StatusOK {
+		t.Fatalf("add member: status %d: %s", w.Code, w.Body)
+	}
+	if w := do(s.handleAddClientGroupMember, http.MethodPut, "kids", "10.0.0.6", ""); w.Code != http.StatusOK {
+		t.Fatalf("add new client: status %d: %s", w.Code, w.Body)
+	}
+	if w := do(s.handleAddClientGroupMember, http.MethodPut, "adults", "10.0.0.5", ""); w.Code != http.StatusNotFound {
+		t.Errorf("add to unknown group: status %d, want 404", w.Code)
+	}
+
+	w := do(s.handleGetClientGroupMembers, http.MethodGet, "kids", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list members: status %d: %s", w.Code, w.Body)
+	}
+	var members struct {
+		Group   string              `json:"group"`
+		Members []clientGroupMember `json:"members"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&members); err != nil {
+		t.Fatal(err)
+	}
+	if members.Group != "kids" || len(members.Members) != 2 {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+	if m := members.Members[0]; m.ClientIP != "10.0.0.5" || m.DisplayName != "Tablet" {
+		t.Errorf("assignment should keep the display name, got %+v", m)
+	}
+
+	w = do(s.handleGetClientGroups, http.MethodGet, "", "", "")
+	var groups struct {
+		Groups []struct {
+			Name        string `json:"name"`
+			Color       string `json:"color"`
+			MemberCount int    `json:"member_count"`
+		} `json:"groups"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups.Groups) != 1 || groups.Groups[0].MemberCount != 2 || groups.Groups[0].Color != "#ff0000" {
+		t.Errorf("unexpected groups: %+v", groups.Groups)
+	}
+
+	if w := do(s.handleRemoveClientGroupMember, http.MethodDelete, "kids", "10.0.0.6", ""); w.Code != http.StatusOK {
+		t.Fatalf("remove member: status %d: %s", w.Code, w.Body)
+	}
+	if w := do(s.handleRemoveClientGroupMember, http.MethodDelete, "kids", "10.0.0.6", ""); w.Code != http.StatusNotFound {
+		t.Errorf("remove non-member: status %d, want 404", w.Code)
+	}
+	if w := do(s.handleGetClientGroupMembers, http.MethodGet, "adults", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("list unknown group: status %d, want 404", w.Code)
+	}
+
+	if reloads != 3 {
+		t.Errorf("expected 3 resolver reloads, got %d", reloads)
+	}
+}
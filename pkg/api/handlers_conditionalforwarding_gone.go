@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 )
 
@@ -23,13 +22,16 @@ func (s *Server) handleConditionalForwardingGone(w http.ResponseWriter, r *http.
 			"remote", r.RemoteAddr,
 		)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusGone)
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"error":         "gone",
-		"message":       "Conditional Forwarding has been removed. Use Policy rules with action=FORWARD instead.",
-		"migrate_to":    "/api/policies",
-		"removed_in":    "0.27.0",
-		"deprecated_in": "0.26.0",
+	s.writeJSON(w, http.StatusGone, struct {
+		ErrorResponse
+		MigrateTo    string `json:"migrate_to"`
+		RemovedIn    string `json:"removed_in"`
+		DeprecatedIn string `json:"deprecated_in"`
+	}{
+		ErrorResponse: newErrorResponse("gone",
+			"Conditional Forwarding has been removed. Use Policy rules with action=FORWARD instead."),
+		MigrateTo:    "/api/policies",
+		RemovedIn:    "0.27.0",
+		DeprecatedIn: "0.26.0",
 	})
 }
@@ -41,15 +41,20 @@ func TestHandleConditionalForwardingGone(t *testing.T) {
 			assert.Equal(t, http.StatusGone, w.Code)
 			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 
-			var body map[string]string
+			var body struct {
+				Error        ErrorDetail `json:"error"`
+				MigrateTo    string      `json:"migrate_to"`
+				RemovedIn    string      `json:"removed_in"`
+				DeprecatedIn string      `json:"deprecated_in"`
+			}
 			err := json.Unmarshal(w.Body.Bytes(), &body)
 			require.NoError(t, err)
 
-			assert.Equal(t, "gone", body["error"])
-			assert.Equal(t, "/api/policies", body["migrate_to"])
-			assert.Equal(t, "0.27.0", body["removed_in"])
-			assert.Equal(t, "0.26.0", body["deprecated_in"])
-			assert.Contains(t, body["message"], "Policy rules")
+			assert.Equal(t, "gone", body.Error.Code)
+			assert.Equal(t, "/api/policies", body.MigrateTo)
+			assert.Equal(t, "0.27.0", body.RemovedIn)
+			assert.Equal(t, "0.26.0", body.DeprecatedIn)
+			assert.Contains(t, body.Error.Message, "Policy rules")
 		})
 	}
 }
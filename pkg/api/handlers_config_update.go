@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/dnscrypt"
 )
 
 const maxConfigPayloadSize = 64 * 1024 // 64KB
@@ -339,17 +340,23 @@ func parseUpstreamServers(r *http.Request) ([]string, error) {
 		if entry == "" {
 			continue
 		}
-		if !strings.Contains(entry, ":") {
+		if dnscrypt.IsUpstream(entry) {
+			if _, err := dnscrypt.ParseUpstream(entry); err != nil {
+				return nil, err
+			}
+		} else if !strings.Contains(entry, ":") {
 			return nil, fmt.Errorf("server %q must include a port (e.g., 1.1.1.1:53)", entry)
-		}
-		if _, _, err := net.SplitHostPort(entry); err != nil {
+		} else if _, _, err := net.SplitHostPort(entry); err != nil {
 			return nil, fmt.Errorf("invalid upstream server %q: %w", entry, err)
 		}
-		lower := strings.ToLower(entry)
-		if _, ok := seen[lower]; ok {
+		key := entry
+		if !dnscrypt.IsUpstream(entry) {
+			key = strings.ToLower(entry) // stamps are base64 and case-sensitive
+		}
+		if _, ok := seen[key]; ok {
 			continue
 		}
-		seen[lower] = struct{}{}
+		seen[key] = struct{}{}
 		result = append(result, entry)
 	}
 
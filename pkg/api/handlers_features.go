@@ -18,11 +18,13 @@ type FeaturesRequest struct {
 type FeaturesResponse struct {
 	BlocklistDisabledUntil       *time.Time `json:"blocklist_disabled_until,omitempty"` // When it will auto-re-enable
 	PoliciesDisabledUntil        *time.Time `json:"policies_disabled_until,omitempty"`  // When it will auto-re-enable
+	LoggingPausedUntil           *time.Time `json:"logging_paused_until,omitempty"`     // When query logging resumes
 	UpdatedAt                    time.Time  `json:"updated_at"`
 	BlocklistEnabled             bool       `json:"blocklist_enabled"`       // Permanent setting from config
 	PoliciesEnabled              bool       `json:"policies_enabled"`        // Permanent setting from config
 	BlocklistTemporarilyDisabled bool       `json:"blocklist_temp_disabled"` // Temporary disable state
 	PoliciesTemporarilyDisabled  bool       `json:"policies_temp_disabled"`  // Temporary disable state
+	LoggingPaused                bool       `json:"logging_paused"`          // Query logging temporarily paused
 }
 
 // DisableRequest represents a request to temporarily disable a feature
@@ -61,6 +63,10 @@ func (s *Server) handleGetFeatures(w http.ResponseWriter, r *http.Request) {
 	if policiesTempDisabled {
 		resp.PoliciesDisabledUntil = &policiesUntil
 	}
+	if paused, until := s.killSwitch.IsLoggingPaused(); paused {
+		resp.LoggingPaused = true
+		resp.LoggingPausedUntil = &until
+	}
 
 	s.writeJSON(w, http.StatusOK, resp)
 }
@@ -305,3 +311,67 @@ func (s *Server) handleEnablePolicies(w http.ResponseWriter, r *http.Request) {
 
 	s.writeJSON(w, http.StatusOK, resp)
 }
+
+// handlePauseLogging stops writing queries to the query log for a duration.
+// DNS resolution, metrics and storage are unaffected.
+// POST /api/features/logging/pause
+func (s *Server) handlePauseLogging(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		s.writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed")
+		return
+	}
+
+	// Limit request body size
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024) // 1MB limit
+
+	// Parse request
+	var req DisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// Validate duration (0 = indefinite, max 24 hours)
+	if req.Duration < 0 || req.Duration > 86400 {
+		s.writeError(w, http.StatusBadRequest, "Duration must be between 0 and 86400 seconds (24 hours)")
+		return
+	}
+
+	// Pause for specified duration
+	var until time.Time
+	if req.Duration == 0 {
+		// Indefinite pause (1 year)
+		until = s.killSwitch.PauseLoggingFor(365 * 24 * time.Hour)
+	} else {
+		until = s.killSwitch.PauseLoggingFor(time.Duration(req.Duration) * time.Second)
+	}
+
+	resp := map[string]interface{}{
+		"paused_until": until,
+		"duration":     req.Duration,
+		"message":      "Query logging paused",
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleResumeLogging immediately resumes query logging (cancels a pause)
+// POST /api/features/logging/resume
+func (s *Server) handleResumeLogging(w http.ResponseWriter, r *http.Request) {
+	// Only allow POST
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		s.writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed")
+		return
+	}
+
+	s.killSwitch.ResumeLogging()
+
+	resp := map[string]interface{}{
+		"message": "Query logging resumed",
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
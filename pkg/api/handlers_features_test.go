@@ -3,11 +3,13 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"glory-hole/pkg/config"
 )
@@ -492,3 +494,43 @@ func TestHandleUpdateFeatures_LargePayload(t *testing.T) {
 		t.Error("expected request to fail due to size limit")
 	}
 }
+
+func TestKillSwitchManager_OnDisable(t *testing.T) {
+	k := NewKillSwitchManager(slog.Default())
+	var features []string
+	k.SetOnDisable(func(feature string, until time.Time) {
+		features = append(features, feature)
+		if until.IsZero() {
+			t.Error("expected a re-enable time")
+		}
+	})
+
+	k.DisableBlocklistFor(time.Minute)
+	k.DisablePoliciesFor(time.Minute)
+	k.EnableBlocklist()
+
+	if len(features) != 2 || features[0] != "blocklist" || features[1] != "policies" {
+		t.Errorf("features = %v, want [blocklist policies]", features)
+	}
+}
+
+func TestKillSwitchManager_PauseLogging(t *testing.T) {
+	k := NewKillSwitchManager(slog.Default())
+	var fired bool
+	k.SetOnDisable(func(string, time.Time) { fired = true })
+
+	if paused, _ := k.IsLoggingPaused(); paused {
+		t.Fatal("logging paused before PauseLoggingFor")
+	}
+	until := k.PauseLoggingFor(time.Minute)
+	if paused, got := k.IsLoggingPaused(); !paused || !got.Equal(until) {
+		t.Errorf("IsLoggingPaused = %v, %v; want true, %v", paused, got, until)
+	}
+	if fired {
+		t.Error("pausing logging should not fire the disable notification")
+	}
+	k.ResumeLogging()
+	if paused, _ := k.IsLoggingPaused(); paused {
+		t.Error("logging still paused after ResumeLogging")
+	}
+}
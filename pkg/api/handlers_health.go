@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"glory-hole/pkg/storage"
+)
+
+// Component states reported by /api/health/detailed.
+const (
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// blocklistStaleFactor is how many update intervals may pass without a
+// successful blocklist refresh before the blocklist is reported as degraded.
+const blocklistStaleFactor = 2
+
+// handleHealthDetailed handles GET /api/health/detailed.
+// Each component reports ok, degraded, down or not_configured. The response
+// is 503 when a critical component (DNS listener, upstreams) is down, so it
+// can back a readiness probe; non-critical failures only degrade the rollup.
+func (s *Server) handleHealthDetailed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	components := map[string]ComponentHealth{
+		"dns":       s.dnsListenerHealth(),
+		"upstreams": s.upstreamHealth(),
+		"storage":   s.storageHealth(r.Context()),
+		"cache":     s.cacheHealth(),
+		"blocklist": s.blocklistHealth(time.Now()),
+	}
+
+	status := statusOK
+	statusCode := http.StatusOK
+	for _, c := range components {
+		switch {
+		case c.Status == healthDown && c.Critical:
+			status = healthDown
+			statusCode = http.StatusServiceUnavailable
+		case c.Status == healthDown || c.Status == healthDegraded:
+			if status == statusOK {
+				status = healthDegraded
+			}
+		}
+	}
+
+	s.writeJSON(w, statusCode, DetailedHealthResponse{
+		Status:     status,
+		Uptime:     s.getUptime(),
+		Version:    s.version,
+		Components: components,
+	})
+}
+
+func (s *Server) dnsListenerHealth() ComponentHealth {
+	if s.dnsServer == nil {
+		return ComponentHealth{Status: statusNotConfigured}
+	}
+	if !s.dnsServer.IsRunning() {
+		return ComponentHealth{Status: healthDown, Critical: true, Detail: "DNS listeners are not running"}
+	}
+	return ComponentHealth{Status: statusOK, Critical: true}
+}
+
+// upstreamHealth reports circuit-breaker state rather than sending probe
+// queries, so frequent probes don't generate upstream traffic.
+func (s *Server) upstreamHealth() ComponentHealth {
+	if s.dnsHandler == nil || s.dnsHandler.GetForwarder() == nil {
+		return ComponentHealth{Status: statusNotConfigured}
+	}
+	fwd := s.dnsHandler.GetForwarder()
+	total := len(fwd.Upstreams())
+	healthy := len(fwd.HealthyUpstreams())
+	c := ComponentHealth{
+		Status:   statusOK,
+		Critical: true,
+		Detail:   fmt.Sprintf("%d/%d upstreams healthy", healthy, total),
+	}
+	switch {
+	case healthy == 0:
+		c.Status = healthDown
+	case healthy < total:
+		c.Status = healthDegraded
+	}
+	return c
+}
+
+func (s *Server) storageHealth(ctx context.Context) ComponentHealth {
+	if s.storage == nil {
+		return ComponentHealth{Status: statusNotConfigured}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	if err := s.storage.Ping(ctx); err != nil {
+		// The endpoint is unauthenticated; keep driver errors (paths, DSNs)
+		// in the log
+		s.logger.Warn("Health check: storage ping failed", "error", err)
+		return ComponentHealth{Status: healthDown, Detail: "storage ping failed"}
+	}
+	c := ComponentHealth{Status: statusOK}
+	if du, ok := s.storage.(storage.DiskUsageReporter); ok {
+		if usage, err := du.DiskUsage(); err == nil {
+			c.DatabaseBytes = usage.DatabaseBytes
+			c.WALBytes = usage.WALBytes
+		}
+	}
+	if br, ok := s.storage.(storage.BufferReporter); ok {
+		stats := br.GetBufferStats()
+		c.Buffer = &stats
+	}
+	return c
+}
+
+func (s *Server) cacheHealth() ComponentHealth {
+	c := s.cache
+	if c == nil && s.dnsHandler != nil {
+		c = s.dnsHandler.GetCache()
+	}
+	if c == nil {
+		return ComponentHealth{Status: statusNotConfigured}
+	}
+	return ComponentHealth{Status: statusOK, Detail: fmt.Sprintf("%d entries", c.Stats().Entries)}
+}
+
+func (s *Server) blocklistHealth(now time.Time) ComponentHealth {
+	if s.blocklistManager == nil {
+		return ComponentHealth{Status: statusNotConfigured}
+	}
+	last := s.blocklistManager.LastUpdated()
+	if last.IsZero() {
+		return ComponentHealth{Status: healthDegraded, Detail: "blocklists have not been loaded yet"}
+	}
+
+	age := now.Sub(last).Truncate(time.Second)
+	c := ComponentHealth{
+		Status:      statusOK,
+		Detail:      fmt.Sprintf("%d domains", s.blocklistManager.Size()),
+		LastUpdated: last.UTC().Format(time.RFC3339),
+		AgeSeconds:  int64(age.Seconds()),
+	}
+	if cfg := s.currentConfig(); cfg != nil && cfg.AutoUpdateBlocklists && cfg.UpdateInterval > 0 &&
+		age > blocklistStaleFactor*cfg.UpdateInterval {
+		c.Status = healthDegraded
+		c.Detail = fmt.Sprintf("last successful update %s ago (update_interval %s)", age, cfg.UpdateInterval)
+	}
+	return c
+}
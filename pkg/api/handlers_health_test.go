@@ -9,6 +9,11 @@ import (
 	"testing"
 	"time"
 
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/dns"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
 	"glory-hole/pkg/policy"
 	"glory-hole/pkg/storage"
 )
@@ -26,6 +31,10 @@ func (m *mockStorageForHealth) GetRecentQueries(ctx context.Context, limit, offs
 	return nil, nil
 }
 
+func (m *mockStorageForHealth) GetRecentBlocked(ctx context.Context, limit, offset int) ([]*storage.QueryLog, error) {
+	return nil, nil
+}
+
 func (m *mockStorageForHealth) GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*storage.QueryLog, error) {
 	return nil, nil
 }
@@ -45,6 +54,10 @@ func (m *mockStorageForHealth) GetTopDomains(ctx context.Context, limit int, blo
 	return nil, nil
 }
 
+func (m *mockStorageForHealth) CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockStorageForHealth) GetBlockedCount(ctx context.Context, since time.Time) (int64, error) {
 	return 0, nil
 }
@@ -57,10 +70,22 @@ func (m *mockStorageForHealth) GetQueriesFiltered(ctx context.Context, filter st
 	return []*storage.QueryLog{}, nil
 }
 
+func (m *mockStorageForHealth) CountQueriesFiltered(ctx context.Context, filter storage.QueryFilter, limit int) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockStorageForHealth) GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
 	return []*storage.TimeSeriesPoint{}, nil
 }
 
+func (m *mockStorageForHealth) GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	return []*storage.TimeSeriesPoint{}, nil
+}
+
+func (m *mockStorageForHealth) GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	return []*storage.TimeSeriesPoint{}, nil
+}
+
 func (m *mockStorageForHealth) GetTraceStatistics(ctx context.Context, since time.Time) (*storage.TraceStatistics, error) {
 	return &storage.TraceStatistics{
 		Since:    since,
@@ -103,10 +128,22 @@ func (m *mockStorageForHealth) ListClientProfiles(ctx context.Context) ([]*stora
 	return nil, nil
 }
 
-func (m *mockStorageForHealth) GetClientSummaries(ctx context.Context, limit, offset int) ([]*storage.ClientSummary, error) {
+func (m *mockStorageForHealth) GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*storage.ClientSummary, error) {
 	return []*storage.ClientSummary{}, nil
 }
 
+func (m *mockStorageForHealth) CountClientSummaries(ctx context.Context, since time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockStorageForHealth) SetClientHostname(ctx context.Context, clientIP, hostname string) error {
+	return nil
+}
+
+func (m *mockStorageForHealth) ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
+}
+
 func (m *mockStorageForHealth) UpdateClientProfile(ctx context.Context, profile *storage.ClientProfile) error {
 	return nil
 }
@@ -408,3 +445,156 @@ func TestHandleReadiness_MethodNotAllowed(t *testing.T) {
 		}
 	}
 }
+
+func detailedHealth(t *testing.T, server *Server) (int, DetailedHealthResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/health/detailed", nil)
+	w := httptest.NewRecorder()
+	server.handleHealthDetailed(w, req)
+
+	var response DetailedHealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return w.Code, response
+}
+
+func TestHandleHealthDetailed_OK(t *testing.T) {
+	cfg := &config.Config{UpstreamDNSServers: []string{"192.0.2.1:53"}}
+	handler := dns.NewHandler()
+	handler.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       &mockStorageForHealth{},
+		DNSHandler:    handler,
+		Version:       "test",
+	})
+
+	code, response := detailedHealth(t, server)
+	if code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if response.Status != "ok" {
+		t.Errorf("expected status 'ok', got %s", response.Status)
+	}
+	if got := response.Components["upstreams"]; got.Status != "ok" || !got.Critical {
+		t.Errorf("expected critical ok upstreams, got %+v", got)
+	}
+	if got := response.Components["storage"].Status; got != "ok" {
+		t.Errorf("expected storage 'ok', got %s", got)
+	}
+	for _, name := range []string{"dns", "cache", "blocklist"} {
+		if got := response.Components[name].Status; got != statusNotConfigured {
+			t.Errorf("expected %s 'not_configured', got %s", name, got)
+		}
+	}
+}
+
+func TestHandleHealthDetailed_StorageDownIsDegraded(t *testing.T) {
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       &mockStorageForHealth{shouldFail: true},
+	})
+
+	code, response := detailedHealth(t, server)
+	if code != http.StatusOK {
+		t.Errorf("expected status 200 (storage is not critical), got %d", code)
+	}
+	if response.Status != "degraded" {
+		t.Errorf("expected status 'degraded', got %s", response.Status)
+	}
+	if got := response.Components["storage"].Status; got != "down" {
+		t.Errorf("expected storage 'down', got %s", got)
+	}
+	if got := response.Components["storage"].Detail; got != "storage ping failed" {
+		t.Errorf("expected a fixed storage detail, got %q", got)
+	}
+}
+
+// diskUsageStorage is a health mock backed by local files.
+type diskUsageStorage struct {
+	mockStorageForHealth
+	usage storage.DiskUsage
+}
+
+func (m *diskUsageStorage) DiskUsage() (storage.DiskUsage, error) {
+	return m.usage, nil
+}
+
+func TestHandleHealthDetailed_StorageDiskUsage(t *testing.T) {
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       &diskUsageStorage{usage: storage.DiskUsage{DatabaseBytes: 4096, WALBytes: 1024}},
+	})
+
+	_, response := detailedHealth(t, server)
+	got := response.Components["storage"]
+	if got.Status != "ok" || got.DatabaseBytes != 4096 || got.WALBytes != 1024 {
+		t.Errorf("expected storage ok with 4096/1024 bytes, got %+v", got)
+	}
+}
+
+// bufferStorage is a health mock that queues writes in memory.
+type bufferStorage struct {
+	mockStorageForHealth
+	stats storage.BufferStats
+}
+
+func (m *bufferStorage) GetBufferStats() storage.BufferStats {
+	return m.stats
+}
+
+func TestHandleHealthDetailed_StorageBuffer(t *testing.T) {
+	server := New(&Config{
+		ListenAddress: ":8080",
+		Storage:       &bufferStorage{stats: storage.BufferStats{Size: 3, Capacity: 10, Peak: 10, Dropped: 7}},
+	})
+
+	_, response := detailedHealth(t, server)
+	got := response.Components["storage"].Buffer
+	if got == nil || got.Peak != 10 || got.Dropped != 7 {
+		t.Errorf("expected buffer peak 10 with 7 drops, got %+v", got)
+	}
+}
+
+func TestHandleHealthDetailed_DNSListenerDown(t *testing.T) {
+	cfg := &config.Config{}
+	server := New(&Config{ListenAddress: ":8080"})
+	// Never started, so IsRunning reports false.
+	server.SetDNSServer(dns.NewServer(cfg, dns.NewHandler(), logging.NewDefault(), nil))
+
+	code, response := detailedHealth(t, server)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", code)
+	}
+	if response.Status != "down" {
+		t.Errorf("expected status 'down', got %s", response.Status)
+	}
+}
+
+func TestHandleHealthDetailed_BlocklistNotLoaded(t *testing.T) {
+	cfg := &config.Config{AutoUpdateBlocklists: true, UpdateInterval: time.Hour}
+	server := New(&Config{
+		ListenAddress:    ":8080",
+		BlocklistManager: blocklist.NewManager(cfg, logging.NewDefault(), nil, nil),
+		InitialConfig:    cfg,
+	})
+
+	// Never loaded.
+	if got := server.blocklistHealth(time.Now()); got.Status != "degraded" {
+		t.Errorf("expected unloaded blocklist 'degraded', got %+v", got)
+	}
+}
+
+func TestHandleHealthDetailed_MethodNotAllowed(t *testing.T) {
+	server := New(&Config{ListenAddress: ":8080"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/health/detailed", nil)
+	w := httptest.NewRecorder()
+	server.handleHealthDetailed(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", w.Code)
+	}
+}
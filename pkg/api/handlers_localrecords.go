@@ -8,9 +8,11 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"glory-hole/pkg/config"
 	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/pattern"
 )
 
 // LocalRecordResponse represents a single local DNS record in API responses
@@ -72,7 +74,7 @@ func (s *Server) handleGetLocalRecords(w http.ResponseWriter, r *http.Request) {
 				Weight:     entry.Weight,
 				Port:       entry.Port,
 				Wildcard:   entry.Wildcard,
-				Enabled:    true, // All records in config are considered enabled
+				Enabled:    entry.IsEnabled(),
 			})
 		}
 	}
@@ -190,6 +192,7 @@ func (s *Server) handleAddLocalRecord(w http.ResponseWriter, r *http.Request) {
 	if err := s.persistLocalRecordsConfig(func(cfg *config.Config) error {
 		cfg.LocalRecords.Enabled = true
 		cfg.LocalRecords.Records = append(cfg.LocalRecords.Records, entry)
+		bumpSOASerials(&cfg.LocalRecords, nil, entry.Domain)
 		return nil
 	}); err != nil {
 		s.logger.Error("Failed to persist local record to config", "error", err)
@@ -256,6 +259,7 @@ func (s *Server) handleRemoveLocalRecord(w http.ResponseWriter, r *http.Request)
 		}
 
 		cfg.LocalRecords.Records = newRecords
+		bumpSOASerials(&cfg.LocalRecords, nil, domain)
 		return nil
 	}); err != nil {
 		s.logger.Error("Failed to persist local records to config", "error", err)
@@ -282,6 +286,223 @@ func (s *Server) handleRemoveLocalRecord(w http.ResponseWriter, r *http.Request)
 	s.handleGetLocalRecords(w, r)
 }
 
+// handleEnableLocalRecord serves a disabled local DNS record again
+// POST /api/localrecords/{id}/enable
+func (s *Server) handleEnableLocalRecord(w http.ResponseWriter, r *http.Request) {
+	s.setLocalRecordEnabled(w, r, true)
+}
+
+// handleDisableLocalRecord stops serving a local DNS record while keeping it
+// in the config, e.g. for a maintenance window
+// POST /api/localrecords/{id}/disable
+func (s *Server) handleDisableLocalRecord(w http.ResponseWriter, r *http.Request) {
+	s.setLocalRecordEnabled(w, r, false)
+}
+
+// setLocalRecordEnabled flips the enabled flag of the records matching the
+// domain and type in the ID, persists it, and reloads the DNS handler.
+func (s *Server) setLocalRecordEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if s.dnsHandler == nil {
+		s.writeError(w, http.StatusInternalServerError, "DNS handler not configured")
+		return
+	}
+
+	recordID := r.PathValue("id")
+	if recordID == "" {
+		s.writeError(w, http.StatusBadRequest, "Record ID parameter required")
+		return
+	}
+
+	// Parse record ID (format: domain:type:index)
+	parts := strings.Split(recordID, ":")
+	if len(parts) != 3 {
+		s.writeError(w, http.StatusBadRequest, "Invalid record ID format")
+		return
+	}
+
+	domain := parts[0]
+	recordType := parts[1]
+
+	if err := s.persistLocalRecordsConfig(func(cfg *config.Config) error {
+		if config.SetLocalRecordEnabled(cfg.LocalRecords.Records, domain, recordType, enabled) == 0 {
+			return fmt.Errorf("record not found")
+		}
+		bumpSOASerials(&cfg.LocalRecords, nil, domain)
+		return nil
+	}); err != nil {
+		s.logger.Error("Failed to persist local records to config", "error", err)
+		if strings.Contains(err.Error(), "not found") {
+			s.writeError(w, http.StatusNotFound, "Record not found")
+		} else {
+			s.writeError(w, http.StatusInternalServerError, "Failed to update record")
+		}
+		return
+	}
+
+	// Reload local records in DNS handler
+	if err := s.reloadLocalRecords(); err != nil {
+		s.logger.Error("Failed to reload local records", "error", err)
+	}
+
+	s.logger.Info("Toggled local DNS record",
+		"domain", domain,
+		"type", recordType,
+		"enabled", enabled)
+
+	// Return updated list
+	s.handleGetLocalRecords(w, r)
+}
+
+// LocalRecordsImportResponse reports the outcome of a local-records import.
+type LocalRecordsImportResponse struct {
+	Mode                  string `json:"mode"`                    // merge or replace
+	Imported              int    `json:"imported"`                // records in the uploaded file
+	Added                 int    `json:"added"`                   // records written (merge skips exact duplicates)
+	Total                 int    `json:"total"`                   // local records after the import
+	StaticAnswersImported int    `json:"static_answers_imported"` // static answers in the uploaded file
+	StaticAnswersAdded    int    `json:"static_answers_added"`    // static answers written
+}
+
+// handleExportLocalRecords handles GET /api/localrecords/export[?format=json|zone].
+// It downloads local_records.records and the static_answers overrides on
+// their own, for backups or moving hand-curated records between instances.
+// Zone files carry the records only.
+func (s *Server) handleExportLocalRecords(w http.ResponseWriter, r *http.Request) {
+	var records []config.LocalRecordEntry
+	var staticAnswers []config.StaticAnswerEntry
+	if cfg := s.currentConfig(); cfg != nil {
+		records, staticAnswers = cfg.LocalRecords.Records, cfg.StaticAnswers
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	data, err := config.ExportLocalRecords(records, staticAnswers, format)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename, contentType := "local-records.json", "application/json"
+	if format == config.LocalRecordsFormatZone {
+		filename, contentType = "local-records.zone", "text/dns"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	_, _ = w.Write(data)
+}
+
+// handleImportLocalRecords handles POST /api/localrecords/import[?mode=merge|replace].
+// The body is an export in either format. merge (the default) appends
+// records and static answers that aren't already configured; replace swaps
+// the record list, and the static answers when the file has them.
+func (s *Server) handleImportLocalRecords(w http.ResponseWriter, r *http.Request) {
+	if s.dnsHandler == nil {
+		s.writeError(w, http.StatusInternalServerError, "DNS handler not configured")
+		return
+	}
+
+	mode := strings.ToLower(r.URL.Query().Get("mode"))
+	if mode == "" {
+		mode = "merge"
+	}
+	if mode != "merge" && mode != "replace" {
+		s.writeError(w, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1*1024*1024)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	doc, err := config.ImportLocalRecords(body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := LocalRecordsImportResponse{Mode: mode, Imported: len(doc.Records), StaticAnswersImported: len(doc.StaticAnswers)}
+	if err := s.persistLocalRecordsConfig(func(cfg *config.Config) error {
+		prev := soaSerials(cfg.LocalRecords.Records)
+		defer func() {
+			domains := make([]string, len(doc.Records))
+			for i, entry := range doc.Records {
+				domains[i] = entry.Domain
+			}
+			bumpSOASerials(&cfg.LocalRecords, prev, domains...)
+		}()
+		resp.Added, resp.StaticAnswersAdded = cfg.ApplyLocalRecordsImport(doc, mode == "replace")
+		resp.Total = len(cfg.LocalRecords.Records)
+		return nil
+	}); err != nil {
+		s.logger.Error("Failed to persist imported local records", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "Failed to save records")
+		return
+	}
+
+	if err := s.reloadLocalRecords(); err != nil {
+		s.logger.Error("Failed to reload local records", "error", err)
+	}
+	if cfg := s.currentConfig(); cfg != nil {
+		s.dnsHandler.SetStaticAnswers(cfg.StaticAnswers)
+	}
+
+	s.logger.Info("Imported local DNS records", "mode", mode, "imported", resp.Imported, "added", resp.Added,
+		"static_answers_added", resp.StaticAnswersAdded)
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// soaSerials returns the serial of each SOA entry, keyed by normalized origin.
+func soaSerials(records []config.LocalRecordEntry) map[string]uint32 {
+	serials := make(map[string]uint32)
+	for _, entry := range records {
+		if strings.EqualFold(entry.Type, "SOA") && entry.Serial != nil {
+			serials[pattern.NormalizeFQDN(entry.Domain)] = *entry.Serial
+		}
+	}
+	return serials
+}
+
+// bumpSOASerials applies local_records.soa_serial after records under
+// domains changed: the serial of each SOA covering one of them moves forward
+// once. prev holds serials from before the change, so a zone replaced by an
+// import never goes backwards; nil means the SOAs themselves weren't touched.
+func bumpSOASerials(lr *config.LocalRecordsConfig, prev map[string]uint32, domains ...string) {
+	mode := localrecords.SerialMode(lr.SOASerial)
+	if mode != localrecords.SerialIncrement && mode != localrecords.SerialDate {
+		return
+	}
+
+	var origins []string
+	var entries []*config.LocalRecordEntry
+	for i := range lr.Records {
+		if strings.EqualFold(lr.Records[i].Type, "SOA") {
+			origins = append(origins, lr.Records[i].Domain)
+			entries = append(entries, &lr.Records[i])
+		}
+	}
+
+	now := time.Now()
+	bumped := make(map[int]bool, len(origins))
+	for _, domain := range domains {
+		i := localrecords.ZoneOrigin(domain, origins)
+		if i < 0 || bumped[i] {
+			continue
+		}
+		bumped[i] = true
+
+		current := uint32(1) // the serial an SOA entry without one is served with
+		if entries[i].Serial != nil {
+			current = *entries[i].Serial
+		}
+		if p, ok := prev[pattern.NormalizeFQDN(origins[i])]; ok && p > current {
+			current = p
+		}
+		next := localrecords.NextSerial(current, mode, now)
+		entries[i].Serial = &next
+	}
+}
+
 // persistLocalRecordsConfig persists local records changes to config file
 func (s *Server) persistLocalRecordsConfig(mutator func(cfg *config.Config) error) error {
 	if s.configPath == "" {
@@ -358,7 +579,7 @@ func (s *Server) reloadLocalRecords() error {
 			TxtRecords: entry.TxtRecords,
 			TTL:        entry.TTL,
 			Wildcard:   entry.Wildcard,
-			Enabled:    true,
+			Enabled:    entry.IsEnabled(),
 		}
 
 		// Set optional fields
@@ -372,6 +593,24 @@ func (s *Server) reloadLocalRecords() error {
 			record.Port = *entry.Port
 		}
 
+		// SOA and CAA fields, with the same defaults as startup
+		switch record.Type {
+		case localrecords.RecordTypeSOA:
+			record.Ns = pattern.NormalizeFQDN(entry.Ns)
+			record.Mbox = entry.Mbox
+			record.Serial = uint32OrDefault(entry.Serial, 1)
+			record.Refresh = uint32OrDefault(entry.Refresh, 3600)
+			record.Retry = uint32OrDefault(entry.Retry, 600)
+			record.Expire = uint32OrDefault(entry.Expire, 86400)
+			record.Minttl = uint32OrDefault(entry.Minttl, 300)
+		case localrecords.RecordTypeCAA:
+			record.CaaTag = entry.CaaTag
+			record.CaaValue = entry.CaaValue
+			if entry.CaaFlag != nil {
+				record.CaaFlag = *entry.CaaFlag
+			}
+		}
+
 		if err := mgr.AddRecord(record); err != nil {
 			s.logger.Error("Failed to add local record", "error", err, "domain", entry.Domain, "type", entry.Type)
 			continue
@@ -382,3 +621,11 @@ func (s *Server) reloadLocalRecords() error {
 	s.dnsHandler.SetLocalRecords(mgr)
 	return nil
 }
+
+// uint32OrDefault returns *v, or def when v is nil.
+func uint32OrDefault(v *uint32, def uint32) uint32 {
+	if v != nil {
+		return *v
+	}
+	return def
+}
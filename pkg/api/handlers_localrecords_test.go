@@ -228,7 +228,7 @@ func TestHandleAddLocalRecord_MissingDomain(t *testing.T) {
 	var response ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
-	assert.Contains(t, response.Message, "Domain is required")
+	assert.Contains(t, response.Error.Message, "Domain is required")
 }
 
 func TestHandleAddLocalRecord_InvalidType(t *testing.T) {
@@ -253,7 +253,7 @@ func TestHandleAddLocalRecord_InvalidType(t *testing.T) {
 	var response ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
-	assert.Contains(t, response.Message, "Unsupported record type")
+	assert.Contains(t, response.Error.Message, "Unsupported record type")
 }
 
 func TestHandleAddLocalRecord_ARecordWithoutIP(t *testing.T) {
@@ -278,7 +278,7 @@ func TestHandleAddLocalRecord_ARecordWithoutIP(t *testing.T) {
 	var response ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
-	assert.Contains(t, response.Message, "IPs are required")
+	assert.Contains(t, response.Error.Message, "IPs are required")
 }
 
 func TestHandleAddLocalRecord_CNAMEWithoutTarget(t *testing.T) {
@@ -303,7 +303,7 @@ func TestHandleAddLocalRecord_CNAMEWithoutTarget(t *testing.T) {
 	var response ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
-	assert.Contains(t, response.Message, "Target is required")
+	assert.Contains(t, response.Error.Message, "Target is required")
 }
 
 func TestHandleAddLocalRecord_InvalidJSON(t *testing.T) {
@@ -383,7 +383,7 @@ func TestHandleRemoveLocalRecord_InvalidIDFormat(t *testing.T) {
 	var response ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	require.NoError(t, err)
-	assert.Contains(t, response.Message, "Invalid record ID format")
+	assert.Contains(t, response.Error.Message, "Invalid record ID format")
 }
 
 func TestHandleRemoveLocalRecord_MissingID(t *testing.T) {
@@ -452,3 +452,193 @@ func TestHandleGetLocalRecords_HTMLResponse(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestHandleExportLocalRecords(t *testing.T) {
+	server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{
+		{Domain: "router.local", Type: "A", IPs: []string{"192.168.1.1"}, TTL: 300},
+	})
+	server.configSnapshot.StaticAnswers = []config.StaticAnswerEntry{
+		{Domain: "example.com", Type: "TXT", Values: []string{`"pinned"`}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/localrecords/export", nil)
+	w := httptest.NewRecorder()
+	server.handleExportLocalRecords(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "local-records.json")
+	var doc config.LocalRecordsExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, 2, doc.Version)
+	require.Len(t, doc.Records, 1)
+	assert.Equal(t, "router.local", doc.Records[0].Domain)
+	require.Len(t, doc.StaticAnswers, 1)
+	assert.Equal(t, "example.com", doc.StaticAnswers[0].Domain)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/localrecords/export?format=zone", nil)
+	w = httptest.NewRecorder()
+	server.handleExportLocalRecords(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "router.local.\t300\tIN\tA\t192.168.1.1")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/localrecords/export?format=csv", nil)
+	w = httptest.NewRecorder()
+	server.handleExportLocalRecords(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleImportLocalRecords(t *testing.T) {
+	existing := config.LocalRecordEntry{Domain: "router.local", Type: "A", IPs: []string{"192.168.1.1"}, TTL: 300}
+	zone := "router.local. 300 IN A 192.168.1.1\nnas.local. 300 IN A 192.168.1.5\n"
+
+	t.Run("merge skips duplicates", func(t *testing.T) {
+		server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{existing})
+		req := httptest.NewRequest(http.MethodPost, "/api/localrecords/import", bytes.NewBufferString(zone))
+		w := httptest.NewRecorder()
+		server.handleImportLocalRecords(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp LocalRecordsImportResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, LocalRecordsImportResponse{Mode: "merge", Imported: 2, Added: 1, Total: 2}, resp)
+
+		saved, err := config.Load(server.configPath)
+		require.NoError(t, err)
+		assert.Len(t, saved.LocalRecords.Records, 2)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{existing})
+		body := `{"version": 1, "records": [{"domain": "nas.local", "type": "a", "ips": ["192.168.1.5"]}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/localrecords/import?mode=replace", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		server.handleImportLocalRecords(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		saved, err := config.Load(server.configPath)
+		require.NoError(t, err)
+		require.Len(t, saved.LocalRecords.Records, 1)
+		assert.Equal(t, "nas.local", saved.LocalRecords.Records[0].Domain)
+		assert.Equal(t, "A", saved.LocalRecords.Records[0].Type)
+	})
+
+	t.Run("static answers", func(t *testing.T) {
+		server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{existing})
+		body := `{"version": 2, "records": [], "static_answers": [{"domain": "example.com", "type": "AAAA", "rcode": "NXDOMAIN"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/localrecords/import", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		server.handleImportLocalRecords(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp LocalRecordsImportResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 1, resp.StaticAnswersImported)
+		assert.Equal(t, 1, resp.StaticAnswersAdded)
+
+		saved, err := config.Load(server.configPath)
+		require.NoError(t, err)
+		require.Len(t, saved.StaticAnswers, 1)
+		assert.Equal(t, "NXDOMAIN", saved.StaticAnswers[0].Rcode)
+		assert.Len(t, saved.LocalRecords.Records, 1)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		server := createTestServerForLocalRecords(t, nil)
+		for _, target := range []string{"/api/localrecords/import", "/api/localrecords/import?mode=append"} {
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString("nas.local. 300 IN A nope\n"))
+			w := httptest.NewRecorder()
+			server.handleImportLocalRecords(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		}
+	})
+}
+
+func TestLocalRecordChangesBumpSOASerial(t *testing.T) {
+	serial := uint32(10)
+	soa := config.LocalRecordEntry{Domain: "local", Type: "SOA", Ns: "ns1.local", Mbox: "admin.local", Serial: &serial}
+	newServer := func(t *testing.T) *Server {
+		server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{soa})
+		server.configSnapshot.LocalRecords.SOASerial = config.SOASerialIncrement
+		return server
+	}
+	savedSerial := func(t *testing.T, server *Server) uint32 {
+		t.Helper()
+		saved, err := config.Load(server.configPath)
+		require.NoError(t, err)
+		for _, entry := range saved.LocalRecords.Records {
+			if entry.Type == "SOA" {
+				require.NotNil(t, entry.Serial)
+				return *entry.Serial
+			}
+		}
+		t.Fatal("SOA record missing from saved config")
+		return 0
+	}
+
+	t.Run("add", func(t *testing.T) {
+		server := newServer(t)
+		body, _ := json.Marshal(LocalRecordAddRequest{Domain: "tv.local", Type: "A", IPs: []string{"192.168.1.20"}})
+		w := httptest.NewRecorder()
+		server.handleAddLocalRecord(w, httptest.NewRequest(http.MethodPost, "/api/localrecords", bytes.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, uint32(11), savedSerial(t, server))
+	})
+
+	t.Run("replace never moves backwards", func(t *testing.T) {
+		server := newServer(t)
+		zone := "local. 300 IN SOA ns1.local. admin.local. 3 3600 600 86400 300\nnas.local. 300 IN A 192.168.1.5\n"
+		w := httptest.NewRecorder()
+		server.handleImportLocalRecords(w, httptest.NewRequest(http.MethodPost, "/api/localrecords/import?mode=replace", bytes.NewBufferString(zone)))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, uint32(11), savedSerial(t, server))
+	})
+
+	t.Run("off", func(t *testing.T) {
+		server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{soa})
+		body, _ := json.Marshal(LocalRecordAddRequest{Domain: "tv.local", Type: "A", IPs: []string{"192.168.1.20"}})
+		w := httptest.NewRecorder()
+		server.handleAddLocalRecord(w, httptest.NewRequest(http.MethodPost, "/api/localrecords", bytes.NewReader(body)))
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, uint32(10), savedSerial(t, server))
+	})
+}
+
+func TestHandleDisableLocalRecord(t *testing.T) {
+	server := createTestServerForLocalRecords(t, []config.LocalRecordEntry{
+		{Domain: "nas.local.", Type: "A", IPs: []string{"192.168.1.5"}, TTL: 300},
+		{Domain: "mail.local.", Type: "A", IPs: []string{"192.168.1.6"}, TTL: 300},
+	})
+	toggle := func(action, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/localrecords/"+id+"/"+action, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		if action == "enable" {
+			server.handleEnableLocalRecord(w, req)
+		} else {
+			server.handleDisableLocalRecord(w, req)
+		}
+		return w
+	}
+	savedEnabled := func() map[string]bool {
+		saved, err := config.Load(server.configPath)
+		require.NoError(t, err)
+		states := map[string]bool{}
+		for _, entry := range saved.LocalRecords.Records {
+			states[entry.Domain] = entry.IsEnabled()
+		}
+		return states
+	}
+
+	w := toggle("disable", "nas.local.:A:0")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, map[string]bool{"nas.local.": false, "mail.local.": true}, savedEnabled())
+
+	w = toggle("enable", "nas.local.:A:0")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, savedEnabled()["nas.local."])
+
+	assert.Equal(t, http.StatusNotFound, toggle("disable", "missing.local.:A:0").Code)
+}
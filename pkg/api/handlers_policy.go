@@ -3,10 +3,12 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -22,22 +24,43 @@ type PolicyResponse struct {
 	Logic      string `json:"logic"`
 	Action     string `json:"action"`
 	ActionData string `json:"action_data,omitempty"`
+	Category   string `json:"category,omitempty"`
 	ID         int64  `json:"id"`
+	Priority   int    `json:"priority"`
 	Enabled    bool   `json:"enabled"`
 }
 
+// PolicyRuleStatsResponse is the hit counter of one loaded policy rule.
+type PolicyRuleStatsResponse struct {
+	LastHit *time.Time `json:"last_hit,omitempty"`
+	Name    string     `json:"name"`
+	Action  string     `json:"action"`
+	Hits    uint64     `json:"hits"`
+	Enabled bool       `json:"enabled"`
+}
+
+// PolicyStatsResponse lists per-rule hit counters in evaluation order.
+type PolicyStatsResponse struct {
+	Rules     []PolicyRuleStatsResponse `json:"rules"`
+	TotalHits uint64                    `json:"total_hits"`
+}
+
 // PolicyListResponse represents the list of policies
 type PolicyListResponse struct {
 	Policies []PolicyResponse `json:"policies"`
 	Total    int              `json:"total"`
 }
 
-// PolicyRequest represents a request to add/update a policy
+// PolicyRequest represents a request to add/update a policy.
+// Rules with a higher Priority are evaluated first. Category is only
+// valid for BLOCK rules.
 type PolicyRequest struct {
 	Name       string `json:"name"`
 	Logic      string `json:"logic"`
 	Action     string `json:"action"`
 	ActionData string `json:"action_data,omitempty"`
+	Category   string `json:"category,omitempty"`
+	Priority   int    `json:"priority"`
 	Enabled    bool   `json:"enabled"`
 }
 
@@ -50,6 +73,8 @@ func policyRuleToResponse(r *storage.PolicyRule) PolicyResponse {
 		Logic:      r.Logic,
 		Action:     r.Action,
 		ActionData: r.ActionData,
+		Category:   r.Category,
+		Priority:   r.Priority,
 		Enabled:    r.Enabled,
 	}
 }
@@ -75,7 +100,8 @@ func (s *Server) loadPolicyResponses(ctx context.Context) ([]PolicyResponse, err
 		for i, r := range rules {
 			out = append(out, PolicyResponse{
 				ID: int64(i), Name: r.Name, Logic: r.Logic,
-				Action: r.Action, ActionData: r.ActionData, Enabled: r.Enabled,
+				Action: r.Action, ActionData: r.ActionData, Category: r.Category,
+				Priority: r.Priority, Enabled: r.Enabled,
 			})
 		}
 		return out, nil
@@ -104,6 +130,8 @@ func (s *Server) rebuildPolicyEngine(ctx context.Context) error {
 			Logic:      r.Logic,
 			Action:     r.Action,
 			ActionData: r.ActionData,
+			Category:   r.Category,
+			Priority:   r.Priority,
 			Enabled:    r.Enabled,
 		}
 		if err := rule.Compile(); err != nil {
@@ -184,9 +212,13 @@ func (s *Server) handleAddPolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate expression compiles before persisting
+	if se := policy.ValidateLogic(req.Logic); se != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid logic: %v", se))
+		return
+	}
 	testRule := &policy.Rule{
 		Name: req.Name, Logic: req.Logic, Action: req.Action,
-		ActionData: req.ActionData, Enabled: req.Enabled,
+		ActionData: req.ActionData, Category: req.Category, Priority: req.Priority, Enabled: req.Enabled,
 	}
 	testEngine := policy.NewEngine(nil)
 	if err := testEngine.AddRule(testRule); err != nil {
@@ -206,8 +238,10 @@ func (s *Server) handleAddPolicy(w http.ResponseWriter, r *http.Request) {
 			Logic:      req.Logic,
 			Action:     req.Action,
 			ActionData: req.ActionData,
+			Category:   req.Category,
 			Enabled:    req.Enabled,
 			SortOrder:  sortOrder,
+			Priority:   req.Priority,
 		}
 		var createErr error
 		newID, createErr = s.storage.CreatePolicyRule(r.Context(), dbRule)
@@ -226,7 +260,7 @@ func (s *Server) handleAddPolicy(w http.ResponseWriter, r *http.Request) {
 			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add policy: %v", err))
 			return
 		}
-		newID = int64(s.policyEngine.Count() - 1)
+		newID = int64(slices.Index(s.policyEngine.GetRules(), testRule))
 	}
 
 	s.logger.Info("Policy added via API", "id", newID, "name", req.Name, "action", req.Action)
@@ -237,6 +271,8 @@ func (s *Server) handleAddPolicy(w http.ResponseWriter, r *http.Request) {
 		Logic:      req.Logic,
 		Action:     req.Action,
 		ActionData: req.ActionData,
+		Category:   req.Category,
+		Priority:   req.Priority,
 		Enabled:    req.Enabled,
 	})
 }
@@ -275,9 +311,13 @@ func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate expression compiles
+	if se := policy.ValidateLogic(req.Logic); se != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid logic: %v", se))
+		return
+	}
 	testRule := &policy.Rule{
 		Name: req.Name, Logic: req.Logic, Action: req.Action,
-		ActionData: req.ActionData, Enabled: req.Enabled,
+		ActionData: req.ActionData, Category: req.Category, Priority: req.Priority, Enabled: req.Enabled,
 	}
 	testEngine := policy.NewEngine(nil)
 	if err := testEngine.AddRule(testRule); err != nil {
@@ -286,13 +326,27 @@ func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if s.storage != nil {
+		// Keep the rule's sort_order so an edit doesn't move it ahead of
+		// rules with the same priority.
+		existing, _ := s.storage.GetPolicyRules(r.Context())
+		sortOrder := 0
+		for _, e := range existing {
+			if e.ID == id {
+				sortOrder = e.SortOrder
+				break
+			}
+		}
+
 		// Update in SQLite
 		dbRule := &storage.PolicyRule{
 			Name:       req.Name,
 			Logic:      req.Logic,
 			Action:     req.Action,
 			ActionData: req.ActionData,
+			Category:   req.Category,
 			Enabled:    req.Enabled,
+			SortOrder:  sortOrder,
+			Priority:   req.Priority,
 		}
 		if err := s.storage.UpdatePolicyRule(r.Context(), id, dbRule); err != nil {
 			s.writeError(w, http.StatusNotFound, fmt.Sprintf("Failed to update policy: %v", err))
@@ -322,6 +376,8 @@ func (s *Server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
 		Logic:      req.Logic,
 		Action:     req.Action,
 		ActionData: req.ActionData,
+		Category:   req.Category,
+		Priority:   req.Priority,
 		Enabled:    req.Enabled,
 	})
 }
@@ -410,11 +466,134 @@ func (s *Server) handleExportPolicies(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleGetPolicyStats returns how many queries each loaded rule has decided
+// since the rules were last loaded, to find rules that never fire.
+func (s *Server) handleGetPolicyStats(w http.ResponseWriter, r *http.Request) {
+	if s.policyEngine == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Policy engine not configured")
+		return
+	}
+
+	stats := s.policyEngine.Stats()
+	resp := PolicyStatsResponse{Rules: make([]PolicyRuleStatsResponse, 0, len(stats))}
+	for _, st := range stats {
+		rs := PolicyRuleStatsResponse{Name: st.Name, Action: st.Action, Hits: st.Hits, Enabled: st.Enabled}
+		if !st.LastHit.IsZero() {
+			lastHit := st.LastHit
+			rs.LastHit = &lastHit
+		}
+		resp.Rules = append(resp.Rules, rs)
+		resp.TotalHits += st.Hits
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// PolicyValidateRequest is a rule to check without saving it. When Domain is
+// set, the logic is also evaluated against that sample query.
+type PolicyValidateRequest struct {
+	Logic      string `json:"logic"`
+	Action     string `json:"action,omitempty"`
+	ActionData string `json:"action_data,omitempty"`
+	Category   string `json:"category,omitempty"`
+	Domain     string `json:"domain,omitempty"`
+	ClientIP   string `json:"client_ip,omitempty"`
+	QueryType  string `json:"query_type,omitempty"`
+	Time       string `json:"time,omitempty"` // RFC 3339; defaults to now
+}
+
+// PolicyValidationError is one problem found in a rule. Line and Column are
+// 1-based positions in the logic expression, omitted when unknown.
+type PolicyValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Snippet string `json:"snippet,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// PolicyValidateResponse reports whether a rule would load and, for a sample
+// query, whether it would match.
+type PolicyValidateResponse struct {
+	Errors  []PolicyValidationError `json:"errors"`
+	Matched *bool                   `json:"matched,omitempty"`
+	Valid   bool                    `json:"valid"`
+}
+
+// handleValidatePolicy handles POST /api/policies/validate: a dry run that
+// compiles a rule, reports syntax errors with their position, and optionally
+// evaluates it against a sample domain, client, and query type.
+func (s *Server) handleValidatePolicy(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1*1024*1024)
+	var req PolicyValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	domain := strings.TrimSpace(req.Domain)
+	sample, err := policySampleContext(domain, req.ClientIP, req.QueryType, req.Time)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := PolicyValidateResponse{Errors: []PolicyValidationError{}}
+	if se := policy.ValidateLogic(req.Logic); se != nil {
+		resp.Errors = append(resp.Errors, PolicyValidationError{
+			Field: "logic", Message: se.Message, Snippet: se.Snippet, Line: se.Line, Column: se.Column,
+		})
+	}
+	if req.Action != "" {
+		if err := policy.ValidateAction(req.Action, req.ActionData, req.Category); err != nil {
+			resp.Errors = append(resp.Errors, PolicyValidationError{Field: "action", Message: err.Error()})
+		}
+	}
+
+	if domain != "" && len(resp.Errors) == 0 {
+		matched, err := policy.Test(req.Logic, sample)
+		if err != nil {
+			resp.Errors = append(resp.Errors, PolicyValidationError{Field: "logic", Message: err.Error()})
+		} else {
+			resp.Matched = &matched
+		}
+	}
+
+	resp.Valid = len(resp.Errors) == 0
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
 type policyTestRequest struct {
 	Logic     string `json:"logic"`
 	Domain    string `json:"domain"`
 	ClientIP  string `json:"client_ip"`
 	QueryType string `json:"query_type"`
+	Time      string `json:"time,omitempty"` // RFC 3339; defaults to now
+}
+
+// policySampleContext builds the query that /api/policies/validate and
+// /api/policies/test evaluate logic against. The client defaults to
+// 127.0.0.1, the type to A and the time (RFC 3339) to now.
+func policySampleContext(domain, clientIP, queryType, at string) (policy.Context, error) {
+	now := time.Now()
+	if at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return policy.Context{}, errors.New("time must be an RFC 3339 timestamp")
+		}
+		now = t
+	}
+	clientIP = strings.TrimSpace(clientIP)
+	if clientIP == "" {
+		clientIP = "127.0.0.1"
+	}
+	if net.ParseIP(clientIP) == nil {
+		return policy.Context{}, errors.New("client_ip must be a valid address")
+	}
+	queryType = strings.ToUpper(strings.TrimSpace(queryType))
+	if queryType == "" {
+		queryType = "A"
+	}
+	return policy.NewContextAt(domain, clientIP, queryType, now), nil
 }
 
 func (s *Server) handleTestPolicy(w http.ResponseWriter, r *http.Request) {
@@ -442,48 +621,17 @@ func (s *Server) handleTestPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.ClientIP = strings.TrimSpace(req.ClientIP)
-	if req.ClientIP == "" {
-		req.ClientIP = "127.0.0.1"
-	}
-
-	if net.ParseIP(req.ClientIP) == nil {
-		s.writeError(w, http.StatusBadRequest, "Client IP must be a valid address")
+	sample, err := policySampleContext(req.Domain, req.ClientIP, req.QueryType, req.Time)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	req.QueryType = strings.ToUpper(strings.TrimSpace(req.QueryType))
-	if req.QueryType == "" {
-		req.QueryType = "A"
-	}
-
-	engine := policy.NewEngine(nil)
-	rule := &policy.Rule{
-		Name:    "tester",
-		Logic:   req.Logic,
-		Action:  policy.ActionBlock,
-		Enabled: true,
-	}
-
-	if err := engine.AddRule(rule); err != nil {
+	matched, err := policy.Test(req.Logic, sample)
+	if err != nil {
 		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to compile rule: %v", err))
 		return
 	}
-
-	now := time.Now()
-	pCtx := policy.Context{
-		Time:      now,
-		Domain:    req.Domain,
-		ClientIP:  req.ClientIP,
-		QueryType: req.QueryType,
-		Hour:      now.Hour(),
-		Minute:    now.Minute(),
-		Day:       now.Day(),
-		Month:     int(now.Month()),
-		Weekday:   int(now.Weekday()),
-	}
-
-	matched, _ := engine.Evaluate(pCtx)
 	s.writeJSON(w, http.StatusOK, map[string]any{
 		"matched": matched,
 	})
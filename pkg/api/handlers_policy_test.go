@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"glory-hole/pkg/policy"
 )
@@ -93,6 +94,42 @@ func TestHandleExportPolicies(t *testing.T) {
 	}
 }
 
+func TestHandleGetPolicyStats(t *testing.T) {
+	server := setupTestAPIServer()
+	for _, name := range []string{"hit", "dead"} {
+		if err := server.policyEngine.AddRule(&policy.Rule{
+			Name:    name,
+			Logic:   `Domain == "` + name + `.example.com"`,
+			Action:  policy.ActionBlock,
+			Enabled: true,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server.policyEngine.Evaluate(policy.NewContext("hit.example.com", "192.168.1.10", "A"))
+	server.policyEngine.Evaluate(policy.NewContext("hit.example.com", "192.168.1.10", "A"))
+
+	w := httptest.NewRecorder()
+	server.handleGetPolicyStats(w, httptest.NewRequest("GET", "/api/policies/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var stats PolicyStatsResponse
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.TotalHits != 2 || len(stats.Rules) != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if r := stats.Rules[0]; r.Name != "hit" || r.Hits != 2 || r.LastHit == nil {
+		t.Errorf("hit rule = %+v, want 2 hits with last_hit", r)
+	}
+	if r := stats.Rules[1]; r.Name != "dead" || r.Hits != 0 || r.LastHit != nil {
+		t.Errorf("dead rule = %+v, want 0 hits and no last_hit", r)
+	}
+}
+
 func TestHandleAddPolicy_Success(t *testing.T) {
 	server := setupTestAPIServer()
 
@@ -144,6 +181,41 @@ func TestHandleAddPolicy_Success(t *testing.T) {
 	}
 }
 
+func TestHandleAddPolicy_Priority(t *testing.T) {
+	server := setupTestAPIServer()
+
+	add := func(name string, priority int) PolicyResponse {
+		t.Helper()
+		body, _ := json.Marshal(PolicyRequest{
+			Name:     name,
+			Logic:    `Domain == "blocked.com"`,
+			Action:   policy.ActionBlock,
+			Priority: priority,
+			Enabled:  true,
+		})
+		w := httptest.NewRecorder()
+		server.handleAddPolicy(w, httptest.NewRequest("POST", "/api/policies", bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var result PolicyResponse
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	add("normal", 0)
+	if result := add("urgent", 10); result.Priority != 10 || result.ID != 0 {
+		t.Errorf("Expected priority 10 at position 0, got %+v", result)
+	}
+
+	_, rule := server.policyEngine.Evaluate(policy.NewContext("blocked.com", "192.168.1.10", "A"))
+	if rule == nil || rule.Name != "urgent" {
+		t.Errorf("Expected the higher-priority rule to match first, got %v", rule)
+	}
+}
+
 func TestHandleAddPolicy_WithRedirect(t *testing.T) {
 	server := setupTestAPIServer()
 
@@ -209,8 +281,8 @@ func TestHandleAddPolicy_RedirectWithoutActionData(t *testing.T) {
 		t.Fatalf("Failed to decode error response: %v", err)
 	}
 
-	if errResp.Code != http.StatusBadRequest {
-		t.Errorf("Expected error code 400, got %d", errResp.Code)
+	if errResp.Error.Code != "bad_request" {
+		t.Errorf("Expected error code bad_request, got %q", errResp.Error.Code)
 	}
 }
 
@@ -632,6 +704,72 @@ func TestPolicyAPI_NoPolicyEngine(t *testing.T) {
 	}
 }
 
+func TestHandleValidatePolicy(t *testing.T) {
+	server := setupTestAPIServer()
+
+	validate := func(req PolicyValidateRequest) PolicyValidateResponse {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		server.handleValidatePolicy(w, httptest.NewRequest("POST", "/api/policies/validate", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp PolicyValidateResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	resp := validate(PolicyValidateRequest{Logic: `Domain == "ads.example.com" &&`})
+	if resp.Valid || len(resp.Errors) != 1 || resp.Errors[0].Field != "logic" || resp.Errors[0].Line != 1 || resp.Errors[0].Column == 0 {
+		t.Errorf("syntax error: got %+v", resp)
+	}
+	if resp.Matched != nil {
+		t.Error("matched should be omitted without a sample domain")
+	}
+
+	resp = validate(PolicyValidateRequest{Logic: `Domain == "ads.example.com"`, Action: "REDIRECT"})
+	if resp.Valid || len(resp.Errors) != 1 || resp.Errors[0].Field != "action" {
+		t.Errorf("missing redirect target: got %+v", resp)
+	}
+
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 1, 5, 23, 0, 0, 0, time.Local), true},
+		{time.Date(2026, 1, 5, 12, 0, 0, 0, time.Local), false},
+	} {
+		resp = validate(PolicyValidateRequest{
+			Logic:  `DomainEndsWith(Domain, ".example.com") && (Hour >= 22 || Hour < 6)`,
+			Domain: "ads.example.com",
+			Time:   tc.at.Format(time.RFC3339),
+		})
+		if !resp.Valid || resp.Matched == nil || *resp.Matched != tc.want {
+			t.Errorf("sample at %s: got %+v, want matched=%v", tc.at.Format(time.Kitchen), resp, tc.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	body, _ := json.Marshal(PolicyValidateRequest{Logic: "true", Time: "yesterday"})
+	server.handleValidatePolicy(w, httptest.NewRequest("POST", "/api/policies/validate", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid time: expected 400, got %d", w.Code)
+	}
+}
+
+func TestHandleAddPolicy_NonBooleanLogic(t *testing.T) {
+	server := setupTestAPIServer()
+	body, _ := json.Marshal(PolicyRequest{Name: "bad", Logic: "Hour + 1", Action: policy.ActionBlock, Enabled: true})
+	w := httptest.NewRecorder()
+	server.handleAddPolicy(w, httptest.NewRequest("POST", "/api/policies", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-boolean logic, got %d", w.Code)
+	}
+}
+
 // TestHandleTestPolicy exercises the /api/policies/test endpoint with every
 // expression pattern the fixed UI generates, ensuring compile + evaluate work
 // through the HTTP layer.
@@ -389,15 +389,9 @@ func mergeServerBlock(base, partial *unbound.ServerBlock, raw map[string]json.Ra
 	mergeBool("so_reuseport", &base.SoReusePort, partial.SoReusePort)
 }
 
-// writeError helper for compatibility — check if the method exists, otherwise inline it
+// writeUnboundError writes a standard API error for the Unbound handlers.
 func (s *Server) writeUnboundError(w http.ResponseWriter, code int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"error":   http.StatusText(code),
-		"message": msg,
-		"code":    code,
-	})
+	s.writeError(w, code, msg)
 }
 
 // sanitizeZoneName ensures zone names end with a dot
@@ -17,8 +17,10 @@ type KillSwitchManager struct {
 	logger                 *slog.Logger
 	stopChan               chan struct{}
 	onReEnable             func()
+	onDisable              func(feature string, until time.Time)
 	blocklistDisabledUntil time.Time
 	policiesDisabledUntil  time.Time
+	loggingPausedUntil     time.Time
 	mu                     sync.RWMutex
 	wg                     sync.WaitGroup
 	stopOnce               sync.Once
@@ -35,6 +37,15 @@ func (k *KillSwitchManager) SetOnReEnable(fn func()) {
 	k.onReEnable = fn
 }
 
+// SetOnDisable registers a callback invoked when the blocklist ("blocklist")
+// or policies ("policies") are temporarily disabled. It runs on the API
+// request goroutine after the lock is released; keep it non-blocking.
+func (k *KillSwitchManager) SetOnDisable(fn func(feature string, until time.Time)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.onDisable = fn
+}
+
 // NewKillSwitchManager creates a new kill-switch manager
 func NewKillSwitchManager(logger *slog.Logger) *KillSwitchManager {
 	return &KillSwitchManager{
@@ -64,7 +75,7 @@ func (k *KillSwitchManager) monitorExpiration(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	var blocklistLogged, policiesLogged bool
+	var blocklistLogged, policiesLogged, loggingLogged bool
 
 	for {
 		select {
@@ -78,6 +89,8 @@ func (k *KillSwitchManager) monitorExpiration(ctx context.Context) {
 			k.mu.RLock()
 			blocklistDisabled := now.Before(k.blocklistDisabledUntil)
 			policiesDisabled := now.Before(k.policiesDisabledUntil)
+			loggingPaused := now.Before(k.loggingPausedUntil)
+			wasPaused := !k.loggingPausedUntil.IsZero()
 			k.mu.RUnlock()
 
 			// Log when blocklist auto-re-enables
@@ -112,6 +125,12 @@ func (k *KillSwitchManager) monitorExpiration(ctx context.Context) {
 				}
 			}
 
+			// Log when query logging resumes
+			if !loggingPaused && !loggingLogged && wasPaused {
+				k.logger.Info("Query logging resumed after temporary pause")
+				loggingLogged = true
+			}
+
 			// Reset logging flags when features are disabled again
 			if blocklistDisabled {
 				blocklistLogged = false
@@ -119,6 +138,9 @@ func (k *KillSwitchManager) monitorExpiration(ctx context.Context) {
 			if policiesDisabled {
 				policiesLogged = false
 			}
+			if loggingPaused {
+				loggingLogged = false
+			}
 		}
 	}
 }
@@ -126,33 +148,67 @@ func (k *KillSwitchManager) monitorExpiration(ctx context.Context) {
 // DisableBlocklistFor temporarily disables the blocklist for the specified duration
 func (k *KillSwitchManager) DisableBlocklistFor(duration time.Duration) time.Time {
 	k.mu.Lock()
-	defer k.mu.Unlock()
-
 	until := time.Now().Add(duration)
 	k.blocklistDisabledUntil = until
+	onDisable := k.onDisable
+	k.mu.Unlock()
 
 	k.logger.Warn("Blocklist temporarily disabled",
 		"duration", duration,
 		"until", until)
 
+	if onDisable != nil {
+		onDisable("blocklist", until)
+	}
 	return until
 }
 
 // DisablePoliciesFor temporarily disables policies for the specified duration
 func (k *KillSwitchManager) DisablePoliciesFor(duration time.Duration) time.Time {
 	k.mu.Lock()
-	defer k.mu.Unlock()
-
 	until := time.Now().Add(duration)
 	k.policiesDisabledUntil = until
+	onDisable := k.onDisable
+	k.mu.Unlock()
 
 	k.logger.Warn("Policies temporarily disabled",
 		"duration", duration,
 		"until", until)
 
+	if onDisable != nil {
+		onDisable("policies", until)
+	}
 	return until
 }
 
+// PauseLoggingFor stops queries from being written to the query log for the
+// specified duration. Nothing about the pause is persisted, and unlike the
+// blocklist and policy switches it does not fire the OnDisable notification.
+func (k *KillSwitchManager) PauseLoggingFor(duration time.Duration) time.Time {
+	k.mu.Lock()
+	until := time.Now().Add(duration)
+	k.loggingPausedUntil = until
+	k.mu.Unlock()
+
+	k.logger.Info("Query logging paused",
+		"duration", duration,
+		"until", until)
+	return until
+}
+
+// ResumeLogging immediately resumes query logging (cancels a pause)
+func (k *KillSwitchManager) ResumeLogging() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	wasPaused := time.Now().Before(k.loggingPausedUntil)
+	k.loggingPausedUntil = time.Time{}
+
+	if wasPaused {
+		k.logger.Info("Query logging resumed (pause canceled)")
+	}
+}
+
 // EnableBlocklist immediately re-enables the blocklist (cancels temporary disable)
 func (k *KillSwitchManager) EnableBlocklist() {
 	k.mu.Lock()
@@ -205,6 +261,18 @@ func (k *KillSwitchManager) IsPoliciesDisabled() (disabled bool, until time.Time
 	return false, time.Time{}
 }
 
+// IsLoggingPaused returns whether query logging is currently paused
+// and the time when it will resume (if applicable)
+func (k *KillSwitchManager) IsLoggingPaused() (paused bool, until time.Time) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if time.Now().Before(k.loggingPausedUntil) {
+		return true, k.loggingPausedUntil
+	}
+	return false, time.Time{}
+}
+
 // GetStatus returns the current status of both kill-switches
 func (k *KillSwitchManager) GetStatus() (blocklistDisabled bool, blocklistUntil time.Time, policiesDisabled bool, policiesUntil time.Time) {
 	blocklistDisabled, blocklistUntil = k.IsBlocklistDisabled()
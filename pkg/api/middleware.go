@@ -11,7 +11,9 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 		origin := r.Header.Get("Origin")
 
 		// Check if origin is allowed
-		if origin != "" && s.isOriginAllowed(origin) {
+		if s.isDoHPath(r.URL.Path) {
+			s.setDoHCORSHeaders(w, origin)
+		} else if origin != "" && s.isOriginAllowed(origin) {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			// Only allow credentials for explicitly listed origins, not wildcard.
 			// Wildcard + credentials is a security misconfiguration.
@@ -33,6 +35,20 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// setDoHCORSHeaders adds CORS headers for the DoH endpoint. It accepts the
+// API's origins plus server.doh.cors_allowed_origins, and never allows
+// credentials: DoH needs no auth, so browser clients have nothing to send.
+func (s *Server) setDoHCORSHeaders(w http.ResponseWriter, origin string) {
+	if origin == "" || (!s.isOriginAllowed(origin) && !originAllowed(origin, s.dohOrigins)) {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+	w.Header().Add("Vary", "Origin")
+}
+
 // hasWildcardOrigin returns true if the allowed origins list contains "*"
 func (s *Server) hasWildcardOrigin() bool {
 	for _, allowed := range s.allowedOrigins {
@@ -45,17 +61,17 @@ func (s *Server) hasWildcardOrigin() bool {
 
 // isOriginAllowed checks if an origin is in the allowed list
 func (s *Server) isOriginAllowed(origin string) bool {
-	if len(s.allowedOrigins) == 0 {
-		// Secure default: no origins allowed
-		return false
-	}
+	return originAllowed(origin, s.allowedOrigins)
+}
 
-	for _, allowed := range s.allowedOrigins {
-		if allowed == "*" || origin == allowed {
+// originAllowed checks origin against an allowed list, where "*" matches any
+// origin. An empty list allows nothing.
+func originAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == "*" || origin == a {
 			return true
 		}
 	}
-
 	return false
 }
 
@@ -102,7 +118,7 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 
 		s.logger.Info("API request",
 			"method", r.Method,
-			"path", r.URL.Path,
+			"path", s.redactDoHPath(r.URL.Path),
 			"status", wrapper.statusCode,
 			"duration", duration,
 			"remote_addr", r.RemoteAddr,
@@ -9,13 +9,16 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// acmeChallengePrefix is where ACME HTTP-01 challenge tokens are fetched.
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
 var authBypassPaths = map[string]struct{}{
-	"/health":     {},
-	"/ready":      {},
-	"/api/health": {},
-	"/login":      {},
-	"/logout":     {},
-	"/dns-query":  {},
+	"/health":              {},
+	"/ready":               {},
+	"/api/health":          {},
+	"/api/health/detailed": {},
+	"/login":               {},
+	"/logout":              {},
 }
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
@@ -88,10 +91,14 @@ func (s *Server) isAuthRequired(r *http.Request) bool {
 		return false
 	}
 
-	if _, ok := authBypassPaths[r.URL.Path]; ok {
+	if _, ok := authBypassPaths[r.URL.Path]; ok || s.isDoHPath(r.URL.Path) {
 		return false
 	}
 
+	if s.acmeChallenge != nil && strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+		return false // the ACME CA can't authenticate
+	}
+
 	if strings.HasPrefix(r.URL.Path, "/static/") ||
 		strings.HasPrefix(r.URL.Path, "/_astro/") ||
 		r.URL.Path == "/favicon.svg" {
@@ -2,9 +2,12 @@ package api
 
 import (
 	"net/http"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"glory-hole/pkg/config"
 )
 
 // rateLimiter implements per-IP token bucket rate limiting.
@@ -87,6 +90,33 @@ func (rl *rateLimiter) cleanup(now time.Time) {
 	rl.lastClean.Store(now.Unix())
 }
 
+// rateLimitKey returns the bucket key for clientIP: its network prefix of
+// rate_limit.ipv4_prefix or ipv6_prefix bits (0 = default), so one client
+// can't dodge the limit by rotating addresses within its subnet.
+// IPv4-mapped IPv6 addresses count as IPv4. Unparsable input is its own key.
+func rateLimitKey(clientIP string, cfg config.RateLimitConfig) string {
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return clientIP
+	}
+	addr = addr.Unmap().WithZone("")
+	bits := cfg.IPv6Prefix
+	if bits == 0 {
+		bits = config.DefaultRateLimitIPv6Prefix
+	}
+	if addr.Is4() {
+		bits = cfg.IPv4Prefix
+		if bits == 0 {
+			bits = config.DefaultRateLimitIPv4Prefix
+		}
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
 // rateLimitMiddleware applies per-IP rate limiting to API requests.
 // Login attempts get a strict limit; other API calls get a moderate limit.
 func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
@@ -96,11 +126,15 @@ func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
 	apiLimiter := newRateLimiter(60, 120)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientIP := s.getClientIP(r)
+		var limits config.RateLimitConfig
+		if cfg := s.currentConfig(); cfg != nil {
+			limits = cfg.RateLimit
+		}
+		key := rateLimitKey(s.getClientIP(r), limits)
 
 		// Strict rate limit on login
 		if r.URL.Path == "/login" && r.Method == http.MethodPost {
-			if !loginLimiter.allow(clientIP) {
+			if !loginLimiter.allow(key) {
 				w.Header().Set("Retry-After", "60")
 				s.writeError(w, http.StatusTooManyRequests, "Too many login attempts")
 				return
@@ -109,7 +143,7 @@ func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
 
 		// General API rate limit
 		if len(r.URL.Path) >= 4 && r.URL.Path[:4] == "/api" {
-			if !apiLimiter.allow(clientIP) {
+			if !apiLimiter.allow(key) {
 				w.Header().Set("Retry-After", "1")
 				s.writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
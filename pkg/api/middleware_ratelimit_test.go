@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"glory-hole/pkg/config"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	defaults := config.RateLimitConfig{}
+	tests := []struct {
+		name string
+		ip   string
+		cfg  config.RateLimitConfig
+		want string
+	}{
+		{"ipv4 default", "192.168.1.20", defaults, "192.168.1.20/32"},
+		{"ipv4 prefix", "192.168.1.20", config.RateLimitConfig{IPv4Prefix: 24}, "192.168.1.0/24"},
+		{"ipv6 default", "2001:db8:1:2:aaaa::1", defaults, "2001:db8:1:2::/64"},
+		{"ipv6 same subnet", "2001:db8:1:2:ffff::9", defaults, "2001:db8:1:2::/64"},
+		{"ipv6 prefix", "2001:db8:1:2::1", config.RateLimitConfig{IPv6Prefix: 48}, "2001:db8:1::/48"},
+		{"ipv4-mapped", "::ffff:10.0.0.7", defaults, "10.0.0.7/32"},
+		{"zone dropped", "fe80::1%eth0", defaults, "fe80::/64"},
+		{"unparsable", "not-an-ip", defaults, "not-an-ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateLimitKey(tt.ip, tt.cfg); got != tt.want {
+				t.Errorf("rateLimitKey(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"time"
 
+	"glory-hole/pkg/blocklist"
 	"glory-hole/pkg/config"
 	"glory-hole/pkg/storage"
 )
@@ -14,6 +15,29 @@ type HealthResponse struct {
 	Version string `json:"version"`
 }
 
+// DetailedHealthResponse is returned by /api/health/detailed. Status is ok,
+// degraded (a non-critical component is failing) or down (a critical one is).
+type DetailedHealthResponse struct {
+	Components map[string]ComponentHealth `json:"components"`
+	Status     string                     `json:"status"`
+	Uptime     string                     `json:"uptime"`
+	Version    string                     `json:"version"`
+}
+
+// ComponentHealth describes one component in DetailedHealthResponse.
+type ComponentHealth struct {
+	Status      string `json:"status"` // ok, degraded, down, not_configured
+	Critical    bool   `json:"critical"`
+	Detail      string `json:"detail,omitempty"`
+	LastUpdated string `json:"last_updated,omitempty"` // blocklist only
+	AgeSeconds  int64  `json:"age_seconds,omitempty"`  // blocklist only
+
+	DatabaseBytes int64 `json:"database_bytes,omitempty"` // storage only
+	WALBytes      int64 `json:"wal_bytes,omitempty"`      // storage only
+
+	Buffer *storage.BufferStats `json:"buffer,omitempty"` // storage only: write buffer occupancy, peak and drops
+}
+
 // LivenessResponse represents the liveness probe response
 type LivenessResponse struct {
 	Status string `json:"status"` // "alive"
@@ -41,12 +65,17 @@ type StatsResponse struct {
 	MemoryUsagePercent   float64 `json:"memory_usage_percent,omitempty"`
 	TemperatureCelsius   float64 `json:"temperature_celsius,omitempty"`
 	TemperatureAvailable bool    `json:"temperature_available,omitempty"`
+	// SampleRate is set when database.sample_rate < 1: query counts then
+	// cover every blocked query but only this fraction of the rest.
+	SampleRate float64 `json:"sample_rate,omitempty"`
 }
 
 // TimeSeriesResponse represents time-series statistics data
 type TimeSeriesResponse struct {
 	Period string                    `json:"period"`
 	Points int                       `json:"points"`
+	Domain string                    `json:"domain,omitempty"` // set for per-domain series
+	Client string                    `json:"client,omitempty"` // set for per-client series
 	Data   []TimeSeriesPointResponse `json:"data"`
 }
 
@@ -67,6 +96,9 @@ type QueryResponse struct {
 	QueryType       string                    `json:"query_type"`
 	Upstream        string                    `json:"upstream,omitempty"`
 	UpstreamError   string                    `json:"upstream_error,omitempty"`
+	MatchedRule     string                    `json:"matched_rule,omitempty"`
+	MatchedSource   string                    `json:"matched_source,omitempty"`
+	MatchedURL      string                    `json:"matched_source_url,omitempty"` // list URL when matched_source shows its display name
 	ID              int64                     `json:"id"`
 	ResponseCode    int                       `json:"response_code"`
 	ResponseTimeMs  float64                   `json:"response_time_ms"`
@@ -77,12 +109,24 @@ type QueryResponse struct {
 	BlockTrace      []storage.BlockTraceEntry `json:"block_trace,omitempty"`
 }
 
+// Pagination places a page of a list endpoint within the full result set.
+type Pagination struct {
+	Total   int64 `json:"total"`
+	Limit   int   `json:"limit"`
+	Offset  int   `json:"offset"`
+	HasMore bool  `json:"has_more"`
+	// TotalExact is false when Total is only a lower bound: counting stopped
+	// at maxListCount, or the endpoint can't count its result set cheaply.
+	TotalExact bool `json:"total_exact"`
+}
+
 // QueriesResponse represents paginated query results
 type QueriesResponse struct {
 	Queries []QueryResponse `json:"queries"`
-	Total   int             `json:"total"`
-	Limit   int             `json:"limit"`
-	Offset  int             `json:"offset"`
+	Pagination
+	// NextCursor continues after the last query via ?cursor=; empty on the
+	// last page. Preferred over offset for deep pagination.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // DomainStatsResponse represents statistics for a single domain
@@ -95,7 +139,21 @@ type DomainStatsResponse struct {
 // TopDomainsResponse represents top queried domains
 type TopDomainsResponse struct {
 	Domains []DomainStatsResponse `json:"domains"`
-	Limit   int                   `json:"limit"`
+	Pagination
+}
+
+// ClientsResponse represents a page of client summaries.
+type ClientsResponse struct {
+	Clients []*storage.ClientSummary `json:"clients"`
+	Pagination
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// TopClientsResponse lists the busiest clients by query volume.
+type TopClientsResponse struct {
+	Clients []*storage.ClientSummary `json:"clients"`
+	Limit   int                      `json:"limit"`
+	Since   *time.Time               `json:"since,omitempty"`
 }
 
 // QueryTypeStatsResponse represents aggregated counts per record type.
@@ -118,6 +176,15 @@ type BlocklistReloadResponse struct {
 	Domains int    `json:"domains"`
 }
 
+// BlocklistsReloadResponse is the result of a synchronous blocklist reload.
+// Status is "ok" when every source downloaded and "partial" otherwise.
+type BlocklistsReloadResponse struct {
+	Status     string                   `json:"status"`
+	Domains    int                      `json:"domains"`
+	DurationMs int64                    `json:"duration_ms"`
+	Sources    []blocklist.SourceResult `json:"sources"`
+}
+
 // CachePurgeResponse represents cache purge result
 type CachePurgeResponse struct {
 	Status         string `json:"status"`
@@ -131,11 +198,25 @@ type StorageResetResponse struct {
 	Message string `json:"message"`
 }
 
-// ErrorResponse represents an API error
+// StorageRestoreResponse is returned once an uploaded backup has been staged.
+type StorageRestoreResponse struct {
+	Status          string `json:"status"`
+	Message         string `json:"message"`
+	RestartRequired bool   `json:"restart_required"`
+}
+
+// ErrorResponse is the envelope every JSON API error is returned in:
+// {"error": {"code": "not_found", "message": "..."}}.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
-	Code    int    `json:"code"`
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail carries a stable machine-readable code (snake_case, derived
+// from the HTTP status unless a handler sets a more specific one) and a
+// human-readable message.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 // ConfigUpdateResponse represents a successful configuration mutation response.
@@ -172,6 +253,8 @@ func convertQueryLog(q *storage.QueryLog) QueryResponse {
 		UpstreamTimeMs:  q.UpstreamTimeMs,
 		Upstream:        q.Upstream,
 		UpstreamError:   q.UpstreamError,
+		MatchedRule:     q.MatchedRule,
+		MatchedSource:   q.MatchedSource,
 		BlockTrace:      q.BlockTrace,
 	}
 }
@@ -251,6 +334,7 @@ type ConfigBlockPageResponse struct {
 
 type ConfigServerResponse struct {
 	ListenAddress      string            `json:"listen_address"`
+	ListenAddresses    []string          `json:"listen_addresses,omitempty"`
 	WebUIAddress       string            `json:"web_ui_address"`
 	TCPEnabled         bool              `json:"tcp_enabled"`
 	UDPEnabled         bool              `json:"udp_enabled"`
@@ -301,6 +385,7 @@ func convertConfigResponse(cfg *config.Config) ConfigResponse {
 	return ConfigResponse{
 		Server: ConfigServerResponse{
 			ListenAddress:      cfg.Server.ListenAddress,
+			ListenAddresses:    cfg.Server.ListenAddresses,
 			WebUIAddress:       cfg.Server.WebUIAddress,
 			TCPEnabled:         cfg.Server.TCPEnabled,
 			UDPEnabled:         cfg.Server.UDPEnabled,
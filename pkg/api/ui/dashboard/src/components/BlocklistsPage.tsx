@@ -25,7 +25,7 @@ import {
 import { cn } from "@/lib/utils";
 import { T } from "@/lib/typography";
 import { formatNumber } from "@/lib/format";
-import type { BlocklistInfo, FeatureState } from "@/lib/api";
+import type { BlocklistInfo, BlocklistLookup, FeatureState } from "@/lib/api";
 import {
   fetchBlocklists,
   reloadBlocklists,
@@ -45,7 +45,7 @@ export function BlocklistsPage() {
   const [reloading, setReloading] = useState(false);
   const [disableDuration, setDisableDuration] = useState("indefinite");
   const [checkQuery, setCheckQuery] = useState("");
-  const [checkResult, setCheckResult] = useState<{ blocked: boolean; source?: string } | null>(null);
+  const [checkResult, setCheckResult] = useState<BlocklistLookup | null>(null);
   const [checking, setChecking] = useState(false);
   const [newSource, setNewSource] = useState("");
   const [savingSources, setSavingSources] = useState(false);
@@ -286,7 +286,17 @@ export function BlocklistsPage() {
               {checkResult.blocked ? <ShieldBan className="h-4 w-4" /> : <ShieldCheck className="h-4 w-4" />}
               <span className="font-data">{checkQuery}</span>
               <span>is {checkResult.blocked ? "blocked" : "not blocked"}</span>
-              {checkResult.source && <span className="text-muted-foreground">({checkResult.source})</span>}
+              {checkResult.decision?.detail && (
+                <span className="text-muted-foreground">({checkResult.decision.detail})</span>
+              )}
+              {checkResult.listed && !checkResult.blocked && checkResult.decision?.rule && (
+                <span className="text-muted-foreground">— listed, but allowed by rule {checkResult.decision.rule}</span>
+              )}
+              {checkResult.sources && checkResult.sources.length > 0 && (
+                <span className="text-muted-foreground">
+                  lists: {(checkResult.source_names ?? checkResult.sources).join(", ")}
+                </span>
+              )}
             </div>
           )}
         </CardContent>
@@ -321,29 +331,40 @@ export function BlocklistsPage() {
             <Table>
               <TableHeader>
                 <TableRow>
-                  <TableHead>URL</TableHead>
+                  <TableHead>Source</TableHead>
+                  <TableHead>Category</TableHead>
                   <TableHead className="w-[50px]"></TableHead>
                 </TableRow>
               </TableHeader>
               <TableBody>
-                {info.sources.map((url, i) => (
-                  <TableRow key={i}>
-                    <TableCell className={cn(T.tableCellMono, "truncate max-w-[600px]")}>
-                      {url}
-                    </TableCell>
-                    <TableCell>
-                      <Button
-                        variant="ghost"
-                        size="icon-sm"
-                        onClick={() => handleRemoveSource(url)}
-                        disabled={savingSources}
-                        className="text-gh-red hover:text-gh-red"
-                      >
-                        <Trash2 className="h-3.5 w-3.5" />
-                      </Button>
-                    </TableCell>
-                  </TableRow>
-                ))}
+                {info.sources.map((url, i) => {
+                  const detail = info.source_details?.find((d) => d.url === url);
+                  return (
+                    <TableRow key={i}>
+                      <TableCell className="max-w-[600px]">
+                        {detail?.name && <div className="font-medium">{detail.name}</div>}
+                        <div className={cn(T.tableCellMono, "truncate")}>{url}</div>
+                        {detail?.description && <div className={T.mutedSm}>{detail.description}</div>}
+                      </TableCell>
+                      <TableCell>
+                        {detail?.category && (
+                          <Badge variant="outline" className="text-[10px]">{detail.category}</Badge>
+                        )}
+                      </TableCell>
+                      <TableCell>
+                        <Button
+                          variant="ghost"
+                          size="icon-sm"
+                          onClick={() => handleRemoveSource(url)}
+                          disabled={savingSources}
+                          className="text-gh-red hover:text-gh-red"
+                        >
+                          <Trash2 className="h-3.5 w-3.5" />
+                        </Button>
+                      </TableCell>
+                    </TableRow>
+                  );
+                })}
               </TableBody>
             </Table>
           ) : (
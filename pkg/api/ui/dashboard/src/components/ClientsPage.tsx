@@ -6,6 +6,13 @@ import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Button } from "@/components/ui/button";
 import { Skeleton } from "@/components/ui/skeleton";
+import {
+  Select,
+  SelectContent,
+  SelectItem,
+  SelectTrigger,
+  SelectValue,
+} from "@/components/ui/select";
 import {
   Dialog,
   DialogContent,
@@ -33,12 +40,20 @@ import {
   deleteClientGroup,
 } from "@/lib/api";
 
+const TIME_RANGES = [
+  { value: "1h", label: "Last 1h" },
+  { value: "24h", label: "Last 24h" },
+  { value: "168h", label: "Last 7d" },
+  { value: "all", label: "All time" },
+] as const;
+
 export function ClientsPage() {
   const [clients, setClients] = useState<ClientSummary[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const [searchInput, setSearchInput] = useState("");
   const [search, setSearch] = useState("");
+  const [range, setRange] = useState("24h");
   const searchTimer = useRef<ReturnType<typeof setTimeout>>();
   const [page, setPage] = useState(1);
   const [pageSize, setPageSize] = useState(50);
@@ -56,7 +71,7 @@ export function ClientsPage() {
   const loadData = useCallback(async () => {
     try {
       const [data, grps] = await Promise.all([
-        fetchClients(pageSize, (page - 1) * pageSize, search || undefined),
+        fetchClients(pageSize, (page - 1) * pageSize, search || undefined, range === "all" ? undefined : range),
         fetchClientGroups(),
       ]);
       setClients(data);
@@ -67,7 +82,7 @@ export function ClientsPage() {
     } finally {
       setLoading(false);
     }
-  }, [page, pageSize, search]);
+  }, [page, pageSize, search, range]);
 
   async function handleCreateGroup() {
     if (!newGroupName.trim()) return;
@@ -91,7 +106,7 @@ export function ClientsPage() {
   }
 
   useEffect(() => { loadData(); }, [loadData]);
-  useEffect(() => { setPage(1); }, [search]);
+  useEffect(() => { setPage(1); }, [search, range]);
 
   function handleSearchChange(value: string) {
     setSearchInput(value);
@@ -138,8 +153,8 @@ export function ClientsPage() {
       )}
 
       <Card>
-        <CardContent className="p-4">
-          <div className="relative">
+        <CardContent className="p-4 flex items-center gap-3">
+          <div className="relative flex-1">
             <Search className="absolute left-3 top-1/2 h-4 w-4 -translate-y-1/2 text-muted-foreground" />
             <Input
               placeholder="Search clients..."
@@ -153,6 +168,18 @@ export function ClientsPage() {
               </button>
             )}
           </div>
+          <Select value={range} onValueChange={setRange}>
+            <SelectTrigger className="w-[120px]">
+              <SelectValue />
+            </SelectTrigger>
+            <SelectContent>
+              {TIME_RANGES.map((r) => (
+                <SelectItem key={r.value} value={r.value}>
+                  {r.label}
+                </SelectItem>
+              ))}
+            </SelectContent>
+          </Select>
         </CardContent>
       </Card>
 
@@ -48,6 +48,7 @@ import type {
   TimeseriesBucket,
   QueryTypeCount,
   TopDomain,
+  ClientSummary,
   UnboundStatus,
   UnboundStats,
 } from "@/lib/api";
@@ -56,6 +57,7 @@ import {
   fetchTimeseries,
   fetchQueryTypes,
   fetchTopDomains,
+  fetchTopClients,
   fetchUnboundStatus,
   fetchUnboundStats,
 } from "@/lib/api";
@@ -78,6 +80,7 @@ export function DashboardOverview() {
   const [queryTypes, setQueryTypes] = useState<QueryTypeCount[]>([]);
   const [topAllowed, setTopAllowed] = useState<TopDomain[]>([]);
   const [topBlocked, setTopBlocked] = useState<TopDomain[]>([]);
+  const [topClients, setTopClients] = useState<ClientSummary[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
@@ -89,18 +92,20 @@ export function DashboardOverview() {
 
   const loadData = useCallback(async () => {
     try {
-      const [s, ts, qt, ta, tb] = await Promise.all([
+      const [s, ts, qt, ta, tb, tc] = await Promise.all([
         fetchStats(range),
         fetchTimeseries(range, buckets),
         fetchQueryTypes(range),
         fetchTopDomains(10, false, range),
         fetchTopDomains(10, true, range),
+        fetchTopClients(8, range),
       ]);
       setStats(s);
       setTimeseries(ts);
       setQueryTypes(qt);
       setTopAllowed(ta);
       setTopBlocked(tb);
+      setTopClients(tc);
 
       // Load resolver stats if enabled (non-blocking)
       try {
@@ -440,6 +445,51 @@ export function DashboardOverview() {
             </CardContent>
           </Card>
         )}
+
+        {/* Noisiest Clients */}
+        {topClients.length > 0 && (
+          <Card>
+            <CardHeader className="pb-2">
+              <CardTitle className={T.cardTitle}>Noisiest Clients</CardTitle>
+            </CardHeader>
+            <CardContent>
+              <div className="h-[200px]">
+                <ResponsiveContainer width="100%" height="100%">
+                  <BarChart
+                    data={topClients.map((c) => ({
+                      name: c.display_name || c.client_ip,
+                      allowed: c.total_queries - c.blocked_queries,
+                      blocked: c.blocked_queries,
+                    }))}
+                    layout="vertical"
+                    margin={{ left: 0, right: 16 }}
+                  >
+                    <CartesianGrid
+                      strokeDasharray="3 3"
+                      stroke="#414457"
+                      horizontal={false}
+                    />
+                    <XAxis
+                      type="number"
+                      tick={{ fontSize: T.chartAxisTick, fill: "#bdbdc1" }}
+                      stroke="#414457"
+                    />
+                    <YAxis
+                      type="category"
+                      dataKey="name"
+                      width={120}
+                      tick={{ fontSize: 9, fill: "#bdbdc1" }}
+                      stroke="#414457"
+                    />
+                    <Tooltip {...CHART_TOOLTIP_STYLE} />
+                    <Bar dataKey="allowed" stackId="client" fill={STATUS_COLORS.allowed} />
+                    <Bar dataKey="blocked" stackId="client" fill={STATUS_COLORS.blocked} radius={[0, 4, 4, 0]} />
+                  </BarChart>
+                </ResponsiveContainer>
+              </div>
+            </CardContent>
+          </Card>
+        )}
       </div>
     </div>
   );
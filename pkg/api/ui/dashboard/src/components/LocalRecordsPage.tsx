@@ -6,6 +6,7 @@ import { Badge } from "@/components/ui/badge";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
 import { Skeleton } from "@/components/ui/skeleton";
+import { Switch } from "@/components/ui/switch";
 import {
   Dialog,
   DialogContent,
@@ -32,7 +33,7 @@ import {
 import { cn } from "@/lib/utils";
 import { T } from "@/lib/typography";
 import type { LocalRecord } from "@/lib/api";
-import { fetchLocalRecords, createLocalRecord, deleteLocalRecord } from "@/lib/api";
+import { fetchLocalRecords, createLocalRecord, deleteLocalRecord, setLocalRecordEnabled } from "@/lib/api";
 
 const RECORD_TYPES = ["A", "AAAA", "CNAME", "MX", "TXT", "SRV", "PTR"];
 
@@ -97,6 +98,15 @@ export function LocalRecordsPage() {
     }
   }
 
+  async function handleToggle(record: LocalRecord) {
+    try {
+      await setLocalRecordEnabled(record.id, !record.enabled);
+      await loadData();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Failed to update record");
+    }
+  }
+
   async function handleDelete(id: string) {
     if (!confirm("Delete this record?")) return;
     try {
@@ -143,6 +153,7 @@ export function LocalRecordsPage() {
                 <TableHead className="w-[80px]">Type</TableHead>
                 <TableHead>Value</TableHead>
                 <TableHead className="w-[80px] text-right">TTL</TableHead>
+                <TableHead className="w-[80px]">Enabled</TableHead>
                 <TableHead className="w-[50px]"></TableHead>
               </TableRow>
             </TableHeader>
@@ -155,6 +166,13 @@ export function LocalRecordsPage() {
                   </TableCell>
                   <TableCell className={T.tableCellMono}>{r.value}</TableCell>
                   <TableCell className={T.tableCellNumeric}>{r.ttl}s</TableCell>
+                  <TableCell>
+                    <Switch
+                      checked={r.enabled}
+                      onCheckedChange={() => handleToggle(r)}
+                      aria-label={`${r.enabled ? "Disable" : "Enable"} record ${r.domain}`}
+                    />
+                  </TableCell>
                   <TableCell>
                     <Button variant="ghost" size="icon-sm" onClick={() => handleDelete(r.id)} className="text-gh-red hover:text-gh-red" aria-label={`Delete record ${r.domain}`}>
                       <Trash2 className="h-3.5 w-3.5" />
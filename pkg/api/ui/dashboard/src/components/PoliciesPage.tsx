@@ -53,7 +53,7 @@ import {
   createPolicy,
   updatePolicy,
   deletePolicy,
-  testPolicy,
+  validatePolicy,
   exportPolicies,
   fetchFeatures,
   disablePolicies,
@@ -85,8 +85,9 @@ export function PoliciesPage() {
   const [dialogOpen, setDialogOpen] = useState(false);
   const [editingPolicy, setEditingPolicy] = useState<Policy | null>(null);
   const [testResult, setTestResult] = useState<{
-    valid: boolean;
-    error?: string;
+    ok: boolean;
+    message: string;
+    snippet?: string;
   } | null>(null);
 
   // Form state
@@ -94,6 +95,8 @@ export function PoliciesPage() {
   const [formLogic, setFormLogic] = useState("");
   const [formAction, setFormAction] = useState("BLOCK");
   const [formActionData, setFormActionData] = useState("");
+  const [formCategory, setFormCategory] = useState("");
+  const [formPriority, setFormPriority] = useState(0);
   const [formEnabled, setFormEnabled] = useState(true);
   const [saving, setSaving] = useState(false);
   const [testDomain, setTestDomain] = useState("");
@@ -164,6 +167,8 @@ export function PoliciesPage() {
     setFormLogic("");
     setFormAction("BLOCK");
     setFormActionData("");
+    setFormCategory("");
+    setFormPriority(0);
     setFormEnabled(true);
     setTestResult(null);
     setTestDomain("");
@@ -178,6 +183,8 @@ export function PoliciesPage() {
     setFormLogic(policy.logic);
     setFormAction(policy.action);
     setFormActionData(policy.action_data || "");
+    setFormCategory(policy.category || "");
+    setFormPriority(policy.priority ?? 0);
     setFormEnabled(policy.enabled);
     setTestResult(null);
     setTestDomain("");
@@ -204,6 +211,8 @@ export function PoliciesPage() {
         logic: formLogic,
         action: formAction,
         action_data: formActionData || undefined,
+        category: formCategory || undefined,
+        priority: formPriority,
         enabled: formEnabled,
       };
 
@@ -242,6 +251,8 @@ export function PoliciesPage() {
         logic: policy.logic,
         action: policy.action,
         action_data: policy.action_data,
+        category: policy.category,
+        priority: policy.priority,
         enabled: !policy.enabled,
       });
       await loadData();
@@ -253,14 +264,39 @@ export function PoliciesPage() {
   }
 
   async function handleTest() {
-    if (!formLogic.trim() || !testDomain.trim()) return;
+    if (!formLogic.trim()) return;
     try {
-      const result = await testPolicy(formLogic, testDomain);
-      setTestResult({ valid: result.matched ?? false });
+      const result = await validatePolicy({
+        logic: formLogic,
+        action: formAction,
+        action_data: formActionData || undefined,
+        category: formCategory || undefined,
+        domain: testDomain.trim() || undefined,
+      });
+      if (!result.valid) {
+        const first = result.errors[0];
+        const where = first?.line
+          ? ` (line ${first.line}, column ${first.column})`
+          : "";
+        setTestResult({
+          ok: false,
+          message: first ? `${first.message}${where}` : "Invalid rule",
+          snippet: first?.snippet,
+        });
+      } else if (result.matched === undefined) {
+        setTestResult({ ok: true, message: "Expression is valid" });
+      } else {
+        setTestResult({
+          ok: result.matched,
+          message: result.matched
+            ? "Expression matched"
+            : "Expression did not match",
+        });
+      }
     } catch (err) {
       setTestResult({
-        valid: false,
-        error: err instanceof Error ? err.message : "Test failed",
+        ok: false,
+        message: err instanceof Error ? err.message : "Test failed",
       });
     }
   }
@@ -279,6 +315,8 @@ export function PoliciesPage() {
         logic: string;
         action: string;
         action_data?: string;
+        category?: string;
+        priority?: number;
         enabled?: boolean;
       }> = Array.isArray(data) ? data : data.policies ?? [];
 
@@ -295,6 +333,8 @@ export function PoliciesPage() {
           logic: p.logic,
           action: p.action.toUpperCase(),
           action_data: p.action_data ?? "",
+          category: p.category ?? "",
+          priority: p.priority ?? 0,
           enabled: p.enabled ?? true,
         });
         count++;
@@ -447,6 +487,11 @@ export function PoliciesPage() {
                         <div className={T.tableRowName}>
                           {policy.name}
                         </div>
+                        {!!policy.priority && (
+                          <div className="text-xs text-muted-foreground">
+                            priority {policy.priority}
+                          </div>
+                        )}
                       </TableCell>
                       <TableCell className="max-w-[350px]">
                         <Tooltip>
@@ -546,6 +591,7 @@ export function PoliciesPage() {
                 <Select value={formAction} onValueChange={(v) => {
                   setFormAction(v);
                   if (v !== "REDIRECT" && v !== "FORWARD") setFormActionData("");
+                  if (v !== "BLOCK") setFormCategory("");
                 }}>
                   <SelectTrigger data-testid="policy-action">
                     <SelectValue />
@@ -656,6 +702,32 @@ export function PoliciesPage() {
               </div>
             )}
 
+            {formAction === "BLOCK" && (
+              <div className="space-y-2">
+                <Label className={T.formLabel}>Category (optional)</Label>
+                <Input
+                  value={formCategory}
+                  onChange={(e) => setFormCategory(e.target.value)}
+                  placeholder="parental"
+                  data-testid="policy-category"
+                />
+              </div>
+            )}
+
+            <div className="space-y-2">
+              <Label className={T.formLabel}>Priority</Label>
+              <Input
+                type="number"
+                value={formPriority}
+                onChange={(e) => setFormPriority(Number(e.target.value) || 0)}
+                className="font-data w-32"
+              />
+              <p className="text-xs text-muted-foreground">
+                Higher priority rules are evaluated first; rules with equal
+                priority run in creation order.
+              </p>
+            </div>
+
             {/* Test expression */}
             <div className="space-y-2">
               <Label className={T.formLabel}>
@@ -676,7 +748,7 @@ export function PoliciesPage() {
                   variant="outline"
                   size="sm"
                   onClick={handleTest}
-                  disabled={!formLogic.trim() || !testDomain.trim()}
+                  disabled={!formLogic.trim()}
                   data-testid="test-button"
                 >
                   <Play className="h-3 w-3 mr-1" />
@@ -687,15 +759,18 @@ export function PoliciesPage() {
                 <div
                   className={cn(
                     "rounded-md px-3 py-2 text-xs",
-                    testResult.valid
+                    testResult.ok
                       ? "border border-gh-green/30 bg-gh-green/10 text-gh-green"
                       : "border border-gh-red/30 bg-gh-red/10 text-gh-red",
                   )}
                   data-testid="test-result"
                 >
-                  {testResult.valid
-                    ? "Expression matched"
-                    : testResult.error || "Expression did not match"}
+                  {testResult.message}
+                  {testResult.snippet && (
+                    <pre className="mt-1 font-data whitespace-pre">
+                      {testResult.snippet}
+                    </pre>
+                  )}
                 </div>
               )}
             </div>
@@ -5,6 +5,8 @@ import { Input } from "@/components/ui/input";
 import { Badge } from "@/components/ui/badge";
 import { Button } from "@/components/ui/button";
 import { Skeleton } from "@/components/ui/skeleton";
+import { Switch } from "@/components/ui/switch";
+import { Label } from "@/components/ui/label";
 import {
   Select,
   SelectContent,
@@ -23,8 +25,8 @@ import {
 import { cn } from "@/lib/utils";
 import { T } from "@/lib/typography";
 import { TablePagination } from "./TablePagination";
-import type { QueryLog, QueryFilter } from "@/lib/api";
-import { fetchQueries } from "@/lib/api";
+import type { QueryLog, QueryFilter, FeatureState } from "@/lib/api";
+import { fetchQueries, fetchFeatures, pauseLogging, resumeLogging } from "@/lib/api";
 
 // ─── Helpers ────────────────────────────────────────────────────────
 
@@ -106,6 +108,8 @@ export function QueryLogPage() {
   const [queries, setQueries] = useState<QueryLog[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
+  const [features, setFeatures] = useState<FeatureState | null>(null);
+  const [pauseDuration, setPauseDuration] = useState("5m");
 
   // Filters
   const [searchInput, setSearchInput] = useState("");
@@ -141,8 +145,9 @@ export function QueryLogPage() {
       if (statusFilter !== "all") filter.status = statusFilter;
       if (search.trim()) filter.domain = search.trim();
 
-      const data = await fetchQueries(filter);
+      const [data, ft] = await Promise.all([fetchQueries(filter), fetchFeatures()]);
       setQueries(data);
+      setFeatures(ft);
       setError(null);
     } catch (err) {
       setError(err instanceof Error ? err.message : "Failed to load queries");
@@ -166,6 +171,21 @@ export function QueryLogPage() {
     };
   }, [loadData, refreshInterval]);
 
+  const loggingPaused = features?.logging_paused ?? false;
+
+  async function handleToggleLogging() {
+    try {
+      if (loggingPaused) {
+        await resumeLogging();
+      } else {
+        await pauseLogging(pauseDuration === "indefinite" ? undefined : pauseDuration);
+      }
+      await loadData();
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Toggle failed");
+    }
+  }
+
   // Debounce search input
   useEffect(() => {
     const timer = setTimeout(() => setSearch(searchInput), 300);
@@ -181,9 +201,34 @@ export function QueryLogPage() {
   return (
     <div className="space-y-6">
       {/* Header */}
-      <div>
-        <h2 className={T.pageTitle}>Query Log</h2>
-        <p className={T.pageDescription}>DNS query history with filtering and search</p>
+      <div className="flex items-center justify-between">
+        <div>
+          <h2 className={T.pageTitle}>Query Log</h2>
+          <p className={T.pageDescription}>DNS query history with filtering and search</p>
+        </div>
+        <div className="flex items-center gap-2">
+          <Switch
+            checked={!loggingPaused}
+            onCheckedChange={handleToggleLogging}
+            aria-label="Toggle query logging"
+          />
+          <Label className="text-xs">
+            {loggingPaused ? "Logging paused" : "Logging"}
+          </Label>
+          {!loggingPaused && (
+            <Select value={pauseDuration} onValueChange={setPauseDuration}>
+              <SelectTrigger className="h-7 w-[130px] text-xs">
+                <SelectValue placeholder="Pause for" />
+              </SelectTrigger>
+              <SelectContent>
+                <SelectItem value="5m">5 minutes</SelectItem>
+                <SelectItem value="15m">15 minutes</SelectItem>
+                <SelectItem value="1h">1 hour</SelectItem>
+                <SelectItem value="indefinite">Until resumed</SelectItem>
+              </SelectContent>
+            </Select>
+          )}
+        </div>
       </div>
 
       {error && (
@@ -483,6 +528,11 @@ function QueryDetail({ query }: { query: QueryLog }) {
                 </Badge>
                 {entry.rule && <span className="text-foreground font-medium shrink-0">{entry.rule}</span>}
                 {entry.source && <span className="text-gh-peach shrink-0">[{entry.source}]</span>}
+                {entry.category && (
+                  <Badge variant="outline" className="text-[10px] shrink-0">
+                    {entry.category}
+                  </Badge>
+                )}
                 {entry.detail && <span className="text-muted-foreground truncate">{entry.detail}</span>}
               </div>
             ))}
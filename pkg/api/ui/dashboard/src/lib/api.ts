@@ -42,6 +42,17 @@ export function clearCSRFToken(): void {
   csrfTokenPromise = null;
 }
 
+/** Pull the message out of an API error envelope ({"error": {"code", "message"}}), falling back to the raw body. */
+function errorMessage(body: string): string {
+  try {
+    const parsed = JSON.parse(body) as { error?: { message?: string } };
+    if (parsed.error?.message) return parsed.error.message;
+  } catch {
+    // not JSON
+  }
+  return body;
+}
+
 async function apiFetch<T>(
   path: string,
   init?: RequestInit
@@ -86,7 +97,7 @@ async function apiFetch<T>(
 
   if (!res.ok) {
     const text = await res.text().catch(() => "");
-    throw new Error(`API ${res.status}: ${text || res.statusText}`);
+    throw new Error(`API ${res.status}: ${errorMessage(text) || res.statusText}`);
   }
   // Some endpoints return 204 No Content
   if (res.status === 204) return undefined as T;
@@ -182,6 +193,7 @@ export interface BlockTraceEntry {
   rule?: string;
   source?: string;
   detail?: string;
+  category?: string;
   metadata?: Record<string, string>;
 }
 
@@ -191,6 +203,10 @@ export interface Policy {
   logic: string;
   action: string;
   action_data?: string;
+  /** Block category of a BLOCK rule, e.g. "malware". */
+  category?: string;
+  /** Higher priority rules are evaluated first; ties keep creation order. */
+  priority?: number;
   enabled: boolean;
 }
 
@@ -200,6 +216,7 @@ export interface LocalRecord {
   type: string;
   value: string;   // UI display value (IP, target, or text)
   ttl: number;
+  enabled: boolean;
 }
 
 export interface LocalRecordCreateRequest {
@@ -218,6 +235,7 @@ export interface LocalRecordCreateRequest {
 export interface ClientSummary {
   client_ip: string;
   display_name: string;
+  hostname?: string;
   group_name?: string;
   group_color?: string;
   notes?: string;
@@ -243,6 +261,16 @@ export interface BlocklistInfo {
   pattern_stats: Record<string, number>;
   last_updated?: string;
   sources: string[];
+  source_details?: BlocklistSourceDetail[];
+  load_duration?: string;
+  load_peak_heap_bytes?: number;
+}
+
+export interface BlocklistSourceDetail {
+  url: string;
+  name?: string;
+  description?: string;
+  category?: string;
 }
 
 // Alias for UI convenience
@@ -262,6 +290,8 @@ export interface FeatureState {
   policies_enabled: boolean;
   policies_temp_disabled: boolean;
   policies_disabled_until?: string;
+  logging_paused: boolean;
+  logging_paused_until?: string;
 }
 
 /** Effective state: enabled in config AND not temporarily disabled. */
@@ -359,6 +389,13 @@ export async function fetchTopDomains(
   return (res.domains ?? []).map((d) => ({ domain: d.domain, query_count: d.queries }));
 }
 
+export async function fetchTopClients(limit = 10, since?: string): Promise<ClientSummary[]> {
+  let url = `/api/top-clients?limit=${limit}`;
+  if (since) url += `&since=${since}`;
+  const res = await apiFetch<{ clients: ClientSummary[] }>(url);
+  return res.clients ?? [];
+}
+
 // ─── Queries ─────────────────────────────────────────────────────────
 
 export interface QueryFilter {
@@ -434,6 +471,37 @@ export function testPolicy(
   });
 }
 
+export interface PolicyValidationError {
+  field: "logic" | "action";
+  message: string;
+  snippet?: string;
+  line?: number;
+  column?: number;
+}
+
+export interface PolicyValidateResult {
+  valid: boolean;
+  errors: PolicyValidationError[];
+  /** Present when a sample domain was given and the rule compiled. */
+  matched?: boolean;
+}
+
+/** Dry-run a rule: compile it, report errors with position, and optionally evaluate it against a sample query. */
+export function validatePolicy(req: {
+  logic: string;
+  action?: string;
+  action_data?: string;
+  category?: string;
+  domain?: string;
+  client_ip?: string;
+  query_type?: string;
+}): Promise<PolicyValidateResult> {
+  return apiFetch(`/api/policies/validate`, {
+    method: "POST",
+    body: JSON.stringify(req),
+  });
+}
+
 export async function exportPolicies(): Promise<Policy[]> {
   const res = await apiFetch<{ policies: Policy[]; total: number }>("/api/policies/export");
   return res.policies ?? [];
@@ -449,6 +517,7 @@ interface LocalRecordRaw {
   target?: string;
   txt_records?: string[];
   ttl: number;
+  enabled?: boolean;
 }
 
 export async function fetchLocalRecords(): Promise<LocalRecord[]> {
@@ -458,6 +527,7 @@ export async function fetchLocalRecords(): Promise<LocalRecord[]> {
     domain: r.domain,
     type: r.type,
     ttl: r.ttl,
+    enabled: r.enabled ?? true,
     value: r.ips?.join(", ") ?? r.target ?? r.txt_records?.join("; ") ?? "",
   }));
 }
@@ -475,18 +545,25 @@ export function deleteLocalRecord(id: string): Promise<void> {
   return apiFetch<void>(`/api/localrecords/${id}`, { method: "DELETE" });
 }
 
+export function setLocalRecordEnabled(id: string, enabled: boolean): Promise<void> {
+  const action = enabled ? "enable" : "disable";
+  return apiFetch<void>(`/api/localrecords/${id}/${action}`, { method: "POST" });
+}
+
 // ─── Clients ─────────────────────────────────────────────────────────
 
 export async function fetchClients(
   limit = 50,
   offset = 0,
-  search?: string
+  search?: string,
+  since?: string
 ): Promise<ClientSummary[]> {
   const params = new URLSearchParams({
     limit: String(limit),
     offset: String(offset),
   });
   if (search) params.set("search", search);
+  if (since) params.set("since", since);
   const res = await apiFetch<{ clients: ClientSummary[] }>(`/api/clients?${params}`);
   return res.clients ?? [];
 }
@@ -539,10 +616,32 @@ export function reloadBlocklists(): Promise<void> {
   return apiFetch<void>("/api/blocklist/reload", { method: "POST" });
 }
 
-export function checkDomain(
-  domain: string
-): Promise<{ blocked: boolean; source?: string }> {
-  return apiFetch(`/api/blocklists/check?domain=${encodeURIComponent(domain)}`);
+export interface BlocklistDecision {
+  action: "answer" | "block" | "allow" | "redirect" | "forward";
+  stage: string;
+  rule?: string;
+  detail?: string;
+  allow_overridden?: string;
+  policies_enabled: boolean;
+  blocklist_enabled: boolean;
+}
+
+export interface BlocklistLookup {
+  domain: string;
+  client?: string;
+  query_type: string;
+  listed: boolean;
+  match_kind?: string;
+  matched_entry?: string;
+  pattern?: string;
+  sources?: string[];
+  source_names?: string[];
+  blocked: boolean;
+  decision?: BlocklistDecision;
+}
+
+export function checkDomain(domain: string): Promise<BlocklistLookup> {
+  return apiFetch<BlocklistLookup>(`/api/blocklist/lookup?domain=${encodeURIComponent(domain)}`);
 }
 
 export function updateBlocklistSources(
@@ -598,6 +697,17 @@ export function enablePolicies(): Promise<void> {
   return apiFetch<void>("/api/features/policies/enable", { method: "POST" });
 }
 
+export function pauseLogging(duration?: string): Promise<void> {
+  return apiFetch<void>("/api/features/logging/pause", {
+    method: "POST",
+    body: JSON.stringify({ duration: durationToSeconds(duration) }),
+  });
+}
+
+export function resumeLogging(): Promise<void> {
+  return apiFetch<void>("/api/features/logging/resume", { method: "POST" });
+}
+
 // ─── Config ──────────────────────────────────────────────────────────
 
 export function fetchConfig(): Promise<ConfigResponse> {
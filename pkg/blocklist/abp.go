@@ -0,0 +1,117 @@
+package blocklist
+
+import (
+	"strings"
+
+	"glory-hole/pkg/pattern"
+)
+
+// lineKind classifies a single blocklist line.
+type lineKind int
+
+const (
+	lineIgnored     lineKind = iota // blank, comment, header or localhost entry
+	lineBlock                       // hosts, plain domain or ||domain^ rule
+	lineException                   // @@||domain^ rule
+	lineCosmetic                    // ABP element-hiding rule (##, #@#, #?#, ...)
+	lineUnsupported                 // ABP network rule DNS can't express (paths, regexes, modifiers)
+	lineMalformed                   // not a recognizable entry, or contains an invalid hostname
+)
+
+// abpOptions are the rule modifiers that don't narrow a domain-anchor rule
+// below "block the whole host", so the rule still maps to a DNS block.
+var abpOptions = map[string]bool{
+	"important": true,
+	"all":       true,
+	"document":  true,
+	"doc":       true,
+}
+
+// cosmeticSeparators mark ABP/uBO element-hiding and scriptlet rules.
+var cosmeticSeparators = []string{"##", "#@#", "#?#", "#@?#", "#$#", "#@$#", "#%#"}
+
+// classifyLine parses one blocklist line in hosts, plain-domain or Adblock Plus
+// syntax and returns its domains as canonical FQDNs. A lineMalformed result
+// may still carry the valid domains of a partly broken hosts entry.
+func (d *Downloader) classifyLine(line string) ([]string, lineKind) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' || line[0] == '!' || line[0] == '[' {
+		return nil, lineIgnored
+	}
+	if isCosmeticRule(line) {
+		return nil, lineCosmetic
+	}
+	// With cosmetic rules excluded, any remaining "#" starts a trailing comment.
+	if idx := strings.Index(line, "#"); idx > 0 {
+		line = strings.TrimSpace(line[:idx])
+	}
+
+	kind := lineBlock
+	rule := line
+	if rest, ok := strings.CutPrefix(line, "@@"); ok {
+		kind, rule = lineException, rest
+	}
+	if strings.HasPrefix(rule, "||") {
+		domain, ok := abpDomain(rule)
+		if !ok {
+			return nil, lineUnsupported
+		}
+		if fqdn := pattern.NormalizeFQDN(domain); validHostname(fqdn) {
+			return []string{fqdn}, kind
+		}
+		return nil, lineMalformed
+	}
+	if kind == lineException || line[0] == '|' || line[0] == '/' || strings.ContainsAny(line, "$^") {
+		return nil, lineUnsupported
+	}
+
+	domains, ok := d.extractDomains(line)
+	switch {
+	case !ok:
+		return domains, lineMalformed
+	case len(domains) == 0:
+		return nil, lineIgnored
+	}
+	return domains, lineBlock
+}
+
+// isCosmeticRule reports whether line is an element-hiding rule such as
+// "example.com##.banner". A "##" preceded by whitespace is a hosts-file
+// trailing comment, not a selector.
+func isCosmeticRule(line string) bool {
+	for _, sep := range cosmeticSeparators {
+		if idx := strings.Index(line, sep); idx > 0 && line[idx-1] != ' ' && line[idx-1] != '\t' {
+			return true
+		}
+	}
+	return false
+}
+
+// abpDomain extracts the host from a domain-anchor rule ("||example.com^",
+// optionally with "$important"-style modifiers). Rules that match URL paths
+// or carry modifiers restricting them to some requests are rejected: DNS can
+// only block or allow a whole name.
+func abpDomain(rule string) (string, bool) {
+	rest, ok := strings.CutPrefix(rule, "||")
+	if !ok {
+		return "", false
+	}
+	if body, opts, hasOpts := strings.Cut(rest, "$"); hasOpts {
+		for _, opt := range strings.Split(opts, ",") {
+			if !abpOptions[strings.ToLower(strings.TrimSpace(opt))] {
+				return "", false
+			}
+		}
+		rest = body
+	}
+
+	host, tail, found := strings.Cut(rest, "^")
+	if !found || (tail != "" && tail != "|") {
+		return "", false
+	}
+	host = strings.TrimSpace(host)
+	if host == "" || strings.ContainsAny(host, "/*|:#? \t") {
+		return "", false
+	}
+	return host, true
+}
@@ -3,16 +3,18 @@ package blocklist
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"sort"
 	"strings"
 	"time"
 
+	"glory-hole/pkg/config"
 	"glory-hole/pkg/logging"
-
-	"github.com/miekg/dns"
+	"glory-hole/pkg/pattern"
 )
 
 // Downloader downloads and parses blocklists
@@ -65,10 +67,11 @@ func (d *Downloader) Download(ctx context.Context, url string) (map[string]struc
 	const maxBlocklistSize int64 = 100 * 1024 * 1024 // 100MB
 	lr := &io.LimitedReader{R: resp.Body, N: maxBlocklistSize}
 
-	domains, err := d.parseHostsFile(lr)
+	domains, stats, err := d.parseHostsFile(lr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse blocklist: %w", err)
 	}
+	d.logMalformed(url, stats)
 
 	if lr.N <= 0 {
 		d.logger.Warn("Blocklist truncated at size limit — list may be incomplete",
@@ -86,10 +89,78 @@ func (d *Downloader) Download(ctx context.Context, url string) (map[string]struc
 	return domains, nil
 }
 
+// ParsedList is a downloaded blocklist split into blocked domains and
+// Adblock Plus exception ("@@") domains, both as sorted, deduplicated FQDNs.
+type ParsedList struct {
+	Domains    []string
+	Exceptions []string
+
+	// Cosmetic and Unsupported count ABP rules that were skipped because DNS
+	// filtering can't apply them: element hiding, URL paths, request modifiers.
+	Cosmetic    int
+	Unsupported int
+
+	// Malformed counts lines that aren't a recognizable entry or carry an
+	// invalid hostname; the rest of the list is still imported.
+	Malformed       int
+	malformedSample string
+
+	// Bytes is the size of the downloaded body.
+	Bytes int64
+}
+
+// maxMalformedSample bounds the example line logged for malformed entries.
+const maxMalformedSample = 120
+
+// noteMalformed counts a malformed line, keeping the first one as a sample.
+func (l *ParsedList) noteMalformed(line string) {
+	l.Malformed++
+	if l.malformedSample == "" {
+		line = strings.TrimSpace(line)
+		if len(line) > maxMalformedSample {
+			line = line[:maxMalformedSample]
+		}
+		l.malformedSample = line
+	}
+}
+
+// logMalformed reports a list's malformed lines, if any.
+func (d *Downloader) logMalformed(url string, l *ParsedList) {
+	if l.Malformed > 0 {
+		d.logger.Warn("Skipped malformed blocklist lines",
+			"url", url,
+			"count", l.Malformed,
+			"example", l.malformedSample)
+	}
+}
+
 // DownloadSorted downloads a blocklist and returns a deduplicated, sorted
 // slice of FQDN strings. This avoids the map[string]struct{} overhead
 // (~60MB per 500K domains) by using a slice + sort.Strings for dedup.
 func (d *Downloader) DownloadSorted(ctx context.Context, url string) ([]string, error) {
+	list, err := d.DownloadList(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return list.Domains, nil
+}
+
+// DownloadList downloads a blocklist like DownloadSorted, additionally
+// keeping the list's "@@" exception rules and skipped-rule counts.
+func (d *Downloader) DownloadList(ctx context.Context, url string) (*ParsedList, error) {
+	return d.downloadList(ctx, url, 0, nil)
+}
+
+// DownloadListAuth is DownloadList for a private source, sending its
+// blocklist_auth credentials (nil sends none).
+func (d *Downloader) DownloadListAuth(ctx context.Context, url string, auth *config.BlocklistAuthConfig) (*ParsedList, error) {
+	return d.downloadList(ctx, url, 0, auth)
+}
+
+// downloadList is DownloadList with a guess at the list's domain count
+// (typically its size on the last load), used to pre-size the parse buffer
+// instead of growing it by repeated doubling.
+func (d *Downloader) downloadList(ctx context.Context, url string, sizeHint int, auth *config.BlocklistAuthConfig) (*ParsedList, error) {
 	d.logger.Info("Downloading blocklist", "url", url)
 	startTime := time.Now()
 
@@ -97,13 +168,20 @@ func (d *Downloader) DownloadSorted(ctx context.Context, url string) ([]string,
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	setAuth(req, auth)
 
-	resp, err := d.client.Do(req)
+	resp, err := d.clientFor(auth).Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download blocklist: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		if auth == nil {
+			return nil, fmt.Errorf("unexpected status code: %d (no blocklist_auth configured)", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("unexpected status code: %d (blocklist_auth credentials rejected)", resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -111,22 +189,91 @@ func (d *Downloader) DownloadSorted(ctx context.Context, url string) ([]string,
 	const maxBlocklistSize int64 = 100 * 1024 * 1024 // 100MB
 	lr := &io.LimitedReader{R: resp.Body, N: maxBlocklistSize}
 
-	domains, err := d.parseToSlice(lr)
+	list, err := d.parseToSlice(lr, sizeHint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse blocklist: %w", err)
 	}
+	list.Bytes = maxBlocklistSize - lr.N
 
 	if lr.N <= 0 {
 		d.logger.Warn("Blocklist truncated at size limit — list may be incomplete",
 			"url", url,
 			"limit_mb", maxBlocklistSize/(1024*1024),
-			"domains_parsed", len(domains))
+			"domains_parsed", len(list.Domains))
 	}
 
-	// Sort for merge and binary search
-	sort.Strings(domains)
+	// Sort for merge and binary search, deduplicating in-place
+	// (hosts files often have duplicates)
+	list.Domains = sortDedup(list.Domains)
+	list.Exceptions = sortDedup(list.Exceptions)
+
+	if list.Cosmetic > 0 || list.Unsupported > 0 {
+		d.logger.Info("Skipped Adblock rules DNS filtering can't apply",
+			"url", url,
+			"cosmetic", list.Cosmetic,
+			"unsupported", list.Unsupported)
+	}
+	d.logMalformed(url, list)
+
+	elapsed := time.Since(startTime)
+	d.logger.Info("Blocklist downloaded",
+		"url", url,
+		"unique_domains", len(list.Domains),
+		"exceptions", len(list.Exceptions),
+		"bytes", list.Bytes,
+		"duration", elapsed)
+
+	return list, nil
+}
+
+// setAuth adds a source's blocklist_auth credentials to its request.
+func setAuth(req *http.Request, auth *config.BlocklistAuthConfig) {
+	if auth == nil {
+		return
+	}
+	for name, value := range auth.Headers {
+		req.Header.Set(name, value)
+	}
+	switch {
+	case auth.Username != "":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case auth.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+auth.BearerToken)
+	}
+}
+
+// clientFor returns the client to download a source with. Go forwards custom
+// headers on every redirect, so for a source with blocklist_auth it returns a
+// copy that drops the credentials once a redirect leaves the original host or
+// downgrades an https source to plain http.
+func (d *Downloader) clientFor(auth *config.BlocklistAuthConfig) *http.Client {
+	if auth == nil {
+		return d.client
+	}
+	client := *d.client
+	next := d.client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		downgraded := via[0].URL.Scheme == "https" && req.URL.Scheme != "https"
+		if req.URL.Host != via[0].URL.Host || downgraded {
+			req.Header.Del("Authorization")
+			for name := range auth.Headers {
+				req.Header.Del(name)
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &client
+}
 
-	// Deduplicate in-place (hosts files often have duplicates)
+// sortDedup sorts domains and removes duplicates in place.
+func sortDedup(domains []string) []string {
+	sort.Strings(domains)
 	if len(domains) > 1 {
 		w := 1
 		for r := 1; r < len(domains); r++ {
@@ -137,80 +284,78 @@ func (d *Downloader) DownloadSorted(ctx context.Context, url string) ([]string,
 		}
 		domains = domains[:w]
 	}
-
-	elapsed := time.Since(startTime)
-	d.logger.Info("Blocklist downloaded",
-		"url", url,
-		"unique_domains", len(domains),
-		"duration", elapsed)
-
-	return domains, nil
+	return domains
 }
 
-// parseToSlice parses a blocklist into a []string slice (no map overhead).
-// The slice may contain duplicates — caller is responsible for dedup.
-func (d *Downloader) parseToSlice(r io.Reader) ([]string, error) {
-	var domains []string
+// parseToSlice parses a blocklist into slices (no map overhead).
+// The slices may contain duplicates — caller is responsible for dedup.
+// sizeHint, when positive, pre-sizes the domain slice.
+func (d *Downloader) parseToSlice(r io.Reader, sizeHint int) (*ParsedList, error) {
+	list := &ParsedList{}
+	if sizeHint > 0 {
+		// Room for the duplicates that dedup will drop
+		list.Domains = make([]string, 0, sizeHint+sizeHint/8)
+	}
 	scanner := bufio.NewScanner(r)
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		domain := d.extractDomain(line)
-		if domain == "" {
-			continue
+		line := scanner.Text()
+		domains, kind := d.classifyLine(line)
+		switch kind {
+		case lineCosmetic:
+			list.Cosmetic++
+		case lineUnsupported:
+			list.Unsupported++
+		case lineException:
+			list.Exceptions = append(list.Exceptions, domains...)
+		case lineMalformed:
+			list.noteMalformed(line)
+			list.Domains = append(list.Domains, domains...)
+		case lineBlock:
+			list.Domains = append(list.Domains, domains...)
 		}
-
-		if !strings.HasSuffix(domain, ".") {
-			domain = dns.Fqdn(domain)
-		}
-
-		domains = append(domains, domain)
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading blocklist: %w", err)
 	}
 
-	return domains, nil
+	return list, nil
 }
 
 // parseHostsFile parses a hosts file format blocklist
 // Supports formats:
-// - 0.0.0.0 domain.com
+// - 0.0.0.0 domain.com [other.domain.com ...]
 // - 127.0.0.1 domain.com
 // - domain.com (plain list)
 // - ||domain.com^ (adblock format)
-func (d *Downloader) parseHostsFile(r io.Reader) (map[string]struct{}, error) {
+//
+// The returned ParsedList carries only the skipped-line counts.
+func (d *Downloader) parseHostsFile(r io.Reader) (map[string]struct{}, *ParsedList, error) {
 	domains := make(map[string]struct{})
+	stats := &ParsedList{}
 	scanner := bufio.NewScanner(r)
 	lineCount := 0
 
 	for scanner.Scan() {
 		lineCount++
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
 
-		// Parse the domain
-		domain := d.extractDomain(line)
-		if domain == "" {
+		// Parse the domains; exceptions and unsupported Adblock rules only
+		// matter to the Manager's merged view and are dropped here.
+		line := scanner.Text()
+		parsed, kind := d.classifyLine(line)
+		switch kind {
+		case lineMalformed:
+			stats.noteMalformed(line)
+		case lineBlock:
+		default:
 			continue
 		}
 
-		// Ensure FQDN format (with trailing dot)
-		if !strings.HasSuffix(domain, ".") {
-			domain = dns.Fqdn(domain)
+		for _, domain := range parsed {
+			domains[domain] = struct{}{}
 		}
 
-		domains[domain] = struct{}{}
-
 		// Log progress for large files
 		if lineCount%100000 == 0 {
 			d.logger.Debug("Parsing blocklist", "lines", lineCount, "domains", len(domains))
@@ -218,70 +363,103 @@ func (d *Downloader) parseHostsFile(r io.Reader) (map[string]struct{}, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading blocklist: %w", err)
+		return nil, nil, fmt.Errorf("error reading blocklist: %w", err)
 	}
 
-	return domains, nil
+	return domains, stats, nil
+}
+
+// hostsLocalNames are the loopback and broadcast entries at the top of most
+// hosts files; they are never meant to be blocked.
+var hostsLocalNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
 }
 
-// extractDomain extracts a domain from various blocklist formats
-func (d *Downloader) extractDomain(line string) string {
+// extractDomains extracts the domains from a hosts entry ("0.0.0.0 a.com
+// b.com # comment", every hostname after the address), a plain or "*."
+// wildcard domain, or an adblock "||domain^" rule, as canonical FQDNs.
+// ok is false when the line isn't in one of those formats or a hostname is
+// invalid; the valid hostnames of such a line are still returned.
+func (d *Downloader) extractDomains(line string) (domains []string, ok bool) {
 	// Strip inline comments. Handles " #", "\t#", and bare "#" forms.
 	// A leading "#" means the whole line is a comment.
 	if idx := strings.Index(line, "#"); idx >= 0 {
-		if idx == 0 {
-			return ""
-		}
 		line = line[:idx]
 	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, true
+	}
 
 	// Adblock format: ||domain.com^
-	if strings.HasPrefix(line, "||") && strings.Contains(line, "^") {
-		domain := strings.TrimPrefix(line, "||")
-		domain = strings.Split(domain, "^")[0]
-		domain = strings.TrimSpace(domain)
-		if strings.Contains(domain, "#") {
-			return ""
+	if strings.HasPrefix(fields[0], "||") {
+		domain, found := abpDomain(strings.TrimSpace(line))
+		if !found {
+			return nil, false
+		}
+		fields = []string{domain}
+	} else if _, err := netip.ParseAddr(fields[0]); err == nil {
+		// Hosts file format: 0.0.0.0 domain.com [more.domain.com ...]
+		if len(fields) == 1 {
+			return nil, false
 		}
-		return domain
+		fields = fields[1:]
+	} else if len(fields) > 1 {
+		// Several names without a leading address isn't a known format.
+		return nil, false
 	}
 
-	// Wildcard domain format: *.domain.com (used by OISD and others)
-	// Strip the "*." prefix — the blocklist manager's Match() already checks subdomains.
-	line = strings.TrimPrefix(line, "*.")
-
-	// Hosts file format: 0.0.0.0 domain.com or 127.0.0.1 domain.com
-	fields := strings.Fields(line)
-	if len(fields) >= 2 {
-		// Check if first field is an IP address
-		if strings.Contains(fields[0], ".") || strings.Contains(fields[0], ":") {
-			// It's likely "IP domain" format
-			domain := fields[1]
-			// Skip localhost entries
-			if domain == "localhost" || domain == "localhost.localdomain" {
-				return ""
-			}
-			if strings.Contains(domain, "#") {
-				return ""
-			}
-			return domain
+	ok = true
+	for _, name := range fields {
+		// Wildcard domain format: *.domain.com (used by OISD and others)
+		// Strip the "*." prefix — the blocklist manager's Match() already checks subdomains.
+		name = strings.TrimPrefix(name, "*.")
+		if hostsLocalNames[strings.ToLower(name)] {
+			continue
+		}
+		if _, err := netip.ParseAddr(name); err == nil {
+			continue // "0.0.0.0 0.0.0.0" entries some lists carry
 		}
+		fqdn := pattern.NormalizeFQDN(name)
+		if !validHostname(fqdn) {
+			ok = false
+			continue
+		}
+		domains = append(domains, fqdn)
 	}
+	return domains, ok
+}
 
-	// Plain domain list format
-	if len(fields) == 1 {
-		domain := fields[0]
-		// Skip localhost
-		if domain == "localhost" || domain == "localhost.localdomain" {
-			return ""
+// validHostname reports whether fqdn (canonical, with trailing dot) is a
+// syntactically valid DNS name: letters, digits, '-' and '_' in labels of
+// 1-63 bytes, at most 253 bytes overall.
+func validHostname(fqdn string) bool {
+	name := strings.TrimSuffix(fqdn, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
 		}
-		if strings.Contains(domain, "#") {
-			return ""
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return false
+			}
 		}
-		return domain
 	}
-
-	return ""
+	return true
 }
 
 // DownloadAll downloads multiple blocklists and merges them
@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"glory-hole/pkg/config"
 	"glory-hole/pkg/logging"
 )
 
@@ -142,6 +143,43 @@ malware.example.com
 	}
 }
 
+func TestDownload_IDNNormalized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := `münchen.de
+0.0.0.0 Ads.KÖLN.de
+xn--mnchen-3ya.de
+||tracker.例え.jp^
+`
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(list))
+	}))
+	defer server.Close()
+
+	d := NewDownloader(logging.NewDefault(), nil)
+	want := []string{"ads.xn--kln-sna.de.", "tracker.xn--r8jz45g.jp.", "xn--mnchen-3ya.de."}
+
+	domains, err := d.Download(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if len(domains) != len(want) {
+		t.Errorf("Expected %d domains after normalization, got %d: %v", len(want), len(domains), domains)
+	}
+	for _, w := range want {
+		if _, ok := domains[w]; !ok {
+			t.Errorf("Expected %q in Download result", w)
+		}
+	}
+
+	sorted, err := d.DownloadSorted(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadSorted: %v", err)
+	}
+	if strings.Join(sorted, ",") != strings.Join(want, ",") {
+		t.Errorf("DownloadSorted = %v, want %v", sorted, want)
+	}
+}
+
 func TestDownload_MixedFormats(t *testing.T) {
 	// Create test HTTP server with mixed formats
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -201,6 +239,61 @@ func TestDownload_HTTPError(t *testing.T) {
 	}
 }
 
+func TestDownloadListAuth_CrossHostRedirectDropsCredentials(t *testing.T) {
+	var gotKey, gotAuth string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotAuth = r.Header.Get("X-Api-Key"), r.Header.Get("Authorization")
+		_, _ = w.Write([]byte("0.0.0.0 mirrored.example.com\n"))
+	}))
+	defer mirror.Close()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "k3y" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, mirror.URL+"/list.txt", http.StatusFound)
+	}))
+	defer source.Close()
+
+	d := NewDownloader(logging.NewDefault(), nil)
+	auth := &config.BlocklistAuthConfig{BearerToken: "tok", Headers: map[string]string{"X-Api-Key": "k3y"}}
+	list, err := d.DownloadListAuth(context.Background(), source.URL, auth)
+	if err != nil {
+		t.Fatalf("DownloadListAuth: %v", err)
+	}
+	if len(list.Domains) != 1 {
+		t.Fatalf("expected the mirrored list, got %v", list.Domains)
+	}
+	if gotKey != "" || gotAuth != "" {
+		t.Errorf("credentials leaked to the redirect target: X-Api-Key=%q Authorization=%q", gotKey, gotAuth)
+	}
+}
+
+func TestClientFor_DowngradeRedirectDropsCredentials(t *testing.T) {
+	d := NewDownloader(logging.NewDefault(), nil)
+	auth := &config.BlocklistAuthConfig{BearerToken: "tok", Headers: map[string]string{"X-Api-Key": "k3y"}}
+	client := d.clientFor(auth)
+
+	original, _ := http.NewRequest(http.MethodGet, "https://lists.example.com/a.txt", nil)
+	for _, tc := range []struct {
+		target string
+		keep   bool
+	}{
+		{"https://lists.example.com/b.txt", true},
+		{"http://lists.example.com/b.txt", false},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, tc.target, nil)
+		setAuth(req, auth)
+		if err := client.CheckRedirect(req, []*http.Request{original}); err != nil {
+			t.Fatalf("CheckRedirect(%s): %v", tc.target, err)
+		}
+		kept := req.Header.Get("Authorization") != "" || req.Header.Get("X-Api-Key") != ""
+		if kept != tc.keep {
+			t.Errorf("redirect to %s: credentials kept = %v, want %v", tc.target, kept, tc.keep)
+		}
+	}
+}
+
 func TestDownload_InvalidURL(t *testing.T) {
 	logger := logging.NewDefault()
 	d := NewDownloader(logger, nil)
@@ -370,7 +463,7 @@ func TestDownloadAll_EmptyList(t *testing.T) {
 	}
 }
 
-func TestExtractDomain_VariousFormats(t *testing.T) {
+func TestExtractDomains_VariousFormats(t *testing.T) {
 	logger := logging.NewDefault()
 	d := NewDownloader(logger, nil)
 
@@ -379,24 +472,161 @@ func TestExtractDomain_VariousFormats(t *testing.T) {
 		input    string
 		expected string
 	}{
-		{"Adblock format", "||ads.example.com^", "ads.example.com"},
-		{"Hosts format with 0.0.0.0", "0.0.0.0 ads.example.com", "ads.example.com"},
-		{"Hosts format with 127.0.0.1", "127.0.0.1 ads.example.com", "ads.example.com"},
-		{"Plain domain", "ads.example.com", "ads.example.com"},
+		{"Adblock format", "||ads.example.com^", "ads.example.com."},
+		{"Hosts format with 0.0.0.0", "0.0.0.0 ads.example.com", "ads.example.com."},
+		{"Hosts format with 127.0.0.1", "127.0.0.1 ads.example.com", "ads.example.com."},
+		{"Plain domain", "ads.example.com", "ads.example.com."},
 		{"Comment", "# This is a comment", ""},
 		{"Empty line", "", ""},
 		{"Localhost", "0.0.0.0 localhost", ""},
 		{"localhost.localdomain", "127.0.0.1 localhost.localdomain", ""},
-		{"Adblock with subdomain", "||tracker.ads.example.com^", "tracker.ads.example.com"},
-		{"Multiple spaces", "0.0.0.0     ads.example.com", "ads.example.com"},
+		{"Adblock with subdomain", "||tracker.ads.example.com^", "tracker.ads.example.com."},
+		{"Multiple spaces", "0.0.0.0     ads.example.com", "ads.example.com."},
+		{"Multiple domains", "0.0.0.0 ads.com tracker.com # comment", "ads.com.,tracker.com."},
+		{"Tabs and inline comment", "0.0.0.0\tads.example.com\t#ads", "ads.example.com."},
+		{"IPv6 address", "::1 ip6-localhost ip6-loopback", ""},
+		{"IPv6 address with domain", ":: ads.example.com", "ads.example.com."},
+		{"Address as hostname", "0.0.0.0 0.0.0.0", ""},
+		{"Wildcard", "*.ads.example.com", "ads.example.com."},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := d.extractDomain(tt.input)
-			if result != tt.expected {
-				t.Errorf("extractDomain(%q) = %q, want %q", tt.input, result, tt.expected)
+			result, ok := d.extractDomains(tt.input)
+			if !ok {
+				t.Fatalf("extractDomains(%q) reported malformed", tt.input)
+			}
+			if got := strings.Join(result, ","); got != tt.expected {
+				t.Errorf("extractDomains(%q) = %q, want %q", tt.input, got, tt.expected)
 			}
 		})
 	}
 }
+
+func TestExtractDomains_Malformed(t *testing.T) {
+	d := NewDownloader(logging.NewDefault(), nil)
+
+	tests := []struct {
+		input string
+		valid string // hostnames still extracted from the line
+	}{
+		{"0.0.0.0", ""},
+		{"ads.example.com tracker.example.com", ""},
+		{"0.0.0.0 bad..example.com", ""},
+		{"0.0.0.0 good.example.com bad!name.com", "good.example.com."},
+		{"0.0.0.0 " + strings.Repeat("a", 64) + ".com", ""},
+	}
+	for _, tt := range tests {
+		result, ok := d.extractDomains(tt.input)
+		if ok {
+			t.Errorf("extractDomains(%q) should report malformed", tt.input)
+		}
+		if got := strings.Join(result, ","); got != tt.valid {
+			t.Errorf("extractDomains(%q) = %q, want %q", tt.input, got, tt.valid)
+		}
+	}
+}
+
+func TestDownloadList_MessyHostsFile(t *testing.T) {
+	// Modeled on StevenBlack/someonewhocares-style hosts files.
+	hosts := "# Title: messy hosts\r\n" +
+		"127.0.0.1 localhost\r\n" +
+		"127.0.0.1 localhost.localdomain\r\n" +
+		"255.255.255.255 broadcasthost\r\n" +
+		"::1 localhost ip6-localhost ip6-loopback\r\n" +
+		"fe80::1%lo0 localhost\r\n" +
+		"0.0.0.0 0.0.0.0\r\n" +
+		"\r\n" +
+		"   # indented comment\r\n" +
+		"0.0.0.0 ads.example.com tracker.example.com # ad servers\r\n" +
+		"0.0.0.0\t\tpixel.example.com\t# tab separated\r\n" +
+		"  127.0.0.1   Metrics.Example.COM   \r\n" +
+		"0.0.0.0 a.example.net b.example.net\tc.example.net\r\n" +
+		"0.0.0.0 bad_host!.example.org good.example.org\r\n" +
+		"this line is garbage\r\n" +
+		"0.0.0.0\r\n" +
+		"0.0.0.0 ads.example.com #duplicate\r\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(hosts))
+	}))
+	defer server.Close()
+
+	d := NewDownloader(logging.NewDefault(), nil)
+	list, err := d.DownloadList(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadList: %v", err)
+	}
+
+	want := []string{
+		"a.example.net.", "ads.example.com.", "b.example.net.", "c.example.net.",
+		"good.example.org.", "metrics.example.com.", "pixel.example.com.", "tracker.example.com.",
+	}
+	if strings.Join(list.Domains, ",") != strings.Join(want, ",") {
+		t.Errorf("Domains = %v, want %v", list.Domains, want)
+	}
+	if list.Malformed != 3 {
+		t.Errorf("Malformed = %d, want 3", list.Malformed)
+	}
+
+	domains, err := d.Download(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if len(domains) != len(want) {
+		t.Errorf("Download returned %d domains, want %d: %v", len(domains), len(want), domains)
+	}
+}
+
+func TestDownloadList_AdblockSyntax(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list := `[Adblock Plus 2.0]
+! Title: Test filter
+||ads.example.com^
+||tracker.example.com^$important
+||track.example.org^|
+@@||cdn.ads.example.com^
+@@||allowed.example.net^$document
+example.com##.banner
+example.com#@#.sponsor
+||example.com/ads/*
+||ads.example.net^$third-party
+/banner[0-9]+/
+|https://example.org/pixel
+0.0.0.0 hosts.example.com ## trailing comment
+`
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(list))
+	}))
+	defer server.Close()
+
+	d := NewDownloader(logging.NewDefault(), nil)
+	list, err := d.DownloadList(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("DownloadList: %v", err)
+	}
+
+	wantDomains := []string{"ads.example.com.", "hosts.example.com.", "track.example.org.", "tracker.example.com."}
+	if strings.Join(list.Domains, ",") != strings.Join(wantDomains, ",") {
+		t.Errorf("Domains = %v, want %v", list.Domains, wantDomains)
+	}
+	wantExceptions := []string{"allowed.example.net.", "cdn.ads.example.com."}
+	if strings.Join(list.Exceptions, ",") != strings.Join(wantExceptions, ",") {
+		t.Errorf("Exceptions = %v, want %v", list.Exceptions, wantExceptions)
+	}
+	if list.Cosmetic != 2 {
+		t.Errorf("Cosmetic = %d, want 2", list.Cosmetic)
+	}
+	if list.Unsupported != 4 {
+		t.Errorf("Unsupported = %d, want 4", list.Unsupported)
+	}
+
+	// The map-based parser keeps only the blocked domains.
+	domains, err := d.Download(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if len(domains) != len(wantDomains) {
+		t.Errorf("Download returned %d domains, want %d: %v", len(domains), len(wantDomains), domains)
+	}
+}
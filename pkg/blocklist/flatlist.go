@@ -1,6 +1,8 @@
 package blocklist
 
 import (
+	"container/heap"
+	"math"
 	"sort"
 	"strings"
 )
@@ -8,21 +10,82 @@ import (
 // FlatBlocklist is a memory-compact blocklist that stores all domain strings
 // in a single contiguous byte slice with a sorted index for binary search.
 //
-// Memory cost per domain: ~33 bytes (vs ~140 bytes for map[string]uint64).
-// At 1.3M domains this saves ~140MB of heap.
+// Memory cost per domain: the name plus ~7 bytes, ~27 bytes for a typical
+// 20-character name (vs ~140 bytes for map[string]uint64).
+// At 1.3M domains this saves ~150MB of heap. BenchmarkExactStore compares
+// the two.
 //
 // Layout:
 //
 //	data  []byte   — all FQDN strings concatenated (e.g. "ad.example.com.\0tracker.net.\0...")
 //	offs  []uint32 — sorted start offsets into data (one per domain)
-//	masks []uint64 — source bitmask parallel to offs
+//	masks maskSet  — source bitmask per domain, parallel to offs
 //
 // Lookup is O(log n) binary search. Subdomain walk does one binary search
 // per parent label (typically 2–4 searches per query).
 type FlatBlocklist struct {
 	data  []byte   // concatenated domain strings, NUL-terminated
 	offs  []uint32 // sorted offsets into data (start of each domain)
-	masks []uint64 // source bitmask, parallel to offs
+	masks maskSet  // source bitmask, parallel to offs
+}
+
+// maskSet stores one source bitmask per domain. A few distinct source
+// combinations cover millions of domains, so each domain holds a 2-byte
+// index into a table of masks rather than the 8-byte mask itself. Past
+// 65536 distinct masks it falls back to storing every mask in full.
+type maskSet struct {
+	ids   []uint16 // index into table, per domain
+	table []uint64
+	index map[uint64]uint16 // table lookup, dropped once building is done
+	wide  []uint64          // every mask, used instead of ids/table once set
+}
+
+func newMaskSet(capacity int) maskSet {
+	return maskSet{ids: make([]uint16, 0, capacity), index: make(map[uint64]uint16)}
+}
+
+func (s *maskSet) add(mask uint64) {
+	if s.wide != nil {
+		s.wide = append(s.wide, mask)
+		return
+	}
+	id, ok := s.index[mask]
+	if !ok {
+		if len(s.table) > math.MaxUint16 {
+			s.widen()
+			s.wide = append(s.wide, mask)
+			return
+		}
+		id = uint16(len(s.table))
+		s.table = append(s.table, mask)
+		s.index[mask] = id
+	}
+	s.ids = append(s.ids, id)
+}
+
+// widen switches to storing full masks.
+func (s *maskSet) widen() {
+	s.wide = make([]uint64, len(s.ids), cap(s.ids))
+	for i, id := range s.ids {
+		s.wide[i] = s.table[id]
+	}
+	s.ids, s.table, s.index = nil, nil, nil
+}
+
+// done releases the build-time index.
+func (s *maskSet) done() {
+	s.index = nil
+}
+
+func (s *maskSet) at(i int) uint64 {
+	if s.wide != nil {
+		return s.wide[i]
+	}
+	return s.table[s.ids[i]]
+}
+
+func (s *maskSet) memoryUsage() int {
+	return len(s.ids)*2 + len(s.table)*8 + len(s.wide)*8
 }
 
 // BuildFlatBlocklist constructs a FlatBlocklist from a map of domain → source mask.
@@ -47,14 +110,15 @@ func BuildFlatBlocklist(m map[string]uint64) *FlatBlocklist {
 	// Phase 3: pack into contiguous storage.
 	data := make([]byte, 0, dataSize)
 	offs := make([]uint32, n)
-	masks := make([]uint64, n)
+	masks := newMaskSet(n)
 
 	for i, k := range keys {
 		offs[i] = uint32(len(data))
-		masks[i] = m[k]
+		masks.add(m[k])
 		data = append(data, k...)
 		data = append(data, 0) // NUL terminator
 	}
+	masks.done()
 
 	return &FlatBlocklist{
 		data:  data,
@@ -74,7 +138,8 @@ type sortedList struct {
 // deduplication, saving ~140 bytes per domain (180MB for 1.3M domains).
 //
 // Each list's domains must already be sorted. Duplicates across lists are
-// merged and their source masks are OR'd together.
+// merged and their source masks are OR'd together. The merge keeps the lists
+// in a min-heap, so a dozen sources cost O(log k) per domain, not O(k).
 func BuildFromSortedLists(lists []sortedList) *FlatBlocklist {
 	// Compute total domain count (upper bound; duplicates reduce this)
 	totalDomains := 0
@@ -93,43 +158,30 @@ func BuildFromSortedLists(lists []sortedList) *FlatBlocklist {
 	// Pre-allocate output arrays at upper-bound capacity
 	data := make([]byte, 0, totalBytes)
 	offs := make([]uint32, 0, totalDomains)
-	masks := make([]uint64, 0, totalDomains)
-
-	// k-way merge using index cursors (simple for small k, typically 2-5 lists)
-	cursors := make([]int, len(lists))
+	masks := newMaskSet(totalDomains)
 
-	for {
-		// Find the lexicographically smallest domain across all lists
-		minDomain := ""
-		for i, l := range lists {
-			if cursors[i] >= len(l.domains) {
-				continue // this list is exhausted
-			}
-			d := l.domains[cursors[i]]
-			if minDomain == "" || d < minDomain {
-				minDomain = d
-			}
-		}
-
-		if minDomain == "" {
-			break // all lists exhausted
+	h := &mergeHeap{lists: lists, cursors: make([]int, len(lists))}
+	for i, l := range lists {
+		if len(l.domains) > 0 {
+			h.order = append(h.order, i)
 		}
+	}
+	heap.Init(h)
 
-		// Collect the source mask from all lists that have this domain
+	for h.Len() > 0 {
+		// Take the smallest domain from every list that has it
+		domain := h.head()
 		var mask uint64
-		for i, l := range lists {
-			if cursors[i] < len(l.domains) && l.domains[cursors[i]] == minDomain {
-				mask |= l.mask
-				cursors[i]++
-			}
+		for h.Len() > 0 && h.head() == domain {
+			mask |= h.advance()
 		}
 
-		// Append to output
 		offs = append(offs, uint32(len(data)))
-		masks = append(masks, mask)
-		data = append(data, minDomain...)
+		masks.add(mask)
+		data = append(data, domain...)
 		data = append(data, 0)
 	}
+	masks.done()
 
 	return &FlatBlocklist{
 		data:  data,
@@ -138,6 +190,105 @@ func BuildFromSortedLists(lists []sortedList) *FlatBlocklist {
 	}
 }
 
+// mergeSorted returns a new FlatBlocklist with f's domains and list's merged
+// in order, OR-ing the masks of domains in both. f is left unchanged. Used to
+// fold sources in one at a time when loading sequentially.
+func (f *FlatBlocklist) mergeSorted(list sortedList) *FlatBlocklist {
+	n := f.Len()
+	if n == 0 {
+		return BuildFromSortedLists([]sortedList{list})
+	}
+	if len(list.domains) == 0 {
+		return f
+	}
+
+	totalBytes := len(f.data)
+	for _, d := range list.domains {
+		totalBytes += len(d) + 1
+	}
+	data := make([]byte, 0, totalBytes)
+	offs := make([]uint32, 0, n+len(list.domains))
+	masks := newMaskSet(n + len(list.domains))
+
+	i, j := 0, 0
+	for i < n || j < len(list.domains) {
+		offs = append(offs, uint32(len(data)))
+		c := -1
+		switch {
+		case i == n:
+			c = 1
+		case j < len(list.domains):
+			c = f.cmpDomainAt(i, list.domains[j])
+		}
+		switch {
+		case c < 0:
+			masks.add(f.masks.at(i))
+			data = append(data, f.entry(i)...)
+			i++
+		case c > 0:
+			masks.add(list.mask)
+			data = append(data, list.domains[j]...)
+			j++
+		default:
+			masks.add(f.masks.at(i) | list.mask)
+			data = append(data, f.entry(i)...)
+			i++
+			j++
+		}
+		data = append(data, 0)
+	}
+	masks.done()
+
+	return &FlatBlocklist{
+		data:  data,
+		offs:  offs,
+		masks: masks,
+	}
+}
+
+// mergeHeap orders the non-exhausted lists of a k-way merge by their
+// current domain. It implements heap.Interface over order.
+type mergeHeap struct {
+	lists   []sortedList
+	cursors []int // next unread domain per list
+	order   []int // heap of list indices
+}
+
+func (h *mergeHeap) Len() int { return len(h.order) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.order[i], h.order[j]
+	return h.lists[a].domains[h.cursors[a]] < h.lists[b].domains[h.cursors[b]]
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.order[i], h.order[j] = h.order[j], h.order[i] }
+
+func (h *mergeHeap) Push(x any) { h.order = append(h.order, x.(int)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.order[len(h.order)-1]
+	h.order = h.order[:len(h.order)-1]
+	return last
+}
+
+// head returns the smallest current domain.
+func (h *mergeHeap) head() string {
+	i := h.order[0]
+	return h.lists[i].domains[h.cursors[i]]
+}
+
+// advance consumes the head domain and returns its list's source mask.
+func (h *mergeHeap) advance() uint64 {
+	i := h.order[0]
+	h.cursors[i]++
+	if h.cursors[i] < len(h.lists[i].domains) {
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+	return h.lists[i].mask
+}
+
 // Len returns the number of domains in the blocklist.
 func (f *FlatBlocklist) Len() int {
 	if f == nil {
@@ -146,19 +297,19 @@ func (f *FlatBlocklist) Len() int {
 	return len(f.offs)
 }
 
-// domainAt returns the domain string at index i without allocating.
-// The returned string shares memory with f.data (no copy).
+// entry returns the bytes of domain i, without its NUL terminator. Domains
+// are packed in index order, so each one ends where the next begins.
+func (f *FlatBlocklist) entry(i int) []byte {
+	end := len(f.data)
+	if i+1 < len(f.offs) {
+		end = int(f.offs[i+1])
+	}
+	return f.data[f.offs[i] : end-1]
+}
+
+// domainAt returns a copy of the domain string at index i.
 func (f *FlatBlocklist) domainAt(i int) string {
-	start := f.offs[i]
-	// Find NUL terminator
-	end := start
-	for end < uint32(len(f.data)) && f.data[end] != 0 {
-		end++
-	}
-	// Convert byte slice to string without allocation via unsafe would be
-	// ideal, but the standard conversion is fine here — the compiler can
-	// often optimize the comparison path to avoid the copy.
-	return string(f.data[start:end])
+	return string(f.entry(i))
 }
 
 // Lookup returns the source bitmask for a domain and whether it was found.
@@ -173,44 +324,25 @@ func (f *FlatBlocklist) Lookup(domain string) (mask uint64, ok bool) {
 	})
 
 	if idx < len(f.offs) && f.cmpDomainAt(idx, domain) == 0 {
-		return f.masks[idx], true
+		return f.masks.at(idx), true
 	}
 	return 0, false
 }
 
 // cmpDomainAt compares the domain at index i with target.
 // Returns negative if data[i] < target, 0 if equal, positive if data[i] > target.
-// Compares directly against f.data bytes without allocating a string.
+// The string conversions are comparison operands, which the compiler
+// evaluates in place without allocating.
 func (f *FlatBlocklist) cmpDomainAt(i int, target string) int {
-	start := int(f.offs[i])
-	tLen := len(target)
-	pos := 0
-
-	for pos < tLen {
-		dataPos := start + pos
-		if dataPos >= len(f.data) || f.data[dataPos] == 0 {
-			// data domain is shorter → data < target
-			return -1
-		}
-		db := f.data[dataPos]
-		tb := target[pos]
-		if db != tb {
-			if db < tb {
-				return -1
-			}
-			return 1
-		}
-		pos++
-	}
-
-	// All characters matched so far. Check if data domain has more chars.
-	endPos := start + pos
-	if endPos < len(f.data) && f.data[endPos] != 0 {
-		// data domain is longer → data > target
+	d := f.entry(i)
+	switch {
+	case string(d) == target:
+		return 0
+	case string(d) < target:
+		return -1
+	default:
 		return 1
 	}
-
-	return 0
 }
 
 // Contains checks if a domain exists in the blocklist.
@@ -226,8 +358,23 @@ func (f *FlatBlocklist) ForEach(fn func(domain string, mask uint64)) {
 		return
 	}
 	for i := range f.offs {
-		fn(f.domainAt(i), f.masks[i])
+		fn(f.domainAt(i), f.masks.at(i))
+	}
+}
+
+// sourceDomains returns, in sorted order, the domains whose source mask
+// includes any bit of mask.
+func (f *FlatBlocklist) sourceDomains(mask uint64) []string {
+	if f == nil {
+		return nil
+	}
+	var domains []string
+	for i := range f.offs {
+		if f.masks.at(i)&mask != 0 {
+			domains = append(domains, f.domainAt(i))
+		}
 	}
+	return domains
 }
 
 // MemoryUsage returns an estimate of the total bytes consumed by the structure.
@@ -235,20 +382,41 @@ func (f *FlatBlocklist) MemoryUsage() int {
 	if f == nil {
 		return 0
 	}
-	return len(f.data) + len(f.offs)*4 + len(f.masks)*8
+	return len(f.data) + len(f.offs)*4 + f.masks.memoryUsage()
 }
 
 // LookupSubdomains checks the domain and all its parent domains.
 // Returns on first match (most specific wins). This is the equivalent
 // of the old Match() subdomain walk but using binary search.
 func (f *FlatBlocklist) LookupSubdomains(fqdn string) (mask uint64, kind string, ok bool) {
+	mask, entry, ok := f.LookupSubdomainsEntry(fqdn)
+	if !ok {
+		return 0, "", false
+	}
+	if entry == fqdn {
+		return mask, "exact", true
+	}
+	return mask, "subdomain", true
+}
+
+// LookupSubdomainsEntry is LookupSubdomains but returns the entry that matched
+// (fqdn itself or the nearest listed parent) instead of the match kind.
+func (f *FlatBlocklist) LookupSubdomainsEntry(fqdn string) (mask uint64, entry string, ok bool) {
+	return f.lookupSuffix(fqdn, 0)
+}
+
+// lookupSuffix is LookupSubdomainsEntry where the sources in exactOnly only
+// block the names they list: a parent entry matches through its other
+// sources, and the returned mask leaves the exact-only ones out. Entries
+// without tracked sources (mask 0) always match as suffixes.
+func (f *FlatBlocklist) lookupSuffix(fqdn string, exactOnly uint64) (mask uint64, entry string, ok bool) {
 	if f == nil || len(f.offs) == 0 {
 		return 0, "", false
 	}
 
 	// Try exact match first
 	if mask, found := f.Lookup(fqdn); found {
-		return mask, "exact", true
+		return mask, fqdn, true
 	}
 
 	// Walk parent domains: "sub.example.com." → "example.com." → "com."
@@ -263,7 +431,12 @@ func (f *FlatBlocklist) LookupSubdomains(fqdn string) (mask uint64, kind string,
 			break
 		}
 		if mask, found := f.Lookup(parent); found {
-			return mask, "subdomain", true
+			if exactOnly != 0 && mask != 0 {
+				if mask &^= exactOnly; mask == 0 {
+					continue
+				}
+			}
+			return mask, parent, true
 		}
 	}
 
@@ -2,6 +2,8 @@ package blocklist
 
 import (
 	"fmt"
+	"runtime"
+	"sort"
 	"testing"
 )
 
@@ -144,6 +146,84 @@ func TestFlatBlocklist_ForEach(t *testing.T) {
 	}
 }
 
+func TestBuildFromSortedLists_ManyLists(t *testing.T) {
+	// Overlapping lists: list i holds every domain whose number is a multiple of i+1
+	const numLists, numDomains = 12, 500
+	want := make(map[string]uint64)
+	lists := make([]sortedList, numLists)
+	for i := range lists {
+		lists[i].mask = 1 << uint(i)
+		for n := 0; n < numDomains; n += i + 1 {
+			d := fmt.Sprintf("d%04d.test.", n)
+			lists[i].domains = append(lists[i].domains, d)
+			want[d] |= lists[i].mask
+		}
+	}
+	lists = append(lists, sortedList{mask: 1 << numLists}) // empty source
+
+	f := BuildFromSortedLists(lists)
+	if f.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", f.Len(), len(want))
+	}
+	prev := ""
+	f.ForEach(func(domain string, mask uint64) {
+		if domain <= prev {
+			t.Errorf("%q out of order after %q", domain, prev)
+		}
+		prev = domain
+		if mask != want[domain] {
+			t.Errorf("%s: mask=%b, want %b", domain, mask, want[domain])
+		}
+	})
+}
+
+func TestFlatBlocklist_MergeSorted(t *testing.T) {
+	// Folding lists in one at a time matches a single k-way merge
+	const numLists, numDomains = 5, 300
+	lists := make([]sortedList, numLists)
+	for i := range lists {
+		lists[i].mask = 1 << uint(i)
+		for n := i; n < numDomains; n += i + 2 {
+			lists[i].domains = append(lists[i].domains, fmt.Sprintf("d%04d.test.", n))
+		}
+	}
+	lists = append(lists, sortedList{mask: 1 << numLists}) // empty source
+
+	want := BuildFromSortedLists(lists)
+	got := &FlatBlocklist{}
+	for _, l := range lists {
+		got = got.mergeSorted(l)
+	}
+	if got.Len() != want.Len() {
+		t.Fatalf("Len() = %d, want %d", got.Len(), want.Len())
+	}
+	for i := 0; i < want.Len(); i++ {
+		if got.domainAt(i) != want.domainAt(i) || got.masks.at(i) != want.masks.at(i) {
+			t.Fatalf("entry %d = %s/%b, want %s/%b", i,
+				got.domainAt(i), got.masks.at(i), want.domainAt(i), want.masks.at(i))
+		}
+	}
+}
+
+func TestFlatBlocklist_ManyDistinctMasks(t *testing.T) {
+	// More source combinations than a 2-byte mask index can address
+	const n = 70_000
+	m := make(map[string]uint64, n)
+	for i := 0; i < n; i++ {
+		m[fmt.Sprintf("d%05d.test.", i)] = uint64(i + 1)
+	}
+	f := BuildFlatBlocklist(m)
+	if f.masks.wide == nil {
+		t.Fatal("expected full masks past 65536 distinct values")
+	}
+	for _, i := range []int{0, 65535, 65536, n - 1} {
+		mask, ok := f.Lookup(fmt.Sprintf("d%05d.test.", i))
+		if !ok || mask != uint64(i+1) {
+			t.Errorf("d%05d: mask=%d ok=%v, want %d", i, mask, ok, i+1)
+		}
+	}
+}
+
 func BenchmarkFlatBlocklist_Lookup(b *testing.B) {
 	const size = 1_000_000
 	m := make(map[string]uint64, size)
@@ -187,3 +267,59 @@ func BenchmarkFlatBlocklist_Build(b *testing.B) {
 		BuildFlatBlocklist(m)
 	}
 }
+
+// BenchmarkExactStore compares the FlatBlocklist exact-match store with the
+// map[string]uint64 it replaced, reporting heap bytes per domain alongside
+// lookup latency.
+func BenchmarkExactStore(b *testing.B) {
+	const size = 1_000_000
+	domains := make([]string, size)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("domain-%d.blocked.test.", i)
+	}
+	hit, miss := domains[size/2], "notblocked.example.com."
+
+	// heapGrowth returns the live heap retained by build, per domain.
+	heapGrowth := func(build func() any) (any, float64) {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		store := build()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		return store, float64(after.HeapAlloc-before.HeapAlloc) / size
+	}
+
+	b.Run("flat", func(b *testing.B) {
+		store, perDomain := heapGrowth(func() any {
+			lists := []sortedList{{domains: append([]string(nil), domains...), mask: 1}}
+			sort.Strings(lists[0].domains)
+			return BuildFromSortedLists(lists)
+		})
+		f := store.(*FlatBlocklist)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			f.Lookup(hit)
+			f.Lookup(miss)
+		}
+		b.ReportMetric(perDomain, "heap-B/domain")
+	})
+
+	b.Run("map", func(b *testing.B) {
+		store, perDomain := heapGrowth(func() any {
+			m := make(map[string]uint64, size)
+			for _, d := range domains {
+				// Copy the key so the map owns its strings, as a parsed list would
+				m[string([]byte(d))] = 1
+			}
+			return m
+		})
+		m := store.(map[string]uint64)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = m[hit]
+			_ = m[miss]
+		}
+		b.ReportMetric(perDomain, "heap-B/domain")
+	})
+}
@@ -4,9 +4,12 @@ package blocklist
 
 import (
 	"context"
+	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"runtime"
 	"runtime/debug"
+	"runtime/metrics"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,6 +19,8 @@ import (
 	"glory-hole/pkg/logging"
 	"glory-hole/pkg/pattern"
 	"glory-hole/pkg/telemetry"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const maxTrackedSources = 64
@@ -27,6 +32,20 @@ type BlockEntry struct {
 	Overflow   bool
 }
 
+// SourceResult is the outcome of downloading one blocklist source during the
+// most recent update.
+type SourceResult struct {
+	URL     string `json:"url"`
+	Name    string `json:"name,omitempty"` // blocklist_names entry, if any
+	Domains int    `json:"domains"`
+	Bytes   int64  `json:"bytes,omitempty"` // size of the download
+	Error   string `json:"error,omitempty"`
+
+	// Held explains why the download was set aside and the source's
+	// previous domains kept (see blocklist_loading.shrink_threshold).
+	Held string `json:"held,omitempty"`
+}
+
 // Manager manages blocklist downloads and automatic updates
 type Manager struct {
 	cfg        *config.Config
@@ -40,12 +59,25 @@ type Manager struct {
 	// this is ~43MB instead of ~180MB.
 	current atomic.Pointer[FlatBlocklist]
 
+	// Adblock "@@" exception domains from the downloaded lists. A listed
+	// exception (or its parent) un-blocks list matches across all sources;
+	// it does not override user-configured patterns or policy rules.
+	exceptions atomic.Pointer[FlatBlocklist]
+
 	// Pattern-based blocklist (wildcard and regex)
 	patterns atomic.Pointer[pattern.Matcher]
 
 	lastUpdated atomic.Value
 	sourceNames atomic.Value
 
+	// exactSources has the source-mask bits of loaded sources configured
+	// with blocklist_match: exact; their entries don't cover subdomains.
+	exactSources atomic.Uint64
+
+	// sourceLabels maps source URLs to their blocklist_names entry. Nil
+	// when no names are configured.
+	sourceLabels atomic.Pointer[map[string]string]
+
 	// updateMu serializes Update calls to prevent concurrent downloads
 	// from overlapping (API reload + config watcher + auto-update ticker).
 	// This prevents double memory usage from parallel downloads.
@@ -55,7 +87,34 @@ type Manager struct {
 	// used to pre-allocate the merged map and avoid repeated growth.
 	lastSize atomic.Int64
 
+	// sourceResults holds the per-source outcome of the last update.
+	sourceResults atomic.Pointer[[]SourceResult]
+
+	// lastLoad holds timing and peak memory of the last successful update.
+	lastLoad atomic.Pointer[LoadStats]
+
+	// shrunkSince records when each held source first came back too small.
+	// Guarded by updateMu.
+	shrunkSince map[string]time.Time
+
+	// reloads coalesces concurrent Reload calls into one download.
+	reloads singleflight.Group
+
+	// ready is closed once a load has produced domains from at least one
+	// source, or found no sources configured.
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	// onUpdateFailure is told about failed updates and unreachable sources.
+	onUpdateFailure atomic.Pointer[func(err error)]
+
+	// retrying is set while retryUntilReady runs; retryInterval is its
+	// period (startupRetryInterval outside tests).
+	retrying      atomic.Bool
+	retryInterval time.Duration
+
 	// Lifecycle management
+	runCtx       context.Context // Start's context, guarded by cfgMu
 	updateTicker *time.Ticker
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
@@ -70,6 +129,10 @@ func NewManager(cfg *config.Config, logger *logging.Logger, metrics *telemetry.M
 		logger:     logger,
 		metrics:    metrics,
 		stopChan:   make(chan struct{}),
+		ready:      make(chan struct{}),
+
+		retryInterval: startupRetryInterval,
+		shrunkSince:   make(map[string]time.Time),
 	}
 
 	// Initialize with empty blocklist
@@ -77,6 +140,7 @@ func NewManager(cfg *config.Config, logger *logging.Logger, metrics *telemetry.M
 	m.current.Store(empty)
 	m.lastUpdated.Store(time.Time{})
 	m.sourceNames.Store([]string{})
+	m.refreshSourceLabels()
 
 	return m
 }
@@ -91,6 +155,10 @@ func (m *Manager) Start(ctx context.Context) error {
 	// Re-create stopChan if this is a restart
 	m.stopChan = make(chan struct{})
 
+	m.cfgMu.Lock()
+	m.runCtx = ctx
+	m.cfgMu.Unlock()
+
 	m.cfgMu.RLock()
 	blocklists := m.cfg.Blocklists
 	autoUpdate := m.cfg.AutoUpdateBlocklists
@@ -107,6 +175,10 @@ func (m *Manager) Start(ctx context.Context) error {
 		m.logger.Error("Initial blocklist download failed", "error", err)
 	}
 
+	// With startup.fail_closed queries are held until a load succeeds, so a
+	// failed initial download can't wait for the next scheduled update.
+	m.startRetryUntilReady()
+
 	// Start auto-update goroutine if enabled
 	if autoUpdate && updateInterval > 0 {
 		m.updateTicker = time.NewTicker(updateInterval)
@@ -142,6 +214,7 @@ func (m *Manager) Update(ctx context.Context) error {
 
 	if len(blocklists) == 0 {
 		m.logger.Debug("No blocklists configured")
+		m.markReady()
 		return nil
 	}
 
@@ -151,6 +224,42 @@ func (m *Manager) Update(ctx context.Context) error {
 	}
 	defer m.updateMu.Unlock()
 
+	return m.update(ctx, blocklists)
+}
+
+// Reload downloads all blocklists now and waits for the result. Unlike
+// Update it never skips: if an update is already running it waits for it to
+// finish and then downloads again, and concurrent Reload calls share a single
+// download. It returns the per-source results of that download.
+func (m *Manager) Reload(ctx context.Context) ([]SourceResult, error) {
+	_, err, _ := m.reloads.Do("reload", func() (any, error) {
+		m.cfgMu.RLock()
+		blocklists := m.cfg.Blocklists
+		m.cfgMu.RUnlock()
+
+		m.updateMu.Lock()
+		defer m.updateMu.Unlock()
+		if len(blocklists) == 0 {
+			m.sourceResults.Store(&[]SourceResult{})
+			m.markReady()
+			return nil, nil
+		}
+		return nil, m.update(ctx, blocklists)
+	})
+	return m.SourceResults(), err
+}
+
+// SourceResults returns the per-source results of the last update, in
+// configuration order. Nil before the first update.
+func (m *Manager) SourceResults() []SourceResult {
+	if p := m.sourceResults.Load(); p != nil {
+		return append([]SourceResult(nil), (*p)...)
+	}
+	return nil
+}
+
+// update performs one download-and-swap. The caller holds updateMu.
+func (m *Manager) update(ctx context.Context, blocklists []string) error {
 	m.logger.Info("Updating blocklists", "sources", len(blocklists))
 	startTime := time.Now()
 	oldSize := int(m.lastSize.Load())
@@ -158,13 +267,27 @@ func (m *Manager) Update(ctx context.Context) error {
 	// Download each list into a sorted slice, then k-way merge into FlatBlocklist.
 	// This avoids the ~180MB temporary map[string]uint64 for 1.3M domains —
 	// each per-list []string is sorted and released after merge.
-	flat, err := m.downloadAndMerge(ctx)
+	var peak heapPeak
+	var fetchTime time.Duration
+	flat, exceptions, results, err := m.downloadAndMerge(ctx, &peak, &fetchTime)
+	m.sourceResults.Store(&results)
 	if err != nil {
+		m.reportUpdateFailure(err)
 		return err
 	}
+	var failed []string
+	for _, res := range results {
+		if res.Error != "" {
+			failed = append(failed, res.URL)
+		}
+	}
+	if len(failed) > 0 {
+		m.reportUpdateFailure(fmt.Errorf("%d of %d blocklists failed to download: %s", len(failed), len(blocklists), strings.Join(failed, ", ")))
+	}
 
 	m.logger.Info("Blocklist compacted",
 		"domains", flat.Len(),
+		"exceptions", exceptions.Len(),
 		"memory_bytes", flat.MemoryUsage(),
 		"memory_mb", flat.MemoryUsage()/(1024*1024))
 
@@ -172,6 +295,7 @@ func (m *Manager) Update(ctx context.Context) error {
 	delta := newSize - oldSize
 
 	m.current.Store(flat)
+	m.exceptions.Store(exceptions)
 	m.lastSize.Store(int64(newSize))
 
 	// Force the Go runtime to return freed pages to the OS immediately.
@@ -191,26 +315,53 @@ func (m *Manager) Update(ctx context.Context) error {
 		sourceCopy = sourceCopy[:maxTrackedSources]
 	}
 	m.sourceNames.Store(sourceCopy)
+	m.refreshMatchModes()
+	if len(failed) < len(results) {
+		m.markReady()
+	}
 
-	if m.metrics != nil {
-		m.metrics.BlocklistSize.Add(ctx, int64(delta))
+	var downloaded int64
+	for _, res := range results {
+		downloaded += res.Bytes
 	}
 
 	elapsed := time.Since(startTime)
+	peakHeap := peak.bytes.Load()
+	load := &LoadStats{Duration: elapsed, PeakHeapBytes: peakHeap, DownloadedBytes: downloaded, DownloadDuration: fetchTime}
+	m.lastLoad.Store(load)
+
+	if m.metrics != nil {
+		m.metrics.BlocklistSize.Add(ctx, int64(delta))
+		if m.metrics.BlocklistLoadPeakHeap != nil {
+			m.metrics.BlocklistLoadPeakHeap.Record(ctx, int64(peakHeap))
+		}
+		if m.metrics.BlocklistDownloaded != nil {
+			m.metrics.BlocklistDownloaded.Add(ctx, downloaded)
+		}
+	}
 	if delta > 0 {
 		m.logger.Info("Blocklists updated - domains increased",
 			"total_domains", newSize, "added", delta,
 			"duration", elapsed,
+			"peak_heap_mb", peakHeap/(1024*1024),
+			"downloaded_mb", load.DownloadedBytes/(1024*1024),
+			"download_bytes_per_second", load.DownloadRate(),
 			"domains_per_second", float64(newSize)/elapsed.Seconds())
 	} else if delta < 0 {
 		m.logger.Info("Blocklists updated - domains decreased",
 			"total_domains", newSize, "removed", -delta,
 			"duration", elapsed,
+			"peak_heap_mb", peakHeap/(1024*1024),
+			"downloaded_mb", load.DownloadedBytes/(1024*1024),
+			"download_bytes_per_second", load.DownloadRate(),
 			"domains_per_second", float64(newSize)/elapsed.Seconds())
 	} else {
 		m.logger.Info("Blocklists updated - no changes",
 			"total_domains", newSize,
 			"duration", elapsed,
+			"peak_heap_mb", peakHeap/(1024*1024),
+			"downloaded_mb", load.DownloadedBytes/(1024*1024),
+			"download_bytes_per_second", load.DownloadRate(),
 			"domains_per_second", float64(newSize)/elapsed.Seconds())
 	}
 
@@ -227,40 +378,102 @@ func (m *Manager) Update(ctx context.Context) error {
 //     into the contiguous FlatBlocklist and the per-list slice is released
 //   - Peak memory: sum of all per-list slices + final FlatBlocklist
 //   - For 3 lists totaling 1.3M domains: ~50MB peak vs ~230MB with temp map
-func (m *Manager) downloadAndMerge(ctx context.Context) (*FlatBlocklist, error) {
+//
+// The second result holds the lists' "@@" exception domains, merged the same
+// way; the third reports each source's outcome in configuration order.
+func (m *Manager) downloadAndMerge(ctx context.Context, peak *heapPeak, fetchTime *time.Duration) (*FlatBlocklist, *FlatBlocklist, []SourceResult, error) {
 	m.cfgMu.RLock()
 	urls := m.cfg.Blocklists
+	names := m.cfg.BlocklistNames
+	loading := m.cfg.BlocklistLoading
+	auth := m.cfg.BlocklistAuth
 	m.cfgMu.RUnlock()
+	workers := loading.Concurrency
+
+	// Jitter spreads scheduled refreshes. Until a load has succeeded (the
+	// initial download, and the retries startup.fail_closed runs while
+	// queries are held) every source is fetched straight away.
+	if !m.IsReady() {
+		loading.Jitter = 0
+	}
 
 	if len(urls) == 0 {
-		return &FlatBlocklist{}, nil
+		return &FlatBlocklist{}, &FlatBlocklist{}, nil, nil
 	}
+	if workers <= 0 {
+		workers = defaultLoadConcurrency
+	}
+	workers = min(workers, len(urls))
 
-	m.logger.Info("Downloading blocklists", "count", len(urls))
+	if loading.Sequential {
+		workers = 1
+	}
+	m.logger.Info("Downloading blocklists", "count", len(urls), "concurrency", workers, "sequential", loading.Sequential)
 	startTime := time.Now()
 
-	lists := make([]sortedList, 0, len(urls))
+	// Size each source's parse buffer from its previous load, which is also
+	// the baseline for the shrink check
+	sizeHints := make(map[string]int)
+	for _, res := range m.SourceResults() {
+		sizeHints[res.URL] = res.Domains
+	}
+	now := time.Now()
+
+	if loading.Sequential {
+		return m.downloadSequential(ctx, peak, fetchTime, urls, names, auth, loading, sizeHints, now, startTime)
+	}
 
+	// Download and parse with a bounded pool. Results land in per-source
+	// slots so masks and SourceResults keep configuration order.
+	parsed := make([]*ParsedList, len(urls))
+	errs := make([]error, len(urls))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
 	for idx, url := range urls {
-		m.logger.Info("Downloading blocklist", "index", idx+1, "total", len(urls), "url", url)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Wait out the jitter before taking a slot so a delayed source
+			// doesn't keep another from downloading
+			if idx > 0 {
+				waitJitter(ctx, loading.Jitter)
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			m.logger.Info("Downloading blocklist", "index", idx+1, "total", len(urls), "url", url)
+
+			// downloadList returns deduplicated, sorted []string slices directly —
+			// no intermediate map[string]struct{} (saves ~60MB per 500K-domain list).
+			parsed[idx], errs[idx] = m.downloader.downloadList(ctx, url, sizeHints[url], auth[url])
+			peak.sample()
+			if errs[idx] != nil {
+				m.logger.Error("Failed to download blocklist", "url", url, "error", errs[idx])
+				return
+			}
+			m.logger.Info("Blocklist downloaded and sorted",
+				"index", idx+1, "domains", len(parsed[idx].Domains))
+		}()
+	}
+	wg.Wait()
+	*fetchTime = time.Since(startTime)
 
-		// DownloadSorted returns a deduplicated, sorted []string directly —
-		// no intermediate map[string]struct{} (saves ~60MB per 500K-domain list).
-		sorted, err := m.downloader.DownloadSorted(ctx, url)
-		if err != nil {
-			m.logger.Error("Failed to download blocklist", "url", url, "error", err)
+	lists := make([]sortedList, 0, len(urls))
+	var exceptionLists []sortedList
+	results := make([]SourceResult, 0, len(urls))
+	for idx, url := range urls {
+		if errs[idx] != nil {
+			results = append(results, SourceResult{URL: url, Name: strings.TrimSpace(names[url]), Error: errs[idx].Error()})
 			continue
 		}
 
-		var mask uint64
-		if idx < maxTrackedSources {
-			mask = 1 << uint(idx)
+		list, exceptions, result := m.acceptSource(idx, url, parsed[idx], names, sizeHints[url], loading, now)
+		lists = append(lists, list)
+		results = append(results, result)
+		if len(exceptions.domains) > 0 {
+			exceptionLists = append(exceptionLists, exceptions)
 		}
-
-		lists = append(lists, sortedList{domains: sorted, mask: mask})
-		m.logger.Info("Blocklist downloaded and sorted",
-			"index", idx+1, "domains", len(sorted))
 	}
+	parsed = nil //nolint:ineffassign
 
 	if len(urls) > maxTrackedSources {
 		m.logger.Warn("Tracking metadata for first 64 blocklist sources only", "configured", len(urls))
@@ -268,15 +481,224 @@ func (m *Manager) downloadAndMerge(ctx context.Context) (*FlatBlocklist, error)
 
 	m.logger.Info("Merging blocklists", "lists", len(lists))
 	flat := BuildFromSortedLists(lists)
+	exceptions := BuildFromSortedLists(exceptionLists)
+	// Every per-list slice and the merged output are live here
+	peak.sample()
 
 	// Release per-list slices
-	lists = nil //nolint:ineffassign
+	lists = nil          //nolint:ineffassign
+	exceptionLists = nil //nolint:ineffassign
 
 	m.logger.Info("All blocklists downloaded and merged",
 		"total_domains", flat.Len(),
+		"exceptions", exceptions.Len(),
 		"duration", time.Since(startTime))
 
-	return flat, nil
+	return flat, exceptions, results, nil
+}
+
+// downloadSequential is downloadAndMerge for blocklist_loading.sequential:
+// sources are fetched one at a time and each is folded into the merged
+// blocklist as soon as it is parsed, then released before the next download.
+// Peak memory is the merged list so far plus one source, instead of every
+// source at once, at the cost of a longer load and a re-merge per source.
+func (m *Manager) downloadSequential(ctx context.Context, peak *heapPeak, fetchTime *time.Duration, urls []string, names map[string]string, auth map[string]*config.BlocklistAuthConfig, loading config.BlocklistLoadingConfig, sizeHints map[string]int, now, startTime time.Time) (*FlatBlocklist, *FlatBlocklist, []SourceResult, error) {
+	flat, exceptions := &FlatBlocklist{}, &FlatBlocklist{}
+	results := make([]SourceResult, 0, len(urls))
+	for idx, url := range urls {
+		if idx > 0 {
+			waitJitter(ctx, loading.Jitter)
+		}
+		m.logger.Info("Downloading blocklist", "index", idx+1, "total", len(urls), "url", url)
+		fetchStart := time.Now()
+		parsed, err := m.downloader.downloadList(ctx, url, sizeHints[url], auth[url])
+		*fetchTime += time.Since(fetchStart)
+		peak.sample()
+		if err != nil {
+			m.logger.Error("Failed to download blocklist", "url", url, "error", err)
+			results = append(results, SourceResult{URL: url, Name: strings.TrimSpace(names[url]), Error: err.Error()})
+			continue
+		}
+		m.logger.Info("Blocklist downloaded and sorted",
+			"index", idx+1, "domains", len(parsed.Domains))
+
+		list, listExceptions, result := m.acceptSource(idx, url, parsed, names, sizeHints[url], loading, now)
+		results = append(results, result)
+		flat = flat.mergeSorted(list)
+		if len(listExceptions.domains) > 0 {
+			exceptions = exceptions.mergeSorted(listExceptions)
+		}
+		// The previous merged list and this source are both live here
+		peak.sample()
+
+		// Drop this source's buffers before the next download
+		parsed, list, listExceptions = nil, sortedList{}, sortedList{} //nolint:ineffassign
+		runtime.GC()
+	}
+
+	m.logger.Info("All blocklists downloaded and merged",
+		"total_domains", flat.Len(),
+		"exceptions", exceptions.Len(),
+		"duration", time.Since(startTime))
+
+	return flat, exceptions, results, nil
+}
+
+// waitJitter sleeps for a random delay up to jitter before a download,
+// returning early if ctx is cancelled.
+func waitJitter(ctx context.Context, jitter time.Duration) {
+	if jitter <= 0 {
+		return
+	}
+	t := time.NewTimer(rand.N(jitter))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
+
+// acceptSource turns a downloaded source into its merge inputs, applying the
+// shrink guard, and reports the source's result. Must be called with
+// updateMu held.
+func (m *Manager) acceptSource(idx int, url string, list *ParsedList, names map[string]string, sizeHint int, loading config.BlocklistLoadingConfig, now time.Time) (domains, exceptions sortedList, result SourceResult) {
+	var mask uint64
+	if idx < maxTrackedSources {
+		mask = 1 << uint(idx)
+	}
+
+	result = SourceResult{URL: url, Name: strings.TrimSpace(names[url]), Domains: len(list.Domains), Bytes: list.Bytes}
+	if held, reason := m.holdShrunk(url, list, sizeHint, loading, now); held != nil {
+		list = held
+		result.Domains, result.Held = len(held.Domains), reason
+	}
+	return sortedList{domains: list.Domains, mask: mask}, sortedList{domains: list.Exceptions, mask: mask}, result
+}
+
+// holdShrunk applies the shrink guard to a fresh download of url. When the
+// download has fewer than shrink_threshold of the previous domain count, and
+// has not stayed that small for shrink_grace, it returns the source's
+// domains from the current blocklist to use instead, with the reason.
+// Otherwise it returns nil and the download is used. Must be called with
+// updateMu held.
+func (m *Manager) holdShrunk(url string, fresh *ParsedList, previous int, loading config.BlocklistLoadingConfig, now time.Time) (*ParsedList, string) {
+	threshold := loading.ShrinkThresholdValue()
+	if previous == 0 || threshold <= 0 || float64(len(fresh.Domains)) >= threshold*float64(previous) {
+		delete(m.shrunkSince, url)
+		return nil, ""
+	}
+
+	grace := loading.ShrinkGrace
+	if grace <= 0 {
+		grace = config.DefaultBlocklistShrinkGrace
+	}
+	since, seen := m.shrunkSince[url]
+	if !seen {
+		since = now
+		m.shrunkSince[url] = now
+	}
+	if now.Sub(since) >= grace {
+		m.logger.Warn("Blocklist stayed smaller past the grace period, accepting it",
+			"url", url, "domains", len(fresh.Domains), "previous", previous, "since", since)
+		delete(m.shrunkSince, url)
+		return nil, ""
+	}
+
+	// The previous domains are recovered from the merged lists by source bit
+	names, _ := m.sourceNames.Load().([]string)
+	bit := -1
+	for i, name := range names {
+		if name == url {
+			bit = i
+			break
+		}
+	}
+	if bit < 0 {
+		m.logger.Warn("Blocklist shrank but its previous domains aren't tracked, accepting it",
+			"url", url, "domains", len(fresh.Domains), "previous", previous)
+		return nil, ""
+	}
+
+	held := &ParsedList{
+		Domains:    m.current.Load().sourceDomains(1 << uint(bit)),
+		Exceptions: m.exceptions.Load().sourceDomains(1 << uint(bit)),
+	}
+	reason := fmt.Sprintf("download had %d domains, under %.0f%% of the previous %d; keeping the previous list until %s",
+		len(fresh.Domains), threshold*100, previous, since.Add(grace).UTC().Format(time.RFC3339))
+	m.logger.Warn("Blocklist shrank sharply, keeping previous domains",
+		"url", url, "domains", len(fresh.Domains), "previous", previous,
+		"threshold", threshold, "accept_after", since.Add(grace))
+	return held, reason
+}
+
+// defaultLoadConcurrency is blocklist_loading.concurrency when unset: one
+// download at a time, the memory profile loads had before the worker pool.
+const defaultLoadConcurrency = 1
+
+// LoadStats describes the most recent successful blocklist load.
+type LoadStats struct {
+	Duration      time.Duration // download, parse, merge, and swap
+	PeakHeapBytes uint64        // largest live heap sampled during the load
+
+	// DownloadedBytes is the total size of every source fetched, and
+	// DownloadDuration the time spent fetching them: the whole download
+	// phase when sources load concurrently, the sum of the fetches when
+	// sequential.
+	DownloadedBytes  int64
+	DownloadDuration time.Duration
+}
+
+// DownloadRate returns the average download bandwidth of the load in bytes
+// per second, or 0 when nothing was downloaded.
+func (s LoadStats) DownloadRate() int64 {
+	if s.DownloadDuration <= 0 {
+		return 0
+	}
+	return int64(float64(s.DownloadedBytes) / s.DownloadDuration.Seconds())
+}
+
+// LastLoad returns timing and memory figures for the most recent successful
+// update, or a zero LoadStats before the first one.
+func (m *Manager) LastLoad() LoadStats {
+	if p := m.lastLoad.Load(); p != nil {
+		return *p
+	}
+	return LoadStats{}
+}
+
+// heapPeak tracks the largest live-heap size seen across samples, which are
+// taken as each source finishes parsing and after the merge, the points where
+// a load holds the most memory.
+type heapPeak struct {
+	bytes atomic.Uint64
+}
+
+func (p *heapPeak) sample() {
+	s := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	v := s[0].Value.Uint64()
+	for {
+		cur := p.bytes.Load()
+		if v <= cur || p.bytes.CompareAndSwap(cur, v) {
+			return
+		}
+	}
+}
+
+// SetOnUpdateFailure registers fn to be called when an update fails or some
+// sources could not be downloaded. fn runs on the updating goroutine and must
+// not block.
+func (m *Manager) SetOnUpdateFailure(fn func(err error)) {
+	m.onUpdateFailure.Store(&fn)
+}
+
+func (m *Manager) reportUpdateFailure(err error) {
+	if fn := m.onUpdateFailure.Load(); fn != nil && *fn != nil {
+		(*fn)(err)
+	}
 }
 
 // SetHTTPClient updates the HTTP client used for downloads.
@@ -289,6 +711,97 @@ func (m *Manager) UpdateConfig(cfg *config.Config) {
 	m.cfgMu.Lock()
 	m.cfg = cfg
 	m.cfgMu.Unlock()
+	m.refreshMatchModes()
+	m.refreshSourceLabels()
+	m.startRetryUntilReady()
+}
+
+// refreshMatchModes recomputes exactSources from blocklist_match and the
+// source order of the loaded lists. Sources past the 64 tracked ones can't be
+// told apart and always match as suffixes.
+func (m *Manager) refreshMatchModes() {
+	names, _ := m.sourceNames.Load().([]string)
+	m.cfgMu.RLock()
+	modes := m.cfg.BlocklistMatch
+	m.cfgMu.RUnlock()
+
+	var exact uint64
+	for idx, name := range names {
+		if modes[name] == config.BlocklistMatchExact {
+			exact |= 1 << uint(idx)
+		}
+	}
+	m.exactSources.Store(exact)
+}
+
+// refreshSourceLabels recomputes sourceLabels from blocklist_names.
+func (m *Manager) refreshSourceLabels() {
+	m.cfgMu.RLock()
+	names := m.cfg.BlocklistNames
+	m.cfgMu.RUnlock()
+
+	if len(names) == 0 {
+		m.sourceLabels.Store(nil)
+		return
+	}
+	labels := make(map[string]string, len(names))
+	for source, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			labels[source] = name
+		}
+	}
+	m.sourceLabels.Store(&labels)
+}
+
+// SourceLabel returns the blocklist_names entry for source, or source itself
+// when it has none.
+func (m *Manager) SourceLabel(source string) string {
+	if labels := m.sourceLabels.Load(); labels != nil {
+		if name, ok := (*labels)[source]; ok {
+			return name
+		}
+	}
+	return source
+}
+
+// labelSources returns the display name of each source, in order. Without
+// configured names it returns sources itself.
+func (m *Manager) labelSources(sources []string) []string {
+	labels := m.sourceLabels.Load()
+	if labels == nil || len(sources) == 0 {
+		return sources
+	}
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source
+		if name, ok := (*labels)[source]; ok {
+			names[i] = name
+		}
+	}
+	return names
+}
+
+// SourceInfo describes a configured blocklist source and its labels.
+type SourceInfo struct {
+	URL         string `json:"url"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+}
+
+// SourceInfos returns the blocklist sources in cfg with their configured
+// name, description and category, in configuration order.
+func SourceInfos(cfg *config.Config) []SourceInfo {
+	infos := make([]SourceInfo, 0, len(cfg.Blocklists))
+	for _, url := range cfg.Blocklists {
+		infos = append(infos, SourceInfo{
+			URL:         url,
+			Name:        strings.TrimSpace(cfg.BlocklistNames[url]),
+			Description: strings.TrimSpace(cfg.BlocklistDescriptions[url]),
+			Category:    strings.TrimSpace(cfg.BlocklistCategories[url]),
+		})
+	}
+	return infos
 }
 
 // SetLogger updates the logger used by the manager and downloader.
@@ -335,10 +848,13 @@ func (m *Manager) IsBlocked(domain string) bool {
 
 // MatchResult describes how a domain was blocked.
 type MatchResult struct {
-	Blocked bool
-	Kind    string   // exact, subdomain, wildcard, regex
-	Pattern string   // for wildcard/regex
-	Sources []string // blocklist sources
+	Blocked     bool
+	Kind        string   // exact, subdomain, wildcard, regex
+	Entry       string   // listed domain that matched, without trailing dot (exact/subdomain)
+	Pattern     string   // for wildcard/regex
+	Sources     []string // blocklist sources
+	Names       []string // display name of each entry in Sources (blocklist_names, else the source)
+	Specificity int      // pattern.DomainSpecificity of the matched entry (0 for regex)
 }
 
 // Match returns detailed information about a blocked domain.
@@ -348,21 +864,29 @@ func (m *Manager) Match(domain string) MatchResult {
 		return MatchResult{}
 	}
 
-	// Wire-format DNS names already have a trailing dot; dns.Fqdn is redundant.
-	// Only ToLower is needed since RFC 1035 preserves case on the wire.
-	fqdn := strings.ToLower(domain)
-	if fqdn[len(fqdn)-1] != '.' {
-		fqdn += "." // defensive: shouldn't happen for wire-parsed names
+	// Wire-format names are lowercase ASCII FQDNs in practice, which
+	// NormalizeFQDN returns as-is; API callers may pass Unicode names.
+	fqdn := pattern.NormalizeFQDN(domain)
+	if fqdn == "" {
+		return MatchResult{}
 	}
 	short := fqdn[:len(fqdn)-1]
 
 	flat := m.current.Load()
-	if flat != nil && flat.Len() > 0 {
-		if mask, kind, ok := flat.LookupSubdomains(fqdn); ok {
+	if flat != nil && flat.Len() > 0 && !m.isException(fqdn) {
+		if mask, entry, ok := flat.lookupSuffix(fqdn, m.exactSources.Load()); ok {
+			kind := "subdomain"
+			if entry == fqdn {
+				kind = "exact"
+			}
+			sources := m.sourcesFromMask(mask)
 			return MatchResult{
-				Blocked: true,
-				Kind:    kind,
-				Sources: m.sourcesFromMask(mask),
+				Blocked:     true,
+				Kind:        kind,
+				Entry:       entry[:len(entry)-1],
+				Sources:     sources,
+				Names:       m.labelSources(sources),
+				Specificity: pattern.DomainSpecificity(entry, entry == fqdn),
 			}
 		}
 	}
@@ -370,10 +894,12 @@ func (m *Manager) Match(domain string) MatchResult {
 	if patterns := m.patterns.Load(); patterns != nil {
 		if matched, ok := patterns.MatchPattern(short); ok && matched != nil {
 			return MatchResult{
-				Blocked: true,
-				Kind:    matched.Type.String(),
-				Pattern: matched.Raw,
-				Sources: []string{"pattern"},
+				Blocked:     true,
+				Kind:        matched.Type.String(),
+				Pattern:     matched.Raw,
+				Sources:     []string{"pattern"},
+				Names:       []string{"pattern"},
+				Specificity: matched.Specificity(),
 			}
 		}
 	}
@@ -381,6 +907,23 @@ func (m *Manager) Match(domain string) MatchResult {
 	return MatchResult{}
 }
 
+// isException reports whether fqdn, or one of its parents, is listed in an
+// "@@" exception rule.
+func (m *Manager) isException(fqdn string) bool {
+	exceptions := m.exceptions.Load()
+	if exceptions == nil || exceptions.Len() == 0 {
+		return false
+	}
+	_, _, ok := exceptions.LookupSubdomainsEntry(fqdn)
+	return ok
+}
+
+// ExceptionCount returns the number of "@@" exception domains loaded from
+// the blocklists.
+func (m *Manager) ExceptionCount() int {
+	return m.exceptions.Load().Len()
+}
+
 // Size returns the number of blocked domains (exact matches only)
 func (m *Manager) Size() int {
 	flat := m.current.Load()
@@ -415,6 +958,26 @@ func (m *Manager) SetPatterns(patternList []string) error {
 	return nil
 }
 
+// Ready returns a channel that is closed once a blocklist load has produced
+// domains from at least one source, or found no sources configured.
+func (m *Manager) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// IsReady reports whether Ready is closed.
+func (m *Manager) IsReady() bool {
+	select {
+	case <-m.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *Manager) markReady() {
+	m.readyOnce.Do(func() { close(m.ready) })
+}
+
 // LastUpdated returns the timestamp of the most recent successful update.
 func (m *Manager) LastUpdated() time.Time {
 	if v := m.lastUpdated.Load(); v != nil {
@@ -428,7 +991,8 @@ func (m *Manager) LastUpdated() time.Time {
 // Stats returns statistics about the blocklist
 func (m *Manager) Stats() map[string]int {
 	stats := map[string]int{
-		"exact": m.Size(),
+		"exact":      m.Size(),
+		"exceptions": m.ExceptionCount(),
 	}
 
 	patterns := m.patterns.Load()
@@ -480,6 +1044,56 @@ func (m *Manager) sourcesFromMask(mask uint64) []string {
 	return result
 }
 
+// startupRetryInterval is how often a failed initial load is retried while
+// startup.fail_closed holds queries.
+const startupRetryInterval = 30 * time.Second
+
+// startRetryUntilReady starts retryUntilReady when startup.fail_closed is on
+// and no load has succeeded yet. Start calls it after the initial download,
+// and UpdateConfig again because a reload can turn fail_closed on after that
+// download failed. At most one retry loop runs at a time.
+func (m *Manager) startRetryUntilReady() {
+	m.cfgMu.RLock()
+	failClosed := m.cfg.Startup.FailClosed
+	ctx := m.runCtx
+	m.cfgMu.RUnlock()
+	if !failClosed || ctx == nil || !m.started.Load() || m.IsReady() {
+		return
+	}
+	if !m.retrying.CompareAndSwap(false, true) {
+		return
+	}
+	m.wg.Add(1)
+	go m.retryUntilReady(ctx, m.retryInterval)
+}
+
+// retryUntilReady retries the download every interval until a load succeeds.
+func (m *Manager) retryUntilReady(ctx context.Context, interval time.Duration) {
+	defer m.wg.Done()
+	defer m.retrying.Store(false)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		case <-m.ready:
+			return
+		case <-ticker.C:
+			m.logger.Info("Retrying initial blocklist download")
+			updateCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			if err := m.Update(updateCtx); err != nil {
+				m.logger.Error("Blocklist download retry failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
 // updateLoop runs the automatic update loop
 func (m *Manager) updateLoop(ctx context.Context) {
 	defer m.wg.Done()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -97,6 +99,352 @@ func TestManager_Update(t *testing.T) {
 	}
 }
 
+func TestManager_Update_ReportsFailedSources(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0.0.0.0 ads.example.com\n"))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer bad.Close()
+
+	m := NewManager(&config.Config{Blocklists: []string{good.URL, bad.URL}}, logging.NewDefault(), nil, nil)
+	var reported []error
+	m.SetOnUpdateFailure(func(err error) { reported = append(reported, err) })
+
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Expected partial update to succeed, got %v", err)
+	}
+	if m.Size() != 1 {
+		t.Errorf("Expected 1 domain from the good source, got %d", m.Size())
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), bad.URL) {
+		t.Errorf("Expected one failure naming %s, got %v", bad.URL, reported)
+	}
+}
+
+func TestManager_Update_Sequential(t *testing.T) {
+	ads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0.0.0.0 ads.example.com\n0.0.0.0 both.example.com\n"))
+	}))
+	defer ads.Close()
+	tracking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("||track.example.com^\n||both.example.com^\n@@||ok.track.example.com^\n"))
+	}))
+	defer tracking.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer bad.Close()
+
+	cfg := &config.Config{
+		Blocklists:       []string{ads.URL, bad.URL, tracking.URL},
+		BlocklistLoading: config.BlocklistLoadingConfig{Sequential: true},
+	}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if m.Size() != 3 {
+		t.Errorf("Expected 3 distinct domains, got %d", m.Size())
+	}
+	if match := m.Match("both.example.com"); !match.Blocked || len(match.Sources) != 2 {
+		t.Errorf("Expected both.example.com from both sources, got %+v", match)
+	}
+	if match := m.Match("ok.track.example.com"); match.Blocked {
+		t.Error("Expected the exception to un-block ok.track.example.com")
+	}
+	results := m.SourceResults()
+	if len(results) != 3 || results[1].Error == "" || results[2].Domains != 2 {
+		t.Errorf("Unexpected source results: %+v", results)
+	}
+	if m.LastLoad().PeakHeapBytes == 0 {
+		t.Error("Expected peak heap to be sampled during a sequential load")
+	}
+}
+
+func TestManager_Ready(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("0.0.0.0 ads.example.com\n"))
+	}))
+	defer server.Close()
+
+	m := NewManager(&config.Config{Blocklists: []string{server.URL}}, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if m.IsReady() {
+		t.Fatal("a load where every source failed should not mark the blocklist ready")
+	}
+
+	// retryUntilReady keeps trying until a source loads
+	failing.Store(false)
+	m.wg.Add(1)
+	go m.retryUntilReady(context.Background(), 10*time.Millisecond)
+	select {
+	case <-m.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry did not load the blocklist")
+	}
+	m.wg.Wait()
+	if m.Size() != 1 {
+		t.Errorf("Expected 1 domain after retry, got %d", m.Size())
+	}
+
+	// Turning startup.fail_closed on by reload after a failed initial load
+	// starts the retry loop too.
+	failing.Store(true)
+	cfg := &config.Config{Blocklists: []string{server.URL}}
+	reloaded := NewManager(cfg, logging.NewDefault(), nil, nil)
+	reloaded.retryInterval = 10 * time.Millisecond
+	if err := reloaded.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer reloaded.Stop()
+	if reloaded.IsReady() {
+		t.Fatal("expected the initial load to fail")
+	}
+	failing.Store(false)
+	failClosed := *cfg
+	failClosed.Startup.FailClosed = true
+	reloaded.UpdateConfig(&failClosed)
+	select {
+	case <-reloaded.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("enabling fail_closed by reload did not retry the load")
+	}
+
+	empty := NewManager(&config.Config{}, logging.NewDefault(), nil, nil)
+	if err := empty.Update(context.Background()); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !empty.IsReady() {
+		t.Error("a manager without sources should be ready after its first update")
+	}
+}
+
+func TestManager_Update_ConcurrentSources(t *testing.T) {
+	var inflight, maxInflight atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			cur := maxInflight.Load()
+			if n <= cur || maxInflight.CompareAndSwap(cur, n) {
+				break
+			}
+		}
+		<-release
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Every source lists shared.example.com plus one of its own
+		_, _ = w.Write([]byte("0.0.0.0 shared.example.com\n0.0.0.0 only" + strings.TrimPrefix(r.URL.Path, "/") + ".example.com\n"))
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a", server.URL + "/missing", server.URL + "/b", server.URL + "/c", server.URL + "/d"}
+	cfg := &config.Config{
+		Blocklists:       urls,
+		BlocklistLoading: config.BlocklistLoadingConfig{Concurrency: 2},
+	}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- m.Update(context.Background()) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for inflight.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // a third download would show up here
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if got := maxInflight.Load(); got != 2 {
+		t.Errorf("max concurrent downloads = %d, want 2", got)
+	}
+	if m.Size() != 5 {
+		t.Errorf("Expected 5 domains, got %d", m.Size())
+	}
+
+	// Results and source masks follow configuration order
+	results := m.SourceResults()
+	if len(results) != len(urls) {
+		t.Fatalf("Expected %d results, got %d", len(urls), len(results))
+	}
+	for i, res := range results {
+		if res.URL != urls[i] {
+			t.Errorf("result %d is %s, want %s", i, res.URL, urls[i])
+		}
+	}
+	if results[1].Error == "" || results[2].Domains != 2 {
+		t.Errorf("unexpected results %+v", results)
+	}
+	match := m.Match("onlyc.example.com.")
+	if len(match.Sources) != 1 || match.Sources[0] != urls[3] {
+		t.Errorf("onlyc sources = %v, want [%s]", match.Sources, urls[3])
+	}
+	if match := m.Match("shared.example.com."); len(match.Sources) != 4 {
+		t.Errorf("shared sources = %v, want all four good sources", match.Sources)
+	}
+
+	if load := m.LastLoad(); load.Duration <= 0 || load.PeakHeapBytes == 0 {
+		t.Errorf("LastLoad() = %+v, want duration and peak heap", load)
+	}
+
+	// Bandwidth: each good source served one body, the missing one nothing
+	var want int64
+	for _, name := range []string{"a", "b", "c", "d"} {
+		want += int64(len("0.0.0.0 shared.example.com\n0.0.0.0 only" + name + ".example.com\n"))
+	}
+	if results[0].Bytes == 0 || results[1].Bytes != 0 {
+		t.Errorf("unexpected per-source bytes %+v", results)
+	}
+	if load := m.LastLoad(); load.DownloadedBytes != want || load.DownloadDuration <= 0 || load.DownloadRate() <= 0 {
+		t.Errorf("LastLoad() = %+v, want %d bytes downloaded", load, want)
+	}
+}
+
+func TestManager_Update_Jitter(t *testing.T) {
+	var mu sync.Mutex
+	var arrivals []time.Duration
+	start := time.Now()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Since(start))
+		mu.Unlock()
+		_, _ = w.Write([]byte("0.0.0.0 ads" + strings.TrimPrefix(r.URL.Path, "/") + ".example.com\n"))
+	}))
+	defer server.Close()
+
+	const jitter = 100 * time.Millisecond
+	cfg := &config.Config{
+		Blocklists:       []string{server.URL + "/1", server.URL + "/2", server.URL + "/3"},
+		BlocklistLoading: config.BlocklistLoadingConfig{Concurrency: 1, Jitter: time.Hour},
+	}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+
+	// The initial load isn't delayed
+	initialStart := time.Now()
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if elapsed := time.Since(initialStart); elapsed > 10*time.Second {
+		t.Errorf("initial load took %v, jitter should be skipped", elapsed)
+	}
+	if m.Size() != 3 {
+		t.Errorf("Expected 3 domains, got %d", m.Size())
+	}
+
+	// Later loads are, and each source sleeps before taking its slot
+	m.UpdateConfig(&config.Config{
+		Blocklists:       cfg.Blocklists,
+		BlocklistLoading: config.BlocklistLoadingConfig{Concurrency: 1, Jitter: jitter},
+	})
+	mu.Lock()
+	arrivals = nil
+	start = time.Now()
+	mu.Unlock()
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(arrivals) != 3 {
+		t.Fatalf("expected 3 downloads, got %d", len(arrivals))
+	}
+	for _, at := range arrivals {
+		if at > jitter+time.Second {
+			t.Errorf("download started %v after the update, past the %v jitter", at, jitter)
+		}
+	}
+
+	// A cancelled update doesn't sit out the delay
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	waitStart := time.Now()
+	waitJitter(ctx, time.Hour)
+	if elapsed := time.Since(waitStart); elapsed > time.Second {
+		t.Errorf("waitJitter ignored cancellation, waited %v", elapsed)
+	}
+}
+
+func TestManager_Update_HoldsShrunkSource(t *testing.T) {
+	var body atomic.Value
+	full := "0.0.0.0 a.example.com\n0.0.0.0 b.example.com\n0.0.0.0 c.example.com\n0.0.0.0 d.example.com\n@@||ok.a.example.com^\n"
+	body.Store(full)
+	shrinking := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer shrinking.Close()
+	steady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0.0.0.0 steady.example.net\n"))
+	}))
+	defer steady.Close()
+
+	cfg := &config.Config{Blocklists: []string{steady.URL, shrinking.URL}}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	// A provider error page parses to one domain: keep the previous four
+	body.Store("<html>oops</html>\n0.0.0.0 a.example.com\n")
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if m.Size() != 5 || !m.IsBlocked("d.example.com.") || m.IsBlocked("ok.a.example.com.") {
+		t.Errorf("previous domains and exceptions not kept: size %d", m.Size())
+	}
+	res := m.SourceResults()[1]
+	if res.Held == "" || res.Domains != 4 {
+		t.Errorf("result = %+v, want held with the previous 4 domains", res)
+	}
+	if match := m.Match("b.example.com."); len(match.Sources) != 1 || match.Sources[0] != shrinking.URL {
+		t.Errorf("held domain sources = %v", match.Sources)
+	}
+
+	// Once the grace period has passed the smaller list is accepted
+	m.shrunkSince[shrinking.URL] = time.Now().Add(-config.DefaultBlocklistShrinkGrace)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if m.Size() != 2 || m.IsBlocked("d.example.com.") {
+		t.Errorf("shrunk list not accepted after grace: size %d", m.Size())
+	}
+	if res := m.SourceResults()[1]; res.Held != "" || res.Domains != 1 {
+		t.Errorf("result = %+v, want accepted with 1 domain", res)
+	}
+
+	// A threshold of 0 turns the check off
+	body.Store(full)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	off := 0.0
+	m.UpdateConfig(&config.Config{Blocklists: cfg.Blocklists, BlocklistLoading: config.BlocklistLoadingConfig{ShrinkThreshold: &off}})
+	body.Store("0.0.0.0 a.example.com\n")
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if m.Size() != 2 {
+		t.Errorf("size with the check off = %d, want 2", m.Size())
+	}
+}
+
 func TestManager_Update_NoBlocklists(t *testing.T) {
 	cfg := &config.Config{
 		Blocklists: []string{},
@@ -321,6 +669,95 @@ func TestManager_MatchPattern(t *testing.T) {
 	}
 }
 
+func TestManager_MatchSpecificity(t *testing.T) {
+	cfg := &config.Config{}
+	logger := logging.NewDefault()
+	m := NewManager(cfg, logger, nil, nil)
+	m.SetDomainsForTest([]string{"example.com.", "ads.tracker.net."})
+	if err := m.SetPatterns([]string{"*.cdn.org"}); err != nil {
+		t.Fatalf("SetPatterns failed: %v", err)
+	}
+
+	exact := m.Match("example.com.")
+	sub := m.Match("ads.example.com.")
+	deep := m.Match("ads.tracker.net.")
+	wild := m.Match("img.cdn.org.")
+
+	if !exact.Blocked || !sub.Blocked || !deep.Blocked || !wild.Blocked {
+		t.Fatal("expected all domains to be blocked")
+	}
+	if exact.Specificity <= sub.Specificity {
+		t.Errorf("exact match (%d) should be more specific than parent match (%d)", exact.Specificity, sub.Specificity)
+	}
+	if deep.Specificity <= exact.Specificity {
+		t.Errorf("deeper exact entry (%d) should outrank shallower one (%d)", deep.Specificity, exact.Specificity)
+	}
+	if wild.Specificity != sub.Specificity {
+		t.Errorf("*.cdn.org (%d) and subtree example.com (%d) should score the same", wild.Specificity, sub.Specificity)
+	}
+}
+
+func TestManager_ExactMatchSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/exact":
+			_, _ = w.Write([]byte("0.0.0.0 example.com\n0.0.0.0 shared.net\n"))
+		default:
+			_, _ = w.Write([]byte("0.0.0.0 other.org\n0.0.0.0 shared.net\n"))
+		}
+	}))
+	defer server.Close()
+
+	exactURL, suffixURL := server.URL+"/exact", server.URL+"/suffix"
+	cfg := &config.Config{
+		Blocklists:     []string{exactURL, suffixURL},
+		BlocklistMatch: map[string]string{exactURL: config.BlocklistMatchExact},
+	}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if !m.IsBlocked("example.com.") {
+		t.Error("exact source should block the listed name")
+	}
+	if m.IsBlocked("ads.example.com.") {
+		t.Error("exact source should not block subdomains")
+	}
+	if match := m.Match("cdn.other.org."); !match.Blocked || match.Kind != "subdomain" {
+		t.Errorf("suffix source should block subdomains, got %+v", match)
+	}
+
+	// A parent on both kinds of list matches through the suffix source only
+	match := m.Match("a.shared.net.")
+	if !match.Blocked || len(match.Sources) != 1 || match.Sources[0] != suffixURL {
+		t.Errorf("a.shared.net. = %+v, want blocked by %s alone", match, suffixURL)
+	}
+	if match := m.Match("shared.net."); len(match.Sources) != 2 {
+		t.Errorf("shared.net. sources = %v, want both", match.Sources)
+	}
+
+	// Modes apply on config change without a re-download
+	m.UpdateConfig(&config.Config{Blocklists: cfg.Blocklists})
+	if !m.IsBlocked("ads.example.com.") {
+		t.Error("dropping the exact mode should make example.com a suffix entry again")
+	}
+}
+
+func TestManager_MatchUnicodeQuery(t *testing.T) {
+	m := NewManager(&config.Config{}, logging.NewDefault(), nil, nil)
+	m.SetDomainsForTest([]string{"xn--mnchen-3ya.de."})
+	if err := m.SetPatterns([]string{"*.köln.de"}); err != nil {
+		t.Fatalf("SetPatterns failed: %v", err)
+	}
+
+	for _, domain := range []string{"München.de.", "xn--mnchen-3ya.de.", "www.xn--kln-sna.de.", "www.köln.de"} {
+		if !m.Match(domain).Blocked {
+			t.Errorf("expected %q to be blocked", domain)
+		}
+	}
+}
+
 func TestManager_Size(t *testing.T) {
 	// Create test HTTP server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -478,3 +915,91 @@ func TestManager_ConcurrentAccess(t *testing.T) {
 
 	// No data races should occur
 }
+
+func TestManager_AdblockExceptions(t *testing.T) {
+	blocks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("||example.com^\n||ads.example.org^\n"))
+	}))
+	defer blocks.Close()
+	// Exceptions apply across lists, not just the list that declares them.
+	allows := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("@@||cdn.example.com^\n"))
+	}))
+	defer allows.Close()
+
+	m := NewManager(&config.Config{Blocklists: []string{blocks.URL, allows.URL}}, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	tests := map[string]bool{
+		"example.com.":          true,
+		"www.example.com.":      true,
+		"cdn.example.com.":      false,
+		"img.cdn.example.com.":  false,
+		"ads.example.org.":      true,
+		"unrelated.example.net": false,
+	}
+	for domain, want := range tests {
+		if got := m.IsBlocked(domain); got != want {
+			t.Errorf("IsBlocked(%q) = %v, want %v", domain, got, want)
+		}
+	}
+	if got := m.Stats()["exceptions"]; got != 1 {
+		t.Errorf("Stats()[exceptions] = %d, want 1", got)
+	}
+}
+
+func TestManager_Update_BlocklistAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/basic":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "glory" || pass != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		case "/token":
+			if r.Header.Get("Authorization") != "Bearer tok" || r.Header.Get("X-Tenant") != "home" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("0.0.0.0 private" + strings.TrimPrefix(r.URL.Path, "/") + ".example.com\n"))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Blocklists: []string{server.URL + "/basic", server.URL + "/token", server.URL + "/open"},
+		BlocklistAuth: map[string]*config.BlocklistAuthConfig{
+			server.URL + "/basic": {Username: "glory", Password: "s3cret"},
+			server.URL + "/token": {BearerToken: "tok", Headers: map[string]string{"X-Tenant": "home"}},
+		},
+	}
+	m := NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if !m.IsBlocked("privatebasic.example.com") || !m.IsBlocked("privatetoken.example.com") {
+		t.Error("expected both authenticated sources to load")
+	}
+	results := m.SourceResults()
+	if len(results) != 3 || results[0].Error != "" || results[1].Error != "" {
+		t.Fatalf("unexpected source results: %+v", results)
+	}
+	if !strings.Contains(results[2].Error, "401") || !strings.Contains(results[2].Error, "no blocklist_auth") {
+		t.Errorf("expected an unauthenticated 401 error, got %q", results[2].Error)
+	}
+
+	// Wrong credentials are reported as rejected
+	cfg.BlocklistAuth[server.URL+"/basic"] = &config.BlocklistAuthConfig{Username: "glory", Password: "wrong"}
+	if err := m.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if res := m.SourceResults()[0]; !strings.Contains(res.Error, "credentials rejected") {
+		t.Errorf("expected rejected credentials, got %+v", res)
+	}
+}
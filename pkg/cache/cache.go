@@ -5,6 +5,8 @@ package cache
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -48,6 +50,23 @@ type cacheEntry struct {
 	// When this entry was last accessed (for LRU eviction) - 8 bytes
 	// Stored as UnixNano for atomic operations without lock contention on cache hits
 	lastAccessNano int64
+
+	// Set once a caller has claimed this entry's background refresh, so only
+	// one refresh runs per entry. The refreshed response replaces the entry.
+	refreshing atomic.Bool
+}
+
+// claimRefresh reports whether entry is due for a stale-while-revalidate
+// refresh at now and marks it as claimed. Entries carrying a trace come from
+// policy or blocklist decisions and are never refreshed upstream.
+func (e *cacheEntry) claimRefresh(now time.Time, window time.Duration) bool {
+	if window <= 0 || len(e.blockTrace) > 0 {
+		return false
+	}
+	if now.After(e.expiresAt) || e.expiresAt.Sub(now) > window {
+		return false
+	}
+	return e.refreshing.CompareAndSwap(false, true)
 }
 
 // cacheStats tracks cache performance metrics using atomic operations.
@@ -130,7 +149,7 @@ func (c *Cache) GetWithTrace(ctx context.Context, r *dns.Msg) (*dns.Msg, []stora
 		return nil, nil
 	}
 
-	key := c.makeMsgKey(r)
+	key := c.makeMsgKey(ctx, r)
 
 	c.mu.RLock()
 	entry, found := c.entries[key]
@@ -168,6 +187,20 @@ func (c *Cache) GetWithTrace(ctx context.Context, r *dns.Msg) (*dns.Msg, []stora
 	return entry.msg.Copy(), cloneBlockTrace(entry.blockTrace)
 }
 
+// ClaimRefresh reports whether the entry for r should be refreshed in the
+// background. See Interface.ClaimRefresh.
+func (c *Cache) ClaimRefresh(ctx context.Context, r *dns.Msg) bool {
+	if !c.cfg.Enabled || c.cfg.StaleWhileRevalidate <= 0 || len(r.Question) == 0 {
+		return false
+	}
+
+	c.mu.RLock()
+	entry, found := c.entries[c.makeMsgKey(ctx, r)]
+	c.mu.RUnlock()
+
+	return found && entry.claimRefresh(time.Now(), c.cfg.StaleWhileRevalidate)
+}
+
 // Set stores a DNS response in the cache with appropriate TTL.
 func (c *Cache) Set(ctx context.Context, r *dns.Msg, resp *dns.Msg) {
 	if !c.cfg.Enabled {
@@ -179,7 +212,7 @@ func (c *Cache) Set(ctx context.Context, r *dns.Msg, resp *dns.Msg) {
 	}
 
 	question := r.Question[0]
-	key := c.makeMsgKey(r)
+	key := c.makeMsgKey(ctx, r)
 
 	// Determine TTL from response
 	ttl := c.determineTTL(resp)
@@ -237,7 +270,7 @@ func (c *Cache) SetWithTrace(ctx context.Context, r *dns.Msg, resp *dns.Msg, tra
 	}
 
 	question := r.Question[0]
-	key := c.makeMsgKey(r)
+	key := c.makeMsgKey(ctx, r)
 
 	// Determine TTL from response (normal TTL, not BlockedTTL)
 	ttl := c.determineTTL(resp)
@@ -282,6 +315,12 @@ func (c *Cache) SetWithTrace(ctx context.Context, r *dns.Msg, resp *dns.Msg, tra
 // This is used for domains blocked by policy engine or blocklist to avoid
 // repeating the blocking logic on every query
 func (c *Cache) SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry) {
+	c.SetBlockedWithTTL(ctx, r, resp, trace, c.cfg.BlockedTTL)
+}
+
+// SetBlockedWithTTL is SetBlocked with an explicit TTL, used when the
+// blocking source has its own TTL. A ttl <= 0 skips caching.
+func (c *Cache) SetBlockedWithTTL(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry, ttl time.Duration) {
 	if !c.cfg.Enabled {
 		return
 	}
@@ -291,10 +330,8 @@ func (c *Cache) SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace
 	}
 
 	question := r.Question[0]
-	key := c.makeMsgKey(r)
+	key := c.makeMsgKey(ctx, r)
 
-	// Use configured blocked TTL
-	ttl := c.cfg.BlockedTTL
 	if ttl <= 0 {
 		// Don't cache if BlockedTTL is disabled
 		return
@@ -340,8 +377,9 @@ func (c *Cache) SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace
 
 // makeMsgKey creates a cache key from a DNS request message.
 // Includes domain, query type, and DNSSEC flags (DO/CD) to prevent serving
-// a non-DNSSEC response to a DNSSEC-expecting client or vice versa.
-func (c *Cache) makeMsgKey(r *dns.Msg) string {
+// a non-DNSSEC response to a DNSSEC-expecting client or vice versa, and the
+// scope from ctx (see WithScope).
+func (c *Cache) makeMsgKey(ctx context.Context, r *dns.Msg) string {
 	if len(r.Question) == 0 {
 		return ""
 	}
@@ -350,12 +388,14 @@ func (c *Cache) makeMsgKey(r *dns.Msg) string {
 	if opt := r.IsEdns0(); opt != nil {
 		do = opt.Do()
 	}
-	return cacheKey(q.Name, q.Qtype, do, r.CheckingDisabled)
+	return cacheKey(q.Name, q.Qtype, do, r.CheckingDisabled, ClientSubnet(r), ScopeFrom(ctx))
 }
 
 // cacheKey builds the key string. Shared between Cache and ShardedCache.
-// Format: "domain:qtype[:D][:C]" where D=DO set, C=CD set.
-func cacheKey(domain string, qtype uint16, do, cd bool) string {
+// Format: "domain:qtype[:D][:C][:S<subnet>][@scope]" where D=DO set, C=CD
+// set and subnet is the query's EDNS Client Subnet. The domain is lowercased
+// so mixed-case (0x20) queries share one entry.
+func cacheKey(domain string, qtype uint16, do, cd bool, ecs, scope string) string {
 	var buf [5]byte
 	i := len(buf)
 	q := qtype
@@ -367,16 +407,60 @@ func cacheKey(domain string, qtype uint16, do, cd bool) string {
 			break
 		}
 	}
-	key := domain + ":" + string(buf[i:])
+	key := strings.ToLower(domain) + ":" + string(buf[i:])
 	if do {
 		key += ":D"
 	}
 	if cd {
 		key += ":C"
 	}
+	if ecs != "" {
+		key += ":S" + ecs
+	}
+	if scope != "" {
+		key += "@" + scope
+	}
 	return key
 }
 
+type scopeKey struct{}
+
+// WithScope returns a context whose cache lookups and stores use entries of
+// their own, separate from other scopes and from the shared entries used
+// without a scope. The DNS handler scopes clients in a client group by their
+// groups (cache.per_client_group), so an answer shaped by one group's rules
+// is never served to another. An empty scope returns ctx unchanged.
+func WithScope(ctx context.Context, scope string) context.Context {
+	if scope == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ClientSubnet returns the EDNS Client Subnet option of r as
+// "address/source-prefix", or "" when r has none. The DNS handler strips
+// client ECS unless forwarder.forward_client_subnet is on; when it is, an
+// upstream may tailor its answer to the subnet, so the subnet is part of the
+// cache key and answers are never shared between subnets.
+func ClientSubnet(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return subnet.Address.String() + "/" + strconv.Itoa(int(subnet.SourceNetmask))
+		}
+	}
+	return ""
+}
+
+// ScopeFrom returns the cache scope of ctx, or "" for the shared entries.
+func ScopeFrom(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	return scope
+}
+
 // determineTTL extracts TTL from DNS response and applies min/max limits
 func (c *Cache) determineTTL(resp *dns.Msg) time.Duration {
 	// For negative responses (NXDOMAIN, NODATA), use negative TTL
@@ -459,6 +543,7 @@ func (c *Cache) evictLRU() {
 	// Record cache size decrease to Prometheus metrics if available
 	if c.metrics != nil {
 		c.metrics.CacheSize.Add(context.Background(), -1)
+		c.metrics.AddCacheEvictions(context.Background(), telemetry.CacheEvictionLRU, 1)
 	}
 
 	c.logger.Debug("Evicted LRU cache entry (sampled)", "key", key)
@@ -504,6 +589,7 @@ func (c *Cache) cleanup() {
 		// (previously only decremented on LRU eviction and Clear).
 		if c.metrics != nil {
 			c.metrics.CacheSize.Add(context.Background(), int64(-removed))
+			c.metrics.AddCacheEvictions(context.Background(), telemetry.CacheEvictionExpired, int64(removed))
 		}
 
 		c.logger.Debug("Cleaned up expired cache entries", "removed", removed, "remaining", c.stats.entries)
@@ -2,11 +2,13 @@ package cache
 
 import (
 	"context"
+	"net"
 	"testing"
 	"time"
 
 	"glory-hole/pkg/config"
 	"glory-hole/pkg/logging"
+	"glory-hole/pkg/storage"
 
 	"github.com/miekg/dns"
 )
@@ -183,6 +185,53 @@ func TestCache_SetAndGet(t *testing.T) {
 	}
 }
 
+func TestCache_CaseInsensitiveKey(t *testing.T) {
+	cache, err := New(testCacheConfig(), testLogger(t), nil)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	ctx := context.Background()
+	cache.Set(ctx, testQuery("Example.COM", dns.TypeA), testResponse("Example.COM", dns.TypeA, 300))
+
+	if cached := cache.Get(ctx, testQuery("eXAMPLE.com", dns.TypeA)); cached == nil {
+		t.Fatal("Get() missed an entry stored under a different case")
+	}
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Errorf("Expected 1 entry, got %d", stats.Entries)
+	}
+}
+
+func TestCache_ClientSubnetKey(t *testing.T) {
+	cache, err := New(testCacheConfig(), testLogger(t), nil)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	withSubnet := func(addr string, prefix uint8) *dns.Msg {
+		q := testQuery("example.com", dns.TypeA)
+		q.SetEdns0(1232, false)
+		opt := q.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: prefix, Address: net.ParseIP(addr).To4()})
+		return q
+	}
+
+	ctx := context.Background()
+	cache.Set(ctx, withSubnet("192.0.2.0", 24), testResponse("example.com", dns.TypeA, 300))
+
+	if cache.Get(ctx, withSubnet("192.0.2.0", 24)) == nil {
+		t.Error("Get() missed an entry for the same client subnet")
+	}
+	if cache.Get(ctx, withSubnet("198.51.100.0", 24)) != nil {
+		t.Error("an answer for one client subnet was served to another")
+	}
+	if cache.Get(ctx, testQuery("example.com", dns.TypeA)) != nil {
+		t.Error("an answer for a client subnet was served to a query without one")
+	}
+}
+
 func TestCache_Miss(t *testing.T) {
 	logger := testLogger(t)
 	cfg := testCacheConfig()
@@ -739,6 +788,38 @@ func TestSetBlocked_ZeroTTL(t *testing.T) {
 	}
 }
 
+// TestSetBlockedWithTTL_OverridesBlockedTTL tests that an explicit TTL is
+// used even when the global BlockedTTL would expire the entry immediately.
+func TestSetBlockedWithTTL_OverridesBlockedTTL(t *testing.T) {
+	logger := testLogger(t)
+	cfg := testCacheConfig()
+	cfg.BlockedTTL = 50 * time.Millisecond
+
+	cache, err := New(cfg, logger, nil)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	ctx := context.Background()
+	query := testQuery("malware.example.com", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetRcode(query, dns.RcodeNameError)
+
+	cache.SetBlockedWithTTL(ctx, query, resp, nil, time.Hour)
+	time.Sleep(100 * time.Millisecond)
+
+	if cache.Get(ctx, query) == nil {
+		t.Fatal("SetBlockedWithTTL() entry expired with the global BlockedTTL")
+	}
+
+	other := testQuery("other.example.com", dns.TypeA)
+	cache.SetBlockedWithTTL(ctx, other, resp, nil, 0)
+	if cache.Get(ctx, other) != nil {
+		t.Error("SetBlockedWithTTL() cached with zero TTL")
+	}
+}
+
 // TestSetBlocked_MultipleQueries tests caching of multiple blocked domains
 func TestSetBlocked_MultipleQueries(t *testing.T) {
 	logger := testLogger(t)
@@ -824,3 +905,102 @@ func TestSetBlocked_DifferentQueryTypes(t *testing.T) {
 		t.Errorf("Expected 2 entries (A and AAAA), got %d", stats.Entries)
 	}
 }
+
+func TestClaimRefresh(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		cfg := testCacheConfig()
+		cfg.ShardCount = shards
+		cfg.StaleWhileRevalidate = 30 * time.Second
+		c, err := New(cfg, testLogger(t), nil)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		ctx := context.Background()
+
+		fresh := testQuery("fresh.test", dns.TypeA)
+		c.Set(ctx, fresh, testResponse("fresh.test", dns.TypeA, 300))
+		if c.ClaimRefresh(ctx, fresh) {
+			t.Errorf("shards=%d: entry outside the window should not be refreshed", shards)
+		}
+
+		due := testQuery("due.test", dns.TypeA)
+		c.Set(ctx, due, testResponse("due.test", dns.TypeA, 10))
+		if !c.ClaimRefresh(ctx, due) {
+			t.Errorf("shards=%d: entry inside the window should be refreshed", shards)
+		}
+		if c.ClaimRefresh(ctx, due) {
+			t.Errorf("shards=%d: refresh should only be claimed once", shards)
+		}
+
+		// The refreshed response replaces the entry and resets the claim.
+		c.Set(ctx, due, testResponse("due.test", dns.TypeA, 10))
+		if !c.ClaimRefresh(ctx, due) {
+			t.Errorf("shards=%d: replaced entry should be claimable again", shards)
+		}
+
+		blocked := testQuery("blocked.test", dns.TypeA)
+		c.SetBlockedWithTTL(ctx, blocked, testResponse("blocked.test", dns.TypeA, 10),
+			[]storage.BlockTraceEntry{{Stage: "blocklist", Action: "block"}}, 10*time.Second)
+		if c.ClaimRefresh(ctx, blocked) {
+			t.Errorf("shards=%d: blocked entries should not be refreshed", shards)
+		}
+
+		if c.ClaimRefresh(ctx, testQuery("missing.test", dns.TypeA)) {
+			t.Errorf("shards=%d: missing entry should not be refreshed", shards)
+		}
+		_ = c.Close()
+	}
+}
+
+func TestScopedEntries(t *testing.T) {
+	for _, shards := range []int{0, 4} {
+		c, err := New(&config.CacheConfig{
+			Enabled:     true,
+			MaxEntries:  100,
+			MinTTL:      time.Second,
+			MaxTTL:      time.Hour,
+			NegativeTTL: time.Minute,
+			ShardCount:  shards,
+		}, testLogger(t), nil)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		shared := context.Background()
+		kids := WithScope(shared, "kids")
+		if WithScope(shared, "") != shared {
+			t.Errorf("shards=%d: an empty scope should leave ctx unchanged", shards)
+		}
+
+		q := testQuery("scoped.test", dns.TypeA)
+		c.Set(kids, q, testResponse("scoped.test", dns.TypeA, 300))
+		if c.Get(kids, q) == nil {
+			t.Errorf("shards=%d: scoped entry not found in its scope", shards)
+		}
+		if c.Get(shared, q) != nil {
+			t.Errorf("shards=%d: scoped entry leaked to the shared entries", shards)
+		}
+		if c.Get(WithScope(shared, "adults"), q) != nil {
+			t.Errorf("shards=%d: scoped entry leaked to another scope", shards)
+		}
+
+		c.Set(shared, q, testResponse("scoped.test", dns.TypeA, 300))
+		if got := c.Stats().Entries; got != 2 {
+			t.Errorf("shards=%d: expected separate shared and scoped entries, got %d", shards, got)
+		}
+		_ = c.Close()
+	}
+}
+
+func TestClaimRefresh_Disabled(t *testing.T) {
+	c, err := New(testCacheConfig(), testLogger(t), nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	q := testQuery("due.test", dns.TypeA)
+	c.Set(context.Background(), q, testResponse("due.test", dns.TypeA, 2))
+	if c.ClaimRefresh(context.Background(), q) {
+		t.Error("refresh should never be claimed without stale_while_revalidate")
+	}
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"glory-hole/pkg/storage"
 
@@ -17,6 +18,11 @@ type Interface interface {
 	// GetWithTrace returns the cached response and any associated block trace metadata
 	GetWithTrace(ctx context.Context, r *dns.Msg) (*dns.Msg, []storage.BlockTraceEntry)
 
+	// ClaimRefresh reports whether the cached response for r is within
+	// cache.stale_while_revalidate of expiry and no other caller has claimed
+	// its refresh yet. A true result obliges the caller to refresh the entry.
+	ClaimRefresh(ctx context.Context, r *dns.Msg) bool
+
 	// Set stores a DNS response in the cache with appropriate TTL
 	Set(ctx context.Context, r *dns.Msg, resp *dns.Msg)
 
@@ -27,6 +33,10 @@ type Interface interface {
 	// SetBlocked stores a blocked domain response in the cache with BlockedTTL
 	SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry)
 
+	// SetBlockedWithTTL stores a blocked domain response with an explicit TTL
+	// (e.g. a per-blocklist override). A ttl <= 0 skips caching.
+	SetBlockedWithTTL(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry, ttl time.Duration)
+
 	// Stats returns current cache statistics
 	Stats() Stats
 
@@ -140,7 +140,7 @@ func (sc *ShardedCache) GetWithTrace(ctx context.Context, r *dns.Msg) (*dns.Msg,
 		return nil, nil
 	}
 
-	key := makeMsgKeySharded(r)
+	key := makeMsgKeySharded(ctx, r)
 
 	// Get the appropriate shard
 	shard := sc.getShard(key)
@@ -180,13 +180,34 @@ func (sc *ShardedCache) GetWithTrace(ctx context.Context, r *dns.Msg) (*dns.Msg,
 	return entry.msg.Copy(), cloneBlockTrace(entry.blockTrace)
 }
 
+// ClaimRefresh reports whether the entry for r should be refreshed in the
+// background. See Interface.ClaimRefresh.
+func (sc *ShardedCache) ClaimRefresh(ctx context.Context, r *dns.Msg) bool {
+	if len(r.Question) == 0 {
+		return false
+	}
+
+	key := makeMsgKeySharded(ctx, r)
+	shard := sc.getShard(key)
+	window := shard.cfg.StaleWhileRevalidate
+	if window <= 0 {
+		return false
+	}
+
+	shard.mu.RLock()
+	entry, found := shard.entries[key]
+	shard.mu.RUnlock()
+
+	return found && entry.claimRefresh(time.Now(), window)
+}
+
 // Set stores a DNS response in the cache with appropriate TTL.
 func (sc *ShardedCache) Set(ctx context.Context, r *dns.Msg, resp *dns.Msg) {
 	if len(r.Question) == 0 {
 		return
 	}
 
-	key := makeMsgKeySharded(r)
+	key := makeMsgKeySharded(ctx, r)
 
 	// Determine TTL from response
 	ttl := determineTTL(sc.shards[0].cfg, resp)
@@ -235,7 +256,7 @@ func (sc *ShardedCache) SetWithTrace(ctx context.Context, r *dns.Msg, resp *dns.
 		return
 	}
 
-	key := makeMsgKeySharded(r)
+	key := makeMsgKeySharded(ctx, r)
 
 	// Determine TTL from response (normal TTL, not BlockedTTL)
 	ttl := determineTTL(sc.shards[0].cfg, resp)
@@ -273,14 +294,17 @@ func (sc *ShardedCache) SetWithTrace(ctx context.Context, r *dns.Msg, resp *dns.
 
 // SetBlocked stores a blocked domain response in the cache with BlockedTTL.
 func (sc *ShardedCache) SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry) {
+	sc.SetBlockedWithTTL(ctx, r, resp, trace, sc.shards[0].cfg.BlockedTTL)
+}
+
+// SetBlockedWithTTL is SetBlocked with an explicit TTL. A ttl <= 0 skips caching.
+func (sc *ShardedCache) SetBlockedWithTTL(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry, ttl time.Duration) {
 	if len(r.Question) == 0 {
 		return
 	}
 
-	key := makeMsgKeySharded(r)
+	key := makeMsgKeySharded(ctx, r)
 
-	// Use configured blocked TTL
-	ttl := sc.shards[0].cfg.BlockedTTL
 	if ttl <= 0 {
 		// Don't cache if BlockedTTL is disabled
 		return
@@ -368,6 +392,7 @@ func (sc *ShardedCache) evictLRU(shard *CacheShard) {
 	// Record cache size decrease
 	if shard.metrics != nil {
 		shard.metrics.CacheSize.Add(context.Background(), -1)
+		shard.metrics.AddCacheEvictions(context.Background(), telemetry.CacheEvictionLRU, 1)
 	}
 }
 
@@ -527,6 +552,7 @@ func (sc *ShardedCache) cleanup() {
 		// Use first shard's metrics reference (all shards share the same Metrics instance).
 		if len(sc.shards) > 0 && sc.shards[0].metrics != nil {
 			sc.shards[0].metrics.CacheSize.Add(context.Background(), -int64(removed))
+			sc.shards[0].metrics.AddCacheEvictions(context.Background(), telemetry.CacheEvictionExpired, int64(removed))
 		}
 
 		sc.logger.Debug("Cleaned up expired cache entries",
@@ -559,7 +585,7 @@ func (sc *ShardedCache) recordMiss(shard *CacheShard) {
 
 // makeMsgKeySharded creates a cache key from a DNS request, including DNSSEC flags.
 // Delegates to the shared cacheKey function in cache.go.
-func makeMsgKeySharded(r *dns.Msg) string {
+func makeMsgKeySharded(ctx context.Context, r *dns.Msg) string {
 	if len(r.Question) == 0 {
 		return ""
 	}
@@ -568,7 +594,7 @@ func makeMsgKeySharded(r *dns.Msg) string {
 	if opt := r.IsEdns0(); opt != nil {
 		do = opt.Do()
 	}
-	return cacheKey(q.Name, q.Qtype, do, r.CheckingDisabled)
+	return cacheKey(q.Name, q.Qtype, do, r.CheckingDisabled, ClientSubnet(r), ScopeFrom(ctx))
 }
 
 // determineTTL extracts TTL from DNS response and applies min/max limits.
@@ -189,7 +189,7 @@ func TestShardedCache_DifferentShards(t *testing.T) {
 
 	for _, domain := range domains {
 		query := testQuery(domain, dns.TypeA)
-		key := makeMsgKeySharded(query)
+		key := makeMsgKeySharded(context.Background(), query)
 
 		// Determine which shard this would go to
 		shard := sc.getShard(key)
@@ -449,6 +449,29 @@ func TestShardedCache_SetBlocked(t *testing.T) {
 	}
 }
 
+func TestShardedCache_SetBlockedWithTTL(t *testing.T) {
+	logger := testLogger(t)
+	cfg := testCacheConfig()
+	cfg.BlockedTTL = 50 * time.Millisecond
+	cache, err := NewSharded(cfg, logger, nil, 4)
+	if err != nil {
+		t.Fatalf("NewSharded() failed: %v", err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	ctx := context.Background()
+	query := testQuery("malware.example.com", dns.TypeA)
+	resp := new(dns.Msg)
+	resp.SetRcode(query, dns.RcodeNameError)
+
+	cache.SetBlockedWithTTL(ctx, query, resp, nil, time.Hour)
+	time.Sleep(100 * time.Millisecond)
+
+	if cache.Get(ctx, query) == nil {
+		t.Fatal("SetBlockedWithTTL() entry expired with the global BlockedTTL")
+	}
+}
+
 func TestShardedCache_GetWithTrace(t *testing.T) {
 	logger := testLogger(t)
 	cfg := testCacheConfig()
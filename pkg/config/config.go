@@ -4,12 +4,19 @@ package config
 
 import (
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/storage"
 
+	"github.com/miekg/dns"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v3"
 )
@@ -22,21 +29,169 @@ type Config struct {
 	Server                ServerConfig                `yaml:"server"`
 	Policy                PolicyConfig                `yaml:"policy"`
 	Auth                  AuthConfig                  `yaml:"auth"`
+	RateLimit             RateLimitConfig             `yaml:"rate_limit"` // How the API rate limiter groups client addresses
 	LocalRecords          LocalRecordsConfig          `yaml:"local_records"`
+	StaticAnswers         []StaticAnswerEntry         `yaml:"static_answers"` // Fixed responses for specific name+type pairs
 	ConditionalForwarding ConditionalForwardingConfig `yaml:"conditional_forwarding"`
 	Forwarder             ForwarderConfig             `yaml:"forwarder"` // Upstream DNS forwarder config
 	UpstreamDNSServers    []string                    `yaml:"upstream_dns_servers"`
 	Blocklists            []string                    `yaml:"blocklists"`
+	BlocklistCategories   map[string]string           `yaml:"blocklist_categories"`   // Category per blocklist URL (e.g. advertising, malware)
+	BlocklistMatch        map[string]string           `yaml:"blocklist_match"`        // Match mode per blocklist URL: suffix (default) or exact
+	BlocklistNames        map[string]string           `yaml:"blocklist_names"`        // Display name per blocklist URL, shown in traces, EDE, and the dashboard
+	BlocklistDescriptions map[string]string           `yaml:"blocklist_descriptions"` // Free-text note per blocklist URL, shown in the dashboard
+	BlocklistRedirects    map[string][]string         `yaml:"blocklist_redirects"`    // Sink IPs per blocklist category; matches are answered with these instead of blocked
+	BlocklistLoading      BlocklistLoadingConfig      `yaml:"blocklist_loading"`
+	Startup               StartupConfig               `yaml:"startup"` // Answering before the first blocklist load completes
 	Whitelist             []string                    `yaml:"whitelist"`
 	Logging               LoggingConfig               `yaml:"logging"`
 	Database              storage.Config              `yaml:"database"`
 	Cache                 CacheConfig                 `yaml:"cache"`
 	BlockPage             BlockPageConfig             `yaml:"block_page"`
 	Unbound               UnboundConfig               `yaml:"unbound"`
+	ClientDiscovery       ClientDiscoveryConfig       `yaml:"client_discovery"`
+	Notifications         NotificationsConfig         `yaml:"notifications"` // Webhooks for operational events
 	UpdateInterval        time.Duration               `yaml:"update_interval"`
 	AutoUpdateBlocklists  bool                        `yaml:"auto_update_blocklists"`
+
+	// BlocklistAuth holds credentials per blocklist URL, sent when that
+	// source is downloaded, for private lists behind basic auth or a token.
+	BlocklistAuth map[string]*BlocklistAuthConfig `yaml:"blocklist_auth,omitempty"`
+}
+
+// BlocklistAuthConfig authenticates the download of one blocklist source,
+// with basic auth, a bearer token, or arbitrary headers. Password and
+// BearerToken can be read from a *_file instead (Docker/K8s secrets).
+type BlocklistAuthConfig struct {
+	Username        string            `yaml:"username,omitempty"`
+	Password        string            `yaml:"password,omitempty"`
+	PasswordFile    string            `yaml:"password_file,omitempty"`
+	BearerToken     string            `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string            `yaml:"bearer_token_file,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`      // Extra request headers, e.g. X-Api-Key
+	HeaderFiles     map[string]string `yaml:"header_files,omitempty"` // Header name to a file holding its value
+}
+
+func (a *BlocklistAuthConfig) validate() error {
+	if a == nil {
+		return fmt.Errorf("must set username, bearer_token or headers")
+	}
+	hasPassword := a.Password != "" || a.PasswordFile != ""
+	hasToken := a.BearerToken != "" || a.BearerTokenFile != ""
+	if hasPassword && a.Username == "" {
+		return fmt.Errorf("password requires username")
+	}
+	if a.Username != "" && hasToken {
+		return fmt.Errorf("username and bearer_token are mutually exclusive")
+	}
+	if a.Username == "" && !hasToken && len(a.Headers) == 0 && len(a.HeaderFiles) == 0 {
+		return fmt.Errorf("must set username, bearer_token or headers")
+	}
+	for name := range a.HeaderFiles {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header_files name %q", name)
+		}
+	}
+	for name, value := range a.Headers {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s: value must not contain line breaks", name)
+		}
+		if strings.EqualFold(name, "Authorization") && (a.Username != "" || hasToken) {
+			return fmt.Errorf("headers.Authorization conflicts with username or bearer_token")
+		}
+	}
+	return nil
+}
+
+// RateLimitConfig controls how the API and login rate limiters group
+// clients. Addresses are keyed by network prefix, so a client rotating
+// through the addresses of its IPv6 /64 still shares one budget.
+type RateLimitConfig struct {
+	IPv4Prefix int `yaml:"ipv4_prefix"` // default 32 (one budget per address)
+	IPv6Prefix int `yaml:"ipv6_prefix"` // default 64 (one budget per subnet)
+}
+
+// Rate limiter prefix defaults.
+const (
+	DefaultRateLimitIPv4Prefix = 32
+	DefaultRateLimitIPv6Prefix = 64
+)
+
+// BlocklistLoadingConfig tunes how blocklist sources are fetched and parsed.
+type BlocklistLoadingConfig struct {
+	// Concurrency is how many sources are downloaded and parsed at once
+	// (0 = 1). Raising it to the CPU count shortens loads with many sources;
+	// each in-flight download holds its raw body and parse buffers, so peak
+	// memory grows with it.
+	Concurrency int `yaml:"concurrency"`
+
+	// Sequential downloads one source at a time and merges it into the
+	// blocklist before fetching the next, releasing its buffers in between.
+	// Peak memory during a load is the merged list plus one source rather
+	// than every source at once; loads take longer. Concurrency is ignored.
+	// Meant for small devices (Raspberry Pi, routers).
+	Sequential bool `yaml:"sequential"`
+
+	// Jitter delays each source's download after the first by a random
+	// amount up to this long, so updates don't hit every list host at the
+	// same instant (0 = off). Concurrency still bounds simultaneous fetches.
+	// Skipped until a load has succeeded, so startup isn't delayed.
+	Jitter time.Duration `yaml:"jitter"`
+
+	// ShrinkThreshold guards against a provider serving an empty or junk
+	// page: a source whose download has fewer than this fraction of its
+	// previous domain count keeps its previous domains instead (default 0.5,
+	// 0 disables). ShrinkGrace is how long a source may stay that small
+	// before the smaller list is accepted as genuine (default 24h).
+	ShrinkThreshold *float64      `yaml:"shrink_threshold"`
+	ShrinkGrace     time.Duration `yaml:"shrink_grace"`
 }
 
+// StartupConfig controls how queries are answered before the first
+// blocklist load has produced any domains, e.g. while a failed initial
+// download is being retried.
+type StartupConfig struct {
+	// FailClosed holds queries that would be checked against the blocklist
+	// until it has loaded, instead of forwarding them unfiltered. A query
+	// waits up to MaxWait (default 2s) and is then answered SERVFAIL, so
+	// clients retry rather than cache an unfiltered answer. A failed initial
+	// download is retried every 30s. Off by default.
+	FailClosed bool          `yaml:"fail_closed"`
+	MaxWait    time.Duration `yaml:"max_wait"`
+}
+
+// DefaultStartupMaxWait is how long a query is held for the first blocklist
+// load when startup.fail_closed is on and startup.max_wait is unset.
+const DefaultStartupMaxWait = 2 * time.Second
+
+// Blocklist shrink-guard defaults.
+const (
+	DefaultBlocklistShrinkThreshold = 0.5
+	DefaultBlocklistShrinkGrace     = 24 * time.Hour
+)
+
+// ShrinkThresholdValue returns ShrinkThreshold, or its default when unset.
+func (b BlocklistLoadingConfig) ShrinkThresholdValue() float64 {
+	if b.ShrinkThreshold == nil {
+		return DefaultBlocklistShrinkThreshold
+	}
+	return *b.ShrinkThreshold
+}
+
+// Blocklist match modes (blocklist_match values). A suffix source blocks its
+// entries and every name below them; an exact source blocks only the names
+// it lists.
+const (
+	BlocklistMatchSuffix = "suffix"
+	BlocklistMatchExact  = "exact"
+)
+
+// MaxBlocklistLoadConcurrency bounds blocklist_loading.concurrency.
+const MaxBlocklistLoadConcurrency = 64
+
 // UnboundConfig controls the integrated Unbound recursive resolver.
 type UnboundConfig struct {
 	BinaryPath    string `yaml:"binary_path"`    // Path to unbound binary (auto-detected if empty)
@@ -59,6 +214,36 @@ type ForwarderConfig struct {
 	// UDP→TCP except on TC truncation, so SERVFAIL would otherwise be final.
 	// Pointer so absent/nil = enabled (default), explicit `false` = disabled.
 	ServfailTCPRetry *bool `yaml:"servfail_tcp_retry,omitempty"`
+
+	// ShuffleAnswers randomizes the order of multi-record A/AAAA answers on
+	// every response (fresh and cached) so clients that always pick the first
+	// address spread across them. Off by default: some upstreams order
+	// answers deliberately (e.g. GeoDNS nearest-first).
+	ShuffleAnswers bool `yaml:"shuffle_answers"`
+
+	// ForwardClientSubnet passes an EDNS Client Subnet option sent by the
+	// client through to the upstream. Off by default: client-supplied ECS is
+	// stripped so the client's subnet isn't disclosed upstream.
+	ForwardClientSubnet bool `yaml:"forward_client_subnet"`
+
+	// FlattenCNAME answers A/AAAA queries whose upstream answer goes through
+	// a CNAME chain with the final addresses under the queried name, dropping
+	// the intermediate CNAMEs (follows up to 10 hops, via extra upstream
+	// queries where needed). Off by default.
+	FlattenCNAME bool `yaml:"flatten_cname"`
+
+	// CaseRandomization enables DNS 0x20 encoding: the letters of each
+	// outgoing query name get a random case, and an upstream answer whose
+	// question doesn't echo that exact spelling is rejected as a likely
+	// spoof. Off by default: a few upstreams normalize the case.
+	CaseRandomization bool `yaml:"case_randomization"`
+
+	// MaxConcurrent caps simultaneous in-flight upstream queries so a burst
+	// of cache misses can't exhaust sockets or overwhelm the upstreams.
+	// 0 = unlimited. Queries over the limit wait up to QueueTimeout for a
+	// slot; with QueueTimeout 0 they fail fast with SERVFAIL.
+	MaxConcurrent int           `yaml:"max_concurrent"`
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`
 }
 
 // ServfailTCPRetryEnabled reports whether the SERVFAIL→TCP retry workaround is on.
@@ -80,25 +265,306 @@ type CircuitBreakerConfig struct {
 
 // ServerConfig holds server-specific settings
 type ServerConfig struct {
-	ListenAddress      string            `yaml:"listen_address"`
-	UDPListenAddress   string            `yaml:"udp_listen_address"` // Override listen_address for UDP only
-	TCPListenAddress   string            `yaml:"tcp_listen_address"` // Override listen_address for TCP only
-	WebUIAddress       string            `yaml:"web_ui_address"`
-	TCPEnabled         bool              `yaml:"tcp_enabled"`
-	UDPEnabled         bool              `yaml:"udp_enabled"`
-	EnableBlocklist    bool              `yaml:"enable_blocklist"`     // Kill-switch for ad-blocking
-	EnablePolicies     bool              `yaml:"enable_policies"`      // Kill-switch for policy engine
-	DecisionTrace      bool              `yaml:"decision_trace"`       // Capture block decision traces
-	CORSAllowedOrigins []string          `yaml:"cors_allowed_origins"` // Allowed CORS origins (empty = none, "*" = all)
-	DotEnabled         bool              `yaml:"dot_enabled"`
-	DotAddress         string            `yaml:"dot_address"`
-	AllowedClients     []string          `yaml:"allowed_clients"` // IP/CIDR allowlist for plain DNS (port 53). Empty = open. DoT/DoH bypass (TLS is the auth).
-	ProxyProtocol      bool              `yaml:"proxy_protocol"`  // Enable PROXY protocol on TCP listeners (for Fly.io / load balancers)
-	TLS                TLSConfig         `yaml:"tls"`
-	QueryLogger        QueryLoggerConfig `yaml:"query_logger"`    // Worker pool config for async query logging
-	TrustedProxies     []string          `yaml:"trusted_proxies"` // CIDRs whose X-Forwarded-For/X-Real-IP headers are trusted
+	ListenAddress      string                 `yaml:"listen_address"`
+	ListenAddresses    []string               `yaml:"listen_addresses"`   // Bind plain DNS on each of these instead of listen_address
+	UDPListenAddress   string                 `yaml:"udp_listen_address"` // Override listen_address for UDP only
+	TCPListenAddress   string                 `yaml:"tcp_listen_address"` // Override listen_address for TCP only
+	UDPWorkers         int                    `yaml:"udp_workers"`        // UDP sockets per address via SO_REUSEPORT (Linux; <= 1 = single socket)
+	WebUIAddress       string                 `yaml:"web_ui_address"`
+	TCPEnabled         bool                   `yaml:"tcp_enabled"`
+	UDPEnabled         bool                   `yaml:"udp_enabled"`
+	EnableBlocklist    bool                   `yaml:"enable_blocklist"`     // Kill-switch for ad-blocking
+	EnablePolicies     bool                   `yaml:"enable_policies"`      // Kill-switch for policy engine
+	DecisionTrace      bool                   `yaml:"decision_trace"`       // Capture block decision traces
+	BlockExplainTXT    bool                   `yaml:"block_explain_txt"`    // Add a TXT record explaining blocks to blocked responses
+	ExtendedDNSErrors  bool                   `yaml:"extended_dns_errors"`  // Attach RFC 8914 EDE codes to our own blocked/SERVFAIL responses
+	StripUpstreamEDE   bool                   `yaml:"strip_upstream_ede"`   // Drop EDE options from upstream responses instead of passing them on
+	CORSAllowedOrigins []string               `yaml:"cors_allowed_origins"` // Allowed CORS origins (empty = none, "*" = all)
+	DotEnabled         bool                   `yaml:"dot_enabled"`
+	DotAddress         string                 `yaml:"dot_address"`
+	AllowedClients     []string               `yaml:"allowed_clients"` // IP/CIDR allowlist for plain DNS (port 53). Empty = open. DoT/DoH bypass (TLS is the auth).
+	ProxyProtocol      bool                   `yaml:"proxy_protocol"`  // Enable PROXY protocol on TCP listeners (for Fly.io / load balancers)
+	TLS                TLSConfig              `yaml:"tls"`
+	QueryLogger        QueryLoggerConfig      `yaml:"query_logger"`         // Worker pool config for async query logging
+	TrustedProxies     []string               `yaml:"trusted_proxies"`      // CIDRs whose X-Forwarded-For/X-Real-IP headers are trusted
+	SlowQueryThreshold time.Duration          `yaml:"slow_query_threshold"` // Warn about queries slower than this (0 = disabled)
+	AnomalyDetection   AnomalyConfig          `yaml:"anomaly_detection"`    // Tunneling/exfiltration signals
+	QueryQuota         QueryQuotaConfig       `yaml:"query_quota"`          // Per-client daily query cap (REFUSED, or query_quota.action, once exceeded)
+	RebindProtection   RebindProtectionConfig `yaml:"rebind_protection"`    // Strip private IPs from public answers
+	SpecialUseNames    SpecialUseNamesConfig  `yaml:"special_use_names"`    // Answer .local etc. locally instead of forwarding
+	AnyQuery           string                 `yaml:"any_query"`            // ANY handling: minimal (default), refuse, forward
+	RefusedTypes       []string               `yaml:"refused_types"`        // Query types answered NODATA (e.g. HTTPS, SVCB); local records still apply
+	AllowedTypes       map[string][]string    `yaml:"allowed_types"`        // Per client group: the only query types its members may resolve; others get NODATA
+	MalformedQueries   MalformedQueriesConfig `yaml:"malformed_queries"`    // Answers for multi-question, non-QUERY and overlong queries
+	ZoneTransfer       ZoneTransferConfig     `yaml:"zone_transfer"`        // AXFR/IXFR and NOTIFY allow-list
+	PrivateReverse     PrivateReverseConfig   `yaml:"private_reverse"`      // PTR handling for RFC 1918/ULA/loopback addresses
+	MaxUDPSize         int                    `yaml:"max_udp_size"`         // Truncate UDP responses above this many bytes (default 1232)
+	MaxTCPConnections  int                    `yaml:"max_tcp_connections"`  // Open TCP+DoT client connections allowed at once (default 1000, -1 = unlimited)
+	TCPIdleTimeout     time.Duration          `yaml:"tcp_idle_timeout"`     // Close TCP/DoT connections idle this long between queries (default 8s)
+	OverrideTTL        time.Duration          `yaml:"override_ttl"`         // TTL of synthetic answers such as policy redirects (default 5m)
+	DoH                DoHConfig              `yaml:"doh"`                  // DNS-over-HTTPS endpoint on the web UI listener
+	HealthName         HealthNameConfig       `yaml:"health_name"`          // Sentinel name answered before any filtering, for DNS health checks
+	Debug              DebugConfig            `yaml:"debug,omitempty"`      // Dev-only knobs; rejected without --allow-debug
+
+	// CompressResponses turns DNS name compression in responses off when
+	// false, for old embedded resolvers that mishandle compression pointers.
+	// Default-on: nil reads as true.
+	CompressResponses *bool `yaml:"compress_responses,omitempty"`
+}
+
+// CompressResponsesEnabled reports whether responses use DNS name
+// compression. Default-on: nil pointer reads as true.
+func (s ServerConfig) CompressResponsesEnabled() bool {
+	if s.CompressResponses == nil {
+		return true
+	}
+	return *s.CompressResponses
+}
+
+// DefaultDoHPath is the RFC 8484 DNS-over-HTTPS path served when
+// server.doh.path is not set.
+const DefaultDoHPath = "/dns-query"
+
+// reservedHTTPPaths are the routes the API server registers outside /api/
+// (see api.New). A DoH path on, above or below one of them would make
+// http.ServeMux panic at startup on the conflicting registration.
+var reservedHTTPPaths = []string{
+	"/health", "/ready", "/login", "/logout", "/metrics", "/favicon.svg",
+	"/queries", "/policies", "/localrecords", "/settings", "/clients", "/blocklists",
+	"/resolver", "/resolver/queries", "/resolver/settings", "/resolver/zones",
+	"/_astro", "/.well-known/acme-challenge",
+}
+
+// dohPathConflict returns the reserved route a DoH path collides with, or ""
+// when it is free. The DoH endpoint also serves <path>/{token}, so a path
+// that is a parent of a route conflicts too.
+func dohPathConflict(p string) string {
+	p = strings.TrimSuffix(p, "/")
+	for _, route := range reservedHTTPPaths {
+		if p == route || strings.HasPrefix(route, p+"/") || strings.HasPrefix(p, route+"/") {
+			return route
+		}
+	}
+	return ""
+}
+
+// DoHConfig controls the DNS-over-HTTPS endpoint served by the API server.
+type DoHConfig struct {
+	// Path the endpoint is served on (default /dns-query). It is always
+	// reachable without authentication.
+	Path string `yaml:"path"`
+	// CORSAllowedOrigins are extra origins allowed to call the DoH endpoint
+	// only, on top of server.cors_allowed_origins, so a browser extension or
+	// web app can use DoH without being granted the rest of the API.
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	// Tokens serve the endpoint under <path>/<token> as well, one per
+	// tenant: each query on a token's path is treated as coming from its
+	// group for policy rules, and unknown tokens are refused. RequireToken
+	// refuses the bare path too.
+	Tokens       []DoHTokenConfig `yaml:"tokens,omitempty"`
+	RequireToken bool             `yaml:"require_token,omitempty"`
+}
+
+// DoHTokenConfig binds a DoH path token to a client group.
+type DoHTokenConfig struct {
+	Token     string `yaml:"token,omitempty"`
+	TokenFile string `yaml:"token_file,omitempty"` // read token from this file (Docker/K8s secrets)
+	Group     string `yaml:"group"`
+}
+
+// DebugConfig holds development and testing options. Validate rejects any of
+// them unless the process was started with --allow-debug (see SetAllowDebug),
+// so they can't be left on in a production config by accident.
+type DebugConfig struct {
+	// InjectLatency delays every DNS response by this long, for reproducing
+	// client timeout bugs and load-testing slow-upstream behavior.
+	InjectLatency time.Duration `yaml:"inject_latency,omitempty"`
+}
+
+// enabled reports whether any debug option is set.
+func (d DebugConfig) enabled() bool {
+	return d.InjectLatency != 0
+}
+
+// allowDebug gates server.debug; set from the --allow-debug flag.
+var allowDebug atomic.Bool
+
+// SetAllowDebug permits server.debug options to pass validation. Call it
+// before loading the config.
+func SetAllowDebug(allowed bool) {
+	allowDebug.Store(allowed)
+}
+
+// ANY query handling modes (server.any_query).
+const (
+	AnyQueryMinimal = "minimal" // RFC 8482 synthesized HINFO answer
+	AnyQueryRefuse  = "refuse"  // REFUSED
+	AnyQueryForward = "forward" // treat like any other query type
+)
+
+// Responses for malformed or unsupported queries (server.malformed_queries).
+const (
+	MalformedRefuse  = "refuse"  // REFUSED
+	MalformedFormErr = "formerr" // FORMERR
+	MalformedNotImp  = "notimp"  // NOTIMP
+)
+
+// MalformedQueriesConfig sets how queries the resolver won't process are
+// answered. They are rejected before any lookup, so they never reach the
+// cache, policies or upstreams.
+type MalformedQueriesConfig struct {
+	// MultiQuestion answers queries with more than one question: refuse
+	// (default) or formerr. No common resolver sends them.
+	MultiQuestion string `yaml:"multi_question"`
+	// UnsupportedOpcode answers any opcode other than QUERY (UPDATE, NOTIFY,
+	// STATUS, ...): notimp (default) or refuse.
+	UnsupportedOpcode string `yaml:"unsupported_opcode"`
+	// MaxQNameLength refuses queries whose name is longer than this many
+	// characters. 0 = only the protocol limit of 255 octets applies.
+	MaxQNameLength int `yaml:"max_qname_length"`
+}
+
+// ZoneTransferConfig controls zone transfer (AXFR/IXFR) requests and NOTIFY
+// messages. Both are refused to everyone by default, since a forwarding
+// resolver must not pass them upstream.
+type ZoneTransferConfig struct {
+	// AllowedClients lists the IPs and CIDRs of secondaries allowed to request
+	// transfers and send NOTIFY. Empty = nobody.
+	AllowedClients []string `yaml:"allowed_clients"`
+	// Zones are the local zone origins (e.g. "lan.") served by AXFR to
+	// allowed clients, over TCP: every enabled local record at or below the
+	// origin, framed by an SOA local record at the origin, which is required.
+	Zones []string `yaml:"zones"`
+}
+
+// Private reverse lookup modes (server.private_reverse.mode).
+const (
+	PrivateReverseForward  = "forward"  // send to the normal upstreams (default)
+	PrivateReverseLocal    = "local"    // NXDOMAIN unless a local PTR record exists
+	PrivateReverseUpstream = "upstream" // send to private_reverse.upstreams only
+)
+
+// PrivateReverseConfig keeps PTR queries for private addresses off public
+// resolvers, which can only answer NXDOMAIN and learn the internal topology
+// in the process. Local PTR records and policy FORWARD rules take precedence.
+type PrivateReverseConfig struct {
+	Mode      string   `yaml:"mode"`      // forward (default), local, or upstream
+	Upstreams []string `yaml:"upstreams"` // Internal resolvers for mode upstream, e.g. the router (host:port)
+}
+
+// DefaultMaxUDPSize is the server.max_udp_size default: the DNS Flag Day 2020
+// payload size, which fits a typical path MTU without IP fragmentation.
+const DefaultMaxUDPSize = 1232
+
+// DefaultMaxTCPConnections is the server.max_tcp_connections default.
+const DefaultMaxTCPConnections = 1000
+
+// DefaultTCPIdleTimeout is the server.tcp_idle_timeout default, the idle
+// timeout miekg/dns uses on its own.
+const DefaultTCPIdleTimeout = 8 * time.Second
+
+// DefaultOverrideTTL is the server.override_ttl default.
+const DefaultOverrideTTL = 5 * time.Minute
+
+// HealthNameConfig is a sentinel name every transport answers with a fixed
+// address and NOERROR, ahead of quotas, blocklists and policies, so monitors
+// can check the DNS path itself rather than just the HTTP API. Health
+// queries are not written to the query log.
+type HealthNameConfig struct {
+	Enabled *bool  `yaml:"enabled,omitempty"` // default true
+	Name    string `yaml:"name"`              // default healthcheck.gloryhole
+	IP      string `yaml:"ip"`                // A (or AAAA for IPv6) answer, default 127.0.0.1
+}
+
+// Defaults for server.health_name.
+const (
+	DefaultHealthName   = "healthcheck.gloryhole"
+	DefaultHealthNameIP = "127.0.0.1"
+)
+
+// IsEnabled reports whether the health name is answered (default true).
+func (h HealthNameConfig) IsEnabled() bool {
+	return h.Enabled == nil || *h.Enabled
+}
+
+// DefaultSpecialUseNames are the zones answered locally when
+// server.special_use_names.names is empty: mDNS (.local and the link-local
+// reverse zones, RFC 6762) plus the RFC 6761 / RFC 7686 names that never exist
+// in the public DNS.
+var DefaultSpecialUseNames = []string{
+	"local",
+	"localhost",
+	"test",
+	"invalid",
+	"onion",
+	"254.169.in-addr.arpa",
+	"8.e.f.ip6.arpa",
+	"9.e.f.ip6.arpa",
+	"a.e.f.ip6.arpa",
+	"b.e.f.ip6.arpa",
+}
+
+// SpecialUseNamesConfig stops special-use names from leaking upstream. Queries
+// under these zones get NXDOMAIN (NODATA when a local record defines the
+// name) straight after the local-records lookup, before policies run.
+type SpecialUseNamesConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Names   []string `yaml:"names"` // Zones to answer locally; each covers its subdomains (default: DefaultSpecialUseNames)
+}
+
+// RebindProtectionConfig controls DNS rebinding protection: forwarded answers
+// for public names that point at private, loopback or link-local addresses are
+// stripped (NXDOMAIN if nothing else is left). Local zones (.local, .lan,
+// home.arpa, ...) and names answered via policy FORWARD rules are exempt.
+type RebindProtectionConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	AllowedDomains []string `yaml:"allowed_domains"` // Names (and their subdomains) allowed to resolve to private IPs
+}
+
+// AnomalyConfig controls detection of query patterns typical of DNS tunneling,
+// data exfiltration, or a misbehaving device. Counts are kept per fixed window;
+// a negative threshold disables that check.
+type AnomalyConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Window  time.Duration `yaml:"window"` // Counting window (default: 1m)
+
+	// DomainRate flags a single name queried more than this many times per
+	// window across all clients (default: off).
+	DomainRate int `yaml:"domain_rate"`
+	// ClientUniqueDomains flags a client querying more than this many distinct
+	// names per window (default: 1000).
+	ClientUniqueDomains int `yaml:"client_unique_domains"`
+	// UniqueSubdomains flags a client querying more than this many distinct
+	// subdomains of one parent per window, the classic tunneling signature
+	// (default: 100).
+	UniqueSubdomains int `yaml:"unique_subdomains"`
+}
+
+// QueryQuotaConfig caps how many queries one client may send per day, to
+// catch malware or telemetry stuck in a lookup loop rather than to smooth out
+// bursts. Counts are kept in memory and reset at local midnight; a client over
+// its quota gets REFUSED for the rest of the day.
+type QueryQuotaConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	DailyLimit int  `yaml:"daily_limit"` // Queries per client per day (0 = unlimited)
+	// Groups overrides daily_limit for members of a client group, keyed by
+	// group name. A client in several groups gets the highest limit; 0 makes
+	// the group unlimited.
+	Groups map[string]int `yaml:"groups"`
+	// Action is the answer to an over-quota query: refused (default),
+	// nxdomain, drop (no response) or truncate (an empty TC=1 answer over
+	// UDP, pushing the client to TCP; REFUSED over TCP, DoT and DoH).
+	Action string `yaml:"action"`
 }
 
+// server.query_quota.action values.
+const (
+	QuotaActionRefused  = "refused"
+	QuotaActionNXDomain = "nxdomain"
+	QuotaActionDrop     = "drop"
+	QuotaActionTruncate = "truncate"
+)
+
 // QueryLoggerConfig holds query logger worker pool settings
 type QueryLoggerConfig struct {
 	Enabled    bool `yaml:"enabled"`     // Enable worker pool (default: true)
@@ -121,6 +587,12 @@ type AutocertConfig struct {
 	CacheDir      string   `yaml:"cache_dir"`
 	Email         string   `yaml:"email"`
 	HTTP01Address string   `yaml:"http01_address"`
+
+	// HTTP01ViaAPI answers HTTP-01 challenges on the API server's own port
+	// (/.well-known/acme-challenge/) instead of a separate listener on
+	// HTTP01Address. The CA still connects on port 80, so the API server
+	// must be reachable there (directly or through a proxy).
+	HTTP01ViaAPI bool `yaml:"http01_via_api"`
 }
 
 // ACMEConfig enables native DNS-01 issuance (Cloudflare-only for now).
@@ -138,6 +610,7 @@ type ACMEConfig struct {
 // CFConfig holds Cloudflare credentials for DNS-01 (prefer env CF_DNS_API_TOKEN).
 type CFConfig struct {
 	APIToken           string        `yaml:"api_token"`
+	APITokenFile       string        `yaml:"api_token_file,omitempty"` // read api_token from this file (Docker/K8s secrets)
 	ZoneID             string        `yaml:"zone_id"`                  // optional: skip zone discovery
 	TTL                int           `yaml:"ttl"`                      // TXT record TTL (min 120)
 	PropagationTimeout time.Duration `yaml:"propagation_timeout"`      // how long to wait for TXT to show up
@@ -154,6 +627,10 @@ type AuthConfig struct {
 	Username     string `yaml:"username"`
 	Password     string `yaml:"password"`      // DEPRECATED: Plaintext password (use password_hash instead)
 	PasswordHash string `yaml:"password_hash"` // Bcrypt hash of password (recommended)
+
+	// File variants (Docker/K8s secrets): read the secret from this file at load.
+	APIKeyFile       string `yaml:"api_key_file,omitempty"`
+	PasswordHashFile string `yaml:"password_hash_file,omitempty"`
 }
 
 func (a *AuthConfig) normalize() {
@@ -199,51 +676,252 @@ type CacheConfig struct {
 	NegativeTTL time.Duration `yaml:"negative_ttl"` // TTL for upstream NXDOMAIN responses
 	BlockedTTL  time.Duration `yaml:"blocked_ttl"`  // TTL for blocked domain responses
 	ShardCount  int           `yaml:"shard_count"`  // Number of shards for concurrent access (0 = use non-sharded cache)
+	// StaleWhileRevalidate is how long before expiry a cache hit also starts
+	// a background refresh, so the entry is renewed before it lapses.
+	// 0 disables it.
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"`
+	// BlockedTTLBySource overrides BlockedTTL for domains from specific
+	// blocklists, keyed by blocklist URL. When a domain is on several
+	// listed sources the longest TTL wins.
+	BlockedTTLBySource map[string]time.Duration `yaml:"blocked_ttl_by_source,omitempty"`
+	// PerClientGroup keeps separate entries for clients in a client group,
+	// keyed by their groups, so answers shaped by group-specific rules
+	// don't reach other clients. Clients in no group share the plain
+	// entries. Pointer so absent/nil = enabled, explicit false = disabled.
+	PerClientGroup *bool `yaml:"per_client_group,omitempty"`
+}
+
+// PerClientGroupEnabled reports whether cache entries are kept per client
+// group (default: true).
+func (c CacheConfig) PerClientGroupEnabled() bool {
+	return c.PerClientGroup == nil || *c.PerClientGroup
+}
+
+// ClientDiscoveryConfig controls automatic hostname discovery for clients seen
+// in the query log. Discovered names are shown when no display name has been
+// set and never replace an operator-set one.
+type ClientDiscoveryConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	LeasesFile string        `yaml:"leases_file"` // dnsmasq or ISC dhcpd leases file (optional)
+	Interval   time.Duration `yaml:"interval"`    // How often to scan for new clients (default: 5m)
+	// PTRLookups reverse-resolves clients not found in the leases file via
+	// the forwarder. Pointer so absent/nil = enabled, explicit false = disabled.
+	PTRLookups *bool `yaml:"ptr_lookups,omitempty"`
+}
+
+// PTRLookupsEnabled reports whether PTR lookups are on (default: true).
+func (c ClientDiscoveryConfig) PTRLookupsEnabled() bool {
+	return c.PTRLookups == nil || *c.PTRLookups
+}
+
+// Notification events (notifications.webhooks[].events).
+const (
+	EventBlocklistUpdateFailed = "blocklist_update_failed" // a blocklist source failed to download
+	EventUpstreamsDown         = "upstreams_down"          // every upstream circuit breaker is open
+	EventKillSwitchEngaged     = "kill_switch_engaged"     // blocklist or policies temporarily disabled
+	EventConfigReloaded        = "config_reloaded"         // config file change applied
+)
+
+// NotificationEvents lists every event a webhook can subscribe to.
+var NotificationEvents = []string{
+	EventBlocklistUpdateFailed,
+	EventUpstreamsDown,
+	EventKillSwitchEngaged,
+	EventConfigReloaded,
+}
+
+// NotificationsConfig sends operational events to external systems so they
+// can alert without scraping logs.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+// Webhook payload formats (notifications.webhooks[].format).
+const (
+	WebhookFormatJSON    = "json"    // generic event document (default)
+	WebhookFormatSlack   = "slack"   // Slack incoming webhook message
+	WebhookFormatDiscord = "discord" // Discord webhook embed
+)
+
+// WebhookConfig is one endpoint that receives events as a JSON POST.
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`     // http(s) endpoint
+	Format  string            `yaml:"format"`  // json (default), slack, or discord
+	Events  []string          `yaml:"events"`  // Events to send (empty = all)
+	Headers map[string]string `yaml:"headers"` // Extra request headers, e.g. Authorization
+}
+
+// Wants reports whether the webhook subscribes to event.
+func (w WebhookConfig) Wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// StaticAnswerEntry pins the response for one name and query type, e.g. a TXT
+// record or A address for an external domain. Unlike local records, other
+// query types for the same name are still resolved normally.
+type StaticAnswerEntry struct {
+	Domain string   `yaml:"domain" json:"domain"`
+	Type   string   `yaml:"type" json:"type"`               // Query type, e.g. A, TXT, HTTPS
+	TTL    uint32   `yaml:"ttl" json:"ttl,omitempty"`       // Answer TTL (default: 300)
+	Values []string `yaml:"values" json:"values,omitempty"` // RDATA in zone-file syntax, one record each; empty = no answers
+	Rcode  string   `yaml:"rcode" json:"rcode,omitempty"`   // Response code, e.g. NXDOMAIN (default: NOERROR)
+}
+
+// validateStaticAnswerEntry checks that an entry has a domain, parses, and
+// doesn't combine answers with an error rcode.
+func validateStaticAnswerEntry(e StaticAnswerEntry) error {
+	if strings.TrimSpace(e.Domain) == "" {
+		return fmt.Errorf("domain is required")
+	}
+	if _, err := e.RRs(); err != nil {
+		return err
+	}
+	rcode, err := e.ResponseCode()
+	if err != nil {
+		return err
+	}
+	if rcode != dns.RcodeSuccess && len(e.Values) > 0 {
+		return fmt.Errorf("values require rcode NOERROR")
+	}
+	return nil
+}
+
+// RRs builds the answer records for the entry.
+func (e StaticAnswerEntry) RRs() ([]dns.RR, error) {
+	qtype, ok := dns.StringToType[strings.ToUpper(e.Type)]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", e.Type)
+	}
+	ttl := e.TTL
+	if ttl == 0 {
+		ttl = defaultLocalRecordTTL
+	}
+	rrs := make([]dns.RR, 0, len(e.Values))
+	for _, value := range e.Values {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(e.Domain), ttl, dns.TypeToString[qtype], value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", e.Type, value, err)
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("empty %s value", e.Type)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// ResponseCode returns the entry's rcode (NOERROR when unset).
+func (e StaticAnswerEntry) ResponseCode() (int, error) {
+	if e.Rcode == "" {
+		return dns.RcodeSuccess, nil
+	}
+	rcode, ok := dns.StringToRcode[strings.ToUpper(e.Rcode)]
+	if !ok {
+		return 0, fmt.Errorf("unknown rcode %q", e.Rcode)
+	}
+	return rcode, nil
 }
 
 // LocalRecordsConfig holds local DNS records configuration
 type LocalRecordsConfig struct {
 	Records []LocalRecordEntry `yaml:"records"`
 	Enabled bool               `yaml:"enabled"`
+
+	// MaxCNAMEDepth caps how many CNAME hops an A/AAAA query follows through
+	// local records before giving up (0 = default 10).
+	MaxCNAMEDepth int `yaml:"max_cname_depth"`
+
+	// SOASerial bumps the serial of the SOA record covering a name whenever
+	// a record there is added, changed or removed through the API:
+	// "increment" adds one, "date" keeps YYYYMMDDnn. Empty or "off" leaves
+	// serials to the operator.
+	SOASerial string `yaml:"soa_serial"`
 }
 
+// SOA serial modes (local_records.soa_serial).
+const (
+	SOASerialOff       = "off"
+	SOASerialIncrement = "increment"
+	SOASerialDate      = "date"
+)
+
 // LocalRecordEntry represents a single local DNS record in the config
 type LocalRecordEntry struct {
-	CaaFlag    *uint8   `yaml:"caa_flag,omitempty"` // CAA: Flags (usually 0 or 128)
-	Priority   *uint16  `yaml:"priority,omitempty"`
-	Weight     *uint16  `yaml:"weight,omitempty"`
-	Port       *uint16  `yaml:"port,omitempty"`
-	Expire     *uint32  `yaml:"expire,omitempty"`
-	Minttl     *uint32  `yaml:"minttl,omitempty"`
-	Refresh    *uint32  `yaml:"refresh,omitempty"`
-	Retry      *uint32  `yaml:"retry,omitempty"`
-	Serial     *uint32  `yaml:"serial,omitempty"`
-	CaaTag     string   `yaml:"caa_tag,omitempty"`   // CAA: Tag (issue/issuewild/iodef)
-	CaaValue   string   `yaml:"caa_value,omitempty"` // CAA: Value (CA domain or URL)
-	Mbox       string   `yaml:"mbox,omitempty"`
-	Ns         string   `yaml:"ns,omitempty"`
-	Target     string   `yaml:"target"`
-	Type       string   `yaml:"type"`
-	Domain     string   `yaml:"domain"`
-	TxtRecords []string `yaml:"txt,omitempty"`
-	IPs        []string `yaml:"ips"`
-	TTL        uint32   `yaml:"ttl"`
-	Wildcard   bool     `yaml:"wildcard"`
+	CaaFlag    *uint8   `yaml:"caa_flag,omitempty" json:"caa_flag,omitempty"` // CAA: Flags (usually 0 or 128)
+	Priority   *uint16  `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Weight     *uint16  `yaml:"weight,omitempty" json:"weight,omitempty"`
+	Port       *uint16  `yaml:"port,omitempty" json:"port,omitempty"`
+	Expire     *uint32  `yaml:"expire,omitempty" json:"expire,omitempty"`
+	Minttl     *uint32  `yaml:"minttl,omitempty" json:"minttl,omitempty"`
+	Refresh    *uint32  `yaml:"refresh,omitempty" json:"refresh,omitempty"`
+	Retry      *uint32  `yaml:"retry,omitempty" json:"retry,omitempty"`
+	Serial     *uint32  `yaml:"serial,omitempty" json:"serial,omitempty"`
+	CaaTag     string   `yaml:"caa_tag,omitempty" json:"caa_tag,omitempty"`     // CAA: Tag (issue/issuewild/iodef)
+	CaaValue   string   `yaml:"caa_value,omitempty" json:"caa_value,omitempty"` // CAA: Value (CA domain or URL)
+	Mbox       string   `yaml:"mbox,omitempty" json:"mbox,omitempty"`
+	Ns         string   `yaml:"ns,omitempty" json:"ns,omitempty"`
+	Target     string   `yaml:"target" json:"target,omitempty"`
+	Type       string   `yaml:"type" json:"type"`
+	Domain     string   `yaml:"domain" json:"domain"`
+	TxtRecords []string `yaml:"txt,omitempty" json:"txt,omitempty"`
+	IPs        []string `yaml:"ips" json:"ips,omitempty"`
+	TTL        uint32   `yaml:"ttl" json:"ttl,omitempty"`
+	Wildcard   bool     `yaml:"wildcard" json:"wildcard,omitempty"`
+	// Enabled false keeps the record in the config without serving it.
+	// Unset means enabled.
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+// IsEnabled reports whether the record is served. Records are enabled unless
+// explicitly disabled.
+func (e *LocalRecordEntry) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// SetLocalRecordEnabled turns the records of recordType for domain on or off,
+// matching the domain without regard to case or a trailing dot. Enabling
+// clears the flag so the saved entry stays minimal. It returns how many
+// records matched.
+func SetLocalRecordEnabled(records []LocalRecordEntry, domain, recordType string, enabled bool) int {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	matched := 0
+	for i := range records {
+		e := &records[i]
+		if strings.TrimSuffix(strings.ToLower(e.Domain), ".") != domain || !strings.EqualFold(e.Type, recordType) {
+			continue
+		}
+		matched++
+		if enabled {
+			e.Enabled = nil
+		} else {
+			disabled := false
+			e.Enabled = &disabled
+		}
+	}
+	return matched
 }
 
 // PolicyConfig holds policy engine configuration
 type PolicyConfig struct {
 	Rules   []PolicyRuleEntry `yaml:"rules"`
 	Enabled bool              `yaml:"enabled"`
+
+	// WhitelistAlwaysWins makes domain-scoped ALLOW rules take precedence over
+	// any blocklist entry. By default the most specific match wins: a list
+	// entry for ads.example.com beats an ALLOW for *.example.com, and the
+	// query is then blocked without evaluating lower-priority rules.
+	WhitelistAlwaysWins bool `yaml:"whitelist_always_wins"`
 }
 
 // PolicyRuleEntry represents a single policy rule in the config
 type PolicyRuleEntry struct {
-	Name       string `yaml:"name"`        // Human-readable name
-	Logic      string `yaml:"logic"`       // Expression to evaluate
-	Action     string `yaml:"action"`      // Action: BLOCK, ALLOW, REDIRECT
-	ActionData string `yaml:"action_data"` // Optional action data (e.g., redirect target)
-	Enabled    bool   `yaml:"enabled"`     // Whether the rule is active
+	Name       string `yaml:"name"`               // Human-readable name
+	Logic      string `yaml:"logic"`              // Expression to evaluate
+	Action     string `yaml:"action"`             // Action: BLOCK, ALLOW, REDIRECT
+	ActionData string `yaml:"action_data"`        // Optional action data (e.g., redirect target)
+	Category   string `yaml:"category,omitempty"` // Optional block category for BLOCK rules
+	Priority   int    `yaml:"priority,omitempty"` // Higher is evaluated first; ties keep list order
+	Enabled    bool   `yaml:"enabled"`            // Whether the rule is active
 }
 
 // LoggingConfig holds logging settings
@@ -269,6 +947,38 @@ type TelemetryConfig struct {
 	TracingEnabled    bool   `yaml:"tracing_enabled"`
 	MetricsUsername   string `yaml:"metrics_username"` // Optional basic auth for /metrics endpoint
 	MetricsPassword   string `yaml:"metrics_password"` // Optional basic auth for /metrics endpoint
+
+	MetricsPasswordFile string `yaml:"metrics_password_file,omitempty"` // read metrics_password from this file
+
+	// TracingSampleRate is the fraction of DNS queries traced (0 < rate <= 1, default: 0.1)
+	TracingSampleRate float64 `yaml:"tracing_sample_rate"`
+
+	MetricLabels MetricLabelsConfig `yaml:"metric_labels"` // Label cardinality controls
+}
+
+// MetricLabelsConfig bounds the label cardinality of query metrics. Large
+// deployments see unusual query types (TYPE65534, ...) and thousands of
+// client/upstream values, each of which becomes a separate time series.
+type MetricLabelsConfig struct {
+	// BucketQueryTypes reports query types outside QueryTypes as "other".
+	BucketQueryTypes bool `yaml:"bucket_query_types"`
+	// QueryTypes kept as their own label when bucketing (default: A, AAAA,
+	// CNAME, MX, TXT, NS, SOA, PTR, SRV, HTTPS, SVCB, CAA, DS, DNSKEY, ANY).
+	QueryTypes []string `yaml:"query_types,omitempty"`
+	// Upstream and Client toggle the high-cardinality labels.
+	// Pointer so absent/nil = enabled (default), explicit `false` = disabled.
+	Upstream *bool `yaml:"upstream,omitempty"`
+	Client   *bool `yaml:"client,omitempty"`
+}
+
+// UpstreamEnabled reports whether metrics carry the upstream label. Default-on.
+func (m MetricLabelsConfig) UpstreamEnabled() bool {
+	return m.Upstream == nil || *m.Upstream
+}
+
+// ClientEnabled reports whether metrics carry the client label. Default-on.
+func (m MetricLabelsConfig) ClientEnabled() bool {
+	return m.Client == nil || *m.Client
 }
 
 // Load loads the configuration from a YAML file
@@ -286,6 +996,10 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
 	}
 
+	if err := cfg.loadSecretFiles(); err != nil {
+		return nil, err
+	}
+
 	// Apply defaults
 	cfg.applyDefaults()
 	cfg.applyEnvOverrides()
@@ -328,13 +1042,261 @@ func (c *Config) Clone() (*Config, error) {
 	return &clone, nil
 }
 
+// Marshal encodes the configuration as YAML, exactly as Save writes it.
+// Secrets read from a *_file are left out so Save never copies them into
+// the config file.
+func Marshal(cfg *Config) ([]byte, error) {
+	out := *cfg
+	// Secrets in slices and maps are cleared on a copy, not the caller's
+	out.Server.DoH.Tokens = append([]DoHTokenConfig(nil), cfg.Server.DoH.Tokens...)
+	if cfg.BlocklistAuth != nil {
+		out.BlocklistAuth = make(map[string]*BlocklistAuthConfig, len(cfg.BlocklistAuth))
+		for source, auth := range cfg.BlocklistAuth {
+			if auth != nil {
+				a := *auth
+				a.Headers = maps.Clone(auth.Headers)
+				auth = &a
+			}
+			out.BlocklistAuth[source] = auth
+		}
+	}
+	for _, secret := range out.secretFiles() {
+		if secret.path != "" {
+			secret.set("")
+		}
+	}
+	data, err := yaml.Marshal(&out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// secretFile pairs a secret with the file it may be read from instead. The
+// secret is *value, or headers[header] for a blocklist_auth header.
+type secretFile struct {
+	key     string // YAML path of the inline secret
+	value   *string
+	path    string
+	fileKey string // YAML path of the file option, if not key + "_file"
+	headers map[string]string
+	header  string
+}
+
+func (s secretFile) get() string {
+	if s.value == nil {
+		return s.headers[s.header]
+	}
+	return *s.value
+}
+
+// set stores the secret; an empty header value removes the header.
+func (s secretFile) set(v string) {
+	switch {
+	case s.value != nil:
+		*s.value = v
+	case v == "":
+		delete(s.headers, s.header)
+	default:
+		s.headers[s.header] = v
+	}
+}
+
+func (c *Config) secretFiles() []secretFile {
+	secrets := []secretFile{
+		{key: "auth.api_key", value: &c.Auth.APIKey, path: c.Auth.APIKeyFile},
+		{key: "auth.password_hash", value: &c.Auth.PasswordHash, path: c.Auth.PasswordHashFile},
+		{key: "server.tls.acme.cloudflare.api_token", value: &c.Server.TLS.ACME.Cloudflare.APIToken, path: c.Server.TLS.ACME.Cloudflare.APITokenFile},
+		{key: "telemetry.metrics_password", value: &c.Telemetry.MetricsPassword, path: c.Telemetry.MetricsPasswordFile},
+	}
+	for i := range c.Server.DoH.Tokens {
+		t := &c.Server.DoH.Tokens[i]
+		secrets = append(secrets, secretFile{key: fmt.Sprintf("server.doh.tokens[%d].token", i), value: &t.Token, path: t.TokenFile})
+	}
+	for _, source := range slices.Sorted(maps.Keys(c.BlocklistAuth)) {
+		a := c.BlocklistAuth[source]
+		if a == nil {
+			continue
+		}
+		secrets = append(secrets,
+			secretFile{key: fmt.Sprintf("blocklist_auth[%s].password", source), value: &a.Password, path: a.PasswordFile},
+			secretFile{key: fmt.Sprintf("blocklist_auth[%s].bearer_token", source), value: &a.BearerToken, path: a.BearerTokenFile},
+		)
+		if len(a.HeaderFiles) > 0 && a.Headers == nil {
+			a.Headers = make(map[string]string, len(a.HeaderFiles))
+		}
+		for _, name := range slices.Sorted(maps.Keys(a.HeaderFiles)) {
+			secrets = append(secrets, secretFile{
+				key:     fmt.Sprintf("blocklist_auth[%s].headers.%s", source, name),
+				path:    a.HeaderFiles[name],
+				fileKey: fmt.Sprintf("blocklist_auth[%s].header_files.%s", source, name),
+				headers: a.Headers,
+				header:  name,
+			})
+		}
+	}
+	return secrets
+}
+
+// loadSecretFiles fills each secret that names a *_file from that file, so
+// container secrets (/run/secrets/...) never have to be pasted into the
+// config. Surrounding whitespace, including the trailing newline most
+// secret files end with, is trimmed. Setting both forms is an error.
+func (c *Config) loadSecretFiles() error {
+	for _, secret := range c.secretFiles() {
+		if secret.path == "" {
+			continue
+		}
+		fileKey := secret.fileKey
+		if fileKey == "" {
+			fileKey = secret.key + "_file"
+		}
+		if secret.get() != "" {
+			return fmt.Errorf("%s and %s are mutually exclusive", secret.key, fileKey)
+		}
+		// #nosec G304 - secret file path comes from the operator's config
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", fileKey, err)
+		}
+		secret.set(strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// blocklistSourceKeys returns the keys of every setting keyed by blocklist
+// URL, by YAML name.
+func (c *Config) blocklistSourceKeys() map[string][]string {
+	return map[string][]string{
+		"blocklist_names":             slices.Collect(maps.Keys(c.BlocklistNames)),
+		"blocklist_categories":        slices.Collect(maps.Keys(c.BlocklistCategories)),
+		"blocklist_match":             slices.Collect(maps.Keys(c.BlocklistMatch)),
+		"blocklist_descriptions":      slices.Collect(maps.Keys(c.BlocklistDescriptions)),
+		"blocklist_auth":              slices.Collect(maps.Keys(c.BlocklistAuth)),
+		"cache.blocked_ttl_by_source": slices.Collect(maps.Keys(c.Cache.BlockedTTLBySource)),
+	}
+}
+
+// checkBlocklistSourceKeys rejects per-source settings for URLs missing from
+// blocklists, which are otherwise silently ignored (usually a typo or a
+// source that was removed).
+func (c *Config) checkBlocklistSourceKeys() error {
+	listed := make(map[string]bool, len(c.Blocklists))
+	for _, source := range c.Blocklists {
+		listed[source] = true
+	}
+	keys := c.blocklistSourceKeys()
+	for _, field := range slices.Sorted(maps.Keys(keys)) {
+		slices.Sort(keys[field])
+		for _, source := range keys[field] {
+			if !listed[source] {
+				return fmt.Errorf("%s[%s]: not listed in blocklists", field, source)
+			}
+		}
+	}
+	return nil
+}
+
+// PruneBlocklistSettings drops per-source settings for URLs no longer in
+// blocklists, so removing a source keeps the config valid. The maps are
+// replaced rather than edited, leaving any config sharing them untouched.
+func (c *Config) PruneBlocklistSettings() {
+	listed := func(source string) bool { return slices.Contains(c.Blocklists, source) }
+	c.BlocklistNames = pruneSources(c.BlocklistNames, listed)
+	c.BlocklistCategories = pruneSources(c.BlocklistCategories, listed)
+	c.BlocklistMatch = pruneSources(c.BlocklistMatch, listed)
+	c.BlocklistDescriptions = pruneSources(c.BlocklistDescriptions, listed)
+	c.BlocklistAuth = pruneSources(c.BlocklistAuth, listed)
+	c.Cache.BlockedTTLBySource = pruneSources(c.Cache.BlockedTTLBySource, listed)
+}
+
+func pruneSources[V any](m map[string]V, keep func(string) bool) map[string]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]V, len(m))
+	for source, v := range m {
+		if keep(source) {
+			out[source] = v
+		}
+	}
+	return out
+}
+
+// redactedValue replaces secrets in Redacted output.
+const redactedValue = "REDACTED"
+
+// Redacted returns a deep copy of the configuration with credentials (API
+// keys, passwords and hashes, the Cloudflare token) masked, for sharing or
+// printing. Empty fields stay empty so it is still clear what is unset.
+func (c *Config) Redacted() (*Config, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range []*string{
+		&clone.Auth.APIKey,
+		&clone.Auth.Password,
+		&clone.Auth.PasswordHash,
+		&clone.Server.TLS.ACME.Cloudflare.APIToken,
+		&clone.Telemetry.MetricsPassword,
+	} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	for i := range clone.Server.DoH.Tokens {
+		if clone.Server.DoH.Tokens[i].Token != "" {
+			clone.Server.DoH.Tokens[i].Token = redactedValue
+		}
+	}
+	// Custom headers usually carry an API key, so their values go too
+	for _, auth := range clone.BlocklistAuth {
+		if auth == nil {
+			continue
+		}
+		for _, secret := range []*string{&auth.Password, &auth.BearerToken} {
+			if *secret != "" {
+				*secret = redactedValue
+			}
+		}
+		for name := range auth.Headers {
+			auth.Headers[name] = redactedValue
+		}
+	}
+	// Slack and Discord put the webhook secret in the URL path
+	for i := range clone.Notifications.Webhooks {
+		hook := &clone.Notifications.Webhooks[i]
+		hook.URL = redactURL(hook.URL)
+		for name := range hook.Headers {
+			hook.Headers[name] = redactedValue
+		}
+	}
+	return clone, nil
+}
+
+// redactURL keeps only the scheme and host of raw, masking any path, query
+// or userinfo.
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redactedValue
+	}
+	if u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == "" {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
+
 // Save writes the configuration back to a YAML file
 // This is used by the kill-switch feature to persist runtime changes
 func Save(path string, cfg *Config) error {
-	// Marshal config to YAML
-	data, err := yaml.Marshal(cfg)
+	data, err := Marshal(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
 	}
 
 	// Write atomically: write to temp file, then rename
@@ -368,6 +1330,33 @@ func (c *Config) applyDefaults() {
 	if c.Server.DotAddress == "" {
 		c.Server.DotAddress = ":853"
 	}
+	if c.Server.DoH.Path == "" {
+		c.Server.DoH.Path = DefaultDoHPath
+	}
+	if c.Server.MaxUDPSize == 0 {
+		c.Server.MaxUDPSize = DefaultMaxUDPSize
+	}
+	if c.Server.MaxTCPConnections == 0 {
+		c.Server.MaxTCPConnections = DefaultMaxTCPConnections
+	}
+	if c.Server.TCPIdleTimeout == 0 {
+		c.Server.TCPIdleTimeout = DefaultTCPIdleTimeout
+	}
+	if c.RateLimit.IPv4Prefix == 0 {
+		c.RateLimit.IPv4Prefix = DefaultRateLimitIPv4Prefix
+	}
+	if c.RateLimit.IPv6Prefix == 0 {
+		c.RateLimit.IPv6Prefix = DefaultRateLimitIPv6Prefix
+	}
+	if c.Server.HealthName.Name == "" {
+		c.Server.HealthName.Name = DefaultHealthName
+	}
+	if c.Server.HealthName.IP == "" {
+		c.Server.HealthName.IP = DefaultHealthNameIP
+	}
+	if c.Server.OverrideTTL == 0 {
+		c.Server.OverrideTTL = DefaultOverrideTTL
+	}
 	if c.Server.TLS.Autocert.HTTP01Address == "" {
 		c.Server.TLS.Autocert.HTTP01Address = ":80"
 	}
@@ -393,6 +1382,27 @@ func (c *Config) applyDefaults() {
 	if c.Server.TLS.ACME.Cloudflare.InitialDelay == 0 {
 		c.Server.TLS.ACME.Cloudflare.InitialDelay = 10 * time.Second
 	}
+	if c.Server.AnomalyDetection.Window == 0 {
+		c.Server.AnomalyDetection.Window = time.Minute
+	}
+	if c.Server.AnomalyDetection.ClientUniqueDomains == 0 {
+		c.Server.AnomalyDetection.ClientUniqueDomains = 1000
+	}
+	if c.Server.AnomalyDetection.UniqueSubdomains == 0 {
+		c.Server.AnomalyDetection.UniqueSubdomains = 100
+	}
+	if c.Server.AnyQuery == "" {
+		c.Server.AnyQuery = AnyQueryMinimal
+	}
+	if c.Server.MalformedQueries.MultiQuestion == "" {
+		c.Server.MalformedQueries.MultiQuestion = MalformedRefuse
+	}
+	if c.Server.MalformedQueries.UnsupportedOpcode == "" {
+		c.Server.MalformedQueries.UnsupportedOpcode = MalformedNotImp
+	}
+	if len(c.Server.SpecialUseNames.Names) == 0 {
+		c.Server.SpecialUseNames.Names = append([]string(nil), DefaultSpecialUseNames...)
+	}
 
 	// Kill-switch defaults: Enable both if neither is explicitly configured
 	// This provides backward compatibility (both enabled by default)
@@ -414,6 +1424,12 @@ func (c *Config) applyDefaults() {
 	if c.UpdateInterval == 0 {
 		c.UpdateInterval = 24 * time.Hour
 	}
+	if c.BlocklistLoading.ShrinkGrace == 0 {
+		c.BlocklistLoading.ShrinkGrace = DefaultBlocklistShrinkGrace
+	}
+	if c.Startup.MaxWait == 0 {
+		c.Startup.MaxWait = DefaultStartupMaxWait
+	}
 
 	// Database defaults
 	if c.Database.Backend == "" {
@@ -443,6 +1459,18 @@ func (c *Config) applyDefaults() {
 	if c.Database.RetentionDays == 0 {
 		c.Database.RetentionDays = 7
 	}
+	if c.Database.SampleRate == 0 {
+		c.Database.SampleRate = 1
+	}
+	if c.Database.Backpressure == "" {
+		c.Database.Backpressure = storage.BackpressureDrop
+	}
+	if c.Database.Backpressure == storage.BackpressureBlock && c.Database.BackpressureTimeout == 0 {
+		c.Database.BackpressureTimeout = storage.DefaultBackpressureTimeout
+	}
+	if c.Database.MaxRestoreSize == 0 {
+		c.Database.MaxRestoreSize = storage.DefaultMaxRestoreSize
+	}
 	if c.Database.Statistics.AggregationInterval == 0 {
 		c.Database.Statistics.AggregationInterval = 1 * time.Hour
 	}
@@ -496,6 +1524,13 @@ func (c *Config) applyDefaults() {
 	if c.Telemetry.PrometheusPort == 0 {
 		c.Telemetry.PrometheusPort = 9090
 	}
+	if c.Telemetry.TracingSampleRate == 0 {
+		c.Telemetry.TracingSampleRate = 0.1
+	}
+
+	if c.ClientDiscovery.Interval == 0 {
+		c.ClientDiscovery.Interval = 5 * time.Minute
+	}
 
 	// Unbound defaults
 	if c.Unbound.ConfigPath == "" {
@@ -538,22 +1573,29 @@ func (c *Config) applyEnvOverrides() {
 	c.Auth.normalize()
 }
 
-// UDPAddr returns the effective listen address for the UDP server.
-// It prefers UDPListenAddress, falling back to ListenAddress.
-func (s *ServerConfig) UDPAddr() string {
+// UDPAddrs returns the effective listen addresses for the UDP server.
+// It prefers UDPListenAddress, then ListenAddresses, then ListenAddress.
+func (s *ServerConfig) UDPAddrs() []string {
 	if s.UDPListenAddress != "" {
-		return s.UDPListenAddress
+		return []string{s.UDPListenAddress}
 	}
-	return s.ListenAddress
+	return s.listenAddrs()
 }
 
-// TCPAddr returns the effective listen address for the TCP server.
-// It prefers TCPListenAddress, falling back to ListenAddress.
-func (s *ServerConfig) TCPAddr() string {
+// TCPAddrs returns the effective listen addresses for the TCP server.
+// It prefers TCPListenAddress, then ListenAddresses, then ListenAddress.
+func (s *ServerConfig) TCPAddrs() []string {
 	if s.TCPListenAddress != "" {
-		return s.TCPListenAddress
+		return []string{s.TCPListenAddress}
+	}
+	return s.listenAddrs()
+}
+
+func (s *ServerConfig) listenAddrs() []string {
+	if len(s.ListenAddresses) > 0 {
+		return s.ListenAddresses
 	}
-	return s.ListenAddress
+	return []string{s.ListenAddress}
 }
 
 // Validate checks if the configuration is valid
@@ -565,6 +1607,28 @@ func (c *Config) Validate() error {
 	if !c.Server.TCPEnabled && !c.Server.UDPEnabled {
 		return fmt.Errorf("at least one of TCP or UDP must be enabled")
 	}
+	if c.Server.UDPWorkers < 0 {
+		return fmt.Errorf("server.udp_workers must be >= 0")
+	}
+	if c.Server.MaxUDPSize != 0 && (c.Server.MaxUDPSize < 512 || c.Server.MaxUDPSize > 65535) {
+		return fmt.Errorf("server.max_udp_size must be between 512 and 65535, got %d", c.Server.MaxUDPSize)
+	}
+	if c.Server.OverrideTTL < 0 || (c.Server.OverrideTTL > 0 && c.Server.OverrideTTL < time.Second) {
+		return fmt.Errorf("server.override_ttl must be at least 1s, got %s", c.Server.OverrideTTL)
+	}
+	if c.Server.OverrideTTL > 7*24*time.Hour {
+		return fmt.Errorf("server.override_ttl must be at most 168h, got %s", c.Server.OverrideTTL)
+	}
+	seenListen := make(map[string]bool, len(c.Server.ListenAddresses))
+	for _, addr := range c.Server.ListenAddresses {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("server.listen_addresses: invalid address %q: %w", addr, err)
+		}
+		if seenListen[addr] {
+			return fmt.Errorf("server.listen_addresses: duplicate address %q", addr)
+		}
+		seenListen[addr] = true
+	}
 
 	if c.Server.DotEnabled {
 		if strings.TrimSpace(c.Server.DotAddress) == "" {
@@ -582,8 +1646,8 @@ func (c *Config) Validate() error {
 			if len(c.Server.TLS.Autocert.Hosts) == 0 {
 				return fmt.Errorf("tls.autocert.hosts must be set when autocert is enabled")
 			}
-			if strings.TrimSpace(c.Server.TLS.Autocert.HTTP01Address) == "" {
-				return fmt.Errorf("tls.autocert.http01_address must be set when autocert is enabled")
+			if !c.Server.TLS.Autocert.HTTP01ViaAPI && strings.TrimSpace(c.Server.TLS.Autocert.HTTP01Address) == "" {
+				return fmt.Errorf("tls.autocert.http01_address must be set when autocert is enabled (or set http01_via_api)")
 			}
 		}
 
@@ -614,6 +1678,14 @@ func (c *Config) Validate() error {
 	if len(c.UpstreamDNSServers) == 0 {
 		return fmt.Errorf("at least one upstream DNS server must be configured")
 	}
+	for _, upstream := range c.UpstreamDNSServers {
+		if !dnscrypt.IsUpstream(upstream) {
+			continue
+		}
+		if _, err := dnscrypt.ParseUpstream(upstream); err != nil {
+			return fmt.Errorf("upstream_dns_servers: %w", err)
+		}
+	}
 
 	// Validate logging level
 	validLevels := map[string]bool{
@@ -644,6 +1716,295 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("logging.file_path must be set when output is 'file'")
 	}
 
+	if c.Server.SlowQueryThreshold < 0 {
+		return fmt.Errorf("server.slow_query_threshold must be >= 0")
+	}
+
+	if c.ClientDiscovery.Interval < 0 {
+		return fmt.Errorf("client_discovery.interval must be >= 0")
+	}
+
+	for i, entry := range c.StaticAnswers {
+		if err := validateStaticAnswerEntry(entry); err != nil {
+			return fmt.Errorf("static_answers[%d] (%s): %w", i, entry.Domain, err)
+		}
+	}
+
+	for i, hook := range c.Notifications.Webhooks {
+		u, err := url.Parse(hook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notifications.webhooks[%d].url must be an http(s) URL, got %q", i, hook.URL)
+		}
+		switch hook.Format {
+		case "", WebhookFormatJSON, WebhookFormatSlack, WebhookFormatDiscord:
+		default:
+			return fmt.Errorf("notifications.webhooks[%d].format must be json, slack or discord, got %q", i, hook.Format)
+		}
+		for _, event := range hook.Events {
+			if !slices.Contains(NotificationEvents, event) {
+				return fmt.Errorf("notifications.webhooks[%d]: unknown event %q (valid: %s)", i, event, strings.Join(NotificationEvents, ", "))
+			}
+		}
+	}
+
+	if err := c.checkBlocklistSourceKeys(); err != nil {
+		return err
+	}
+
+	for source, category := range c.BlocklistCategories {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf("blocklist_categories[%s] must not be empty", source)
+		}
+	}
+
+	namedSources := make(map[string]string, len(c.BlocklistNames))
+	for source, name := range c.BlocklistNames {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("blocklist_names[%s] must not be empty", source)
+		}
+		if other, dup := namedSources[name]; dup {
+			a, b := min(source, other), max(source, other)
+			return fmt.Errorf("blocklist_names: %s and %s share the name %q", a, b, name)
+		}
+		namedSources[name] = source
+	}
+
+	for category, ips := range c.BlocklistRedirects {
+		if strings.TrimSpace(category) == "" {
+			return fmt.Errorf("blocklist_redirects: category must not be empty")
+		}
+		if len(ips) == 0 {
+			return fmt.Errorf("blocklist_redirects[%s] must list at least one sink IP", category)
+		}
+		for _, ip := range ips {
+			if net.ParseIP(ip) == nil {
+				return fmt.Errorf("blocklist_redirects[%s]: invalid IP address %q", category, ip)
+			}
+		}
+	}
+
+	for source, mode := range c.BlocklistMatch {
+		if mode != BlocklistMatchSuffix && mode != BlocklistMatchExact {
+			return fmt.Errorf("blocklist_match[%s] must be suffix or exact, got %q", source, mode)
+		}
+	}
+
+	for source, auth := range c.BlocklistAuth {
+		if err := auth.validate(); err != nil {
+			return fmt.Errorf("blocklist_auth[%s]: %w", source, err)
+		}
+	}
+
+	for source, ttl := range c.Cache.BlockedTTLBySource {
+		if ttl < 0 {
+			return fmt.Errorf("cache.blocked_ttl_by_source[%s] must be >= 0", source)
+		}
+	}
+
+	if c.Cache.StaleWhileRevalidate < 0 {
+		return fmt.Errorf("cache.stale_while_revalidate must be >= 0")
+	}
+
+	if p := c.Server.DoH.Path; p != "" {
+		if !strings.HasPrefix(p, "/") || p == "/" || strings.HasPrefix(p, "/api/") || strings.ContainsAny(p, " {}?#") {
+			return fmt.Errorf("invalid server.doh.path: %q (must be an absolute path outside /api/)", p)
+		}
+		if route := dohPathConflict(p); route != "" {
+			return fmt.Errorf("invalid server.doh.path: %q conflicts with the %s route", p, route)
+		}
+	}
+	dohTokens := make(map[string]bool, len(c.Server.DoH.Tokens))
+	for i, t := range c.Server.DoH.Tokens {
+		if t.Token == "" && t.TokenFile == "" {
+			return fmt.Errorf("server.doh.tokens[%d]: token or token_file is required", i)
+		}
+		if strings.TrimSpace(t.Group) == "" {
+			return fmt.Errorf("server.doh.tokens[%d]: group is required", i)
+		}
+		if t.Token == "" {
+			continue // read from token_file at load
+		}
+		if strings.ContainsAny(t.Token, "/ {}?#%") {
+			return fmt.Errorf("server.doh.tokens[%d]: token must not contain '/', spaces, or URL metacharacters", i)
+		}
+		if dohTokens[t.Token] {
+			return fmt.Errorf("server.doh.tokens[%d]: duplicate token", i)
+		}
+		dohTokens[t.Token] = true
+	}
+	if c.Server.DoH.RequireToken && len(c.Server.DoH.Tokens) == 0 {
+		return fmt.Errorf("server.doh.require_token needs at least one server.doh.tokens entry")
+	}
+
+	switch c.Server.AnyQuery {
+	case "", AnyQueryMinimal, AnyQueryRefuse, AnyQueryForward:
+	default:
+		return fmt.Errorf("invalid server.any_query: %s (must be minimal, refuse, or forward)", c.Server.AnyQuery)
+	}
+	if c.Server.MaxTCPConnections < -1 {
+		return fmt.Errorf("server.max_tcp_connections must be -1 (unlimited) or more, got %d", c.Server.MaxTCPConnections)
+	}
+	if c.Server.TCPIdleTimeout < 0 || (c.Server.TCPIdleTimeout > 0 && c.Server.TCPIdleTimeout < 100*time.Millisecond) {
+		return fmt.Errorf("server.tcp_idle_timeout must be at least 100ms, got %s", c.Server.TCPIdleTimeout)
+	}
+	if p := c.RateLimit.IPv4Prefix; p < 0 || p > 32 {
+		return fmt.Errorf("rate_limit.ipv4_prefix must be between 1 and 32, got %d", p)
+	}
+	if p := c.RateLimit.IPv6Prefix; p < 0 || p > 128 {
+		return fmt.Errorf("rate_limit.ipv6_prefix must be between 1 and 128, got %d", p)
+	}
+	if hn := c.Server.HealthName; hn.IsEnabled() {
+		if hn.Name != "" {
+			if _, ok := dns.IsDomainName(hn.Name); !ok || strings.Trim(hn.Name, ".") == "" {
+				return fmt.Errorf("invalid server.health_name.name: %q", hn.Name)
+			}
+		}
+		if hn.IP != "" && net.ParseIP(hn.IP) == nil {
+			return fmt.Errorf("invalid server.health_name.ip: %q", hn.IP)
+		}
+	}
+	switch c.Server.PrivateReverse.Mode {
+	case "", PrivateReverseForward, PrivateReverseLocal:
+	case PrivateReverseUpstream:
+		if len(c.Server.PrivateReverse.Upstreams) == 0 {
+			return fmt.Errorf("server.private_reverse.upstreams is required when mode is upstream")
+		}
+		for _, upstream := range c.Server.PrivateReverse.Upstreams {
+			if _, _, err := net.SplitHostPort(upstream); err != nil {
+				return fmt.Errorf("invalid server.private_reverse upstream %q: %w", upstream, err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid server.private_reverse.mode: %s (must be forward, local, or upstream)", c.Server.PrivateReverse.Mode)
+	}
+	for _, name := range c.Server.RefusedTypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return fmt.Errorf("invalid server.refused_types entry: %q is not a DNS record type", name)
+		}
+		if qtype == dns.TypeANY {
+			return fmt.Errorf("server.refused_types cannot contain ANY (use server.any_query)")
+		}
+	}
+
+	for group, names := range c.Server.AllowedTypes {
+		if strings.TrimSpace(group) == "" {
+			return fmt.Errorf("server.allowed_types: group name is required")
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("server.allowed_types.%s: list at least one query type", group)
+		}
+		for _, name := range names {
+			if _, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]; !ok {
+				return fmt.Errorf("invalid server.allowed_types.%s entry: %q is not a DNS record type", group, name)
+			}
+		}
+	}
+
+	switch c.Server.MalformedQueries.MultiQuestion {
+	case "", MalformedRefuse, MalformedFormErr:
+	default:
+		return fmt.Errorf("invalid server.malformed_queries.multi_question: %s (must be refuse or formerr)", c.Server.MalformedQueries.MultiQuestion)
+	}
+	switch c.Server.MalformedQueries.UnsupportedOpcode {
+	case "", MalformedNotImp, MalformedRefuse:
+	default:
+		return fmt.Errorf("invalid server.malformed_queries.unsupported_opcode: %s (must be notimp or refuse)", c.Server.MalformedQueries.UnsupportedOpcode)
+	}
+	if c.Server.MalformedQueries.MaxQNameLength < 0 {
+		return fmt.Errorf("server.malformed_queries.max_qname_length must be >= 0")
+	}
+	for _, entry := range c.Server.ZoneTransfer.AllowedClients {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid server.zone_transfer.allowed_clients entry: %q is not an IP or CIDR", entry)
+		}
+	}
+	for _, zone := range c.Server.ZoneTransfer.Zones {
+		if _, ok := dns.IsDomainName(strings.TrimSpace(zone)); !ok || strings.TrimSpace(zone) == "" {
+			return fmt.Errorf("invalid server.zone_transfer.zones entry: %q is not a domain name", zone)
+		}
+	}
+
+	if c.Server.Debug.enabled() && !allowDebug.Load() {
+		return fmt.Errorf("server.debug options are for development only and require the --allow-debug flag")
+	}
+	if c.Server.Debug.InjectLatency < 0 {
+		return fmt.Errorf("server.debug.inject_latency must be >= 0")
+	}
+
+	if c.Server.AnomalyDetection.Window < 0 {
+		return fmt.Errorf("server.anomaly_detection.window must be >= 0")
+	}
+
+	if c.Server.QueryQuota.DailyLimit < 0 {
+		return fmt.Errorf("server.query_quota.daily_limit must be >= 0")
+	}
+	for group, limit := range c.Server.QueryQuota.Groups {
+		if strings.TrimSpace(group) == "" {
+			return fmt.Errorf("server.query_quota.groups: group name must not be empty")
+		}
+		if limit < 0 {
+			return fmt.Errorf("server.query_quota.groups[%s] must be >= 0", group)
+		}
+	}
+	switch c.Server.QueryQuota.Action {
+	case "", QuotaActionRefused, QuotaActionNXDomain, QuotaActionDrop, QuotaActionTruncate:
+	default:
+		return fmt.Errorf("server.query_quota.action must be %q, %q, %q or %q, got %q",
+			QuotaActionRefused, QuotaActionNXDomain, QuotaActionDrop, QuotaActionTruncate, c.Server.QueryQuota.Action)
+	}
+
+	if c.Forwarder.MaxConcurrent < 0 {
+		return fmt.Errorf("forwarder.max_concurrent must be >= 0")
+	}
+	if c.BlocklistLoading.Concurrency < 0 || c.BlocklistLoading.Concurrency > MaxBlocklistLoadConcurrency {
+		return fmt.Errorf("blocklist_loading.concurrency must be between 0 and %d", MaxBlocklistLoadConcurrency)
+	}
+	if t := c.BlocklistLoading.ShrinkThresholdValue(); t < 0 || t > 1 {
+		return fmt.Errorf("blocklist_loading.shrink_threshold must be between 0 and 1, got %v", t)
+	}
+	if c.BlocklistLoading.ShrinkGrace < 0 {
+		return fmt.Errorf("blocklist_loading.shrink_grace must be >= 0")
+	}
+	if c.BlocklistLoading.Jitter < 0 {
+		return fmt.Errorf("blocklist_loading.jitter must be >= 0")
+	}
+	if c.Startup.MaxWait < 0 {
+		return fmt.Errorf("startup.max_wait must be >= 0")
+	}
+	if c.Forwarder.QueueTimeout < 0 {
+		return fmt.Errorf("forwarder.queue_timeout must be >= 0")
+	}
+	if c.LocalRecords.MaxCNAMEDepth < 0 {
+		return fmt.Errorf("local_records.max_cname_depth must be >= 0")
+	}
+	switch c.LocalRecords.SOASerial {
+	case "", SOASerialOff, SOASerialIncrement, SOASerialDate:
+	default:
+		return fmt.Errorf("local_records.soa_serial must be off, increment or date, got %q", c.LocalRecords.SOASerial)
+	}
+
+	if c.Database.SampleRate < 0 || c.Database.SampleRate > 1 {
+		return fmt.Errorf("database.sample_rate must be between 0 and 1, got %v", c.Database.SampleRate)
+	}
+	switch c.Database.Backpressure {
+	case "", storage.BackpressureDrop, storage.BackpressureBlock:
+	default:
+		return fmt.Errorf("database.backpressure must be %q or %q, got %q",
+			storage.BackpressureDrop, storage.BackpressureBlock, c.Database.Backpressure)
+	}
+	if c.Database.BackpressureTimeout < 0 {
+		return fmt.Errorf("database.backpressure_timeout must not be negative, got %v", c.Database.BackpressureTimeout)
+	}
+	if c.Database.MaxRestoreSize < 0 {
+		return fmt.Errorf("database.max_restore_size must not be negative, got %d", c.Database.MaxRestoreSize)
+	}
+
+	if c.Telemetry.TracingSampleRate < 0 || c.Telemetry.TracingSampleRate > 1 {
+		return fmt.Errorf("telemetry.tracing_sample_rate must be between 0 and 1, got %v", c.Telemetry.TracingSampleRate)
+	}
+
 	if c.Auth.Enabled {
 		c.Auth.normalize()
 		hasAPIKey := strings.TrimSpace(c.Auth.APIKey) != ""
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"glory-hole/pkg/storage"
 )
 
 func TestLoad(t *testing.T) {
@@ -110,15 +115,16 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "invalid log level",
+			name: "invalid any_query mode",
 			cfg: &Config{
 				Server: ServerConfig{
 					ListenAddress: ":53",
 					UDPEnabled:    true,
+					AnyQuery:      "drop",
 				},
 				UpstreamDNSServers: []string{"1.1.1.1:53"},
 				Logging: LoggingConfig{
-					Level:  "invalid",
+					Level:  "info",
 					Format: "text",
 					Output: "stdout",
 				},
@@ -126,36 +132,1089 @@ func TestValidate(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "file output without path",
+			name: "valid listen_addresses",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:   ":53",
+					ListenAddresses: []string{"192.168.1.2:53", "[fd00::2]:53"},
+					UDPEnabled:      true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "listen_addresses without port",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:   ":53",
+					ListenAddresses: []string{"192.168.1.2"},
+					UDPEnabled:      true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate listen_addresses",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:   ":53",
+					ListenAddresses: []string{"192.168.1.2:53", "192.168.1.2:53"},
+					UDPEnabled:      true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative udp_workers",
 			cfg: &Config{
 				Server: ServerConfig{
 					ListenAddress: ":53",
 					UDPEnabled:    true,
+					UDPWorkers:    -1,
 				},
 				UpstreamDNSServers: []string{"1.1.1.1:53"},
 				Logging: LoggingConfig{
 					Level:  "info",
 					Format: "text",
-					Output: "file",
+					Output: "stdout",
 				},
 			},
 			wantErr: true,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.cfg.Validate()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestLoadNonExistentFile(t *testing.T) {
-	_, err := Load("nonexistent.yml")
-	if err == nil {
-		t.Error("Expected error when loading non-existent file")
+		{
+			name: "max_udp_size below 512",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					MaxUDPSize:    256,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "override_ttl below one second",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					OverrideTTL:   500 * time.Millisecond,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative forwarder max_concurrent",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Forwarder:          ForwarderConfig{MaxConcurrent: -1},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "database sample_rate above 1",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Database:           storage.Config{SampleRate: 1.5},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown database backpressure mode",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Database:           storage.Config{Backpressure: "wait"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed dnscrypt upstream",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53", "sdns://not-a-stamp"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown refused type",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					RefusedTypes:  []string{"HTTPS", "BOGUS"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "private_reverse upstream mode without upstreams",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:  ":53",
+					UDPEnabled:     true,
+					PrivateReverse: PrivateReverseConfig{Mode: PrivateReverseUpstream},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative query_quota group limit",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					QueryQuota:    QueryQuotaConfig{Enabled: true, DailyLimit: 10000, Groups: map[string]int{"iot": -1}},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown query_quota action",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					QueryQuota:    QueryQuotaConfig{Enabled: true, DailyLimit: 10000, Action: "servfail"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "webhook with unknown event",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Notifications: NotificationsConfig{Webhooks: []WebhookConfig{
+					{URL: "https://hooks.example.com/dns", Events: []string{"blocklist_updated"}},
+				}},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "webhook with unknown format",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Notifications: NotificationsConfig{Webhooks: []WebhookConfig{
+					{URL: "https://hooks.example.com/dns", Format: "teams"},
+				}},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "static answer with invalid value",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				StaticAnswers:      []StaticAnswerEntry{{Domain: "example.com", Type: "A", Values: []string{"not-an-ip"}}},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty blocklist category",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers:  []string{"1.1.1.1:53"},
+				Blocklists:          []string{"https://example.com/ads.txt"},
+				BlocklistCategories: map[string]string{"https://example.com/ads.txt": " "},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate blocklist name",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Blocklists:         []string{"https://example.com/ads.txt", "https://example.org/more.txt"},
+				BlocklistNames: map[string]string{
+					"https://example.com/ads.txt":  "Ads",
+					"https://example.org/more.txt": " Ads ",
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max cname depth",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				LocalRecords:       LocalRecordsConfig{MaxCNAMEDepth: -1},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative stale while revalidate",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Cache:              CacheConfig{StaleWhileRevalidate: -time.Second},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "doh path under /api/",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH:           DoHConfig{Path: "/api/dns"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "doh path on the liveness route",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH:           DoHConfig{Path: "/health"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "doh path above a dashboard route",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH:           DoHConfig{Path: "/resolver"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "doh path under static assets",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH:           DoHConfig{Path: "/_astro/dns"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative doh path",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH:           DoHConfig{Path: "dns-query"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid malformed multi_question",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:    ":53",
+					UDPEnabled:       true,
+					MalformedQueries: MalformedQueriesConfig{MultiQuestion: "drop"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max qname length",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:    ":53",
+					UDPEnabled:       true,
+					MalformedQueries: MalformedQueriesConfig{MaxQNameLength: -1},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid zone transfer client",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					ZoneTransfer:  ZoneTransferConfig{AllowedClients: []string{"secondary.lan"}},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid zone transfer zone",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					ZoneTransfer:  ZoneTransferConfig{Zones: []string{" "}},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid soa_serial mode",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				LocalRecords:       LocalRecordsConfig{SOASerial: "timestamp"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blocklist load concurrency too high",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				BlocklistLoading:   BlocklistLoadingConfig{Concurrency: MaxBlocklistLoadConcurrency + 1},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blocklist auth with both basic auth and a bearer token",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Blocklists:         []string{"https://lists.example.com/private.txt"},
+				BlocklistAuth: map[string]*BlocklistAuthConfig{
+					"https://lists.example.com/private.txt": {Username: "glory", Password: "pw", BearerToken: "tok"},
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blocklist auth header with a line break",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Blocklists:         []string{"https://lists.example.com/private.txt"},
+				BlocklistAuth: map[string]*BlocklistAuthConfig{
+					"https://lists.example.com/private.txt": {Headers: map[string]string{"X-Api-Key": "key\r\nX-Other: 1"}},
+				},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative blocklist download jitter",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				BlocklistLoading:   BlocklistLoadingConfig{Jitter: -time.Second},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid blocklist match mode",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Blocklists:         []string{"https://example.com/hosts"},
+				BlocklistMatch:     map[string]string{"https://example.com/hosts": "prefix"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blocklist name for an unlisted source",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Blocklists:         []string{"https://example.com/hosts"},
+				BlocklistNames:     map[string]string{"https://example.com/host": "Typo"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "blocklist shrink threshold above 1",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				BlocklistLoading:   BlocklistLoadingConfig{ShrinkThreshold: func() *float64 { v := 1.5; return &v }()},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate DoH token",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					DoH: DoHConfig{Tokens: []DoHTokenConfig{
+						{Token: "abc", Group: "kids"},
+						{Token: "abc", Group: "guests"},
+					}},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid health name IP",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					HealthName:    HealthNameConfig{IP: "localhost"},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "rate limit ipv6 prefix too long",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				RateLimit:          RateLimitConfig{IPv6Prefix: 129},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max tcp connections",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress:     ":53",
+					UDPEnabled:        true,
+					MaxTCPConnections: -5,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown allowed type",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+					AllowedTypes:  map[string][]string{"guests": {"A", "BOGUS"}},
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid blocklist redirect IP",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				BlocklistRedirects: map[string][]string{"tracking": {"not-an-ip"}},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative startup max wait",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Startup:            StartupConfig{FailClosed: true, MaxWait: -time.Second},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid log level",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "invalid",
+					Format: "text",
+					Output: "stdout",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "file output without path",
+			cfg: &Config{
+				Server: ServerConfig{
+					ListenAddress: ":53",
+					UDPEnabled:    true,
+				},
+				UpstreamDNSServers: []string{"1.1.1.1:53"},
+				Logging: LoggingConfig{
+					Level:  "info",
+					Format: "text",
+					Output: "file",
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerConfig_ListenAddrs(t *testing.T) {
+	s := ServerConfig{ListenAddress: ":53"}
+	if got := strings.Join(s.UDPAddrs(), ","); got != ":53" {
+		t.Errorf("UDPAddrs() = %q, want listen_address", got)
+	}
+
+	s.ListenAddresses = []string{"10.0.0.1:53", "10.0.0.2:53"}
+	s.TCPListenAddress = "10.0.0.3:53"
+	if got := strings.Join(s.UDPAddrs(), ","); got != "10.0.0.1:53,10.0.0.2:53" {
+		t.Errorf("UDPAddrs() = %q, want listen_addresses", got)
+	}
+	if got := strings.Join(s.TCPAddrs(), ","); got != "10.0.0.3:53" {
+		t.Errorf("TCPAddrs() = %q, want tcp_listen_address override", got)
+	}
+}
+
+func TestValidate_DebugRequiresAllowDebug(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{
+			ListenAddress: ":53",
+			UDPEnabled:    true,
+			Debug:         DebugConfig{InjectLatency: 200 * time.Millisecond},
+		},
+		UpstreamDNSServers: []string{"1.1.1.1:53"},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+			Output: "stdout",
+		},
+	}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "--allow-debug") {
+		t.Fatalf("expected --allow-debug error, got %v", err)
+	}
+
+	SetAllowDebug(true)
+	t.Cleanup(func() { SetAllowDebug(false) })
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected debug options to validate with --allow-debug, got %v", err)
+	}
+	cfg.Server.Debug.InjectLatency = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected negative inject_latency to be rejected")
+	}
+}
+
+func TestLoadNonExistentFile(t *testing.T) {
+	_, err := Load("nonexistent.yml")
+	if err == nil {
+		t.Error("Expected error when loading non-existent file")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := LoadWithDefaults()
+	cfg.Auth.APIKey = "key-123"
+	cfg.Auth.PasswordHash = "$2a$12$abcdefghijklmnopqrstuv"
+	cfg.Server.TLS.ACME.Cloudflare.APIToken = "cf-token"
+	cfg.Telemetry.MetricsPassword = ""
+
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted() error = %v", err)
+	}
+	if redacted.Auth.APIKey != "REDACTED" || redacted.Auth.PasswordHash != "REDACTED" ||
+		redacted.Server.TLS.ACME.Cloudflare.APIToken != "REDACTED" {
+		t.Errorf("secrets not masked: %+v / %q", redacted.Auth, redacted.Server.TLS.ACME.Cloudflare.APIToken)
+	}
+	if redacted.Telemetry.MetricsPassword != "" {
+		t.Errorf("empty secret should stay empty, got %q", redacted.Telemetry.MetricsPassword)
+	}
+	if cfg.Auth.APIKey != "key-123" {
+		t.Error("Redacted() modified the original config")
+	}
+
+	data, err := Marshal(redacted)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if strings.Contains(string(data), "key-123") || strings.Contains(string(data), "cf-token") {
+		t.Errorf("marshaled output leaks a secret:\n%s", data)
+	}
+}
+
+func TestLoad_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyFile := writeFile("api_key", "key-from-file\n")
+	tokenFile := writeFile("cf_token", "  cf-from-file\n")
+	cfgPath := writeFile("config.yml", `
+auth:
+  enabled: true
+  api_key_file: `+keyFile+`
+server:
+  tls:
+    acme:
+      cloudflare:
+        api_token_file: `+tokenFile+`
+`)
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.Auth.APIKey != "key-from-file" {
+		t.Errorf("APIKey = %q, want key-from-file", cfg.Auth.APIKey)
+	}
+	if cfg.Server.TLS.ACME.Cloudflare.APIToken != "cf-from-file" {
+		t.Errorf("APIToken = %q, want cf-from-file", cfg.Server.TLS.ACME.Cloudflare.APIToken)
+	}
+
+	// Saving must keep the file reference and never the secret itself.
+	data, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if strings.Contains(string(data), "key-from-file") || strings.Contains(string(data), "cf-from-file") {
+		t.Errorf("marshaled output contains a file-sourced secret:\n%s", data)
+	}
+	if !strings.Contains(string(data), keyFile) {
+		t.Errorf("marshaled output lost api_key_file:\n%s", data)
+	}
+	if cfg.Auth.APIKey != "key-from-file" {
+		t.Error("Marshal() modified the original config")
+	}
+
+	both := writeFile("both.yml", "auth:\n  api_key: inline\n  api_key_file: "+keyFile+"\n")
+	if _, err := Load(both); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected mutually exclusive error, got %v", err)
+	}
+
+	missing := writeFile("missing.yml", "auth:\n  password_hash_file: "+filepath.Join(dir, "nope")+"\n")
+	if _, err := Load(missing); err == nil || !strings.Contains(err.Error(), "password_hash_file") {
+		t.Errorf("expected read error naming password_hash_file, got %v", err)
+	}
+}
+
+func TestLoad_BlocklistAuth(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "list_password")
+	if err := os.WriteFile(passwordFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "list_key")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(cfgPath, []byte(`
+blocklists:
+  - https://lists.example.com/private.txt
+  - https://feeds.example.com/threats.txt
+blocklist_auth:
+  "https://lists.example.com/private.txt":
+    username: glory
+    password_file: `+passwordFile+`
+    header_files:
+      X-Api-Key: `+keyFile+`
+  "https://feeds.example.com/threats.txt":
+    headers:
+      X-Api-Key: feed-key
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(cfgPath)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	auth := cfg.BlocklistAuth["https://lists.example.com/private.txt"]
+	if auth == nil || auth.Username != "glory" || auth.Password != "s3cret" {
+		t.Fatalf("basic auth not loaded: %+v", auth)
+	}
+	if auth.Headers["X-Api-Key"] != "file-key" {
+		t.Errorf("header from header_files not loaded: %+v", auth.Headers)
+	}
+
+	data, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), passwordFile) {
+		t.Errorf("marshaled output should keep password_file and drop the password:\n%s", data)
+	}
+	if strings.Contains(string(data), "file-key") || !strings.Contains(string(data), keyFile) {
+		t.Errorf("marshaled output should keep header_files and drop the header value:\n%s", data)
+	}
+	if auth.Password != "s3cret" || auth.Headers["X-Api-Key"] != "file-key" {
+		t.Error("Marshal() modified the original config")
+	}
+
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted() error = %v", err)
+	}
+	if got := redacted.BlocklistAuth["https://feeds.example.com/threats.txt"].Headers["X-Api-Key"]; got != "REDACTED" {
+		t.Errorf("header value not masked: %q", got)
+	}
+	if cfg.BlocklistAuth["https://feeds.example.com/threats.txt"].Headers["X-Api-Key"] != "feed-key" {
+		t.Error("Redacted() modified the original config")
+	}
+}
+
+func TestRedacted_Webhooks(t *testing.T) {
+	cfg := &Config{Notifications: NotificationsConfig{Webhooks: []WebhookConfig{
+		{URL: "https://hooks.slack.com/services/T000/B000/XXXX", Format: "slack"},
+		{URL: "https://ntfy.example.com", Headers: map[string]string{"Authorization": "Bearer s3cret"}},
+	}}}
+
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted() error = %v", err)
+	}
+	hooks := redacted.Notifications.Webhooks
+	if hooks[0].URL != "https://hooks.slack.com/REDACTED" {
+		t.Errorf("webhook URL path not masked: %q", hooks[0].URL)
+	}
+	if hooks[1].URL != "https://ntfy.example.com" {
+		t.Errorf("URL without a path should be kept: %q", hooks[1].URL)
+	}
+	if hooks[1].Headers["Authorization"] != "REDACTED" {
+		t.Errorf("webhook header not masked: %q", hooks[1].Headers["Authorization"])
+	}
+	if cfg.Notifications.Webhooks[1].Headers["Authorization"] != "Bearer s3cret" {
+		t.Error("Redacted() modified the original config")
+	}
+}
+
+func TestPruneBlocklistSettings(t *testing.T) {
+	names := map[string]string{"https://a.example/list": "A", "https://b.example/list": "B"}
+	cfg := &Config{
+		Blocklists:     []string{"https://a.example/list"},
+		BlocklistNames: names,
+		Cache:          CacheConfig{BlockedTTLBySource: map[string]time.Duration{"https://b.example/list": time.Hour}},
+	}
+
+	cfg.PruneBlocklistSettings()
+
+	if len(cfg.BlocklistNames) != 1 || cfg.BlocklistNames["https://a.example/list"] != "A" {
+		t.Errorf("BlocklistNames = %v, want only the listed source", cfg.BlocklistNames)
+	}
+	if len(cfg.Cache.BlockedTTLBySource) != 0 {
+		t.Errorf("BlockedTTLBySource = %v, want empty", cfg.Cache.BlockedTTLBySource)
+	}
+	if len(names) != 2 {
+		t.Error("PruneBlocklistSettings() modified the original map")
+	}
+	if err := cfg.checkBlocklistSourceKeys(); err != nil {
+		t.Errorf("pruned config still fails the source check: %v", err)
 	}
 }
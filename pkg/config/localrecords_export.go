@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Local-record export formats, shared by GET /api/localrecords/export and
+// the export-records/import-records subcommands.
+const (
+	LocalRecordsFormatJSON = "json" // LocalRecordsExport document
+	LocalRecordsFormatZone = "zone" // RFC 1035 master-file lines
+)
+
+// localRecordsExportVersion is bumped if the JSON document changes shape.
+// Version 2 added static_answers.
+const localRecordsExportVersion = 2
+
+// defaultLocalRecordTTL is written to zone files for records without a TTL,
+// matching the localrecords default.
+const defaultLocalRecordTTL = 300
+
+// LocalRecordsExport is the portable JSON form of local_records.records and
+// the static_answers overrides. StaticAnswers is nil when the document has no
+// static_answers key (zone files, version 1 exports), so an import leaves
+// the configured ones alone.
+type LocalRecordsExport struct {
+	Version       int                 `json:"version"`
+	Records       []LocalRecordEntry  `json:"records"`
+	StaticAnswers []StaticAnswerEntry `json:"static_answers"`
+}
+
+// ExportLocalRecords serializes records and static answers as JSON, or
+// records alone as a zone file: static answers can carry a response code,
+// which a zone file has no way to express.
+func ExportLocalRecords(records []LocalRecordEntry, staticAnswers []StaticAnswerEntry, format string) ([]byte, error) {
+	switch format {
+	case "", LocalRecordsFormatJSON:
+		if records == nil {
+			records = []LocalRecordEntry{}
+		}
+		if staticAnswers == nil {
+			staticAnswers = []StaticAnswerEntry{}
+		}
+		data, err := json.MarshalIndent(LocalRecordsExport{
+			Version:       localRecordsExportVersion,
+			Records:       records,
+			StaticAnswers: staticAnswers,
+		}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case LocalRecordsFormatZone:
+		var b bytes.Buffer
+		b.WriteString("; glory-hole local records\n")
+		for _, entry := range records {
+			rrs, err := localRecordToRRs(entry)
+			if err != nil {
+				return nil, err
+			}
+			for _, rr := range rrs {
+				b.WriteString(rr.String())
+				b.WriteByte('\n')
+			}
+		}
+		return b.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q (must be json or zone)", format)
+	}
+}
+
+// ImportLocalRecords parses an export produced by ExportLocalRecords. A
+// document starting with '{' is read as JSON, anything else as a zone file.
+// Every record and static answer is checked for the fields it needs.
+func ImportLocalRecords(data []byte) (*LocalRecordsExport, error) {
+	doc := &LocalRecordsExport{Version: localRecordsExportVersion}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, doc); err != nil {
+			return nil, fmt.Errorf("invalid local records JSON: %w", err)
+		}
+		if doc.Version > localRecordsExportVersion {
+			return nil, fmt.Errorf("unsupported local records export version %d", doc.Version)
+		}
+	} else {
+		var err error
+		if doc.Records, err = parseLocalRecordsZone(data); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range doc.Records {
+		doc.Records[i].Type = strings.ToUpper(doc.Records[i].Type)
+		if err := validateLocalRecordEntry(doc.Records[i]); err != nil {
+			return nil, fmt.Errorf("record %d (%s %s): %w", i+1, doc.Records[i].Domain, doc.Records[i].Type, err)
+		}
+	}
+	for i, entry := range doc.StaticAnswers {
+		if err := validateStaticAnswerEntry(entry); err != nil {
+			return nil, fmt.Errorf("static answer %d (%s %s): %w", i+1, entry.Domain, entry.Type, err)
+		}
+	}
+	return doc, nil
+}
+
+// ApplyLocalRecordsImport merges doc into c, or with replace swaps in its
+// records and, when the document has any, its static answers. It reports
+// how many records and static answers were added.
+func (c *Config) ApplyLocalRecordsImport(doc *LocalRecordsExport, replace bool) (records, staticAnswers int) {
+	if replace {
+		c.LocalRecords.Records, records = doc.Records, len(doc.Records)
+		if doc.StaticAnswers != nil {
+			c.StaticAnswers, staticAnswers = doc.StaticAnswers, len(doc.StaticAnswers)
+		}
+	} else {
+		c.LocalRecords.Records, records = mergeEntries(c.LocalRecords.Records, doc.Records)
+		c.StaticAnswers, staticAnswers = mergeEntries(c.StaticAnswers, doc.StaticAnswers)
+	}
+	c.LocalRecords.Enabled = len(c.LocalRecords.Records) > 0
+	return records, staticAnswers
+}
+
+// mergeEntries appends the imported entries that are not already present
+// and reports how many were added.
+func mergeEntries[T any](existing, imported []T) ([]T, int) {
+	merged := append([]T(nil), existing...)
+	added := 0
+	for _, entry := range imported {
+		duplicate := false
+		for _, have := range merged {
+			if reflect.DeepEqual(have, entry) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, entry)
+			added++
+		}
+	}
+	return merged, added
+}
+
+// validateLocalRecordEntry checks the fields each record type requires, the
+// same ones the server needs to build the record at startup.
+func validateLocalRecordEntry(e LocalRecordEntry) error {
+	if strings.TrimSpace(e.Domain) == "" {
+		return fmt.Errorf("domain is required")
+	}
+	switch e.Type {
+	case "A", "AAAA":
+		if len(e.IPs) == 0 {
+			return fmt.Errorf("at least one IP is required")
+		}
+		for _, ip := range e.IPs {
+			parsed := net.ParseIP(ip)
+			if parsed == nil || (e.Type == "A") != (parsed.To4() != nil) {
+				return fmt.Errorf("invalid %s address %q", e.Type, ip)
+			}
+		}
+	case "CNAME", "PTR", "NS", "MX":
+		if e.Target == "" {
+			return fmt.Errorf("target is required")
+		}
+	case "SRV":
+		if e.Target == "" || e.Port == nil {
+			return fmt.Errorf("target and port are required")
+		}
+	case "TXT":
+		if len(e.TxtRecords) == 0 {
+			return fmt.Errorf("at least one txt string is required")
+		}
+	case "SOA":
+		if e.Ns == "" || e.Mbox == "" {
+			return fmt.Errorf("ns and mbox are required")
+		}
+	case "CAA":
+		if e.CaaTag == "" || e.CaaValue == "" {
+			return fmt.Errorf("caa_tag and caa_value are required")
+		}
+	default:
+		return fmt.Errorf("unsupported record type")
+	}
+	return nil
+}
+
+// localRecordToRRs renders one entry as resource records; A/AAAA entries
+// with several IPs become one record per address.
+func localRecordToRRs(e LocalRecordEntry) ([]dns.RR, error) {
+	ttl := e.TTL
+	if ttl == 0 {
+		ttl = defaultLocalRecordTTL
+	}
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: dns.Fqdn(e.Domain), Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+	u16 := func(p *uint16, def uint16) uint16 {
+		if p != nil {
+			return *p
+		}
+		return def
+	}
+	u32 := func(p *uint32, def uint32) uint32 {
+		if p != nil {
+			return *p
+		}
+		return def
+	}
+
+	switch strings.ToUpper(e.Type) {
+	case "A", "AAAA":
+		rrs := make([]dns.RR, 0, len(e.IPs))
+		for _, s := range e.IPs {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%s: invalid IP %q", e.Domain, s)
+			}
+			if ip4 := ip.To4(); ip4 != nil && strings.EqualFold(e.Type, "A") {
+				rrs = append(rrs, &dns.A{Hdr: hdr(dns.TypeA), A: ip4})
+			} else {
+				rrs = append(rrs, &dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: ip})
+			}
+		}
+		return rrs, nil
+	case "CNAME":
+		return []dns.RR{&dns.CNAME{Hdr: hdr(dns.TypeCNAME), Target: dns.Fqdn(e.Target)}}, nil
+	case "PTR":
+		return []dns.RR{&dns.PTR{Hdr: hdr(dns.TypePTR), Ptr: dns.Fqdn(e.Target)}}, nil
+	case "NS":
+		return []dns.RR{&dns.NS{Hdr: hdr(dns.TypeNS), Ns: dns.Fqdn(e.Target)}}, nil
+	case "MX":
+		return []dns.RR{&dns.MX{Hdr: hdr(dns.TypeMX), Preference: u16(e.Priority, 10), Mx: dns.Fqdn(e.Target)}}, nil
+	case "SRV":
+		return []dns.RR{&dns.SRV{Hdr: hdr(dns.TypeSRV), Priority: u16(e.Priority, 0), Weight: u16(e.Weight, 0), Port: u16(e.Port, 0), Target: dns.Fqdn(e.Target)}}, nil
+	case "TXT":
+		return []dns.RR{&dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: e.TxtRecords}}, nil
+	case "SOA":
+		return []dns.RR{&dns.SOA{
+			Hdr: hdr(dns.TypeSOA), Ns: dns.Fqdn(e.Ns), Mbox: dns.Fqdn(e.Mbox),
+			Serial: u32(e.Serial, 1), Refresh: u32(e.Refresh, 3600), Retry: u32(e.Retry, 600),
+			Expire: u32(e.Expire, 86400), Minttl: u32(e.Minttl, 300),
+		}}, nil
+	case "CAA":
+		var flag uint8
+		if e.CaaFlag != nil {
+			flag = *e.CaaFlag
+		}
+		return []dns.RR{&dns.CAA{Hdr: hdr(dns.TypeCAA), Flag: flag, Tag: e.CaaTag, Value: e.CaaValue}}, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported record type %q", e.Domain, e.Type)
+}
+
+// parseLocalRecordsZone reads zone-file lines back into entries, one entry
+// per resource record. Names starting with "*." become wildcard records.
+func parseLocalRecordsZone(data []byte) ([]LocalRecordEntry, error) {
+	zp := dns.NewZoneParser(bytes.NewReader(data), ".", "")
+	var records []LocalRecordEntry
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		h := rr.Header()
+		e := LocalRecordEntry{
+			Domain:   strings.TrimSuffix(h.Name, "."),
+			TTL:      h.Ttl,
+			Wildcard: strings.HasPrefix(h.Name, "*."),
+		}
+		switch v := rr.(type) {
+		case *dns.A:
+			e.Type, e.IPs = "A", []string{v.A.String()}
+		case *dns.AAAA:
+			e.Type, e.IPs = "AAAA", []string{v.AAAA.String()}
+		case *dns.CNAME:
+			e.Type, e.Target = "CNAME", strings.TrimSuffix(v.Target, ".")
+		case *dns.PTR:
+			e.Type, e.Target = "PTR", strings.TrimSuffix(v.Ptr, ".")
+		case *dns.NS:
+			e.Type, e.Target = "NS", strings.TrimSuffix(v.Ns, ".")
+		case *dns.MX:
+			e.Type, e.Target, e.Priority = "MX", strings.TrimSuffix(v.Mx, "."), &v.Preference
+		case *dns.SRV:
+			e.Type, e.Target = "SRV", strings.TrimSuffix(v.Target, ".")
+			e.Priority, e.Weight, e.Port = &v.Priority, &v.Weight, &v.Port
+		case *dns.TXT:
+			e.Type, e.TxtRecords = "TXT", v.Txt
+		case *dns.SOA:
+			e.Type, e.Ns, e.Mbox = "SOA", strings.TrimSuffix(v.Ns, "."), strings.TrimSuffix(v.Mbox, ".")
+			e.Serial, e.Refresh, e.Retry, e.Expire, e.Minttl = &v.Serial, &v.Refresh, &v.Retry, &v.Expire, &v.Minttl
+		case *dns.CAA:
+			e.Type, e.CaaTag, e.CaaValue, e.CaaFlag = "CAA", v.Tag, v.Value, &v.Flag
+		default:
+			return nil, fmt.Errorf("%s: unsupported record type %s", h.Name, dns.TypeToString[h.Rrtype])
+		}
+		records = append(records, e)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("invalid zone file: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportTestRecords() []LocalRecordEntry {
+	prio, weight, port := uint16(5), uint16(1), uint16(5060)
+	flag := uint8(0)
+	return []LocalRecordEntry{
+		{Domain: "nas.local", Type: "A", IPs: []string{"192.168.1.5", "192.168.1.6"}, TTL: 300},
+		{Domain: "nas.local", Type: "AAAA", IPs: []string{"fd00::5"}, TTL: 300},
+		{Domain: "*.dev.local", Type: "A", IPs: []string{"192.168.1.50"}, TTL: 60, Wildcard: true},
+		{Domain: "www.local", Type: "CNAME", Target: "nas.local", TTL: 300},
+		{Domain: "local", Type: "MX", Target: "mail.local", Priority: &prio, TTL: 300},
+		{Domain: "_sip._tcp.local", Type: "SRV", Target: "pbx.local", Priority: &prio, Weight: &weight, Port: &port, TTL: 300},
+		{Domain: "local", Type: "TXT", TxtRecords: []string{"v=spf1 -all"}, TTL: 300},
+		{Domain: "local", Type: "CAA", CaaTag: "issue", CaaValue: "letsencrypt.org", CaaFlag: &flag, TTL: 300},
+	}
+}
+
+func exportTestStaticAnswers() []StaticAnswerEntry {
+	return []StaticAnswerEntry{
+		{Domain: "example.com", Type: "TXT", TTL: 60, Values: []string{`"pinned"`}},
+		{Domain: "ipv6.example.com", Type: "AAAA", Rcode: "NXDOMAIN"},
+	}
+}
+
+func TestLocalRecordsExport_JSONRoundTrip(t *testing.T) {
+	records, answers := exportTestRecords(), exportTestStaticAnswers()
+	data, err := ExportLocalRecords(records, answers, LocalRecordsFormatJSON)
+	if err != nil {
+		t.Fatalf("ExportLocalRecords() error = %v", err)
+	}
+	got, err := ImportLocalRecords(data)
+	if err != nil {
+		t.Fatalf("ImportLocalRecords() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Records, records) {
+		t.Errorf("records round trip mismatch:\n got %+v\nwant %+v", got.Records, records)
+	}
+	if !reflect.DeepEqual(got.StaticAnswers, answers) {
+		t.Errorf("static answers round trip mismatch:\n got %+v\nwant %+v", got.StaticAnswers, answers)
+	}
+}
+
+func TestLocalRecordsExport_ZoneRoundTrip(t *testing.T) {
+	data, err := ExportLocalRecords(exportTestRecords(), exportTestStaticAnswers(), LocalRecordsFormatZone)
+	if err != nil {
+		t.Fatalf("ExportLocalRecords() error = %v", err)
+	}
+	if !strings.Contains(string(data), "*.dev.local.\t60\tIN\tA\t192.168.1.50") {
+		t.Errorf("zone output missing wildcard record:\n%s", data)
+	}
+
+	doc, err := ImportLocalRecords(data)
+	if err != nil {
+		t.Fatalf("ImportLocalRecords() error = %v", err)
+	}
+	if doc.StaticAnswers != nil {
+		t.Errorf("zone import should carry no static answers, got %+v", doc.StaticAnswers)
+	}
+	got := doc.Records
+	// Multi-IP entries come back as one entry per address.
+	if len(got) != len(exportTestRecords())+1 {
+		t.Fatalf("expected %d records, got %d", len(exportTestRecords())+1, len(got))
+	}
+	if !got[3].Wildcard || got[3].Domain != "*.dev.local" {
+		t.Errorf("wildcard record = %+v", got[3])
+	}
+	if srv := got[6]; srv.Type != "SRV" || srv.Target != "pbx.local" || *srv.Port != 5060 {
+		t.Errorf("SRV record = %+v", srv)
+	}
+}
+
+func TestImportLocalRecords_Invalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"bad json":       `{"records": [`,
+		"future version": `{"version": 99, "records": []}`,
+		"missing ip":     `{"version": 1, "records": [{"domain": "a.local", "type": "A"}]}`,
+		"v6 in A record": `{"version": 1, "records": [{"domain": "a.local", "type": "A", "ips": ["fd00::1"]}]}`,
+		"unknown type":   `{"version": 1, "records": [{"domain": "a.local", "type": "HINFO"}]}`,
+		"bad static":     `{"version": 2, "records": [], "static_answers": [{"domain": "a.com", "type": "A", "values": ["nope"]}]}`,
+		"bad zone":       "nas.local. 300 IN A not-an-ip\n",
+		"unsupported rr": "host.local. 300 IN HINFO \"cpu\" \"os\"\n",
+	} {
+		if _, err := ImportLocalRecords([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestApplyLocalRecordsImport(t *testing.T) {
+	cfg := &Config{StaticAnswers: exportTestStaticAnswers()[:1]}
+	cfg.LocalRecords.Records = exportTestRecords()[:2]
+	doc := &LocalRecordsExport{Records: exportTestRecords()[1:3], StaticAnswers: exportTestStaticAnswers()}
+
+	records, answers := cfg.ApplyLocalRecordsImport(doc, false)
+	if records != 1 || len(cfg.LocalRecords.Records) != 3 || !cfg.LocalRecords.Enabled {
+		t.Errorf("merge added %d records, total %d; want 1 added, 3 total", records, len(cfg.LocalRecords.Records))
+	}
+	if answers != 1 || len(cfg.StaticAnswers) != 2 {
+		t.Errorf("merge added %d static answers, total %d; want 1 added, 2 total", answers, len(cfg.StaticAnswers))
+	}
+
+	// A replace from a file without static answers (e.g. a zone file)
+	// keeps the configured ones.
+	cfg.ApplyLocalRecordsImport(&LocalRecordsExport{Records: exportTestRecords()[:1]}, true)
+	if len(cfg.LocalRecords.Records) != 1 || len(cfg.StaticAnswers) != 2 {
+		t.Errorf("replace without static answers: %d records, %d static answers; want 1, 2",
+			len(cfg.LocalRecords.Records), len(cfg.StaticAnswers))
+	}
+	cfg.ApplyLocalRecordsImport(&LocalRecordsExport{Records: exportTestRecords()[:1], StaticAnswers: []StaticAnswerEntry{}}, true)
+	if len(cfg.StaticAnswers) != 0 {
+		t.Errorf("replace with an empty static_answers list kept %d", len(cfg.StaticAnswers))
+	}
+}
@@ -0,0 +1,191 @@
+// Package discovery fills in client hostnames from DHCP leases and reverse DNS
+// so the clients view shows device names without manual labelling.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ptrBatchSize caps PTR lookups per scan so a large backlog of clients
+	// is worked through gradually instead of bursting the upstream.
+	ptrBatchSize = 50
+	// ptrRetryAfter is how long a client whose PTR lookup failed is left
+	// alone before trying again.
+	ptrRetryAfter = time.Hour
+	ptrTimeout    = 2 * time.Second
+)
+
+// ErrNoForwarder is returned by an ExchangeFunc when no upstream is available.
+var ErrNoForwarder = errors.New("no forwarder configured")
+
+// Store is the subset of storage.Storage used for discovery.
+type Store interface {
+	SetClientHostname(ctx context.Context, clientIP, hostname string) error
+	ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error)
+}
+
+// ExchangeFunc sends a query upstream, e.g. forwarder.Forwarder.Forward.
+type ExchangeFunc func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// Discoverer periodically assigns hostnames to clients seen in the query log:
+// first from the DHCP leases file, then by PTR lookup for the rest.
+type Discoverer struct {
+	cfg      config.ClientDiscoveryConfig
+	store    Store
+	exchange ExchangeFunc // nil = PTR lookups disabled
+	logger   *logging.Logger
+
+	known     map[string]string    // ip → hostname last written from leases
+	attempted map[string]time.Time // ip → time of last unsuccessful PTR lookup
+}
+
+// New creates a Discoverer. exchange may be nil to rely on leases only.
+func New(cfg config.ClientDiscoveryConfig, store Store, exchange ExchangeFunc, logger *logging.Logger) *Discoverer {
+	if !cfg.PTRLookupsEnabled() {
+		exchange = nil
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+	return &Discoverer{
+		cfg:       cfg,
+		store:     store,
+		exchange:  exchange,
+		logger:    logger,
+		known:     make(map[string]string),
+		attempted: make(map[string]time.Time),
+	}
+}
+
+// Run scans immediately and then every Interval until ctx is cancelled.
+func (d *Discoverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		d.scan(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scan runs one discovery pass.
+func (d *Discoverer) scan(ctx context.Context) {
+	leases := d.applyLeases(ctx)
+	if d.exchange == nil {
+		return
+	}
+
+	now := time.Now()
+	for ip, at := range d.attempted {
+		if now.Sub(at) > ptrRetryAfter {
+			delete(d.attempted, ip)
+		}
+	}
+
+	ips, err := d.store.ListClientsWithoutHostname(ctx, ptrBatchSize+len(d.attempted))
+	if err != nil {
+		d.logger.Warn("Client discovery: failed to list unnamed clients", "error", err)
+		return
+	}
+
+	lookups := 0
+	for _, ip := range ips {
+		if lookups >= ptrBatchSize || ctx.Err() != nil {
+			return
+		}
+		if _, ok := leases[ip]; ok {
+			continue
+		}
+		if _, ok := d.attempted[ip]; ok {
+			continue
+		}
+		lookups++
+
+		name, err := d.lookupPTR(ctx, ip)
+		if errors.Is(err, ErrNoForwarder) {
+			return // upstreams not ready yet; retry next scan
+		}
+		if err != nil || name == "" {
+			d.attempted[ip] = now
+			if err != nil {
+				d.logger.Debug("Client discovery: PTR lookup failed", "client", ip, "error", err)
+			}
+			continue
+		}
+		if err := d.store.SetClientHostname(ctx, ip, name); err != nil {
+			d.logger.Warn("Client discovery: failed to store hostname", "client", ip, "error", err)
+			d.attempted[ip] = now
+			continue
+		}
+		d.logger.Debug("Client discovery: hostname from PTR", "client", ip, "hostname", name)
+	}
+}
+
+// applyLeases stores hostnames from the leases file that are new or changed
+// since the last scan and returns the parsed leases.
+func (d *Discoverer) applyLeases(ctx context.Context) map[string]string {
+	if d.cfg.LeasesFile == "" {
+		return nil
+	}
+	leases, err := ParseLeasesFile(d.cfg.LeasesFile)
+	if err != nil {
+		d.logger.Warn("Client discovery: failed to read leases file", "path", d.cfg.LeasesFile, "error", err)
+		return nil
+	}
+
+	updated := 0
+	for ip, name := range leases {
+		if d.known[ip] == name {
+			continue
+		}
+		if err := d.store.SetClientHostname(ctx, ip, name); err != nil {
+			d.logger.Warn("Client discovery: failed to store hostname", "client", ip, "error", err)
+			continue
+		}
+		d.known[ip] = name
+		updated++
+	}
+	if updated > 0 {
+		d.logger.Info("Client discovery: hostnames updated from leases", "count", updated, "path", d.cfg.LeasesFile)
+	}
+	return leases
+}
+
+// lookupPTR reverse-resolves ip, returning "" when there is no PTR record.
+func (d *Discoverer) lookupPTR(ctx context.Context, ip string) (string, error) {
+	rev, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(rev, dns.TypePTR)
+	m.RecursionDesired = true
+
+	ctx, cancel := context.WithTimeout(ctx, ptrTimeout)
+	defer cancel()
+	resp, err := d.exchange(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	if resp == nil || resp.Rcode != dns.RcodeSuccess {
+		return "", nil
+	}
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return cleanHostname(strings.ToLower(ptr.Ptr)), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+type fakeStore struct {
+	unnamed   []string
+	hostnames map[string]string
+	sets      int
+}
+
+func newFakeStore(unnamed ...string) *fakeStore {
+	return &fakeStore{unnamed: unnamed, hostnames: make(map[string]string)}
+}
+
+func (f *fakeStore) SetClientHostname(_ context.Context, ip, hostname string) error {
+	f.sets++
+	f.hostnames[ip] = hostname
+	return nil
+}
+
+func (f *fakeStore) ListClientsWithoutHostname(_ context.Context, limit int) ([]string, error) {
+	var out []string
+	for _, ip := range f.unnamed {
+		if _, ok := f.hostnames[ip]; ok {
+			continue
+		}
+		out = append(out, ip)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// ptrExchange answers PTR queries from names (ip → hostname) and counts calls.
+func ptrExchange(names map[string]string, calls *int) ExchangeFunc {
+	return func(_ context.Context, m *dns.Msg) (*dns.Msg, error) {
+		*calls++
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		for ip, name := range names {
+			rev, _ := dns.ReverseAddr(ip)
+			if rev == m.Question[0].Name {
+				resp.Answer = append(resp.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{Name: rev, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: 300},
+					Ptr: name,
+				})
+				return resp, nil
+			}
+		}
+		resp.Rcode = dns.RcodeNameError
+		return resp, nil
+	}
+}
+
+func TestDiscoverer_PTRLookups(t *testing.T) {
+	store := newFakeStore("192.168.1.10", "192.168.1.11")
+	calls := 0
+	exchange := ptrExchange(map[string]string{"192.168.1.10": "Laptop.lan."}, &calls)
+
+	d := New(config.ClientDiscoveryConfig{Enabled: true}, store, exchange, logging.NewDefault())
+	d.scan(context.Background())
+
+	if store.hostnames["192.168.1.10"] != "laptop.lan" {
+		t.Errorf("hostname = %q, want laptop.lan", store.hostnames["192.168.1.10"])
+	}
+	if _, ok := store.hostnames["192.168.1.11"]; ok {
+		t.Error("NXDOMAIN PTR should not store a hostname")
+	}
+	if calls != 2 {
+		t.Fatalf("expected 2 lookups, got %d", calls)
+	}
+
+	// The failed client is not retried until ptrRetryAfter has passed.
+	d.scan(context.Background())
+	if calls != 2 {
+		t.Errorf("failed lookup retried too soon: %d calls", calls)
+	}
+	d.attempted["192.168.1.11"] = time.Now().Add(-2 * ptrRetryAfter)
+	d.scan(context.Background())
+	if calls != 3 {
+		t.Errorf("expected retry after backoff, got %d calls", calls)
+	}
+}
+
+func TestDiscoverer_NoForwarderIsRetried(t *testing.T) {
+	store := newFakeStore("192.168.1.10")
+	exchange := func(context.Context, *dns.Msg) (*dns.Msg, error) { return nil, ErrNoForwarder }
+
+	d := New(config.ClientDiscoveryConfig{Enabled: true}, store, exchange, logging.NewDefault())
+	d.scan(context.Background())
+
+	if len(d.attempted) != 0 {
+		t.Errorf("clients should not be backed off while upstreams are unavailable: %v", d.attempted)
+	}
+}
+
+func TestDiscoverer_LeasesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("0 aa:bb:cc:dd:ee:01 192.168.1.10 laptop *\n")
+
+	store := newFakeStore("192.168.1.10")
+	calls := 0
+	disabled := false
+	cfg := config.ClientDiscoveryConfig{Enabled: true, LeasesFile: path, PTRLookups: &disabled}
+	d := New(cfg, store, ptrExchange(nil, &calls), logging.NewDefault())
+
+	d.scan(context.Background())
+	if store.hostnames["192.168.1.10"] != "laptop" {
+		t.Fatalf("hostname = %q, want laptop", store.hostnames["192.168.1.10"])
+	}
+	if calls != 0 {
+		t.Errorf("PTR lookups disabled but %d queries sent", calls)
+	}
+
+	// Unchanged leases are not rewritten; renamed devices are.
+	d.scan(context.Background())
+	if store.sets != 1 {
+		t.Errorf("unchanged lease rewritten: %d writes", store.sets)
+	}
+	write("0 aa:bb:cc:dd:ee:01 192.168.1.10 work-laptop *\n")
+	d.scan(context.Background())
+	if store.hostnames["192.168.1.10"] != "work-laptop" {
+		t.Errorf("hostname = %q, want work-laptop", store.hostnames["192.168.1.10"])
+	}
+}
+
+func TestDiscoverer_RunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	d := New(config.ClientDiscoveryConfig{Enabled: true, Interval: time.Hour}, newFakeStore(), nil, logging.NewDefault())
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,84 @@
+package discovery
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// ParseLeasesFile reads a DHCP leases file and returns IP → hostname.
+// See ParseLeases for supported formats.
+func ParseLeasesFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open leases file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return ParseLeases(f)
+}
+
+// ParseLeases parses dnsmasq and ISC dhcpd lease files:
+//
+//	1700000000 aa:bb:cc:dd:ee:ff 192.168.1.23 laptop 01:aa:bb:cc:dd:ee:ff   (dnsmasq)
+//
+//	lease 192.168.1.50 {                                                  (ISC dhcpd)
+//	  client-hostname "phone";
+//	}
+//
+// Leases without a hostname ("*" in dnsmasq) are skipped. For ISC files the
+// last block for an address wins, matching dhcpd's append-only journal.
+func ParseLeases(r io.Reader) (map[string]string, error) {
+	leases := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+
+	var iscLease string // address of the open ISC lease block, if any
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, "{"):
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && net.ParseIP(fields[1]) != nil {
+				iscLease = fields[1]
+			}
+		case iscLease != "" && line == "}":
+			iscLease = ""
+		case iscLease != "":
+			if rest, ok := strings.CutPrefix(line, "client-hostname "); ok {
+				if name := cleanHostname(strings.Trim(strings.TrimSuffix(rest, ";"), `"`)); name != "" {
+					leases[iscLease] = name
+				}
+			}
+		default:
+			// dnsmasq: <expiry> <mac|iaid> <ip> <hostname> [client-id]
+			fields := strings.Fields(line)
+			if len(fields) < 4 || net.ParseIP(fields[2]) == nil {
+				continue
+			}
+			if name := cleanHostname(fields[3]); name != "" {
+				leases[fields[2]] = name
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read leases: %w", err)
+	}
+	return leases, nil
+}
+
+// cleanHostname trims a discovered name to a displayable form, returning ""
+// for placeholders.
+func cleanHostname(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" || name == "*" {
+		return ""
+	}
+	return name
+}
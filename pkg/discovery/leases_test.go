@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLeases_Dnsmasq(t *testing.T) {
+	input := `1700000000 aa:bb:cc:dd:ee:01 192.168.1.23 laptop 01:aa:bb:cc:dd:ee:01
+1700000000 aa:bb:cc:dd:ee:02 192.168.1.24 * *
+duid 00:01:00:01:2c:aa:bb:cc:dd:ee:ff:00
+1700000000 1234 fd00::23 nas 00:01:00:01
+garbage line
+`
+	leases, err := ParseLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseLeases() error = %v", err)
+	}
+	want := map[string]string{"192.168.1.23": "laptop", "fd00::23": "nas"}
+	if len(leases) != len(want) {
+		t.Fatalf("leases = %v, want %v", leases, want)
+	}
+	for ip, name := range want {
+		if leases[ip] != name {
+			t.Errorf("leases[%s] = %q, want %q", ip, leases[ip], name)
+		}
+	}
+}
+
+func TestParseLeases_ISC(t *testing.T) {
+	input := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.50 {
+  starts 4 2024/01/01 10:00:00;
+  hardware ethernet aa:bb:cc:dd:ee:50;
+  client-hostname "old-phone";
+}
+lease 192.168.1.51 {
+  hardware ethernet aa:bb:cc:dd:ee:51;
+}
+lease 192.168.1.50 {
+  starts 4 2024/01/02 10:00:00;
+  client-hostname "phone";
+}
+`
+	leases, err := ParseLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseLeases() error = %v", err)
+	}
+	if len(leases) != 1 || leases["192.168.1.50"] != "phone" {
+		t.Errorf("leases = %v, want latest hostname for 192.168.1.50 only", leases)
+	}
+}
+
+func TestParseLeasesFile_Missing(t *testing.T) {
+	if _, err := ParseLeasesFile(filepath.Join(t.TempDir(), "missing.leases")); err == nil {
+		t.Fatal("expected error for missing leases file")
+	}
+
+	path := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	if err := os.WriteFile(path, []byte("0 aa:bb:cc:dd:ee:ff 10.0.0.5 printer *\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	leases, err := ParseLeasesFile(path)
+	if err != nil {
+		t.Fatalf("ParseLeasesFile() error = %v", err)
+	}
+	if leases["10.0.0.5"] != "printer" {
+		t.Errorf("leases = %v, want printer at 10.0.0.5", leases)
+	}
+}
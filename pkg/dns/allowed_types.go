@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"sort"
+	"strings"
+
+	"glory-hole/pkg/policy"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageAllowedType = "allowed_type"
+
+// allowedTypes restricts members of some client groups to a set of query
+// types (server.allowed_types). Clients outside every listed group are not
+// restricted.
+type allowedTypes struct {
+	groups  map[string]map[uint16]struct{} // group -> types its members may query
+	names   []string                       // group names, sorted for stable traces
+	inGroup func(clientIP, group string) bool
+}
+
+// newAllowedTypes parses server.allowed_types. Unknown type names are
+// skipped; config validation rejects them before they get here.
+func newAllowedTypes(cfg map[string][]string) *allowedTypes {
+	if len(cfg) == 0 {
+		return nil
+	}
+	a := &allowedTypes{
+		groups:  make(map[string]map[uint16]struct{}, len(cfg)),
+		inGroup: policy.InClientGroup,
+	}
+	for group, names := range cfg {
+		types := make(map[uint16]struct{}, len(names))
+		for _, name := range names {
+			if qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]; ok {
+				types[qtype] = struct{}{}
+			}
+		}
+		a.groups[group] = types
+		a.names = append(a.names, group)
+	}
+	sort.Strings(a.names)
+	return a
+}
+
+// denies reports whether clientIP may not query qtype, and the restricted
+// group it belongs to. assigned is a group given on arrival (a DoH token),
+// which counts as membership. A client in several restricted groups may
+// query any type one of them allows.
+func (a *allowedTypes) denies(clientIP, assigned string, qtype uint16) (group string, denied bool) {
+	for _, name := range a.names {
+		if name != assigned && !a.inGroup(clientIP, name) {
+			continue
+		}
+		if _, ok := a.groups[name][qtype]; ok {
+			return "", false
+		}
+		if group == "" {
+			group = name
+		}
+	}
+	return group, group != ""
+}
+
+// serveDisallowedType answers a query type the client's group may not use
+// with NODATA, like server.refused_types. It runs after local records and
+// static answers, so those still resolve.
+func (h *Handler) serveDisallowedType(w dns.ResponseWriter, r, msg *dns.Msg, group, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	trace.Record(traceStageAllowedType, "nodata", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "allowed_types"
+		entry.Rule = group
+		entry.Detail = qtypeLabel + " queries are not allowed for client group " + group
+	})
+	msg.SetRcode(r, dns.RcodeSuccess)
+	outcome.responseCode = dns.RcodeSuccess
+	h.writeMsg(w, r, msg)
+	return true
+}
@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestAllowedTypes_Denies(t *testing.T) {
+	a := newAllowedTypes(map[string][]string{
+		"guests": {"A", "aaaa", " HTTPS "},
+		"iot":    {"A"},
+	})
+	members := map[string][]string{
+		"10.0.0.1": {"guests"},
+		"10.0.0.2": {"iot"},
+		"10.0.0.3": {"guests", "iot"},
+	}
+	a.inGroup = func(ip, group string) bool {
+		for _, g := range members[ip] {
+			if g == group {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		assigned  string
+		qtype     uint16
+		wantGroup string
+		denied    bool
+	}{
+		{"guest A", "10.0.0.1", "", dns.TypeA, "", false},
+		{"guest HTTPS", "10.0.0.1", "", dns.TypeHTTPS, "", false},
+		{"guest TXT", "10.0.0.1", "", dns.TypeTXT, "guests", true},
+		{"iot AAAA", "10.0.0.2", "", dns.TypeAAAA, "iot", true},
+		{"both groups union", "10.0.0.3", "", dns.TypeAAAA, "", false},
+		{"unrestricted client", "10.0.0.9", "", dns.TypeTXT, "", false},
+		{"assigned group", "10.0.0.9", "iot", dns.TypeTXT, "iot", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, denied := a.denies(tt.ip, tt.assigned, tt.qtype)
+			if group != tt.wantGroup || denied != tt.denied {
+				t.Errorf("denies() = (%q, %v), want (%q, %v)", group, denied, tt.wantGroup, tt.denied)
+			}
+		})
+	}
+}
+
+func TestServeDNS_AllowedTypes(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{"www.example.com.": "93.184.216.34"})
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+	h.SetAllowedTypes(map[string][]string{"guests": {"A"}})
+
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewTXTRecord("nas.lan.", []string{"v=1"})); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+
+	query := func(ctx context.Context, name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		h.ServeDNS(ctx, w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+	guest := WithClientGroup(context.Background(), "guests")
+
+	// The test upstream answers every type with its A record, so an answer
+	// proves the query was forwarded.
+	if resp := query(guest, "www.example.com.", dns.TypeTXT); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("guest TXT: expected NODATA, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query(guest, "www.example.com.", dns.TypeA); len(resp.Answer) != 1 {
+		t.Errorf("guest A: expected the query to be forwarded, got %d answers", len(resp.Answer))
+	}
+	if resp := query(guest, "nas.lan.", dns.TypeTXT); len(resp.Answer) != 1 {
+		t.Errorf("local records should still be answered, got %d answers", len(resp.Answer))
+	}
+	if resp := query(context.Background(), "www.example.com.", dns.TypeTXT); len(resp.Answer) != 1 {
+		t.Errorf("clients outside the group should be unrestricted, got %d answers", len(resp.Answer))
+	}
+	if dec := h.Explain(guest, "www.example.com", "192.168.1.10", dns.TypeTXT); dec.Stage != traceStageAllowedType {
+		t.Errorf("Explain with the token group: stage = %q, want %s", dec.Stage, traceStageAllowedType)
+	}
+}
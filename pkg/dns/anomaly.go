@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"glory-hole/pkg/config"
+)
+
+// Anomaly kinds reported by the detector.
+const (
+	AnomalyDomainRate          = "domain_rate"           // one name queried too often (all clients)
+	AnomalyClientUniqueDomains = "client_unique_domains" // one client querying too many distinct names
+	AnomalyUniqueSubdomains    = "unique_subdomains"     // one client querying many subdomains of one parent (tunneling)
+)
+
+// Bounds on tracked state so a flood of random names can't exhaust memory.
+// Once a map is full, new keys are ignored until the window rolls over.
+const (
+	maxAnomalyDomains        = 100_000
+	maxAnomalyClients        = 65_536
+	maxAnomalyParentsPerHost = 4_096
+)
+
+// Anomaly describes a threshold crossing. Each (kind, client, domain) fires at
+// most once per window.
+type Anomaly struct {
+	Kind      string
+	Client    string // empty for AnomalyDomainRate
+	Domain    string // queried name, or the parent domain for AnomalyUniqueSubdomains
+	Count     int
+	Threshold int
+	Window    time.Duration
+}
+
+// anomalyDetector counts queries in fixed windows and reports names or clients
+// that cross the configured thresholds. Reports are delivered after the lock
+// is released so callbacks may log or record metrics freely.
+type anomalyDetector struct {
+	cfg    config.AnomalyConfig
+	report func(Anomaly)
+	peaks  func(domainQueries, clientDomains int) // called when a window closes
+
+	mu        sync.Mutex
+	windowEnd time.Time
+	domains   map[string]int
+	clients   map[string]*clientAnomalyState
+	flagged   map[string]struct{}
+}
+
+type clientAnomalyState struct {
+	names   map[string]struct{}
+	parents map[string]map[string]struct{} // parent → distinct leftmost labels
+}
+
+func newAnomalyDetector(cfg config.AnomalyConfig, report func(Anomaly), peaks func(int, int)) *anomalyDetector {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	return &anomalyDetector{
+		cfg:     cfg,
+		report:  report,
+		peaks:   peaks,
+		domains: make(map[string]int),
+		clients: make(map[string]*clientAnomalyState),
+		flagged: make(map[string]struct{}),
+	}
+}
+
+// observe records one query and reports any thresholds it crosses.
+func (a *anomalyDetector) observe(now time.Time, clientIP, domain string) {
+	name := strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == "" {
+		return
+	}
+
+	var (
+		found      [3]Anomaly
+		n          int
+		rolled     bool
+		peakDomain int
+		peakClient int
+	)
+
+	a.mu.Lock()
+	if now.After(a.windowEnd) {
+		if !a.windowEnd.IsZero() {
+			rolled = true
+			peakDomain, peakClient = a.peaksLocked()
+		}
+		a.resetLocked(now)
+	}
+
+	if limit := a.cfg.DomainRate; limit > 0 {
+		count, tracked := a.domains[name]
+		if tracked || len(a.domains) < maxAnomalyDomains {
+			count++
+			a.domains[name] = count
+			if count > limit && a.flagOnceLocked(AnomalyDomainRate, "", name) {
+				found[n] = Anomaly{Kind: AnomalyDomainRate, Domain: name, Count: count, Threshold: limit}
+				n++
+			}
+		}
+	}
+
+	if state := a.clientLocked(clientIP); state != nil {
+		if limit := a.cfg.ClientUniqueDomains; limit > 0 && len(state.names) <= limit {
+			state.names[name] = struct{}{}
+			if len(state.names) > limit && a.flagOnceLocked(AnomalyClientUniqueDomains, clientIP, "") {
+				found[n] = Anomaly{Kind: AnomalyClientUniqueDomains, Client: clientIP, Domain: name, Count: len(state.names), Threshold: limit}
+				n++
+			}
+		}
+
+		if limit := a.cfg.UniqueSubdomains; limit > 0 {
+			if label, parent, ok := splitForTunneling(name); ok {
+				subs, tracked := state.parents[parent]
+				if !tracked && len(state.parents) < maxAnomalyParentsPerHost {
+					subs = make(map[string]struct{})
+					state.parents[parent] = subs
+				}
+				if subs != nil && len(subs) <= limit {
+					subs[label] = struct{}{}
+					if len(subs) > limit && a.flagOnceLocked(AnomalyUniqueSubdomains, clientIP, parent) {
+						found[n] = Anomaly{Kind: AnomalyUniqueSubdomains, Client: clientIP, Domain: parent, Count: len(subs), Threshold: limit}
+						n++
+					}
+				}
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	if rolled && a.peaks != nil {
+		a.peaks(peakDomain, peakClient)
+	}
+	if a.report != nil {
+		for i := 0; i < n; i++ {
+			found[i].Window = a.cfg.Window
+			a.report(found[i])
+		}
+	}
+}
+
+func (a *anomalyDetector) resetLocked(now time.Time) {
+	a.windowEnd = now.Add(a.cfg.Window)
+	clear(a.domains)
+	clear(a.clients)
+	clear(a.flagged)
+}
+
+func (a *anomalyDetector) peaksLocked() (domainQueries, clientDomains int) {
+	for _, c := range a.domains {
+		domainQueries = max(domainQueries, c)
+	}
+	for _, s := range a.clients {
+		clientDomains = max(clientDomains, len(s.names))
+	}
+	return domainQueries, clientDomains
+}
+
+// clientLocked returns the per-client state, or nil when the client table is
+// full or no per-client check is enabled.
+func (a *anomalyDetector) clientLocked(clientIP string) *clientAnomalyState {
+	if a.cfg.ClientUniqueDomains <= 0 && a.cfg.UniqueSubdomains <= 0 {
+		return nil
+	}
+	if s, ok := a.clients[clientIP]; ok {
+		return s
+	}
+	if len(a.clients) >= maxAnomalyClients {
+		return nil
+	}
+	s := &clientAnomalyState{
+		names:   make(map[string]struct{}),
+		parents: make(map[string]map[string]struct{}),
+	}
+	a.clients[clientIP] = s
+	return s
+}
+
+// flagOnceLocked reports whether this is the first crossing for the key in the
+// current window.
+func (a *anomalyDetector) flagOnceLocked(kind, client, domain string) bool {
+	key := kind + "|" + client + "|" + domain
+	if _, seen := a.flagged[key]; seen {
+		return false
+	}
+	a.flagged[key] = struct{}{}
+	return true
+}
+
+// splitForTunneling splits name into its leftmost label and the parent it sits
+// under. Tunnels encode data in that label ("<payload>.t.example.com"), so
+// grouping by everything to its right catches them without a public suffix
+// list. Names directly under a TLD and reverse-lookup zones are skipped: PTR
+// sweeps legitimately produce many distinct labels.
+func splitForTunneling(name string) (label, parent string, ok bool) {
+	idx := strings.IndexByte(name, '.')
+	if idx <= 0 {
+		return "", "", false
+	}
+	parent = name[idx+1:]
+	if !strings.Contains(parent, ".") {
+		return "", "", false
+	}
+	if strings.HasSuffix(parent, "in-addr.arpa") || strings.HasSuffix(parent, "ip6.arpa") {
+		return "", "", false
+	}
+	return name[:idx], parent, true
+}
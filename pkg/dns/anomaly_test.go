@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+
+	"github.com/miekg/dns"
+)
+
+type anomalyRecorder struct {
+	mu    sync.Mutex
+	found []Anomaly
+}
+
+func (r *anomalyRecorder) add(a Anomaly) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.found = append(r.found, a)
+}
+
+func (r *anomalyRecorder) kinds() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]int)
+	for _, a := range r.found {
+		out[a.Kind]++
+	}
+	return out
+}
+
+func TestAnomalyDetector_UniqueSubdomains(t *testing.T) {
+	rec := &anomalyRecorder{}
+	det := newAnomalyDetector(config.AnomalyConfig{Enabled: true, Window: time.Minute, UniqueSubdomains: 10}, rec.add, nil)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		det.observe(now, "10.0.0.5", fmt.Sprintf("c%d.t.evil.com.", i))
+	}
+	if len(rec.found) != 0 {
+		t.Fatalf("no anomaly expected at threshold, got %v", rec.found)
+	}
+
+	// Crossing fires once; further subdomains in the same window don't re-fire.
+	for i := 10; i < 30; i++ {
+		det.observe(now, "10.0.0.5", fmt.Sprintf("c%d.t.evil.com.", i))
+	}
+	if len(rec.found) != 1 {
+		t.Fatalf("expected exactly one anomaly, got %d", len(rec.found))
+	}
+	a := rec.found[0]
+	if a.Kind != AnomalyUniqueSubdomains || a.Client != "10.0.0.5" || a.Domain != "t.evil.com" || a.Count != 11 || a.Threshold != 10 {
+		t.Errorf("unexpected anomaly: %+v", a)
+	}
+
+	// Another client under the same parent is tracked separately.
+	for i := 0; i < 5; i++ {
+		det.observe(now, "10.0.0.6", fmt.Sprintf("c%d.t.evil.com.", i))
+	}
+	if len(rec.found) != 1 {
+		t.Errorf("other client below threshold should not fire, got %d anomalies", len(rec.found))
+	}
+
+	// A new window resets counts and allows the alert again.
+	later := now.Add(2 * time.Minute)
+	for i := 0; i < 11; i++ {
+		det.observe(later, "10.0.0.5", fmt.Sprintf("d%d.t.evil.com.", i))
+	}
+	if len(rec.found) != 2 {
+		t.Errorf("expected alert to re-fire in new window, got %d anomalies", len(rec.found))
+	}
+}
+
+func TestAnomalyDetector_RepeatedNameIsNotTunneling(t *testing.T) {
+	rec := &anomalyRecorder{}
+	det := newAnomalyDetector(config.AnomalyConfig{Enabled: true, Window: time.Minute, UniqueSubdomains: 5, ClientUniqueDomains: 10}, rec.add, nil)
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		det.observe(now, "10.0.0.5", "www.example.com.")
+	}
+	// PTR sweeps and names directly under a TLD aren't grouped.
+	for i := 0; i < 5; i++ {
+		det.observe(now, "10.0.0.5", fmt.Sprintf("%d.1.168.192.in-addr.arpa.", i))
+	}
+	if len(rec.found) != 0 {
+		t.Errorf("expected no anomalies, got %v", rec.found)
+	}
+}
+
+func TestAnomalyDetector_ClientUniqueDomains(t *testing.T) {
+	rec := &anomalyRecorder{}
+	det := newAnomalyDetector(config.AnomalyConfig{Enabled: true, Window: time.Minute, ClientUniqueDomains: 20, UniqueSubdomains: -1}, rec.add, nil)
+	now := time.Now()
+
+	for i := 0; i < 50; i++ {
+		det.observe(now, "10.0.0.7", fmt.Sprintf("host%d.example%d.com.", i, i))
+	}
+	if got := rec.kinds(); got[AnomalyClientUniqueDomains] != 1 || len(got) != 1 {
+		t.Errorf("expected one client_unique_domains anomaly, got %v", got)
+	}
+}
+
+func TestAnomalyDetector_DomainRateAndPeaks(t *testing.T) {
+	rec := &anomalyRecorder{}
+	var peakDomain, peakClient int
+	det := newAnomalyDetector(
+		config.AnomalyConfig{Enabled: true, Window: time.Minute, DomainRate: 30, ClientUniqueDomains: 100},
+		rec.add,
+		func(d, c int) { peakDomain, peakClient = d, c },
+	)
+	now := time.Now()
+
+	// Many clients hammering one name trips the global per-domain rate.
+	for i := 0; i < 40; i++ {
+		det.observe(now, fmt.Sprintf("10.0.1.%d", i), "Beacon.Example.com.")
+	}
+	det.observe(now, "10.0.1.1", "other.example.com.")
+	if got := rec.kinds(); got[AnomalyDomainRate] != 1 {
+		t.Fatalf("expected one domain_rate anomaly, got %v", got)
+	}
+	if rec.found[0].Domain != "beacon.example.com" || rec.found[0].Client != "" {
+		t.Errorf("unexpected domain_rate anomaly: %+v", rec.found[0])
+	}
+
+	// Peaks are published when the window closes.
+	det.observe(now.Add(2*time.Minute), "10.0.0.1", "example.com.")
+	if peakDomain != 40 || peakClient != 2 {
+		t.Errorf("peaks = (%d, %d), want (40, 2)", peakDomain, peakClient)
+	}
+}
+
+func TestHandler_AnomalyDetectionHook(t *testing.T) {
+	h := NewHandler()
+	h.SetAnomalyDetection(config.AnomalyConfig{Enabled: true, Window: time.Minute, UniqueSubdomains: 3})
+	rec := &anomalyRecorder{}
+	h.SetAnomalyHook(rec.add)
+
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.50"), Port: 5353}}
+	for i := 0; i < 5; i++ {
+		r := new(dns.Msg)
+		r.SetQuestion(fmt.Sprintf("aGVsbG8%d.tunnel.example.net.", i), dns.TypeTXT)
+		h.ServeDNS(context.Background(), w, r)
+	}
+
+	if len(rec.found) != 1 || rec.found[0].Client != "192.168.1.50" || rec.found[0].Domain != "tunnel.example.net" {
+		t.Fatalf("expected one tunneling anomaly for 192.168.1.50, got %+v", rec.found)
+	}
+
+	// Re-applying the same config keeps the detector (and its counts).
+	before := h.deps.Load().anomaly
+	h.SetAnomalyDetection(config.AnomalyConfig{Enabled: true, Window: time.Minute, UniqueSubdomains: 3})
+	if h.deps.Load().anomaly != before {
+		t.Error("unchanged config should keep the existing detector")
+	}
+
+	h.SetAnomalyDetection(config.AnomalyConfig{})
+	if h.deps.Load().anomaly != nil {
+		t.Error("disabled config should remove the detector")
+	}
+}
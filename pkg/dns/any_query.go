@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageAnyQuery = "any_query"
+
+// rfc8482TTL is the TTL of the synthesized HINFO answer. RFC 8482 §4.2
+// suggests a long TTL so resolvers cache it; a day keeps it well below the
+// usual negative-caching ceilings.
+const rfc8482TTL = 86400
+
+// serveAnyQuery handles qtype ANY according to the configured mode. ANY is a
+// favourite of amplification attacks and rarely useful to real clients, so by
+// default it gets the RFC 8482 minimal answer: a single HINFO record with
+// CPU "RFC8482" and an empty OS. Returns false in forward mode.
+func (h *Handler) serveAnyQuery(w dns.ResponseWriter, r, msg *dns.Msg, domain string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	mode := h.deps.Load().anyQuery
+	if mode == config.AnyQueryForward {
+		return false
+	}
+
+	if mode == config.AnyQueryRefuse {
+		trace.Record(traceStageAnyQuery, "refuse", func(entry *storage.BlockTraceEntry) {
+			entry.Source = "any_query"
+			entry.Detail = "ANY queries are refused"
+		})
+		msg.SetRcode(r, dns.RcodeRefused)
+		outcome.responseCode = dns.RcodeRefused
+		h.writeMsg(w, r, msg)
+		return true
+	}
+
+	trace.Record(traceStageAnyQuery, "minimal", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "any_query"
+		entry.Detail = "RFC 8482 minimal response"
+	})
+	msg.Answer = append(msg.Answer, &dns.HINFO{
+		Hdr: dns.RR_Header{Name: domain, Rrtype: dns.TypeHINFO, Class: dns.ClassINET, Ttl: rfc8482TTL},
+		Cpu: "RFC8482",
+		Os:  "",
+	})
+	outcome.responseCode = dns.RcodeSuccess
+	h.writeMsg(w, r, msg)
+	return true
+}
@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_AnyQuery(t *testing.T) {
+	upstream := startRebindUpstream(t, nil)
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	query := func() *dns.Msg {
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion("example.com.", dns.TypeANY)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	t.Run("minimal is the default", func(t *testing.T) {
+		resp := query()
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+			t.Fatalf("expected a single answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+		}
+		hinfo, ok := resp.Answer[0].(*dns.HINFO)
+		if !ok {
+			t.Fatalf("expected HINFO, got %T", resp.Answer[0])
+		}
+		if hinfo.Cpu != "RFC8482" || hinfo.Os != "" || hinfo.Hdr.Name != "example.com." {
+			t.Errorf("unexpected HINFO: %s", hinfo)
+		}
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		h.SetAnyQueryMode(config.AnyQueryRefuse)
+		if resp := query(); resp.Rcode != dns.RcodeRefused || len(resp.Answer) != 0 {
+			t.Errorf("expected REFUSED, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+		}
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		h.SetAnyQueryMode(config.AnyQueryForward)
+		resp := query()
+		if resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("expected upstream NOERROR, got %s", dns.RcodeToString[resp.Rcode])
+		}
+		for _, rr := range resp.Answer {
+			if _, ok := rr.(*dns.HINFO); ok {
+				t.Error("forward mode must not synthesize HINFO")
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"glory-hole/pkg/cache"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+// cacheRefreshTimeout bounds a stale-while-revalidate refresh, which runs
+// detached from the query that triggered it.
+const cacheRefreshTimeout = 5 * time.Second
+
+// refreshCached re-resolves r through the default upstreams in the
+// background and replaces its cache entry. The cache stage only sees queries
+// no policy matched, so the default forwarder is the path the entry came from.
+// Failures leave the entry to expire as usual. scope is the cache scope of
+// the entry (see cache.WithScope).
+func (h *Handler) refreshCached(scope string, r *dns.Msg, clientIP string) {
+	fwd := h.getForwarder()
+	c := h.getCache()
+	if fwd == nil || c == nil {
+		return
+	}
+
+	h.inflight.Add(1)
+	go func() {
+		defer h.inflight.Add(-1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cacheRefreshTimeout)
+		defer cancel()
+		ctx = cache.WithScope(ctx, scope)
+
+		resp, err := fwd.Forward(ctx, r)
+		if err != nil {
+			if lg := h.getLogger(); lg != nil {
+				lg.Debug("Background cache refresh failed",
+					"domain", r.Question[0].Name,
+					"error", err)
+			}
+			return
+		}
+
+		trace := newBlockTraceRecorder(false)
+		defer trace.Release()
+		outcome := getOutcome()
+		defer releaseOutcome(outcome)
+
+		resp = h.maybeFlattenCNAME(ctx, r, resp, fwd.Forward)
+		resp = h.applyRebindProtection(ctx, resp, r.Question[0].Name, clientIP, trace, outcome)
+		c.Set(ctx, r, resp)
+	}()
+}
+
+// cacheScope returns the cache scope for a client: its client groups,
+// including one assigned on arrival, sorted and comma-joined. Clients in no
+// group get "" and share the plain entries.
+func cacheScope(clientIP, assigned string) string {
+	groups := policy.ClientGroupsOf(clientIP)
+	if assigned != "" && !slices.Contains(groups, assigned) {
+		groups = append(groups, assigned)
+		slices.Sort(groups)
+	}
+	return strings.Join(groups, ",")
+}
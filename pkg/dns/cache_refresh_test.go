@@ -0,0 +1,184 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/cache"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_StaleWhileRevalidate(t *testing.T) {
+	upstream, queries := startZoneUpstream(t, map[string][]string{
+		"soon.test.": {"soon.test. 60 IN A 192.0.2.1"},
+		"late.test.": {"late.test. 3600 IN A 192.0.2.2"},
+	})
+
+	logger := logging.NewDefault()
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{upstream}}, logger, nil))
+	dnsCache, _ := cache.New(&config.CacheConfig{
+		Enabled:              true,
+		MaxEntries:           100,
+		MinTTL:               1 * time.Second,
+		MaxTTL:               3600 * time.Second,
+		NegativeTTL:          300 * time.Second,
+		StaleWhileRevalidate: 5 * time.Minute,
+	}, logger, nil)
+	h.SetCache(dnsCache)
+
+	query := func(name string) {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("%s: expected one answer, got %v", name, w.msg)
+		}
+	}
+	settle := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := h.Drain(ctx); err != nil {
+			t.Fatalf("background refresh did not finish: %v", err)
+		}
+	}
+
+	// Outside the window: cache hits never go upstream.
+	query("late.test.")
+	query("late.test.")
+	settle()
+	if got := queries.Load(); got != 1 {
+		t.Fatalf("entry outside the window should not be refreshed, upstream saw %d queries", got)
+	}
+
+	// Inside the window: the hit is answered from cache and refreshed once.
+	query("soon.test.")
+	query("soon.test.")
+	settle()
+	if got := queries.Load(); got != 3 {
+		t.Fatalf("expected one background refresh, upstream saw %d queries", got)
+	}
+}
+
+// groupProfiles serves client profiles to a policy.SQLiteResolver.
+type groupProfiles struct {
+	storage.NoOpStorage
+	profiles []*storage.ClientProfile
+}
+
+func (g *groupProfiles) ListClientProfiles(context.Context) ([]*storage.ClientProfile, error) {
+	return g.profiles, nil
+}
+
+func TestServeDNS_CacheScopedByClientGroup(t *testing.T) {
+	resolver := policy.NewSQLiteResolver(&groupProfiles{profiles: []*storage.ClientProfile{
+		{ClientIP: "192.168.1.20", GroupName: "kids"},
+	}})
+	if err := resolver.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	policy.SetClientGroupResolver(resolver)
+	t.Cleanup(func() { policy.SetClientGroupResolver(nil) })
+
+	defaultUpstream, _ := startZoneUpstream(t, map[string][]string{
+		"video.test.": {"video.test. 3600 IN A 192.0.2.1"},
+	})
+	kidsUpstream, _ := startZoneUpstream(t, map[string][]string{
+		"video.test.": {"video.test. 3600 IN A 192.0.2.99"},
+	})
+
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:       "kids-safe-dns",
+		Logic:      `InClientGroup(ClientIP, "kids")`,
+		Action:     policy.ActionForward,
+		ActionData: kidsUpstream,
+		Enabled:    true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	logger := logging.NewDefault()
+	h := NewHandler()
+	h.SetPolicyEngine(engine)
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{defaultUpstream}}, logger, nil))
+	dnsCache, _ := cache.New(&config.CacheConfig{
+		Enabled:     true,
+		MaxEntries:  100,
+		MinTTL:      1 * time.Second,
+		MaxTTL:      3600 * time.Second,
+		NegativeTTL: 300 * time.Second,
+	}, logger, nil)
+	h.SetCache(dnsCache)
+
+	query := func(client string) string {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP(client), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion("video.test.", dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("%s: expected one answer, got %v", client, w.msg)
+		}
+		return w.msg.Answer[0].(*dns.A).A.String()
+	}
+
+	// Without scoping the kids' FORWARD answer is served from cache to
+	// everyone; this pins the old behaviour the option turns off.
+	if got := query("192.168.1.20"); got != "192.0.2.99" {
+		t.Fatalf("kids client got %s, want the kids upstream answer", got)
+	}
+	if got := query("192.168.1.30"); got != "192.0.2.99" {
+		t.Fatalf("unscoped cache: other client got %s, want the shared entry", got)
+	}
+
+	dnsCache.Clear()
+	h.SetCacheByClientGroup(true)
+	if got := query("192.168.1.20"); got != "192.0.2.99" {
+		t.Fatalf("kids client got %s, want the kids upstream answer", got)
+	}
+	if got := query("192.168.1.30"); got != "192.0.2.1" {
+		t.Errorf("other client got %s from the kids' cache entry", got)
+	}
+	// Both answers are now cached, each for its own clients.
+	if got := query("192.168.1.20"); got != "192.0.2.99" {
+		t.Errorf("kids client got %s on a cache hit", got)
+	}
+	if got := query("192.168.1.30"); got != "192.0.2.1" {
+		t.Errorf("other client got %s on a cache hit", got)
+	}
+}
+
+func TestCacheScope(t *testing.T) {
+	resolver := policy.NewSQLiteResolver(&groupProfiles{profiles: []*storage.ClientProfile{
+		{ClientIP: "10.0.0.1", GroupName: "kids"},
+	}})
+	if err := resolver.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	policy.SetClientGroupResolver(resolver)
+	t.Cleanup(func() { policy.SetClientGroupResolver(nil) })
+
+	for _, tc := range []struct{ ip, assigned, want string }{
+		{"10.0.0.9", "", ""},
+		{"10.0.0.1", "", "kids"},
+		{"10.0.0.9", "guests", "guests"},
+		{"10.0.0.1", "guests", "guests,kids"},
+		{"10.0.0.1", "kids", "kids"},
+	} {
+		if got := cacheScope(tc.ip, tc.assigned); got != tc.want {
+			t.Errorf("cacheScope(%s, %q) = %q, want %q", tc.ip, tc.assigned, got, tc.want)
+		}
+	}
+}
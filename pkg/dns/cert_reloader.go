@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"glory-hole/pkg/logging"
+)
+
+// certReloadInterval is how often a handshake may trigger a check of the
+// certificate files. Between checks every handshake is a single atomic load.
+const certReloadInterval = 30 * time.Second
+
+// certReloader serves a manually configured certificate (tls.cert_file /
+// tls.key_file) and picks up replaced files without a restart, so an
+// external renewer (certbot, cert-manager, a mounted secret) only has to
+// write the new PEMs. Files are checked at most once per
+// certReloadInterval, from the handshake path: no watcher goroutine to stop.
+// A pair that fails to load (e.g. caught mid-write) is logged and retried on
+// the next check while the current certificate keeps being served.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   *logging.Logger
+
+	cert      atomic.Pointer[tls.Certificate]
+	checkedAt atomic.Int64 // unix nanos of the last file check
+
+	mu    sync.Mutex // serializes reloads
+	stamp certStamp  // files the current cert was loaded from
+}
+
+// certStamp identifies one version of the cert/key files.
+type certStamp struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// newCertReloader loads the initial key pair; failing that is a startup error.
+func newCertReloader(certFile, keyFile string, logger *logging.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	stamp, err := r.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load x509 key pair: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.stamp = stamp
+	r.checkedAt.Store(time.Now().UnixNano())
+	return r, nil
+}
+
+// getCertificate is the tls.Config.GetCertificate callback.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	now := time.Now()
+	if now.UnixNano()-r.checkedAt.Load() >= int64(certReloadInterval) {
+		r.reload(now)
+	}
+	cert := r.cert.Load()
+	if cert == nil {
+		return nil, errors.New("certificate not initialized")
+	}
+	return cert, nil
+}
+
+// reload re-reads the key pair if either file changed since it was loaded.
+func (r *certReloader) reload(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.UnixNano()-r.checkedAt.Load() < int64(certReloadInterval) {
+		return // another handshake just checked
+	}
+	r.checkedAt.Store(now.UnixNano())
+
+	stamp, err := r.statFiles()
+	if err != nil {
+		r.logger.Warn("TLS certificate check failed, keeping current certificate", "error", err)
+		return
+	}
+	if stamp == r.stamp {
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.logger.Warn("TLS certificate changed but failed to load, keeping current certificate",
+			"cert_file", r.certFile, "error", err)
+		return
+	}
+	r.cert.Store(&cert)
+	r.stamp = stamp
+	r.logger.Info("TLS certificate reloaded", "cert_file", r.certFile)
+}
+
+func (r *certReloader) statFiles() (certStamp, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return certStamp{}, fmt.Errorf("stat cert file: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return certStamp{}, fmt.Errorf("stat key file: %w", err)
+	}
+	return certStamp{
+		certMod:  certInfo.ModTime(),
+		keyMod:   keyInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+	}, nil
+}
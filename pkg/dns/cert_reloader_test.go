@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/logging"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writePair := func(host string) {
+		t.Helper()
+		certPEM, keyPEM := generateSelfSignedPEMWithExpiry(t, host, -time.Hour, 24*time.Hour)
+		if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	servedHost := func(r *certReloader) string {
+		t.Helper()
+		cert, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("getCertificate() error = %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.DNSNames[0]
+	}
+	// expireCheck makes the next handshake re-check the files.
+	expireCheck := func(r *certReloader) {
+		r.checkedAt.Store(time.Now().Add(-certReloadInterval).UnixNano())
+	}
+
+	writePair("old.example.com")
+	r, err := newCertReloader(certFile, keyFile, logging.NewDefault())
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	if got := servedHost(r); got != "old.example.com" {
+		t.Fatalf("served %q, want old.example.com", got)
+	}
+
+	// Replaced files are not looked at until the check interval passes.
+	writePair("rotated.example.com")
+	if got := servedHost(r); got != "old.example.com" {
+		t.Errorf("reloaded before the check interval: served %q", got)
+	}
+	expireCheck(r)
+	if got := servedHost(r); got != "rotated.example.com" {
+		t.Errorf("served %q after rotation, want rotated.example.com", got)
+	}
+
+	// A broken pair keeps the last good certificate.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expireCheck(r)
+	if got := servedHost(r); got != "rotated.example.com" {
+		t.Errorf("served %q after a bad write, want the previous certificate", got)
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "missing.pem"), keyFile, logging.NewDefault()); err == nil {
+		t.Error("expected error for a missing cert file")
+	}
+}
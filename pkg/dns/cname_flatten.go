@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxFlattenChain bounds how many CNAME hops flattening follows, matching the
+// local records CNAME resolver.
+const maxFlattenChain = 10
+
+// upstreamExchange sends a query to the upstreams that answered the original
+// query, so flattening follows the chain through the same resolvers.
+type upstreamExchange func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// maybeFlattenCNAME flattens resp when forwarder.flatten_cname is enabled.
+func (h *Handler) maybeFlattenCNAME(ctx context.Context, r, resp *dns.Msg, exchange upstreamExchange) *dns.Msg {
+	if !h.deps.Load().flattenCNAME {
+		return resp
+	}
+	return flattenCNAME(ctx, r, resp, exchange)
+}
+
+// flattenCNAME rewrites an A/AAAA answer that goes through a CNAME chain so it
+// holds only address records owned by the queried name. The chain is followed
+// through the records already in resp, querying upstream for any hop the
+// response stops at. Every record in the chain bounds the TTL of the result.
+//
+// resp is returned unchanged when there is nothing to flatten or the chain
+// cannot be resolved: it loops, exceeds maxFlattenChain, ends without
+// addresses, or an upstream lookup fails. The flattened answer is synthesized,
+// so its AD bit is cleared and chain signatures are dropped.
+func flattenCNAME(ctx context.Context, r, resp *dns.Msg, exchange upstreamExchange) *dns.Msg {
+	if resp == nil || resp.Rcode != dns.RcodeSuccess || len(r.Question) == 0 {
+		return resp
+	}
+	q := r.Question[0]
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA {
+		return resp
+	}
+
+	name := strings.ToLower(q.Name)
+	seen := map[string]bool{name: true}
+	minTTL := ^uint32(0)
+	msg := resp
+
+	for hops := 0; ; {
+		var addrs []dns.RR
+		next := ""
+		for _, rr := range msg.Answer {
+			hdr := rr.Header()
+			if !strings.EqualFold(hdr.Name, name) {
+				continue
+			}
+			switch v := rr.(type) {
+			case *dns.CNAME:
+				next = strings.ToLower(v.Target)
+				minTTL = min(minTTL, hdr.Ttl)
+			case *dns.A, *dns.AAAA:
+				if hdr.Rrtype == q.Qtype {
+					addrs = append(addrs, rr)
+				}
+			}
+		}
+
+		if len(addrs) > 0 {
+			if hops == 0 {
+				return resp // the name has addresses of its own
+			}
+			return flattenedReply(resp, q, addrs, minTTL)
+		}
+		if next == "" || seen[next] {
+			return resp
+		}
+		if hops++; hops > maxFlattenChain {
+			return resp
+		}
+		seen[next] = true
+		name = next
+
+		if hasOwner(msg, name) {
+			continue
+		}
+		m := new(dns.Msg)
+		m.SetQuestion(name, q.Qtype)
+		m.RecursionDesired = true
+		if opt := r.IsEdns0(); opt != nil {
+			m.SetEdns0(opt.UDPSize(), opt.Do())
+		}
+		reply, err := exchange(ctx, m)
+		if err != nil || reply == nil || reply.Rcode != dns.RcodeSuccess {
+			return resp
+		}
+		msg = reply
+	}
+}
+
+// hasOwner reports whether msg's answer section has a record owned by name.
+func hasOwner(msg *dns.Msg, name string) bool {
+	for _, rr := range msg.Answer {
+		if strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenedReply copies resp with its answer replaced by addrs, renamed to
+// the question name and capped at ttl.
+func flattenedReply(resp *dns.Msg, q dns.Question, addrs []dns.RR, ttl uint32) *dns.Msg {
+	for _, rr := range addrs {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	out := resp.Copy()
+	out.AuthenticatedData = false
+	out.Answer = make([]dns.RR, 0, len(addrs))
+	for _, rr := range addrs {
+		cp := dns.Copy(rr)
+		cp.Header().Name = q.Name
+		cp.Header().Ttl = ttl
+		out.Answer = append(out.Answer, cp)
+	}
+	return out
+}
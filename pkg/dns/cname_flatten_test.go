@@ -0,0 +1,159 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/cache"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+// startZoneUpstream serves fixed answer sections keyed by lowercased query
+// name, as RR strings. Unknown names get an empty NOERROR answer.
+func startZoneUpstream(t *testing.T, zone map[string][]string) (string, *atomic.Int32) {
+	t.Helper()
+	var queries atomic.Int32
+	addr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		for _, s := range zone[strings.ToLower(r.Question[0].Name)] {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Errorf("bad test RR %q: %v", s, err)
+				continue
+			}
+			m.Answer = append(m.Answer, rr)
+		}
+		_ = w.WriteMsg(m)
+	})
+	return addr, &queries
+}
+
+func TestServeDNS_FlattenCNAME(t *testing.T) {
+	upstream, queries := startZoneUpstream(t, map[string][]string{
+		// Full chain in one response, as recursive resolvers return it.
+		"www.shop.test.": {
+			"www.shop.test. 300 IN CNAME shop.cdn.test.",
+			"shop.cdn.test. 60 IN CNAME edge.cdn.test.",
+			"edge.cdn.test. 120 IN A 203.0.113.10",
+			"edge.cdn.test. 120 IN A 203.0.113.11",
+		},
+		// Chain that stops at a CNAME; the target needs its own query.
+		"apex.test.":        {"apex.test. 300 IN CNAME lb.provider.test."},
+		"lb.provider.test.": {"lb.provider.test. 30 IN A 198.51.100.7"},
+		// Loop.
+		"loop1.test.": {"loop1.test. 60 IN CNAME loop2.test."},
+		"loop2.test.": {"loop2.test. 60 IN CNAME loop1.test."},
+		// Dangling CNAME: the target has no addresses.
+		"dangling.test.": {"dangling.test. 60 IN CNAME nowhere.test."},
+		"plain.test.":    {"plain.test. 60 IN A 192.0.2.1"},
+	})
+
+	logger := logging.NewDefault()
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{upstream}}, logger, nil))
+	dnsCache, _ := cache.New(&config.CacheConfig{
+		Enabled:     true,
+		MaxEntries:  100,
+		MinTTL:      1 * time.Second,
+		MaxTTL:      3600 * time.Second,
+		NegativeTTL: 300 * time.Second,
+	}, logger, nil)
+	h.SetCache(dnsCache)
+	h.SetFlattenCNAME(true)
+
+	query := func(name string) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatalf("no response for %s", name)
+		}
+		return w.msg
+	}
+	onlyAddresses := func(resp *dns.Msg, owner string, want int, ttl uint32) {
+		t.Helper()
+		if len(resp.Answer) != want {
+			t.Fatalf("%s: expected %d answers, got %v", owner, want, resp.Answer)
+		}
+		for _, rr := range resp.Answer {
+			a, ok := rr.(*dns.A)
+			if !ok || a.Hdr.Name != owner || a.Hdr.Ttl > ttl {
+				t.Errorf("%s: unexpected flattened record %v (want A owned by the query name, TTL <= %d)", owner, rr, ttl)
+			}
+		}
+	}
+
+	onlyAddresses(query("WWW.shop.test."), "WWW.shop.test.", 2, 60)
+	onlyAddresses(query("apex.test."), "apex.test.", 1, 30)
+
+	// Served from cache, still flattened, with no further upstream queries.
+	before := queries.Load()
+	onlyAddresses(query("apex.test."), "apex.test.", 1, 30)
+	if queries.Load() != before {
+		t.Error("flattened answer should have been served from cache")
+	}
+
+	for _, name := range []string{"loop1.test.", "dangling.test."} {
+		resp := query(name)
+		if len(resp.Answer) == 0 {
+			t.Fatalf("%s: expected the original CNAME answer, got none", name)
+		}
+		if _, ok := resp.Answer[0].(*dns.CNAME); !ok {
+			t.Errorf("%s: unresolvable chain should be left as is, got %v", name, resp.Answer)
+		}
+	}
+
+	onlyAddresses(query("plain.test."), "plain.test.", 1, 60)
+
+	h.SetFlattenCNAME(false)
+	h.SetCache(nil)
+	resp := query("www.shop.test.")
+	if len(resp.Answer) != 4 {
+		t.Errorf("with flattening off the chain should be returned as is, got %v", resp.Answer)
+	}
+}
+
+func TestFlattenCNAME_MaxChain(t *testing.T) {
+	// Build a chain one hop longer than allowed, all in one response.
+	resp := new(dns.Msg)
+	r := new(dns.Msg)
+	r.SetQuestion(chainName(0), dns.TypeA)
+	resp.SetReply(r)
+	for i := 0; i <= maxFlattenChain; i++ {
+		rr, _ := dns.NewRR(chainName(i) + " 60 IN CNAME " + chainName(i+1))
+		resp.Answer = append(resp.Answer, rr)
+	}
+	rr, _ := dns.NewRR(chainName(maxFlattenChain+1) + " 60 IN A 192.0.2.1")
+	resp.Answer = append(resp.Answer, rr)
+
+	noUpstream := func(context.Context, *dns.Msg) (*dns.Msg, error) {
+		t.Fatal("no upstream query expected")
+		return nil, nil
+	}
+	if got := flattenCNAME(context.Background(), r, resp, noUpstream); got != resp {
+		t.Error("a chain longer than maxFlattenChain should not be flattened")
+	}
+
+	// One hop shorter flattens.
+	resp.Answer = append(resp.Answer[1:maxFlattenChain+1], rr)
+	r.SetQuestion(chainName(1), dns.TypeA)
+	if got := flattenCNAME(context.Background(), r, resp, noUpstream); len(got.Answer) != 1 || got.Answer[0].Header().Name != chainName(1) {
+		t.Errorf("chain of %d hops should flatten, got %v", maxFlattenChain, got.Answer)
+	}
+}
+
+func chainName(i int) string {
+	return "c" + string(rune('a'+i)) + ".test."
+}
@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval is how often Drain re-checks in-flight work.
+const drainPollInterval = 10 * time.Millisecond
+
+// Drain waits for in-flight ServeDNS calls and background cache refreshes to
+// finish, then closes the query logger so its buffered entries are written to
+// storage. Call it after the listeners (DNS and DoH) have stopped accepting
+// queries and before storage is closed. It returns ctx.Err() if the deadline
+// passes first; entries still buffered at that point may be lost.
+func (h *Handler) Drain(ctx context.Context) error {
+	if err := waitForZero(ctx, h.inflight.Load); err != nil {
+		return err
+	}
+
+	if ql := h.getQueryLogger(); ql != nil {
+		done := make(chan struct{})
+		go func() {
+			_ = ql.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return waitForZero(ctx, legacyLogPending.Load)
+}
+
+// waitForZero polls count until it reaches zero or ctx is done.
+func waitForZero(ctx context.Context, count func() int64) error {
+	if count() <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if count() <= 0 {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+// startSlowUpstream answers every query after delay.
+func startSlowUpstream(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	return startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(delay)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})
+}
+
+func newDrainHandler(t *testing.T, delay time.Duration) (*Handler, *mockStorage) {
+	t.Helper()
+	cfg := &config.Config{UpstreamDNSServers: []string{startSlowUpstream(t, delay)}}
+	fwd := forwarder.NewForwarder(cfg, logging.NewDefault(), nil)
+	fwd.SetTimeout(5 * time.Second)
+
+	stor := newMockStorage()
+	h := NewHandler()
+	h.SetForwarder(fwd)
+	h.SetQueryLogger(NewQueryLogger(stor, nil, 100, 1))
+	return h, stor
+}
+
+func startQuery(h *Handler) {
+	go func() {
+		r := new(dns.Msg)
+		r.SetQuestion("slow.example.com.", dns.TypeA)
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		h.ServeDNS(context.Background(), w, r)
+	}()
+}
+
+func waitInflight(t *testing.T, h *Handler) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for h.inflight.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("query never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDrain_WaitsForInflightQueryAndFlushesLog(t *testing.T) {
+	h, stor := newDrainHandler(t, 150*time.Millisecond)
+	startQuery(h)
+	waitInflight(t, h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if got := stor.Count(); got != 1 {
+		t.Errorf("expected the in-flight query to be logged before Drain returned, got %d entries", got)
+	}
+}
+
+func TestDrain_Timeout(t *testing.T) {
+	h, _ := newDrainHandler(t, 300*time.Millisecond)
+	startQuery(h)
+	waitInflight(t, h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDrain_Idle(t *testing.T) {
+	h := NewHandler()
+	if err := h.Drain(context.Background()); err != nil {
+		t.Errorf("Drain on an idle handler: %v", err)
+	}
+}
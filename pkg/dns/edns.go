@@ -1,6 +1,8 @@
 package dns
 
 import (
+	"slices"
+
 	"github.com/miekg/dns"
 )
 
@@ -110,6 +112,26 @@ func HandleEDNS0(req *dns.Msg, resp *dns.Msg) {
 	SetEDNS0(resp, ednsInfo)
 }
 
+// StripClientSubnet removes every EDNS Client Subnet option (RFC 7871) from
+// req so it isn't forwarded upstream. Reports whether any was removed.
+func StripClientSubnet(req *dns.Msg) bool {
+	if req == nil {
+		return false
+	}
+	opt := req.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	n := len(opt.Option)
+	opt.Option = slices.DeleteFunc(opt.Option, isClientSubnet)
+	return len(opt.Option) != n
+}
+
+func isClientSubnet(o dns.EDNS0) bool {
+	_, ok := o.(*dns.EDNS0_SUBNET)
+	return ok
+}
+
 // ExtractEDE extracts the Extended DNS Error (RFC 8914) from a DNS response.
 // Returns the info code, human-readable text, and whether EDE was present.
 func ExtractEDE(resp *dns.Msg) (uint16, string, bool) {
@@ -128,6 +150,36 @@ func ExtractEDE(resp *dns.Msg) (uint16, string, bool) {
 	return 0, "", false
 }
 
+// SetEDE attaches an Extended DNS Error (RFC 8914) to resp, replacing any it
+// already carries. EDE lives in the OPT record, so nothing is added when resp
+// has none (the client did not send EDNS0).
+func SetEDE(resp *dns.Msg, code uint16, text string) {
+	if resp == nil {
+		return
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return
+	}
+	opt.Option = slices.DeleteFunc(opt.Option, isEDE)
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: code, ExtraText: text})
+}
+
+// StripEDE removes every Extended DNS Error option from resp.
+func StripEDE(resp *dns.Msg) {
+	if resp == nil {
+		return
+	}
+	if opt := resp.IsEdns0(); opt != nil {
+		opt.Option = slices.DeleteFunc(opt.Option, isEDE)
+	}
+}
+
+func isEDE(o dns.EDNS0) bool {
+	_, ok := o.(*dns.EDNS0_EDE)
+	return ok
+}
+
 // EDECodeToString returns a human-readable name for an EDE info code (RFC 8914).
 func EDECodeToString(code uint16) string {
 	switch code {
@@ -1,9 +1,16 @@
 package dns
 
 import (
+	"context"
+	"net"
+	"sync/atomic"
 	"testing"
 
 	"github.com/miekg/dns"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
 )
 
 func TestGetEDNSInfo_NoEDNS(t *testing.T) {
@@ -288,3 +295,80 @@ func TestHandleEDNS0_BufferSizeNegotiation(t *testing.T) {
 		})
 	}
 }
+
+func newECSQuery() *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP("198.51.100.0").To4()},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0123456789abcdef"},
+	)
+	return req
+}
+
+func TestStripClientSubnet(t *testing.T) {
+	req := newECSQuery()
+	if !StripClientSubnet(req) {
+		t.Fatal("expected ECS option to be removed")
+	}
+	opt := req.IsEdns0()
+	if len(opt.Option) != 1 {
+		t.Fatalf("expected only the cookie option to remain, got %v", opt.Option)
+	}
+	if _, ok := opt.Option[0].(*dns.EDNS0_COOKIE); !ok {
+		t.Errorf("expected cookie option, got %T", opt.Option[0])
+	}
+	if StripClientSubnet(req) {
+		t.Error("second strip should report nothing removed")
+	}
+	if StripClientSubnet(nil) {
+		t.Error("nil request should report nothing removed")
+	}
+}
+
+func TestServeDNS_ClientSubnet(t *testing.T) {
+	var sawECS atomic.Bool
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		sawECS.Store(false)
+		if opt := r.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+					sawECS.Store(true)
+				}
+			}
+		}
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("93.184.216.34"),
+		})
+		_ = w.WriteMsg(m)
+	})
+
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	query := func() {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		h.ServeDNS(context.Background(), w, newECSQuery())
+		if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("expected NOERROR response, got %v", w.msg)
+		}
+	}
+
+	query()
+	if sawECS.Load() {
+		t.Error("client-supplied ECS should be stripped by default")
+	}
+
+	h.SetForwardClientSubnet(true)
+	query()
+	if !sawECS.Load() {
+		t.Error("client-supplied ECS should be forwarded when enabled")
+	}
+}
@@ -0,0 +1,184 @@
+package dns
+
+import (
+	"context"
+	"strings"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/pattern"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+// Decision actions reported by Explain.
+const (
+	DecisionAnswer   = "answer"   // answered locally (local records, special-use names, ANY)
+	DecisionBlock    = "block"    // policy BLOCK or blocklist
+	DecisionAllow    = "allow"    // policy ALLOW: forwarded, blocklist bypassed
+	DecisionRedirect = "redirect" // policy REDIRECT, or a blocklist match in a blocklist_redirects category
+	DecisionForward  = "forward"  // policy FORWARD to specific upstreams, or default upstreams
+)
+
+// Decision is the outcome ServeDNS would reach for a query, computed without
+// resolving it, touching the cache, or recording metrics.
+type Decision struct {
+	Action           string                `json:"action"`
+	Stage            string                `json:"stage"` // pipeline stage that decided
+	Rule             string                `json:"rule,omitempty"`
+	Detail           string                `json:"detail,omitempty"`
+	Category         string                `json:"category,omitempty"`         // block category of the deciding list or rule
+	Blocklist        blocklist.MatchResult `json:"-"`                          // blocklist match, evaluated even when a policy decided
+	AllowOverridden  string                `json:"allow_overridden,omitempty"` // ALLOW rule that lost to a more specific blocklist entry
+	PoliciesEnabled  bool                  `json:"policies_enabled"`
+	BlocklistEnabled bool                  `json:"blocklist_enabled"`
+}
+
+// QueryResult is what ServeDNS actually did with one query, reported to
+// callers that pass it in via WithQueryResult.
+type QueryResult struct {
+	Outcome  string // blocked, cached, forwarded or answered
+	Upstream string // upstream that answered, if forwarded
+	Rcode    int
+}
+
+type queryResultKey struct{}
+
+// WithQueryResult returns a context that makes ServeDNS fill res once the
+// query has been answered. The DoH debug header uses it to report whether an
+// answer came from the cache, which Explain can't know.
+func WithQueryResult(ctx context.Context, res *QueryResult) context.Context {
+	return context.WithValue(ctx, queryResultKey{}, res)
+}
+
+func queryResultFrom(ctx context.Context) *QueryResult {
+	res, _ := ctx.Value(queryResultKey{}).(*QueryResult)
+	return res
+}
+
+// Explain walks the ServeDNS pipeline for domain as asked by clientIP with
+// qtype and reports the first stage that would answer. A client group set
+// on ctx with WithClientGroup applies as it does in ServeDNS. Response-cache
+// contents are ignored: cached upstream answers never change a decision.
+func (h *Handler) Explain(ctx context.Context, domain, clientIP string, qtype uint16) Decision {
+	d := h.deps.Load()
+	group := clientGroupFrom(ctx)
+	fqdn := pattern.NormalizeFQDN(domain)
+	enablePolicies, enableBlocklist := h.resolveFeatureToggles(d)
+	dec := Decision{PoliciesEnabled: enablePolicies, BlocklistEnabled: enableBlocklist}
+	if mgr := d.blocklistManager; mgr != nil {
+		dec.Blocklist = mgr.Match(fqdn)
+	}
+
+	if hn := d.healthName; hn != nil && strings.EqualFold(fqdn, hn.name) {
+		dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStageHealthName, "health check name is answered locally"
+		return dec
+	}
+	if qtype == dns.TypeANY && d.anyQuery != config.AnyQueryForward {
+		dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStageAnyQuery, "ANY queries are answered locally ("+anyQueryModeLabel(d.anyQuery)+")"
+		return dec
+	}
+	if lr := d.localRecords; lr != nil && lr.HasRecord(fqdn) {
+		dec.Action, dec.Stage, dec.Detail = DecisionAnswer, "local_records", "name is defined in local records"
+		return dec
+	}
+	if _, ok := lookupStaticAnswer(d.staticAnswers, fqdn, qtype); ok {
+		dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStageStaticAnswer, "answered from static_answers"
+		return dec
+	}
+	if _, refused := d.refusedTypes[qtype]; refused {
+		dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStageRefusedType, dnsTypeLabel(qtype)+" queries are disabled"
+		return dec
+	}
+	if at := d.allowedTypes; at != nil {
+		if group, denied := at.denies(clientIP, group, qtype); denied {
+			dec.Action, dec.Stage, dec.Rule, dec.Detail = DecisionAnswer, traceStageAllowedType, group, dnsTypeLabel(qtype)+" queries are not allowed for client group "+group
+			return dec
+		}
+	}
+	if g := d.specialUse; g != nil {
+		if zone, ok := g.zone(fqdn); ok {
+			dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStageSpecialUse, "special-use zone "+zone+" is not forwarded upstream"
+			if zone == "localhost" {
+				dec.Detail = localhostDetail
+			}
+			return dec
+		}
+	}
+
+	if pr := d.privateReverse; qtype == dns.TypePTR && pr.Mode != "" && pr.Mode != config.PrivateReverseForward &&
+		isPrivateReverse(fqdn) && !h.policyForwards(d, fqdn, clientIP, group, dnsTypeLabel(qtype)) {
+		if pr.Mode == config.PrivateReverseUpstream && len(pr.Upstreams) > 0 {
+			dec.Action, dec.Stage, dec.Detail = DecisionForward, traceStagePrivateReverse, "private reverse lookup sent to "+strings.Join(pr.Upstreams, ", ")
+		} else {
+			dec.Action, dec.Stage, dec.Detail = DecisionAnswer, traceStagePrivateReverse, "private reverse lookup answered NXDOMAIN locally"
+		}
+		return dec
+	}
+
+	if pe := d.policyEngine; enablePolicies && pe != nil && pe.Count() > 0 {
+		policyCtx := policy.NewContext(strings.TrimSuffix(fqdn, "."), clientIP, dnsTypeLabel(qtype))
+		policyCtx.ClientGroup = group
+		matched, rule := pe.Match(policyCtx)
+		if matched && rule != nil {
+			overridden := rule.Action == policy.ActionAllow && enableBlocklist && !d.allowAlwaysWins &&
+				h.allowOverriddenByBlocklist(rule, fqdn, &blockTraceRecorder{})
+			if overridden {
+				dec.AllowOverridden = rule.Name
+			} else if action := policyDecision(rule.Action); action != "" {
+				dec.Action, dec.Stage, dec.Rule = action, traceStagePolicy, rule.Name
+				dec.Detail = "policy rule matched: " + rule.Logic
+				dec.Category = rule.BlockCategory()
+				return dec
+			}
+		}
+	}
+
+	if enableBlocklist {
+		if dec.Blocklist.Blocked {
+			if category, sink := blockRedirectForSources(d.blockCategories, d.blockRedirects, dec.Blocklist.Sources); sink != nil {
+				dec.Action, dec.Stage, dec.Category = DecisionRedirect, traceStageBlocklist, category
+				dec.Detail = describeBlockMatch(dec.Blocklist) + ", redirected to sink"
+				return dec
+			}
+			dec.Action, dec.Stage, dec.Detail = DecisionBlock, traceStageBlocklist, describeBlockMatch(dec.Blocklist)
+			dec.Category = blockCategoryForSources(d.blockCategories, dec.Blocklist.Sources)
+			return dec
+		}
+		if d.blocklistManager == nil && h.Blocklist != nil {
+			h.lookupMu.RLock()
+			_, blocked := h.Blocklist[fqdn]
+			h.lookupMu.RUnlock()
+			if blocked {
+				dec.Action, dec.Stage, dec.Detail = DecisionBlock, traceStageBlocklist, "Matched legacy blocklist entry"
+				return dec
+			}
+		}
+	}
+
+	dec.Action, dec.Stage, dec.Detail = DecisionForward, "upstream", "resolved by the default upstreams"
+	return dec
+}
+
+func policyDecision(action string) string {
+	switch action {
+	case policy.ActionBlock:
+		return DecisionBlock
+	case policy.ActionAllow:
+		return DecisionAllow
+	case policy.ActionRedirect:
+		return DecisionRedirect
+	case policy.ActionForward:
+		return DecisionForward
+	default:
+		return ""
+	}
+}
+
+func anyQueryModeLabel(mode string) string {
+	if mode == "" {
+		return config.AnyQueryMinimal
+	}
+	return mode
+}
@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/localrecords"
+
+	"github.com/miekg/dns"
+)
+
+func TestExplain_MatchesServeDNS(t *testing.T) {
+	h := newPrecedenceHandler(t, wildcardAllowExampleCom, []string{"ads.example.com.", "tracker.net."})
+
+	tests := []struct {
+		domain     string
+		wantAction string
+		wantStage  string
+	}{
+		{"ads.example.com", DecisionBlock, traceStageBlocklist}, // exact block beats wildcard allow
+		{"www.example.com.", DecisionAllow, traceStagePolicy},   // allowed by the rule
+		{"cdn.tracker.net", DecisionBlock, traceStageBlocklist}, // parent listed
+		{"unrelated.org", DecisionForward, "upstream"},          // nothing matches
+	}
+	for _, tt := range tests {
+		dec := h.Explain(context.Background(), tt.domain, "192.168.1.10", dns.TypeA)
+		if dec.Action != tt.wantAction || dec.Stage != tt.wantStage {
+			t.Errorf("Explain(%q) = %s/%s, want %s/%s", tt.domain, dec.Action, dec.Stage, tt.wantAction, tt.wantStage)
+		}
+
+		rcode, _ := queryRcode(t, h, dns.Fqdn(tt.domain))
+		if blocked := rcode == dns.RcodeNameError; blocked != (dec.Action == DecisionBlock) {
+			t.Errorf("%s: Explain says %s but ServeDNS returned %s", tt.domain, dec.Action, dns.RcodeToString[rcode])
+		}
+	}
+
+	dec := h.Explain(context.Background(), "ads.example.com", "192.168.1.10", dns.TypeA)
+	if dec.AllowOverridden != "allow" {
+		t.Errorf("expected the overridden ALLOW rule to be reported, got %q", dec.AllowOverridden)
+	}
+	if dec.Blocklist.Entry != "ads.example.com" || dec.Blocklist.Kind != "exact" {
+		t.Errorf("unexpected blocklist match: %+v", dec.Blocklist)
+	}
+
+	dec = h.Explain(context.Background(), "www.example.com", "192.168.1.10", dns.TypeA)
+	if dec.Rule != "allow" {
+		t.Errorf("expected allow rule to be named, got %q", dec.Rule)
+	}
+
+	h.SetWhitelistAlwaysWins(true)
+	if dec := h.Explain(context.Background(), "ads.example.com", "192.168.1.10", dns.TypeA); dec.Action != DecisionAllow {
+		t.Errorf("whitelist_always_wins: expected allow, got %s", dec.Action)
+	}
+}
+
+func TestExplain_LocalStages(t *testing.T) {
+	h := newPrecedenceHandler(t, `Domain == "nothing.invalid"`, []string{"nas.lan."})
+
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewARecord("nas.lan.", net.ParseIP("192.168.1.5"))); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+	h.SetSpecialUseNames(config.SpecialUseNamesConfig{Enabled: true})
+
+	if dec := h.Explain(context.Background(), "nas.lan", "", dns.TypeA); dec.Action != DecisionAnswer || dec.Stage != "local_records" {
+		t.Errorf("local record: got %s/%s", dec.Action, dec.Stage)
+	}
+	if dec := h.Explain(context.Background(), "printer.local", "", dns.TypeA); dec.Action != DecisionAnswer || dec.Stage != traceStageSpecialUse {
+		t.Errorf("special-use: got %s/%s", dec.Action, dec.Stage)
+	}
+	if dec := h.Explain(context.Background(), "example.com", "", dns.TypeANY); dec.Action != DecisionAnswer || dec.Stage != traceStageAnyQuery {
+		t.Errorf("ANY: got %s/%s", dec.Action, dec.Stage)
+	}
+}
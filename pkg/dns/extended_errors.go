@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"errors"
+
+	"glory-hole/pkg/forwarder"
+
+	"github.com/miekg/dns"
+)
+
+// attachEDE adds an Extended DNS Error to a response generated here when
+// server.extended_dns_errors is on.
+func (h *Handler) attachEDE(msg *dns.Msg, code uint16, text string) {
+	if !h.deps.Load().extendedErrors {
+		return
+	}
+	SetEDE(msg, code, text)
+}
+
+// attachForwardFailureEDE explains a SERVFAIL caused by err from the
+// forwarder: no reachable upstream when every breaker is open, otherwise a
+// network error talking to the upstream.
+func (h *Handler) attachForwardFailureEDE(msg *dns.Msg, err error) {
+	if errors.Is(err, forwarder.ErrNoHealthyUpstreams) || errors.Is(err, forwarder.ErrCircuitOpen) {
+		h.attachEDE(msg, dns.ExtendedErrorCodeNoReachableAuthority, "no upstream resolver available")
+		return
+	}
+	h.attachEDE(msg, dns.ExtendedErrorCodeNetworkError, "upstream query failed")
+}
+
+// captureUpstreamEDE records the upstream's Extended DNS Error on the outcome
+// for the query log, then removes it from resp when server.strip_upstream_ede
+// is on. resp is the forwarder's copy, so it is safe to modify.
+func (h *Handler) captureUpstreamEDE(resp *dns.Msg, outcome *serveDNSOutcome) {
+	edeCode, edeText, hasEDE := ExtractEDE(resp)
+	if !hasEDE {
+		return
+	}
+	codeName := EDECodeToString(edeCode)
+	if edeText != "" {
+		outcome.upstreamError = codeName + ": " + edeText
+	} else {
+		outcome.upstreamError = codeName
+	}
+	if h.deps.Load().stripUpstreamEDE {
+		StripEDE(resp)
+	}
+}
@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+// queryEDNS sends an EDNS0 query for domain and returns the response.
+func queryEDNS(t *testing.T, h *Handler, domain string, edns bool) *dns.Msg {
+	t.Helper()
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+	r := new(dns.Msg)
+	r.SetQuestion(domain, dns.TypeA)
+	if edns {
+		r.SetEdns0(1232, false)
+	}
+	h.ServeDNS(context.Background(), w, r)
+	if w.msg == nil {
+		t.Fatalf("no response for %s", domain)
+	}
+	return w.msg
+}
+
+func TestExtendedDNSErrors_Blocks(t *testing.T) {
+	ads := serveList(t, "0.0.0.0 ads.example.com\n")
+	mgr := blocklist.NewManager(&config.Config{Blocklists: []string{ads}}, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:    "no-social",
+		Logic:   `Domain == "social.example.com"`,
+		Action:  policy.ActionBlock,
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetPolicyEngine(engine)
+
+	if _, _, ok := ExtractEDE(queryEDNS(t, h, "ads.example.com.", true)); ok {
+		t.Fatal("EDE is off by default")
+	}
+
+	h.SetExtendedDNSErrors(true, false)
+	code, text, ok := ExtractEDE(queryEDNS(t, h, "ads.example.com.", true))
+	if !ok || code != dns.ExtendedErrorCodeBlocked || text != "blocked by glory-hole" {
+		t.Errorf("blocklist block: got %d %q %v, want Blocked", code, text, ok)
+	}
+
+	h.SetDecisionTrace(true)
+	code, text, ok = ExtractEDE(queryEDNS(t, h, "social.example.com.", true))
+	if !ok || code != dns.ExtendedErrorCodeFiltered || text != "blocked by glory-hole; rule: no-social" {
+		t.Errorf("policy block: got %d %q %v, want Filtered naming the rule", code, text, ok)
+	}
+
+	// Without EDNS0 there is no OPT record to carry the option.
+	if resp := queryEDNS(t, h, "ads.example.com.", false); resp.IsEdns0() != nil {
+		t.Error("non-EDNS client should get no OPT record")
+	}
+}
+
+func TestExtendedDNSErrors_ForwardFailure(t *testing.T) {
+	h := NewHandler()
+	h.SetExtendedDNSErrors(true, false)
+
+	for _, tc := range []struct {
+		err  error
+		want uint16
+	}{
+		{forwarder.ErrNoHealthyUpstreams, dns.ExtendedErrorCodeNoReachableAuthority},
+		{errors.New("i/o timeout"), dns.ExtendedErrorCodeNetworkError},
+	} {
+		msg := new(dns.Msg)
+		msg.SetEdns0(1232, false)
+		h.attachForwardFailureEDE(msg, tc.err)
+		if code, _, ok := ExtractEDE(msg); !ok || code != tc.want {
+			t.Errorf("%v: got EDE %d (present %v), want %d", tc.err, code, ok, tc.want)
+		}
+	}
+}
+
+func TestExtendedDNSErrors_StripUpstream(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		m.SetEdns0(1232, false)
+		SetEDE(m, dns.ExtendedErrorCodeDNSBogus, "signature mismatch")
+		_ = w.WriteMsg(m)
+	})
+
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{upstream}}, logging.NewDefault(), nil))
+
+	if code, text, ok := ExtractEDE(queryEDNS(t, h, "bogus.example.", true)); !ok || code != dns.ExtendedErrorCodeDNSBogus || text != "signature mismatch" {
+		t.Errorf("upstream EDE should pass through by default, got %d %q %v", code, text, ok)
+	}
+
+	h.SetExtendedDNSErrors(false, true)
+	if _, _, ok := ExtractEDE(queryEDNS(t, h, "bogus2.example.", true)); ok {
+		t.Error("upstream EDE should be stripped with strip_upstream_ede")
+	}
+}
+
+func TestSetEDE_ReplacesExisting(t *testing.T) {
+	m := new(dns.Msg)
+	SetEDE(m, dns.ExtendedErrorCodeBlocked, "")
+	if m.IsEdns0() != nil {
+		t.Fatal("SetEDE must not add an OPT record")
+	}
+	m.SetEdns0(1232, false)
+	SetEDE(m, dns.ExtendedErrorCodeBlocked, "a")
+	SetEDE(m, dns.ExtendedErrorCodeFiltered, "b")
+	if n := len(m.IsEdns0().Option); n != 1 {
+		t.Fatalf("expected one EDE option, got %d", n)
+	}
+	StripEDE(m)
+	if _, _, ok := ExtractEDE(m); ok {
+		t.Error("StripEDE left an EDE option")
+	}
+}
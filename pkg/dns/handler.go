@@ -4,6 +4,9 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,15 +25,47 @@ import (
 	"glory-hole/pkg/unbound"
 
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// msgPool provides object pooling for dns.Msg to reduce allocations
+// msgPool provides object pooling for dns.Msg to reduce allocations.
+//
+// Reusing the section slices is safe because the handler only ever appends to
+// a pooled response and every ResponseWriter is done with it when WriteMsg
+// returns: miekg/dns packs it synchronously and the DoH writer copies it.
+// Nothing else keeps a reference (the cache stores deep copies).
 var msgPool = sync.Pool{
 	New: func() interface{} {
 		return new(dns.Msg)
 	},
 }
 
+// maxPooledRRs caps the section capacity kept by a pooled message, so one
+// large answer doesn't pin a big backing array in the pool.
+const maxPooledRRs = 16
+
+// getMsg returns an empty message from msgPool whose Answer, Ns and Extra
+// slices keep the capacity of their previous use.
+func getMsg() *dns.Msg {
+	msg := msgPool.Get().(*dns.Msg)
+	*msg = dns.Msg{
+		Answer: reuseRRs(msg.Answer),
+		Ns:     reuseRRs(msg.Ns),
+		Extra:  reuseRRs(msg.Extra),
+	}
+	return msg
+}
+
+// reuseRRs empties rrs for reuse, dropping the old records so a pooled
+// message doesn't keep them alive.
+func reuseRRs(rrs []dns.RR) []dns.RR {
+	if cap(rrs) == 0 || cap(rrs) > maxPooledRRs {
+		return nil
+	}
+	clear(rrs)
+	return rrs[:0]
+}
+
 // legacyLogRequest holds a query log request for the legacy storage path.
 type legacyLogRequest struct {
 	storage storage.Storage
@@ -44,6 +79,14 @@ type legacyLogRequest struct {
 var legacyLogCh chan legacyLogRequest
 var legacyLogOnce sync.Once
 
+// legacyLogPending counts legacy log requests queued or being written, so
+// Drain can wait for them.
+var legacyLogPending atomic.Int64
+
+// legacyLogDrops rate-limits the warning for requests dropped because
+// legacyLogCh is full.
+var legacyLogDrops = storage.NewDropWarner(storage.DropWarnInterval)
+
 func initLegacyLog() {
 	legacyLogOnce.Do(func() {
 		legacyLogCh = make(chan legacyLogRequest, 10000)
@@ -56,12 +99,14 @@ func initLegacyLog() {
 func legacyLogWorker() {
 	for req := range legacyLogCh {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-		if err := req.storage.LogQuery(ctx, req.log); err != nil && req.logger != nil {
+		// Full-buffer drops are counted and logged, rate limited, by storage.
+		if err := req.storage.LogQuery(ctx, req.log); err != nil && !errors.Is(err, storage.ErrBufferFull) && req.logger != nil {
 			req.logger.Error("Failed to log query to storage",
 				"domain", req.log.Domain,
 				"error", err)
 		}
 		cancel()
+		legacyLogPending.Add(-1)
 	}
 }
 
@@ -70,6 +115,7 @@ func legacyLogWorker() {
 type KillSwitchChecker interface {
 	IsBlocklistDisabled() (disabled bool, until time.Time)
 	IsPoliciesDisabled() (disabled bool, until time.Time)
+	IsLoggingPaused() (paused bool, until time.Time)
 }
 
 // handlerDeps bundles all hot-reloadable dependencies for lock-free reads
@@ -79,16 +125,52 @@ type handlerDeps struct {
 	storage          storage.Storage
 	queryLogger      *QueryLogger
 	blocklistManager *blocklist.Manager
+	startup          *startupGate // nil = forward unfiltered until blocklists load
 	localRecords     *localrecords.Manager
+	maxCNAMEDepth    int // local records CNAME chain limit; 0 = localrecords.DefaultMaxCNAMEDepth
 	policyEngine     *policy.Engine
 	fwd              *forwarder.Forwarder
+	upstreamsDown    func(upstreams []string) // passed to every forwarder; see SetUpstreamsDownHook
 	cache            cache.Interface
 	configWatcher    *config.Watcher
 	killSwitch       KillSwitchChecker
 	decisionTrace    bool
+	explainBlocks    bool // append a TXT explanation to blocked responses
+	extendedErrors   bool // attach RFC 8914 EDE options to our own errors and blocks
+	stripUpstreamEDE bool // remove EDE options from upstream responses
 	blockPageIP      string
 	unboundBuffer    *unbound.ReplyBuffer
 	metrics          *telemetry.Metrics
+	tracer           trace.Tracer     // nil = no spans
+	slowQuery        time.Duration    // 0 = slow-query log disabled
+	allowAlwaysWins  bool             // ALLOW rules beat blocklist entries regardless of specificity
+	anomaly          *anomalyDetector // nil = anomaly detection disabled
+	anomalyHook      func(Anomaly)
+	quota            *queryQuota         // nil = no daily query quota
+	specialUse       *specialUseGuard    // nil = special-use names are forwarded like any other
+	shuffleAnswers   bool                // randomize A/AAAA order in forwarded and cached answers
+	forwardECS       bool                // pass client-supplied EDNS Client Subnet upstream
+	cacheByGroup     bool                // scope cache entries by the client's groups
+	flattenCNAME     bool                // collapse forwarded CNAME chains into A/AAAA for the query name
+	anyQuery         string              // config.AnyQuery* mode; "" = minimal
+	refusedTypes     map[uint16]struct{} // query types answered NODATA; nil = none
+	allowedTypes     *allowedTypes       // per-client-group query type allowlists; nil = none
+	malformed        config.MalformedQueriesConfig
+	transferACL      *ClientACL          // secondaries allowed zone transfers and NOTIFY; nil = nobody
+	transferZones    map[string]struct{} // local zones served by AXFR, lowercase FQDN
+	staticAnswers    map[staticAnswerKey]staticAnswer
+	privateReverse   config.PrivateReverseConfig
+	blockedTTLs      map[string]time.Duration // per-blocklist cache TTL for blocked answers, keyed by source URL
+	blockCategories  map[string]string        // per-blocklist category (advertising, malware, ...), keyed by source URL
+	blockRedirects   map[string][]net.IP      // sink IPs per blocklist category (blocklist_redirects)
+	injectLatency    time.Duration            // server.debug.inject_latency; 0 = off
+	maxUDPSize       int                      // server.max_udp_size cap on UDP responses; 0 = client's size only
+	noCompress       bool                     // server.compress_responses: false; write names without compression pointers
+	overrideTTL      uint32                   // server.override_ttl in seconds for policy redirects; 0 = defaultOverrideTTL
+	logSampleRate    float64                  // database.sample_rate for non-blocked queries; 0 or 1 = log all
+	logPreserveCase  bool                     // database.preserve_domain_case; false lowercases logged domains
+	rebind           *rebindGuard             // nil = rebind protection disabled
+	healthName       *healthName              // server.health_name; nil = disabled
 	logger           *logging.Logger
 }
 
@@ -102,6 +184,8 @@ type Handler struct {
 	// (single-IP overrides) and LocalRecords (CNAME chains, TXT, MX, etc.).
 	Blocklist map[string]struct{}
 	lookupMu  sync.RWMutex
+
+	inflight atomic.Int64 // ServeDNS calls and cache refreshes in progress, for Drain
 }
 
 // NewHandler creates a new DNS handler
@@ -138,6 +222,7 @@ func (h *Handler) getUnboundBuffer() *unbound.ReplyBuffer  { return h.deps.Load(
 func (h *Handler) getMetrics() *telemetry.Metrics          { return h.deps.Load().metrics }
 func (h *Handler) GetMetrics() *telemetry.Metrics          { return h.deps.Load().metrics }
 func (h *Handler) GetCache() cache.Interface               { return h.deps.Load().cache }
+func (h *Handler) GetForwarder() *forwarder.Forwarder      { return h.deps.Load().fwd }
 func (h *Handler) getLogger() *logging.Logger              { return h.deps.Load().logger }
 
 // --- Setters: clone-and-swap (single writer assumed) ---
@@ -145,6 +230,21 @@ func (h *Handler) getLogger() *logging.Logger              { return h.deps.Load(
 func (h *Handler) SetForwarder(f *forwarder.Forwarder) {
 	d := h.clone()
 	d.fwd = f
+	if f != nil && d.upstreamsDown != nil {
+		f.SetOnAllUpstreamsDown(d.upstreamsDown)
+	}
+	h.deps.Store(&d)
+}
+
+// SetUpstreamsDownHook registers fn to be called when every upstream's
+// circuit breaker has opened. It is carried over to forwarders installed
+// later by SetForwarder (config reloads). fn must not block.
+func (h *Handler) SetUpstreamsDownHook(fn func(upstreams []string)) {
+	d := h.clone()
+	d.upstreamsDown = fn
+	if d.fwd != nil {
+		d.fwd.SetOnAllUpstreamsDown(fn)
+	}
 	h.deps.Store(&d)
 }
 
@@ -160,6 +260,14 @@ func (h *Handler) SetBlocklistManager(m *blocklist.Manager) {
 	h.deps.Store(&d)
 }
 
+// SetStartup configures startup.fail_closed: holding queries until the first
+// blocklist load instead of forwarding them unfiltered.
+func (h *Handler) SetStartup(cfg config.StartupConfig) {
+	d := h.clone()
+	d.startup = newStartupGate(cfg)
+	h.deps.Store(&d)
+}
+
 func (h *Handler) SetStorage(s storage.Storage) {
 	d := h.clone()
 	d.storage = s
@@ -178,6 +286,14 @@ func (h *Handler) SetLocalRecords(l *localrecords.Manager) {
 	h.deps.Store(&d)
 }
 
+// SetMaxCNAMEDepth sets how many CNAME hops A/AAAA lookups follow through
+// local records. 0 uses localrecords.DefaultMaxCNAMEDepth.
+func (h *Handler) SetMaxCNAMEDepth(depth int) {
+	d := h.clone()
+	d.maxCNAMEDepth = depth
+	h.deps.Store(&d)
+}
+
 func (h *Handler) SetPolicyEngine(e *policy.Engine) {
 	d := h.clone()
 	d.policyEngine = e
@@ -190,6 +306,295 @@ func (h *Handler) SetMetrics(m *telemetry.Metrics) {
 	h.deps.Store(&d)
 }
 
+// SetTracer enables OpenTelemetry spans for the resolution pipeline.
+func (h *Handler) SetTracer(t trace.Tracer) {
+	d := h.clone()
+	d.tracer = t
+	h.deps.Store(&d)
+}
+
+// SetSlowQueryThreshold sets the duration above which queries are logged as
+// slow. Zero disables the slow-query log.
+func (h *Handler) SetSlowQueryThreshold(threshold time.Duration) {
+	d := h.clone()
+	d.slowQuery = threshold
+	h.deps.Store(&d)
+}
+
+// SetQueryLogSampleRate logs only the given fraction of non-blocked queries.
+// Blocked queries are always logged. 0 or 1 logs every query.
+func (h *Handler) SetQueryLogSampleRate(rate float64) {
+	d := h.clone()
+	d.logSampleRate = rate
+	h.deps.Store(&d)
+}
+
+// SetQueryLogPreserveCase keeps the client's letter case in logged domains
+// instead of lowercasing them.
+func (h *Handler) SetQueryLogPreserveCase(preserve bool) {
+	d := h.clone()
+	d.logPreserveCase = preserve
+	h.deps.Store(&d)
+}
+
+// SetMaxUDPSize caps the size of UDP responses regardless of the buffer size
+// the client advertises. Zero applies only the client's limit.
+func (h *Handler) SetMaxUDPSize(size int) {
+	d := h.clone()
+	d.maxUDPSize = size
+	h.deps.Store(&d)
+}
+
+// SetCompressResponses controls DNS name compression in responses. On by
+// default; turning it off helps old embedded resolvers that mishandle
+// compression pointers, at the cost of larger responses.
+func (h *Handler) SetCompressResponses(enabled bool) {
+	d := h.clone()
+	d.noCompress = !enabled
+	h.deps.Store(&d)
+}
+
+// SetOverrideTTL sets the TTL of synthetic answers such as policy redirects.
+// Zero restores the default of five minutes.
+func (h *Handler) SetOverrideTTL(ttl time.Duration) {
+	d := h.clone()
+	d.overrideTTL = uint32(ttl / time.Second)
+	h.deps.Store(&d)
+}
+
+// SetWhitelistAlwaysWins controls precedence between domain-scoped ALLOW
+// rules and blocklist entries. When false, the most specific match wins.
+func (h *Handler) SetWhitelistAlwaysWins(enabled bool) {
+	d := h.clone()
+	d.allowAlwaysWins = enabled
+	h.deps.Store(&d)
+}
+
+// SetAnomalyDetection enables query anomaly detection with cfg, or disables it
+// when cfg.Enabled is false. Counts carry over when cfg is unchanged.
+func (h *Handler) SetAnomalyDetection(cfg config.AnomalyConfig) {
+	d := h.clone()
+	switch {
+	case !cfg.Enabled:
+		d.anomaly = nil
+	case d.anomaly != nil && d.anomaly.cfg == cfg:
+		return
+	default:
+		d.anomaly = newAnomalyDetector(cfg, h.reportAnomaly, h.recordAnomalyPeaks)
+	}
+	h.deps.Store(&d)
+}
+
+// SetQueryQuota enables the per-client daily query quota with cfg, or
+// disables it when cfg.Enabled is false. Today's counts survive a reload.
+func (h *Handler) SetQueryQuota(cfg config.QueryQuotaConfig) {
+	d := h.clone()
+	switch {
+	case !cfg.Enabled:
+		d.quota = nil
+	case d.quota != nil:
+		d.quota.setConfig(cfg)
+		return
+	default:
+		d.quota = newQueryQuota(cfg)
+	}
+	h.deps.Store(&d)
+}
+
+// SetAnomalyHook registers fn to be called for every detected anomaly, in
+// addition to the WARN log and dns.anomalies metric. fn runs on the query
+// path and must not block.
+func (h *Handler) SetAnomalyHook(fn func(Anomaly)) {
+	d := h.clone()
+	d.anomalyHook = fn
+	h.deps.Store(&d)
+}
+
+// SetRebindProtection enables or disables DNS rebinding protection for
+// forwarded answers.
+func (h *Handler) SetRebindProtection(cfg config.RebindProtectionConfig) {
+	d := h.clone()
+	d.rebind = nil
+	if cfg.Enabled {
+		d.rebind = newRebindGuard(cfg)
+	}
+	h.deps.Store(&d)
+}
+
+// SetAnyQueryMode sets how qtype ANY is answered: config.AnyQueryMinimal
+// (RFC 8482, the default), config.AnyQueryRefuse or config.AnyQueryForward.
+func (h *Handler) SetAnyQueryMode(mode string) {
+	d := h.clone()
+	d.anyQuery = mode
+	h.deps.Store(&d)
+}
+
+// SetStaticAnswers installs the static_answers entries: fixed responses for
+// specific name and type pairs, served right after local records.
+func (h *Handler) SetStaticAnswers(entries []config.StaticAnswerEntry) {
+	d := h.clone()
+	d.staticAnswers = buildStaticAnswers(entries)
+	h.deps.Store(&d)
+}
+
+// SetRefusedTypes sets the query types (by name, e.g. "HTTPS") that are
+// answered with NODATA instead of being resolved. Local records still apply.
+func (h *Handler) SetRefusedTypes(types []string) {
+	d := h.clone()
+	d.refusedTypes = parseRefusedTypes(types)
+	h.deps.Store(&d)
+}
+
+// SetAllowedTypes restricts members of the given client groups to the listed
+// query types (server.allowed_types); other types get NODATA.
+func (h *Handler) SetAllowedTypes(groups map[string][]string) {
+	d := h.clone()
+	d.allowedTypes = newAllowedTypes(groups)
+	h.deps.Store(&d)
+}
+
+// SetMalformedQueries sets how multi-question queries, opcodes other than
+// QUERY and overlong names are answered (server.malformed_queries).
+func (h *Handler) SetMalformedQueries(cfg config.MalformedQueriesConfig) {
+	d := h.clone()
+	d.malformed = cfg
+	h.deps.Store(&d)
+}
+
+// SetZoneTransfer sets which clients may request zone transfers and send
+// NOTIFY, and which local zones they can transfer. With no allowed clients
+// every transfer is refused.
+func (h *Handler) SetZoneTransfer(cfg config.ZoneTransferConfig) {
+	d := h.clone()
+	d.transferACL = nil
+	if len(cfg.AllowedClients) > 0 {
+		d.transferACL = NewClientACL(cfg.AllowedClients)
+	}
+	d.transferZones = make(map[string]struct{}, len(cfg.Zones))
+	for _, zone := range cfg.Zones {
+		d.transferZones[strings.ToLower(dns.Fqdn(strings.TrimSpace(zone)))] = struct{}{}
+	}
+	h.deps.Store(&d)
+}
+
+// SetPrivateReverse sets how PTR queries for private addresses are handled:
+// forwarded like any other query (default), answered NXDOMAIN locally, or
+// sent to dedicated internal upstreams.
+func (h *Handler) SetPrivateReverse(cfg config.PrivateReverseConfig) {
+	d := h.clone()
+	d.privateReverse = cfg
+	h.deps.Store(&d)
+}
+
+// SetHealthName sets the sentinel name answered with a fixed address before
+// any filtering, for DNS-level health checks (server.health_name).
+func (h *Handler) SetHealthName(cfg config.HealthNameConfig) {
+	d := h.clone()
+	d.healthName = newHealthName(cfg)
+	h.deps.Store(&d)
+}
+
+// SetCacheByClientGroup controls whether clients in a client group get cache
+// entries of their own (cache.per_client_group). Off in a bare handler.
+func (h *Handler) SetCacheByClientGroup(enabled bool) {
+	d := h.clone()
+	d.cacheByGroup = enabled
+	h.deps.Store(&d)
+}
+
+// SetShuffleAnswers controls whether multi-record A/AAAA answers from
+// upstream are shuffled. Off by default: upstream order is preserved.
+func (h *Handler) SetShuffleAnswers(enabled bool) {
+	d := h.clone()
+	d.shuffleAnswers = enabled
+	h.deps.Store(&d)
+}
+
+// SetForwardClientSubnet controls whether an EDNS Client Subnet option sent
+// by the client is passed upstream. Off by default: it is stripped so the
+// client's subnet doesn't leak to the upstream resolver.
+func (h *Handler) SetForwardClientSubnet(enabled bool) {
+	d := h.clone()
+	d.forwardECS = enabled
+	h.deps.Store(&d)
+}
+
+// SetFlattenCNAME controls whether forwarded A/AAAA answers that go through
+// a CNAME chain are flattened to address records under the queried name.
+func (h *Handler) SetFlattenCNAME(enabled bool) {
+	d := h.clone()
+	d.flattenCNAME = enabled
+	h.deps.Store(&d)
+}
+
+// SetBlockedTTLBySource sets per-blocklist cache TTLs for blocked answers,
+// keyed by blocklist URL. Sources not in the map use cache.blocked_ttl.
+func (h *Handler) SetBlockedTTLBySource(ttls map[string]time.Duration) {
+	d := h.clone()
+	d.blockedTTLs = nil
+	if len(ttls) > 0 {
+		d.blockedTTLs = make(map[string]time.Duration, len(ttls))
+		for source, ttl := range ttls {
+			d.blockedTTLs[source] = ttl
+		}
+	}
+	h.deps.Store(&d)
+}
+
+// SetBlocklistCategories sets the category (advertising, malware, ...) of each
+// blocklist, keyed by blocklist URL. The category of a matching list is
+// recorded in the decision trace and named in block explanations.
+func (h *Handler) SetBlocklistCategories(categories map[string]string) {
+	d := h.clone()
+	d.blockCategories = nil
+	if len(categories) > 0 {
+		d.blockCategories = make(map[string]string, len(categories))
+		for source, category := range categories {
+			d.blockCategories[source] = strings.TrimSpace(category)
+		}
+	}
+	h.deps.Store(&d)
+}
+
+// SetBlocklistRedirects sets the sink IPs for blocklist categories whose
+// matches are answered with a local sink instead of being blocked, keyed by
+// category. Invalid IPs are skipped; config validation rejects them.
+func (h *Handler) SetBlocklistRedirects(redirects map[string][]string) {
+	d := h.clone()
+	d.blockRedirects = nil
+	if len(redirects) > 0 {
+		d.blockRedirects = make(map[string][]net.IP, len(redirects))
+		for category, ips := range redirects {
+			category = strings.TrimSpace(category)
+			for _, s := range ips {
+				if ip := net.ParseIP(s); ip != nil {
+					d.blockRedirects[category] = append(d.blockRedirects[category], ip)
+				}
+			}
+		}
+	}
+	h.deps.Store(&d)
+}
+
+// SetDebug applies server.debug options. Config validation only admits them
+// when the process runs with --allow-debug.
+func (h *Handler) SetDebug(cfg config.DebugConfig) {
+	d := h.clone()
+	d.injectLatency = cfg.InjectLatency
+	h.deps.Store(&d)
+}
+
+// SetSpecialUseNames enables or disables local answers for special-use names
+// such as .local.
+func (h *Handler) SetSpecialUseNames(cfg config.SpecialUseNamesConfig) {
+	d := h.clone()
+	d.specialUse = nil
+	if cfg.Enabled {
+		d.specialUse = newSpecialUseGuard(cfg)
+	}
+	h.deps.Store(&d)
+}
+
 func (h *Handler) SetLogger(l *logging.Logger) {
 	d := h.clone()
 	d.logger = l
@@ -208,6 +613,26 @@ func (h *Handler) SetDecisionTrace(enabled bool) {
 	h.deps.Store(&d)
 }
 
+// SetBlockExplainTXT controls whether blocked responses carry a TXT record in
+// the additional section explaining the block. The list or rule responsible is
+// named only while decision tracing is on.
+func (h *Handler) SetBlockExplainTXT(enabled bool) {
+	d := h.clone()
+	d.explainBlocks = enabled
+	h.deps.Store(&d)
+}
+
+// SetExtendedDNSErrors controls RFC 8914 Extended DNS Errors. With emit on,
+// blocked responses and SERVFAILs generated here carry an EDE option; with
+// stripUpstream on, EDE options in upstream responses are removed rather than
+// passed through to clients. Either only affects clients that sent EDNS0.
+func (h *Handler) SetExtendedDNSErrors(emit, stripUpstream bool) {
+	d := h.clone()
+	d.extendedErrors = emit
+	d.stripUpstreamEDE = stripUpstream
+	h.deps.Store(&d)
+}
+
 func (h *Handler) SetConfigWatcher(cw *config.Watcher) {
 	d := h.clone()
 	d.configWatcher = cw
@@ -242,27 +667,86 @@ func (h *Handler) enrichFromUnbound(r *dns.Msg, outcome *serveDNSOutcome) {
 	}
 }
 
-// writeMsg writes a DNS message to the response writer with error handling.
-// For UDP, if the serialized response exceeds the client's buffer size, the TC
-// (truncated) bit is set and the answer section is stripped to force TCP retry.
-// This prevents DNS amplification via oversized UDP responses.
-func (h *Handler) writeMsg(w dns.ResponseWriter, msg *dns.Msg) {
-	// Only enforce size limits on UDP (TCP has no practical size limit)
+// writeMsg writes the response msg to request r with error handling.
+// For UDP, a response larger than the client's buffer size (capped at
+// server.max_udp_size) is truncated with the TC bit set to force a TCP retry.
+// This also limits DNS amplification via oversized UDP responses.
+func (h *Handler) writeMsg(w dns.ResponseWriter, r, msg *dns.Msg) {
+	// Client likely disconnected - nothing we can do
+	_ = h.sendMsg(w, r, msg)
+}
+
+// sendMsg is writeMsg returning the write error, for callers such as zone
+// transfers that send several messages and stop on the first failure.
+func (h *Handler) sendMsg(w dns.ResponseWriter, r, msg *dns.Msg) error {
+	d := h.deps.Load()
+	if delay := d.injectLatency; delay > 0 {
+		time.Sleep(delay)
+	}
+
+	// Trim records that don't fit and set TC so the client retries over TCP,
+	// rather than sending a datagram that gets fragmented or dropped. TCP
+	// carries up to the 64KB message limit.
+	msg.Compress = !d.noCompress
+	limit := dns.MaxMsgSize
 	if isUDP(w) {
-		maxSize := 512 // Default without EDNS0
-		if opt := msg.IsEdns0(); opt != nil {
-			maxSize = int(opt.UDPSize())
+		limit = udpResponseLimit(r, d.maxUDPSize)
+	}
+	if msg.Len() > limit {
+		truncateMsg(msg, limit, !d.noCompress)
+	}
+
+	return w.WriteMsg(msg)
+}
+
+// truncateMsg trims msg to size bytes with TC set. Truncate may turn on
+// compression to fit more records; without compression, records are dropped
+// from the end (additional, then authority, then answer) until the
+// uncompressed message fits.
+func truncateMsg(msg *dns.Msg, size int, compress bool) {
+	msg.Truncate(size)
+	if compress {
+		return
+	}
+	msg.Compress = false
+	for msg.Len() > size {
+		switch {
+		case dropLastRR(&msg.Extra):
+		case len(msg.Ns) > 0:
+			msg.Ns = msg.Ns[:len(msg.Ns)-1]
+		case len(msg.Answer) > 0:
+			msg.Answer = msg.Answer[:len(msg.Answer)-1]
+		default:
+			return
 		}
-		if msg.Len() > maxSize {
-			msg.Truncated = true
-			msg.Answer = nil // Strip answers to fit in buffer
+	}
+}
+
+// dropLastRR removes the last record other than the OPT pseudo-record from
+// rrs, reporting whether one was removed.
+func dropLastRR(rrs *[]dns.RR) bool {
+	for i := len(*rrs) - 1; i >= 0; i-- {
+		if _, ok := (*rrs)[i].(*dns.OPT); ok {
+			continue
 		}
+		*rrs = append((*rrs)[:i], (*rrs)[i+1:]...)
+		return true
 	}
+	return false
+}
 
-	if err := w.WriteMsg(msg); err != nil {
-		// Client likely disconnected - nothing we can do
-		_ = err
+// udpResponseLimit returns the largest UDP response r's client accepts: its
+// EDNS0 buffer size, or 512 bytes without EDNS0 (RFC 1035), further capped at
+// maxSize when set. The result is never below 512.
+func udpResponseLimit(r *dns.Msg, maxSize int) int {
+	limit := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		limit = max(int(opt.UDPSize()), dns.MinMsgSize)
 	}
+	if maxSize > 0 && limit > maxSize {
+		limit = max(maxSize, dns.MinMsgSize)
+	}
+	return limit
 }
 
 // isUDP returns true if the response writer is for a UDP connection.
@@ -273,6 +757,14 @@ func isUDP(w dns.ResponseWriter) bool {
 	return false
 }
 
+// isTCP reports whether the query arrived over a TCP or DoT connection.
+func isTCP(w dns.ResponseWriter) bool {
+	if addr := w.LocalAddr(); addr != nil {
+		return addr.Network() == "tcp"
+	}
+	return false
+}
+
 // serveFromCache attempts to serve a cached DNS response.
 // With policy-first evaluation, cache only contains upstream responses.
 // Policy and blocklist decisions are NOT cached - they are evaluated fresh every time.
@@ -286,9 +778,17 @@ func (h *Handler) serveFromCache(ctx context.Context, w dns.ResponseWriter, r, m
 	if cachedResp == nil {
 		return false
 	}
+	if c.ClaimRefresh(ctx, r) {
+		h.refreshCached(cache.ScopeFrom(ctx), r.Copy(), getClientIP(w))
+	}
 
 	cachedResp.Id = r.Id
+	// Entries are keyed case-insensitively; echo the client's own spelling.
+	cachedResp.Question = append(cachedResp.Question[:0], r.Question...)
 	HandleEDNS0(r, cachedResp)
+	if h.deps.Load().shuffleAnswers {
+		shuffleAddresses(cachedResp) // cachedResp is a copy
+	}
 
 	outcome.cached = true
 	outcome.responseCode = cachedResp.Rcode
@@ -303,39 +803,75 @@ func (h *Handler) serveFromCache(ctx context.Context, w dns.ResponseWriter, r, m
 		entry.Detail = "cached upstream response"
 	})
 
-	h.writeMsg(w, cachedResp)
+	h.writeMsg(w, r, cachedResp)
 	return true
 }
 
 // ServeDNS implements the dns.Handler interface
 func (h *Handler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) {
+	h.inflight.Add(1)
+	defer h.inflight.Add(-1)
+
 	startTime := time.Now()
 	// Single atomic load — all sub-methods use this snapshot for consistency
 	// and to avoid 16+ redundant atomic pointer loads per query.
 	d := h.deps.Load()
 	outcome := getOutcome()
-	trace := newBlockTraceRecorder(d.decisionTrace)
+	blockTrace := newBlockTraceRecorder(d.decisionTrace)
 	clientIP := getClientIP(w)
+	ctx, span := startSpan(ctx, d.tracer, spanQuery)
 
 	defer func() {
-		h.asyncLogQuery(startTime, r, clientIP, trace, outcome)
+		paused := loggingPaused(d)
+		if d.slowQuery > 0 {
+			if elapsed := time.Since(startTime); elapsed > d.slowQuery {
+				h.logSlowQuery(ctx, r, clientIP, outcome, elapsed, paused)
+			}
+		}
+		endQuerySpan(span, r, clientIP, outcome, paused)
+		h.asyncLogQuery(startTime, r, clientIP, blockTrace, outcome)
+		if res := queryResultFrom(ctx); res != nil {
+			res.Outcome, res.Upstream, res.Rcode = outcomeDecision(outcome), outcome.upstream, outcome.responseCode
+		}
 		releaseOutcome(outcome)
-		trace.Release()
+		blockTrace.Release()
 	}()
 
-	msg := msgPool.Get().(*dns.Msg)
+	if group := clientGroupFrom(ctx); group != "" {
+		blockTrace.Record(traceStageClientGroup, "assign", func(entry *storage.BlockTraceEntry) {
+			entry.Rule = group
+			entry.Detail = "client group assigned on arrival (DoH token)"
+		})
+	}
+	if d.cacheByGroup {
+		ctx = cache.WithScope(ctx, cacheScope(clientIP, clientGroupFrom(ctx)))
+	}
+
+	msg := getMsg()
 	defer msgPool.Put(msg)
 
-	*msg = dns.Msg{}
 	msg.SetReply(r)
 	msg.Authoritative = true
 	msg.RecursionAvailable = true
+	if !d.forwardECS {
+		StripClientSubnet(r)
+	}
 	HandleEDNS0(r, msg)
 
+	// AXFR/IXFR and NOTIFY are never forwarded (server.zone_transfer)
+	if h.serveZoneTransfer(w, r, msg, clientIP, d, blockTrace, outcome) {
+		return
+	}
+
+	// Multi-question queries, other opcodes and overlong names (server.malformed_queries)
+	if h.serveMalformed(w, r, msg, &d.malformed, blockTrace, outcome) {
+		return
+	}
+
 	if len(r.Question) == 0 {
 		msg.SetRcode(r, dns.RcodeFormatError)
 		outcome.responseCode = dns.RcodeFormatError
-		h.writeMsg(w, msg)
+		h.writeMsg(w, r, msg)
 		return
 	}
 
@@ -344,30 +880,74 @@ func (h *Handler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	qtype := question.Qtype
 	qtypeLabel := dnsTypeLabel(qtype)
 
+	// The health check name bypasses quotas and filtering (server.health_name)
+	if h.serveHealthName(w, r, msg, d.healthName, domain, qtype, blockTrace, outcome) {
+		return
+	}
+
+	if ad := d.anomaly; ad != nil {
+		ad.observe(startTime, clientIP, domain)
+	}
+
+	// Clients over their daily quota (server.query_quota) are refused outright
+	if q := d.quota; q != nil {
+		if count, limit, exceeded, first := q.observe(startTime, clientIP, clientGroupFrom(ctx)); exceeded {
+			h.serveQuotaExceeded(ctx, w, r, msg, clientIP, count, limit, first, blockTrace, outcome)
+			return
+		}
+	}
+
+	if qtype == dns.TypeANY && h.serveAnyQuery(w, r, msg, domain, blockTrace, outcome) {
+		return
+	}
+
 	// Local records always take precedence
 	if lr := d.localRecords; lr != nil {
-		if h.serveFromLocalRecords(w, msg, domain, qtype, outcome) {
+		if h.serveFromLocalRecords(w, r, msg, domain, qtype, outcome) {
 			return
 		}
 	}
 
-	// Resolve feature toggles (permanent config + temporary kill-switches)
-	enablePolicies, enableBlocklist := h.resolveFeatureToggles()
-	if ks := d.killSwitch; ks != nil {
-		if disabled, _ := ks.IsBlocklistDisabled(); disabled {
-			enableBlocklist = false
-		}
-		if disabled, _ := ks.IsPoliciesDisabled(); disabled {
-			enablePolicies = false
+	// Pinned responses for specific name+type pairs (static_answers)
+	if answer, ok := lookupStaticAnswer(d.staticAnswers, domain, qtype); ok {
+		h.serveStaticAnswer(w, r, msg, domain, answer, blockTrace, outcome)
+		return
+	}
+
+	// Disabled record types (server.refused_types) get NODATA
+	if _, refused := d.refusedTypes[qtype]; refused && h.serveRefusedType(w, r, msg, qtypeLabel, blockTrace, outcome) {
+		return
+	}
+
+	// Client groups limited to some query types (server.allowed_types)
+	if at := d.allowedTypes; at != nil {
+		if group, denied := at.denies(clientIP, clientGroupFrom(ctx), qtype); denied && h.serveDisallowedType(w, r, msg, group, qtypeLabel, blockTrace, outcome) {
+			return
 		}
 	}
 
+	// Special-use names (.local, .test, ...) never leave the network
+	if d.specialUse != nil && h.serveSpecialUse(w, r, msg, domain, blockTrace, outcome) {
+		return
+	}
+
+	// Reverse lookups for private ranges stay internal (server.private_reverse)
+	if qtype == dns.TypePTR && h.servePrivateReverse(ctx, w, r, msg, domain, clientIP, qtypeLabel, blockTrace, outcome) {
+		return
+	}
+
+	// Resolve feature toggles (permanent config + temporary kill-switches)
+	enablePolicies, enableBlocklist := h.resolveFeatureToggles(d)
+
 	// POLICY-FIRST: Policies are always evaluated fresh (decisions NOT cached).
 	// This ensures correct behavior with policy ordering, multiple matches, and toggles.
 	// ALLOW/FORWARD actions forward to upstream and cache the upstream response.
 	// BLOCK/REDIRECT return immediately without caching.
 	if pe := d.policyEngine; enablePolicies && pe != nil && pe.Count() > 0 {
-		if h.handlePolicies(ctx, w, r, msg, domain, clientIP, qtype, qtypeLabel, trace, outcome) {
+		spanCtx, stage := startSpan(ctx, d.tracer, spanPolicy)
+		handled := h.handlePolicies(spanCtx, w, r, msg, domain, clientIP, qtype, qtypeLabel, enableBlocklist, d, blockTrace, outcome)
+		stage.End()
+		if handled {
 			return
 		}
 	}
@@ -375,24 +955,48 @@ func (h *Handler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	// BLOCKLIST-FIRST: Blocklist is always evaluated fresh (blocked NOT cached).
 	// This ensures blocklist changes take immediate effect.
 	if enableBlocklist {
-		if h.handleBlocklistAndOverrides(ctx, w, r, msg, domain, qtype, qtypeLabel, trace, outcome) {
+		// Until the first load, fail closed rather than forward unfiltered (startup)
+		if h.serveBlocklistNotReady(ctx, w, r, msg, d.startup, d.blocklistManager, blockTrace, outcome) {
+			return
+		}
+		spanCtx, stage := startSpan(ctx, d.tracer, spanBlocklist)
+		handled := h.handleBlocklistAndOverrides(spanCtx, w, r, msg, domain, qtype, qtypeLabel, blockTrace, outcome)
+		stage.End()
+		if handled {
 			return
 		}
 	}
 
 	// Cache check - contains upstream responses and blocklist decisions (with traces).
 	// Policy BLOCK/REDIRECT decisions are NOT cached.
-	if h.serveFromCache(ctx, w, r, msg, trace, outcome) {
+	spanCtx, stage := startSpan(ctx, d.tracer, spanCache)
+	handled := h.serveFromCache(spanCtx, w, r, msg, blockTrace, outcome)
+	stage.End()
+	if handled {
 		return
 	}
 
-	if h.forwardToUpstream(ctx, w, r, msg, qtypeLabel, outcome) {
+	spanCtx, stage = startSpan(ctx, d.tracer, spanForward)
+	handled = h.forwardToUpstream(spanCtx, w, r, msg, clientIP, qtypeLabel, blockTrace, outcome)
+	stage.End()
+	if handled {
 		return
 	}
 
 	outcome.responseCode = dns.RcodeNameError
 	msg.SetRcode(r, dns.RcodeNameError)
-	h.writeMsg(w, msg)
+	h.writeMsg(w, r, msg)
+}
+
+// loggingPaused reports whether the kill-switch has paused query logging.
+// While it is, nothing that names the domain or client leaves the handler:
+// no query log entry, slow-query line or span attribute.
+func loggingPaused(d *handlerDeps) bool {
+	if ks := d.killSwitch; ks != nil {
+		paused, _ := ks.IsLoggingPaused()
+		return paused
+	}
+	return false
 }
 
 func (h *Handler) asyncLogQuery(startTime time.Time, r *dns.Msg, clientIP string, trace *blockTraceRecorder, outcome *serveDNSOutcome) {
@@ -405,11 +1009,24 @@ func (h *Handler) asyncLogQuery(startTime time.Time, r *dns.Msg, clientIP string
 	if ql == nil && st == nil {
 		return
 	}
+	if outcome.skipLog {
+		return
+	}
+	d := h.deps.Load()
+	if loggingPaused(d) {
+		return
+	}
+	if !outcome.blocked && !sampleQueryLog(d.logSampleRate) {
+		return
+	}
 
 	domain := ""
 	queryType := ""
 	if len(r.Question) > 0 {
 		domain = strings.TrimSuffix(r.Question[0].Name, ".")
+		if !d.logPreserveCase {
+			domain = strings.ToLower(domain)
+		}
 		queryType = dnsTypeLabel(r.Question[0].Qtype)
 	}
 
@@ -427,6 +1044,8 @@ func (h *Handler) asyncLogQuery(startTime time.Time, r *dns.Msg, clientIP string
 		Upstream:          outcome.upstream,
 		UpstreamError:     outcome.upstreamError,
 		BlockTrace:        trace.Entries(),
+		MatchedRule:       outcome.matchedRule,
+		MatchedSource:     outcome.matchedSource,
 		UnboundCached:     outcome.unboundCached,
 		UnboundDurationMs: outcome.unboundDuration,
 		UnboundRespSize:   outcome.unboundRespSize,
@@ -444,27 +1063,45 @@ func (h *Handler) asyncLogQuery(startTime time.Time, r *dns.Msg, clientIP string
 	// Legacy path: use select with buffered channel to avoid blocking.
 	// Lazy-initialize on first use to avoid waste when QueryLogger is active.
 	initLegacyLog()
+	legacyLogPending.Add(1)
 	select {
 	case legacyLogCh <- legacyLogRequest{storage: st, log: queryLog, logger: lg}:
 		// Sent to worker
 	default:
-		// Buffer full, log warning (rare under normal load)
-		if lg != nil {
+		legacyLogPending.Add(-1)
+		// Buffer full (rare under normal load); warn once per interval
+		if n := legacyLogDrops.Drop(time.Now()); n > 0 && lg != nil {
 			lg.Warn("Legacy log buffer full, query log dropped",
-				"domain", domain)
+				"dropped", n,
+				"last_domain", domain)
 		}
 	}
 }
 
-func (h *Handler) resolveFeatureToggles() (enablePolicies, enableBlocklist bool) {
+// sampleQueryLog reports whether a non-blocked query is kept in the query log
+// at the given sample rate.
+func sampleQueryLog(rate float64) bool {
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// resolveFeatureToggles combines the permanent config toggles with any
+// temporary kill-switch.
+func (h *Handler) resolveFeatureToggles(d *handlerDeps) (enablePolicies, enableBlocklist bool) {
 	enablePolicies = true
 	enableBlocklist = true
-	cw := h.getConfigWatcher()
-	if cw == nil {
-		return
+	if cw := d.configWatcher; cw != nil {
+		cfg := cw.Config()
+		enablePolicies, enableBlocklist = cfg.Server.EnablePolicies, cfg.Server.EnableBlocklist
+	}
+	if ks := d.killSwitch; ks != nil {
+		if disabled, _ := ks.IsBlocklistDisabled(); disabled {
+			enableBlocklist = false
+		}
+		if disabled, _ := ks.IsPoliciesDisabled(); disabled {
+			enablePolicies = false
+		}
 	}
-	cfg := cw.Config()
-	return cfg.Server.EnablePolicies, cfg.Server.EnableBlocklist
+	return enablePolicies, enableBlocklist
 }
 
 // dnsTypeLabel returns a human-readable string for the query type, falling back to TYPE#### per RFC 3597 when unknown.
@@ -3,6 +3,9 @@ package dns
 import (
 	"context"
 	"net"
+	"slices"
+	"strings"
+	"time"
 
 	"glory-hole/pkg/blocklist"
 	"glory-hole/pkg/storage"
@@ -20,6 +23,10 @@ func (h *Handler) handleBlocklistAndOverrides(ctx context.Context, w dns.Respons
 func (h *Handler) handleFastBlocklistPath(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, domain string, qtype uint16, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	blockMatch := h.getBlocklistManager().Match(domain)
 	if blockMatch.Blocked {
+		d := h.deps.Load()
+		if category, sink := blockRedirectForSources(d.blockCategories, d.blockRedirects, blockMatch.Sources); sink != nil {
+			return h.handleRedirectedDomain(w, r, msg, qtypeLabel, trace, outcome, blockMatch, category, sink)
+		}
 		return h.handleBlockedDomain(ctx, w, r, msg, qtypeLabel, trace, outcome, blockMatch)
 	}
 	return false
@@ -49,6 +56,7 @@ func (h *Handler) handleLegacyBlocklistPath(ctx context.Context, w dns.ResponseW
 		})
 
 		outcome.blocked = true
+		outcome.matchedSource, outcome.matchedRule = matchedSourceLegacy, strings.TrimSuffix(domain, ".")
 		// If block page is configured, return the block page IP instead of NXDOMAIN
 		bpIP := h.getBlockPageIP()
 		if bpIP != "" {
@@ -68,6 +76,7 @@ func (h *Handler) handleLegacyBlocklistPath(ctx context.Context, w dns.ResponseW
 			outcome.responseCode = dns.RcodeNameError
 			msg.SetRcode(r, dns.RcodeNameError)
 		}
+		h.explainBlock(msg, "list", "", "legacy")
 
 		// Cache blocked response WITH trace so subsequent cache hits show WHY it was blocked.
 		// Cached decisions are cleared when blocklist is toggled ON to prevent stale decisions.
@@ -75,7 +84,7 @@ func (h *Handler) handleLegacyBlocklistPath(ctx context.Context, w dns.ResponseW
 			c.SetBlocked(ctx, r, msg, trace.Entries())
 		}
 
-		h.writeMsg(w, msg)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
@@ -112,10 +121,13 @@ func (h *Handler) handleBlockedDomain(ctx context.Context, w dns.ResponseWriter,
 	if sourceLabel == "" {
 		sourceLabel = "blocklist"
 	}
+	category := blockCategoryForSources(h.deps.Load().blockCategories, match.Sources)
+	outcome.setBlocklistMatch(match)
 
 	// Record trace BEFORE response - this appears in query logs
 	trace.Record(traceStageBlocklist, "block", func(entry *storage.BlockTraceEntry) {
 		entry.Source = sourceLabel
+		entry.Category = category
 		if detail := describeBlockMatch(match); detail != "" {
 			entry.Detail = detail
 		}
@@ -128,13 +140,182 @@ func (h *Handler) handleBlockedDomain(ctx context.Context, w dns.ResponseWriter,
 		stage:      traceStageBlocklist,
 		source:     sourceLabel,
 	})
+	if len(match.Sources) > 0 {
+		h.explainBlock(msg, "list", category, matchSourceNames(match)...)
+	} else {
+		h.explainBlock(msg, "pattern", category, match.Pattern)
+	}
 
 	// Cache blocked response WITH trace so subsequent cache hits show WHY it was blocked.
 	// Cached decisions are cleared when blocklist is toggled ON to prevent stale decisions.
 	if c := h.getCache(); c != nil {
-		c.SetBlocked(ctx, r, msg, trace.Entries())
+		if ttl, ok := blockedTTLForSources(h.deps.Load().blockedTTLs, match.Sources); ok {
+			c.SetBlockedWithTTL(ctx, r, msg, trace.Entries(), ttl)
+		} else {
+			c.SetBlocked(ctx, r, msg, trace.Entries())
+		}
+	}
+
+	h.writeMsg(w, r, msg)
+	return true
+}
+
+// handleRedirectedDomain answers a blocklist match in a redirect category
+// (blocklist_redirects) with the category's sink IPs instead of blocking it,
+// so pages that hard-depend on a tracker resolving keep working. Query types
+// without a sink address of their family get NODATA. Like policy redirects,
+// the answer is not cached and the query does not count as blocked.
+func (h *Handler) handleRedirectedDomain(w dns.ResponseWriter, r, msg *dns.Msg, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome, match blocklist.MatchResult, category string, sink []net.IP) bool {
+	domain := r.Question[0].Name
+	qtype := r.Question[0].Qtype
+
+	ttl := h.deps.Load().overrideTTL
+	if ttl == 0 {
+		ttl = defaultOverrideTTL
+	}
+	targets := make([]string, 0, len(sink))
+	for _, ip := range sink {
+		targets = append(targets, ip.String())
+		switch {
+		case qtype == dns.TypeA && ip.To4() != nil:
+			addARecord(msg, domain, ip, ttl)
+		case qtype == dns.TypeAAAA && ip.To4() == nil:
+			addAAAARecord(msg, domain, ip, ttl)
+		}
+	}
+	outcome.responseCode = dns.RcodeSuccess
+
+	sourceLabel := blocklistTraceSource(match)
+	if sourceLabel == "" {
+		sourceLabel = "blocklist"
+	}
+	outcome.setBlocklistMatch(match)
+	trace.Record(traceStageBlocklist, "redirect", func(entry *storage.BlockTraceEntry) {
+		entry.Source = sourceLabel
+		entry.Category = category
+		if detail := describeBlockMatch(match); detail != "" {
+			entry.Detail = detail
+		}
+		applyBlockMatchMetadata(entry, match)
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]string)
+		}
+		entry.Metadata["target"] = strings.Join(targets, ", ")
+		entry.Metadata["query_type"] = qtypeLabel
+	})
+
+	if lg := h.getLogger(); lg != nil {
+		lg.Debug("Blocklist redirecting query to sink",
+			"domain", domain,
+			"category", category,
+			"sink", strings.Join(targets, ", "),
+			"query_type", qtypeLabel)
 	}
 
-	h.writeMsg(w, msg)
+	h.writeMsg(w, r, msg)
 	return true
 }
+
+// blockRedirectForSources returns the category and sink IPs to answer a
+// blocklist match with. Every matching list must be in a redirect category,
+// so a domain that is also on, say, a malware list stays blocked; the first
+// list's category picks the sink. sink is nil when the match should block.
+func blockRedirectForSources(categories map[string]string, redirects map[string][]net.IP, sources []string) (category string, sink []net.IP) {
+	if len(redirects) == 0 || len(sources) == 0 {
+		return "", nil
+	}
+	for _, source := range sources {
+		c := categories[source]
+		ips, ok := redirects[c]
+		if !ok || len(ips) == 0 {
+			return "", nil
+		}
+		if sink == nil {
+			category, sink = c, ips
+		}
+	}
+	return category, sink
+}
+
+// blockExplainTTL is the TTL of the explanation TXT record, matching the
+// block page answers.
+const blockExplainTTL = 60
+
+// explainBlock describes a blocked response to the client. With
+// server.block_explain_txt on it appends a TXT record to the additional
+// section whose first string always reads "blocked by glory-hole"; with
+// server.extended_dns_errors on it attaches an EDE option (Blocked for lists,
+// Filtered for policy rules) with the same text. A "category: name" string
+// follows when the list or rule has a category, and with decision tracing
+// enabled one "kind: name" string for each list or rule responsible.
+func (h *Handler) explainBlock(msg *dns.Msg, kind, category string, names ...string) {
+	d := h.deps.Load()
+	if (!d.explainBlocks && !d.extendedErrors) || len(msg.Question) == 0 {
+		return
+	}
+	txt := []string{"blocked by glory-hole"}
+	if category != "" {
+		txt = append(txt, "category: "+category)
+	}
+	if d.decisionTrace {
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			reason := kind + ": " + name
+			// A TXT character-string holds at most 255 bytes.
+			if len(reason) > 255 {
+				reason = reason[:255]
+			}
+			txt = append(txt, reason)
+		}
+	}
+	if d.extendedErrors {
+		code := dns.ExtendedErrorCodeBlocked
+		if kind == "rule" {
+			code = dns.ExtendedErrorCodeFiltered
+		}
+		SetEDE(msg, code, strings.Join(txt, "; "))
+	}
+	if !d.explainBlocks {
+		return
+	}
+	msg.Extra = append(msg.Extra, &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   msg.Question[0].Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    blockExplainTTL,
+		},
+		Txt: txt,
+	})
+}
+
+// blockCategoryForSources returns the distinct categories configured for the
+// matching blocklists, in source order and comma-separated, so a domain on
+// both an ad list and a malware list reads "advertising, malware".
+func blockCategoryForSources(categories map[string]string, sources []string) string {
+	if len(categories) == 0 {
+		return ""
+	}
+	var found []string
+	for _, source := range sources {
+		if c := categories[source]; c != "" && !slices.Contains(found, c) {
+			found = append(found, c)
+		}
+	}
+	return strings.Join(found, ", ")
+}
+
+// blockedTTLForSources returns the longest per-source TTL configured for any
+// of the matching blocklists, so a domain on both an ad list and a malware
+// list is cached as long as the malware list asks. ok is false when none of
+// the sources has an override.
+func blockedTTLForSources(ttls map[string]time.Duration, sources []string) (ttl time.Duration, ok bool) {
+	for _, source := range sources {
+		if v, found := ttls[source]; found && (!ok || v > ttl) {
+			ttl, ok = v, true
+		}
+	}
+	return ttl, ok
+}
@@ -0,0 +1,358 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/cache"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+// ttlRecordingCache records the TTL each blocked answer was stored with.
+type ttlRecordingCache struct {
+	cache.Interface
+	blocked map[string]time.Duration
+}
+
+func (c *ttlRecordingCache) SetBlocked(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry) {
+	c.blocked[r.Question[0].Name] = -1 // global cache.blocked_ttl
+}
+
+func (c *ttlRecordingCache) SetBlockedWithTTL(ctx context.Context, r *dns.Msg, resp *dns.Msg, trace []storage.BlockTraceEntry, ttl time.Duration) {
+	c.blocked[r.Question[0].Name] = ttl
+}
+
+func serveList(t *testing.T, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestHandleBlockedDomain_PerSourceTTL(t *testing.T) {
+	ads := serveList(t, "0.0.0.0 ads.example.com\n0.0.0.0 both.example.com\n")
+	malware := serveList(t, "0.0.0.0 malware.example.com\n0.0.0.0 both.example.com\n")
+	plain := serveList(t, "0.0.0.0 plain.example.com\n")
+
+	cfg := &config.Config{Blocklists: []string{ads, malware, plain}}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	rec := &ttlRecordingCache{blocked: make(map[string]time.Duration)}
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetCache(rec)
+	h.SetBlockedTTLBySource(map[string]time.Duration{
+		ads:     time.Minute,
+		malware: time.Hour,
+	})
+
+	tests := map[string]time.Duration{
+		"ads.example.com.":     time.Minute,
+		"malware.example.com.": time.Hour,
+		"both.example.com.":    time.Hour, // longest TTL of the matching sources
+		"plain.example.com.":   -1,        // no override: global blocked_ttl
+	}
+	for domain, want := range tests {
+		if rcode, _ := queryRcode(t, h, domain); rcode != dns.RcodeNameError {
+			t.Fatalf("%s: expected NXDOMAIN, got %s", domain, dns.RcodeToString[rcode])
+		}
+		if got := rec.blocked[domain]; got != want {
+			t.Errorf("%s: cached with TTL %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func TestBlockedTTLForSources(t *testing.T) {
+	ttls := map[string]time.Duration{"a": time.Minute, "b": 0}
+
+	if _, ok := blockedTTLForSources(ttls, []string{"c"}); ok {
+		t.Error("expected no override for an unlisted source")
+	}
+	if _, ok := blockedTTLForSources(nil, []string{"a"}); ok {
+		t.Error("expected no override with an empty map")
+	}
+	// An explicit 0 disables caching for that source but loses to a longer TTL.
+	if ttl, ok := blockedTTLForSources(ttls, []string{"b"}); !ok || ttl != 0 {
+		t.Errorf("got %v/%v, want 0/true", ttl, ok)
+	}
+	if ttl, _ := blockedTTLForSources(ttls, []string{"b", "a"}); ttl != time.Minute {
+		t.Errorf("got %v, want %v", ttl, time.Minute)
+	}
+}
+
+// explainTXT returns the strings of the explanation TXT record in the
+// additional section of the response to domain, or nil if there is none.
+func explainTXT(t *testing.T, h *Handler, domain string) []string {
+	t.Helper()
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+	r := new(dns.Msg)
+	r.SetQuestion(domain, dns.TypeA)
+	h.ServeDNS(context.Background(), w, r)
+	if w.msg == nil {
+		t.Fatalf("no response for %s", domain)
+	}
+	for _, rr := range w.msg.Extra {
+		if txt, ok := rr.(*dns.TXT); ok {
+			return txt.Txt
+		}
+	}
+	return nil
+}
+
+func TestBlockExplainTXT(t *testing.T) {
+	ads := serveList(t, "0.0.0.0 ads.example.com\n")
+	cfg := &config.Config{Blocklists: []string{ads}}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:    "no-social",
+		Logic:   `Domain == "social.example.com"`,
+		Action:  policy.ActionBlock,
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetPolicyEngine(engine)
+
+	if txt := explainTXT(t, h, "ads.example.com."); txt != nil {
+		t.Fatalf("explanation is off by default, got %q", txt)
+	}
+
+	h.SetBlockExplainTXT(true)
+	want := []string{"blocked by glory-hole"}
+	if txt := explainTXT(t, h, "ads.example.com."); !slices.Equal(txt, want) {
+		t.Errorf("without decision trace: got %q, want %q", txt, want)
+	}
+
+	h.SetDecisionTrace(true)
+	want = []string{"blocked by glory-hole", "list: " + ads}
+	if txt := explainTXT(t, h, "ads.example.com."); !slices.Equal(txt, want) {
+		t.Errorf("blocklist block: got %q, want %q", txt, want)
+	}
+	want = []string{"blocked by glory-hole", "rule: no-social"}
+	if txt := explainTXT(t, h, "social.example.com."); !slices.Equal(txt, want) {
+		t.Errorf("policy block: got %q, want %q", txt, want)
+	}
+}
+
+func TestBlockSourceNames(t *testing.T) {
+	ads := serveList(t, "0.0.0.0 ads.example.com\n0.0.0.0 both.example.com\n")
+	malware := serveList(t, "0.0.0.0 both.example.com\n")
+	cfg := &config.Config{
+		Blocklists:     []string{ads, malware},
+		BlocklistNames: map[string]string{ads: "Ad servers"},
+	}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetBlockExplainTXT(true)
+	h.SetDecisionTrace(true)
+
+	// Unnamed lists keep their URL.
+	want := []string{"blocked by glory-hole", "list: Ad servers", "list: " + malware}
+	if txt := explainTXT(t, h, "both.example.com."); !slices.Equal(txt, want) {
+		t.Errorf("TXT = %q, want %q", txt, want)
+	}
+	dec := h.Explain(context.Background(), "both.example.com.", "192.168.1.10", dns.TypeA)
+	if !slices.Equal(dec.Blocklist.Sources, []string{ads, malware}) || !slices.Equal(dec.Blocklist.Names, []string{"Ad servers", malware}) {
+		t.Errorf("Explain sources %v names %v", dec.Blocklist.Sources, dec.Blocklist.Names)
+	}
+	var entry storage.BlockTraceEntry
+	applyBlockMatchMetadata(&entry, dec.Blocklist)
+	if entry.Metadata["lists"] != "Ad servers, "+malware || entry.Metadata["list_urls"] != ads+", "+malware {
+		t.Errorf("trace metadata = %v", entry.Metadata)
+	}
+	if src := blocklistTraceSource(dec.Blocklist); src != "Ad servers" {
+		t.Errorf("trace source = %q, want the list name", src)
+	}
+
+	// Names follow config changes without a re-download.
+	mgr.UpdateConfig(&config.Config{Blocklists: cfg.Blocklists})
+	want = []string{"blocked by glory-hole", "list: " + ads}
+	if txt := explainTXT(t, h, "ads.example.com."); !slices.Equal(txt, want) {
+		t.Errorf("after removing names: TXT = %q, want %q", txt, want)
+	}
+}
+
+func TestBlockCategories(t *testing.T) {
+	ads := serveList(t, "0.0.0.0 ads.example.com\n0.0.0.0 both.example.com\n")
+	malware := serveList(t, "0.0.0.0 evil.example.com\n0.0.0.0 both.example.com\n")
+	cfg := &config.Config{Blocklists: []string{ads, malware}}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:     "no-games",
+		Logic:    `Domain == "games.example.com"`,
+		Action:   policy.ActionBlock,
+		Category: "parental",
+		Enabled:  true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetPolicyEngine(engine)
+	h.SetBlockExplainTXT(true)
+	h.SetBlocklistCategories(map[string]string{ads: "advertising", malware: " malware "})
+
+	for domain, category := range map[string]string{
+		"ads.example.com.":   "advertising",
+		"evil.example.com.":  "malware",
+		"both.example.com.":  "advertising, malware",
+		"games.example.com.": "parental",
+	} {
+		want := []string{"blocked by glory-hole", "category: " + category}
+		if txt := explainTXT(t, h, domain); !slices.Equal(txt, want) {
+			t.Errorf("%s: TXT = %q, want %q", domain, txt, want)
+		}
+		if dec := h.Explain(context.Background(), domain, "192.168.1.10", dns.TypeA); dec.Category != category {
+			t.Errorf("%s: Explain category = %q, want %q", domain, dec.Category, category)
+		}
+	}
+
+	h.SetBlocklistCategories(nil)
+	if txt := explainTXT(t, h, "ads.example.com."); !slices.Equal(txt, []string{"blocked by glory-hole"}) {
+		t.Errorf("uncategorized list: TXT = %q", txt)
+	}
+}
+
+func TestBlocklistRedirects(t *testing.T) {
+	trackers := serveList(t, "0.0.0.0 tracker.example.com\n0.0.0.0 both.example.com\n")
+	malware := serveList(t, "0.0.0.0 both.example.com\n")
+	cfg := &config.Config{Blocklists: []string{trackers, malware}}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetBlocklistCategories(map[string]string{trackers: "tracking", malware: "malware"})
+	h.SetBlocklistRedirects(map[string][]string{"tracking": {"10.0.0.53", "fd00::53"}})
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatalf("%s: no response", name)
+		}
+		return w.msg
+	}
+
+	resp := query("tracker.example.com.", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "10.0.0.53" {
+		t.Errorf("A: got rcode %d answers %v, want the IPv4 sink", resp.Rcode, resp.Answer)
+	}
+	resp = query("tracker.example.com.", dns.TypeAAAA)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.AAAA).AAAA.String() != "fd00::53" {
+		t.Errorf("AAAA: got answers %v, want the IPv6 sink", resp.Answer)
+	}
+	resp = query("tracker.example.com.", dns.TypeTXT)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("TXT: got rcode %d answers %v, want NODATA", resp.Rcode, resp.Answer)
+	}
+	if dec := h.Explain(context.Background(), "tracker.example.com.", "192.168.1.10", dns.TypeA); dec.Action != DecisionRedirect || dec.Category != "tracking" {
+		t.Errorf("Explain = %s/%q, want redirect/tracking", dec.Action, dec.Category)
+	}
+
+	// A domain also on a list without a redirect stays blocked.
+	if resp = query("both.example.com.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("both: got rcode %d, want NXDOMAIN", resp.Rcode)
+	}
+}
+
+func TestServeDNS_LogsMatchedRuleAndSource(t *testing.T) {
+	malware := serveList(t, "0.0.0.0 malware.example.com\n")
+	cfg := &config.Config{
+		Blocklists:     []string{malware},
+		BlocklistNames: map[string]string{malware: "Malware"},
+	}
+	mgr := blocklist.NewManager(cfg, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:    "no-social",
+		Logic:   `Domain == "social.example.com"`,
+		Action:  policy.ActionBlock,
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	h := NewHandler() // decision traces off: the columns don't depend on them
+	h.SetBlocklistManager(mgr)
+	h.SetPolicyEngine(engine)
+	stor := newMockStorage()
+	h.SetQueryLogger(NewQueryLogger(stor, nil, 100, 1))
+
+	for _, name := range []string{"cdn.malware.example.com.", "social.example.com.", "example.org."} {
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][2]string{
+		"cdn.malware.example.com": {malware, "malware.example.com"},
+		"social.example.com":      {matchedSourcePolicy, "no-social"},
+		"example.org":             {"", ""},
+	}
+	logs := stor.GetLogs()
+	if len(logs) != len(want) {
+		t.Fatalf("expected %d logged queries, got %d", len(want), len(logs))
+	}
+	for _, q := range logs {
+		w, ok := want[q.Domain]
+		if !ok {
+			t.Errorf("unexpected query %q", q.Domain)
+			continue
+		}
+		if q.MatchedSource != w[0] || q.MatchedRule != w[1] {
+			t.Errorf("%s: matched source/rule = %q/%q, want %q/%q", q.Domain, q.MatchedSource, q.MatchedRule, w[0], w[1])
+		}
+		if len(q.BlockTrace) != 0 {
+			t.Errorf("%s: expected no trace with decision traces off", q.Domain)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"time"
 
+	"glory-hole/pkg/forwarder"
+
 	"github.com/miekg/dns"
 )
 
@@ -15,50 +17,47 @@ import (
 // docs/plans/2026-05-25-v026-policy-consolidation.md §1 for context, and the
 // migrator at cmd/glory-hole/main.go::migrateConditionalForwardingToPolicies
 // which still runs at boot to move legacy YAML rules into the policy table.
-func (h *Handler) forwardToUpstream(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, qtypeLabel string, outcome *serveDNSOutcome) bool {
+func (h *Handler) forwardToUpstream(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, clientIP, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	fwd := h.getForwarder()
 	if fwd == nil {
 		return false
 	}
 
+	var answered forwarder.Answered
 	forwardStart := time.Now()
-	resp, err := fwd.Forward(ctx, r)
+	resp, err := fwd.Forward(forwarder.WithAnswered(ctx, &answered), r)
 	outcome.upstreamDuration = time.Since(forwardStart)
 	if err != nil {
 		outcome.responseCode = dns.RcodeServerFailure
 		msg.SetRcode(r, dns.RcodeServerFailure)
-		h.writeMsg(w, msg)
+		h.attachForwardFailureEDE(msg, err)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
-	upstreams := fwd.Upstreams()
-	if len(upstreams) > 0 {
-		outcome.upstream = upstreams[0]
-	}
-
-	h.recordForwardedQuery(ctx, "default_forward", qtypeLabel, outcome.upstream)
+	outcome.upstream = answered.Upstream
+	h.recordForwardedQuery(ctx, "default_forward", qtypeLabel, outcome.upstream, outcome.upstreamDuration)
 
 	// Capture DNSSEC validation status from response
 	outcome.dnssecValidated = resp.AuthenticatedData
 
 	// Extract Extended DNS Error (RFC 8914) from upstream response
-	if edeCode, edeText, hasEDE := ExtractEDE(resp); hasEDE {
-		codeName := EDECodeToString(edeCode)
-		if edeText != "" {
-			outcome.upstreamError = codeName + ": " + edeText
-		} else {
-			outcome.upstreamError = codeName
-		}
-	}
+	h.captureUpstreamEDE(resp, outcome)
 
 	// Enrich with Unbound dnstap data (best-effort inline correlation)
 	h.enrichFromUnbound(r, outcome)
 
+	resp = h.maybeFlattenCNAME(ctx, r, resp, fwd.Forward)
+	resp = h.applyRebindProtection(ctx, resp, r.Question[0].Name, clientIP, trace, outcome)
+	if h.deps.Load().shuffleAnswers {
+		shuffleAddresses(resp)
+	}
+
 	if c := h.getCache(); c != nil {
 		c.Set(ctx, r, resp)
 	}
 
 	outcome.responseCode = resp.Rcode
-	h.writeMsg(w, resp)
+	h.writeMsg(w, r, resp)
 	return true
 }
@@ -1,8 +1,15 @@
 package dns
 
-import "github.com/miekg/dns"
+import (
+	"errors"
+	"net"
 
-func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, domain string, qtype uint16, outcome *serveDNSOutcome) bool {
+	"glory-hole/pkg/localrecords"
+
+	"github.com/miekg/dns"
+)
+
+func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, r, msg *dns.Msg, domain string, qtype uint16, outcome *serveDNSOutcome) bool {
 	if h.getLocalRecords() == nil {
 		return false
 	}
@@ -11,23 +18,23 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 	case dns.TypeA:
 		if h.appendLocalARecords(msg, domain) {
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 		if h.resolveLocalCNAMEAsA(msg, domain) {
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeAAAA:
 		if h.appendLocalAAAARecords(msg, domain) {
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 		if h.resolveLocalCNAMEAsAAAA(msg, domain) {
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeCNAME:
@@ -43,7 +50,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 			}
 			msg.Answer = append(msg.Answer, rr)
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeTXT:
@@ -61,7 +68,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeMX:
@@ -80,7 +87,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypePTR:
@@ -98,7 +105,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeSRV:
@@ -119,7 +126,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeNS:
@@ -137,7 +144,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeSOA:
@@ -160,7 +167,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 			}
 			msg.Answer = append(msg.Answer, rr)
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	case dns.TypeCAA:
@@ -180,7 +187,7 @@ func (h *Handler) serveFromLocalRecords(w dns.ResponseWriter, msg *dns.Msg, doma
 				msg.Answer = append(msg.Answer, rr)
 			}
 			outcome.responseCode = dns.RcodeSuccess
-			h.writeMsg(w, msg)
+			h.writeMsg(w, r, msg)
 			return true
 		}
 	}
@@ -211,8 +218,37 @@ func (h *Handler) appendLocalARecords(msg *dns.Msg, domain string) bool {
 	return len(msg.Answer) > 0
 }
 
+// resolveLocalCNAME follows a local CNAME chain to its addresses. Chains that
+// loop or run past local_records.max_cname_depth are logged with distinct
+// messages, since one is a broken record set and the other a limit to raise.
+func (h *Handler) resolveLocalCNAME(domain string) ([]net.IP, uint32, bool) {
+	d := h.deps.Load()
+	ips, ttl, err := d.localRecords.ResolveCNAMEChain(domain, d.maxCNAMEDepth)
+	if err == nil {
+		return ips, ttl, true
+	}
+	if lg := h.getLogger(); lg != nil {
+		switch {
+		case errors.Is(err, localrecords.ErrCNAMELoop):
+			lg.Warn("Local CNAME chain loops; fix the local records", "domain", domain)
+		case errors.Is(err, localrecords.ErrCNAMEDepthExceeded):
+			lg.Warn("Local CNAME chain exceeds max_cname_depth; raise local_records.max_cname_depth or shorten the chain",
+				"domain", domain,
+				"max_cname_depth", maxCNAMEDepthOrDefault(d.maxCNAMEDepth))
+		}
+	}
+	return nil, 0, false
+}
+
+func maxCNAMEDepthOrDefault(depth int) int {
+	if depth <= 0 {
+		return localrecords.DefaultMaxCNAMEDepth
+	}
+	return depth
+}
+
 func (h *Handler) resolveLocalCNAMEAsA(msg *dns.Msg, domain string) bool {
-	ips, ttl, found := h.getLocalRecords().ResolveCNAME(domain, 10)
+	ips, ttl, found := h.resolveLocalCNAME(domain)
 	if !found {
 		return false
 	}
@@ -258,7 +294,7 @@ func (h *Handler) appendLocalAAAARecords(msg *dns.Msg, domain string) bool {
 }
 
 func (h *Handler) resolveLocalCNAMEAsAAAA(msg *dns.Msg, domain string) bool {
-	ips, ttl, found := h.getLocalRecords().ResolveCNAME(domain, 10)
+	ips, ttl, found := h.resolveLocalCNAME(domain)
 	if !found {
 		return false
 	}
@@ -6,18 +6,37 @@ import (
 	"strings"
 	"time"
 
+	"glory-hole/pkg/forwarder"
 	"glory-hole/pkg/policy"
 	"glory-hole/pkg/storage"
 
 	"github.com/miekg/dns"
 )
 
-func (h *Handler) handlePolicies(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, domain, clientIP string, qtype uint16, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+// traceStageClientGroup records the group a query was assigned on arrival.
+const traceStageClientGroup = "client_group"
+
+type clientGroupKey struct{}
+
+// WithClientGroup returns a context that makes ServeDNS evaluate policy
+// rules as if the client were in group, whatever its IP. The DoH endpoint
+// uses it for path tokens (server.doh.tokens).
+func WithClientGroup(ctx context.Context, group string) context.Context {
+	return context.WithValue(ctx, clientGroupKey{}, group)
+}
+
+func clientGroupFrom(ctx context.Context) string {
+	group, _ := ctx.Value(clientGroupKey{}).(string)
+	return group
+}
+
+func (h *Handler) handlePolicies(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, domain, clientIP string, qtype uint16, qtypeLabel string, enableBlocklist bool, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	policyCtx := policy.NewContext(
 		strings.TrimSuffix(domain, "."),
 		clientIP,
 		qtypeLabel,
 	)
+	policyCtx.ClientGroup = clientGroupFrom(ctx)
 
 	matched, rule := h.getPolicyEngine().Evaluate(policyCtx)
 	if !matched || rule == nil {
@@ -33,20 +52,66 @@ func (h *Handler) handlePolicies(ctx context.Context, w dns.ResponseWriter, r, m
 			"query_type", qtypeLabel)
 	}
 
+	// An ALLOW that loses to a more specific blocklist entry ends policy
+	// evaluation: the blocklist decides, and lower-priority rules (e.g. a
+	// REDIRECT or FORWARD for the same domain) are not consulted. Explain
+	// reports the same decision.
+	if rule.Action == policy.ActionAllow && enableBlocklist && !d.allowAlwaysWins {
+		if h.allowOverriddenByBlocklist(rule, domain, trace) {
+			return false
+		}
+	}
+
+	outcome.matchedSource, outcome.matchedRule = matchedSourcePolicy, rule.Name
 	switch rule.Action {
 	case policy.ActionBlock:
 		return h.handlePolicyBlock(ctx, w, r, msg, rule, domain, clientIP, qtypeLabel, trace, outcome)
 	case policy.ActionAllow:
-		return h.handlePolicyAllow(ctx, w, r, msg, rule, domain, clientIP, qtypeLabel, trace, outcome)
+		return h.handlePolicyAllow(ctx, w, r, msg, rule, domain, clientIP, qtypeLabel, d, trace, outcome)
 	case policy.ActionRedirect:
-		return h.handlePolicyRedirect(ctx, w, r, msg, rule, domain, clientIP, qtype, qtypeLabel, trace, outcome)
+		return h.handlePolicyRedirect(ctx, w, r, msg, rule, domain, clientIP, qtype, qtypeLabel, d, trace, outcome)
 	case policy.ActionForward:
-		return h.handlePolicyForward(ctx, w, r, msg, rule, domain, clientIP, qtypeLabel, trace, outcome)
+		return h.handlePolicyForward(ctx, w, r, msg, rule, domain, clientIP, qtypeLabel, d, trace, outcome)
 	default:
 		return false
 	}
 }
 
+// allowOverriddenByBlocklist applies most-specific-wins between a
+// domain-scoped ALLOW rule and the blocklist. When the blocklist entry that
+// matches domain is strictly more specific than the rule (a list blocks
+// ads.example.com while the whitelist allows *.example.com), the ALLOW is
+// skipped so the blocklist stage blocks the query. Ties go to the ALLOW, and
+// rules that aren't plain domain scopes (client/time conditions) always win.
+func (h *Handler) allowOverriddenByBlocklist(rule *policy.Rule, domain string, trace *blockTraceRecorder) bool {
+	allowScore, ok := rule.Specificity(domain)
+	if !ok {
+		return false
+	}
+	mgr := h.getBlocklistManager()
+	if mgr == nil {
+		return false
+	}
+	match := mgr.Match(domain)
+	if !match.Blocked || match.Specificity <= allowScore {
+		return false
+	}
+
+	trace.Record(traceStagePolicy, "allow_overridden", func(entry *storage.BlockTraceEntry) {
+		entry.Rule = rule.Name
+		entry.Source = "policy_engine"
+		entry.Detail = "blocklist entry is more specific than allow rule: " + rule.Logic
+	})
+	if lg := h.getLogger(); lg != nil {
+		lg.Debug("ALLOW rule overridden by more specific blocklist entry",
+			"rule", rule.Name,
+			"domain", domain,
+			"allow_specificity", allowScore,
+			"block_specificity", match.Specificity)
+	}
+	return true
+}
+
 func (h *Handler) handlePolicyBlock(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	outcome.blocked = true
 
@@ -76,6 +141,7 @@ func (h *Handler) handlePolicyBlock(ctx context.Context, w dns.ResponseWriter, r
 		entry.Rule = rule.Name
 		entry.Source = "policy_engine"
 		entry.Detail = "policy rule matched: " + rule.Logic
+		entry.Category = rule.BlockCategory()
 	})
 
 	h.recordBlockedQuery(ctx, blockMetadata{
@@ -85,6 +151,7 @@ func (h *Handler) handlePolicyBlock(ctx context.Context, w dns.ResponseWriter, r
 		rule:       rule.Name,
 		source:     "policy_engine",
 	})
+	h.explainBlock(msg, "rule", rule.BlockCategory(), rule.Name)
 
 	if lg := h.getLogger(); lg != nil {
 		lg.Debug("Policy blocked query",
@@ -96,11 +163,11 @@ func (h *Handler) handlePolicyBlock(ctx context.Context, w dns.ResponseWriter, r
 	// Policy BLOCK decisions are NOT cached.
 	// Policies are always evaluated fresh to handle ordering, multiple matches, and toggles correctly.
 
-	h.writeMsg(w, msg)
+	h.writeMsg(w, r, msg)
 	return true
 }
 
-func (h *Handler) handlePolicyAllow(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+func (h *Handler) handlePolicyAllow(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP, qtypeLabel string, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	// Record trace BEFORE response - this appears in query logs
 	// ALLOW bypasses blocklist and forwards directly to upstream
 	trace.Record(traceStagePolicy, string(rule.Action), func(entry *storage.BlockTraceEntry) {
@@ -124,7 +191,7 @@ func (h *Handler) handlePolicyAllow(ctx context.Context, w dns.ResponseWriter, r
 		}
 		outcome.responseCode = dns.RcodeNameError
 		msg.SetRcode(r, dns.RcodeNameError)
-		h.writeMsg(w, msg)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
@@ -136,8 +203,9 @@ func (h *Handler) handlePolicyAllow(ctx context.Context, w dns.ResponseWriter, r
 			"bypasses_blocklist", true)
 	}
 
+	var answered forwarder.Answered
 	forwardStart := time.Now()
-	resp, err := fwd.Forward(ctx, r)
+	resp, err := fwd.Forward(forwarder.WithAnswered(ctx, &answered), r)
 	outcome.upstreamDuration = time.Since(forwardStart)
 	if err != nil {
 		if lg != nil {
@@ -149,41 +217,37 @@ func (h *Handler) handlePolicyAllow(ctx context.Context, w dns.ResponseWriter, r
 		}
 		outcome.responseCode = dns.RcodeServerFailure
 		msg.SetRcode(r, dns.RcodeServerFailure)
-		h.writeMsg(w, msg)
+		h.attachForwardFailureEDE(msg, err)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
-	upstreams := fwd.Upstreams()
-	if len(upstreams) > 0 {
-		outcome.upstream = upstreams[0]
-	}
-
-	h.recordForwardedQuery(ctx, "policy_allow", qtypeLabel, outcome.upstream)
+	outcome.upstream = answered.Upstream
+	h.recordForwardedQuery(ctx, "policy_allow", qtypeLabel, outcome.upstream, outcome.upstreamDuration)
 
 	// Capture DNSSEC and EDE from upstream response
 	outcome.dnssecValidated = resp.AuthenticatedData
-	if edeCode, edeText, hasEDE := ExtractEDE(resp); hasEDE {
-		codeName := EDECodeToString(edeCode)
-		if edeText != "" {
-			outcome.upstreamError = codeName + ": " + edeText
-		} else {
-			outcome.upstreamError = codeName
-		}
-	}
+	h.captureUpstreamEDE(resp, outcome)
 
 	// Enrich with Unbound dnstap data (best-effort inline correlation)
 	h.enrichFromUnbound(r, outcome)
 
+	resp = h.maybeFlattenCNAME(ctx, r, resp, fwd.Forward)
+	resp = h.applyRebindProtection(ctx, resp, domain, clientIP, trace, outcome)
+	if d.shuffleAnswers {
+		shuffleAddresses(resp)
+	}
+
 	if c := h.getCache(); c != nil {
 		c.Set(ctx, r, resp)
 	}
 
 	outcome.responseCode = resp.Rcode
-	h.writeMsg(w, resp)
+	h.writeMsg(w, r, resp)
 	return true
 }
 
-func (h *Handler) handlePolicyRedirect(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP string, qtype uint16, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+func (h *Handler) handlePolicyRedirect(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP string, qtype uint16, qtypeLabel string, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	targetIP := net.ParseIP(rule.ActionData)
 	if targetIP == nil {
 		if lg := h.getLogger(); lg != nil {
@@ -195,7 +259,7 @@ func (h *Handler) handlePolicyRedirect(ctx context.Context, w dns.ResponseWriter
 		}
 		outcome.responseCode = dns.RcodeNameError
 		msg.SetRcode(r, dns.RcodeNameError)
-		h.writeMsg(w, msg)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
@@ -220,12 +284,17 @@ func (h *Handler) handlePolicyRedirect(ctx context.Context, w dns.ResponseWriter
 			"query_type", qtypeLabel)
 	}
 
+	ttl := d.overrideTTL
+	if ttl == 0 {
+		ttl = defaultOverrideTTL
+	}
+
 	switch {
 	case qtype == dns.TypeA && targetIP.To4() != nil:
-		addARecord(msg, domain, targetIP, 300)
+		addARecord(msg, domain, targetIP, ttl)
 		outcome.responseCode = dns.RcodeSuccess
 	case qtype == dns.TypeAAAA && targetIP.To4() == nil:
-		addAAAARecord(msg, domain, targetIP, 300)
+		addAAAARecord(msg, domain, targetIP, ttl)
 		outcome.responseCode = dns.RcodeSuccess
 	default:
 		outcome.responseCode = dns.RcodeSuccess
@@ -234,11 +303,11 @@ func (h *Handler) handlePolicyRedirect(ctx context.Context, w dns.ResponseWriter
 	// Policy REDIRECT decisions are NOT cached.
 	// Policies are always evaluated fresh to handle ordering, multiple matches, and toggles correctly.
 
-	h.writeMsg(w, msg)
+	h.writeMsg(w, r, msg)
 	return true
 }
 
-func (h *Handler) handlePolicyForward(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+func (h *Handler) handlePolicyForward(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, rule *policy.Rule, domain, clientIP, qtypeLabel string, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
 	upstreams := rule.GetUpstreams()
 	fwd := h.getForwarder()
 	lg := h.getLogger()
@@ -252,7 +321,8 @@ func (h *Handler) handlePolicyForward(ctx context.Context, w dns.ResponseWriter,
 		}
 		outcome.responseCode = dns.RcodeServerFailure
 		msg.SetRcode(r, dns.RcodeServerFailure)
-		h.writeMsg(w, msg)
+		h.attachEDE(msg, dns.ExtendedErrorCodeNoReachableAuthority, "policy forward has no upstreams")
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
@@ -275,8 +345,9 @@ func (h *Handler) handlePolicyForward(ctx context.Context, w dns.ResponseWriter,
 			"upstreams", upstreams)
 	}
 
+	var answered forwarder.Answered
 	forwardStart := time.Now()
-	resp, err := fwd.ForwardWithUpstreams(ctx, r, upstreams)
+	resp, err := fwd.ForwardWithUpstreams(forwarder.WithAnswered(ctx, &answered), r, upstreams)
 	outcome.upstreamDuration = time.Since(forwardStart)
 	if err != nil {
 		if lg != nil {
@@ -289,35 +360,33 @@ func (h *Handler) handlePolicyForward(ctx context.Context, w dns.ResponseWriter,
 		}
 		outcome.responseCode = dns.RcodeServerFailure
 		msg.SetRcode(r, dns.RcodeServerFailure)
-		h.writeMsg(w, msg)
+		h.attachForwardFailureEDE(msg, err)
+		h.writeMsg(w, r, msg)
 		return true
 	}
 
-	if len(upstreams) > 0 {
-		outcome.upstream = upstreams[0]
-	}
-
-	h.recordForwardedQuery(ctx, "conditional_rule", qtypeLabel, outcome.upstream)
+	outcome.upstream = answered.Upstream
+	h.recordForwardedQuery(ctx, "conditional_rule", qtypeLabel, outcome.upstream, outcome.upstreamDuration)
 
 	// Capture DNSSEC and EDE from upstream response
 	outcome.dnssecValidated = resp.AuthenticatedData
-	if edeCode, edeText, hasEDE := ExtractEDE(resp); hasEDE {
-		codeName := EDECodeToString(edeCode)
-		if edeText != "" {
-			outcome.upstreamError = codeName + ": " + edeText
-		} else {
-			outcome.upstreamError = codeName
-		}
-	}
+	h.captureUpstreamEDE(resp, outcome)
 
 	// Enrich with Unbound dnstap data (best-effort inline correlation)
 	h.enrichFromUnbound(r, outcome)
 
+	resp = h.maybeFlattenCNAME(ctx, r, resp, func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+		return fwd.ForwardWithUpstreams(ctx, m, upstreams)
+	})
+	if d.shuffleAnswers {
+		shuffleAddresses(resp)
+	}
+
 	if c := h.getCache(); c != nil {
 		c.Set(ctx, r, resp)
 	}
 
 	outcome.responseCode = resp.Rcode
-	h.writeMsg(w, resp)
+	h.writeMsg(w, r, resp)
 	return true
 }
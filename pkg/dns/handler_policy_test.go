@@ -0,0 +1,226 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+// startAnsweringUpstream runs a UDP DNS server that answers every A query
+// with 10.9.9.9, so tests can tell a forwarded (allowed) query from a block.
+func startAnsweringUpstream(t *testing.T) string {
+	t.Helper()
+	return startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("10.9.9.9"),
+		})
+		_ = w.WriteMsg(m)
+	})
+}
+
+func newPrecedenceHandler(t *testing.T, allowLogic string, blocked []string) *Handler {
+	t.Helper()
+	logger := logging.NewDefault()
+	cfg := &config.Config{UpstreamDNSServers: []string{startAnsweringUpstream(t)}}
+
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logger, nil))
+
+	mgr := blocklist.NewManager(cfg, logger, nil, nil)
+	mgr.SetDomainsForTest(blocked)
+	h.SetBlocklistManager(mgr)
+
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{
+		Name:    "allow",
+		Logic:   allowLogic,
+		Action:  policy.ActionAllow,
+		Enabled: true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+	h.SetPolicyEngine(engine)
+	return h
+}
+
+func queryRcode(t *testing.T, h *Handler, domain string) (int, int) {
+	t.Helper()
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+	r := new(dns.Msg)
+	r.SetQuestion(domain, dns.TypeA)
+	h.ServeDNS(context.Background(), w, r)
+	if w.msg == nil {
+		t.Fatalf("no response for %s", domain)
+	}
+	return w.msg.Rcode, len(w.msg.Answer)
+}
+
+const wildcardAllowExampleCom = `Domain == "example.com" || DomainEndsWith(Domain, ".example.com")`
+
+func TestPrecedence_ExactBlockBeatsWildcardAllow(t *testing.T) {
+	h := newPrecedenceHandler(t, wildcardAllowExampleCom, []string{"ads.example.com."})
+
+	if rcode, _ := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeNameError {
+		t.Errorf("ads.example.com: expected NXDOMAIN (exact block is more specific), got %s", dns.RcodeToString[rcode])
+	}
+	if rcode, n := queryRcode(t, h, "www.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("www.example.com: expected allowed answer, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+}
+
+func TestPrecedence_OverriddenAllowEndsPolicyEvaluation(t *testing.T) {
+	h := newPrecedenceHandler(t, wildcardAllowExampleCom, []string{"ads.example.com."})
+	// A lower-priority rule that would otherwise answer the query.
+	if err := h.getPolicyEngine().AddRule(&policy.Rule{
+		Name:       "redirect-ads",
+		Logic:      `Domain == "ads.example.com"`,
+		Action:     policy.ActionRedirect,
+		ActionData: "10.1.1.1",
+		Enabled:    true,
+	}); err != nil {
+		t.Fatalf("AddRule: %v", err)
+	}
+
+	if rcode, n := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeNameError || n != 0 {
+		t.Errorf("expected the blocklist to decide after the overridden ALLOW, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+	dec := h.Explain(context.Background(), "ads.example.com", "192.168.1.10", dns.TypeA)
+	if dec.Action != DecisionBlock || dec.Stage != traceStageBlocklist || dec.AllowOverridden != "allow" {
+		t.Errorf("Explain should agree with ServeDNS, got %s/%s (overridden %q)", dec.Action, dec.Stage, dec.AllowOverridden)
+	}
+}
+
+func TestPrecedence_ExactAllowBeatsWildcardBlock(t *testing.T) {
+	// Blocklist entry example.com blocks the whole subtree; the exact allow
+	// for one host inside it is more specific.
+	h := newPrecedenceHandler(t, `Domain == "cdn.example.com"`, []string{"example.com."})
+
+	if rcode, n := queryRcode(t, h, "cdn.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("cdn.example.com: expected allowed answer, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+	if rcode, _ := queryRcode(t, h, "tracker.example.com."); rcode != dns.RcodeNameError {
+		t.Errorf("tracker.example.com: expected NXDOMAIN, got %s", dns.RcodeToString[rcode])
+	}
+}
+
+func TestPrecedence_DeeperWildcardAllowBeatsShallowBlock(t *testing.T) {
+	h := newPrecedenceHandler(t,
+		`Domain == "static.example.com" || DomainEndsWith(Domain, ".static.example.com")`,
+		[]string{"example.com."})
+
+	if rcode, n := queryRcode(t, h, "img.static.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("expected allowed answer, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+}
+
+func TestPrecedence_TieGoesToAllow(t *testing.T) {
+	h := newPrecedenceHandler(t, `Domain == "ads.example.com"`, []string{"ads.example.com."})
+
+	if rcode, n := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("expected allowed answer on tie, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+}
+
+func TestPrecedence_WhitelistAlwaysWins(t *testing.T) {
+	h := newPrecedenceHandler(t, wildcardAllowExampleCom, []string{"ads.example.com."})
+	h.SetWhitelistAlwaysWins(true)
+
+	if rcode, n := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("expected allow to win with override, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+}
+
+func TestPrecedence_NonDomainRuleAlwaysWins(t *testing.T) {
+	// Rules with client conditions are deliberate policy, not a whitelist
+	// entry, and keep policy-first semantics.
+	h := newPrecedenceHandler(t,
+		`IPInCIDR(ClientIP, "192.168.1.0/24") && DomainEndsWith(Domain, "example.com")`,
+		[]string{"ads.example.com."})
+
+	if rcode, n := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeSuccess || n != 1 {
+		t.Errorf("expected client-scoped allow to win, got %s with %d answers", dns.RcodeToString[rcode], n)
+	}
+}
+
+// startCountingUpstream runs a UDP DNS server that answers every query with
+// NOERROR and counts queries by type label.
+func startCountingUpstream(t *testing.T) (string, func(label string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	addr := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		mu.Lock()
+		seen[dnsTypeLabel(r.Question[0].Qtype)]++
+		mu.Unlock()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	})
+	return addr, func(label string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen[label]
+	}
+}
+
+func TestPolicyForward_ByQueryType(t *testing.T) {
+	general, generalSeen := startCountingUpstream(t)
+	local, localSeen := startCountingUpstream(t)
+
+	cfg := &config.Config{UpstreamDNSServers: []string{general}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	engine := policy.NewEngine(nil)
+	for _, rule := range []*policy.Rule{
+		{Name: "ptr-local", Logic: `QueryType == "PTR"`, Action: policy.ActionForward, ActionData: local, Enabled: true},
+		{Name: "private-type", Logic: `QueryTypeIn(QueryType, "TYPE65280", "type65")`, Action: policy.ActionForward, ActionData: local, Enabled: true},
+	} {
+		if err := engine.AddRule(rule); err != nil {
+			t.Fatalf("AddRule(%s): %v", rule.Name, err)
+		}
+	}
+	h.SetPolicyEngine(engine)
+
+	queries := []struct {
+		name  string
+		qtype uint16
+		local bool
+	}{
+		{"1.1.168.192.in-addr.arpa.", dns.TypePTR, true},
+		{"www.example.com.", dns.TypeA, false},
+		{"www.example.com.", 65280, true},         // unassigned type, labelled TYPE65280
+		{"www.example.com.", dns.TypeHTTPS, true}, // matched via its RFC 3597 form TYPE65
+		{"www.example.com.", dns.TypeMX, false},
+	}
+	for _, q := range queries {
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(q.name, q.qtype)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess {
+			t.Fatalf("%s %s: expected NOERROR response, got %v", q.name, dnsTypeLabel(q.qtype), w.msg)
+		}
+
+		label := dnsTypeLabel(q.qtype)
+		want, other := generalSeen, localSeen
+		if q.local {
+			want, other = localSeen, generalSeen
+		}
+		if want(label) != 1 || other(label) != 0 {
+			t.Errorf("%s: routed to the wrong upstream (general=%d local=%d)", label, generalSeen(label), localSeen(label))
+		}
+	}
+}
@@ -3,6 +3,8 @@ package dns
 import (
 	"sync"
 	"time"
+
+	"glory-hole/pkg/blocklist"
 )
 
 // serveDNSOutcome captures the mutable fields that downstream helpers update
@@ -15,6 +17,9 @@ type serveDNSOutcome struct {
 	upstreamError    string // EDE (Extended DNS Error) text from upstream
 	responseCode     int
 	upstreamDuration time.Duration
+	skipLog          bool // not written to the query log (health checks)
+	matchedRule      string
+	matchedSource    string
 
 	// Unbound enrichment (populated via dnstap reply buffer)
 	unboundCached   *bool
@@ -22,6 +27,31 @@ type serveDNSOutcome struct {
 	unboundRespSize *int
 }
 
+// Query log matched_source values for decisions that aren't a named list
+const (
+	matchedSourcePolicy = "policy"
+	matchedSourceLegacy = "legacy"
+)
+
+// setBlocklistMatch records the list and entry that decided the query for
+// the query log's matched_source/matched_rule columns. The source is the
+// first matching list's URL, which stays stable when its display name is
+// changed; the API maps it to the name when reading.
+func (o *serveDNSOutcome) setBlocklistMatch(match blocklist.MatchResult) {
+	switch {
+	case len(match.Sources) > 0:
+		o.matchedSource = match.Sources[0]
+	case match.Kind != "":
+		o.matchedSource = match.Kind
+	default:
+		o.matchedSource = "blocklist"
+	}
+	o.matchedRule = match.Entry
+	if match.Pattern != "" {
+		o.matchedRule = match.Pattern
+	}
+}
+
 // outcomePool provides object pooling for serveDNSOutcome to reduce allocations.
 var outcomePool = sync.Pool{
 	New: func() interface{} {
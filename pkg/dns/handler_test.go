@@ -1,9 +1,15 @@
 package dns
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"glory-hole/pkg/logging"
 
 	"github.com/miekg/dns"
 )
@@ -128,3 +134,34 @@ func TestNewHandler(t *testing.T) {
 		t.Error("Blocklist not initialized")
 	}
 }
+
+func TestServeDNS_SlowQueryLog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewHandler()
+	handler.SetLogger(&logging.Logger{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+
+	w := &mockResponseWriter{
+		remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 12345},
+	}
+	r := new(dns.Msg)
+	r.SetQuestion("slow.example.com.", dns.TypeA)
+
+	// Disabled by default
+	handler.ServeDNS(context.Background(), w, r)
+	if strings.Contains(buf.String(), "Slow DNS query") {
+		t.Fatal("slow-query log should be off without a threshold")
+	}
+
+	handler.SetSlowQueryThreshold(time.Nanosecond)
+	handler.ServeDNS(context.Background(), w, r)
+
+	out := buf.String()
+	if !strings.Contains(out, "Slow DNS query") {
+		t.Fatalf("expected slow-query warning, got %q", out)
+	}
+	for _, want := range []string{"domain=slow.example.com.", "client=192.0.2.7", "duration_ms="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("slow-query log missing %q: %s", want, out)
+		}
+	}
+}
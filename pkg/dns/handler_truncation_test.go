@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/localrecords"
+
+	"github.com/miekg/dns"
+)
+
+// startTruncationServer serves h on UDP and TCP on one loopback port with a
+// local TXT name whose answer is ~4KB: 20 records of 200 bytes each.
+func startTruncationServer(t *testing.T, h *Handler) string {
+	t.Helper()
+	mgr := localrecords.NewManager()
+	for i := 0; i < 20; i++ {
+		txt := strings.Repeat(string(rune('a'+i)), 200)
+		if err := mgr.AddRecord(localrecords.NewTXTRecord("big.local", []string{txt})); err != nil {
+			t.Fatalf("AddRecord: %v", err)
+		}
+	}
+	h.SetLocalRecords(mgr)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		t.Skipf("port not free for TCP: %v", err)
+	}
+	serve := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		h.ServeDNS(context.Background(), w, r)
+	})
+	udp := &dns.Server{PacketConn: pc, Handler: serve}
+	tcp := &dns.Server{Listener: ln, Handler: serve}
+	go func() { _ = udp.ActivateAndServe() }()
+	go func() { _ = tcp.ActivateAndServe() }()
+	t.Cleanup(func() {
+		_ = udp.Shutdown()
+		_ = tcp.Shutdown()
+	})
+	time.Sleep(20 * time.Millisecond) // let the serve goroutines activate
+	return pc.LocalAddr().String()
+}
+
+func queryBigTXT(t *testing.T, addr, network string, bufsize uint16) (*dns.Msg, int) {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetQuestion("big.local.", dns.TypeTXT)
+	if bufsize > 0 {
+		msg.SetEdns0(bufsize, false)
+	}
+	c := &dns.Client{Net: network, Timeout: time.Second, UDPSize: dns.MaxMsgSize}
+	resp, _, err := c.Exchange(msg, addr)
+	if err != nil {
+		t.Fatalf("%s exchange: %v", network, err)
+	}
+	packed, err := resp.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	return resp, len(packed)
+}
+
+func TestWriteMsg_UDPTruncation(t *testing.T) {
+	h := NewHandler()
+	h.SetMaxUDPSize(1232)
+	addr := startTruncationServer(t, h)
+
+	tests := []struct {
+		name    string
+		bufsize uint16 // 0 = no EDNS0
+		limit   int
+	}{
+		{"no EDNS0 uses 512 bytes", 0, 512},
+		{"EDNS0 buffer below the cap", 1000, 1000},
+		{"EDNS0 buffer above the cap", 4096, 1232},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, size := queryBigTXT(t, addr, "udp", tt.bufsize)
+			if !resp.Truncated {
+				t.Fatal("expected TC bit on oversized UDP response")
+			}
+			if size > tt.limit {
+				t.Errorf("response is %d bytes, limit %d", size, tt.limit)
+			}
+			if len(resp.Answer) >= 20 {
+				t.Errorf("expected records to be trimmed, got %d", len(resp.Answer))
+			}
+			if tt.bufsize > 0 && resp.IsEdns0() == nil {
+				t.Error("truncated response should keep its OPT record")
+			}
+		})
+	}
+}
+
+func TestWriteMsg_TCPNotTruncated(t *testing.T) {
+	h := NewHandler()
+	h.SetMaxUDPSize(1232)
+	addr := startTruncationServer(t, h)
+
+	resp, size := queryBigTXT(t, addr, "tcp", 0)
+	if resp.Truncated {
+		t.Error("TCP response should not be truncated")
+	}
+	if len(resp.Answer) != 20 {
+		t.Errorf("expected all 20 TXT records over TCP, got %d", len(resp.Answer))
+	}
+	if size <= 4000 {
+		t.Errorf("expected the full ~4KB answer over TCP, got %d bytes", size)
+	}
+}
+
+func TestWriteMsg_UDPFitsClientBuffer(t *testing.T) {
+	h := NewHandler() // no server.max_udp_size cap
+	addr := startTruncationServer(t, h)
+
+	resp, _ := queryBigTXT(t, addr, "udp", 8192)
+	if resp.Truncated || len(resp.Answer) != 20 {
+		t.Errorf("answer fits the client's buffer: truncated=%v answers=%d", resp.Truncated, len(resp.Answer))
+	}
+}
+
+func TestUDPResponseLimit(t *testing.T) {
+	withEDNS := func(size uint16) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetEdns0(size, false)
+		return m
+	}
+	tests := []struct {
+		name    string
+		r       *dns.Msg
+		maxSize int
+		want    int
+	}{
+		{"no EDNS0", new(dns.Msg), 0, 512},
+		{"no EDNS0 ignores larger cap", new(dns.Msg), 1232, 512},
+		{"EDNS0 uncapped", withEDNS(4096), 0, 4096},
+		{"EDNS0 capped", withEDNS(4096), 1232, 1232},
+		{"EDNS0 below 512 is raised", withEDNS(100), 0, 512},
+	}
+	for _, tt := range tests {
+		if got := udpResponseLimit(tt.r, tt.maxSize); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// rawUDPExchange sends msg to addr and returns the response datagram as
+// received, before any unpacking.
+func rawUDPExchange(t *testing.T, addr string, msg *dns.Msg) []byte {
+	t.Helper()
+	out, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack: %v", err)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, dns.MaxMsgSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return buf[:n]
+}
+
+func TestWriteMsg_CompressResponses(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		name := "compressed"
+		if !compress {
+			name = "uncompressed"
+		}
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler()
+			h.SetCompressResponses(compress)
+			addr := startTruncationServer(t, h)
+
+			for _, bufsize := range []uint16{8192, 1232} {
+				q := new(dns.Msg)
+				q.SetQuestion("big.local.", dns.TypeTXT)
+				q.SetEdns0(bufsize, false)
+				wire := rawUDPExchange(t, addr, q)
+
+				resp := new(dns.Msg)
+				if err := resp.Unpack(wire); err != nil {
+					t.Fatalf("Unpack: %v", err)
+				}
+				resp.Compress = false
+				plain, err := resp.Pack()
+				if err != nil {
+					t.Fatalf("Pack: %v", err)
+				}
+				if compress && len(wire) >= len(plain) {
+					t.Errorf("bufsize %d: expected a compressed response, got %d bytes (%d uncompressed)", bufsize, len(wire), len(plain))
+				}
+				if !compress && len(wire) != len(plain) {
+					t.Errorf("bufsize %d: expected no compression, got %d bytes (%d uncompressed)", bufsize, len(wire), len(plain))
+				}
+				if len(wire) > int(bufsize) {
+					t.Errorf("bufsize %d: response is %d bytes", bufsize, len(wire))
+				}
+				if bufsize < 4000 && !resp.Truncated {
+					t.Errorf("bufsize %d: expected TC on the trimmed answer", bufsize)
+				}
+			}
+		})
+	}
+}
@@ -364,6 +364,42 @@ func TestServeDNS_LocalRecord_AAAA(t *testing.T) {
 	}
 }
 
+func TestServeDNS_LocalRecord_MaxCNAMEDepth(t *testing.T) {
+	handler := NewHandler()
+	mgr := localrecords.NewManager()
+	_ = mgr.AddRecord(localrecords.NewCNAMERecord("a.local.", "b.local."))
+	_ = mgr.AddRecord(localrecords.NewCNAMERecord("b.local.", "c.local."))
+	_ = mgr.AddRecord(localrecords.NewARecord("c.local.", net.ParseIP("192.168.1.30")))
+	handler.SetLocalRecords(mgr)
+
+	query := func() *dns.Msg {
+		t.Helper()
+		req := new(dns.Msg)
+		req.SetQuestion("a.local.", dns.TypeA)
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345}}
+		handler.ServeDNS(context.Background(), w, req)
+		if w.msg == nil {
+			t.Fatal("Expected response")
+		}
+		return w.msg
+	}
+
+	if resp := query(); len(resp.Answer) != 1 {
+		t.Fatalf("default depth: expected the chain to resolve, got %v", resp.Answer)
+	}
+
+	// Two hops are needed; with a limit of one the chain is not answered locally.
+	handler.SetMaxCNAMEDepth(1)
+	if resp := query(); len(resp.Answer) != 0 {
+		t.Errorf("depth 1: expected no local answer, got %v", resp.Answer)
+	}
+
+	handler.SetMaxCNAMEDepth(2)
+	if resp := query(); len(resp.Answer) != 1 {
+		t.Errorf("depth 2: expected the chain to resolve, got %v", resp.Answer)
+	}
+}
+
 func TestServeDNS_LocalRecord_CNAME_Query(t *testing.T) {
 	handler := NewHandler()
 	mgr := localrecords.NewManager()
@@ -549,6 +585,21 @@ func TestServeDNS_PolicyEngineRedirect_IPv4(t *testing.T) {
 	if aRecord.A.String() != "192.168.1.250" {
 		t.Errorf("Expected redirect IP 192.168.1.250, got %s", aRecord.A.String())
 	}
+	if aRecord.Hdr.Ttl != defaultOverrideTTL {
+		t.Errorf("Expected default TTL %d, got %d", defaultOverrideTTL, aRecord.Hdr.Ttl)
+	}
+
+	handler.SetOverrideTTL(30 * time.Second)
+	w = &mockResponseWriter{
+		remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.100"), Port: 12345},
+	}
+	handler.ServeDNS(ctx, w, req)
+	if w.msg == nil || len(w.msg.Answer) != 1 {
+		t.Fatalf("Expected 1 answer with override_ttl set, got %v", w.msg)
+	}
+	if ttl := w.msg.Answer[0].Header().Ttl; ttl != 30 {
+		t.Errorf("Expected override_ttl of 30s, got %d", ttl)
+	}
 }
 
 // Test policy REDIRECT action with IPv6
@@ -769,3 +820,84 @@ func TestServeDNS_CacheBlockedResponse(t *testing.T) {
 		t.Errorf("Expected NXDOMAIN from cache, got %s", dns.RcodeToString[w2.msg.Rcode])
 	}
 }
+
+func TestHandler_SetDebugInjectLatency(t *testing.T) {
+	h := newPrecedenceHandler(t, `Domain == "never.invalid"`, []string{"ads.example.com."})
+	h.SetDebug(config.DebugConfig{InjectLatency: 100 * time.Millisecond})
+
+	start := time.Now()
+	if rcode, _ := queryRcode(t, h, "ads.example.com."); rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN, got %s", dns.RcodeToString[rcode])
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected response delayed by >= 100ms, took %v", elapsed)
+	}
+
+	h.SetDebug(config.DebugConfig{})
+	start = time.Now()
+	queryRcode(t, h, "ads.example.com.")
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("expected no delay after clearing inject_latency, took %v", elapsed)
+	}
+}
+
+func TestGetMsg_ReusesSections(t *testing.T) {
+	rr, _ := dns.NewRR("example.com. 60 IN A 192.0.2.1")
+	msg := &dns.Msg{
+		MsgHdr: dns.MsgHdr{Id: 7, Rcode: dns.RcodeNameError},
+		Answer: make([]dns.RR, 0, 4),
+		Extra:  make([]dns.RR, 0, maxPooledRRs+1),
+	}
+	msg.Answer = append(msg.Answer, rr, rr)
+	msg.Extra = append(msg.Extra, rr)
+	answer := msg.Answer
+
+	msgPool.Put(msg)
+	// sync.Pool may hand out a different object; only check reuse when it
+	// returns the one just put back.
+	got := getMsg()
+	defer msgPool.Put(got)
+	if got != msg {
+		t.Skip("pool returned a fresh message")
+	}
+
+	if got.Id != 0 || got.Rcode != dns.RcodeSuccess || len(got.Answer) != 0 || len(got.Extra) != 0 {
+		t.Fatalf("message not reset: %+v", got)
+	}
+	if cap(got.Answer) != 4 {
+		t.Errorf("Answer capacity = %d, want 4 (reused)", cap(got.Answer))
+	}
+	if answer[0] != nil || answer[1] != nil {
+		t.Error("old answer records should be cleared so the pool doesn't pin them")
+	}
+	if got.Extra != nil {
+		t.Errorf("Extra with capacity above %d should not be pooled", maxPooledRRs)
+	}
+}
+
+func TestServeDNS_PooledMsgDoesNotLeakAnswers(t *testing.T) {
+	h := NewHandler()
+	mgr := localrecords.NewManager()
+	if err := mgr.AddRecord(localrecords.NewARecord("nas.local", net.ParseIP("192.168.1.10"))); err != nil {
+		t.Fatalf("AddRecord: %v", err)
+	}
+	h.SetLocalRecords(mgr)
+
+	for i := 0; i < 50; i++ {
+		w := &mockResponseWriter{}
+		req := new(dns.Msg)
+		req.SetQuestion("nas.local.", dns.TypeA)
+		h.ServeDNS(context.Background(), w, req)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("iteration %d: expected 1 answer for nas.local", i)
+		}
+
+		w = &mockResponseWriter{}
+		req = new(dns.Msg)
+		req.SetQuestion("missing.example.", dns.TypeA)
+		h.ServeDNS(context.Background(), w, req)
+		if w.msg == nil || len(w.msg.Answer) != 0 {
+			t.Fatalf("iteration %d: answer from a previous query leaked into the next response", i)
+		}
+	}
+}
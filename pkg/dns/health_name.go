@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageHealthName = "health_name"
+
+// healthNameTTL keeps monitors from being answered out of a resolver cache
+// between probes.
+const healthNameTTL = 0
+
+// healthName is the server.health_name sentinel: a lowercase FQDN and the
+// address it resolves to.
+type healthName struct {
+	name string
+	ip   net.IP
+}
+
+// newHealthName builds the sentinel from config, filling in defaults. It
+// returns nil when the health name is disabled or its IP doesn't parse
+// (config validation rejects that before it gets here).
+func newHealthName(cfg config.HealthNameConfig) *healthName {
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	name, ip := cfg.Name, cfg.IP
+	if name == "" {
+		name = config.DefaultHealthName
+	}
+	if ip == "" {
+		ip = config.DefaultHealthNameIP
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+	return &healthName{name: strings.ToLower(dns.Fqdn(name)), ip: parsed}
+}
+
+// serveHealthName answers the health name with its address (A for IPv4, AAAA
+// for IPv6; NODATA for other types) and NOERROR, before any filtering. It
+// reports false for every other name.
+func (h *Handler) serveHealthName(w dns.ResponseWriter, r, msg *dns.Msg, hn *healthName, domain string, qtype uint16, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	if hn == nil || !strings.EqualFold(domain, hn.name) {
+		return false
+	}
+	trace.Record(traceStageHealthName, "answer", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "health_name"
+		entry.Detail = "answered health check name"
+	})
+
+	hdr := dns.RR_Header{Name: domain, Class: dns.ClassINET, Ttl: healthNameTTL}
+	if ip4 := hn.ip.To4(); ip4 != nil {
+		if qtype == dns.TypeA {
+			hdr.Rrtype = dns.TypeA
+			msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr, A: ip4})
+		}
+	} else if qtype == dns.TypeAAAA {
+		hdr.Rrtype = dns.TypeAAAA
+		msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: hdr, AAAA: hn.ip})
+	}
+	msg.SetRcode(r, dns.RcodeSuccess)
+	outcome.responseCode = dns.RcodeSuccess
+	outcome.skipLog = true
+	h.writeMsg(w, r, msg)
+	return true
+}
@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_HealthName(t *testing.T) {
+	h := NewHandler()
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{Name: "Block all", Logic: "true", Action: policy.ActionBlock, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicyEngine(engine)
+	stor := newMockStorage()
+	h.SetQueryLogger(NewQueryLogger(stor, nil, 100, 1))
+	h.SetHealthName(config.HealthNameConfig{})
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	// Defaults apply to an empty config, and filtering is bypassed
+	resp := query("HealthCheck.GloryHole.", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("expected one A answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if a, ok := resp.Answer[0].(*dns.A); !ok || !a.A.Equal(net.ParseIP("127.0.0.1")) || a.Hdr.Name != "HealthCheck.GloryHole." {
+		t.Errorf("unexpected answer %v", resp.Answer[0])
+	}
+	if resp := query("healthcheck.gloryhole.", dns.TypeAAAA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("AAAA: expected NODATA, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("www.example.com.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("other names should still be filtered, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if dec := h.Explain(context.Background(), "healthcheck.gloryhole", "192.168.1.10", dns.TypeA); dec.Stage != traceStageHealthName {
+		t.Errorf("Explain stage = %q, want %q", dec.Stage, traceStageHealthName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := stor.Count(); got != 1 {
+		t.Errorf("expected only the blocked query to be logged, got %d entries", got)
+	}
+
+	h.SetHealthName(config.HealthNameConfig{Name: "probe.lan", IP: "fd00::53"})
+	resp = query("probe.lan.", dns.TypeAAAA)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected one AAAA answer, got %d", len(resp.Answer))
+	}
+	if aaaa, ok := resp.Answer[0].(*dns.AAAA); !ok || !aaaa.AAAA.Equal(net.ParseIP("fd00::53")) {
+		t.Errorf("unexpected answer %v", resp.Answer[0])
+	}
+
+	disabled := false
+	h.SetHealthName(config.HealthNameConfig{Enabled: &disabled})
+	if resp := query("healthcheck.gloryhole.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("disabled: expected the name to be filtered, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
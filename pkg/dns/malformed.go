@@ -0,0 +1,82 @@
+package dns
+
+import (
+	"fmt"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageMalformed = "malformed_query"
+
+// serveMalformed rejects queries the resolver won't process: more than one
+// question, an opcode other than QUERY, or a name over max_qname_length. It
+// returns false for a well-formed query.
+func (h *Handler) serveMalformed(w dns.ResponseWriter, r, msg *dns.Msg, cfg *config.MalformedQueriesConfig, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	var rcode int
+	var detail string
+	switch {
+	case r.Opcode != dns.OpcodeQuery:
+		rcode = malformedRcode(cfg.UnsupportedOpcode, dns.RcodeNotImplemented)
+		detail = "unsupported opcode " + opcodeLabel(r.Opcode)
+	case len(r.Question) > 1:
+		rcode = malformedRcode(cfg.MultiQuestion, dns.RcodeRefused)
+		detail = fmt.Sprintf("%d questions in one query", len(r.Question))
+	case cfg.MaxQNameLength > 0 && len(r.Question) == 1 && len(r.Question[0].Name) > cfg.MaxQNameLength:
+		rcode = dns.RcodeRefused
+		detail = fmt.Sprintf("query name is %d characters, limit is %d", len(r.Question[0].Name), cfg.MaxQNameLength)
+	default:
+		return false
+	}
+
+	trace.Record(traceStageMalformed, "reject", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "malformed_queries"
+		entry.Detail = detail
+	})
+	msg.SetRcode(r, rcode) // echoes only the first question
+	outcome.responseCode = rcode
+	h.writeMsg(w, r, msg)
+	return true
+}
+
+// malformedRcode maps a server.malformed_queries mode to its rcode, falling
+// back to def when the mode is unset.
+func malformedRcode(mode string, def int) int {
+	switch mode {
+	case config.MalformedRefuse:
+		return dns.RcodeRefused
+	case config.MalformedFormErr:
+		return dns.RcodeFormatError
+	case config.MalformedNotImp:
+		return dns.RcodeNotImplemented
+	}
+	return def
+}
+
+// opcodeLabel names an opcode for logs and traces.
+func opcodeLabel(opcode int) string {
+	if name, ok := dns.OpcodeToString[opcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("OPCODE%d", opcode)
+}
+
+// acceptQuery is the listeners' dns.MsgAcceptFunc. Unlike
+// dns.DefaultMsgAcceptFunc it lets multi-question queries and every opcode
+// through, so ServeDNS answers them as server.malformed_queries says. Other
+// header checks are the library's.
+func acceptQuery(dh dns.Header) dns.MsgAcceptAction {
+	const qrBit = 1 << 15
+	if dh.Bits&qrBit != 0 {
+		return dns.MsgIgnore
+	}
+	if opcode := int(dh.Bits>>11) & 0xF; opcode != dns.OpcodeQuery {
+		return dns.MsgAccept
+	}
+	if dh.Qdcount > 1 {
+		dh.Qdcount = 1
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
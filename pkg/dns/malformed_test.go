@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_MalformedQueries(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{"www.example.com.": "93.184.216.34"})
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{upstream}}, logging.NewDefault(), nil))
+
+	serve := func(r *dns.Msg) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+	query := func(name string) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		return r
+	}
+	multi := func() *dns.Msg {
+		r := query("www.example.com.")
+		r.Question = append(r.Question, dns.Question{Name: "other.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+		return r
+	}
+	withOpcode := func(opcode int) *dns.Msg {
+		r := query("example.com.")
+		r.Opcode = opcode
+		return r
+	}
+	longName := strings.Repeat("a", 60) + "." + strings.Repeat("b", 60) + ".example.com."
+
+	// Defaults: multi-question REFUSED, other opcodes NOTIMP, no length cap.
+	tests := []struct {
+		name  string
+		r     *dns.Msg
+		rcode int
+	}{
+		{"multi-question", multi(), dns.RcodeRefused},
+		{"update", withOpcode(dns.OpcodeUpdate), dns.RcodeNotImplemented},
+		{"notify", withOpcode(dns.OpcodeNotify), dns.RcodeNotImplemented},
+		{"status", withOpcode(dns.OpcodeStatus), dns.RcodeNotImplemented},
+		{"no question", new(dns.Msg), dns.RcodeFormatError},
+		{"long name", query(longName), dns.RcodeSuccess},
+		{"normal", query("www.example.com."), dns.RcodeSuccess},
+	}
+	for _, tt := range tests {
+		resp := serve(tt.r)
+		if resp.Rcode != tt.rcode {
+			t.Errorf("%s: rcode = %s, want %s", tt.name, dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.rcode])
+		}
+		if len(resp.Question) > 1 {
+			t.Errorf("%s: reply should echo at most one question, got %d", tt.name, len(resp.Question))
+		}
+	}
+
+	h.SetMalformedQueries(config.MalformedQueriesConfig{
+		MultiQuestion:     config.MalformedFormErr,
+		UnsupportedOpcode: config.MalformedRefuse,
+		MaxQNameLength:    100,
+	})
+	tests = []struct {
+		name  string
+		r     *dns.Msg
+		rcode int
+	}{
+		{"multi-question", multi(), dns.RcodeFormatError},
+		{"update", withOpcode(dns.OpcodeUpdate), dns.RcodeRefused},
+		{"long name", query(longName), dns.RcodeRefused},
+		{"normal", query("www.example.com."), dns.RcodeSuccess},
+	}
+	for _, tt := range tests {
+		if resp := serve(tt.r); resp.Rcode != tt.rcode {
+			t.Errorf("configured %s: rcode = %s, want %s", tt.name, dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.rcode])
+		}
+	}
+}
+
+func TestAcceptQuery(t *testing.T) {
+	header := func(opcode int, response bool, qd, an, ns, ar uint16) dns.Header {
+		bits := uint16(opcode&0xF) << 11
+		if response {
+			bits |= 1 << 15
+		}
+		return dns.Header{Bits: bits, Qdcount: qd, Ancount: an, Nscount: ns, Arcount: ar}
+	}
+
+	tests := []struct {
+		name string
+		dh   dns.Header
+		want dns.MsgAcceptAction
+	}{
+		{"query", header(dns.OpcodeQuery, false, 1, 0, 0, 1), dns.MsgAccept},
+		{"multi-question reaches the handler", header(dns.OpcodeQuery, false, 2, 0, 0, 0), dns.MsgAccept},
+		{"update reaches the handler", header(dns.OpcodeUpdate, false, 1, 2, 3, 0), dns.MsgAccept},
+		{"response ignored", header(dns.OpcodeQuery, true, 1, 1, 0, 0), dns.MsgIgnore},
+		{"no question", header(dns.OpcodeQuery, false, 0, 0, 0, 0), dns.MsgReject},
+		{"stuffed authority", header(dns.OpcodeQuery, false, 1, 0, 5, 0), dns.MsgReject},
+	}
+	for _, tt := range tests {
+		if got := acceptQuery(tt.dh); got != tt.want {
+			t.Errorf("%s: acceptQuery = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,11 +3,14 @@ package dns
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"glory-hole/pkg/blocklist"
 	"glory-hole/pkg/storage"
 
+	"github.com/miekg/dns"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
@@ -28,11 +31,11 @@ func (h *Handler) recordRateLimit(ctx context.Context, clientIP, qtypeLabel, act
 		return
 	}
 	attrs := make([]attribute.KeyValue, 0, 3)
-	if clientIP != "" {
-		attrs = append(attrs, attribute.String("client", clientIP))
+	if client := m.ClientLabel(clientIP); client != "" {
+		attrs = append(attrs, attribute.String("client", client))
 	}
 	if qtypeLabel != "" {
-		attrs = append(attrs, attribute.String("type", qtypeLabel))
+		attrs = append(attrs, attribute.String("type", m.QueryTypeLabel(qtypeLabel)))
 	}
 	if action != "" {
 		attrs = append(attrs, attribute.String("action", action))
@@ -55,7 +58,7 @@ func (h *Handler) recordBlockedQuery(ctx context.Context, meta blockMetadata) {
 		attrs = append(attrs, attribute.String("reason", meta.reason))
 	}
 	if meta.qtypeLabel != "" {
-		attrs = append(attrs, attribute.String("type", meta.qtypeLabel))
+		attrs = append(attrs, attribute.String("type", m.QueryTypeLabel(meta.qtypeLabel)))
 	}
 	if meta.stage != "" {
 		attrs = append(attrs, attribute.String("stage", meta.stage))
@@ -75,8 +78,8 @@ func (h *Handler) recordBlockedQuery(ctx context.Context, meta blockMetadata) {
 }
 
 func blocklistTraceSource(match blocklist.MatchResult) string {
-	if len(match.Sources) > 0 {
-		return match.Sources[0]
+	if names := matchSourceNames(match); len(names) > 0 {
+		return names[0]
 	}
 	if match.Kind != "" {
 		return match.Kind
@@ -97,7 +100,7 @@ func describeBlockMatch(match blocklist.MatchResult) string {
 	case kind != "":
 		return fmt.Sprintf("Matched %s entry", strings.ToLower(kind))
 	case len(match.Sources) > 0:
-		return fmt.Sprintf("Blocked by %s", match.Sources[0])
+		return fmt.Sprintf("Blocked by %s", matchSourceNames(match)[0])
 	default:
 		return ""
 	}
@@ -110,8 +113,11 @@ func applyBlockMatchMetadata(entry *storage.BlockTraceEntry, match blocklist.Mat
 	if entry.Metadata == nil {
 		entry.Metadata = make(map[string]string)
 	}
-	if len(match.Sources) > 0 {
-		entry.Metadata["lists"] = strings.Join(match.Sources, ", ")
+	if names := matchSourceNames(match); len(names) > 0 {
+		entry.Metadata["lists"] = strings.Join(names, ", ")
+		if !slices.Equal(names, match.Sources) {
+			entry.Metadata["list_urls"] = strings.Join(match.Sources, ", ")
+		}
 	}
 	if match.Kind != "" {
 		entry.Metadata["match_kind"] = titleCase(match.Kind)
@@ -124,6 +130,15 @@ func applyBlockMatchMetadata(entry *storage.BlockTraceEntry, match blocklist.Mat
 	}
 }
 
+// matchSourceNames returns the display names of the lists in match, falling
+// back to their URLs when the match carries no names.
+func matchSourceNames(match blocklist.MatchResult) []string {
+	if len(match.Names) == len(match.Sources) {
+		return match.Names
+	}
+	return match.Sources
+}
+
 func titleCase(value string) string {
 	if value == "" {
 		return ""
@@ -134,18 +149,29 @@ func titleCase(value string) string {
 	return strings.ToUpper(value[:1]) + strings.ToLower(value[1:])
 }
 
-// recordForwardedQuery increments the forwarded-query counter tagged with path/upstream metadata.
-func (h *Handler) recordForwardedQuery(ctx context.Context, path, qtypeLabel, upstream string) {
+// recordForwardedQuery increments the forwarded-query counter tagged with
+// path/upstream metadata and records the exchange time in the per-upstream
+// latency histogram.
+func (h *Handler) recordForwardedQuery(ctx context.Context, path, qtypeLabel, upstream string, elapsed time.Duration) {
 	m := h.getMetrics()
 	if m == nil {
 		return
 	}
+	upstream = m.UpstreamLabel(upstream)
+	if m.DNSUpstreamDuration != nil {
+		ms := float64(elapsed.Microseconds()) / 1000
+		if upstream != "" {
+			m.DNSUpstreamDuration.Record(ctx, ms, metric.WithAttributes(attribute.String("upstream", upstream)))
+		} else {
+			m.DNSUpstreamDuration.Record(ctx, ms)
+		}
+	}
 	attrs := make([]attribute.KeyValue, 0, 3)
 	if path != "" {
 		attrs = append(attrs, attribute.String("path", path))
 	}
 	if qtypeLabel != "" {
-		attrs = append(attrs, attribute.String("type", qtypeLabel))
+		attrs = append(attrs, attribute.String("type", m.QueryTypeLabel(qtypeLabel)))
 	}
 	if upstream != "" {
 		attrs = append(attrs, attribute.String("upstream", upstream))
@@ -156,3 +182,83 @@ func (h *Handler) recordForwardedQuery(ctx context.Context, path, qtypeLabel, up
 	}
 	m.DNSForwardedQueries.Add(ctx, 1, metric.WithAttributes(attrs...))
 }
+
+// logSlowQuery warns about a query that exceeded server.slow_query_threshold
+// and records dns.queries.slow tagged with the decision and upstream. The
+// warning is skipped while query logging is paused; the metric is not.
+func (h *Handler) logSlowQuery(ctx context.Context, r *dns.Msg, clientIP string, outcome *serveDNSOutcome, elapsed time.Duration, paused bool) {
+	domain, qtypeLabel := "", ""
+	if len(r.Question) > 0 {
+		domain = r.Question[0].Name
+		qtypeLabel = dnsTypeLabel(r.Question[0].Qtype)
+	}
+	decision := outcomeDecision(outcome)
+
+	if lg := h.getLogger(); lg != nil && !paused {
+		lg.Warn("Slow DNS query",
+			"domain", domain,
+			"type", qtypeLabel,
+			"client", clientIP,
+			"upstream", outcome.upstream,
+			"decision", decision,
+			"rcode", dns.RcodeToString[outcome.responseCode],
+			"duration_ms", float64(elapsed.Microseconds())/1000,
+			"upstream_ms", float64(outcome.upstreamDuration.Microseconds())/1000,
+		)
+	}
+
+	m := h.getMetrics()
+	if m == nil || m.DNSSlowQueries == nil {
+		return
+	}
+	attrs := make([]attribute.KeyValue, 0, 2)
+	attrs = append(attrs, attribute.String("decision", decision))
+	if upstream := m.UpstreamLabel(outcome.upstream); upstream != "" {
+		attrs = append(attrs, attribute.String("upstream", upstream))
+	}
+	m.DNSSlowQueries.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// reportAnomaly logs a detected anomaly, records dns.anomalies{kind}, and
+// passes it to the registered hook.
+func (h *Handler) reportAnomaly(a Anomaly) {
+	d := h.deps.Load()
+	if lg := d.logger; lg != nil {
+		lg.Warn("DNS query anomaly detected",
+			"kind", a.Kind,
+			"client", a.Client,
+			"domain", a.Domain,
+			"count", a.Count,
+			"threshold", a.Threshold,
+			"window", a.Window,
+		)
+	}
+	if m := d.metrics; m != nil && m.DNSAnomalies != nil {
+		m.DNSAnomalies.Add(context.Background(), 1, metric.WithAttributes(attribute.String("kind", a.Kind)))
+	}
+	if d.anomalyHook != nil {
+		d.anomalyHook(a)
+	}
+}
+
+// recordAnomalyPeaks publishes the busiest domain and client of the window
+// that just closed.
+func (h *Handler) recordAnomalyPeaks(domainQueries, clientDomains int) {
+	m := h.getMetrics()
+	if m == nil {
+		return
+	}
+	if m.DNSPeakDomainQueries != nil {
+		m.DNSPeakDomainQueries.Record(context.Background(), int64(domainQueries))
+	}
+	if m.DNSPeakClientDomains != nil {
+		m.DNSPeakClientDomains.Record(context.Background(), int64(clientDomains))
+	}
+}
+
+// recordRebindBlocked counts answers rewritten by rebind protection.
+func (h *Handler) recordRebindBlocked(ctx context.Context) {
+	if m := h.getMetrics(); m != nil && m.DNSRebindBlocked != nil {
+		m.DNSRebindBlocked.Add(ctx, 1)
+	}
+}
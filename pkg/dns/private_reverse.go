@@ -0,0 +1,177 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/policy"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStagePrivateReverse = "private_reverse"
+
+// reverseAddr parses a full in-addr.arpa or ip6.arpa name back into the
+// address it names. Partial (zone-level) names are not addresses.
+func reverseAddr(name string) (netip.Addr, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if rest, ok := strings.CutSuffix(name, ".in-addr.arpa"); ok {
+		labels := strings.Split(rest, ".")
+		if len(labels) != 4 {
+			return netip.Addr{}, false
+		}
+		var b [4]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return netip.Addr{}, false
+			}
+			b[3-i] = byte(n)
+		}
+		return netip.AddrFrom4(b), true
+	}
+	if rest, ok := strings.CutSuffix(name, ".ip6.arpa"); ok {
+		labels := strings.Split(rest, ".")
+		if len(labels) != 32 {
+			return netip.Addr{}, false
+		}
+		var b [16]byte
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return netip.Addr{}, false
+			}
+			nibble := 31 - i
+			b[nibble/2] |= byte(n) << (4 * (1 - nibble%2))
+		}
+		return netip.AddrFrom16(b), true
+	}
+	return netip.Addr{}, false
+}
+
+// isPrivateReverse reports whether a PTR name is the reverse of a private
+// (RFC 1918 / ULA), loopback or link-local address.
+func isPrivateReverse(name string) bool {
+	ip, ok := reverseAddr(name)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// policyForwards reports whether an enabled FORWARD rule matches the query,
+// which routes it internally and so takes precedence over the private
+// reverse handling. group is the client group assigned by a DoH token.
+func (h *Handler) policyForwards(d *handlerDeps, domain, clientIP, group, qtypeLabel string) bool {
+	return h.policyForwardRule(d, domain, clientIP, group, qtypeLabel) != nil
+}
+
+// policyForwardRule returns the enabled FORWARD rule matching the query, or
+// nil when the first match is another action or nothing matches.
+func (h *Handler) policyForwardRule(d *handlerDeps, domain, clientIP, group, qtypeLabel string) *policy.Rule {
+	enablePolicies, _ := h.resolveFeatureToggles(d)
+	pe := d.policyEngine
+	if !enablePolicies || pe == nil || pe.Count() == 0 {
+		return nil
+	}
+	policyCtx := policy.NewContext(strings.TrimSuffix(domain, "."), clientIP, qtypeLabel)
+	policyCtx.ClientGroup = group
+	matched, rule := pe.Match(policyCtx)
+	if !matched || rule == nil || rule.Action != policy.ActionForward {
+		return nil
+	}
+	return rule
+}
+
+// ExchangeInternal resolves a query the server makes on its own behalf
+// (client discovery PTR lookups) with the routing a client query gets: a
+// matching policy FORWARD rule first, then server.private_reverse for
+// private reverse names, which never reach the default upstreams unless
+// configured to, then the default upstreams.
+func (h *Handler) ExchangeInternal(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	d := h.deps.Load()
+	if d.fwd == nil {
+		return nil, errors.New("no forwarder configured")
+	}
+	if len(m.Question) == 0 {
+		return d.fwd.Forward(ctx, m)
+	}
+	q := m.Question[0]
+
+	if rule := h.policyForwardRule(d, q.Name, "", "", dnsTypeLabel(q.Qtype)); rule != nil {
+		if upstreams := rule.GetUpstreams(); len(upstreams) > 0 {
+			return d.fwd.ForwardWithUpstreams(ctx, m, upstreams)
+		}
+	}
+
+	if pr := d.privateReverse; q.Qtype == dns.TypePTR && pr.Mode != "" && pr.Mode != config.PrivateReverseForward && isPrivateReverse(q.Name) {
+		if pr.Mode == config.PrivateReverseUpstream && len(pr.Upstreams) > 0 {
+			return d.fwd.ForwardWithUpstreams(ctx, m, pr.Upstreams)
+		}
+		resp := new(dns.Msg)
+		resp.SetRcode(m, dns.RcodeNameError)
+		return resp, nil
+	}
+
+	return d.fwd.Forward(ctx, m)
+}
+
+// servePrivateReverse handles PTR queries for private ranges according to
+// server.private_reverse: "local" answers NXDOMAIN, "upstream" asks the
+// configured internal resolvers. Local PTR records were already tried, and a
+// matching policy FORWARD rule wins over both. Returns false in forward mode.
+func (h *Handler) servePrivateReverse(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, domain, clientIP, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	d := h.deps.Load()
+	cfg := d.privateReverse
+	if cfg.Mode == "" || cfg.Mode == config.PrivateReverseForward || !isPrivateReverse(domain) {
+		return false
+	}
+	if h.policyForwards(d, domain, clientIP, clientGroupFrom(ctx), qtypeLabel) {
+		return false
+	}
+
+	if cfg.Mode == config.PrivateReverseLocal || d.fwd == nil || len(cfg.Upstreams) == 0 {
+		trace.Record(traceStagePrivateReverse, "local_answer", func(entry *storage.BlockTraceEntry) {
+			entry.Source = "private_reverse"
+			entry.Detail = "reverse lookup for a private address is not forwarded upstream"
+		})
+		msg.SetRcode(r, dns.RcodeNameError)
+		outcome.responseCode = dns.RcodeNameError
+		h.writeMsg(w, r, msg)
+		return true
+	}
+
+	trace.Record(traceStagePrivateReverse, "forward", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "private_reverse"
+		entry.Detail = "reverse lookup for a private address sent to internal upstreams"
+		entry.Metadata = map[string]string{"upstreams": strings.Join(cfg.Upstreams, ",")}
+	})
+	var answered forwarder.Answered
+	forwardStart := time.Now()
+	resp, err := d.fwd.ForwardWithUpstreams(forwarder.WithAnswered(ctx, &answered), r, cfg.Upstreams)
+	outcome.upstreamDuration = time.Since(forwardStart)
+	if err != nil {
+		if lg := d.logger; lg != nil {
+			lg.Warn("Private reverse lookup failed", "domain", domain, "upstreams", cfg.Upstreams, "error", err)
+		}
+		msg.SetRcode(r, dns.RcodeServerFailure)
+		outcome.responseCode = dns.RcodeServerFailure
+		h.attachForwardFailureEDE(msg, err)
+		h.writeMsg(w, r, msg)
+		return true
+	}
+
+	outcome.upstream = answered.Upstream
+	h.recordForwardedQuery(ctx, "private_reverse", qtypeLabel, outcome.upstream, outcome.upstreamDuration)
+	outcome.responseCode = resp.Rcode
+	h.writeMsg(w, r, resp)
+	return true
+}
@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/logging"
+	"glory-hole/pkg/policy"
+
+	"github.com/miekg/dns"
+)
+
+func reverse(t *testing.T, ip string) string {
+	t.Helper()
+	name, err := dns.ReverseAddr(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestReverseAddr(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		private bool
+	}{
+		{"1.1.168.192.in-addr.arpa.", "192.168.1.1", true},
+		{"5.0.0.10.IN-ADDR.ARPA.", "10.0.0.5", true},
+		{"1.0.0.127.in-addr.arpa.", "127.0.0.1", true},
+		{"1.0.16.172.in-addr.arpa.", "172.16.0.1", true},
+		{"8.8.8.8.in-addr.arpa.", "8.8.8.8", false},
+		{reverse(t, "fd00::1"), "fd00::1", true},
+		{reverse(t, "2606:4700::1111"), "2606:4700::1111", false},
+		{"168.192.in-addr.arpa.", "", false},
+		{"300.1.168.192.in-addr.arpa.", "", false},
+		{"example.com.", "", false},
+	}
+	for _, tt := range tests {
+		ip, ok := reverseAddr(tt.name)
+		if got := ""; ok {
+			got = ip.String()
+			if got != tt.want {
+				t.Errorf("reverseAddr(%q) = %s, want %s", tt.name, got, tt.want)
+			}
+		} else if tt.want != "" {
+			t.Errorf("reverseAddr(%q) failed, want %s", tt.name, tt.want)
+		}
+		if got := isPrivateReverse(tt.name); got != tt.private {
+			t.Errorf("isPrivateReverse(%q) = %v, want %v", tt.name, got, tt.private)
+		}
+	}
+}
+
+func TestServeDNS_PrivateReverse(t *testing.T) {
+	public, publicSeen := startCountingUpstream(t)
+	internal, internalSeen := startCountingUpstream(t)
+	cfg := &config.Config{UpstreamDNSServers: []string{public}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewPTRRecord("5.1.168.192.in-addr.arpa.", "nas.lan.")); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+
+	query := func(name string) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypePTR)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	t.Run("forward is the default", func(t *testing.T) {
+		query("9.1.168.192.in-addr.arpa.")
+		if publicSeen("PTR") != 1 {
+			t.Errorf("expected the private PTR to reach the default upstream, got %d queries", publicSeen("PTR"))
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseLocal})
+		before := publicSeen("PTR")
+
+		if resp := query("9.1.168.192.in-addr.arpa."); resp.Rcode != dns.RcodeNameError {
+			t.Errorf("expected NXDOMAIN, got %s", dns.RcodeToString[resp.Rcode])
+		}
+		if resp := query("5.1.168.192.in-addr.arpa."); len(resp.Answer) != 1 {
+			t.Errorf("local PTR record should still answer, got %d answers", len(resp.Answer))
+		}
+		query("8.8.8.8.in-addr.arpa.")
+		if got := publicSeen("PTR") - before; got != 1 {
+			t.Errorf("only the public PTR should be forwarded, got %d", got)
+		}
+	})
+
+	t.Run("upstream", func(t *testing.T) {
+		h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseUpstream, Upstreams: []string{internal}})
+		before := publicSeen("PTR")
+
+		if resp := query("9.1.168.192.in-addr.arpa."); resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("expected the internal upstream's answer, got %s", dns.RcodeToString[resp.Rcode])
+		}
+		if internalSeen("PTR") != 1 || publicSeen("PTR") != before {
+			t.Errorf("internal = %d, public = %d new; want 1 and 0", internalSeen("PTR"), publicSeen("PTR")-before)
+		}
+	})
+
+	t.Run("policy FORWARD takes precedence", func(t *testing.T) {
+		h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseLocal})
+		engine := policy.NewEngine(nil)
+		if err := engine.AddRule(&policy.Rule{Name: "lan-ptr", Logic: `DomainEndsWith(Domain, "168.192.in-addr.arpa")`, Action: policy.ActionForward, ActionData: internal, Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+		h.SetPolicyEngine(engine)
+		before := internalSeen("PTR")
+
+		if resp := query("9.1.168.192.in-addr.arpa."); resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("expected the FORWARD rule's answer, got %s", dns.RcodeToString[resp.Rcode])
+		}
+		if internalSeen("PTR") != before+1 {
+			t.Error("policy FORWARD rule should route the query internally")
+		}
+		if dec := h.Explain(context.Background(), "10.1.168.192.in-addr.arpa", "192.168.1.10", dns.TypePTR); dec.Stage != traceStagePolicy {
+			t.Errorf("Explain stage = %q, want policy", dec.Stage)
+		}
+	})
+}
+
+func TestExchangeInternal_RoutesLikeClientQueries(t *testing.T) {
+	public, publicSeen := startCountingUpstream(t)
+	internal, internalSeen := startCountingUpstream(t)
+	cfg := &config.Config{UpstreamDNSServers: []string{public}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	exchange := func(name string) *dns.Msg {
+		t.Helper()
+		m := new(dns.Msg)
+		m.SetQuestion(name, dns.TypePTR)
+		resp, err := h.ExchangeInternal(context.Background(), m)
+		if err != nil {
+			t.Fatalf("ExchangeInternal(%s): %v", name, err)
+		}
+		return resp
+	}
+
+	h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseLocal})
+	if resp := exchange("9.1.168.192.in-addr.arpa."); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("private PTR in local mode: got %s, want NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+	if publicSeen("PTR") != 0 {
+		t.Error("private PTR in local mode reached the default upstream")
+	}
+
+	h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseUpstream, Upstreams: []string{internal}})
+	exchange("9.1.168.192.in-addr.arpa.")
+	if internalSeen("PTR") != 1 || publicSeen("PTR") != 0 {
+		t.Errorf("internal = %d, public = %d; want 1 and 0", internalSeen("PTR"), publicSeen("PTR"))
+	}
+
+	h.SetPrivateReverse(config.PrivateReverseConfig{Mode: config.PrivateReverseLocal})
+	engine := policy.NewEngine(nil)
+	if err := engine.AddRule(&policy.Rule{Name: "lan-ptr", Logic: `DomainEndsWith(Domain, "168.192.in-addr.arpa")`, Action: policy.ActionForward, ActionData: internal, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	h.SetPolicyEngine(engine)
+	exchange("9.1.168.192.in-addr.arpa.")
+	if internalSeen("PTR") != 2 {
+		t.Error("policy FORWARD rule should win over private_reverse")
+	}
+
+	exchange("8.8.8.8.in-addr.arpa.")
+	if publicSeen("PTR") != 1 {
+		t.Errorf("public PTR should use the default upstream, got %d", publicSeen("PTR"))
+	}
+}
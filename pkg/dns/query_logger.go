@@ -3,13 +3,18 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"glory-hole/pkg/logging"
 	"glory-hole/pkg/storage"
 )
 
+// ErrQueryLoggerClosed is returned by LogAsync after Close.
+var ErrQueryLoggerClosed = errors.New("query logger closed")
+
 // QueryLogger manages a worker pool for asynchronous query logging
 // This prevents spawning a new goroutine for every DNS query
 type QueryLogger struct {
@@ -21,8 +26,14 @@ type QueryLogger struct {
 	storage   storage.Storage
 	logger    *logging.Logger
 	dropped   atomic.Uint64
+	dropWarn  *storage.DropWarner
 	buffered  atomic.Uint64
 	closeOnce sync.Once
+
+	// closeMu orders LogAsync against Close so a late query can't send on
+	// the closed channel.
+	closeMu sync.RWMutex
+	closed  bool
 }
 
 // NewQueryLogger creates a new query logger with a fixed worker pool
@@ -30,12 +41,13 @@ func NewQueryLogger(stor storage.Storage, logger *logging.Logger, bufferSize, wo
 	ctx, cancel := context.WithCancel(context.Background())
 
 	ql := &QueryLogger{
-		logCh:   make(chan *storage.QueryLog, bufferSize),
-		workers: workers,
-		ctx:     ctx,
-		cancel:  cancel,
-		storage: stor,
-		logger:  logger,
+		logCh:    make(chan *storage.QueryLog, bufferSize),
+		workers:  workers,
+		ctx:      ctx,
+		cancel:   cancel,
+		storage:  stor,
+		logger:   logger,
+		dropWarn: storage.NewDropWarner(storage.DropWarnInterval),
 	}
 
 	// Start worker pool
@@ -66,7 +78,8 @@ func (ql *QueryLogger) worker(id int) {
 		// be canceled during shutdown, but we still want to flush entries.
 		logCtx, cancel := context.WithTimeout(context.Background(), storage.DefaultLogTimeout)
 
-		if err := ql.storage.LogQuery(logCtx, entry); err != nil {
+		// Full-buffer drops are counted and logged, rate limited, by storage.
+		if err := ql.storage.LogQuery(logCtx, entry); err != nil && !errors.Is(err, storage.ErrBufferFull) {
 			if ql.logger != nil {
 				ql.logger.Error("Failed to log query",
 					"worker", id,
@@ -83,19 +96,26 @@ func (ql *QueryLogger) worker(id int) {
 // LogAsync queues a query log entry for async processing
 // Returns error if buffer is full (non-blocking)
 func (ql *QueryLogger) LogAsync(entry *storage.QueryLog) error {
+	ql.closeMu.RLock()
+	defer ql.closeMu.RUnlock()
+	if ql.closed {
+		ql.dropped.Add(1)
+		return ErrQueryLoggerClosed
+	}
+
 	select {
 	case ql.logCh <- entry:
 		ql.buffered.Add(1)
 		return nil
 	default:
 		// Buffer full - drop query and increment counter
-		ql.dropped.Add(1)
+		total := ql.dropped.Add(1)
 
-		if ql.logger != nil {
-			ql.logger.Warn("Query log buffer full, dropping entry",
-				"domain", entry.Domain,
-				"client_ip", entry.ClientIP,
-				"dropped_total", ql.dropped.Load())
+		if n := ql.dropWarn.Drop(time.Now()); n > 0 && ql.logger != nil {
+			ql.logger.Warn("Query log buffer full, dropping entries",
+				"dropped", n,
+				"dropped_total", total,
+				"last_domain", entry.Domain)
 		}
 
 		return storage.ErrBufferFull
@@ -121,7 +141,10 @@ func (ql *QueryLogger) Close() error {
 		// Close channel first — workers drain remaining entries via range,
 		// then exit. This guarantees no entries are stranded between
 		// cancel() and close() (the previous ordering bug).
+		ql.closeMu.Lock()
+		ql.closed = true
 		close(ql.logCh)
+		ql.closeMu.Unlock()
 
 		// Wait for all workers to finish draining
 		ql.wg.Wait()
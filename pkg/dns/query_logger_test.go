@@ -3,12 +3,15 @@ package dns
 import (
 	"context"
 	"errors"
+	"net"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
 )
 
 // mockStorage implements storage.Storage for testing
@@ -54,6 +57,9 @@ func (m *mockStorage) Count() int64 {
 func (m *mockStorage) GetRecentQueries(ctx context.Context, limit, offset int) ([]*storage.QueryLog, error) {
 	return nil, nil
 }
+func (m *mockStorage) GetRecentBlocked(ctx context.Context, limit, offset int) ([]*storage.QueryLog, error) {
+	return nil, nil
+}
 func (m *mockStorage) GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*storage.QueryLog, error) {
 	return nil, nil
 }
@@ -63,12 +69,18 @@ func (m *mockStorage) GetQueriesByClientIP(ctx context.Context, clientIP string,
 func (m *mockStorage) GetQueriesFiltered(ctx context.Context, filter storage.QueryFilter, limit, offset int) ([]*storage.QueryLog, error) {
 	return nil, nil
 }
+func (m *mockStorage) CountQueriesFiltered(ctx context.Context, filter storage.QueryFilter, limit int) (int64, error) {
+	return 0, nil
+}
 func (m *mockStorage) GetStatistics(ctx context.Context, since time.Time) (*storage.Statistics, error) {
 	return nil, nil
 }
 func (m *mockStorage) GetTopDomains(ctx context.Context, limit int, blocked bool, since time.Time) ([]*storage.DomainStats, error) {
 	return nil, nil
 }
+func (m *mockStorage) CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error) {
+	return 0, nil
+}
 func (m *mockStorage) GetBlockedCount(ctx context.Context, since time.Time) (int64, error) {
 	return 0, nil
 }
@@ -78,6 +90,12 @@ func (m *mockStorage) GetQueryCount(ctx context.Context, since time.Time) (int64
 func (m *mockStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
 	return nil, nil
 }
+func (m *mockStorage) GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	return nil, nil
+}
+func (m *mockStorage) GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*storage.TimeSeriesPoint, error) {
+	return nil, nil
+}
 func (m *mockStorage) GetQueryTypeStats(ctx context.Context, limit int, since time.Time) ([]*storage.QueryTypeStats, error) {
 	return nil, nil
 }
@@ -91,9 +109,20 @@ func (m *mockStorage) ListClientProfiles(ctx context.Context) ([]*storage.Client
 	return nil, nil
 }
 
-func (m *mockStorage) GetClientSummaries(ctx context.Context, limit, offset int) ([]*storage.ClientSummary, error) {
+func (m *mockStorage) GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*storage.ClientSummary, error) {
+	return nil, nil
+}
+func (m *mockStorage) CountClientSummaries(ctx context.Context, since time.Time) (int64, error) {
+	return 0, nil
+}
+func (m *mockStorage) SetClientHostname(ctx context.Context, clientIP, hostname string) error {
+	return nil
+}
+
+func (m *mockStorage) ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error) {
 	return nil, nil
 }
+
 func (m *mockStorage) UpdateClientProfile(ctx context.Context, profile *storage.ClientProfile) error {
 	return nil
 }
@@ -283,6 +312,20 @@ func TestQueryLogger_GracefulShutdown(t *testing.T) {
 	}
 }
 
+func TestQueryLogger_LogAfterClose(t *testing.T) {
+	stor := newMockStorage()
+	ql := NewQueryLogger(stor, nil, 10, 1)
+	_ = ql.Close()
+
+	// A query finishing after shutdown must not panic on the closed channel.
+	if err := ql.LogAsync(&storage.QueryLog{Domain: "late.example.com"}); !errors.Is(err, ErrQueryLoggerClosed) {
+		t.Errorf("expected ErrQueryLoggerClosed, got %v", err)
+	}
+	if _, dropped := ql.Stats(); dropped != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", dropped)
+	}
+}
+
 func TestQueryLogger_StorageError(t *testing.T) {
 	stor := newMockStorage()
 	stor.failCount = 5 // First 5 attempts will fail
@@ -409,3 +452,127 @@ func BenchmarkQueryLogger_vs_Goroutine(b *testing.B) {
 		}
 	})
 }
+
+func TestHandler_QueryLogSampling(t *testing.T) {
+	stor := newMockStorage()
+	h := NewHandler()
+	h.Blocklist["blocked.example.com."] = struct{}{}
+	h.SetQueryLogger(NewQueryLogger(stor, nil, 5000, 2))
+	h.SetQueryLogSampleRate(0.05)
+
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+	serve := func(name string, n int) {
+		for i := 0; i < n; i++ {
+			r := new(dns.Msg)
+			r.SetQuestion(name, dns.TypeA)
+			h.ServeDNS(context.Background(), w, r)
+		}
+	}
+	serve("blocked.example.com.", 100)
+	serve("allowed.example.com.", 2000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	stor.mu.Lock()
+	defer stor.mu.Unlock()
+	var blocked, allowed int
+	for _, entry := range stor.logs {
+		if entry.Blocked {
+			blocked++
+		} else {
+			allowed++
+		}
+	}
+	if blocked != 100 {
+		t.Errorf("expected every blocked query logged, got %d/100", blocked)
+	}
+	// Expect ~100 of 2000; the bounds are many standard deviations wide.
+	if allowed == 0 || allowed > 300 {
+		t.Errorf("expected about 5%% of allowed queries logged, got %d/2000", allowed)
+	}
+}
+
+func TestSampleQueryLog(t *testing.T) {
+	for _, rate := range []float64{0, 1} {
+		for i := 0; i < 100; i++ {
+			if !sampleQueryLog(rate) {
+				t.Fatalf("rate %v should log every query", rate)
+			}
+		}
+	}
+}
+
+// pausedSwitch is a kill switch that only pauses query logging.
+type pausedSwitch struct{ paused bool }
+
+func (pausedSwitch) IsBlocklistDisabled() (bool, time.Time) { return false, time.Time{} }
+func (pausedSwitch) IsPoliciesDisabled() (bool, time.Time)  { return false, time.Time{} }
+func (p pausedSwitch) IsLoggingPaused() (bool, time.Time) {
+	return p.paused, time.Time{}
+}
+
+func TestHandler_QueryLogPaused(t *testing.T) {
+	stor := newMockStorage()
+	h := NewHandler()
+	h.Blocklist["blocked.example.com."] = struct{}{}
+	h.SetQueryLogger(NewQueryLogger(stor, nil, 100, 1))
+
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+	serve := func(name string) {
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+	}
+
+	h.SetKillSwitch(pausedSwitch{paused: true})
+	serve("blocked.example.com.")
+	h.SetKillSwitch(pausedSwitch{})
+	serve("blocked.example.com.")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	stor.mu.Lock()
+	defer stor.mu.Unlock()
+	if len(stor.logs) != 1 {
+		t.Errorf("expected only the query after resume logged, got %d entries", len(stor.logs))
+	}
+}
+
+func TestHandler_QueryLogDomainCase(t *testing.T) {
+	for _, preserve := range []bool{false, true} {
+		stor := newMockStorage()
+		h := NewHandler()
+		h.Blocklist["ads.example.com."] = struct{}{}
+		h.SetQueryLogger(NewQueryLogger(stor, nil, 100, 1))
+		h.SetQueryLogPreserveCase(preserve)
+
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion("aDs.ExAmple.COM.", dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := h.Drain(ctx); err != nil {
+			t.Fatalf("Drain: %v", err)
+		}
+		cancel()
+
+		want := "ads.example.com"
+		if preserve {
+			want = "aDs.ExAmple.COM"
+		}
+		stor.mu.Lock()
+		if len(stor.logs) != 1 || stor.logs[0].Domain != want {
+			t.Errorf("preserve=%v: logged %+v, want domain %q", preserve, stor.logs, want)
+		}
+		stor.mu.Unlock()
+	}
+}
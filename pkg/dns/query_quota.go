@@ -0,0 +1,197 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/policy"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageQueryQuota = "query_quota"
+
+// maxQuotaClients bounds the per-day counter table. Once it is full, clients
+// not yet seen that day are not counted (and so never refused) until midnight.
+const maxQuotaClients = 65_536
+
+// quotaShards splits the counter table so queries from different clients
+// rarely contend on one lock. A client always maps to the same shard.
+const quotaShards = 32
+
+// queryQuota counts queries per client per local calendar day and reports
+// clients that go over their daily limit.
+type queryQuota struct {
+	settings  atomic.Pointer[quotaSettings]
+	inGroup   func(clientIP, group string) bool
+	groupsGen func() uint64
+	shards    [quotaShards]quotaShard
+}
+
+// quotaSettings is one generation of the config. Limits cached under an
+// older generation are resolved again.
+type quotaSettings struct {
+	cfg config.QueryQuotaConfig
+	gen uint64
+}
+
+type quotaShard struct {
+	mu      sync.Mutex
+	day     int // yyyymmdd of the day being counted
+	clients map[string]*quotaClient
+}
+
+// quotaClient is one client's count for the day and its resolved limit,
+// cached until the config, client group membership or assigned group
+// changes.
+type quotaClient struct {
+	count    int
+	limit    int
+	assigned string
+	cfgGen   uint64
+	groupGen uint64
+}
+
+func newQueryQuota(cfg config.QueryQuotaConfig) *queryQuota {
+	q := &queryQuota{
+		inGroup:   policy.InClientGroup,
+		groupsGen: policy.ClientGroupsGeneration,
+	}
+	q.settings.Store(&quotaSettings{cfg: cfg})
+	for i := range q.shards {
+		q.shards[i].clients = make(map[string]*quotaClient)
+	}
+	return q
+}
+
+// setConfig swaps the limits in place so a config reload keeps today's counts.
+func (q *queryQuota) setConfig(cfg config.QueryQuotaConfig) {
+	q.settings.Store(&quotaSettings{cfg: cfg, gen: q.settings.Load().gen + 1})
+}
+
+// limitFor returns the daily limit that applies to clientIP, which assigned
+// (a DoH token's group) also places in a group: the highest limit among its
+// client groups, else the global daily_limit. 0 = unlimited.
+func (q *queryQuota) limitFor(cfg config.QueryQuotaConfig, clientIP, assigned string) int {
+	limit, grouped := 0, false
+	for group, groupLimit := range cfg.Groups {
+		if group != assigned && !q.inGroup(clientIP, group) {
+			continue
+		}
+		if groupLimit == 0 {
+			return 0
+		}
+		if !grouped || groupLimit > limit {
+			limit, grouped = groupLimit, true
+		}
+	}
+	if grouped {
+		return limit
+	}
+	return cfg.DailyLimit
+}
+
+// observe counts one query from clientIP, with assigned the client group
+// from a DoH token (empty for none). exceeded is true when the client is
+// over its limit; first is true only for the query that crossed it, so the
+// caller alerts once per client per day.
+func (q *queryQuota) observe(now time.Time, clientIP, assigned string) (count, limit int, exceeded, first bool) {
+	y, m, dd := now.Date()
+	today := y*10000 + int(m)*100 + dd
+	settings := q.settings.Load()
+	groupGen := q.groupsGen()
+
+	s := &q.shards[quotaShardFor(clientIP)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if today != s.day {
+		s.day = today
+		clear(s.clients)
+	}
+	c := s.clients[clientIP]
+	if c == nil {
+		limit = q.limitFor(settings.cfg, clientIP, assigned)
+		if len(s.clients) >= maxQuotaClients/quotaShards {
+			return 0, limit, false, false
+		}
+		c = &quotaClient{limit: limit, assigned: assigned, cfgGen: settings.gen, groupGen: groupGen}
+		s.clients[clientIP] = c
+	} else if c.cfgGen != settings.gen || c.groupGen != groupGen || c.assigned != assigned {
+		c.limit = q.limitFor(settings.cfg, clientIP, assigned)
+		c.assigned, c.cfgGen, c.groupGen = assigned, settings.gen, groupGen
+	}
+	if c.limit <= 0 {
+		return 0, 0, false, false
+	}
+	c.count++
+	return c.count, c.limit, c.count > c.limit, c.count == c.limit+1
+}
+
+// quotaShardFor hashes clientIP (FNV-1a) to its shard without allocating.
+func quotaShardFor(clientIP string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(clientIP); i++ {
+		h ^= uint32(clientIP[i])
+		h *= 16777619
+	}
+	return int(h % quotaShards)
+}
+
+// action returns the configured answer for over-quota queries.
+func (q *queryQuota) action() string {
+	return q.settings.Load().cfg.Action
+}
+
+// serveQuotaExceeded answers a client that has used up its daily query
+// quota with server.query_quota.action: REFUSED by default, NXDOMAIN, no
+// response at all, or an empty truncated answer that sends a UDP client to
+// TCP. The first refusal of the day is logged at WARN.
+func (h *Handler) serveQuotaExceeded(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, clientIP string, count, limit int, first bool, trace *blockTraceRecorder, outcome *serveDNSOutcome) {
+	d := h.deps.Load()
+	if first {
+		if lg := d.logger; lg != nil {
+			lg.Warn("Client exceeded daily query quota; refusing further queries until midnight",
+				"client", clientIP,
+				"count", count,
+				"limit", limit,
+			)
+		}
+	}
+	if m := d.metrics; m != nil && m.DNSQuotaRefused != nil {
+		m.DNSQuotaRefused.Add(ctx, 1)
+	}
+	action := config.QuotaActionRefused
+	if q := d.quota; q != nil {
+		if a := q.action(); a != "" {
+			action = a
+		}
+	}
+	// TC over TCP would send the client straight back; refuse instead
+	if action == config.QuotaActionTruncate && !isUDP(w) {
+		action = config.QuotaActionRefused
+	}
+	trace.Record(traceStageQueryQuota, action, func(entry *storage.BlockTraceEntry) {
+		entry.Source = "query_quota"
+		entry.Detail = "client exceeded its daily query quota"
+	})
+
+	switch action {
+	case config.QuotaActionDrop:
+		// No response; the query log still records it as refused
+		outcome.responseCode = dns.RcodeRefused
+		return
+	case config.QuotaActionNXDomain:
+		msg.SetRcode(r, dns.RcodeNameError)
+	case config.QuotaActionTruncate:
+		msg.SetRcode(r, dns.RcodeSuccess)
+		msg.Truncated = true
+	default:
+		msg.SetRcode(r, dns.RcodeRefused)
+	}
+	outcome.responseCode = msg.Rcode
+	h.writeMsg(w, r, msg)
+}
@@ -0,0 +1,199 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/localrecords"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryQuota_ResetsAtMidnight(t *testing.T) {
+	q := newQueryQuota(config.QueryQuotaConfig{Enabled: true, DailyLimit: 2})
+	day := time.Date(2026, 3, 14, 23, 59, 0, 0, time.Local)
+
+	for i := 0; i < 2; i++ {
+		if _, _, exceeded, _ := q.observe(day, "10.0.0.1", ""); exceeded {
+			t.Fatalf("query %d should be within the quota", i+1)
+		}
+	}
+	if _, _, exceeded, first := q.observe(day, "10.0.0.1", ""); !exceeded || !first {
+		t.Fatalf("third query: exceeded=%v first=%v, want both true", exceeded, first)
+	}
+	if _, _, exceeded, first := q.observe(day, "10.0.0.1", ""); !exceeded || first {
+		t.Fatalf("fourth query: exceeded=%v first=%v, want alert only once", exceeded, first)
+	}
+	if _, _, exceeded, _ := q.observe(day, "10.0.0.2", ""); exceeded {
+		t.Fatal("quota is per client")
+	}
+	if _, _, exceeded, _ := q.observe(day.Add(2*time.Minute), "10.0.0.1", ""); exceeded {
+		t.Fatal("counts should reset on the next day")
+	}
+}
+
+func TestQueryQuota_GroupLimits(t *testing.T) {
+	groups := map[string]map[string]bool{
+		"10.0.0.5": {"iot": true},
+		"10.0.0.6": {"iot": true, "admins": true},
+	}
+	q := newQueryQuota(config.QueryQuotaConfig{
+		Enabled:    true,
+		DailyLimit: 100,
+		Groups:     map[string]int{"iot": 5, "admins": 0},
+	})
+	q.inGroup = func(ip, group string) bool { return groups[ip][group] }
+
+	cfg := q.settings.Load().cfg
+	if got := q.limitFor(cfg, "10.0.0.1", ""); got != 100 {
+		t.Errorf("ungrouped client limit = %d, want 100", got)
+	}
+	if got := q.limitFor(cfg, "10.0.0.5", ""); got != 5 {
+		t.Errorf("iot client limit = %d, want 5", got)
+	}
+	if got := q.limitFor(cfg, "10.0.0.6", ""); got != 0 {
+		t.Errorf("client in an unlimited group: limit = %d, want 0 (unlimited)", got)
+	}
+	if got := q.limitFor(cfg, "10.0.0.1", "iot"); got != 5 {
+		t.Errorf("client assigned iot by a DoH token: limit = %d, want 5", got)
+	}
+}
+
+func TestQueryQuota_GroupChangeResolvesLimitAgain(t *testing.T) {
+	groups := map[string]map[string]bool{"10.0.0.5": {"iot": true}}
+	var gen uint64
+	q := newQueryQuota(config.QueryQuotaConfig{
+		Enabled:    true,
+		DailyLimit: 100,
+		Groups:     map[string]int{"iot": 1},
+	})
+	q.inGroup = func(ip, group string) bool { return groups[ip][group] }
+	q.groupsGen = func() uint64 { return gen }
+	day := time.Date(2026, 3, 14, 12, 0, 0, 0, time.Local)
+
+	q.observe(day, "10.0.0.5", "")
+	if _, limit, exceeded, _ := q.observe(day, "10.0.0.5", ""); !exceeded || limit != 1 {
+		t.Fatalf("iot client: limit=%d exceeded=%v, want 1 and true", limit, exceeded)
+	}
+
+	// The cached limit holds until the membership generation moves
+	delete(groups, "10.0.0.5")
+	if _, _, exceeded, _ := q.observe(day, "10.0.0.5", ""); !exceeded {
+		t.Fatal("limit should stay cached while the generation is unchanged")
+	}
+	gen++
+	if count, limit, exceeded, _ := q.observe(day, "10.0.0.5", ""); exceeded || limit != 100 || count != 4 {
+		t.Fatalf("after leaving the group: count=%d limit=%d exceeded=%v, want 4, 100, false", count, limit, exceeded)
+	}
+}
+
+func TestServeDNS_QueryQuota(t *testing.T) {
+	h := NewHandler()
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewARecord("nas.lan.", net.ParseIP("192.168.1.2"))); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+	h.SetQueryQuota(config.QueryQuotaConfig{Enabled: true, DailyLimit: 2})
+
+	query := func() *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion("nas.lan.", dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := query(); resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("query %d: rcode %s, want NOERROR", i+1, dns.RcodeToString[resp.Rcode])
+		}
+	}
+	if resp := query(); resp.Rcode != dns.RcodeRefused {
+		t.Fatalf("over quota: rcode %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Raising the limit on reload keeps today's count.
+	h.SetQueryQuota(config.QueryQuotaConfig{Enabled: true, DailyLimit: 4})
+	if resp := query(); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("after raising the limit: rcode %s, want NOERROR", dns.RcodeToString[resp.Rcode])
+	}
+	if resp := query(); resp.Rcode != dns.RcodeRefused {
+		t.Fatalf("counts should carry over a reload: rcode %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+	}
+
+	h.SetQueryQuota(config.QueryQuotaConfig{})
+	if resp := query(); resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("quota disabled: rcode %s, want NOERROR", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestServeDNS_QueryQuotaActions(t *testing.T) {
+	tests := []struct {
+		action    string
+		udp       bool
+		wantReply bool
+		rcode     int
+		truncated bool
+	}{
+		{action: "", udp: true, wantReply: true, rcode: dns.RcodeRefused},
+		{action: config.QuotaActionRefused, udp: true, wantReply: true, rcode: dns.RcodeRefused},
+		{action: config.QuotaActionNXDomain, udp: true, wantReply: true, rcode: dns.RcodeNameError},
+		{action: config.QuotaActionDrop, udp: true},
+		{action: config.QuotaActionTruncate, udp: true, wantReply: true, rcode: dns.RcodeSuccess, truncated: true},
+		{action: config.QuotaActionTruncate, udp: false, wantReply: true, rcode: dns.RcodeRefused},
+	}
+	for _, tt := range tests {
+		name := tt.action
+		if name == "" {
+			name = "default"
+		}
+		if !tt.udp {
+			name += "/tcp"
+		}
+		t.Run(name, func(t *testing.T) {
+			h := NewHandler()
+			h.SetQueryQuota(config.QueryQuotaConfig{Enabled: true, DailyLimit: 1, Action: tt.action})
+
+			query := func() *mockResponseWriter {
+				mock := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+				var w dns.ResponseWriter = mock
+				if tt.udp {
+					w = &udpResponseWriter{mock}
+				}
+				r := new(dns.Msg)
+				r.SetQuestion("example.com.", dns.TypeA)
+				h.ServeDNS(context.Background(), w, r)
+				return mock
+			}
+
+			query() // within quota
+			resp := query().msg
+			if !tt.wantReply {
+				if resp != nil {
+					t.Fatalf("expected no response, got %s", dns.RcodeToString[resp.Rcode])
+				}
+				return
+			}
+			if resp == nil {
+				t.Fatal("no response")
+			}
+			if resp.Rcode != tt.rcode {
+				t.Errorf("rcode %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.rcode])
+			}
+			if resp.Truncated != tt.truncated {
+				t.Errorf("TC = %v, want %v", resp.Truncated, tt.truncated)
+			}
+			if len(resp.Answer) != 0 {
+				t.Errorf("expected an empty answer section, got %d records", len(resp.Answer))
+			}
+		})
+	}
+}
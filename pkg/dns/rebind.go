@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/pattern"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageRebind = "rebind_protection"
+
+// localZones are always allowed to resolve to private addresses: they are
+// LAN-only names by definition (RFC 6762, RFC 8375, RFC 6761).
+var localZones = []string{"localhost", "local", "lan", "home.arpa", "internal", "in-addr.arpa", "ip6.arpa"}
+
+// rebindGuard strips private, loopback, link-local and unspecified addresses
+// from upstream answers for public names, so a hostile domain can't rebind to
+// a LAN device. Policy FORWARD responses are exempt: those rules exist to send
+// internal zones to internal resolvers.
+type rebindGuard struct {
+	allowed []string // normalized names; each also covers its subdomains
+}
+
+func newRebindGuard(cfg config.RebindProtectionConfig) *rebindGuard {
+	g := &rebindGuard{allowed: make([]string, 0, len(localZones)+len(cfg.AllowedDomains))}
+	g.allowed = append(g.allowed, localZones...)
+	for _, d := range cfg.AllowedDomains {
+		if n := pattern.NormalizeDomain(strings.TrimPrefix(d, "*.")); n != "" {
+			g.allowed = append(g.allowed, n)
+		}
+	}
+	return g
+}
+
+// allows reports whether domain may resolve to private addresses.
+func (g *rebindGuard) allows(domain string) bool {
+	name := pattern.NormalizeDomain(domain)
+	if !strings.Contains(name, ".") {
+		return true // single-label names only resolve via search domains on the LAN
+	}
+	for _, zone := range g.allowed {
+		if inZone(name, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns resp with rebinding addresses removed, and the removed
+// addresses. When nothing public is left the response becomes NXDOMAIN so
+// clients don't fall back to a cached private answer. resp is not modified.
+func (g *rebindGuard) filter(resp *dns.Msg) (*dns.Msg, []string) {
+	var removed []string
+	for _, rr := range resp.Answer {
+		if ip, ok := rebindAddress(rr); ok {
+			removed = append(removed, ip.String())
+		}
+	}
+	if len(removed) == 0 {
+		return resp, nil
+	}
+
+	out := resp.Copy()
+	out.Answer = out.Answer[:0]
+	hasAddress := false
+	for _, rr := range resp.Answer {
+		if _, bad := rebindAddress(rr); bad {
+			continue
+		}
+		switch rr.(type) {
+		case *dns.A, *dns.AAAA:
+			hasAddress = true
+		}
+		out.Answer = append(out.Answer, rr)
+	}
+	if !hasAddress {
+		out.Answer = nil
+		out.Rcode = dns.RcodeNameError
+	}
+	return out, removed
+}
+
+// rebindAddress returns the address of an A/AAAA record that points into a
+// private, loopback, link-local or unspecified range.
+func rebindAddress(rr dns.RR) (netip.Addr, bool) {
+	var ip netip.Addr
+	switch v := rr.(type) {
+	case *dns.A:
+		ip, _ = netip.AddrFromSlice(v.A)
+	case *dns.AAAA:
+		ip, _ = netip.AddrFromSlice(v.AAAA)
+	default:
+		return netip.Addr{}, false
+	}
+	ip = ip.Unmap()
+	if !ip.IsValid() {
+		return netip.Addr{}, false
+	}
+	return ip, ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// applyRebindProtection filters an upstream response before it is cached and
+// written. It returns resp unchanged when protection is off or the name is
+// allowed to resolve privately.
+func (h *Handler) applyRebindProtection(ctx context.Context, resp *dns.Msg, domain, clientIP string, trace *blockTraceRecorder, outcome *serveDNSOutcome) *dns.Msg {
+	g := h.deps.Load().rebind
+	if g == nil || resp == nil || g.allows(domain) {
+		return resp
+	}
+	filtered, removed := g.filter(resp)
+	if len(removed) == 0 {
+		return resp
+	}
+
+	if filtered.Rcode == dns.RcodeNameError {
+		outcome.blocked = true
+		h.attachEDE(filtered, dns.ExtendedErrorCodeFiltered, "rebind protection: answer pointed at a private address")
+	}
+	trace.Record(traceStageRebind, "strip", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "rebind_protection"
+		entry.Detail = "upstream answer pointed at private addresses: " + strings.Join(removed, ", ")
+	})
+	if lg := h.getLogger(); lg != nil {
+		lg.Warn("Blocked DNS rebinding answer",
+			"domain", domain,
+			"client", clientIP,
+			"upstream", outcome.upstream,
+			"addresses", removed)
+	}
+	h.recordRebindBlocked(ctx)
+	return filtered
+}
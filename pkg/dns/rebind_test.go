@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func rrs(t *testing.T, records ...string) []dns.RR {
+	t.Helper()
+	out := make([]dns.RR, 0, len(records))
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("NewRR(%q): %v", s, err)
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+func TestRebindGuard_Allows(t *testing.T) {
+	g := newRebindGuard(config.RebindProtectionConfig{Enabled: true, AllowedDomains: []string{"corp.example.com", "*.plex.direct"}})
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"nas.local.", true},
+		{"printer.lan.", true},
+		{"router.home.arpa.", true},
+		{"router.", true},
+		{"corp.example.com.", true},
+		{"git.corp.example.com.", true},
+		{"abc.plex.direct.", true},
+		{"evil.example.com.", false},
+		{"notcorp.example.com.", false},
+		{"local.example.com.", false},
+	}
+	for _, tt := range tests {
+		if got := g.allows(tt.domain); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestRebindGuard_Filter(t *testing.T) {
+	g := newRebindGuard(config.RebindProtectionConfig{Enabled: true})
+
+	mixed := new(dns.Msg)
+	mixed.Answer = rrs(t,
+		"evil.example.com. 60 IN A 93.184.216.34",
+		"evil.example.com. 60 IN A 192.168.1.1",
+		"evil.example.com. 60 IN AAAA ::ffff:10.0.0.1",
+	)
+	out, removed := g.filter(mixed)
+	if len(removed) != 2 || len(out.Answer) != 1 || out.Rcode != dns.RcodeSuccess {
+		t.Errorf("mixed: removed=%v answers=%d rcode=%d", removed, len(out.Answer), out.Rcode)
+	}
+	if len(mixed.Answer) != 3 {
+		t.Error("filter must not modify the input message")
+	}
+
+	for _, private := range []string{
+		"a.example.com. 60 IN A 127.0.0.1",
+		"a.example.com. 60 IN A 169.254.169.254",
+		"a.example.com. 60 IN A 172.16.5.4",
+		"a.example.com. 60 IN A 0.0.0.0",
+		"a.example.com. 60 IN AAAA ::1",
+		"a.example.com. 60 IN AAAA fe80::1",
+		"a.example.com. 60 IN AAAA fd00::1",
+	} {
+		m := new(dns.Msg)
+		m.Answer = rrs(t, "x.example.com. 60 IN CNAME a.example.com.", private)
+		out, removed := g.filter(m)
+		if len(removed) != 1 || out.Rcode != dns.RcodeNameError || len(out.Answer) != 0 {
+			t.Errorf("%s: expected NXDOMAIN, got rcode=%d answers=%d", private, out.Rcode, len(out.Answer))
+		}
+	}
+
+	public := new(dns.Msg)
+	public.Answer = rrs(t, "a.example.com. 60 IN A 8.8.8.8", "a.example.com. 60 IN AAAA 2606:4700::1111")
+	if out, removed := g.filter(public); out != public || removed != nil {
+		t.Error("public-only answer should be returned as-is")
+	}
+}
+
+// startRebindUpstream answers A queries from the given name → IP map.
+func startRebindUpstream(t *testing.T, answers map[string]string) string {
+	t.Helper()
+	return startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if ip, ok := answers[r.Question[0].Name]; ok {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP(ip),
+			})
+		}
+		_ = w.WriteMsg(m)
+	})
+}
+
+func TestServeDNS_RebindProtection(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{
+		"rebind.attacker.com.": "192.168.1.1",
+		"www.example.com.":     "93.184.216.34",
+		"nas.corp.example.":    "10.0.0.20",
+	})
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+	h.SetRebindProtection(config.RebindProtectionConfig{Enabled: true, AllowedDomains: []string{"corp.example"}})
+
+	query := func(name string) *dns.Msg {
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, dns.TypeA)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatalf("no response for %s", name)
+		}
+		return w.msg
+	}
+
+	if resp := query("rebind.attacker.com."); resp.Rcode != dns.RcodeNameError || len(resp.Answer) != 0 {
+		t.Errorf("rebind answer: expected NXDOMAIN, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("www.example.com."); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("public answer: expected pass-through, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("nas.corp.example."); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("allowed domain: expected private answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+
+	h.SetRebindProtection(config.RebindProtectionConfig{})
+	if resp := query("rebind.attacker.com."); len(resp.Answer) != 1 {
+		t.Errorf("protection disabled: expected private answer, got %d answers", len(resp.Answer))
+	}
+}
@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"strings"
+
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageRefusedType = "refused_type"
+
+// parseRefusedTypes maps server.refused_types names to query types. Unknown
+// names are skipped; config validation rejects them before they get here.
+func parseRefusedTypes(names []string) map[uint16]struct{} {
+	if len(names) == 0 {
+		return nil
+	}
+	types := make(map[uint16]struct{}, len(names))
+	for _, name := range names {
+		if qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]; ok {
+			types[qtype] = struct{}{}
+		}
+	}
+	return types
+}
+
+// serveRefusedType answers a query for a disabled record type with NODATA
+// (NOERROR, empty answer) so clients fall back instead of retrying. It runs
+// after the local-records lookup, so local records of that type still resolve.
+func (h *Handler) serveRefusedType(w dns.ResponseWriter, r, msg *dns.Msg, qtypeLabel string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	trace.Record(traceStageRefusedType, "nodata", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "refused_types"
+		entry.Detail = qtypeLabel + " queries are disabled"
+	})
+	msg.SetRcode(r, dns.RcodeSuccess)
+	outcome.responseCode = dns.RcodeSuccess
+	h.writeMsg(w, r, msg)
+	return true
+}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_RefusedTypes(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{"www.example.com.": "93.184.216.34"})
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+	h.SetRefusedTypes([]string{"https", " TXT "})
+
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewTXTRecord("nas.lan.", []string{"v=1"})); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	for _, qtype := range []uint16{dns.TypeHTTPS, dns.TypeTXT} {
+		resp := query("www.example.com.", qtype)
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+			t.Errorf("%s: expected NODATA, got %s with %d answers", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode], len(resp.Answer))
+		}
+	}
+
+	if resp := query("nas.lan.", dns.TypeTXT); len(resp.Answer) != 1 {
+		t.Errorf("local TXT record should still be answered, got %d answers", len(resp.Answer))
+	}
+	if resp := query("www.example.com.", dns.TypeA); len(resp.Answer) != 1 {
+		t.Errorf("other types should still be forwarded, got %d answers", len(resp.Answer))
+	}
+	if dec := h.Explain(context.Background(), "www.example.com", "192.168.1.10", dns.TypeHTTPS); dec.Stage != traceStageRefusedType {
+		t.Errorf("Explain stage = %q, want %q", dec.Stage, traceStageRefusedType)
+	}
+
+	h.SetRefusedTypes(nil)
+	// The test upstream answers every type with its A record, so an answer
+	// proves the query was forwarded.
+	if resp := query("www.example.com.", dns.TypeTXT); len(resp.Answer) != 1 {
+		t.Errorf("after clearing, TXT should be forwarded, got %d answers", len(resp.Answer))
+	}
+}
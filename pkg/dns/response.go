@@ -6,7 +6,9 @@ import (
 	"github.com/miekg/dns"
 )
 
-const overrideTTL = 300
+// defaultOverrideTTL is the TTL of synthetic answers (policy redirects) when
+// server.override_ttl is not set.
+const defaultOverrideTTL = 300
 
 func addARecord(msg *dns.Msg, domain string, ip net.IP, ttl uint32) {
 	if ip == nil || ip.To4() == nil {
@@ -0,0 +1,62 @@
+//go:build linux
+
+package dns
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenUDPWorkers binds workers UDP sockets to addr with SO_REUSEPORT so the
+// kernel spreads incoming datagrams across them (hashed by source address),
+// letting each socket's read loop run on its own core. With workers <= 1, or
+// when SO_REUSEPORT can't be set, it binds a single plain socket and reports
+// reusePort false.
+func listenUDPWorkers(addr string, workers int) (conns []net.PacketConn, reusePort bool, err error) {
+	if workers <= 1 {
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, false, err
+		}
+		return []net.PacketConn{pc}, false, nil
+	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	first, err := lc.ListenPacket(context.Background(), "udp", addr)
+	if err != nil {
+		// SO_REUSEPORT unsupported (old kernel, seccomp): fall back to one socket.
+		pc, plainErr := net.ListenPacket("udp", addr)
+		if plainErr != nil {
+			return nil, false, plainErr
+		}
+		return []net.PacketConn{pc}, false, nil
+	}
+	conns = append(conns, first)
+
+	// Bind the rest to the resolved address so ":0" shares one port.
+	bound := first.LocalAddr().String()
+	for len(conns) < workers {
+		pc, err := lc.ListenPacket(context.Background(), "udp", bound)
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, false, err
+		}
+		conns = append(conns, pc)
+	}
+	return conns, true, nil
+}
+
+func reusePortControl(_, _ string, c syscall.RawConn) error {
+	var opErr error
+	if err := c.Control(func(fd uintptr) {
+		opErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); err != nil {
+		return err
+	}
+	return opErr
+}
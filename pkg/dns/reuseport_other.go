@@ -0,0 +1,15 @@
+//go:build !linux
+
+package dns
+
+import "net"
+
+// listenUDPWorkers binds a single UDP socket. SO_REUSEPORT only load-balances
+// datagrams across sockets on Linux, so server.udp_workers is ignored here.
+func listenUDPWorkers(addr string, _ int) ([]net.PacketConn, bool, error) {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, false, err
+	}
+	return []net.PacketConn{pc}, false, nil
+}
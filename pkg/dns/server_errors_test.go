@@ -26,7 +26,7 @@ func TestWriteMsg_ErrorHandling(t *testing.T) {
 	msg.SetQuestion("example.com.", dns.TypeA)
 
 	// Should not panic when WriteMsg fails
-	handler.writeMsg(mockWriter, msg)
+	handler.writeMsg(mockWriter, msg, msg)
 
 	// Verify the error was ignored gracefully
 	if !mockWriter.writeAttempted {
@@ -47,7 +47,7 @@ func TestWriteMsg_Success(t *testing.T) {
 	msg.SetReply(msg)
 
 	// Should successfully write message
-	handler.writeMsg(mockWriter, msg)
+	handler.writeMsg(mockWriter, msg, msg)
 
 	// Verify message was written
 	if mockWriter.msg == nil {
@@ -3,6 +3,7 @@ package dns
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -28,8 +29,8 @@ type Server struct {
 	logger         *logging.Logger
 	metrics        *telemetry.Metrics
 	clientACL      *ClientACL
-	udpServer      *dns.Server
-	tcpServer      *dns.Server
+	udpServers     []*dns.Server // one per UDP listen address
+	tcpServers     []*dns.Server // one per TCP listen address
 	dotServer      *dns.Server
 	acmeHTTPServer *http.Server
 	tlsConfig      *tls.Config
@@ -118,110 +119,127 @@ func (s *Server) Start(ctx context.Context) error {
 		transport: "dot", // no clientACL — TLS cert verification is the auth layer
 	}
 
-	errChan := make(chan error, 4)
-
-	// Create and assign UDP server
+	// Bind every plain DNS address up front so a failure names its address.
+	// Each address was configured explicitly, so any failure stops the start
+	// rather than leaving the server half-listening.
+	var bindErrs []error
+	limiter := newConnLimiter(s.cfg.Server.MaxTCPConnections, s.metrics)
+	idleTimeout := s.cfg.Server.TCPIdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = config.DefaultTCPIdleTimeout
+	}
+	tcpIdle := func() time.Duration { return idleTimeout }
 	if s.cfg.Server.UDPEnabled {
-		s.udpServer = &dns.Server{
-			Addr:    s.cfg.Server.UDPAddr(),
-			Net:     "udp",
-			Handler: dns.HandlerFunc(udpHandler.serveDNS),
+		workers := s.cfg.Server.UDPWorkers
+		for _, addr := range s.cfg.Server.UDPAddrs() {
+			conns, reusePort, err := listenUDPWorkers(addr, workers)
+			if err != nil {
+				s.logger.Error("Failed to bind UDP DNS listener", "address", addr, "error", err)
+				bindErrs = append(bindErrs, fmt.Errorf("UDP %s: %w", addr, err))
+				continue
+			}
+			if workers > 1 && !reusePort {
+				s.logger.Warn("SO_REUSEPORT unavailable, using a single UDP socket",
+					"address", addr, "udp_workers", workers)
+			}
+			for _, pc := range conns {
+				s.udpServers = append(s.udpServers, &dns.Server{
+					PacketConn:    pc,
+					Net:           "udp",
+					Handler:       dns.HandlerFunc(udpHandler.serveDNS),
+					MsgAcceptFunc: acceptQuery,
+				})
+			}
 		}
 	}
 
-	// Create and assign TCP server
 	if s.cfg.Server.TCPEnabled {
-		if s.cfg.Server.ProxyProtocol {
-			// PROXY protocol: create raw TCP listener wrapped with proxyproto
-			rawLn, err := net.Listen("tcp", s.cfg.Server.TCPAddr())
+		for _, addr := range s.cfg.Server.TCPAddrs() {
+			ln, err := net.Listen("tcp", addr)
 			if err != nil {
-				s.mu.Unlock()
-				return fmt.Errorf("TCP DNS listen: %w", err)
-			}
-			proxyLn := &proxyproto.Listener{
-				Listener:          rawLn,
-				ReadHeaderTimeout: 5 * time.Second,
+				s.logger.Error("Failed to bind TCP DNS listener", "address", addr, "error", err)
+				bindErrs = append(bindErrs, fmt.Errorf("TCP %s: %w", addr, err))
+				continue
 			}
-			s.tcpServer = &dns.Server{
-				Listener: proxyLn,
-				Net:      "tcp",
-				Handler:  dns.HandlerFunc(tcpHandler.serveDNS),
-			}
-		} else {
-			s.tcpServer = &dns.Server{
-				Addr:    s.cfg.Server.TCPAddr(),
-				Net:     "tcp",
-				Handler: dns.HandlerFunc(tcpHandler.serveDNS),
+			ln = limiter.wrap(ln)
+			if s.cfg.Server.ProxyProtocol {
+				// PROXY protocol: wrap the raw TCP listener with proxyproto
+				ln = &proxyproto.Listener{
+					Listener:          ln,
+					ReadHeaderTimeout: 5 * time.Second,
+				}
 			}
+			s.tcpServers = append(s.tcpServers, &dns.Server{
+				Listener:      ln,
+				Net:           "tcp",
+				Handler:       dns.HandlerFunc(tcpHandler.serveDNS),
+				MsgAcceptFunc: acceptQuery,
+				IdleTimeout:   tcpIdle,
+			})
 		}
 	}
 
+	if len(bindErrs) > 0 {
+		s.closeListeners()
+		s.running = false
+		s.mu.Unlock()
+		return fmt.Errorf("failed to bind DNS listener: %w", errors.Join(bindErrs...))
+	}
+
+	errChan := make(chan error, len(s.udpServers)+len(s.tcpServers)+2)
+
 	// Create DoT server if enabled and TLS is available
 	if s.cfg.Server.DotEnabled && s.tlsConfig != nil {
+		// Raw TCP → connection limit → (PROXY protocol) → TLS. Fly.io sends
+		// the PROXY header before the TLS ClientHello, so the proxy layer
+		// must sit between raw TCP and TLS.
+		rawLn, err := net.Listen("tcp", s.cfg.Server.DotAddress)
+		if err != nil {
+			s.closeListeners()
+			s.running = false
+			s.mu.Unlock()
+			return fmt.Errorf("DoT listen: %w", err)
+		}
+		ln := limiter.wrap(rawLn)
 		if s.cfg.Server.ProxyProtocol {
-			// PROXY protocol + TLS: raw TCP → proxyproto → TLS
-			// Fly.io sends PROXY header before TLS ClientHello, so
-			// the proxy layer must sit between raw TCP and TLS.
-			rawLn, err := net.Listen("tcp", s.cfg.Server.DotAddress)
-			if err != nil {
-				s.mu.Unlock()
-				return fmt.Errorf("DoT listen: %w", err)
-			}
-			proxyLn := &proxyproto.Listener{
-				Listener:          rawLn,
+			ln = &proxyproto.Listener{
+				Listener:          ln,
 				ReadHeaderTimeout: 5 * time.Second,
 			}
-			tlsLn := tls.NewListener(proxyLn, s.tlsConfig)
-			s.dotServer = &dns.Server{
-				Listener: tlsLn,
-				Net:      "tcp-tls",
-				Handler:  dns.HandlerFunc(dotHandler.serveDNS),
-			}
-		} else {
-			s.dotServer = &dns.Server{
-				Addr:      s.cfg.Server.DotAddress,
-				Net:       "tcp-tls",
-				Handler:   dns.HandlerFunc(dotHandler.serveDNS),
-				TLSConfig: s.tlsConfig,
-			}
+		}
+		s.dotServer = &dns.Server{
+			Listener:      tls.NewListener(ln, s.tlsConfig),
+			Net:           "tcp-tls",
+			Handler:       dns.HandlerFunc(dotHandler.serveDNS),
+			MsgAcceptFunc: acceptQuery,
+			IdleTimeout:   tcpIdle,
 		}
 	}
 
+	// Snapshot the listeners; Shutdown may clear the slices concurrently.
+	udpServers, tcpServers := s.udpServers, s.tcpServers
+
 	// Unlock before starting goroutines
 	s.mu.Unlock()
 
-	// Start UDP server in goroutine
-	if s.cfg.Server.UDPEnabled {
-		go func() {
-			s.logger.Info("Starting UDP DNS server", "address", s.cfg.Server.UDPAddr())
-			s.mu.RLock()
-			udpSrv := s.udpServer
-			s.mu.RUnlock()
-			if err := udpSrv.ListenAndServe(); err != nil {
-				errChan <- fmt.Errorf("UDP server failed: %w", err)
+	// Start one goroutine per plain DNS listener
+	for _, srv := range udpServers {
+		go func(srv *dns.Server) {
+			s.logger.Info("Starting UDP DNS server", "address", srv.PacketConn.LocalAddr().String())
+			if err := srv.ActivateAndServe(); err != nil {
+				errChan <- fmt.Errorf("UDP server %s failed: %w", srv.PacketConn.LocalAddr(), err)
 			}
-		}()
+		}(srv)
 	}
-
-	// Start TCP server in goroutine
-	if s.cfg.Server.TCPEnabled {
-		go func() {
+	for _, srv := range tcpServers {
+		go func(srv *dns.Server) {
 			s.logger.Info("Starting TCP DNS server",
-				"address", s.cfg.Server.TCPAddr(),
+				"address", srv.Listener.Addr().String(),
 				"proxy_protocol", s.cfg.Server.ProxyProtocol)
-			s.mu.RLock()
-			tcpSrv := s.tcpServer
-			s.mu.RUnlock()
-			var err error
-			if s.cfg.Server.ProxyProtocol {
-				err = tcpSrv.ActivateAndServe()
-			} else {
-				err = tcpSrv.ListenAndServe()
+			if err := srv.ActivateAndServe(); err != nil {
+				errChan <- fmt.Errorf("TCP server %s failed: %w", srv.Listener.Addr(), err)
 			}
-			if err != nil {
-				errChan <- fmt.Errorf("TCP server failed: %w", err)
-			}
-		}()
+		}(srv)
 	}
 
 	// Start DoT server
@@ -233,13 +251,7 @@ func (s *Server) Start(ctx context.Context) error {
 			s.mu.RLock()
 			dotSrv := s.dotServer
 			s.mu.RUnlock()
-			var err error
-			if s.cfg.Server.ProxyProtocol {
-				err = dotSrv.ActivateAndServe()
-			} else {
-				err = dotSrv.ListenAndServe()
-			}
-			if err != nil {
+			if err := dotSrv.ActivateAndServe(); err != nil {
 				errChan <- fmt.Errorf("DoT server failed: %w", err)
 			}
 		}()
@@ -256,10 +268,13 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	s.logger.Info("DNS server started",
-		"udp_address", s.cfg.Server.UDPAddr(),
-		"tcp_address", s.cfg.Server.TCPAddr(),
+		"udp_addresses", s.cfg.Server.UDPAddrs(),
+		"tcp_addresses", s.cfg.Server.TCPAddrs(),
 		"udp", s.cfg.Server.UDPEnabled,
 		"tcp", s.cfg.Server.TCPEnabled,
+		"udp_listeners", len(udpServers),
+		"tcp_listeners", len(tcpServers),
+		"bind_failures", len(bindErrs),
 	)
 
 	// Wait for context cancellation or server error
@@ -286,19 +301,22 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 	var errs []error
 
-	// Shutdown UDP server
-	if s.udpServer != nil {
-		if err := s.udpServer.ShutdownContext(ctx); err != nil {
-			errs = append(errs, fmt.Errorf("UDP shutdown: %w", err))
+	// Shutdown UDP and TCP servers. A server whose goroutine hasn't reached
+	// ActivateAndServe yet reports "not started"; close its socket directly
+	// so it can't start serving after shutdown.
+	for _, srv := range s.udpServers {
+		if err := srv.ShutdownContext(ctx); err != nil {
+			_ = srv.PacketConn.Close()
+			errs = append(errs, fmt.Errorf("UDP %s shutdown: %w", srv.PacketConn.LocalAddr(), err))
 		}
 	}
-
-	// Shutdown TCP server
-	if s.tcpServer != nil {
-		if err := s.tcpServer.ShutdownContext(ctx); err != nil {
-			errs = append(errs, fmt.Errorf("TCP shutdown: %w", err))
+	for _, srv := range s.tcpServers {
+		if err := srv.ShutdownContext(ctx); err != nil {
+			_ = srv.Listener.Close()
+			errs = append(errs, fmt.Errorf("TCP %s shutdown: %w", srv.Listener.Addr(), err))
 		}
 	}
+	s.udpServers, s.tcpServers = nil, nil
 
 	// Shutdown DoT server
 	if s.dotServer != nil {
@@ -328,6 +346,18 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// closeListeners closes the sockets bound by Start before any server was
+// activated. Callers hold s.mu.
+func (s *Server) closeListeners() {
+	for _, srv := range s.udpServers {
+		_ = srv.PacketConn.Close()
+	}
+	for _, srv := range s.tcpServers {
+		_ = srv.Listener.Close()
+	}
+	s.udpServers, s.tcpServers = nil, nil
+}
+
 // UpdateClientACL replaces the client ACL entries (hot-reload safe).
 func (s *Server) UpdateClientACL(entries []string) {
 	if s.clientACL != nil {
@@ -429,7 +459,7 @@ func (w *wrappedHandler) serveDNS(rw dns.ResponseWriter, r *dns.Msg) {
 		w.metrics.DNSQueriesTotal.Add(ctx, 1, metric.WithAttributes(attrs...))
 		if queryTypeName != "" {
 			w.metrics.DNSQueriesByType.Add(ctx, 1, metric.WithAttributes(
-				append(attrs, attribute.String("type", queryTypeName))...),
+				append(attrs, attribute.String("type", w.metrics.QueryTypeLabel(queryTypeName)))...),
 			)
 		} else {
 			w.metrics.DNSQueriesByType.Add(ctx, 1, metric.WithAttributes(attrs...))
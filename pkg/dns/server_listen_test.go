@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+// startListenServer starts a DNS server on the given addresses and waits
+// until its listeners are bound. It returns the bound UDP and TCP addresses.
+func startListenServer(t testing.TB, addrs []string, udpWorkers int) (*Server, []string, []string) {
+	t.Helper()
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			ListenAddress:   addrs[0],
+			ListenAddresses: addrs,
+			UDPEnabled:      true,
+			TCPEnabled:      true,
+			UDPWorkers:      udpWorkers,
+		},
+	}
+	logger, err := logging.New(&config.LoggingConfig{Level: "error", Format: "text", Output: "stdout"})
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	server := NewServer(cfg, NewHandler(), logger, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		server.mu.RLock()
+		var udp, tcp []string
+		for _, srv := range server.udpServers {
+			udp = append(udp, srv.PacketConn.LocalAddr().String())
+		}
+		for _, srv := range server.tcpServers {
+			tcp = append(tcp, srv.Listener.Addr().String())
+		}
+		server.mu.RUnlock()
+		if len(udp) > 0 || len(tcp) > 0 {
+			time.Sleep(20 * time.Millisecond) // let the serve goroutines activate
+			return server, udp, tcp
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("server did not bind any listener")
+	return nil, nil, nil
+}
+
+func exchangeOn(t testing.TB, network, addr string) {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	c := &dns.Client{Net: network, Timeout: time.Second}
+	resp, _, err := c.Exchange(msg, addr)
+	if err != nil {
+		t.Fatalf("%s query to %s: %v", network, addr, err)
+	}
+	if resp.Id != msg.Id {
+		t.Fatalf("%s query to %s: mismatched response id", network, addr)
+	}
+}
+
+func TestServer_MultipleListenAddresses(t *testing.T) {
+	server, udp, tcp := startListenServer(t, []string{"127.0.0.1:0", "127.0.0.2:0"}, 0)
+	if len(udp) != 2 || len(tcp) != 2 {
+		t.Fatalf("expected 2 UDP and 2 TCP listeners, got %v / %v", udp, tcp)
+	}
+	for _, addr := range udp {
+		exchangeOn(t, "udp", addr)
+	}
+	for _, addr := range tcp {
+		exchangeOn(t, "tcp", addr)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	// Every socket is released: the exact addresses can be bound again.
+	for _, addr := range udp {
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			t.Errorf("UDP %s still bound after shutdown: %v", addr, err)
+			continue
+		}
+		_ = pc.Close()
+	}
+	for _, addr := range tcp {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("TCP %s still bound after shutdown: %v", addr, err)
+			continue
+		}
+		_ = ln.Close()
+	}
+}
+
+func TestServer_StartFailsWhenAnyAddressFailsToBind(t *testing.T) {
+	busyUDP, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer func() { _ = busyUDP.Close() }()
+	busy := busyUDP.LocalAddr().String()
+
+	free, err := net.ListenPacket("udp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 not available: %v", err)
+	}
+	freeAddr := free.LocalAddr().String()
+	_ = free.Close()
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			ListenAddress:   freeAddr,
+			ListenAddresses: []string{freeAddr, busy},
+			UDPEnabled:      true,
+		},
+	}
+	server := NewServer(cfg, NewHandler(), logging.NewDefault(), nil)
+
+	err = server.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), busy) {
+		t.Fatalf("expected Start to fail naming %s, got %v", busy, err)
+	}
+	if server.IsRunning() {
+		t.Error("server should not be running after a failed start")
+	}
+	// The address that did bind is released again
+	pc, err := net.ListenPacket("udp", freeAddr)
+	if err != nil {
+		t.Fatalf("%s still bound after the failed start: %v", freeAddr, err)
+	}
+	_ = pc.Close()
+}
+
+func TestServer_StartFailsWhenNoAddressBinds(t *testing.T) {
+	busyUDP, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer func() { _ = busyUDP.Close() }()
+	busy := busyUDP.LocalAddr().String()
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			ListenAddress: busy,
+			UDPEnabled:    true,
+		},
+	}
+	server := NewServer(cfg, NewHandler(), logging.NewDefault(), nil)
+
+	err = server.Start(context.Background())
+	if err == nil {
+		t.Fatal("expected Start to fail when no listener binds")
+	}
+	if !strings.Contains(err.Error(), busy) {
+		t.Errorf("error should name the failed address %s: %v", busy, err)
+	}
+	if server.IsRunning() {
+		t.Error("server should not be running after a failed start")
+	}
+}
+
+func TestServer_UDPWorkers(t *testing.T) {
+	_, udp, _ := startListenServer(t, []string{"127.0.0.1:0"}, 4)
+	want := 4
+	if runtime.GOOS != "linux" {
+		want = 1 // single-socket fallback
+	}
+	if len(udp) != want {
+		t.Fatalf("expected %d UDP sockets, got %d: %v", want, len(udp), udp)
+	}
+	for _, addr := range udp[1:] {
+		if addr != udp[0] {
+			t.Errorf("UDP workers should share one address, got %s and %s", udp[0], addr)
+		}
+	}
+	// Queries from many source ports land on different sockets; all answer.
+	for i := 0; i < 16; i++ {
+		exchangeOn(t, "udp", udp[0])
+	}
+}
+
+// BenchmarkServer_UDPWorkers measures UDP query throughput through the real
+// listener with one socket versus SO_REUSEPORT sockets per core. Compare the
+// reported qps across sub-benchmarks, e.g.:
+//
+//	go test ./pkg/dns -run '^$' -bench UDPWorkers -cpu 8
+func BenchmarkServer_UDPWorkers(b *testing.B) {
+	for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			_, udp, _ := startListenServer(b, []string{"127.0.0.1:0"}, workers)
+			addr := udp[0]
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				// One connection (source port) per goroutine so the kernel
+				// hashes clients across the reuseport sockets.
+				conn, err := dns.Dial("udp", addr)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				defer func() { _ = conn.Close() }()
+				msg := new(dns.Msg)
+				msg.SetQuestion("example.com.", dns.TypeA)
+				for pb.Next() {
+					_ = conn.SetDeadline(time.Now().Add(time.Second))
+					if err := conn.WriteMsg(msg); err != nil {
+						b.Error(err)
+						return
+					}
+					if _, err := conn.ReadMsg(); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "qps")
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package dns
+
+import (
+	"math/rand/v2"
+
+	"github.com/miekg/dns"
+)
+
+// shuffleAddresses randomizes the order of the A records and, separately, the
+// AAAA records in resp's answer section. Other records (e.g. the CNAME chain
+// in front of the addresses) keep their positions.
+func shuffleAddresses(resp *dns.Msg) {
+	if resp == nil || len(resp.Answer) < 2 {
+		return
+	}
+	var a, aaaa []int
+	for i, rr := range resp.Answer {
+		switch rr.(type) {
+		case *dns.A:
+			a = append(a, i)
+		case *dns.AAAA:
+			aaaa = append(aaaa, i)
+		}
+	}
+	for _, idx := range [][]int{a, aaaa} {
+		rand.Shuffle(len(idx), func(i, j int) {
+			resp.Answer[idx[i]], resp.Answer[idx[j]] = resp.Answer[idx[j]], resp.Answer[idx[i]]
+		})
+	}
+}
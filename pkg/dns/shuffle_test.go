@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestShuffleAddresses(t *testing.T) {
+	base := rrs(t,
+		"www.example.com. 60 IN CNAME edge.example.net.",
+		"edge.example.net. 60 IN A 192.0.2.1",
+		"edge.example.net. 60 IN A 192.0.2.2",
+		"edge.example.net. 60 IN A 192.0.2.3",
+		"edge.example.net. 60 IN A 192.0.2.4",
+	)
+
+	firsts := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		m := new(dns.Msg)
+		m.Answer = append([]dns.RR(nil), base...)
+		shuffleAddresses(m)
+
+		if _, ok := m.Answer[0].(*dns.CNAME); !ok {
+			t.Fatal("CNAME must stay in front of the address records")
+		}
+		seen := make(map[string]bool)
+		for _, rr := range m.Answer[1:] {
+			seen[rr.(*dns.A).A.String()] = true
+		}
+		if len(seen) != 4 {
+			t.Fatalf("shuffle lost or duplicated records: %v", m.Answer)
+		}
+		firsts[m.Answer[1].(*dns.A).A.String()] = true
+	}
+	if len(firsts) < 2 {
+		t.Error("expected the first address to vary across shuffles")
+	}
+}
+
+func TestShuffleAddresses_KeepsTypesApart(t *testing.T) {
+	m := new(dns.Msg)
+	m.Answer = rrs(t,
+		"a.example.com. 60 IN A 192.0.2.1",
+		"a.example.com. 60 IN AAAA 2001:db8::1",
+		"a.example.com. 60 IN A 192.0.2.2",
+		"a.example.com. 60 IN AAAA 2001:db8::2",
+	)
+	for i := 0; i < 50; i++ {
+		shuffleAddresses(m)
+		for j, want := range []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeA, dns.TypeAAAA} {
+			if got := m.Answer[j].Header().Rrtype; got != want {
+				t.Fatalf("answer %d has type %s, want %s", j, dns.TypeToString[got], dns.TypeToString[want])
+			}
+		}
+	}
+
+	shuffleAddresses(nil) // must not panic
+}
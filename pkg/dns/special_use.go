@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/pattern"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	traceStageSpecialUse = "special_use"
+
+	// localhostTTL is the TTL of the loopback answers for localhost names.
+	localhostTTL = 300
+
+	localhostDetail = "localhost names resolve to the loopback address"
+)
+
+// specialUseGuard answers special-use names (.local, .test, link-local reverse
+// zones, ...) locally so they never leak to public resolvers.
+type specialUseGuard struct {
+	zones []string // normalized; each also covers its subdomains
+}
+
+func newSpecialUseGuard(cfg config.SpecialUseNamesConfig) *specialUseGuard {
+	names := cfg.Names
+	if len(names) == 0 {
+		names = config.DefaultSpecialUseNames
+	}
+	g := &specialUseGuard{zones: make([]string, 0, len(names))}
+	for _, n := range names {
+		if z := pattern.NormalizeDomain(strings.TrimPrefix(n, "*.")); z != "" {
+			g.zones = append(g.zones, z)
+		}
+	}
+	return g
+}
+
+// zone returns the configured zone domain falls under, if any.
+func (g *specialUseGuard) zone(domain string) (string, bool) {
+	name := pattern.NormalizeDomain(domain)
+	for _, z := range g.zones {
+		if inZone(name, z) {
+			return z, true
+		}
+	}
+	return "", false
+}
+
+// inZone reports whether the normalized name equals zone or is a subdomain of it.
+func inZone(name, zone string) bool {
+	return name == zone || (strings.HasSuffix(name, zone) && name[len(name)-len(zone)-1] == '.')
+}
+
+// serveSpecialUse answers a special-use query with NXDOMAIN, or NODATA when a
+// local record exists for the name under another type. Localhost names get
+// the loopback address instead (RFC 6761 §6.3). It runs after the
+// local-records lookup, so names defined there still resolve normally.
+func (h *Handler) serveSpecialUse(w dns.ResponseWriter, r, msg *dns.Msg, domain string, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	g := h.deps.Load().specialUse
+	if g == nil {
+		return false
+	}
+	zone, ok := g.zone(domain)
+	if !ok {
+		return false
+	}
+	if zone == "localhost" {
+		h.serveLocalhost(w, r, msg, domain, trace, outcome)
+		return true
+	}
+
+	rcode := dns.RcodeNameError
+	if lr := h.getLocalRecords(); lr != nil && lr.HasRecord(domain) {
+		rcode = dns.RcodeSuccess
+	}
+	trace.Record(traceStageSpecialUse, "local_answer", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "special_use_names"
+		entry.Detail = "special-use zone " + zone + " is not forwarded upstream"
+	})
+	msg.SetRcode(r, rcode)
+	outcome.responseCode = rcode
+	h.writeMsg(w, r, msg)
+	return true
+}
+
+// serveLocalhost answers A with 127.0.0.1 and AAAA with ::1 for localhost and
+// its subdomains; other types get NODATA.
+func (h *Handler) serveLocalhost(w dns.ResponseWriter, r, msg *dns.Msg, domain string, trace *blockTraceRecorder, outcome *serveDNSOutcome) {
+	trace.Record(traceStageSpecialUse, "local_answer", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "special_use_names"
+		entry.Detail = localhostDetail
+	})
+
+	hdr := dns.RR_Header{Name: domain, Class: dns.ClassINET, Ttl: localhostTTL}
+	switch r.Question[0].Qtype {
+	case dns.TypeA:
+		hdr.Rrtype = dns.TypeA
+		msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr, A: net.IPv4(127, 0, 0, 1)})
+	case dns.TypeAAAA:
+		hdr.Rrtype = dns.TypeAAAA
+		msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.IPv6loopback})
+	}
+	msg.SetRcode(r, dns.RcodeSuccess)
+	outcome.responseCode = dns.RcodeSuccess
+	h.writeMsg(w, r, msg)
+}
@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestSpecialUseGuard_Zone(t *testing.T) {
+	g := newSpecialUseGuard(config.SpecialUseNamesConfig{Enabled: true})
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"printer.local.", true},
+		{"LOCAL.", true},
+		{"app.localhost.", true},
+		{"foo.test.", true},
+		{"x.invalid.", true},
+		{"4.3.254.169.in-addr.arpa.", true},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa.", true},
+		{"1.1.168.192.in-addr.arpa.", false},
+		{"local.example.com.", false},
+		{"mylocal.", false},
+		{"example.com.", false},
+	}
+	for _, tt := range tests {
+		if _, got := g.zone(tt.domain); got != tt.want {
+			t.Errorf("zone(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+
+	custom := newSpecialUseGuard(config.SpecialUseNamesConfig{Enabled: true, Names: []string{"*.corp"}})
+	if _, ok := custom.zone("printer.local."); ok {
+		t.Error("custom list should replace the defaults")
+	}
+	if _, ok := custom.zone("git.corp."); !ok {
+		t.Error("custom zone should match its subdomains")
+	}
+}
+
+func TestServeDNS_SpecialUseNames(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{
+		"printer.local.":   "93.184.216.34",
+		"www.example.com.": "93.184.216.34",
+	})
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+
+	lr := localrecords.NewManager()
+	if err := lr.AddRecord(localrecords.NewARecord("nas.local.", net.ParseIP("192.168.1.5"))); err != nil {
+		t.Fatal(err)
+	}
+	h.SetLocalRecords(lr)
+	h.SetSpecialUseNames(config.SpecialUseNamesConfig{Enabled: true})
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatalf("no response for %s", name)
+		}
+		return w.msg
+	}
+
+	if resp := query("printer.local.", dns.TypeA); resp.Rcode != dns.RcodeNameError || len(resp.Answer) != 0 {
+		t.Errorf("special-use name: expected NXDOMAIN, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("nas.local.", dns.TypeA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("local record: expected answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("nas.local.", dns.TypeAAAA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("local record, other type: expected NODATA, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("localhost.", dns.TypeA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 ||
+		!resp.Answer[0].(*dns.A).A.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("localhost A: expected 127.0.0.1, got %s with %v", dns.RcodeToString[resp.Rcode], resp.Answer)
+	}
+	if resp := query("app.localhost.", dns.TypeAAAA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 ||
+		!resp.Answer[0].(*dns.AAAA).AAAA.Equal(net.IPv6loopback) {
+		t.Errorf("localhost AAAA: expected ::1, got %s with %v", dns.RcodeToString[resp.Rcode], resp.Answer)
+	}
+	if resp := query("localhost.", dns.TypeMX); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("localhost MX: expected NODATA, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if resp := query("www.example.com.", dns.TypeA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("public name: expected forwarded answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+
+	h.SetSpecialUseNames(config.SpecialUseNamesConfig{})
+	if resp := query("printer.local.", dns.TypeA); len(resp.Answer) != 1 {
+		t.Errorf("guard disabled: expected forwarded answer, got %d answers", len(resp.Answer))
+	}
+}
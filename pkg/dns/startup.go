@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"context"
+	"time"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageStartup = "startup"
+
+// startupGate is startup.fail_closed: how long a query may wait for the
+// first blocklist load before it is refused.
+type startupGate struct {
+	maxWait time.Duration
+}
+
+// newStartupGate builds the gate from config. It returns nil when
+// fail_closed is off.
+func newStartupGate(cfg config.StartupConfig) *startupGate {
+	if !cfg.FailClosed {
+		return nil
+	}
+	return &startupGate{maxWait: cfg.MaxWait}
+}
+
+// serveBlocklistNotReady holds a query until the blocklist has loaded, for up
+// to the gate's max wait, and then answers SERVFAIL (EDE Not Ready) rather
+// than letting it through unfiltered. It reports false once the blocklist is
+// ready, including when it becomes ready during the wait.
+func (h *Handler) serveBlocklistNotReady(ctx context.Context, w dns.ResponseWriter, r, msg *dns.Msg, gate *startupGate, bm *blocklist.Manager, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	if gate == nil || bm == nil || bm.IsReady() {
+		return false
+	}
+	if gate.maxWait > 0 {
+		timer := time.NewTimer(gate.maxWait)
+		defer timer.Stop()
+		select {
+		case <-bm.Ready():
+			return false
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	trace.Record(traceStageStartup, "servfail", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "startup"
+		entry.Detail = "blocklists have not loaded yet (startup.fail_closed)"
+	})
+	msg.SetRcode(r, dns.RcodeServerFailure)
+	h.attachEDE(msg, dns.ExtendedErrorCodeNotReady, "blocklists still loading")
+	outcome.responseCode = dns.RcodeServerFailure
+	h.writeMsg(w, r, msg)
+	return true
+}
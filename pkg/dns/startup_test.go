@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/blocklist"
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_StartupFailClosed(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("0.0.0.0 ads.example.com\n"))
+	}))
+	t.Cleanup(srv.Close)
+
+	mgr := blocklist.NewManager(&config.Config{Blocklists: []string{srv.URL}}, logging.NewDefault(), nil, nil)
+	if err := mgr.Update(context.Background()); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	h := NewHandler()
+	h.SetBlocklistManager(mgr)
+	h.SetExtendedDNSErrors(true, false)
+
+	// Off by default: the query goes on to the (missing) forwarder.
+	if code, _, _ := ExtractEDE(queryEDNS(t, h, "ads.example.com.", true)); code == dns.ExtendedErrorCodeNotReady {
+		t.Fatal("queries should not be held without startup.fail_closed")
+	}
+
+	h.SetStartup(config.StartupConfig{FailClosed: true, MaxWait: 10 * time.Millisecond})
+	resp := queryEDNS(t, h, "ads.example.com.", true)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("expected SERVFAIL before blocklists load, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if code, _, ok := ExtractEDE(resp); !ok || code != dns.ExtendedErrorCodeNotReady {
+		t.Errorf("expected EDE Not Ready, got %d (present %v)", code, ok)
+	}
+
+	// A load finishing while the query waits lets it through to the blocklist.
+	h.SetStartup(config.StartupConfig{FailClosed: true, MaxWait: 5 * time.Second})
+	failing.Store(false)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = mgr.Update(context.Background())
+	}()
+	resp = queryEDNS(t, h, "ads.example.com.", true)
+	if resp.Rcode == dns.RcodeServerFailure {
+		t.Fatal("expected the blocklist answer once loading completes")
+	}
+	if code, _, ok := ExtractEDE(resp); !ok || code != dns.ExtendedErrorCodeBlocked {
+		t.Errorf("expected EDE Blocked after load, got %d (present %v)", code, ok)
+	}
+}
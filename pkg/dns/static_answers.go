@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"strings"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageStaticAnswer = "static_answer"
+
+// staticAnswerKey identifies a static answer by lowercased FQDN and type.
+type staticAnswerKey struct {
+	name  string
+	qtype uint16
+}
+
+// staticAnswer is a prebuilt response for one name and query type.
+type staticAnswer struct {
+	rrs   []dns.RR
+	rcode int
+}
+
+// buildStaticAnswers indexes the static_answers entries. Entries that fail to
+// parse are skipped; config validation rejects them before they get here.
+// A later entry for the same name and type replaces an earlier one.
+func buildStaticAnswers(entries []config.StaticAnswerEntry) map[staticAnswerKey]staticAnswer {
+	if len(entries) == 0 {
+		return nil
+	}
+	answers := make(map[staticAnswerKey]staticAnswer, len(entries))
+	for _, e := range entries {
+		qtype, ok := dns.StringToType[strings.ToUpper(e.Type)]
+		if !ok {
+			continue
+		}
+		rrs, err := e.RRs()
+		if err != nil {
+			continue
+		}
+		rcode, err := e.ResponseCode()
+		if err != nil {
+			continue
+		}
+		key := staticAnswerKey{name: strings.ToLower(dns.Fqdn(e.Domain)), qtype: qtype}
+		answers[key] = staticAnswer{rrs: rrs, rcode: rcode}
+	}
+	return answers
+}
+
+// lookupStaticAnswer returns the static answer for domain and qtype, if any.
+func lookupStaticAnswer(answers map[staticAnswerKey]staticAnswer, domain string, qtype uint16) (staticAnswer, bool) {
+	if len(answers) == 0 {
+		return staticAnswer{}, false
+	}
+	a, ok := answers[staticAnswerKey{name: strings.ToLower(dns.Fqdn(domain)), qtype: qtype}]
+	return a, ok
+}
+
+// serveStaticAnswer writes a configured static answer. Records are copied and
+// renamed to the question name so the reply echoes the client's casing.
+func (h *Handler) serveStaticAnswer(w dns.ResponseWriter, r, msg *dns.Msg, domain string, answer staticAnswer, trace *blockTraceRecorder, outcome *serveDNSOutcome) {
+	trace.Record(traceStageStaticAnswer, "answer", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "static_answers"
+		entry.Detail = "answered from static_answers"
+	})
+	for _, rr := range answer.rrs {
+		cp := dns.Copy(rr)
+		cp.Header().Name = domain
+		msg.Answer = append(msg.Answer, cp)
+	}
+	msg.SetRcode(r, answer.rcode)
+	outcome.responseCode = answer.rcode
+	h.writeMsg(w, r, msg)
+}
@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_StaticAnswers(t *testing.T) {
+	upstream := startRebindUpstream(t, map[string]string{"example.com.": "93.184.216.34"})
+	cfg := &config.Config{UpstreamDNSServers: []string{upstream}}
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(cfg, logging.NewDefault(), nil))
+	h.SetStaticAnswers([]config.StaticAnswerEntry{
+		{Domain: "example.com", Type: "TXT", TTL: 60, Values: []string{`"v=spf1 -all"`}},
+		{Domain: "pinned.example.com", Type: "a", Values: []string{"203.0.113.7", "203.0.113.8"}},
+		{Domain: "gone.example.com", Type: "AAAA", Rcode: "NXDOMAIN"},
+	})
+
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 5353}}
+		r := new(dns.Msg)
+		r.SetQuestion(name, qtype)
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	resp := query("Example.COM.", dns.TypeTXT)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("TXT: expected 1 static answer, got %d", len(resp.Answer))
+	}
+	txt, ok := resp.Answer[0].(*dns.TXT)
+	if !ok || txt.Txt[0] != "v=spf1 -all" || txt.Hdr.Ttl != 60 || txt.Hdr.Name != "Example.COM." {
+		t.Errorf("unexpected TXT answer %v", resp.Answer[0])
+	}
+
+	if resp := query("pinned.example.com.", dns.TypeA); len(resp.Answer) != 2 || resp.Answer[0].Header().Ttl != 300 {
+		t.Errorf("pinned A: expected 2 answers with the default TTL, got %v", resp.Answer)
+	}
+	if resp := query("gone.example.com.", dns.TypeAAAA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("expected NXDOMAIN, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Other types for the same name still go upstream.
+	resp = query("example.com.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "93.184.216.34" {
+		t.Errorf("A for example.com should be forwarded, got %v", resp.Answer)
+	}
+
+	if dec := h.Explain(context.Background(), "example.com", "192.168.1.10", dns.TypeTXT); dec.Stage != traceStageStaticAnswer {
+		t.Errorf("Explain stage = %q, want %q", dec.Stage, traceStageStaticAnswer)
+	}
+
+	h.SetStaticAnswers(nil)
+	if resp := query("pinned.example.com.", dns.TypeA); resp.Rcode == dns.RcodeSuccess && len(resp.Answer) == 2 {
+		t.Error("static answers should be gone after clearing")
+	}
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"glory-hole/pkg/telemetry"
+)
+
+// connLimiter caps the TCP and DoT client connections open at once, across
+// every listener it wraps. Connections over the cap are closed right after
+// accept rather than left in the kernel backlog, so clients holding
+// connections open can't starve everyone else.
+type connLimiter struct {
+	max     int64 // <= 0 = unlimited
+	open    atomic.Int64
+	metrics *telemetry.Metrics
+}
+
+func newConnLimiter(max int, metrics *telemetry.Metrics) *connLimiter {
+	return &connLimiter{max: int64(max), metrics: metrics}
+}
+
+// wrap returns ln with every accepted connection counted against the limit.
+func (l *connLimiter) wrap(ln net.Listener) net.Listener {
+	return &limitedListener{Listener: ln, limiter: l}
+}
+
+func (l *connLimiter) acquire() bool {
+	if n := l.open.Add(1); l.max > 0 && n > l.max {
+		l.open.Add(-1)
+		if l.metrics != nil && l.metrics.DNSTCPRejected != nil {
+			l.metrics.DNSTCPRejected.Add(context.Background(), 1)
+		}
+		return false
+	}
+	if l.metrics != nil && l.metrics.DNSTCPConnections != nil {
+		l.metrics.DNSTCPConnections.Add(context.Background(), 1)
+	}
+	return true
+}
+
+func (l *connLimiter) release() {
+	l.open.Add(-1)
+	if l.metrics != nil && l.metrics.DNSTCPConnections != nil {
+		l.metrics.DNSTCPConnections.Add(context.Background(), -1)
+	}
+}
+
+type limitedListener struct {
+	net.Listener
+	limiter *connLimiter
+}
+
+// Accept returns the next connection under the limit, closing any accepted
+// over it.
+func (ln *limitedListener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if ln.limiter.acquire() {
+			return &limitedConn{Conn: c, release: ln.limiter.release}, nil
+		}
+		_ = c.Close()
+	}
+}
+
+// limitedConn gives its slot back the first time it is closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
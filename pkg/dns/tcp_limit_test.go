@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnLimiter_ClosesExcessConnections(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := newConnLimiter(1, nil)
+	ln := limiter.wrap(raw)
+	defer func() { _ = ln.Close() }()
+
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	dial := func() net.Conn {
+		t.Helper()
+		c, err := net.Dial("tcp", raw.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	first := dial()
+	defer func() { _ = first.Close() }()
+	var held net.Conn
+	select {
+	case held = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("first connection was not accepted")
+	}
+
+	// Over the limit: closed by the server without being handed out
+	second := dial()
+	defer func() { _ = second.Close() }()
+	_ = second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the excess connection to be closed, got %v", err)
+	}
+	if got := limiter.open.Load(); got != 1 {
+		t.Errorf("open = %d, want 1", got)
+	}
+
+	// Closing twice frees exactly one slot
+	_ = held.Close()
+	_ = held.Close()
+	if got := limiter.open.Load(); got != 0 {
+		t.Errorf("open after close = %d, want 0", got)
+	}
+	third := dial()
+	defer func() { _ = third.Close() }()
+	select {
+	case c := <-accepted:
+		_ = c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection after a slot freed up was not accepted")
+	}
+}
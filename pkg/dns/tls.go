@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/logging"
 	"glory-hole/pkg/resolver"
 
@@ -48,13 +49,17 @@ func buildTLSResources(cfg *config.ServerConfig, upstreams []string, logger *log
 		return &tlsResources{}, nil
 	}
 
-	// Manual PEMs
+	// Manual PEMs, reloaded when the files change (see certReloader)
 	if cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		reloader, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile, logger)
 		if err != nil {
-			return nil, fmt.Errorf("load x509 key pair: %w", err)
+			return nil, err
 		}
-		return &tlsResources{TLSConfig: tlsConfigFromCert(&cert)}, nil
+		return &tlsResources{TLSConfig: &tls.Config{
+			GetCertificate: reloader.getCertificate,
+			MinVersion:     tls.VersionTLS13,
+			NextProtos:     []string{"dot", "h2", "http/1.1"},
+		}}, nil
 	}
 
 	// Native DNS-01 via Cloudflare
@@ -82,49 +87,47 @@ func buildTLSResources(cfg *config.ServerConfig, upstreams []string, logger *log
 	return nil, fmt.Errorf("DoT enabled but no TLS configuration provided")
 }
 
-func tlsConfigFromCert(cert *tls.Certificate) *tls.Config {
-	return &tls.Config{
-		Certificates: []tls.Certificate{*cert},
-		MinVersion:   tls.VersionTLS13,
-		NextProtos:   []string{"dot", "h2", "http/1.1"},
-	}
-}
-
 // ------------------------------------------------------------------
 // HTTP-01 Autocert (existing behavior)
 // ------------------------------------------------------------------
 
 func buildAutocert(cfg *config.ServerConfig, logger *logging.Logger) (*tls.Config, *http.Server, error) {
-	cacheDir := cfg.TLS.Autocert.CacheDir
-	if cacheDir == "" {
-		if usrCache, err := os.UserCacheDir(); err == nil {
-			cacheDir = filepath.Join(usrCache, "gloryhole-autocert")
-		} else {
-			cacheDir = "./.cache/autocert"
+	m := newAutocertManagerWrapper(cfg)
+
+	// With http01_via_api the API server answers challenges (see
+	// AutocertChallengeHandler), so no standalone listener is started.
+	var acmeHTTP *http.Server
+	if !cfg.TLS.Autocert.HTTP01ViaAPI {
+		acmeHTTP = &http.Server{
+			Addr:    cfg.TLS.Autocert.HTTP01Address,
+			Handler: m.HTTPHandler(),
 		}
 	}
 
-	m := &autocertManagerWrapper{
-		CacheDir: cacheDir,
-		Hosts:    cfg.TLS.Autocert.Hosts,
-		Email:    cfg.TLS.Autocert.Email,
-	}
-
-	acmeHTTP := &http.Server{
-		Addr:    cfg.TLS.Autocert.HTTP01Address,
-		Handler: m.HTTPHandler(),
-	}
-
 	tlsCfg := &tls.Config{
 		GetCertificate: m.GetCertificate,
 		MinVersion:     tls.VersionTLS13,
 		NextProtos:     []string{"dot", "h2", "http/1.1", "acme-tls/1"},
 	}
 
-	logger.Info("Autocert enabled for DoT (HTTP-01)", "hosts", cfg.TLS.Autocert.Hosts, "cache", cacheDir)
+	logger.Info("Autocert enabled for DoT (HTTP-01)",
+		"hosts", cfg.TLS.Autocert.Hosts,
+		"cache", m.CacheDir,
+		"via_api", cfg.TLS.Autocert.HTTP01ViaAPI)
 	return tlsCfg, acmeHTTP, nil
 }
 
+// AutocertChallengeHandler returns the HTTP-01 challenge handler for the DoT
+// autocert manager when tls.autocert.http01_via_api is set, or nil when the
+// challenges are not served by the API server. The API server mounts it at
+// /.well-known/acme-challenge/.
+func AutocertChallengeHandler(cfg *config.ServerConfig) http.Handler {
+	if cfg == nil || !cfg.DotEnabled || !cfg.TLS.Autocert.Enabled || !cfg.TLS.Autocert.HTTP01ViaAPI {
+		return nil
+	}
+	return newAutocertManagerWrapper(cfg).HTTPHandler()
+}
+
 // Minimal wrapper to avoid pulling in full autocert package into this file.
 // We keep implementation in autocert_impl.go to keep dependencies isolated.
 type autocertManagerWrapper struct {
@@ -133,6 +136,22 @@ type autocertManagerWrapper struct {
 	Email    string
 }
 
+func newAutocertManagerWrapper(cfg *config.ServerConfig) *autocertManagerWrapper {
+	cacheDir := cfg.TLS.Autocert.CacheDir
+	if cacheDir == "" {
+		if usrCache, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(usrCache, "gloryhole-autocert")
+		} else {
+			cacheDir = "./.cache/autocert"
+		}
+	}
+	return &autocertManagerWrapper{
+		CacheDir: cacheDir,
+		Hosts:    cfg.TLS.Autocert.Hosts,
+		Email:    cfg.TLS.Autocert.Email,
+	}
+}
+
 func (m *autocertManagerWrapper) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	return getAutocertManager(m.CacheDir, m.Hosts, m.Email).GetCertificate(hello)
 }
@@ -171,7 +190,7 @@ func newACMEManager(cfg *config.ServerConfig, upstreams []string, logger *loggin
 
 	mgr := &acmeManager{
 		cfg:         cfg,
-		upstreams:   upstreams,
+		upstreams:   dnscrypt.PlainUpstreams(upstreams), // lego resolves over plain DNS
 		logger:      logger,
 		stopCh:      make(chan struct{}),
 		renewBefore: cfg.TLS.ACME.RenewBefore,
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry span names for the resolution pipeline. Not to be confused
+// with the decision trace in trace.go, which is stored with the query log.
+const (
+	spanQuery     = "dns.query"
+	spanPolicy    = "dns.policy"
+	spanBlocklist = "dns.blocklist"
+	spanCache     = "dns.cache"
+	spanForward   = "dns.forward"
+)
+
+// noopSpan is returned when no tracer is configured so callers can End()
+// unconditionally without allocating.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// startSpan starts a span when a tracer is configured. Sampling is decided by
+// the tracer provider (telemetry.tracing_sample_rate); callers should guard
+// attribute construction with span.IsRecording().
+func startSpan(ctx context.Context, tracer trace.Tracer, name string) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, noopSpan
+	}
+	return tracer.Start(ctx, name)
+}
+
+// endQuerySpan tags the root query span with the final decision and ends it.
+// While query logging is paused the domain and client are left off.
+func endQuerySpan(span trace.Span, r *dns.Msg, clientIP string, outcome *serveDNSOutcome, paused bool) {
+	if span.IsRecording() {
+		if len(r.Question) > 0 {
+			span.SetAttributes(attribute.String("dns.type", dnsTypeLabel(r.Question[0].Qtype)))
+			if !paused {
+				span.SetAttributes(attribute.String("dns.domain", r.Question[0].Name))
+			}
+		}
+		if !paused {
+			span.SetAttributes(attribute.String("dns.client", clientIP))
+		}
+		span.SetAttributes(
+			attribute.String("dns.decision", outcomeDecision(outcome)),
+			attribute.Int("dns.rcode", outcome.responseCode),
+		)
+		if outcome.upstream != "" {
+			span.SetAttributes(attribute.String("dns.upstream", outcome.upstream))
+		}
+	}
+	span.End()
+}
+
+// outcomeDecision summarises how a query was answered.
+func outcomeDecision(outcome *serveDNSOutcome) string {
+	switch {
+	case outcome.blocked:
+		return "blocked"
+	case outcome.cached:
+		return "cached"
+	case outcome.upstream != "":
+		return "forwarded"
+	default:
+		return "answered"
+	}
+}
@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServeDNS_TracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	handler := NewHandler()
+	handler.SetTracer(provider.Tracer("test"))
+	handler.Blocklist["ads.example.com."] = struct{}{}
+
+	w := &mockResponseWriter{
+		remoteAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345},
+	}
+	r := new(dns.Msg)
+	r.SetQuestion("ads.example.com.", dns.TypeA)
+
+	handler.ServeDNS(context.Background(), w, r)
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan, len(spans))
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	root, ok := byName[spanQuery]
+	if !ok {
+		t.Fatalf("missing %s span, got %d spans", spanQuery, len(spans))
+	}
+	blk, ok := byName[spanBlocklist]
+	if !ok {
+		t.Fatalf("missing %s span", spanBlocklist)
+	}
+	if blk.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("blocklist span should be a child of the query span")
+	}
+	if _, ok := byName[spanForward]; ok {
+		t.Error("blocked query should not produce a forward span")
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if got := attrs["dns.decision"].AsString(); got != "blocked" {
+		t.Errorf("dns.decision = %q, want blocked", got)
+	}
+	if got := attrs["dns.domain"].AsString(); got != "ads.example.com." {
+		t.Errorf("dns.domain = %q", got)
+	}
+	if got := attrs["dns.type"].AsString(); got != "A" {
+		t.Errorf("dns.type = %q", got)
+	}
+}
+
+func TestServeDNS_NoTracer(t *testing.T) {
+	// Without a tracer the handler must not touch the span path at all.
+	handler := NewHandler()
+	w := &mockResponseWriter{
+		remoteAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345},
+	}
+	r := new(dns.Msg)
+	r.SetQuestion("unknown.example.com.", dns.TypeA)
+
+	handler.ServeDNS(context.Background(), w, r)
+
+	if w.msg == nil || w.msg.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN, got %v", w.msg)
+	}
+}
+
+func TestServeDNS_LoggingPausedHidesQueryDetails(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	var buf bytes.Buffer
+
+	handler := NewHandler()
+	handler.SetTracer(provider.Tracer("test"))
+	handler.SetLogger(&logging.Logger{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+	handler.SetSlowQueryThreshold(time.Nanosecond)
+	handler.SetKillSwitch(pausedSwitch{paused: true})
+
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.7"), Port: 12345}}
+	r := new(dns.Msg)
+	r.SetQuestion("private.example.com.", dns.TypeA)
+	handler.ServeDNS(context.Background(), w, r)
+
+	if strings.Contains(buf.String(), "Slow DNS query") {
+		t.Errorf("slow-query warning logged while logging is paused: %s", buf.String())
+	}
+	for _, s := range recorder.Ended() {
+		if s.Name() != spanQuery {
+			continue
+		}
+		for _, kv := range s.Attributes() {
+			if kv.Key == "dns.domain" || kv.Key == "dns.client" {
+				t.Errorf("span carries %s while logging is paused", kv.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/storage"
+
+	"github.com/miekg/dns"
+)
+
+const traceStageZoneTransfer = "zone_transfer"
+
+// serveZoneTransfer answers zone transfer requests (AXFR/IXFR) and NOTIFY
+// messages, which must never be forwarded upstream. Transfers are REFUSED
+// unless the client is in server.zone_transfer.allowed_clients; allowed
+// clients are sent the zone when it is one of server.zone_transfer.zones and
+// get NOTAUTH otherwise. A transfer takes several messages, so it is served
+// over TCP and DoT only: UDP queries get TC and anything else (DoH, which
+// returns a single message) is REFUSED. NOTIFY from an allowed client is
+// acknowledged so its primary stops retrying; from anyone else it returns
+// false and is answered as an unsupported opcode.
+func (h *Handler) serveZoneTransfer(w dns.ResponseWriter, r, msg *dns.Msg, clientIP string, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) bool {
+	notify := r.Opcode == dns.OpcodeNotify
+	if !notify && !isTransferQuery(r) {
+		return false
+	}
+	allowed := d.transferACL != nil && d.transferACL.IsAllowed(clientIP)
+
+	var rcode int
+	var action, detail string
+	switch {
+	case notify && !allowed:
+		return false
+	case notify:
+		rcode, action, detail = dns.RcodeSuccess, "notify_ack", "NOTIFY acknowledged from allowed client"
+	case !allowed:
+		rcode, action, detail = dns.RcodeRefused, "refuse", "zone transfer refused: client not in server.zone_transfer.allowed_clients"
+	default:
+		zone := strings.ToLower(r.Question[0].Name)
+		if _, ok := d.transferZones[zone]; !ok {
+			rcode, action, detail = dns.RcodeNotAuth, "not_auth", "zone transfer refused: "+zone+" is not in server.zone_transfer.zones"
+			break
+		}
+		if isUDP(w) {
+			// Transfers run over TCP only; TC sends the client there.
+			msg.Truncated = true
+			rcode, action, detail = dns.RcodeSuccess, "tcp_only", "zone transfer over UDP redirected to TCP"
+			break
+		}
+		if !isTCP(w) {
+			rcode, action, detail = dns.RcodeRefused, "tcp_only", "zone transfer refused: only served over TCP or DoT"
+			break
+		}
+		h.serveAXFR(w, r, msg, zone, clientIP, d, trace, outcome)
+		return true
+	}
+
+	trace.Record(traceStageZoneTransfer, action, func(entry *storage.BlockTraceEntry) {
+		entry.Source = "zone_transfer"
+		entry.Detail = detail
+	})
+	msg.SetRcode(r, rcode)
+	outcome.responseCode = rcode
+	h.writeMsg(w, r, msg)
+	return true
+}
+
+// axfrMessageBytes caps the records packed into each transfer message, well
+// under the 64 KiB DNS-over-TCP limit.
+const axfrMessageBytes = 16 * 1024
+
+// serveAXFR sends zone built from local records as a full transfer (RFC
+// 5936): the zone's SOA, every other record, then the SOA again, split across
+// as many messages as needed. IXFR requests get the same full transfer, which
+// RFC 1995 allows. A zone without an SOA local record at its origin can't be
+// transferred and gets SERVFAIL.
+func (h *Handler) serveAXFR(w dns.ResponseWriter, r, msg *dns.Msg, zone, clientIP string, d *handlerDeps, trace *blockTraceRecorder, outcome *serveDNSOutcome) {
+	var soa dns.RR
+	var body []dns.RR
+	if d.localRecords != nil {
+		for _, rec := range d.localRecords.ZoneRecords(zone) {
+			if rec.Type == localrecords.RecordTypeSOA && rec.Domain == zone {
+				if soa == nil {
+					soa = localRecordRRs(rec)[0]
+				}
+				continue
+			}
+			body = append(body, localRecordRRs(rec)...)
+		}
+	}
+
+	if soa == nil {
+		if lg := h.getLogger(); lg != nil {
+			lg.Warn("Zone transfer failed: zone has no SOA local record", "zone", zone, "client", clientIP)
+		}
+		trace.Record(traceStageZoneTransfer, "no_soa", func(entry *storage.BlockTraceEntry) {
+			entry.Source = "zone_transfer"
+			entry.Detail = "zone " + zone + " has no SOA local record"
+		})
+		msg.SetRcode(r, dns.RcodeServerFailure)
+		outcome.responseCode = dns.RcodeServerFailure
+		h.writeMsg(w, r, msg)
+		return
+	}
+
+	records := make([]dns.RR, 0, len(body)+2)
+	records = append(records, soa)
+	records = append(records, body...)
+	records = append(records, soa)
+
+	trace.Record(traceStageZoneTransfer, "transfer", func(entry *storage.BlockTraceEntry) {
+		entry.Source = "zone_transfer"
+		entry.Detail = fmt.Sprintf("%s of %s: %d records", dns.TypeToString[r.Question[0].Qtype], zone, len(records))
+	})
+	outcome.responseCode = dns.RcodeSuccess
+
+	for len(records) > 0 {
+		n, size := 0, 0
+		for n < len(records) && (n == 0 || size+dns.Len(records[n]) <= axfrMessageBytes) {
+			size += dns.Len(records[n])
+			n++
+		}
+		out := new(dns.Msg)
+		out.SetReply(r)
+		out.Authoritative = true
+		out.Answer = records[:n]
+		records = records[n:]
+		if err := h.sendMsg(w, r, out); err != nil {
+			if lg := h.getLogger(); lg != nil {
+				lg.Warn("Zone transfer aborted", "zone", zone, "client", clientIP, "error", err)
+			}
+			return
+		}
+	}
+
+	if lg := h.getLogger(); lg != nil {
+		lg.Info("Zone transfer served", "zone", zone, "client", clientIP)
+	}
+}
+
+// localRecordRRs converts a local record to resource records. A and AAAA
+// records yield one RR per address.
+func localRecordRRs(rec *localrecords.LocalRecord) []dns.RR {
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: rec.Domain, Rrtype: rrtype, Class: dns.ClassINET, Ttl: rec.TTL}
+	}
+	switch rec.Type {
+	case localrecords.RecordTypeA, localrecords.RecordTypeAAAA:
+		rrs := make([]dns.RR, 0, len(rec.IPs))
+		for _, ip := range rec.IPs {
+			if v4 := ip.To4(); v4 != nil && rec.Type == localrecords.RecordTypeA {
+				rrs = append(rrs, &dns.A{Hdr: hdr(dns.TypeA), A: v4})
+			} else if v4 == nil && rec.Type == localrecords.RecordTypeAAAA {
+				rrs = append(rrs, &dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: ip})
+			}
+		}
+		return rrs
+	case localrecords.RecordTypeCNAME:
+		return []dns.RR{&dns.CNAME{Hdr: hdr(dns.TypeCNAME), Target: rec.Target}}
+	case localrecords.RecordTypeTXT:
+		return []dns.RR{&dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: rec.TxtRecords}}
+	case localrecords.RecordTypeMX:
+		return []dns.RR{&dns.MX{Hdr: hdr(dns.TypeMX), Preference: rec.Priority, Mx: rec.Target}}
+	case localrecords.RecordTypePTR:
+		return []dns.RR{&dns.PTR{Hdr: hdr(dns.TypePTR), Ptr: rec.Target}}
+	case localrecords.RecordTypeSRV:
+		return []dns.RR{&dns.SRV{Hdr: hdr(dns.TypeSRV), Priority: rec.Priority, Weight: rec.Weight, Port: rec.Port, Target: rec.Target}}
+	case localrecords.RecordTypeNS:
+		return []dns.RR{&dns.NS{Hdr: hdr(dns.TypeNS), Ns: rec.Target}}
+	case localrecords.RecordTypeSOA:
+		return []dns.RR{&dns.SOA{Hdr: hdr(dns.TypeSOA), Ns: rec.Ns, Mbox: rec.Mbox, Serial: rec.Serial,
+			Refresh: rec.Refresh, Retry: rec.Retry, Expire: rec.Expire, Minttl: rec.Minttl}}
+	case localrecords.RecordTypeCAA:
+		return []dns.RR{&dns.CAA{Hdr: hdr(dns.TypeCAA), Flag: rec.CaaFlag, Tag: rec.CaaTag, Value: rec.CaaValue}}
+	}
+	return nil
+}
+
+// isTransferQuery reports whether r is an AXFR or IXFR request.
+func isTransferQuery(r *dns.Msg) bool {
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		return false
+	}
+	qtype := r.Question[0].Qtype
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/forwarder"
+	"glory-hole/pkg/localrecords"
+	"glory-hole/pkg/logging"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeDNS_ZoneTransfer(t *testing.T) {
+	upstream, queries := startZoneUpstream(t, map[string][]string{})
+	h := NewHandler()
+	h.SetForwarder(forwarder.NewForwarder(&config.Config{UpstreamDNSServers: []string{upstream}}, logging.NewDefault(), nil))
+
+	serve := func(client string, r *dns.Msg) *dns.Msg {
+		t.Helper()
+		w := &mockResponseWriter{remoteAddr: &net.TCPAddr{IP: net.ParseIP(client), Port: 5353}}
+		h.ServeDNS(context.Background(), w, r)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+	transfer := func(qtype uint16) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion("lan.", qtype)
+		return r
+	}
+	notify := func() *dns.Msg {
+		r := new(dns.Msg)
+		r.SetNotify("lan.")
+		return r
+	}
+
+	// Nobody is allowed by default.
+	for _, qtype := range []uint16{dns.TypeAXFR, dns.TypeIXFR} {
+		if resp := serve("192.168.1.53", transfer(qtype)); resp.Rcode != dns.RcodeRefused {
+			t.Errorf("%s: rcode = %s, want REFUSED", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])
+		}
+	}
+	if resp := serve("192.168.1.53", notify()); resp.Rcode != dns.RcodeNotImplemented {
+		t.Errorf("NOTIFY: rcode = %s, want NOTIMP", dns.RcodeToString[resp.Rcode])
+	}
+
+	h.SetZoneTransfer(config.ZoneTransferConfig{AllowedClients: []string{"192.168.1.53", "10.0.0.0/24"}})
+
+	if resp := serve("192.168.1.99", transfer(dns.TypeAXFR)); resp.Rcode != dns.RcodeRefused {
+		t.Errorf("unlisted client: rcode = %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+	}
+	if resp := serve("10.0.0.7", transfer(dns.TypeAXFR)); resp.Rcode != dns.RcodeNotAuth {
+		t.Errorf("allowed client, zone not served: rcode = %s, want NOTAUTH", dns.RcodeToString[resp.Rcode])
+	}
+	resp := serve("192.168.1.53", notify())
+	if resp.Rcode != dns.RcodeSuccess || resp.Opcode != dns.OpcodeNotify || len(resp.Question) != 1 {
+		t.Errorf("NOTIFY from allowed client: want NOERROR NOTIFY reply echoing the question, got %s opcode %d", dns.RcodeToString[resp.Rcode], resp.Opcode)
+	}
+	if resp := serve("192.168.1.99", notify()); resp.Rcode != dns.RcodeNotImplemented {
+		t.Errorf("NOTIFY from unlisted client: rcode = %s, want NOTIMP", dns.RcodeToString[resp.Rcode])
+	}
+
+	if n := queries.Load(); n != 0 {
+		t.Errorf("transfers and NOTIFY must never be forwarded, upstream saw %d queries", n)
+	}
+}
+
+func TestServeDNS_AXFR(t *testing.T) {
+	lr := localrecords.NewManager()
+	add := func(rec *localrecords.LocalRecord) {
+		t.Helper()
+		if err := lr.AddRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(localrecords.NewSOARecord("lan.", "ns.lan.", "hostmaster.lan.", 2026101701, 3600, 600, 86400, 300))
+	add(localrecords.NewARecord("nas.lan.", net.ParseIP("192.168.1.10")))
+	add(localrecords.NewCNAMERecord("files.lan.", "nas.lan."))
+	add(localrecords.NewMXRecord("lan.", "mail.lan.", 10))
+	disabled := localrecords.NewARecord("old.lan.", net.ParseIP("192.168.1.99"))
+	disabled.Enabled = false
+	add(disabled)
+	add(localrecords.NewARecord("host.other.", net.ParseIP("10.0.0.1")))
+	// Enough TXT data to need several messages.
+	for i := range 300 {
+		add(localrecords.NewTXTRecord(fmt.Sprintf("t%d.lan.", i), []string{strings.Repeat("x", 100)}))
+	}
+	add(localrecords.NewARecord("nosoa.test.", net.ParseIP("192.0.2.1")))
+
+	h := NewHandler()
+	h.SetLocalRecords(lr)
+	h.SetZoneTransfer(config.ZoneTransferConfig{AllowedClients: []string{"127.0.0.1"}, Zones: []string{"LAN", "nosoa.test."}})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dns.Server{Listener: ln, Net: "tcp", MsgAcceptFunc: acceptQuery,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) { h.ServeDNS(context.Background(), w, r) })}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	addr := ln.Addr().String()
+
+	for _, qtype := range []uint16{dns.TypeAXFR, dns.TypeIXFR} {
+		m := new(dns.Msg)
+		m.SetQuestion("lan.", qtype)
+		if qtype == dns.TypeIXFR {
+			m.Ns = append(m.Ns, &dns.SOA{Hdr: dns.RR_Header{Name: "lan.", Rrtype: dns.TypeSOA, Class: dns.ClassINET}, Ns: "ns.lan.", Mbox: "hostmaster.lan.", Serial: 1})
+		}
+		envelopes, err := new(dns.Transfer).In(m, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rrs []dns.RR
+		messages := 0
+		for env := range envelopes {
+			if env.Error != nil {
+				t.Fatalf("%s: %v", dns.TypeToString[qtype], env.Error)
+			}
+			messages++
+			rrs = append(rrs, env.RR...)
+		}
+
+		// SOA, MX, nas A, files CNAME, 300 TXT, SOA.
+		if want := 2 + 3 + 300; len(rrs) != want {
+			t.Fatalf("%s: got %d records, want %d", dns.TypeToString[qtype], len(rrs), want)
+		}
+		first, ok1 := rrs[0].(*dns.SOA)
+		last, ok2 := rrs[len(rrs)-1].(*dns.SOA)
+		if !ok1 || !ok2 || first.Serial != 2026101701 || last.Serial != first.Serial {
+			t.Errorf("%s: transfer must start and end with the zone SOA, got %v ... %v", dns.TypeToString[qtype], rrs[0], rrs[len(rrs)-1])
+		}
+		for _, rr := range rrs {
+			if name := rr.Header().Name; name == "old.lan." || !dns.IsSubDomain("lan.", name) {
+				t.Errorf("%s: unexpected record %v", dns.TypeToString[qtype], rr)
+			}
+		}
+		if messages < 2 {
+			t.Errorf("%s: expected the zone split across several messages, got %d", dns.TypeToString[qtype], messages)
+		}
+	}
+
+	// A zone without an SOA can't be transferred.
+	c := &dns.Client{Net: "tcp"}
+	m := new(dns.Msg)
+	m.SetQuestion("nosoa.test.", dns.TypeAXFR)
+	resp, _, err := c.Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("zone without SOA: rcode = %s, want SERVFAIL", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Over UDP the client is sent to TCP.
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5353}}
+	udp := &udpResponseWriter{mockResponseWriter: w}
+	m.SetQuestion("lan.", dns.TypeAXFR)
+	h.ServeDNS(context.Background(), udp, m)
+	if w.msg == nil || !w.msg.Truncated || len(w.msg.Answer) != 0 {
+		t.Errorf("AXFR over UDP should get an empty truncated reply, got %v", w.msg)
+	}
+
+	// A transport that isn't a stream (DoH keeps one message) is refused.
+	w = &mockResponseWriter{remoteAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5353}}
+	h.ServeDNS(context.Background(), w, m)
+	if w.msg == nil || w.msg.Rcode != dns.RcodeRefused || len(w.msg.Answer) != 0 {
+		t.Errorf("AXFR over a non-stream transport should be REFUSED, got %v", w.msg)
+	}
+
+	// server.compress_responses: false applies to transfer messages too.
+	h.SetCompressResponses(false)
+	w = &mockResponseWriter{remoteAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5353}}
+	h.ServeDNS(context.Background(), &tcpResponseWriter{mockResponseWriter: w}, m)
+	if w.msg == nil || len(w.msg.Answer) == 0 || w.msg.Compress {
+		t.Errorf("AXFR with compression disabled should be sent uncompressed, got %v", w.msg)
+	}
+}
+
+// udpResponseWriter reports a UDP local address so isUDP sees a UDP query.
+type udpResponseWriter struct {
+	*mockResponseWriter
+}
+
+func (u *udpResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+// tcpResponseWriter reports a TCP local address so isTCP sees a TCP query.
+type tcpResponseWriter struct {
+	*mockResponseWriter
+}
+
+func (t *tcpResponseWriter) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
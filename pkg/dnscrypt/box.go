@@ -0,0 +1,143 @@
+package dnscrypt
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/poly1305" //nolint:staticcheck // SA1019: secretbox-style XChaCha20 needs raw Poly1305; no AEAD matches libsodium's layout
+)
+
+// Encryption systems a certificate can advertise (es-version).
+const (
+	esXSalsa20Poly1305  uint16 = 0x0001
+	esXChacha20Poly1305 uint16 = 0x0002
+)
+
+const (
+	nonceSize    = 24
+	halfNonce    = nonceSize / 2
+	boxOverhead  = poly1305.TagSize
+	paddingBlock = 64
+)
+
+var errDecrypt = errors.New("dnscrypt: response failed authentication")
+
+// sharedKey derives the symmetric key for an es-version from our secret key
+// and the resolver's public key, matching libsodium's *_beforenm functions.
+func sharedKey(es uint16, secret, peer *[32]byte) ([32]byte, error) {
+	var key [32]byte
+	switch es {
+	case esXSalsa20Poly1305:
+		box.Precompute(&key, peer, secret)
+		return key, nil
+	case esXChacha20Poly1305:
+		dh, err := curve25519.X25519(secret[:], peer[:])
+		if err != nil {
+			return key, err
+		}
+		subkey, err := chacha20.HChaCha20(dh, make([]byte, 16))
+		if err != nil {
+			return key, err
+		}
+		copy(key[:], subkey)
+		return key, nil
+	}
+	return key, errors.New("dnscrypt: unsupported encryption system")
+}
+
+// seal encrypts msg as tag||ciphertext (libsodium's *_easy_afternm layout).
+func seal(es uint16, msg []byte, nonce *[nonceSize]byte, key *[32]byte) []byte {
+	if es == esXSalsa20Poly1305 {
+		return box.SealAfterPrecomputation(nil, msg, nonce, key)
+	}
+	out := make([]byte, boxOverhead+len(msg))
+	polyKey := xchachaStream(out[boxOverhead:], msg, nonce, key)
+	var tag [poly1305.TagSize]byte
+	poly1305.Sum(&tag, out[boxOverhead:], &polyKey)
+	copy(out, tag[:])
+	return out
+}
+
+// open reverses seal.
+func open(es uint16, sealed []byte, nonce *[nonceSize]byte, key *[32]byte) ([]byte, error) {
+	if len(sealed) < boxOverhead {
+		return nil, errDecrypt
+	}
+	if es == esXSalsa20Poly1305 {
+		msg, ok := box.OpenAfterPrecomputation(nil, sealed, nonce, key)
+		if !ok {
+			return nil, errDecrypt
+		}
+		return msg, nil
+	}
+
+	// Derive the Poly1305 key without decrypting, then verify before XOR.
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		return nil, err
+	}
+	var polyKey [32]byte
+	c.XORKeyStream(polyKey[:], polyKey[:])
+	var tag [poly1305.TagSize]byte
+	poly1305.Sum(&tag, sealed[boxOverhead:], &polyKey)
+	if subtle.ConstantTimeCompare(tag[:], sealed[:boxOverhead]) != 1 {
+		return nil, errDecrypt
+	}
+	msg := make([]byte, len(sealed)-boxOverhead)
+	xchachaStream(msg, sealed[boxOverhead:], nonce, key)
+	return msg, nil
+}
+
+// xchachaStream XORs src into dst with the XChaCha20 keystream the way
+// crypto_secretbox_xchacha20poly1305 does: the first 32 bytes of block 0 are
+// the Poly1305 key (returned) and the message starts at byte 32.
+func xchachaStream(dst, src []byte, nonce *[nonceSize]byte, key *[32]byte) [32]byte {
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		panic(err) // key and nonce sizes are fixed by the array types
+	}
+	var block0 [64]byte
+	c.XORKeyStream(block0[:], block0[:])
+	var polyKey [32]byte
+	copy(polyKey[:], block0[:32])
+
+	head := min(len(src), 32)
+	for i := 0; i < head; i++ {
+		dst[i] = src[i] ^ block0[32+i]
+	}
+	if len(src) > head {
+		c.XORKeyStream(dst[head:], src[head:])
+	}
+	return polyKey
+}
+
+// pad appends the ISO/IEC 7816-4 padding DNSCrypt uses (0x80 then zeros) so
+// the result is a multiple of 64 bytes and at least minLen long.
+func pad(msg []byte, minLen int) []byte {
+	n := len(msg) + 1
+	if n < minLen {
+		n = minLen
+	}
+	if rem := n % paddingBlock; rem != 0 {
+		n += paddingBlock - rem
+	}
+	out := make([]byte, n)
+	copy(out, msg)
+	out[len(msg)] = 0x80
+	return out
+}
+
+// unpad strips the padding added by pad.
+func unpad(msg []byte) ([]byte, error) {
+	i := len(msg) - 1
+	for i >= 0 && msg[i] == 0 {
+		i--
+	}
+	if i < 0 || msg[i] != 0x80 {
+		return nil, errors.New("dnscrypt: invalid padding")
+	}
+	return msg[:i], nil
+}
@@ -0,0 +1,115 @@
+package dnscrypt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// certMagic opens every DNSCrypt certificate ("DNSC").
+var certMagic = []byte{0x44, 0x4e, 0x53, 0x43}
+
+// certSize is the length of a certificate without extensions:
+// magic(4) es(2) minor(2) signature(64) resolver-pk(32) client-magic(8)
+// serial(4) ts-start(4) ts-end(4).
+const certSize = 124
+
+// cert is a verified resolver certificate.
+type cert struct {
+	es          uint16
+	resolverPK  [32]byte
+	clientMagic [8]byte
+	serial      uint32
+	notBefore   time.Time
+	notAfter    time.Time
+}
+
+// parseCert decodes and verifies one certificate against the provider key.
+func parseCert(raw []byte, providerKey ed25519.PublicKey, now time.Time) (*cert, error) {
+	if len(raw) < certSize || !bytes.Equal(raw[:4], certMagic) {
+		return nil, errors.New("not a DNSCrypt certificate")
+	}
+	es := binary.BigEndian.Uint16(raw[4:6])
+	if es != esXSalsa20Poly1305 && es != esXChacha20Poly1305 {
+		return nil, fmt.Errorf("unsupported encryption system %d", es)
+	}
+	// The signature covers everything after it, extensions included.
+	if !ed25519.Verify(providerKey, raw[72:], raw[8:72]) {
+		return nil, errors.New("certificate signature does not match the provider key")
+	}
+
+	c := &cert{
+		es:        es,
+		serial:    binary.BigEndian.Uint32(raw[112:116]),
+		notBefore: time.Unix(int64(binary.BigEndian.Uint32(raw[116:120])), 0),
+		notAfter:  time.Unix(int64(binary.BigEndian.Uint32(raw[120:124])), 0),
+	}
+	copy(c.resolverPK[:], raw[72:104])
+	copy(c.clientMagic[:], raw[104:112])
+	if now.Before(c.notBefore) || now.After(c.notAfter) {
+		return nil, fmt.Errorf("certificate %d is valid %s to %s", c.serial,
+			c.notBefore.UTC().Format(time.RFC3339), c.notAfter.UTC().Format(time.RFC3339))
+	}
+	return c, nil
+}
+
+// bestCert picks the usable certificate with the highest serial from a
+// certificate response, preferring XChaCha20 on a tie.
+func bestCert(resp *dns.Msg, providerKey ed25519.PublicKey, now time.Time) (*cert, error) {
+	var best *cert
+	var lastErr error
+	for _, rr := range resp.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		c, err := parseCert(txtBytes(txt.Txt), providerKey, now)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if best == nil || c.serial > best.serial || (c.serial == best.serial && c.es > best.es) {
+			best = c
+		}
+	}
+	if best == nil {
+		if lastErr == nil {
+			lastErr = errors.New("no certificates in response")
+		}
+		return nil, lastErr
+	}
+	return best, nil
+}
+
+// txtBytes joins TXT character-strings back into raw bytes. miekg/dns keeps
+// them in presentation form, so binary certificates arrive with \DDD and
+// \X escapes.
+func txtBytes(parts []string) []byte {
+	var out []byte
+	for _, s := range parts {
+		for i := 0; i < len(s); i++ {
+			if s[i] != '\\' || i+1 >= len(s) {
+				out = append(out, s[i])
+				continue
+			}
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				if v, err := strconv.Atoi(s[i+1 : i+4]); err == nil && v < 256 {
+					out = append(out, byte(v))
+					i += 3
+					continue
+				}
+			}
+			out = append(out, s[i+1])
+			i++
+		}
+	}
+	return out
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
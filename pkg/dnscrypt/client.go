@@ -0,0 +1,265 @@
+package dnscrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// resolverMagic opens every DNSCrypt response.
+var resolverMagic = []byte{0x72, 0x36, 0x66, 0x6e, 0x76, 0x57, 0x6a, 0x38}
+
+const (
+	// minQueryLen is the smallest padded UDP query, so a response can't be
+	// used for amplification.
+	minQueryLen = 256
+	// certRefresh bounds how long a certificate is reused before the
+	// resolver is asked again, so rotated keys are picked up.
+	certRefresh = time.Hour
+)
+
+// ErrHandshake wraps failures to fetch or verify a resolver certificate.
+var ErrHandshake = errors.New("dnscrypt handshake failed")
+
+// session is a verified certificate plus the key shared with the resolver.
+type session struct {
+	cert      *cert
+	shared    [32]byte
+	fetchedAt time.Time
+}
+
+// Client sends queries to DNSCrypt resolvers. It is safe for concurrent use
+// and caches one certificate per resolver.
+type Client struct {
+	// timeout bounds each network exchange (certificate fetch or query), as
+	// a time.Duration; see SetTimeout.
+	timeout atomic.Int64
+
+	publicKey, secretKey *[32]byte
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewClient creates a client with a fresh X25519 key pair.
+func NewClient(timeout time.Duration) (*Client, error) {
+	pub, sec, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		publicKey: pub,
+		secretKey: sec,
+		sessions:  make(map[string]*session),
+	}
+	c.SetTimeout(timeout)
+	return c, nil
+}
+
+// Timeout returns the bound on each network exchange.
+func (c *Client) Timeout() time.Duration {
+	return time.Duration(c.timeout.Load())
+}
+
+// SetTimeout changes the bound on each network exchange. It is safe to call
+// while queries are in flight; they keep the timeout they started with.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.timeout.Store(int64(timeout))
+}
+
+// Exchange sends m to the resolver over UDP, retrying over TCP when the
+// answer is truncated. The certificate is fetched on first use; any failure
+// drops it so the next query handshakes again.
+func (c *Client) Exchange(ctx context.Context, m *dns.Msg, s *Server) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+	sess, err := c.session(ctx, s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := c.exchange(ctx, m, s, sess, "udp")
+	if err == nil && resp.Truncated {
+		resp, err = c.exchange(ctx, m, s, sess, "tcp")
+	}
+	if err != nil {
+		c.forget(s)
+		return nil, 0, err
+	}
+	return resp, time.Since(start), nil
+}
+
+// session returns the cached session for s, handshaking when it is missing,
+// expired or due for a refresh.
+func (c *Client) session(ctx context.Context, s *Server) (*session, error) {
+	now := time.Now()
+	key := s.key()
+
+	c.mu.Lock()
+	sess := c.sessions[key]
+	c.mu.Unlock()
+	if sess != nil && now.Before(sess.cert.notAfter) && now.Sub(sess.fetchedAt) < certRefresh {
+		return sess, nil
+	}
+
+	sess, err := c.handshake(ctx, s, now)
+	if err != nil {
+		return nil, fmt.Errorf("%w with %s: %v", ErrHandshake, s.Address, err)
+	}
+	c.mu.Lock()
+	c.sessions[key] = sess
+	c.mu.Unlock()
+	return sess, nil
+}
+
+func (c *Client) forget(s *Server) {
+	c.mu.Lock()
+	delete(c.sessions, s.key())
+	c.mu.Unlock()
+}
+
+// handshake fetches the provider's certificates with a plain TXT query and
+// derives the shared key for the best one.
+func (c *Client) handshake(ctx context.Context, s *Server, now time.Time) (*session, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(s.ProviderName, dns.TypeTXT)
+	q.SetEdns0(dns.DefaultMsgSize, false)
+
+	dc := &dns.Client{Net: "udp", Timeout: c.Timeout(), UDPSize: dns.DefaultMsgSize}
+	resp, _, err := dc.ExchangeContext(ctx, q, s.Address)
+	if err == nil && resp.Truncated {
+		dc.Net = "tcp"
+		resp, _, err = dc.ExchangeContext(ctx, q, s.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("certificate query answered %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	crt, err := bestCert(resp, s.PublicKey, now)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := sharedKey(crt.es, c.secretKey, &crt.resolverPK)
+	if err != nil {
+		return nil, err
+	}
+	return &session{cert: crt, shared: shared, fetchedAt: now}, nil
+}
+
+// exchange performs one encrypted round trip over network ("udp" or "tcp").
+func (c *Client) exchange(ctx context.Context, m *dns.Msg, s *Server, sess *session, network string) (*dns.Msg, error) {
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	minLen := minQueryLen
+	if network == "tcp" {
+		minLen = 0
+	}
+
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:halfNonce]); err != nil {
+		return nil, err
+	}
+	query := make([]byte, 0, 8+32+halfNonce+boxOverhead+len(packed)+paddingBlock+minLen)
+	query = append(query, sess.cert.clientMagic[:]...)
+	query = append(query, c.publicKey[:]...)
+	query = append(query, nonce[:halfNonce]...)
+	query = append(query, seal(sess.cert.es, pad(packed, minLen), &nonce, &sess.shared)...)
+
+	raw, err := c.roundTrip(ctx, s.Address, network, query)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptResponse(raw, &nonce, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(plain); err != nil {
+		return nil, fmt.Errorf("dnscrypt: malformed response: %w", err)
+	}
+	if resp.Id != m.Id {
+		return nil, dns.ErrId
+	}
+	return resp, nil
+}
+
+// decryptResponse checks the resolver magic and our half of the nonce, then
+// authenticates, decrypts and unpads the response.
+func decryptResponse(raw []byte, clientNonce *[nonceSize]byte, sess *session) ([]byte, error) {
+	if len(raw) < len(resolverMagic)+nonceSize+boxOverhead || !bytes.Equal(raw[:len(resolverMagic)], resolverMagic) {
+		return nil, errors.New("dnscrypt: not a DNSCrypt response")
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], raw[len(resolverMagic):])
+	if !bytes.Equal(nonce[:halfNonce], clientNonce[:halfNonce]) {
+		return nil, errors.New("dnscrypt: response nonce does not match the query")
+	}
+	plain, err := open(sess.cert.es, raw[len(resolverMagic)+nonceSize:], &nonce, &sess.shared)
+	if err != nil {
+		return nil, err
+	}
+	return unpad(plain)
+}
+
+// roundTrip sends one packet and reads one reply. TCP messages carry a
+// two-byte length prefix as in plain DNS.
+func (c *Client) roundTrip(ctx context.Context, addr, network string, packet []byte) ([]byte, error) {
+	if timeout := c.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, dns.MaxMsgSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	framed := make([]byte, 2+len(packet))
+	binary.BigEndian.PutUint16(framed, uint16(len(packet)))
+	copy(framed[2:], packet)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
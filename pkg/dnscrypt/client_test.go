@@ -0,0 +1,322 @@
+package dnscrypt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// testResolver is a minimal DNSCrypt resolver: it serves its certificate
+// over plain DNS and answers encrypted A queries with 192.0.2.1.
+type testResolver struct {
+	server   *Server
+	es       uint16
+	pub, sec *[32]byte
+	cert     []byte
+
+	truncateUDP bool         // set TC on every UDP answer
+	tcpQueries  atomic.Int32 // encrypted queries received over TCP
+}
+
+func startTestResolver(t *testing.T, es uint16, validFor time.Duration) *testResolver {
+	t.Helper()
+	providerPub, providerSec, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, sec, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := make([]byte, certSize)
+	copy(crt, certMagic)
+	binary.BigEndian.PutUint16(crt[4:], es)
+	copy(crt[72:], pub[:])
+	copy(crt[104:], pub[:8]) // client magic
+	binary.BigEndian.PutUint32(crt[112:], 1)
+	now := time.Now()
+	binary.BigEndian.PutUint32(crt[116:], uint32(now.Add(-time.Hour).Unix()))
+	binary.BigEndian.PutUint32(crt[120:], uint32(now.Add(validFor).Unix()))
+	copy(crt[8:72], ed25519.Sign(providerSec, crt[72:]))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		_ = pc.Close()
+		t.Skipf("TCP port not free: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = pc.Close()
+		_ = ln.Close()
+	})
+
+	r := &testResolver{
+		server: &Server{
+			Address:      pc.LocalAddr().String(),
+			ProviderName: "2.dnscrypt-cert.test.example.",
+			PublicKey:    providerPub,
+		},
+		es:   es,
+		pub:  pub,
+		sec:  sec,
+		cert: crt,
+	}
+	go r.serveUDP(pc)
+	go r.serveTCP(ln)
+	return r
+}
+
+func (r *testResolver) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if out := r.handle(buf[:n], "udp"); out != nil {
+			_, _ = pc.WriteTo(out, addr)
+		}
+	}
+}
+
+func (r *testResolver) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			out := r.handle(buf, "tcp")
+			if out == nil {
+				return
+			}
+			framed := binary.BigEndian.AppendUint16(nil, uint16(len(out)))
+			_, _ = conn.Write(append(framed, out...))
+		}()
+	}
+}
+
+func (r *testResolver) handle(packet []byte, network string) []byte {
+	if len(packet) > 8 && string(packet[:8]) == string(r.pub[:8]) {
+		return r.handleEncrypted(packet, network)
+	}
+
+	q := new(dns.Msg)
+	if q.Unpack(packet) != nil || len(q.Question) == 0 {
+		return nil
+	}
+	resp := new(dns.Msg)
+	resp.SetReply(q)
+	if q.Question[0].Qtype == dns.TypeTXT && q.Question[0].Name == r.server.ProviderName {
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{escapeTXT(r.cert)},
+		})
+	} else {
+		resp.Rcode = dns.RcodeRefused
+	}
+	out, _ := resp.Pack()
+	return out
+}
+
+func (r *testResolver) handleEncrypted(packet []byte, network string) []byte {
+	if network == "tcp" {
+		r.tcpQueries.Add(1)
+	}
+	var clientPK [32]byte
+	copy(clientPK[:], packet[8:40])
+	var nonce [nonceSize]byte
+	copy(nonce[:], packet[40:40+halfNonce])
+	shared, err := sharedKey(r.es, r.sec, &clientPK)
+	if err != nil {
+		return nil
+	}
+	plain, err := open(r.es, packet[40+halfNonce:], &nonce, &shared)
+	if err != nil {
+		return nil
+	}
+	if network == "udp" && len(plain) < minQueryLen {
+		return nil // an unpadded UDP query must be dropped
+	}
+	msg, err := unpad(plain)
+	if err != nil {
+		return nil
+	}
+	q := new(dns.Msg)
+	if q.Unpack(msg) != nil {
+		return nil
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(q)
+	if network == "udp" && r.truncateUDP {
+		resp.Truncated = true
+	} else {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.0.2.1"),
+		})
+	}
+	packed, _ := resp.Pack()
+
+	_, _ = rand.Read(nonce[halfNonce:])
+	out := append([]byte{}, resolverMagic...)
+	out = append(out, nonce[:]...)
+	return append(out, seal(r.es, pad(packed, 0), &nonce, &shared)...)
+}
+
+// escapeTXT renders binary data as a TXT character-string in presentation form.
+func escapeTXT(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' || c == ';' {
+			fmt.Fprintf(&b, "\\%03d", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func query(t *testing.T, c *Client, s *Server) (*dns.Msg, error) {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	resp, _, err := c.Exchange(context.Background(), m, s)
+	return resp, err
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewClient(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClient_Exchange(t *testing.T) {
+	for _, es := range []uint16{esXSalsa20Poly1305, esXChacha20Poly1305} {
+		t.Run(fmt.Sprintf("es=%d", es), func(t *testing.T) {
+			r := startTestResolver(t, es, time.Hour)
+			c := newTestClient(t)
+
+			for i := 0; i < 2; i++ { // second query reuses the cached certificate
+				resp, err := query(t, c, r.server)
+				if err != nil {
+					t.Fatalf("Exchange() error = %v", err)
+				}
+				if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+					t.Fatalf("unexpected answer: %v", resp.Answer)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_TruncatedRetriesOverTCP(t *testing.T) {
+	r := startTestResolver(t, esXChacha20Poly1305, time.Hour)
+	r.truncateUDP = true
+
+	resp, err := query(t, newTestClient(t), r.server)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if resp.Truncated || len(resp.Answer) != 1 {
+		t.Errorf("expected the full TCP answer, got %v", resp)
+	}
+	if r.tcpQueries.Load() != 1 {
+		t.Errorf("expected 1 TCP query, got %d", r.tcpQueries.Load())
+	}
+}
+
+func TestClient_HandshakeFailures(t *testing.T) {
+	t.Run("wrong provider key", func(t *testing.T) {
+		r := startTestResolver(t, esXSalsa20Poly1305, time.Hour)
+		other, _, _ := ed25519.GenerateKey(rand.Reader)
+		s := *r.server
+		s.PublicKey = other
+		if _, err := query(t, newTestClient(t), &s); !errors.Is(err, ErrHandshake) {
+			t.Errorf("expected ErrHandshake, got %v", err)
+		}
+	})
+	t.Run("expired certificate", func(t *testing.T) {
+		r := startTestResolver(t, esXSalsa20Poly1305, -time.Minute)
+		if _, err := query(t, newTestClient(t), r.server); !errors.Is(err, ErrHandshake) {
+			t.Errorf("expected ErrHandshake, got %v", err)
+		}
+	})
+	t.Run("plain DNS server", func(t *testing.T) {
+		r := startTestResolver(t, esXSalsa20Poly1305, time.Hour)
+		s := *r.server
+		s.ProviderName = "not-the-provider.example."
+		if _, err := query(t, newTestClient(t), &s); !errors.Is(err, ErrHandshake) {
+			t.Errorf("expected ErrHandshake, got %v", err)
+		}
+	})
+}
+
+func TestSealOpen(t *testing.T) {
+	var key [32]byte
+	var nonce [nonceSize]byte
+	_, _ = rand.Read(key[:])
+	_, _ = rand.Read(nonce[:])
+	for _, es := range []uint16{esXSalsa20Poly1305, esXChacha20Poly1305} {
+		for _, size := range []int{0, 1, 31, 32, 33, 64, 300} {
+			msg := make([]byte, size)
+			_, _ = rand.Read(msg)
+			sealed := seal(es, msg, &nonce, &key)
+			got, err := open(es, sealed, &nonce, &key)
+			if err != nil || string(got) != string(msg) {
+				t.Fatalf("es=%d size=%d: round trip failed: %v", es, size, err)
+			}
+			sealed[len(sealed)-1] ^= 1
+			if _, err := open(es, sealed, &nonce, &key); err == nil {
+				t.Fatalf("es=%d size=%d: tampered message authenticated", es, size)
+			}
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	for _, tc := range []struct{ msg, minLen, want int }{
+		{msg: 30, minLen: 256, want: 256},
+		{msg: 63, minLen: 0, want: 64},
+		{msg: 64, minLen: 0, want: 128},
+		{msg: 300, minLen: 256, want: 320},
+	} {
+		padded := pad(make([]byte, tc.msg), tc.minLen)
+		if len(padded) != tc.want {
+			t.Errorf("pad(%d, %d) length = %d, want %d", tc.msg, tc.minLen, len(padded), tc.want)
+		}
+		got, err := unpad(padded)
+		if err != nil || len(got) != tc.msg {
+			t.Errorf("unpad(pad(%d)) = %d bytes, %v", tc.msg, len(got), err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package dnscrypt implements a DNSCrypt v2 client for forwarding queries to
+// resolvers that only offer DNSCrypt. Upstreams are written either as a DNS
+// stamp ("sdns://...") or as an explicit URL carrying the provider name and
+// public key:
+//
+//	dnscrypt://2.dnscrypt-cert.example.com@203.0.113.1:443?pk=<64 hex chars>
+//
+// See https://dnscrypt.info/protocol and https://dnscrypt.info/stamps-specifications.
+package dnscrypt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	stampScheme = "sdns://"
+	urlScheme   = "dnscrypt://"
+
+	stampProtoDNSCrypt = 0x01
+	defaultPort        = "443"
+)
+
+// ErrInvalidUpstream is returned for malformed stamps and dnscrypt:// URLs.
+var ErrInvalidUpstream = errors.New("invalid dnscrypt upstream")
+
+// Server identifies a DNSCrypt resolver.
+type Server struct {
+	Address      string            // host:port the resolver listens on
+	ProviderName string            // FQDN queried for certificates, e.g. "2.dnscrypt-cert.example.com."
+	PublicKey    ed25519.PublicKey // provider key that signs the certificates
+}
+
+// IsUpstream reports whether an upstream string names a DNSCrypt resolver
+// rather than a plain host:port.
+func IsUpstream(upstream string) bool {
+	lower := strings.ToLower(upstream)
+	return strings.HasPrefix(lower, stampScheme) || strings.HasPrefix(lower, urlScheme)
+}
+
+// PlainUpstreams returns upstreams without the DNSCrypt entries, for callers
+// that can only speak plain DNS.
+func PlainUpstreams(upstreams []string) []string {
+	plain := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		if !IsUpstream(upstream) {
+			plain = append(plain, upstream)
+		}
+	}
+	return plain
+}
+
+// ParseUpstream parses a DNS stamp or dnscrypt:// URL.
+func ParseUpstream(upstream string) (*Server, error) {
+	lower := strings.ToLower(upstream)
+	switch {
+	case strings.HasPrefix(lower, stampScheme):
+		return parseStamp(upstream[len(stampScheme):])
+	case strings.HasPrefix(lower, urlScheme):
+		return parseURL(upstream)
+	}
+	return nil, fmt.Errorf("%w: %q is not a sdns:// stamp or dnscrypt:// URL", ErrInvalidUpstream, upstream)
+}
+
+// parseStamp decodes the DNSCrypt form of a DNS stamp:
+// 0x01 | props (8 bytes LE) | LP(addr) | LP(pk) | LP(provider name).
+func parseStamp(encoded string) (*Server, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: stamp is not base64url: %v", ErrInvalidUpstream, err)
+	}
+	if len(raw) < 1 || raw[0] != stampProtoDNSCrypt {
+		return nil, fmt.Errorf("%w: stamp is not a DNSCrypt stamp", ErrInvalidUpstream)
+	}
+	if len(raw) < 9 {
+		return nil, fmt.Errorf("%w: stamp is truncated", ErrInvalidUpstream)
+	}
+	rest := raw[9:] // skip the DNSSEC/no-log/no-filter properties; they're informational
+
+	var fields [3][]byte
+	for i := range fields {
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return nil, fmt.Errorf("%w: stamp is truncated", ErrInvalidUpstream)
+		}
+		n := int(rest[0])
+		fields[i], rest = rest[1:1+n], rest[1+n:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: stamp has trailing data", ErrInvalidUpstream)
+	}
+	return newServer(string(fields[0]), fields[1], string(fields[2]))
+}
+
+// parseURL decodes dnscrypt://<provider-name>@<host[:port]>?pk=<hex>.
+func parseURL(upstream string) (*Server, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUpstream, err)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("%w: %q has no provider name (dnscrypt://<provider>@<host>)", ErrInvalidUpstream, upstream)
+	}
+	pk, err := hex.DecodeString(strings.ReplaceAll(u.Query().Get("pk"), ":", ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: pk is not hex: %v", ErrInvalidUpstream, err)
+	}
+	return newServer(u.Host, pk, u.User.Username())
+}
+
+func newServer(addr string, pk []byte, provider string) (*Server, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("%w: empty resolver address", ErrInvalidUpstream)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// No port (IPv6 literals arrive bracketed)
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), defaultPort)
+	}
+	if len(pk) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: public key must be %d bytes, got %d", ErrInvalidUpstream, ed25519.PublicKeySize, len(pk))
+	}
+	if provider == "" {
+		return nil, fmt.Errorf("%w: empty provider name", ErrInvalidUpstream)
+	}
+	if _, ok := dns.IsDomainName(provider); !ok {
+		return nil, fmt.Errorf("%w: provider name %q is not a domain name", ErrInvalidUpstream, provider)
+	}
+	return &Server{
+		Address:      addr,
+		ProviderName: dns.Fqdn(provider),
+		PublicKey:    ed25519.PublicKey(pk),
+	}, nil
+}
+
+// Stamp encodes s as a sdns:// DNS stamp with no properties set.
+func (s *Server) Stamp() string {
+	raw := []byte{stampProtoDNSCrypt, 0, 0, 0, 0, 0, 0, 0, 0}
+	for _, field := range [][]byte{[]byte(s.Address), s.PublicKey, []byte(strings.TrimSuffix(s.ProviderName, "."))} {
+		raw = append(raw, byte(len(field)))
+		raw = append(raw, field...)
+	}
+	return stampScheme + base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// key identifies the server in the certificate cache.
+func (s *Server) key() string {
+	return s.Address + "|" + s.ProviderName + "|" + hex.EncodeToString(s.PublicKey)
+}
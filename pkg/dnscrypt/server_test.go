@@ -0,0 +1,78 @@
+package dnscrypt
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// adguardStamp is AdGuard DNS's published DNSCrypt stamp.
+const adguardStamp = "sdns://AQIAAAAAAAAAFDE3Ni4xMDMuMTMwLjEzMDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20"
+
+func TestParseUpstream_Stamp(t *testing.T) {
+	s, err := ParseUpstream(adguardStamp)
+	if err != nil {
+		t.Fatalf("ParseUpstream() error = %v", err)
+	}
+	if s.Address != "176.103.130.130:5443" {
+		t.Errorf("Address = %q", s.Address)
+	}
+	if s.ProviderName != "2.dnscrypt.default.ns1.adguard.com." {
+		t.Errorf("ProviderName = %q", s.ProviderName)
+	}
+	if got := hex.EncodeToString(s.PublicKey); !strings.HasPrefix(got, "d12b47f2") {
+		t.Errorf("PublicKey = %s", got)
+	}
+
+	again, err := ParseUpstream(s.Stamp())
+	if err != nil || again.key() != s.key() {
+		t.Errorf("Stamp() round trip = %+v, %v", again, err)
+	}
+}
+
+func TestParseUpstream_URL(t *testing.T) {
+	pk := strings.Repeat("ab", 32)
+	s, err := ParseUpstream("dnscrypt://2.dnscrypt-cert.example.com@203.0.113.1?pk=" + pk)
+	if err != nil {
+		t.Fatalf("ParseUpstream() error = %v", err)
+	}
+	if s.Address != "203.0.113.1:443" {
+		t.Errorf("Address = %q, want default port 443", s.Address)
+	}
+	if s.ProviderName != "2.dnscrypt-cert.example.com." {
+		t.Errorf("ProviderName = %q", s.ProviderName)
+	}
+	if hex.EncodeToString(s.PublicKey) != pk {
+		t.Errorf("PublicKey = %x", s.PublicKey)
+	}
+}
+
+func TestParseUpstream_Invalid(t *testing.T) {
+	for _, upstream := range []string{
+		"1.1.1.1:53",
+		"sdns://not base64!",
+		"sdns://AgcAAAAAAAAAAAAHOS45LjkuOQA", // DoH stamp
+		"sdns://AQIAAAAAAAAAFDE3Ni4xMDMuMTMwLjEzMDo1NDQz",
+		"dnscrypt://203.0.113.1:443?pk=" + strings.Repeat("ab", 32),
+		"dnscrypt://2.dnscrypt-cert.example.com@203.0.113.1:443?pk=abcd",
+	} {
+		if _, err := ParseUpstream(upstream); !errors.Is(err, ErrInvalidUpstream) {
+			t.Errorf("ParseUpstream(%q) error = %v, want ErrInvalidUpstream", upstream, err)
+		}
+	}
+}
+
+func TestIsUpstream(t *testing.T) {
+	for upstream, want := range map[string]bool{
+		adguardStamp:                     true,
+		"DNSCrypt://p@203.0.113.1?pk=00": true,
+		"1.1.1.1:53":                     false,
+		"[2606:4700:4700::1111]:53":      false,
+		"https://dns.example/dns-query":  false,
+	} {
+		if got := IsUpstream(upstream); got != want {
+			t.Errorf("IsUpstream(%q) = %v, want %v", upstream, got, want)
+		}
+	}
+}
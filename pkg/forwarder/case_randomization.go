@@ -0,0 +1,85 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrCaseMismatch is returned when an upstream answer doesn't echo the
+// randomized case of the query name (forwarder.case_randomization). An
+// off-path spoofer has to guess the case of every letter as well as the
+// query ID and source port, so a mismatch is treated as a failed exchange.
+var ErrCaseMismatch = errors.New("upstream response does not match query name case")
+
+// exchangeRandomizedCase sends a copy of r whose query name has randomly
+// cased letters (DNS 0x20 encoding) and rejects any response whose question
+// doesn't carry exactly that spelling. On success the client's original
+// spelling is restored in the question and in every record owned by the
+// query name, so callers and the cache never see the randomized form.
+func (f *Forwarder) exchangeRandomizedCase(ctx context.Context, client *dns.Client, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
+	if len(r.Question) != 1 {
+		return f.exchangeRaw(ctx, client, r, upstream)
+	}
+	original := r.Question[0].Name
+	sent := randomizeCase(original)
+
+	q := r.Copy()
+	q.Question[0].Name = sent
+	resp, rtt, err := f.exchangeRaw(ctx, client, q, upstream)
+	if err != nil || resp == nil {
+		return resp, rtt, err
+	}
+	if len(resp.Question) != 1 || resp.Question[0].Name != sent {
+		f.logger.Warn("Upstream response failed 0x20 case check",
+			"upstream", upstream,
+			"sent", sent,
+			"received", questionName(resp),
+		)
+		return nil, rtt, fmt.Errorf("%w from %s", ErrCaseMismatch, upstream)
+	}
+
+	resp.Question[0].Name = original
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if h := rr.Header(); h.Name == sent {
+				h.Name = original
+			}
+		}
+	}
+	return resp, rtt, nil
+}
+
+// randomizeCase flips each ASCII letter of name to upper or lower case at
+// random. Escapes such as \065 are left alone.
+func randomizeCase(name string) string {
+	b := []byte(name)
+	bits := rand.Uint64()
+	for i, c := range b {
+		lower := c | 0x20
+		if lower < 'a' || lower > 'z' {
+			continue
+		}
+		if i%64 == 0 && i > 0 {
+			bits = rand.Uint64()
+		}
+		if bits&(1<<(i%64)) != 0 {
+			b[i] = lower - 0x20
+		} else {
+			b[i] = lower
+		}
+	}
+	return string(b)
+}
+
+// questionName returns the first question name of m, or "" if it has none.
+func questionName(m *dns.Msg) string {
+	if len(m.Question) == 0 {
+		return ""
+	}
+	return m.Question[0].Name
+}
@@ -13,6 +13,10 @@ var (
 
 	// ErrNoHealthyUpstreams is returned when all upstreams are unhealthy
 	ErrNoHealthyUpstreams = errors.New("no healthy upstream servers available")
+
+	// ErrTooManyInflight is returned when forwarder.max_concurrent upstream
+	// queries are already in flight and no slot freed up in time
+	ErrTooManyInflight = errors.New("too many in-flight upstream queries")
 )
 
 // CircuitState represents the state of a circuit breaker
@@ -55,6 +59,10 @@ type CircuitBreaker struct {
 	successThreshold int           // Successes to close circuit from half-open
 	timeout          time.Duration // How long to wait before half-open
 	halfOpenMax      int           // Max requests in half-open state
+
+	// onStateChange, when set, is invoked after every successful state
+	// transition. Must be assigned before the breaker is shared.
+	onStateChange func(from, to CircuitState)
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -86,6 +94,7 @@ func (cb *CircuitBreaker) Call(fn func() error) error {
 				cb.successes.Store(0)
 				cb.failures.Store(0)
 				cb.halfOpenReqs.Store(0)
+				cb.notify(StateOpen, StateHalfOpen)
 			}
 		} else {
 			// Circuit still open - fail fast
@@ -127,6 +136,7 @@ func (cb *CircuitBreaker) onFailure() {
 			// Open circuit
 			if cb.state.CompareAndSwap(int32(StateClosed), int32(StateOpen)) {
 				cb.lastStateChange.Store(time.Now().UnixNano())
+				cb.notify(StateClosed, StateOpen)
 			}
 		}
 
@@ -136,6 +146,7 @@ func (cb *CircuitBreaker) onFailure() {
 			cb.lastStateChange.Store(time.Now().UnixNano())
 			cb.failures.Store(0)
 			cb.successes.Store(0)
+			cb.notify(StateHalfOpen, StateOpen)
 		}
 	}
 }
@@ -151,6 +162,7 @@ func (cb *CircuitBreaker) onSuccess() {
 		// Close circuit - upstream recovered
 		if cb.state.CompareAndSwap(int32(StateHalfOpen), int32(StateClosed)) {
 			cb.lastStateChange.Store(time.Now().UnixNano())
+			cb.notify(StateHalfOpen, StateClosed)
 		}
 	}
 }
@@ -160,9 +172,22 @@ func (cb *CircuitBreaker) GetState() CircuitState {
 	return CircuitState(cb.state.Load())
 }
 
-// IsHealthy returns true if the circuit is closed (healthy)
+// IsHealthy returns true if the circuit accepts requests. An open circuit
+// whose cool-down has elapsed is reported healthy so that upstream selection
+// lets the half-open probe through; otherwise an open breaker filtered out by
+// GetHealthyUpstreams would never get the chance to recover.
 func (cb *CircuitBreaker) IsHealthy() bool {
-	return cb.GetState() != StateOpen
+	if cb.GetState() != StateOpen {
+		return true
+	}
+	return time.Since(time.Unix(0, cb.lastStateChange.Load())) > cb.timeout
+}
+
+// notify invokes the state change hook, if any
+func (cb *CircuitBreaker) notify(from, to CircuitState) {
+	if cb.onStateChange != nil {
+		cb.onStateChange(from, to)
+	}
 }
 
 // GetStats returns circuit breaker statistics
@@ -172,8 +197,11 @@ func (cb *CircuitBreaker) GetStats() (failures, successes int64, state CircuitSt
 
 // Reset resets the circuit breaker to closed state
 func (cb *CircuitBreaker) Reset() {
-	cb.state.Store(int32(StateClosed))
+	prev := CircuitState(cb.state.Swap(int32(StateClosed)))
 	cb.failures.Store(0)
 	cb.successes.Store(0)
 	cb.lastStateChange.Store(time.Now().UnixNano())
+	if prev != StateClosed {
+		cb.notify(prev, StateClosed)
+	}
 }
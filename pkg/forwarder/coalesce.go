@@ -0,0 +1,131 @@
+package forwarder
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// coalesce runs exchange once for all identical concurrent queries and hands
+// every caller its own copy of the shared response. When a popular name
+// expires from the cache, the burst of clients asking for it then costs one
+// upstream query instead of one per client.
+//
+// The shared exchange runs detached from any single caller's context, so a
+// client that gives up doesn't fail the others; each caller still returns as
+// soon as its own ctx is done. The exchange itself stays bounded by the
+// forwarder timeout. route distinguishes queries sent to different upstream
+// sets (policy FORWARD rules).
+//
+// The upstream that answered is reported to every caller's Answered (see
+// WithAnswered).
+func (f *Forwarder) coalesce(ctx context.Context, r *dns.Msg, route string, exchange func(context.Context) (*dns.Msg, string, error)) (*dns.Msg, error) {
+	if len(r.Question) == 0 {
+		resp, upstream, err := exchange(ctx)
+		recordAnswered(ctx, upstream)
+		return resp, err
+	}
+
+	led := false // set when this caller's function runs the exchange
+	ch := f.flights.DoChan(flightKey(r, route), func() (any, error) {
+		led = true
+		resp, upstream, err := exchange(context.WithoutCancel(ctx))
+		return flightResult{resp: resp, upstream: upstream}, err
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		fr := res.Val.(flightResult)
+		recordAnswered(ctx, fr.upstream)
+		resp := fr.resp
+		if !res.Shared {
+			return resp, nil
+		}
+		if !led {
+			f.recordCoalesced(ctx)
+		}
+		// Every waiter gets its own copy, carrying its own ID and question
+		// (names may differ in case), since callers mutate and write it.
+		out := resp.Copy()
+		out.Id = r.Id
+		out.Question = append(out.Question[:0:0], r.Question...)
+		return out, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flightResult is what a shared exchange hands its callers.
+type flightResult struct {
+	resp     *dns.Msg
+	upstream string
+}
+
+// Answered receives the upstream that answered a query forwarded with a
+// context from WithAnswered. Upstream stays empty when no upstream answered.
+type Answered struct {
+	Upstream string
+}
+
+type answeredKey struct{}
+
+// WithAnswered returns a context that makes Forward and ForwardWithUpstreams
+// record in a which upstream answered. With retries and round-robin this can
+// differ from the first configured upstream.
+func WithAnswered(ctx context.Context, a *Answered) context.Context {
+	return context.WithValue(ctx, answeredKey{}, a)
+}
+
+func recordAnswered(ctx context.Context, upstream string) {
+	if a, ok := ctx.Value(answeredKey{}).(*Answered); ok && a != nil {
+		a.Upstream = upstream
+	}
+}
+
+// flightKey identifies queries whose upstream answers are interchangeable:
+// the same name (case-insensitive), type and class, with the same DNSSEC
+// flags and EDNS Client Subnet, sent to the same upstreams. The subnet only
+// appears when forwarder.forward_client_subnet passes it through, and an
+// upstream may answer each subnet differently.
+func flightKey(r *dns.Msg, route string) string {
+	q := r.Question[0]
+	var b strings.Builder
+	b.Grow(len(q.Name) + len(route) + 16)
+	b.WriteString(strings.ToLower(q.Name))
+	b.WriteByte('/')
+	b.WriteString(strconv.Itoa(int(q.Qtype)))
+	b.WriteByte('/')
+	b.WriteString(strconv.Itoa(int(q.Qclass)))
+	if r.CheckingDisabled {
+		b.WriteString("/cd")
+	}
+	if opt := r.IsEdns0(); opt != nil {
+		if opt.Do() {
+			b.WriteString("/do")
+		}
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				b.WriteString("/ecs=")
+				b.WriteString(subnet.Address.String())
+				b.WriteByte('/')
+				b.WriteString(strconv.Itoa(int(subnet.SourceNetmask)))
+			}
+		}
+	}
+	b.WriteByte('|')
+	b.WriteString(route)
+	return b.String()
+}
+
+// recordCoalesced counts a query answered from another caller's in-flight
+// upstream exchange.
+func (f *Forwarder) recordCoalesced(ctx context.Context) {
+	if f.metrics != nil && f.metrics.ForwarderCoalesced != nil {
+		f.metrics.ForwarderCoalesced.Add(ctx, 1)
+	}
+}
@@ -0,0 +1,50 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"glory-hole/pkg/dnscrypt"
+
+	"github.com/miekg/dns"
+)
+
+// exchange sends r to upstream, with 0x20 case randomization when enabled.
+func (f *Forwarder) exchange(ctx context.Context, client *dns.Client, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
+	if f.randomizeCase {
+		return f.exchangeRandomizedCase(ctx, client, r, upstream)
+	}
+	return f.exchangeRaw(ctx, client, r, upstream)
+}
+
+// exchangeRaw sends r to upstream over the upstream's transport: DNSCrypt for
+// sdns:// stamps and dnscrypt:// URLs, plain DNS through client otherwise.
+// A failed DNSCrypt handshake is an ordinary upstream error, so callers fall
+// through to the next upstream and the circuit breaker counts it.
+func (f *Forwarder) exchangeRaw(ctx context.Context, client *dns.Client, r *dns.Msg, upstream string) (*dns.Msg, time.Duration, error) {
+	if !dnscrypt.IsUpstream(upstream) {
+		return client.ExchangeContext(ctx, r, upstream)
+	}
+	if f.dnscrypt == nil {
+		return nil, 0, errors.New("dnscrypt client unavailable")
+	}
+	server, err := f.dnscryptServer(upstream)
+	if err != nil {
+		return nil, 0, err
+	}
+	return f.dnscrypt.Exchange(ctx, r, server)
+}
+
+// dnscryptServer parses a DNSCrypt upstream once and caches the result.
+func (f *Forwarder) dnscryptServer(upstream string) (*dnscrypt.Server, error) {
+	if cached, ok := f.dnscryptServers.Load(upstream); ok {
+		return cached.(*dnscrypt.Server), nil
+	}
+	server, err := dnscrypt.ParseUpstream(upstream)
+	if err != nil {
+		return nil, err
+	}
+	f.dnscryptServers.Store(upstream, server)
+	return server, nil
+}
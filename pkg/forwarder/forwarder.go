@@ -4,19 +4,24 @@ package forwarder
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/logging"
 	"glory-hole/pkg/telemetry"
 
 	"github.com/miekg/dns"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
 )
 
 // Forwarder handles forwarding DNS queries to upstream servers
@@ -26,10 +31,24 @@ type Forwarder struct {
 	metrics          *telemetry.Metrics
 	upstreams        []string
 	health           *UpstreamHealth // Circuit breaker for each upstream
-	timeout          time.Duration
+	timeout          atomic.Int64    // time.Duration, swapped by SetTimeout
 	retries          int
 	index            atomic.Uint32
 	servfailTCPRetry bool // When upstream returns SERVFAIL over UDP, retry once over TCP
+	randomizeCase    bool // 0x20 encoding (forwarder.case_randomization)
+
+	// Concurrency limit (forwarder.max_concurrent). sem is nil when unlimited.
+	sem          chan struct{}
+	queueTimeout time.Duration
+	inflight     atomic.Int64
+
+	flights singleflight.Group // Coalesces identical concurrent upstream queries
+
+	dnscrypt        *dnscrypt.Client // nil if key generation failed
+	dnscryptServers sync.Map         // upstream string -> *dnscrypt.Server
+
+	allDown   atomic.Bool                              // every upstream circuit is open
+	onAllDown atomic.Pointer[func(upstreams []string)] // see SetOnAllUpstreamsDown
 }
 
 // NewForwarder creates a new DNS forwarder.
@@ -44,7 +63,9 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 	// Normalize upstream addresses (add :53 if port is missing)
 	upstreams := make([]string, len(rawUpstreams))
 	for i, upstream := range rawUpstreams {
-		if _, _, err := net.SplitHostPort(upstream); err != nil {
+		if dnscrypt.IsUpstream(upstream) {
+			upstreams[i] = upstream
+		} else if _, _, err := net.SplitHostPort(upstream); err != nil {
 			// No port specified, add default DNS port
 			upstreams[i] = net.JoinHostPort(upstream, "53")
 		} else {
@@ -74,11 +95,21 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 
 	f := &Forwarder{
 		upstreams:        upstreams,
-		timeout:          2 * time.Second, // Default 2 second timeout
-		retries:          2,               // Try up to 2 different upstreams
+		retries:          2, // Try up to 2 different upstreams
 		logger:           logger,
 		metrics:          metrics,
 		servfailTCPRetry: cfg.Forwarder.ServfailTCPRetryEnabled(),
+		randomizeCase:    cfg.Forwarder.CaseRandomization,
+		queueTimeout:     cfg.Forwarder.QueueTimeout,
+	}
+	f.timeout.Store(int64(2 * time.Second)) // Default 2 second timeout
+	if cfg.Forwarder.MaxConcurrent > 0 {
+		f.sem = make(chan struct{}, cfg.Forwarder.MaxConcurrent)
+	}
+	if client, err := dnscrypt.NewClient(f.upstreamTimeout()); err != nil {
+		logger.Error("DNSCrypt client unavailable", "error", err)
+	} else {
+		f.dnscrypt = client
 	}
 
 	// Initialize circuit breaker health tracking
@@ -89,6 +120,7 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 			SuccessThreshold: cbCfg.SuccessThreshold,
 			TimeoutSeconds:   cbCfg.TimeoutSeconds,
 		})
+		f.health.SetStateChangeHandler(f.onBreakerStateChange)
 		logger.Info("Circuit breaker initialized",
 			"failure_threshold", cbCfg.FailureThreshold,
 			"success_threshold", cbCfg.SuccessThreshold,
@@ -99,16 +131,18 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 	f.clientPool.New = func() any {
 		return &dns.Client{
 			Net:     "udp",
-			Timeout: f.timeout,
+			Timeout: f.upstreamTimeout(),
 		}
 	}
 
 	logger.Info("Forwarder initialized",
 		"upstreams", upstreams,
-		"timeout", f.timeout,
+		"timeout", f.upstreamTimeout(),
 		"retries", f.retries,
 		"circuit_breaker", cbCfg.Enabled,
 		"servfail_tcp_retry", f.servfailTCPRetry,
+		"case_randomization", f.randomizeCase,
+		"max_concurrent", cap(f.sem),
 	)
 
 	return f
@@ -118,6 +152,8 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 // a SERVFAIL UDP response or a UDP transport error (timeout / connection
 // refused / unreachable). Returns (nil, false) on TCP error or unchanged
 // SERVFAIL, (resp, true) when TCP returns a different (non-SERVFAIL) Rcode.
+// With case_randomization on, the retry is 0x20-encoded and checked like the
+// UDP exchange; a case mismatch counts as a TCP error.
 //
 // Workaround for environments where UDP packets to specific resolver IPs are
 // silently dropped, filtered, or actively refused while TCP works to the same
@@ -130,8 +166,11 @@ func NewForwarder(cfg *config.Config, logger *logging.Logger, metrics *telemetry
 //	trigger ∈ {servfail, net_error}
 //	outcome ∈ {recovered, still_servfail, tcp_error}
 func (f *Forwarder) retryOverTCP(ctx context.Context, r *dns.Msg, upstream, trigger string) (*dns.Msg, bool) {
-	tcpClient := &dns.Client{Net: "tcp", Timeout: f.timeout}
-	tcpResp, _, tcpErr := tcpClient.ExchangeContext(ctx, r, upstream)
+	if dnscrypt.IsUpstream(upstream) {
+		return nil, false // the DNSCrypt client already falls back to TCP on truncation
+	}
+	tcpClient := &dns.Client{Net: "tcp", Timeout: f.upstreamTimeout()}
+	tcpResp, _, tcpErr := f.exchange(ctx, tcpClient, r, upstream)
 
 	outcome := "recovered"
 	switch {
@@ -144,11 +183,15 @@ func (f *Forwarder) retryOverTCP(ctx context.Context, r *dns.Msg, upstream, trig
 	}
 
 	if f.metrics != nil && f.metrics.ServfailTCPRetryTotal != nil {
-		f.metrics.ServfailTCPRetryTotal.Add(ctx, 1, metric.WithAttributes(
-			attribute.String("upstream", upstream),
+		attrs := make([]attribute.KeyValue, 0, 3)
+		if label := f.metrics.UpstreamLabel(upstream); label != "" {
+			attrs = append(attrs, attribute.String("upstream", label))
+		}
+		attrs = append(attrs,
 			attribute.String("trigger", trigger),
 			attribute.String("outcome", outcome),
-		))
+		)
+		f.metrics.ServfailTCPRetryTotal.Add(ctx, 1, metric.WithAttributes(attrs...))
 	}
 
 	f.logger.Debug("TCP retry",
@@ -164,11 +207,28 @@ func (f *Forwarder) retryOverTCP(ctx context.Context, r *dns.Msg, upstream, trig
 	return nil, false
 }
 
-// Forward forwards a DNS query to upstream servers
+// Forward forwards a DNS query to upstream servers. Identical concurrent
+// queries share a single upstream exchange (see coalesce).
 func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
 	if len(f.upstreams) == 0 {
 		return nil, fmt.Errorf("no upstream DNS servers configured")
 	}
+	return f.coalesce(ctx, r, "", func(ctx context.Context) (*dns.Msg, string, error) {
+		return f.forward(ctx, r)
+	})
+}
+
+// forward performs the upstream exchange for Forward.
+func (f *Forwarder) forward(ctx context.Context, r *dns.Msg) (*dns.Msg, string, error) {
+	if len(f.upstreams) == 0 {
+		return nil, "", fmt.Errorf("no upstream DNS servers configured")
+	}
+
+	release, err := f.acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
 
 	// Try multiple upstreams with round-robin selection
 	attempts := min(f.retries, len(f.upstreams))
@@ -176,19 +236,21 @@ func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
 
 	for i := 0; i < attempts; i++ {
 		if ctx.Err() != nil {
-			return nil, ctx.Err()
+			return nil, "", ctx.Err()
 		}
 
 		// Select upstream using round-robin (filters by health)
 		upstream, err := f.selectUpstream()
 		if err != nil {
 			f.logger.Error("No healthy upstreams available", "error", err)
-			return nil, err
+			f.recordBreakerRejected(ctx, "default")
+			return nil, "", err
 		}
 
 		// Get client from pool — return explicitly at each exit, not via defer,
 		// to avoid holding N clients when retrying inside the loop.
 		client := f.clientPool.Get().(*dns.Client)
+		client.Timeout = f.upstreamTimeout() // SetTimeout may have run since it was pooled
 
 		// Log the forward attempt
 		f.logger.Debug("Forwarding DNS query",
@@ -208,14 +270,14 @@ func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
 			if breaker != nil {
 				queryErr = breaker.Call(func() error {
 					var exchangeErr error
-					resp, rtt, exchangeErr = client.ExchangeContext(ctx, r, upstream)
+					resp, rtt, exchangeErr = f.exchange(ctx, client, r, upstream)
 					return exchangeErr
 				})
 			} else {
-				resp, rtt, queryErr = client.ExchangeContext(ctx, r, upstream)
+				resp, rtt, queryErr = f.exchange(ctx, client, r, upstream)
 			}
 		} else {
-			resp, rtt, queryErr = client.ExchangeContext(ctx, r, upstream)
+			resp, rtt, queryErr = f.exchange(ctx, client, r, upstream)
 		}
 
 		// Return client to pool immediately after use
@@ -233,9 +295,11 @@ func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
 			// resolver IP is silently dropped, filtered, or actively refused
 			// (e.g. Fly.io edge anycast inbound from intra-Fly), while TCP
 			// works. Disabled via cfg.Forwarder.ServfailTCPRetry=false.
-			if f.servfailTCPRetry {
+			// Skipped when the breaker rejected the call: nothing was sent.
+			if f.servfailTCPRetry && !errors.Is(queryErr, ErrCircuitOpen) {
 				if tcpResp, ok := f.retryOverTCP(ctx, r, upstream, "net_error"); ok {
-					return tcpResp, nil
+					f.recordTCPRecovery(upstream)
+					return tcpResp, upstream, nil
 				}
 			}
 
@@ -269,18 +333,18 @@ func (f *Forwarder) Forward(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
 		// because IT couldn't reach an authoritative server over UDP.
 		if resp.Rcode == dns.RcodeServerFailure && f.servfailTCPRetry {
 			if tcpResp, ok := f.retryOverTCP(ctx, r, upstream, "servfail"); ok {
-				return tcpResp, nil
+				return tcpResp, upstream, nil
 			}
 		}
 
-		return resp, nil
+		return resp, upstream, nil
 	}
 
 	// All attempts failed
 	if lastErr != nil {
-		return nil, fmt.Errorf("all upstream servers failed: %w", lastErr)
+		return nil, "", fmt.Errorf("all upstream servers failed: %w", lastErr)
 	}
-	return nil, fmt.Errorf("all upstream servers failed")
+	return nil, "", fmt.Errorf("all upstream servers failed")
 }
 
 // ForwardTCP forwards a DNS query using TCP
@@ -289,6 +353,12 @@ func (f *Forwarder) ForwardTCP(ctx context.Context, r *dns.Msg) (*dns.Msg, error
 		return nil, fmt.Errorf("no upstream DNS servers configured")
 	}
 
+	release, err := f.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Try multiple upstreams
 	attempts := min(f.retries, len(f.upstreams))
 	var lastErr error
@@ -302,13 +372,14 @@ func (f *Forwarder) ForwardTCP(ctx context.Context, r *dns.Msg) (*dns.Msg, error
 		upstream, err := f.selectUpstream()
 		if err != nil {
 			f.logger.Error("No healthy upstreams available for TCP", "error", err)
+			f.recordBreakerRejected(ctx, "default")
 			return nil, err
 		}
 
 		// Create TCP client
 		client := &dns.Client{
 			Net:     "tcp",
-			Timeout: f.timeout,
+			Timeout: f.upstreamTimeout(),
 		}
 
 		f.logger.Debug("Forwarding DNS query via TCP",
@@ -327,14 +398,14 @@ func (f *Forwarder) ForwardTCP(ctx context.Context, r *dns.Msg) (*dns.Msg, error
 			if breaker != nil {
 				queryErr = breaker.Call(func() error {
 					var exchangeErr error
-					resp, rtt, exchangeErr = client.ExchangeContext(ctx, r, upstream)
+					resp, rtt, exchangeErr = f.exchange(ctx, client, r, upstream)
 					return exchangeErr
 				})
 			} else {
-				resp, rtt, queryErr = client.ExchangeContext(ctx, r, upstream)
+				resp, rtt, queryErr = f.exchange(ctx, client, r, upstream)
 			}
 		} else {
-			resp, rtt, queryErr = client.ExchangeContext(ctx, r, upstream)
+			resp, rtt, queryErr = f.exchange(ctx, client, r, upstream)
 		}
 
 		if queryErr != nil {
@@ -379,13 +450,49 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 		return nil, fmt.Errorf("no upstream DNS servers provided")
 	}
 
+	// Collapse duplicates so a rule listing the same host twice doesn't wait
+	// out its timeout twice per query.
+	upstreams = dedupeUpstreams(upstreams)
+
+	return f.coalesce(ctx, r, strings.Join(upstreams, ","), func(ctx context.Context) (*dns.Msg, string, error) {
+		return f.forwardWithUpstreams(ctx, r, upstreams)
+	})
+}
+
+// forwardWithUpstreams performs the upstream exchange for ForwardWithUpstreams.
+func (f *Forwarder) forwardWithUpstreams(ctx context.Context, r *dns.Msg, upstreams []string) (*dns.Msg, string, error) {
+	// Conditional upstreams aren't in f.upstreams, so register them with the
+	// health tracker on first use. Upstreams with an open circuit are skipped;
+	// when all of them are open the query fails fast instead of waiting the
+	// full timeout on a host that is known to be down. The breaker lets a
+	// probe through once its cool-down expires.
+	if f.health != nil {
+		for _, upstream := range upstreams {
+			f.health.AddUpstream(upstream)
+		}
+		upstreams = f.health.GetHealthyUpstreams(upstreams)
+		if len(upstreams) == 0 {
+			f.logger.Debug("All conditional upstreams have open circuits, failing fast",
+				"domain", r.Question[0].Name,
+			)
+			f.recordBreakerRejected(ctx, "conditional")
+			return nil, "", ErrNoHealthyUpstreams
+		}
+	}
+
+	release, err := f.acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
 	// Try multiple upstreams
 	attempts := min(f.retries, len(upstreams))
 	var lastErr error
 
 	for i := 0; i < attempts; i++ {
 		if ctx.Err() != nil {
-			return nil, ctx.Err()
+			return nil, "", ctx.Err()
 		}
 
 		// Select upstream (round-robin for multiple upstreams)
@@ -393,6 +500,7 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 
 		// Get client from pool — return explicitly, not via defer (same fix as Forward)
 		client := f.clientPool.Get().(*dns.Client)
+		client.Timeout = f.upstreamTimeout() // SetTimeout may have run since it was pooled
 
 		// Log the forward attempt
 		f.logger.Debug("Forwarding DNS query to conditional upstream",
@@ -412,14 +520,14 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 			if breaker != nil {
 				err = breaker.Call(func() error {
 					var exchangeErr error
-					resp, rtt, exchangeErr = client.ExchangeContext(ctx, r, upstream)
+					resp, rtt, exchangeErr = f.exchange(ctx, client, r, upstream)
 					return exchangeErr
 				})
 			} else {
-				resp, rtt, err = client.ExchangeContext(ctx, r, upstream)
+				resp, rtt, err = f.exchange(ctx, client, r, upstream)
 			}
 		} else {
-			resp, rtt, err = client.ExchangeContext(ctx, r, upstream)
+			resp, rtt, err = f.exchange(ctx, client, r, upstream)
 		}
 
 		// Return client to pool immediately after use
@@ -434,9 +542,10 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 
 			// UDP transport error → TCP retry against the SAME upstream BEFORE
 			// falling through to the next one (see Forward() for rationale).
-			if f.servfailTCPRetry {
+			if f.servfailTCPRetry && !errors.Is(err, ErrCircuitOpen) {
 				if tcpResp, ok := f.retryOverTCP(ctx, r, upstream, "net_error"); ok {
-					return tcpResp, nil
+					f.recordTCPRecovery(upstream)
+					return tcpResp, upstream, nil
 				}
 			}
 
@@ -447,6 +556,9 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 		// Check if response is valid
 		if resp == nil {
 			lastErr = fmt.Errorf("received nil response from %s", upstream)
+			if f.health != nil {
+				f.health.RecordResult(upstream, lastErr)
+			}
 			continue
 		}
 
@@ -463,18 +575,164 @@ func (f *Forwarder) ForwardWithUpstreams(ctx context.Context, r *dns.Msg, upstre
 		// SERVFAIL→TCP retry against the SAME upstream (see Forward() for rationale).
 		if resp.Rcode == dns.RcodeServerFailure && f.servfailTCPRetry {
 			if tcpResp, ok := f.retryOverTCP(ctx, r, upstream, "servfail"); ok {
-				return tcpResp, nil
+				return tcpResp, upstream, nil
 			}
 		}
 
-		return resp, nil
+		return resp, upstream, nil
 	}
 
 	// All attempts failed
 	if lastErr != nil {
-		return nil, fmt.Errorf("all conditional upstream servers failed: %w", lastErr)
+		return nil, "", fmt.Errorf("all conditional upstream servers failed: %w", lastErr)
+	}
+	return nil, "", fmt.Errorf("all conditional upstream servers failed")
+}
+
+// recordTCPRecovery marks upstream healthy after a TCP retry recovered from a
+// UDP transport error. The breaker already counted the UDP failure; without
+// this, an upstream that only answers over TCP would eventually be opened
+// and fail fast even though every query to it succeeds.
+func (f *Forwarder) recordTCPRecovery(upstream string) {
+	if f.health != nil {
+		f.health.RecordResult(upstream, nil)
+	}
+}
+
+// onBreakerStateChange logs upstream circuit transitions and records
+// `forwarder.circuit_breaker.transitions{upstream,from,to}`.
+func (f *Forwarder) onBreakerStateChange(upstream string, from, to CircuitState) {
+	if to == StateOpen {
+		f.logger.Warn("Upstream circuit breaker opened",
+			"upstream", upstream,
+			"from", from.String(),
+		)
+	} else {
+		f.logger.Info("Upstream circuit breaker state changed",
+			"upstream", upstream,
+			"from", from.String(),
+			"to", to.String(),
+		)
+	}
+
+	if f.metrics != nil && f.metrics.CircuitBreakerTransitions != nil {
+		attrs := make([]attribute.KeyValue, 0, 3)
+		if label := f.metrics.UpstreamLabel(upstream); label != "" {
+			attrs = append(attrs, attribute.String("upstream", label))
+		}
+		attrs = append(attrs,
+			attribute.String("from", from.String()),
+			attribute.String("to", to.String()),
+		)
+		f.metrics.CircuitBreakerTransitions.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	}
+
+	switch {
+	case to == StateClosed:
+		f.allDown.Store(false)
+	case to == StateOpen && f.allUpstreamsOpen() && f.allDown.CompareAndSwap(false, true):
+		f.logger.Error("All upstream circuit breakers are open", "upstreams", f.upstreams)
+		if fn := f.onAllDown.Load(); fn != nil && *fn != nil {
+			(*fn)(f.upstreams)
+		}
+	}
+}
+
+// allUpstreamsOpen reports whether no upstream currently has a closed circuit.
+func (f *Forwarder) allUpstreamsOpen() bool {
+	if f.health == nil || len(f.upstreams) == 0 {
+		return false
+	}
+	for _, upstream := range f.upstreams {
+		if _, _, state := f.health.GetStats(upstream); state == StateClosed {
+			return false
+		}
+	}
+	return true
+}
+
+// SetOnAllUpstreamsDown registers fn to be called when the last upstream's
+// circuit breaker opens. It fires once per outage: not again until some
+// upstream's circuit has closed. fn must not block.
+func (f *Forwarder) SetOnAllUpstreamsDown(fn func(upstreams []string)) {
+	f.onAllDown.Store(&fn)
+}
+
+// recordBreakerRejected records a query that failed fast because every
+// candidate upstream had an open circuit. path is "default" or "conditional".
+func (f *Forwarder) recordBreakerRejected(ctx context.Context, path string) {
+	if f.metrics != nil && f.metrics.CircuitBreakerRejected != nil {
+		f.metrics.CircuitBreakerRejected.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("path", path),
+		))
+	}
+}
+
+// acquire takes an upstream query slot when forwarder.max_concurrent is set.
+// Over the limit it waits up to queueTimeout (or until ctx is done) for a
+// slot, or fails immediately with ErrTooManyInflight when queueTimeout is 0.
+// The returned release must be called once the query finishes.
+func (f *Forwarder) acquire(ctx context.Context) (func(), error) {
+	if f.sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case f.sem <- struct{}{}:
+	default:
+		if f.queueTimeout <= 0 {
+			f.recordConcurrencyRejected(ctx)
+			return nil, ErrTooManyInflight
+		}
+		timer := time.NewTimer(f.queueTimeout)
+		defer timer.Stop()
+		select {
+		case f.sem <- struct{}{}:
+		case <-timer.C:
+			f.recordConcurrencyRejected(ctx)
+			return nil, ErrTooManyInflight
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	f.inflight.Add(1)
+	if f.metrics != nil && f.metrics.ForwarderInflight != nil {
+		f.metrics.ForwarderInflight.Add(ctx, 1)
+	}
+	return func() {
+		f.inflight.Add(-1)
+		if f.metrics != nil && f.metrics.ForwarderInflight != nil {
+			f.metrics.ForwarderInflight.Add(context.Background(), -1)
+		}
+		<-f.sem
+	}, nil
+}
+
+// recordConcurrencyRejected records a query turned away by the
+// forwarder.max_concurrent limit.
+func (f *Forwarder) recordConcurrencyRejected(ctx context.Context) {
+	f.logger.Debug("Upstream concurrency limit reached, rejecting query", "max_concurrent", cap(f.sem))
+	if f.metrics != nil && f.metrics.ForwarderRejected != nil {
+		f.metrics.ForwarderRejected.Add(ctx, 1)
 	}
-	return nil, fmt.Errorf("all conditional upstream servers failed")
+}
+
+// Inflight returns the number of upstream queries currently holding a
+// concurrency slot. Always 0 when forwarder.max_concurrent is unset.
+func (f *Forwarder) Inflight() int64 {
+	return f.inflight.Load()
+}
+
+// dedupeUpstreams returns upstreams with duplicates removed, preserving order.
+func dedupeUpstreams(upstreams []string) []string {
+	out := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		if !slices.Contains(out, upstream) {
+			out = append(out, upstream)
+		}
+	}
+	return out
 }
 
 // selectUpstream selects the next upstream server using round-robin
@@ -500,7 +758,15 @@ func (f *Forwarder) selectUpstream() (string, error) {
 
 // SetTimeout sets the query timeout duration
 func (f *Forwarder) SetTimeout(timeout time.Duration) {
-	f.timeout = timeout
+	f.timeout.Store(int64(timeout))
+	if f.dnscrypt != nil {
+		f.dnscrypt.SetTimeout(timeout)
+	}
+}
+
+// upstreamTimeout returns the per-exchange timeout set by SetTimeout.
+func (f *Forwarder) upstreamTimeout() time.Duration {
+	return time.Duration(f.timeout.Load())
 }
 
 // SetRetries sets the number of retry attempts
@@ -515,6 +781,16 @@ func (f *Forwarder) Upstreams() []string {
 	return out
 }
 
+// HealthyUpstreams returns the upstreams whose circuit breaker currently
+// admits traffic. With the circuit breaker disabled every upstream counts as
+// healthy.
+func (f *Forwarder) HealthyUpstreams() []string {
+	if f.health == nil {
+		return f.Upstreams()
+	}
+	return f.health.GetHealthyUpstreams(f.upstreams)
+}
+
 // isLocalUpstream returns true if the upstream address is a loopback address.
 // Used to skip circuit breaker for managed local processes (e.g. Unbound on 127.0.0.1:5353).
 func isLocalUpstream(addr string) bool {
@@ -2,12 +2,17 @@ package forwarder
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"glory-hole/pkg/config"
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/logging"
 
 	"github.com/miekg/dns"
@@ -218,6 +223,32 @@ func TestForward_Timeout(t *testing.T) {
 	}
 }
 
+func TestSetTimeout_ConcurrentWithForward(t *testing.T) {
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"192.0.2.1:53"},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	fwd.SetTimeout(50 * time.Millisecond)
+
+	// Run with -race: the timeout swap must not race queries reading it
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := new(dns.Msg)
+			req.SetQuestion("timeout.test.", dns.TypeA)
+			_, _ = fwd.Forward(context.Background(), req)
+		}()
+	}
+	fwd.SetTimeout(20 * time.Millisecond)
+	wg.Wait()
+
+	if got := fwd.dnscrypt.Timeout(); got != 20*time.Millisecond {
+		t.Errorf("dnscrypt timeout = %v, want 20ms", got)
+	}
+}
+
 func TestForward_Retry(t *testing.T) {
 	// First server will not respond (non-routable IP)
 	// Second server will respond correctly
@@ -254,6 +285,41 @@ func TestForward_Retry(t *testing.T) {
 	}
 }
 
+func TestForward_ReportsAnsweringUpstream(t *testing.T) {
+	responses := map[string]*dns.Msg{
+		"answered.test.": createTestResponse("answered.test.", "10.0.0.1"),
+	}
+	addr, cleanup := mockDNSServer(t, responses)
+	defer cleanup()
+
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"192.0.2.1:53", addr}, // First fails, second succeeds
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	fwd.SetTimeout(100 * time.Millisecond)
+	fwd.SetRetries(2)
+
+	for _, upstreams := range [][]string{nil, {"192.0.2.1:53", addr}} {
+		req := new(dns.Msg)
+		req.SetQuestion("answered.test.", dns.TypeA)
+
+		var answered Answered
+		ctx := WithAnswered(context.Background(), &answered)
+		var err error
+		if upstreams == nil {
+			_, err = fwd.Forward(ctx, req)
+		} else {
+			_, err = fwd.ForwardWithUpstreams(ctx, req, upstreams)
+		}
+		if err != nil {
+			t.Fatalf("forward failed: %v", err)
+		}
+		if answered.Upstream != addr {
+			t.Errorf("answered upstream = %q, want %q", answered.Upstream, addr)
+		}
+	}
+}
+
 func TestForward_AllServersFail(t *testing.T) {
 	cfg := &config.Config{
 		UpstreamDNSServers: []string{"192.0.2.1:53", "192.0.2.2:53"}, // Both non-routable
@@ -981,3 +1047,626 @@ func TestForwardWithUpstreams_NetErrorTCPRetry_Recovered(t *testing.T) {
 		t.Fatalf("expected A 10.0.0.42, got %v", resp.Answer[0])
 	}
 }
+
+// TestForwardWithUpstreams_CircuitBreakerFastFail: a conditional-forwarding
+// rule pointing at a single dead host (listed twice) should stop paying the
+// timeout once the breaker opens and fail fast with ErrNoHealthyUpstreams.
+func TestForwardWithUpstreams_CircuitBreakerFastFail(t *testing.T) {
+	udpConn, _ := blackholeUDPListener(t)
+	defer udpConn.Close()
+	dead := udpConn.LocalAddr().String()
+
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"1.1.1.1:53"},
+		Forwarder: config.ForwarderConfig{
+			ServfailTCPRetry: &disabled,
+			CircuitBreaker: config.CircuitBreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 2,
+				TimeoutSeconds:   60,
+			},
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	fwd.SetTimeout(100 * time.Millisecond)
+
+	req := new(dns.Msg)
+	req.SetQuestion("internal.corp.", dns.TypeA)
+
+	// Duplicates collapse to one attempt, so two queries trip the breaker.
+	for i := 0; i < 2; i++ {
+		if _, err := fwd.ForwardWithUpstreams(context.Background(), req, []string{dead, dead}); err == nil {
+			t.Fatalf("query %d: expected error from dead upstream", i+1)
+		}
+	}
+
+	if state := fwd.health.GetBreaker(dead).GetState(); state != StateOpen {
+		t.Fatalf("expected breaker open after failures, got %s", state)
+	}
+
+	start := time.Now()
+	_, err := fwd.ForwardWithUpstreams(context.Background(), req, []string{dead})
+	if !errors.Is(err, ErrNoHealthyUpstreams) {
+		t.Fatalf("expected ErrNoHealthyUpstreams, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected fast fail, took %v", elapsed)
+	}
+}
+
+// TestForwardWithUpstreams_CircuitBreakerSkipsOpenUpstream: with one dead and
+// one live conditional upstream, the dead one is skipped once its breaker is
+// open so queries go straight to the live one.
+func TestForwardWithUpstreams_CircuitBreakerSkipsOpenUpstream(t *testing.T) {
+	udpConn, _ := blackholeUDPListener(t)
+	defer udpConn.Close()
+	dead := udpConn.LocalAddr().String()
+
+	live, cleanup := mockDNSServer(t, map[string]*dns.Msg{
+		"internal.corp.": createTestResponse("internal.corp.", "10.1.2.3"),
+	})
+	defer cleanup()
+
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"1.1.1.1:53"},
+		Forwarder: config.ForwarderConfig{
+			ServfailTCPRetry: &disabled,
+			CircuitBreaker: config.CircuitBreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 1,
+				TimeoutSeconds:   60,
+			},
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	fwd.SetTimeout(100 * time.Millisecond)
+
+	req := new(dns.Msg)
+	req.SetQuestion("internal.corp.", dns.TypeA)
+
+	// First query times out on the dead upstream, then succeeds on the live one.
+	if _, err := fwd.ForwardWithUpstreams(context.Background(), req, []string{dead, live}); err != nil {
+		t.Fatalf("first query failed: %v", err)
+	}
+
+	start := time.Now()
+	resp, err := fwd.ForwardWithUpstreams(context.Background(), req, []string{dead, live})
+	if err != nil {
+		t.Fatalf("second query failed: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(resp.Answer))
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected dead upstream to be skipped, took %v", elapsed)
+	}
+}
+
+func TestCircuitBreaker_ProbeAfterCooldown(t *testing.T) {
+	cb := NewCircuitBreaker(1, 1, 20*time.Millisecond)
+
+	var transitions []string
+	cb.onStateChange = func(from, to CircuitState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	}
+
+	_ = cb.Call(func() error { return errors.New("boom") })
+	if cb.IsHealthy() {
+		t.Fatal("expected breaker to be unhealthy right after opening")
+	}
+	if err := cb.Call(func() error { return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen during cool-down, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !cb.IsHealthy() {
+		t.Fatal("expected breaker to admit a probe after cool-down")
+	}
+	if err := cb.Call(func() error { return nil }); err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+	if cb.GetState() != StateClosed {
+		t.Fatalf("expected closed after successful probe, got %s", cb.GetState())
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if fmt.Sprint(transitions) != fmt.Sprint(want) {
+		t.Errorf("transitions = %v, want %v", transitions, want)
+	}
+}
+
+func TestHealthyUpstreams(t *testing.T) {
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"192.0.2.1:53", "192.0.2.2:53"},
+		Forwarder: config.ForwarderConfig{
+			CircuitBreaker: config.CircuitBreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 1,
+				TimeoutSeconds:   60,
+			},
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	if got := fwd.HealthyUpstreams(); len(got) != 2 {
+		t.Fatalf("expected both upstreams healthy, got %v", got)
+	}
+
+	fwd.health.RecordResult("192.0.2.1:53", errors.New("timeout"))
+	got := fwd.HealthyUpstreams()
+	if len(got) != 1 || got[0] != "192.0.2.2:53" {
+		t.Errorf("expected only 192.0.2.2:53 healthy, got %v", got)
+	}
+
+	cfg.Forwarder.CircuitBreaker.Enabled = false
+	if got := NewForwarder(cfg, logging.NewDefault(), nil).HealthyUpstreams(); len(got) != 2 {
+		t.Errorf("expected all upstreams healthy with breaker disabled, got %v", got)
+	}
+}
+
+func TestOnAllUpstreamsDown_FiresOncePerOutage(t *testing.T) {
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{"192.0.2.1:53", "192.0.2.2:53"},
+		Forwarder: config.ForwarderConfig{
+			CircuitBreaker: config.CircuitBreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 1,
+				SuccessThreshold: 1,
+				TimeoutSeconds:   60,
+			},
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+	var calls int
+	fwd.SetOnAllUpstreamsDown(func(upstreams []string) {
+		calls++
+		if len(upstreams) != 2 {
+			t.Errorf("upstreams = %v, want both", upstreams)
+		}
+	})
+
+	fwd.health.RecordResult("192.0.2.1:53", errors.New("timeout"))
+	if calls != 0 {
+		t.Fatal("hook fired while an upstream was still healthy")
+	}
+	fwd.health.RecordResult("192.0.2.2:53", errors.New("timeout"))
+	if calls != 1 {
+		t.Fatalf("calls = %d after all circuits opened, want 1", calls)
+	}
+
+	// Recovery re-arms the hook for the next outage.
+	fwd.health.GetBreaker("192.0.2.1:53").Reset()
+	fwd.health.RecordResult("192.0.2.1:53", errors.New("timeout"))
+	if calls != 2 {
+		t.Errorf("calls = %d after a second outage, want 2", calls)
+	}
+}
+
+// gatedUpstream starts a UDP upstream whose answers are held until gate is
+// closed, so tests can keep queries in flight. queries counts the requests
+// it received.
+func gatedUpstream(t *testing.T) (addr string, gate chan struct{}, queries *atomic.Int32) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate = make(chan struct{})
+	queries = new(atomic.Int32)
+	srv := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		<-gate
+		answerHandler(r.Question[0].Name, "192.0.2.10")(w, r)
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return pc.LocalAddr().String(), gate, queries
+}
+
+// waitInflight polls until fwd reports n in-flight upstream queries.
+func waitInflight(t *testing.T, fwd *Forwarder, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for fwd.Inflight() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d in-flight queries, got %d", n, fwd.Inflight())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestForward_MaxConcurrentFailsFast(t *testing.T) {
+	addr, gate, _ := gatedUpstream(t)
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder:          config.ForwarderConfig{MaxConcurrent: 1, ServfailTCPRetry: &disabled},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := fwd.Forward(context.Background(), msg)
+		done <- err
+	}()
+	waitInflight(t, fwd, 1)
+
+	// A different name, so it isn't coalesced onto the in-flight query.
+	other := new(dns.Msg)
+	other.SetQuestion("other.example.com.", dns.TypeA)
+	start := time.Now()
+	if _, err := fwd.Forward(context.Background(), other); !errors.Is(err, ErrTooManyInflight) {
+		t.Fatalf("expected ErrTooManyInflight over the limit, got %v", err)
+	}
+	if _, err := fwd.ForwardWithUpstreams(context.Background(), msg, []string{addr}); !errors.Is(err, ErrTooManyInflight) {
+		t.Fatalf("conditional forwarding should share the limit, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("rejection should be immediate, took %v", elapsed)
+	}
+
+	close(gate)
+	if err := <-done; err != nil {
+		t.Fatalf("in-flight query failed: %v", err)
+	}
+	waitInflight(t, fwd, 0)
+	if _, err := fwd.Forward(context.Background(), msg); err != nil {
+		t.Fatalf("query after the slot freed up failed: %v", err)
+	}
+}
+
+func TestForward_MaxConcurrentQueues(t *testing.T) {
+	addr, gate, _ := gatedUpstream(t)
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder: config.ForwarderConfig{
+			MaxConcurrent:    1,
+			QueueTimeout:     time.Second,
+			ServfailTCPRetry: &disabled,
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		msg := new(dns.Msg)
+		msg.SetQuestion(fmt.Sprintf("host%d.example.com.", i), dns.TypeA)
+		go func() {
+			_, err := fwd.Forward(context.Background(), msg)
+			results <- err
+		}()
+	}
+	waitInflight(t, fwd, 1)
+	time.Sleep(50 * time.Millisecond) // second query is now queued, not in flight
+	if got := fwd.Inflight(); got != 1 {
+		t.Fatalf("limit exceeded: %d queries in flight", got)
+	}
+
+	close(gate)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("queued query should succeed once a slot frees up: %v", err)
+		}
+	}
+}
+
+func TestForward_MaxConcurrentQueueTimeout(t *testing.T) {
+	addr, gate, _ := gatedUpstream(t)
+	defer close(gate)
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder: config.ForwarderConfig{
+			MaxConcurrent:    1,
+			QueueTimeout:     50 * time.Millisecond,
+			ServfailTCPRetry: &disabled,
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	go func() { _, _ = fwd.Forward(context.Background(), msg) }()
+	waitInflight(t, fwd, 1)
+
+	if _, err := fwd.ForwardTCP(context.Background(), msg); !errors.Is(err, ErrTooManyInflight) {
+		t.Fatalf("expected ErrTooManyInflight after queue_timeout, got %v", err)
+	}
+}
+
+func TestForward_CoalescesIdenticalQueries(t *testing.T) {
+	addr, gate, queries := gatedUpstream(t)
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder:          config.ForwarderConfig{ServfailTCPRetry: &disabled},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	const clients = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, clients+1)
+	for i := 0; i < clients; i++ {
+		req := new(dns.Msg)
+		req.SetQuestion("Example.COM.", dns.TypeA) // case differs from the others
+		if i%2 == 0 {
+			req.SetQuestion("example.com.", dns.TypeA)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := fwd.Forward(context.Background(), req)
+			switch {
+			case err != nil:
+				errs <- err
+			case resp.Id != req.Id:
+				errs <- fmt.Errorf("response id %d, want %d", resp.Id, req.Id)
+			case resp.Question[0].Name != req.Question[0].Name:
+				errs <- fmt.Errorf("response question %q, want %q", resp.Question[0].Name, req.Question[0].Name)
+			case len(resp.Answer) != 1:
+				errs <- fmt.Errorf("expected 1 answer, got %d", len(resp.Answer))
+			}
+		}()
+	}
+	// A different type is a different question and goes upstream separately.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := new(dns.Msg)
+		req.SetQuestion("example.com.", dns.TypeAAAA)
+		if _, err := fwd.Forward(context.Background(), req); err != nil {
+			errs <- err
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for queries.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond) // let every query join its flight
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("expected 2 upstream queries (A and AAAA), got %d", got)
+	}
+}
+
+func TestFlightKey_ClientSubnet(t *testing.T) {
+	query := func(subnet string) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		if subnet != "" {
+			m.SetEdns0(1232, false)
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, Family: 1, SourceNetmask: 24, Address: net.ParseIP(subnet).To4()})
+		}
+		return m
+	}
+
+	a, b, none := flightKey(query("192.0.2.0"), "u"), flightKey(query("198.51.100.0"), "u"), flightKey(query(""), "u")
+	if a == b || a == none {
+		t.Errorf("queries with different client subnets must not share a flight: %q %q %q", a, b, none)
+	}
+	if flightKey(query("192.0.2.0"), "u") != a {
+		t.Error("queries with the same client subnet should share a flight")
+	}
+}
+
+func TestForward_CoalescedWaiterHonorsOwnContext(t *testing.T) {
+	addr, gate, queries := gatedUpstream(t)
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder:          config.ForwarderConfig{ServfailTCPRetry: &disabled},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := fwd.Forward(leaderCtx, msg)
+		leaderDone <- err
+	}()
+	for queries.Load() == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	waiterDone := make(chan error, 1)
+	go func() {
+		_, err := fwd.Forward(context.Background(), msg.Copy())
+		waiterDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// The first caller giving up doesn't fail the query it started.
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled leader, got %v", err)
+	}
+	close(gate)
+	if err := <-waiterDone; err != nil {
+		t.Fatalf("waiter should still get the shared answer: %v", err)
+	}
+	if got := queries.Load(); got != 1 {
+		t.Errorf("expected 1 upstream query, got %d", got)
+	}
+}
+
+func TestForwardWithUpstreams_DNSCryptHandshakeFallsThrough(t *testing.T) {
+	responses := map[string]*dns.Msg{
+		"conditional.test.": createTestResponse("conditional.test.", "10.0.0.1"),
+	}
+	addr, cleanup := mockDNSServer(t, responses)
+	defer cleanup()
+
+	// A stamp pointing at a plain DNS server: the certificate query gets
+	// NXDOMAIN, so the handshake fails and the next upstream answers.
+	stamp := (&dnscrypt.Server{
+		Address:      addr,
+		ProviderName: "2.dnscrypt-cert.test.example.",
+		PublicKey:    make([]byte, 32),
+	}).Stamp()
+
+	cfg := &config.Config{UpstreamDNSServers: []string{"1.1.1.1:53"}}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	req := new(dns.Msg)
+	req.SetQuestion("conditional.test.", dns.TypeA)
+	resp, err := fwd.ForwardWithUpstreams(context.Background(), req, []string{stamp, addr})
+	if err != nil {
+		t.Fatalf("ForwardWithUpstreams failed: %v", err)
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 answer from the plain upstream, got %d", len(resp.Answer))
+	}
+}
+
+func TestForward_CaseRandomization(t *testing.T) {
+	// The upstream records the spelling it saw and either echoes it (a
+	// compliant resolver) or lowercases it (a spoofer that didn't see the
+	// query). Both reply with an answer owned by the echoed name.
+	var echo atomic.Bool
+	var seen atomic.Value
+	handler := func(w dns.ResponseWriter, r *dns.Msg) {
+		seen.Store(r.Question[0].Name)
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		if !echo.Load() {
+			resp.Question[0].Name = strings.ToLower(r.Question[0].Name)
+		}
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: resp.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("10.0.0.20"),
+		})
+		_ = w.WriteMsg(resp)
+	}
+	addr, cleanup := mockDualStackServer(t, handler, handler)
+	defer cleanup()
+
+	disabled := false
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder: config.ForwarderConfig{
+			CaseRandomization: true,
+			ServfailTCPRetry:  &disabled,
+		},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	const name = "www.example-with-a-long-label.test."
+
+	t.Run("mismatch rejected", func(t *testing.T) {
+		echo.Store(false)
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		resp, err := fwd.Forward(context.Background(), req)
+		if !errors.Is(err, ErrCaseMismatch) {
+			t.Fatalf("expected ErrCaseMismatch, got resp=%v err=%v", resp, err)
+		}
+	})
+
+	t.Run("matching case accepted", func(t *testing.T) {
+		echo.Store(true)
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		resp, err := fwd.Forward(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+		sent, _ := seen.Load().(string)
+		if !strings.EqualFold(sent, name) || sent == name {
+			t.Errorf("upstream saw %q, want a case-randomized %q", sent, name)
+		}
+		if got := resp.Question[0].Name; got != name {
+			t.Errorf("question = %q, want the client's spelling %q", got, name)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].Header().Name != name {
+			t.Errorf("answer owner not restored: %v", resp.Answer)
+		}
+		if req.Question[0].Name != name {
+			t.Errorf("caller's request was mutated: %q", req.Question[0].Name)
+		}
+	})
+}
+
+func TestForward_CaseRandomizationOnTCPRetry(t *testing.T) {
+	// UDP fails with SERVFAIL; the TCP retry must be randomized and checked
+	// the same way as the UDP exchange.
+	var echo atomic.Bool
+	var seen atomic.Value
+	tcpHandler := func(w dns.ResponseWriter, r *dns.Msg) {
+		seen.Store(r.Question[0].Name)
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		if !echo.Load() {
+			resp.Question[0].Name = strings.ToLower(r.Question[0].Name)
+		}
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: resp.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("10.0.0.21"),
+		})
+		_ = w.WriteMsg(resp)
+	}
+	addr, cleanup := mockDualStackServer(t, dns.HandlerFunc(servfailHandler), tcpHandler)
+	defer cleanup()
+
+	cfg := &config.Config{
+		UpstreamDNSServers: []string{addr},
+		Forwarder:          config.ForwarderConfig{CaseRandomization: true},
+	}
+	fwd := NewForwarder(cfg, logging.NewDefault(), nil)
+
+	const name = "www.example-with-a-long-label.test."
+
+	t.Run("matching case accepted", func(t *testing.T) {
+		echo.Store(true)
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		resp, err := fwd.Forward(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Forward failed: %v", err)
+		}
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+			t.Fatalf("expected the TCP answer, got %v", resp)
+		}
+		sent, _ := seen.Load().(string)
+		if !strings.EqualFold(sent, name) || sent == name {
+			t.Errorf("TCP retry sent %q, want a case-randomized %q", sent, name)
+		}
+		if resp.Answer[0].Header().Name != name {
+			t.Errorf("answer owner not restored: %v", resp.Answer)
+		}
+	})
+
+	t.Run("mismatch not accepted", func(t *testing.T) {
+		echo.Store(false)
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+		resp, _ := fwd.Forward(context.Background(), req)
+		if resp != nil && resp.Rcode == dns.RcodeSuccess {
+			t.Fatalf("TCP answer with the wrong case was accepted: %v", resp)
+		}
+	})
+}
+
+func TestRandomizeCase(t *testing.T) {
+	name := `a1-b\065.` + strings.Repeat("x", 100) + "."
+	got := randomizeCase(name)
+	if !strings.EqualFold(got, name) {
+		t.Fatalf("randomizeCase changed more than case: %q", got)
+	}
+	if got[1:3] != name[1:3] || got[4:9] != name[4:9] {
+		t.Errorf("non-letters changed: %q", got)
+	}
+}
@@ -26,9 +26,10 @@ func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
 
 // UpstreamHealth tracks health of multiple upstreams using circuit breakers
 type UpstreamHealth struct {
-	breakers map[string]*CircuitBreaker
-	mu       sync.RWMutex
-	config   CircuitBreakerConfig
+	breakers      map[string]*CircuitBreaker
+	mu            sync.RWMutex
+	config        CircuitBreakerConfig
+	onStateChange func(upstream string, from, to CircuitState)
 }
 
 // NewUpstreamHealth creates a new upstream health tracker
@@ -39,18 +40,40 @@ func NewUpstreamHealth(upstreams []string, config CircuitBreakerConfig) *Upstrea
 	}
 
 	// Create circuit breaker for each upstream
-	timeout := time.Duration(config.TimeoutSeconds) * time.Second
 	for _, upstream := range upstreams {
-		uh.breakers[upstream] = NewCircuitBreaker(
-			config.FailureThreshold,
-			config.SuccessThreshold,
-			timeout,
-		)
+		uh.breakers[upstream] = uh.newBreaker(upstream)
 	}
 
 	return uh
 }
 
+// newBreaker creates a circuit breaker for upstream whose state transitions
+// are reported to the handler registered via SetStateChangeHandler.
+func (uh *UpstreamHealth) newBreaker(upstream string) *CircuitBreaker {
+	cb := NewCircuitBreaker(
+		uh.config.FailureThreshold,
+		uh.config.SuccessThreshold,
+		time.Duration(uh.config.TimeoutSeconds)*time.Second,
+	)
+	cb.onStateChange = func(from, to CircuitState) {
+		uh.mu.RLock()
+		fn := uh.onStateChange
+		uh.mu.RUnlock()
+		if fn != nil {
+			fn(upstream, from, to)
+		}
+	}
+	return cb
+}
+
+// SetStateChangeHandler registers a callback invoked whenever any tracked
+// upstream's circuit changes state. The callback must not block.
+func (uh *UpstreamHealth) SetStateChangeHandler(fn func(upstream string, from, to CircuitState)) {
+	uh.mu.Lock()
+	defer uh.mu.Unlock()
+	uh.onStateChange = fn
+}
+
 // IsHealthy returns true if the upstream circuit is closed (healthy)
 func (uh *UpstreamHealth) IsHealthy(upstream string) bool {
 	uh.mu.RLock()
@@ -129,16 +152,31 @@ func (uh *UpstreamHealth) GetAllStats() map[string]CircuitState {
 
 // ResetAll resets all circuit breakers to closed state
 func (uh *UpstreamHealth) ResetAll() {
+	// Snapshot under the lock: Reset fires the state change hook, which
+	// takes the read lock itself.
 	uh.mu.RLock()
-	defer uh.mu.RUnlock()
-
+	breakers := make([]*CircuitBreaker, 0, len(uh.breakers))
 	for _, breaker := range uh.breakers {
+		breakers = append(breakers, breaker)
+	}
+	uh.mu.RUnlock()
+
+	for _, breaker := range breakers {
 		breaker.Reset()
 	}
 }
 
 // AddUpstream adds a new upstream to health tracking
 func (uh *UpstreamHealth) AddUpstream(upstream string) {
+	// Fast path: conditional upstreams are registered on every query, so
+	// avoid the write lock once they're known.
+	uh.mu.RLock()
+	_, exists := uh.breakers[upstream]
+	uh.mu.RUnlock()
+	if exists {
+		return
+	}
+
 	uh.mu.Lock()
 	defer uh.mu.Unlock()
 
@@ -146,12 +184,7 @@ func (uh *UpstreamHealth) AddUpstream(upstream string) {
 		return
 	}
 
-	timeout := time.Duration(uh.config.TimeoutSeconds) * time.Second
-	uh.breakers[upstream] = NewCircuitBreaker(
-		uh.config.FailureThreshold,
-		uh.config.SuccessThreshold,
-		timeout,
-	)
+	uh.breakers[upstream] = uh.newBreaker(upstream)
 }
 
 // RemoveUpstream removes an upstream from health tracking
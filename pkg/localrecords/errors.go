@@ -18,6 +18,10 @@ var (
 	// ErrCNAMELoop is returned when a CNAME loop is detected
 	ErrCNAMELoop = errors.New("CNAME loop detected")
 
+	// ErrCNAMEDepthExceeded is returned when a CNAME chain is longer than the
+	// configured maximum depth without looping
+	ErrCNAMEDepthExceeded = errors.New("CNAME chain exceeds maximum depth")
+
 	// ErrMultipleCNAME is returned when multiple CNAME records exist for the same domain
 	ErrMultipleCNAME = errors.New("multiple CNAME records not allowed")
 
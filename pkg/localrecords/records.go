@@ -3,8 +3,11 @@
 package localrecords
 
 import (
+	"cmp"
 	"fmt"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -133,6 +136,58 @@ func (m *Manager) RemoveRecord(domain string, recordType RecordType) error {
 	return nil
 }
 
+// UpdateRecord atomically replaces the first record of recordType for domain
+// with record, keeping its position so multi-record types like MX keep their
+// order. Lookups never see the domain missing mid-edit. If record moves to
+// another domain it is appended there. Returns ErrRecordNotFound when no
+// record matches; on any error the existing records are left untouched.
+func (m *Manager) UpdateRecord(domain string, recordType RecordType, record *LocalRecord) error {
+	if record == nil || record.Wildcard {
+		return ErrInvalidRecord
+	}
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+	domain = normalizeDomain(domain)
+	record.Domain = normalizeDomain(record.Domain)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := m.records[domain]
+	idx := -1
+	for i, r := range records {
+		if r.Type == recordType {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrRecordNotFound
+	}
+
+	// Build new slices rather than writing into the old one, which a caller
+	// may still hold from a lookup.
+	if record.Domain == domain {
+		updated := make([]*LocalRecord, len(records))
+		copy(updated, records)
+		updated[idx] = record
+		m.records[domain] = updated
+		return nil
+	}
+
+	remaining := make([]*LocalRecord, 0, len(records)-1)
+	remaining = append(remaining, records[:idx]...)
+	remaining = append(remaining, records[idx+1:]...)
+	if len(remaining) == 0 {
+		delete(m.records, domain)
+	} else {
+		m.records[domain] = remaining
+	}
+	m.records[record.Domain] = append(m.records[record.Domain], record)
+	return nil
+}
+
 // LookupA looks up A records for a domain
 // Returns IPs and TTL, or nil if not found
 func (m *Manager) LookupA(domain string) ([]net.IP, uint32, bool) {
@@ -423,26 +478,45 @@ func (m *Manager) LookupCAA(domain string) []*LocalRecord {
 	return result
 }
 
-// ResolveCNAME follows CNAME chains and returns the final A/AAAA records
-// Prevents infinite loops with max depth of 10
+// DefaultMaxCNAMEDepth is the CNAME chain depth used when none is configured.
+const DefaultMaxCNAMEDepth = 10
+
+// ResolveCNAME follows CNAME chains and returns the final A/AAAA records.
+// maxDepth <= 0 uses DefaultMaxCNAMEDepth. Use ResolveCNAMEChain to find out
+// why a chain did not resolve.
 func (m *Manager) ResolveCNAME(domain string, maxDepth int) ([]net.IP, uint32, bool) {
+	ips, ttl, err := m.ResolveCNAMEChain(domain, maxDepth)
+	return ips, ttl, err == nil
+}
+
+// ResolveCNAMEChain is ResolveCNAME with the reason for a failed resolution:
+// ErrCNAMELoop if the chain revisits a name, ErrCNAMEDepthExceeded if it is
+// longer than maxDepth, and ErrRecordNotFound if it ends at a name with no
+// A/AAAA records.
+func (m *Manager) ResolveCNAMEChain(domain string, maxDepth int) ([]net.IP, uint32, error) {
 	if maxDepth <= 0 {
-		maxDepth = 10 // Default max CNAME chain depth
+		maxDepth = DefaultMaxCNAMEDepth
 	}
 
 	domain = normalizeDomain(domain)
 	visited := make(map[string]bool)
 	minTTL := uint32(300) // Track minimum TTL in chain
 
-	for depth := 0; depth < maxDepth; depth++ {
+	for depth := 0; depth <= maxDepth; depth++ {
 		// Prevent infinite loops
 		if visited[domain] {
-			return nil, 0, false
+			return nil, 0, ErrCNAMELoop
 		}
 		visited[domain] = true
 
 		// Check for CNAME
 		if target, ttl, found := m.LookupCNAME(domain); found {
+			if depth == maxDepth {
+				if visited[target] {
+					return nil, 0, ErrCNAMELoop
+				}
+				break
+			}
 			if ttl < minTTL {
 				minTTL = ttl
 			}
@@ -455,22 +529,21 @@ func (m *Manager) ResolveCNAME(domain string, maxDepth int) ([]net.IP, uint32, b
 			if ttl < minTTL {
 				minTTL = ttl
 			}
-			return ips, minTTL, true
+			return ips, minTTL, nil
 		}
 
 		if ips, ttl, found := m.LookupAAAA(domain); found {
 			if ttl < minTTL {
 				minTTL = ttl
 			}
-			return ips, minTTL, true
+			return ips, minTTL, nil
 		}
 
 		// Not found
-		return nil, 0, false
+		return nil, 0, ErrRecordNotFound
 	}
 
-	// Max depth reached (loop detected)
-	return nil, 0, false
+	return nil, 0, ErrCNAMEDepthExceeded
 }
 
 // HasRecord checks if any record exists for a domain
@@ -510,6 +583,39 @@ func (m *Manager) GetAllRecords() []*LocalRecord {
 	return all
 }
 
+// ZoneRecords returns the enabled records at or below origin, wildcards
+// included, ordered by domain and type so zone transfers are repeatable.
+func (m *Manager) ZoneRecords(origin string) []*LocalRecord {
+	origin = normalizeDomain(origin)
+	inZone := func(domain string) bool {
+		return origin == "." || domain == origin || strings.HasSuffix(domain, "."+origin)
+	}
+
+	m.mu.RLock()
+	var zone []*LocalRecord
+	for domain, records := range m.records {
+		if !inZone(domain) {
+			continue
+		}
+		for _, r := range records {
+			if r.Enabled {
+				zone = append(zone, r)
+			}
+		}
+	}
+	for _, wc := range m.wildcards {
+		if wc.Enabled && inZone(wc.Domain) {
+			zone = append(zone, wc)
+		}
+	}
+	m.mu.RUnlock()
+
+	slices.SortStableFunc(zone, func(a, b *LocalRecord) int {
+		return cmp.Or(strings.Compare(a.Domain, b.Domain), strings.Compare(string(a.Type), string(b.Type)))
+	})
+	return zone
+}
+
 // Count returns the total number of records
 func (m *Manager) Count() int {
 	m.mu.RLock()
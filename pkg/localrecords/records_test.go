@@ -1,8 +1,10 @@
 package localrecords
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -166,6 +168,69 @@ func TestRemoveRecord_NotFound(t *testing.T) {
 	}
 }
 
+func TestUpdateRecord(t *testing.T) {
+	mgr := NewManager()
+	for _, r := range []*LocalRecord{
+		NewMXRecord("example.local", "mail1.example.local", 10),
+		NewTXTRecord("example.local", []string{"v=spf1 -all"}),
+		NewMXRecord("example.local", "mail2.example.local", 10),
+	} {
+		if err := mgr.AddRecord(r); err != nil {
+			t.Fatalf("AddRecord() error = %v", err)
+		}
+	}
+
+	if err := mgr.UpdateRecord("EXAMPLE.local.", RecordTypeMX, NewMXRecord("example.local", "mx.example.local", 10)); err != nil {
+		t.Fatalf("UpdateRecord() error = %v", err)
+	}
+
+	// Equal priorities keep insertion order, so the edit must stay first.
+	records := mgr.LookupMX("example.local")
+	if len(records) != 2 || records[0].Target != "mx.example.local." || records[1].Target != "mail2.example.local." {
+		t.Fatalf("unexpected MX records after update: %v", records)
+	}
+	if mgr.Count() != 3 || len(mgr.LookupTXT("example.local")) != 1 {
+		t.Errorf("other records should be untouched, count = %d", mgr.Count())
+	}
+}
+
+func TestUpdateRecord_MovesDomain(t *testing.T) {
+	mgr := NewManager()
+	if err := mgr.AddRecord(NewARecord("old.local", net.ParseIP("192.168.1.1"))); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	if err := mgr.UpdateRecord("old.local", RecordTypeA, NewARecord("new.local", net.ParseIP("192.168.1.2"))); err != nil {
+		t.Fatalf("UpdateRecord() error = %v", err)
+	}
+	if mgr.HasRecord("old.local") {
+		t.Error("record should have left its old domain")
+	}
+	if ips, _, found := mgr.LookupA("new.local"); !found || !ips[0].Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("LookupA(new.local) = %v, %v", ips, found)
+	}
+}
+
+func TestUpdateRecord_Errors(t *testing.T) {
+	mgr := NewManager()
+	if err := mgr.AddRecord(NewARecord("nas.local", net.ParseIP("192.168.1.100"))); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+
+	if err := mgr.UpdateRecord("nas.local", RecordTypeAAAA, NewAAAARecord("nas.local", net.ParseIP("fd00::1"))); err != ErrRecordNotFound {
+		t.Errorf("wrong type: expected ErrRecordNotFound, got %v", err)
+	}
+	if err := mgr.UpdateRecord("missing.local", RecordTypeA, NewARecord("missing.local", net.ParseIP("192.168.1.1"))); err != ErrRecordNotFound {
+		t.Errorf("missing domain: expected ErrRecordNotFound, got %v", err)
+	}
+	if err := mgr.UpdateRecord("nas.local", RecordTypeA, NewLocalRecord("nas.local", RecordTypeA)); err == nil {
+		t.Error("expected a validation error for an A record without IPs")
+	}
+	if ips, _, found := mgr.LookupA("nas.local"); !found || !ips[0].Equal(net.ParseIP("192.168.1.100")) {
+		t.Errorf("failed updates must leave the record unchanged, got %v", ips)
+	}
+}
+
 func TestLookupCaseInsensitive(t *testing.T) {
 	mgr := NewManager()
 
@@ -319,6 +384,52 @@ func TestResolveCNAME_Loop(t *testing.T) {
 	}
 }
 
+func TestResolveCNAMEChain_Outcomes(t *testing.T) {
+	mgr := NewManager()
+
+	// hop0 -> hop1 -> hop2 -> hop3 (A)
+	for i := 0; i < 3; i++ {
+		if err := mgr.AddRecord(NewCNAMERecord(fmt.Sprintf("hop%d.local", i), fmt.Sprintf("hop%d.local", i+1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mgr.AddRecord(NewARecord("hop3.local", net.ParseIP("192.168.1.3"))); err != nil {
+		t.Fatal(err)
+	}
+	// x -> y -> x
+	if err := mgr.AddRecord(NewCNAMERecord("x.local", "y.local")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.AddRecord(NewCNAMERecord("y.local", "x.local")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.AddRecord(NewCNAMERecord("dangling.local", "nowhere.local")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain   string
+		maxDepth int
+		wantErr  error
+	}{
+		{"hop0.local", 3, nil},
+		{"hop0.local", 0, nil}, // default depth
+		{"hop0.local", 2, ErrCNAMEDepthExceeded},
+		{"x.local", 10, ErrCNAMELoop},
+		{"x.local", 1, ErrCNAMELoop}, // loop found even at the depth limit
+		{"dangling.local", 10, ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		ips, _, err := mgr.ResolveCNAMEChain(tt.domain, tt.maxDepth)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ResolveCNAMEChain(%s, %d) error = %v, want %v", tt.domain, tt.maxDepth, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && len(ips) != 1 {
+			t.Errorf("ResolveCNAMEChain(%s, %d) = %v, want one IP", tt.domain, tt.maxDepth, ips)
+		}
+	}
+}
+
 func TestResolveCNAME_MinTTL(t *testing.T) {
 	mgr := NewManager()
 
@@ -2370,3 +2481,36 @@ func TestAddRecord_CAARecord_CaseInsensitive(t *testing.T) {
 		}
 	}
 }
+
+func TestZoneRecords(t *testing.T) {
+	m := NewManager()
+	wc := NewARecord("*.lan.", net.ParseIP("192.168.1.1"))
+	wc.Wildcard = true
+	disabled := NewARecord("old.lan.", net.ParseIP("192.168.1.99"))
+	disabled.Enabled = false
+	for _, rec := range []*LocalRecord{
+		NewARecord("nas.lan.", net.ParseIP("192.168.1.10")),
+		NewTXTRecord("lan.", []string{"v=1"}),
+		NewARecord("Deep.Sub.LAN.", net.ParseIP("192.168.1.11")),
+		NewARecord("notlan.", net.ParseIP("10.0.0.1")),
+		NewARecord("host.other.", net.ParseIP("10.0.0.2")),
+		wc,
+		disabled,
+	} {
+		if err := m.AddRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	for _, rec := range m.ZoneRecords("LAN") {
+		got = append(got, rec.Domain+" "+string(rec.Type))
+	}
+	want := []string{"*.lan. A", "deep.sub.lan. A", "lan. TXT", "nas.lan. A"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ZoneRecords(lan) = %v, want %v", got, want)
+	}
+	if n := len(m.ZoneRecords("missing.")); n != 0 {
+		t.Errorf("empty zone returned %d records", n)
+	}
+}
@@ -0,0 +1,53 @@
+package localrecords
+
+import (
+	"strings"
+	"time"
+)
+
+// SerialMode selects how SOA serials change when records in their zone do.
+type SerialMode string
+
+const (
+	SerialManual    SerialMode = ""          // serials change only when edited
+	SerialIncrement SerialMode = "increment" // add one per change
+	SerialDate      SerialMode = "date"      // YYYYMMDDnn (RFC 1912 §2.2), +1 past nn=99
+)
+
+// NextSerial returns the serial a zone should publish after a change, given
+// its current serial. Date serials move to today's first revision, or add one
+// when the current serial is already at or past it, so they never go
+// backwards. SerialManual (and unknown modes) return current unchanged.
+func NextSerial(current uint32, mode SerialMode, now time.Time) uint32 {
+	switch mode {
+	case SerialIncrement:
+		return current + 1
+	case SerialDate:
+		y, m, d := now.UTC().Date()
+		today := uint32(y*1000000 + int(m)*10000 + d*100)
+		if current < today {
+			return today
+		}
+		return current + 1
+	default:
+		return current
+	}
+}
+
+// ZoneOrigin returns the index of the longest origin in origins that
+// contains domain (domain itself or a name below it), or -1 when none does.
+// Names are compared as normalized FQDNs.
+func ZoneOrigin(domain string, origins []string) int {
+	domain = normalizeDomain(domain)
+	best, bestLen := -1, -1
+	for i, origin := range origins {
+		origin = normalizeDomain(origin)
+		if origin != "." && domain != origin && !strings.HasSuffix(domain, "."+origin) {
+			continue
+		}
+		if len(origin) > bestLen {
+			best, bestLen = i, len(origin)
+		}
+	}
+	return best
+}
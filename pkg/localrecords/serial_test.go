@@ -0,0 +1,51 @@
+package localrecords
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2026, 3, 14, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		current uint32
+		mode    SerialMode
+		want    uint32
+	}{
+		{"manual", 7, SerialManual, 7},
+		{"unknown mode", 7, SerialMode("off"), 7},
+		{"increment", 7, SerialIncrement, 8},
+		{"date from counter", 7, SerialDate, 2026031400},
+		{"date from yesterday", 2026031305, SerialDate, 2026031400},
+		{"date same day", 2026031400, SerialDate, 2026031401},
+		{"date ahead of clock", 2026031599, SerialDate, 2026031600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextSerial(tt.current, tt.mode, now); got != tt.want {
+				t.Errorf("NextSerial(%d, %q) = %d, want %d", tt.current, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoneOrigin(t *testing.T) {
+	origins := []string{"lan.", "Sub.LAN", "other"}
+	tests := []struct {
+		domain string
+		want   int
+	}{
+		{"nas.lan.", 0},
+		{"lan", 0},
+		{"host.sub.lan.", 1},
+		{"sub.lan.", 1},
+		{"notlan.", -1},
+		{"host.other.", 2},
+	}
+	for _, tt := range tests {
+		if got := ZoneOrigin(tt.domain, origins); got != tt.want {
+			t.Errorf("ZoneOrigin(%q) = %d, want %d", tt.domain, got, tt.want)
+		}
+	}
+}
@@ -3,18 +3,17 @@ package localrecords
 import (
 	"net"
 	"strings"
+
+	"glory-hole/pkg/pattern"
 )
 
-// normalizeDomain normalizes a domain name to lowercase FQDN with trailing dot
+// normalizeDomain normalizes a domain name to a lowercase, punycode FQDN with
+// trailing dot (see pattern.NormalizeFQDN). The root name maps to ".".
 func normalizeDomain(domain string) string {
-	domain = strings.ToLower(strings.TrimSpace(domain))
-
-	// Ensure trailing dot for FQDN
-	if !strings.HasSuffix(domain, ".") {
-		domain += "."
+	if n := pattern.NormalizeFQDN(domain); n != "" {
+		return n
 	}
-
-	return domain
+	return "."
 }
 
 // matchesWildcard checks if a domain matches a wildcard pattern
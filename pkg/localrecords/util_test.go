@@ -98,6 +98,25 @@ func TestIsValidDomain(t *testing.T) {
 	}
 }
 
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"NAS.local", "nas.local."},
+		{" nas.local. ", "nas.local."},
+		{"*.Home.Arpa", "*.home.arpa."},
+		{"drucker.büro.lan", "drucker.xn--bro-hoa.lan."},
+		{"drucker.xn--bro-hoa.lan.", "drucker.xn--bro-hoa.lan."},
+		{"", "."},
+	}
+	for _, tt := range tests {
+		if got := normalizeDomain(tt.in); got != tt.want {
+			t.Errorf("normalizeDomain(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
 func TestIsAlphanumeric(t *testing.T) {
 	tests := []struct {
 		name string
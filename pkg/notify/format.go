@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"glory-hole/pkg/config"
+)
+
+// Discord rejects embeds whose description or field values exceed these
+// lengths, so longer text is cut rather than losing the whole notification.
+const (
+	discordContentLimit    = 4096
+	discordFieldValueLimit = 1024
+)
+
+// Discord embed colors: red for failures, amber for warnings, blue otherwise.
+var discordColors = map[string]int{
+	config.EventBlocklistUpdateFailed: 0xE01E5A,
+	config.EventUpstreamsDown:         0xE01E5A,
+	config.EventKillSwitchEngaged:     0xECB22E,
+	config.EventConfigReloaded:        0x36C5F0,
+}
+
+// encode renders ev in the payload shape the webhook expects.
+func encode(format string, ev Event) ([]byte, error) {
+	switch format {
+	case "", config.WebhookFormatJSON:
+		return json.Marshal(ev)
+	case config.WebhookFormatSlack:
+		return json.Marshal(slackPayload(ev))
+	case config.WebhookFormatDiscord:
+		return json.Marshal(discordPayload(ev))
+	default:
+		return nil, fmt.Errorf("unsupported webhook format %q", format)
+	}
+}
+
+// sortedDetailKeys orders details so rendered messages are stable.
+func sortedDetailKeys(details map[string]string) []string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// slackPayload builds a Slack incoming-webhook message using mrkdwn: a bold
+// headline followed by one bullet per detail.
+func slackPayload(ev Event) slackMessage {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Glory-Hole: %s*\n%s", ev.Event, ev.Message)
+	for _, k := range sortedDetailKeys(ev.Details) {
+		fmt.Fprintf(&b, "\n• *%s:* %s", k, ev.Details[k])
+	}
+	return slackMessage{Text: b.String()}
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discordPayload builds a Discord webhook message with a single embed whose
+// fields carry the event details.
+func discordPayload(ev Event) discordMessage {
+	embed := discordEmbed{
+		Title:       ev.Event,
+		Description: truncate(ev.Message, discordContentLimit),
+		Color:       discordColors[ev.Event],
+		Timestamp:   ev.Time.Format(time.RFC3339),
+	}
+	for _, k := range sortedDetailKeys(ev.Details) {
+		embed.Fields = append(embed.Fields, discordField{Name: k, Value: truncate(ev.Details[k], discordFieldValueLimit), Inline: true})
+	}
+	return discordMessage{Username: "Glory-Hole", Embeds: []discordEmbed{embed}}
+}
+
+// truncate cuts s to at most limit bytes without splitting a UTF-8 sequence.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "")
+}
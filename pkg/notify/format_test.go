@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"glory-hole/pkg/config"
+)
+
+var testEvent = Event{
+	Event:   config.EventUpstreamsDown,
+	Time:    time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC),
+	Message: "All upstream DNS servers are unreachable",
+	Details: map[string]string{"upstreams": "1.1.1.1:53, 8.8.8.8:53", "count": "2"},
+}
+
+func TestEncode_JSON(t *testing.T) {
+	for _, format := range []string{"", config.WebhookFormatJSON} {
+		body, err := encode(format, testEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Event
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Event != testEvent.Event || got.Message != testEvent.Message || got.Details["upstreams"] != testEvent.Details["upstreams"] {
+			t.Errorf("format %q: round trip = %+v", format, got)
+		}
+	}
+}
+
+func TestEncode_Slack(t *testing.T) {
+	body, err := encode(config.WebhookFormatSlack, testEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("expected only a text field, got %v", got)
+	}
+	text, _ := got["text"].(string)
+	want := "*Glory-Hole: upstreams_down*\nAll upstream DNS servers are unreachable\n• *count:* 2\n• *upstreams:* 1.1.1.1:53, 8.8.8.8:53"
+	if text != want {
+		t.Errorf("text =\n%s\nwant\n%s", text, want)
+	}
+}
+
+func TestEncode_Discord(t *testing.T) {
+	body, err := encode(config.WebhookFormatDiscord, testEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got discordMessage
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Embeds) != 1 {
+		t.Fatalf("expected one embed, got %d", len(got.Embeds))
+	}
+	embed := got.Embeds[0]
+	if embed.Title != config.EventUpstreamsDown || embed.Description != testEvent.Message {
+		t.Errorf("embed title/description = %q / %q", embed.Title, embed.Description)
+	}
+	if embed.Timestamp != "2026-03-14T12:00:00Z" || embed.Color == 0 {
+		t.Errorf("embed timestamp/color = %q / %#x", embed.Timestamp, embed.Color)
+	}
+	if len(embed.Fields) != 2 || embed.Fields[0].Name != "count" || embed.Fields[1].Value != "1.1.1.1:53, 8.8.8.8:53" {
+		t.Errorf("embed fields = %+v", embed.Fields)
+	}
+
+	long := testEvent
+	long.Message = strings.Repeat("x", discordContentLimit+10)
+	body, _ = encode(config.WebhookFormatDiscord, long)
+	_ = json.Unmarshal(body, &got)
+	if n := len(got.Embeds[0].Description); n != discordContentLimit {
+		t.Errorf("description length = %d, want truncation to %d", n, discordContentLimit)
+	}
+
+	long = testEvent
+	long.Details = map[string]string{"upstreams": strings.Repeat("é", discordFieldValueLimit)}
+	body, _ = encode(config.WebhookFormatDiscord, long)
+	got = discordMessage{}
+	_ = json.Unmarshal(body, &got)
+	if v := got.Embeds[0].Fields[0].Value; len(v) > discordFieldValueLimit || !utf8.ValidString(v) {
+		t.Errorf("field value length = %d (valid UTF-8: %v), want at most %d", len(v), utf8.ValidString(v), discordFieldValueLimit)
+	}
+}
+
+func TestEncode_UnknownFormat(t *testing.T) {
+	if _, err := encode("teams", testEvent); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,188 @@
+// Package notify delivers operational events (blocklist update failures,
+// upstream outages, kill-switch use, config reloads) to webhooks so they can
+// drive alerting without anyone scraping logs.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+)
+
+const (
+	// maxAttempts is how many times one event is POSTed to a webhook before
+	// it is dropped.
+	maxAttempts = 4
+	// initialBackoff is the wait before the first retry; it doubles after
+	// each failed attempt (1s, 2s, 4s).
+	initialBackoff = time.Second
+	requestTimeout = 10 * time.Second
+)
+
+// Event is the JSON body POSTed to webhooks in the default format; the Slack
+// and Discord formats render the same fields as a chat message.
+type Event struct {
+	Event   string            `json:"event"`
+	Time    time.Time         `json:"time"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Dispatcher sends events to the configured webhooks in the background. A nil
+// *Dispatcher is valid and drops every event, so callers need not check.
+type Dispatcher struct {
+	webhooks atomic.Pointer[[]config.WebhookConfig]
+	client   *http.Client
+	logger   *logging.Logger
+	backoff  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a Dispatcher for cfg. Call Close on shutdown to stop pending
+// retries.
+func New(cfg config.NotificationsConfig, logger *logging.Logger) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		client:  &http.Client{Timeout: requestTimeout},
+		logger:  logger,
+		backoff: initialBackoff,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	d.SetConfig(cfg)
+	return d
+}
+
+// SetConfig swaps the webhook list; events already being delivered finish
+// against the old list.
+func (d *Dispatcher) SetConfig(cfg config.NotificationsConfig) {
+	if d == nil {
+		return
+	}
+	hooks := append([]config.WebhookConfig(nil), cfg.Webhooks...)
+	d.webhooks.Store(&hooks)
+}
+
+// Notify queues event for every webhook subscribed to it and returns
+// immediately. details may be nil.
+func (d *Dispatcher) Notify(event, message string, details map[string]string) {
+	if d == nil || d.ctx.Err() != nil {
+		return
+	}
+	hooks := d.webhooks.Load()
+	if hooks == nil {
+		return
+	}
+	ev := Event{Event: event, Time: time.Now().UTC(), Message: message, Details: details}
+	bodies := make(map[string][]byte, 1) // encoded once per format
+	for _, hook := range *hooks {
+		if !hook.Wants(event) {
+			continue
+		}
+		body, ok := bodies[hook.Format]
+		if !ok {
+			var err error
+			if body, err = encode(hook.Format, ev); err != nil {
+				d.logger.Error("Failed to encode notification", "event", event, "url", redactURL(hook.URL), "error", err)
+				continue
+			}
+			bodies[hook.Format] = body
+		}
+		d.wg.Add(1)
+		go d.deliver(hook, event, body)
+	}
+}
+
+// Close abandons pending retries and waits for in-flight requests to finish.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	d.cancel()
+	d.wg.Wait()
+}
+
+// deliver POSTs body to hook, retrying network errors, 429s and 5xx
+// responses with exponential backoff.
+func (d *Dispatcher) deliver(hook config.WebhookConfig, event string, body []byte) {
+	defer d.wg.Done()
+
+	backoff := d.backoff
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var retry bool
+		if retry, err = d.post(hook, body); err == nil {
+			return
+		}
+		if !retry || attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-d.ctx.Done():
+			return
+		}
+	}
+	d.logger.Warn("Webhook delivery failed", "url", redactURL(hook.URL), "event", event, "error", err)
+}
+
+// post makes one delivery attempt. retry reports whether a later attempt
+// could succeed.
+func (d *Dispatcher) post(hook config.WebhookConfig, body []byte) (retry bool, err error) {
+	// Not bound to d.ctx: an attempt already on the wire is allowed to finish
+	// (bounded by the client timeout); Close only cancels the retries.
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "glory-hole")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// *url.Error repeats the full URL, secret path included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
+
+// redactURL reduces raw to its scheme and host for logging; Slack and
+// Discord webhook URLs carry their secret in the path.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "invalid URL"
+	}
+	return u.Scheme + "://" + u.Host
+}
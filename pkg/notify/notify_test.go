@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"glory-hole/pkg/config"
+	"glory-hole/pkg/logging"
+)
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization header = %q", got)
+		}
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		received <- ev
+	}))
+	defer srv.Close()
+
+	d := New(config.NotificationsConfig{Webhooks: []config.WebhookConfig{{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}}}, logging.NewDefault())
+	d.backoff = time.Millisecond
+	defer d.Close()
+
+	d.Notify(config.EventConfigReloaded, "Configuration reloaded", map[string]string{"path": "config.yml"})
+
+	select {
+	case ev := <-received:
+		if ev.Event != config.EventConfigReloaded || ev.Details["path"] != "config.yml" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d, want 3 (two 503s, then success)", n)
+	}
+}
+
+func TestDispatcher_EventFilterAndClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	d := New(config.NotificationsConfig{Webhooks: []config.WebhookConfig{{
+		URL:    srv.URL,
+		Events: []string{config.EventUpstreamsDown},
+	}}}, logging.NewDefault())
+	d.backoff = time.Millisecond
+
+	d.Notify(config.EventConfigReloaded, "filtered out", nil)
+	d.Notify(config.EventUpstreamsDown, "all upstreams down", nil)
+	d.Close()
+
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d, want 1 (filtered event skipped, 4xx not retried)", n)
+	}
+}
+
+func TestDispatcher_NilIsNoop(t *testing.T) {
+	var d *Dispatcher
+	d.Notify(config.EventConfigReloaded, "ignored", nil)
+	d.SetConfig(config.NotificationsConfig{})
+	d.Close()
+}
+
+func TestDispatcher_ErrorsOmitWebhookPath(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	hookURL := srv.URL + "/services/T000/B000/s3cret"
+	srv.Close()
+
+	d := New(config.NotificationsConfig{}, logging.NewDefault())
+	defer d.Close()
+	_, err := d.post(config.WebhookConfig{URL: hookURL}, []byte("{}"))
+	if err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("error leaks the webhook path: %v", err)
+	}
+	if got := redactURL(hookURL); got != srv.URL {
+		t.Errorf("redactURL() = %q, want %q", got, srv.URL)
+	}
+}
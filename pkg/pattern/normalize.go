@@ -0,0 +1,60 @@
+package pattern
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile converts Unicode names to punycode for lookup. STD3 rules are
+// relaxed because real blocklists and local zones contain underscores and
+// wildcard labels that strict hostname validation would reject.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// NormalizeDomain returns the canonical form used for every domain we store
+// or match against: ASCII (punycode for internationalized labels), lowercase,
+// without surrounding whitespace or a trailing dot. Queries arrive in this
+// form on the wire, so lists and rules entered as Unicode (münchen.de) match
+// their punycode queries (xn--mnchen-3ya.de). Names that fail IDNA conversion
+// are returned lowercased rather than dropped.
+func NormalizeDomain(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return ""
+	}
+	if isASCII(name) {
+		return strings.ToLower(name)
+	}
+	ascii, err := idnaProfile.ToASCII(name)
+	if err != nil {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(ascii)
+}
+
+// NormalizeFQDN is NormalizeDomain with a trailing dot, the key format used by
+// the blocklist and local records. It returns name unchanged (no allocation)
+// when it is already canonical, which is the common case for wire queries.
+func NormalizeFQDN(name string) string {
+	n := NormalizeDomain(name)
+	if n == "" {
+		return ""
+	}
+	if len(name) == len(n)+1 && name[len(n)] == '.' && name[:len(n)] == n {
+		return name
+	}
+	return n + "."
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package pattern
+
+import "testing"
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM.", "example.com"},
+		{"  example.com  ", "example.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"MÜNCHEN.DE.", "xn--mnchen-3ya.de"},
+		{"xn--mnchen-3ya.de", "xn--mnchen-3ya.de"},
+		{"XN--MNCHEN-3YA.DE.", "xn--mnchen-3ya.de"},
+		{"ads.münchen.de", "ads.xn--mnchen-3ya.de"},
+		{"*.münchen.de", "*.xn--mnchen-3ya.de"},
+		{"例え.jp", "xn--r8jz45g.jp"},
+		{"_dmarc.example.com", "_dmarc.example.com"},
+		{"", ""},
+		{".", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeDomain(tt.in); got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFQDN(t *testing.T) {
+	if got := NormalizeFQDN("münchen.de"); got != "xn--mnchen-3ya.de." {
+		t.Errorf("NormalizeFQDN(münchen.de) = %q", got)
+	}
+	if got := NormalizeFQDN("Example.com"); got != "example.com." {
+		t.Errorf("NormalizeFQDN(Example.com) = %q", got)
+	}
+	if got := NormalizeFQDN("."); got != "" {
+		t.Errorf("NormalizeFQDN(.) = %q, want empty", got)
+	}
+
+	canonical := "ads.example.com."
+	if allocs := testing.AllocsPerRun(100, func() { _ = NormalizeFQDN(canonical) }); allocs != 0 {
+		t.Errorf("NormalizeFQDN allocated %v times for a canonical name", allocs)
+	}
+}
+
+func TestMatcher_UnicodeAndPunycode(t *testing.T) {
+	m, err := NewMatcher([]string{"münchen.de", "*.köln.de", "XN--R8JZ45G.JP"})
+	if err != nil {
+		t.Fatalf("NewMatcher: %v", err)
+	}
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"xn--mnchen-3ya.de", true},
+		{"münchen.de", true},
+		{"www.xn--kln-sna.de", true},
+		{"www.köln.de.", true},
+		{"xn--kln-sna.de", false},
+		{"例え.jp", true},
+		{"xn--r8jz45g.jp", true},
+		{"munchen.de", false},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.domain); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
@@ -77,7 +77,7 @@ func ParsePattern(pattern string) (*Pattern, error) {
 	// Detect wildcards (*.example.com)
 	if strings.HasPrefix(pattern, "*.") {
 		return &Pattern{
-			Raw:  pattern,
+			Raw:  "*." + NormalizeDomain(pattern[2:]),
 			Type: PatternTypeWildcard,
 		}, nil
 	}
@@ -97,7 +97,7 @@ func ParsePattern(pattern string) (*Pattern, error) {
 
 	// Default to exact match
 	return &Pattern{
-		Raw:  pattern,
+		Raw:  NormalizeDomain(pattern),
 		Type: PatternTypeExact,
 	}, nil
 }
@@ -120,6 +120,36 @@ func (p *Pattern) Match(domain string) bool {
 	return false
 }
 
+// Specificity ranks how narrowly the pattern matches, for resolving overlaps
+// between allow and block rules (most specific wins). See DomainSpecificity.
+// Regex patterns can't be ranked and report 0.
+func (p *Pattern) Specificity() int {
+	switch p.Type {
+	case PatternTypeExact:
+		return DomainSpecificity(p.Raw, true)
+	case PatternTypeWildcard:
+		return DomainSpecificity(strings.TrimPrefix(p.Raw, "*."), false)
+	default:
+		return 0
+	}
+}
+
+// DomainSpecificity scores a domain-scoped match: two points per label of the
+// matched name, plus one when the match is exact rather than a suffix. So
+// ads.example.com (exact, 7) beats *.example.com (suffix, 4), and at equal
+// depth an exact name beats a subtree rooted at the same name.
+func DomainSpecificity(name string, exact bool) int {
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return 0
+	}
+	score := (strings.Count(name, ".") + 1) * 2
+	if exact {
+		score++
+	}
+	return score
+}
+
 // String returns a string representation of the pattern.
 func (p *Pattern) String() string {
 	return fmt.Sprintf("%s(%s)", p.Type, p.Raw)
@@ -176,6 +206,8 @@ func (m *Matcher) Match(domain string) bool {
 // MatchPattern returns the specific pattern that matched the provided domain.
 // The returned pointer may refer to an existing pattern; callers must treat it as read-only.
 func (m *Matcher) MatchPattern(domain string) (*Pattern, bool) {
+	domain = NormalizeDomain(domain)
+
 	// Try exact first (fastest)
 	if _, ok := m.exact[domain]; ok {
 		return &Pattern{
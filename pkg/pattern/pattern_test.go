@@ -426,3 +426,32 @@ func BenchmarkMatcherMatch(b *testing.B) {
 		}
 	}
 }
+
+func TestPattern_Specificity(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{"ads.example.com", 7},
+		{"*.example.com", 4},
+		{"*.ads.example.com", 6},
+		{`(\.|^)example\.com$`, 0},
+	}
+	for _, tt := range tests {
+		p, err := ParsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("ParsePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.Specificity(); got != tt.want {
+			t.Errorf("Specificity(%q) = %d, want %d", tt.pattern, got, tt.want)
+		}
+	}
+
+	// Exact beats a wildcard rooted at the same name, deeper beats shallower.
+	if DomainSpecificity("example.com", true) <= DomainSpecificity("example.com", false) {
+		t.Error("exact should outrank suffix at equal depth")
+	}
+	if DomainSpecificity("a.example.com", false) <= DomainSpecificity("example.com", true) {
+		t.Error("deeper suffix should outrank shallower exact")
+	}
+}
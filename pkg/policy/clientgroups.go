@@ -2,6 +2,7 @@ package policy
 
 import (
 	"context"
+	"sort"
 	"sync/atomic"
 
 	"glory-hole/pkg/storage"
@@ -39,6 +40,16 @@ func (noopResolver) IsInGroup(_, _ string) bool { return false }
 // package-level free functions.
 var resolver atomic.Pointer[ClientGroupResolver]
 
+// generation changes whenever group membership may have changed (resolver
+// swap or reload), so callers caching membership-derived values know when to
+// recompute them.
+var generation atomic.Uint64
+
+// ClientGroupsGeneration returns the current membership generation.
+func ClientGroupsGeneration() uint64 {
+	return generation.Load()
+}
+
 func init() {
 	var n ClientGroupResolver = noopResolver{}
 	resolver.Store(&n)
@@ -48,6 +59,7 @@ func init() {
 // Call once at engine init after building the SQLiteResolver. Subsequent
 // calls atomically swap the resolver — useful for tests.
 func SetClientGroupResolver(r ClientGroupResolver) {
+	defer generation.Add(1)
 	if r == nil {
 		var n ClientGroupResolver = noopResolver{}
 		resolver.Store(&n)
@@ -64,6 +76,21 @@ func InClientGroup(clientIP, groupName string) bool {
 	return (*resolver.Load()).IsInGroup(clientIP, groupName)
 }
 
+// ClientGroupLister is implemented by resolvers that can list the groups an
+// IP belongs to.
+type ClientGroupLister interface {
+	GroupsOf(clientIP string) []string
+}
+
+// ClientGroupsOf returns the groups clientIP belongs to, sorted, or nil when
+// it is in none or the active resolver can't list them.
+func ClientGroupsOf(clientIP string) []string {
+	if l, ok := (*resolver.Load()).(ClientGroupLister); ok {
+		return l.GroupsOf(clientIP)
+	}
+	return nil
+}
+
 // SQLiteResolver builds and serves the IP → groups cache from SQLite's
 // client_profiles table. Reload is cheap (single query, single map build)
 // and runs at engine init plus whenever the API mutates the underlying
@@ -98,6 +125,7 @@ func (r *SQLiteResolver) Reload(ctx context.Context) error {
 	if r.storage == nil {
 		empty := make(map[string]map[string]struct{})
 		r.cache.Store(&empty)
+		generation.Add(1)
 		return nil
 	}
 
@@ -119,9 +147,31 @@ func (r *SQLiteResolver) Reload(ctx context.Context) error {
 		groups[p.GroupName] = struct{}{}
 	}
 	r.cache.Store(&m)
+	generation.Add(1)
 	return nil
 }
 
+// GroupsOf returns the groups the given IP has been assigned to, sorted.
+func (r *SQLiteResolver) GroupsOf(clientIP string) []string {
+	if r == nil {
+		return nil
+	}
+	m := r.cache.Load()
+	if m == nil {
+		return nil
+	}
+	groups := (*m)[clientIP]
+	if len(groups) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // IsInGroup returns true if the given IP has been assigned to the given
 // group via the API. Lock-free single atomic load + two map lookups.
 func (r *SQLiteResolver) IsInGroup(clientIP, groupName string) bool {
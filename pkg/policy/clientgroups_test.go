@@ -58,6 +58,33 @@ func TestInClientGroup_DefaultIsNoop(t *testing.T) {
 	}
 }
 
+func TestClientGroupsOf(t *testing.T) {
+	resetResolver(t)
+	if got := ClientGroupsOf("10.0.0.1"); got != nil {
+		t.Fatalf("noop resolver: ClientGroupsOf = %v, want nil", got)
+	}
+
+	stor := &fakeProfileStorage{profiles: []*storage.ClientProfile{
+		{ClientIP: "10.0.0.1", GroupName: "kids"},
+		{ClientIP: "10.0.0.1", GroupName: "guests"},
+		{ClientIP: "10.0.0.2", GroupName: ""},
+	}}
+	r := NewSQLiteResolver(stor)
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	SetClientGroupResolver(r)
+
+	if got := ClientGroupsOf("10.0.0.1"); len(got) != 2 || got[0] != "guests" || got[1] != "kids" {
+		t.Errorf("ClientGroupsOf(10.0.0.1) = %v, want [guests kids]", got)
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+		if got := ClientGroupsOf(ip); got != nil {
+			t.Errorf("ClientGroupsOf(%s) = %v, want nil", ip, got)
+		}
+	}
+}
+
 func TestSetClientGroupResolver_NilFallsBackToNoop(t *testing.T) {
 	resetResolver(t)
 	// Set a real resolver, then nil it — must fall back to noop.
@@ -265,6 +292,9 @@ func TestInClientGroup_EndToEndThroughEngine(t *testing.T) {
 		{"kid hits target", Context{Domain: "example.com", ClientIP: "10.0.0.50"}, true},
 		{"non-kid hits target", Context{Domain: "example.com", ClientIP: "10.0.0.99"}, false},
 		{"kid hits unrelated", Context{Domain: "other.com", ClientIP: "10.0.0.50"}, false},
+		// A group assigned on arrival (DoH token) replaces IP membership
+		{"assigned kids group", Context{Domain: "example.com", ClientIP: "10.0.0.99", ClientGroup: "kids"}, true},
+		{"assigned other group", Context{Domain: "example.com", ClientIP: "10.0.0.50", ClientGroup: "adults"}, false},
 	}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
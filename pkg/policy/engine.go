@@ -6,15 +6,20 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/logging"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
+	"github.com/miekg/dns"
 )
 
 // asString safely converts a parameter to string, returning an error instead of panicking.
@@ -48,11 +53,20 @@ type Engine struct {
 // Rule represents a single policy rule
 type Rule struct {
 	program    *vm.Program
+	scope      domainScope
+	hits       atomic.Uint64 // queries this rule decided since it was loaded
+	lastHit    atomic.Int64  // unix nanoseconds of the latest hit, 0 if none
 	Name       string
 	Logic      string
 	Action     string
 	ActionData string
-	Enabled    bool
+	// Category labels a BLOCK rule's blocks (e.g. "malware") in decision
+	// traces and block explanations.
+	Category string
+	// Priority orders evaluation: higher values are evaluated first, and
+	// rules with equal priority keep the order they were added in.
+	Priority int
+	Enabled  bool
 }
 
 // Action constants
@@ -75,6 +89,21 @@ type Context struct {
 	Day       int
 	Month     int
 	Weekday   int
+
+	// ClientGroup is the group the query was assigned on arrival, such as
+	// a DoH path token's group; "" when membership comes from the client IP.
+	ClientGroup string
+}
+
+// InClientGroup is the rule-logic membership check,
+// `InClientGroup(ClientIP, "kids")`. A query that arrived with a group is in
+// exactly that group; otherwise ip is looked up in the client-group resolver
+// (SetClientGroupResolver), whose noop default returns false.
+func (c Context) InClientGroup(ip, group string) bool {
+	if c.ClientGroup != "" && ip == c.ClientIP {
+		return c.ClientGroup == group
+	}
+	return InClientGroup(ip, group)
 }
 
 // NewEngine creates a new policy engine
@@ -99,9 +128,9 @@ func (e *Engine) HasAction(action string) bool {
 
 // compileRuleLogic compiles a rule expression with the standard environment
 // and safe helper function wrappers. All type assertions use asString/asInt
-// to return errors instead of panicking.
-func compileRuleLogic(logic string) (*vm.Program, error) {
-	return expr.Compile(logic,
+// to return errors instead of panicking. extra options are appended.
+func compileRuleLogic(logic string, extra ...expr.Option) (*vm.Program, error) {
+	opts := []expr.Option{
 		expr.Env(Context{}),
 		// Domain matching functions
 		expr.Function("DomainMatches",
@@ -199,22 +228,8 @@ func compileRuleLogic(logic string) (*vm.Program, error) {
 			},
 			new(func(string, string) bool),
 		),
-		// Client group membership (resolver populated via SetClientGroupResolver;
-		// noop default returns false for every (ip, group) pair).
-		expr.Function("InClientGroup",
-			func(params ...any) (any, error) {
-				ip, e := asString(params[0], "InClientGroup.ip")
-				if e != nil {
-					return false, e
-				}
-				group, e := asString(params[1], "InClientGroup.group")
-				if e != nil {
-					return false, e
-				}
-				return InClientGroup(ip, group), nil
-			},
-			new(func(string, string) bool),
-		),
+		// Client group membership is Context.InClientGroup, a method so it
+		// can see a group the query arrived with (Context.ClientGroup).
 		// Query type functions
 		expr.Function("QueryTypeIn",
 			func(params ...any) (any, error) {
@@ -274,7 +289,8 @@ func compileRuleLogic(logic string) (*vm.Program, error) {
 			},
 			new(func(int, int, int, int, int, int) bool),
 		),
-	)
+	}
+	return expr.Compile(logic, append(opts, extra...)...)
 }
 
 // Compile validates and compiles a rule's logic expression outside the engine.
@@ -288,6 +304,7 @@ func (r *Rule) Compile() error {
 		return fmt.Errorf("failed to compile rule '%s': %w", r.Name, err)
 	}
 	r.program = program
+	r.scope = parseDomainScope(r.Logic)
 	return nil
 }
 
@@ -308,18 +325,40 @@ func (e *Engine) AddRule(rule *Rule) error {
 	}
 
 	rule.program = program
+	rule.scope = parseDomainScope(rule.Logic)
 
 	e.mu.Lock()
-	e.rules = append(e.rules, rule)
+	// Insert after every rule of equal or higher priority so insertion order
+	// breaks ties.
+	i := sort.Search(len(e.rules), func(i int) bool { return e.rules[i].Priority < rule.Priority })
+	e.rules = slices.Insert(e.rules, i, rule)
 	e.count.Store(int32(len(e.rules)))
 	e.mu.Unlock()
 
 	return nil
 }
 
+// sortRules orders rules by descending priority, keeping the existing order
+// of rules with equal priority.
+func sortRules(rules []*Rule) {
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+}
+
 // Evaluate evaluates all rules against the given context
-// Returns (matched, rule) where matched is true if a rule matched
+// Returns (matched, rule) where matched is true if a rule matched.
+// The matching rule's hit counter is incremented.
 func (e *Engine) Evaluate(ctx Context) (bool, *Rule) {
+	matched, rule := e.Match(ctx)
+	if matched {
+		rule.hits.Add(1)
+		rule.lastHit.Store(time.Now().UnixNano())
+	}
+	return matched, rule
+}
+
+// Match evaluates the rules like Evaluate but does not count a hit. Use it
+// for lookahead and diagnostics that don't decide a query.
+func (e *Engine) Match(ctx Context) (bool, *Rule) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
@@ -366,7 +405,8 @@ func (e *Engine) RemoveRule(name string) bool {
 	return false
 }
 
-// UpdateRule updates a rule at the given index, preserving evaluation order.
+// UpdateRule updates a rule at the given index. The rule keeps its position
+// among rules of equal priority; a changed priority moves it accordingly.
 // Returns an error if the index is out of bounds or the rule fails validation.
 func (e *Engine) UpdateRule(index int, rule *Rule) error {
 	if rule == nil {
@@ -385,6 +425,7 @@ func (e *Engine) UpdateRule(index int, rule *Rule) error {
 	}
 
 	rule.program = program
+	rule.scope = parseDomainScope(rule.Logic)
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -394,6 +435,7 @@ func (e *Engine) UpdateRule(index int, rule *Rule) error {
 	}
 
 	e.rules[index] = rule
+	sortRules(e.rules)
 	return nil
 }
 
@@ -407,6 +449,36 @@ func (e *Engine) GetRules() []*Rule {
 	return rules
 }
 
+// RuleStats reports how often a rule has matched since it was loaded.
+type RuleStats struct {
+	LastHit time.Time // zero if the rule never matched
+	Name    string
+	Action  string
+	Hits    uint64
+	Enabled bool
+}
+
+// Hits returns how many queries this rule has decided since it was loaded.
+func (r *Rule) Hits() uint64 {
+	return r.hits.Load()
+}
+
+// Stats returns the hit counters of every rule in evaluation order. Counters
+// start at zero when a rule is added or the rule set is replaced.
+func (e *Engine) Stats() []RuleStats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	stats := make([]RuleStats, len(e.rules))
+	for i, r := range e.rules {
+		stats[i] = RuleStats{Name: r.Name, Action: r.Action, Enabled: r.Enabled, Hits: r.hits.Load()}
+		if ns := r.lastHit.Load(); ns != 0 {
+			stats[i].LastHit = time.Unix(0, ns).UTC()
+		}
+	}
+	return stats
+}
+
 // Count returns the number of rules without acquiring a lock.
 // Uses an atomic counter kept in sync by Add/Remove/Clear.
 func (e *Engine) Count() int {
@@ -416,7 +488,9 @@ func (e *Engine) Count() int {
 // ReplaceRules atomically swaps the entire rule set under a single lock.
 // Rules must already be compiled (via compileRuleLogic). This avoids the
 // window where Clear+AddRule leaves readers seeing an empty/partial set.
+// Rules are sorted by priority; the slice order breaks ties.
 func (e *Engine) ReplaceRules(rules []*Rule) {
+	sortRules(rules)
 	e.mu.Lock()
 	e.rules = rules
 	e.count.Store(int32(len(rules)))
@@ -597,17 +671,35 @@ func IPEquals(ip1Str, ip2Str string) bool {
 	return ip1.Equal(ip2)
 }
 
-// QueryTypeIn checks if query type is in a list of types
+// QueryTypeIn checks if query type is in a list of types. Matching is
+// case-insensitive and accepts the RFC 3597 form for any type, so "TYPE65"
+// matches HTTPS and "TYPE65280" matches a query for an unassigned type.
 func QueryTypeIn(queryType string, types ...string) bool {
-	queryType = strings.ToUpper(queryType)
+	queryType = normalizeQueryType(queryType)
 	for _, t := range types {
-		if strings.ToUpper(t) == queryType {
+		if normalizeQueryType(t) == queryType {
 			return true
 		}
 	}
 	return false
 }
 
+// normalizeQueryType upper-cases t and rewrites "TYPEnnn" to the mnemonic
+// when the type has one, matching the labels the DNS handler passes in
+// Context.QueryType.
+func normalizeQueryType(t string) string {
+	t = strings.ToUpper(strings.TrimSpace(t))
+	if num, ok := strings.CutPrefix(t, "TYPE"); ok {
+		if n, err := strconv.ParseUint(num, 10, 16); err == nil {
+			if name, known := dns.TypeToString[uint16(n)]; known {
+				return name
+			}
+			return "TYPE" + strconv.FormatUint(n, 10)
+		}
+	}
+	return t
+}
+
 // IsWeekend checks if the given weekday is Saturday (6) or Sunday (0)
 func IsWeekend(weekday int) bool {
 	return weekday == 0 || weekday == 6
@@ -631,8 +723,12 @@ func InTimeRange(hour, minute, startHour, startMinute, endHour, endMinute int) b
 
 // NewContext creates a new evaluation context from a DNS query
 func NewContext(domain, clientIP, queryType string) Context {
-	now := time.Now()
+	return NewContextAt(domain, clientIP, queryType, time.Now())
+}
 
+// NewContextAt is NewContext evaluated at a given time, for testing rules
+// that depend on the hour or weekday.
+func NewContextAt(domain, clientIP, queryType string, now time.Time) Context {
 	return Context{
 		Domain:    domain,
 		ClientIP:  clientIP,
@@ -651,6 +747,10 @@ func validateAction(rule *Rule) error {
 	action := strings.ToUpper(rule.Action)
 	rule.Action = action // Normalize to uppercase
 
+	if action != ActionBlock && strings.TrimSpace(rule.Category) != "" {
+		return fmt.Errorf("category is only valid for BLOCK rules")
+	}
+
 	switch action {
 	case ActionBlock, ActionAllow:
 		// No action_data needed
@@ -692,7 +792,8 @@ func validateAction(rule *Rule) error {
 
 // ParseUpstreams parses a comma-separated list of upstream DNS servers
 // Format: "host:port,host:port" or just "host:port"
-// Adds default port :53 if not specified
+// Adds default port :53 if not specified. DNSCrypt upstreams (sdns:// stamps
+// or dnscrypt:// URLs) are accepted as-is once they parse.
 func ParseUpstreams(actionData string) ([]string, error) {
 	if actionData == "" {
 		return nil, fmt.Errorf("empty upstream list")
@@ -707,6 +808,14 @@ func ParseUpstreams(actionData string) ([]string, error) {
 			continue
 		}
 
+		if dnscrypt.IsUpstream(part) {
+			if _, err := dnscrypt.ParseUpstream(part); err != nil {
+				return nil, err
+			}
+			upstreams = append(upstreams, part)
+			continue
+		}
+
 		// Validate format: must be host:port or just host
 		if strings.Contains(part, ":") {
 			// Already has port, validate it
@@ -730,6 +839,15 @@ func ParseUpstreams(actionData string) ([]string, error) {
 	return upstreams, nil
 }
 
+// BlockCategory returns the category of a BLOCK rule. It is empty for
+// other actions.
+func (r *Rule) BlockCategory() string {
+	if r.Action != ActionBlock {
+		return ""
+	}
+	return strings.TrimSpace(r.Category)
+}
+
 // GetUpstreams returns the parsed upstream list from a FORWARD rule's action_data
 // Returns nil if the rule is not a FORWARD action or parsing fails
 func (r *Rule) GetUpstreams() []string {
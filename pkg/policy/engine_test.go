@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -625,6 +626,18 @@ func TestParseUpstreams(t *testing.T) {
 			want:       []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"},
 			wantErr:    false,
 		},
+		{
+			name:       "dnscrypt stamp kept as-is",
+			actionData: "sdns://AQIAAAAAAAAAFDE3Ni4xMDMuMTMwLjEzMDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20, 9.9.9.9",
+			want:       []string{"sdns://AQIAAAAAAAAAFDE3Ni4xMDMuMTMwLjEzMDo1NDQzINErR_JS3PLCu_iZEIbq95zkSV2LFsigxDIuUso_OQhzIjIuZG5zY3J5cHQuZGVmYXVsdC5uczEuYWRndWFyZC5jb20", "9.9.9.9:53"},
+			wantErr:    false,
+		},
+		{
+			name:       "invalid dnscrypt stamp",
+			actionData: "sdns://AQ",
+			want:       nil,
+			wantErr:    true,
+		},
 		{
 			name:       "empty string",
 			actionData: "",
@@ -771,6 +784,7 @@ func TestValidateActionViaAddRule(t *testing.T) {
 		name       string
 		action     string
 		actionData string
+		category   string
 		wantErr    bool
 	}{
 		{
@@ -815,6 +829,18 @@ func TestValidateActionViaAddRule(t *testing.T) {
 			actionData: ":53",
 			wantErr:    true,
 		},
+		{
+			name:     "BLOCK action with category",
+			action:   ActionBlock,
+			category: "malware",
+			wantErr:  false,
+		},
+		{
+			name:     "ALLOW action with category",
+			action:   ActionAllow,
+			category: "malware",
+			wantErr:  true,
+		},
 	}
 
 	engine := NewEngine(nil)
@@ -825,6 +851,7 @@ func TestValidateActionViaAddRule(t *testing.T) {
 				Logic:      "true", // Simple logic that always matches
 				Action:     tt.action,
 				ActionData: tt.actionData,
+				Category:   tt.category,
 				Enabled:    true,
 			}
 			err := engine.AddRule(rule)
@@ -834,3 +861,127 @@ func TestValidateActionViaAddRule(t *testing.T) {
 		})
 	}
 }
+
+func TestRule_Specificity(t *testing.T) {
+	tests := []struct {
+		name   string
+		logic  string
+		domain string
+		want   int
+		ok     bool
+	}{
+		{"exact", `Domain == "ads.example.com"`, "ads.example.com", 7, true},
+		{"wildcard subdomain", `Domain == "example.com" || DomainEndsWith(Domain, ".example.com")`, "ads.example.com", 4, true},
+		{"wildcard apex", `Domain == "example.com" || DomainEndsWith(Domain, ".example.com")`, "example.com.", 5, true},
+		{"domain matches", `DomainMatches(Domain, "example.com")`, "a.example.com", 4, true},
+		{"bare label", `DomainMatches(Domain, "facebook")`, "www.facebook.com", 0, true},
+		{"mismatched subtree", `Domain == "a.com" || DomainEndsWith(Domain, ".b.com")`, "x.b.com", 0, false},
+		{"client scoped", `ClientIP == "10.0.0.1" && Domain == "ads.example.com"`, "ads.example.com", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &Rule{Name: tt.name, Logic: tt.logic, Action: ActionAllow, Enabled: true}
+			if err := rule.Compile(); err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got, ok := rule.Specificity(tt.domain)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Specificity(%q) = (%d, %v), want (%d, %v)", tt.domain, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEngine_RuleHitCounters(t *testing.T) {
+	e := NewEngine(nil)
+	for _, r := range []*Rule{
+		{Name: "block-ads", Logic: `Domain == "ads.example.com"`, Action: ActionBlock, Enabled: true},
+		{Name: "dead-rule", Logic: `Domain == "never.example.com"`, Action: ActionBlock, Enabled: true},
+	} {
+		if err := e.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := NewContext("ads.example.com", "192.168.1.10", "A")
+	for i := 0; i < 3; i++ {
+		e.Evaluate(ctx)
+	}
+	e.Evaluate(NewContext("other.example.com", "192.168.1.10", "A"))
+	// Match is for lookahead and must not count.
+	e.Match(ctx)
+
+	stats := e.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 rules, got %d", len(stats))
+	}
+	if stats[0].Name != "block-ads" || stats[0].Hits != 3 || stats[0].LastHit.IsZero() {
+		t.Errorf("block-ads stats = %+v, want 3 hits with a last hit time", stats[0])
+	}
+	if stats[1].Hits != 0 || !stats[1].LastHit.IsZero() {
+		t.Errorf("dead-rule stats = %+v, want no hits", stats[1])
+	}
+
+	// Replacing the rule set starts the counters over.
+	fresh := &Rule{Name: "block-ads", Logic: `Domain == "ads.example.com"`, Action: ActionBlock, Enabled: true}
+	if err := fresh.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	e.ReplaceRules([]*Rule{fresh})
+	if stats := e.Stats(); len(stats) != 1 || stats[0].Hits != 0 {
+		t.Errorf("after reload: %+v, want one rule with 0 hits", stats)
+	}
+}
+
+func TestEngine_RulePriority(t *testing.T) {
+	e := NewEngine(nil)
+	add := func(name string, priority int) {
+		t.Helper()
+		if err := e.AddRule(&Rule{Name: name, Logic: `Domain == "x.example.com"`, Action: ActionBlock, Priority: priority, Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("default-a", 0)
+	add("high", 10)
+	add("low", -5)
+	add("default-b", 0)
+	add("high-b", 10)
+
+	order := func(rules []*Rule) string {
+		names := make([]string, len(rules))
+		for i, r := range rules {
+			names[i] = r.Name
+		}
+		return strings.Join(names, ",")
+	}
+	if got, want := order(e.GetRules()), "high,high-b,default-a,default-b,low"; got != want {
+		t.Errorf("order after AddRule = %s, want %s", got, want)
+	}
+	if _, rule := e.Evaluate(NewContext("x.example.com", "192.168.1.10", "A")); rule.Name != "high" {
+		t.Errorf("matched %q, want the highest-priority rule", rule.Name)
+	}
+
+	// Raising a rule's priority via UpdateRule moves it up.
+	bumped := &Rule{Name: "low", Logic: `Domain == "x.example.com"`, Action: ActionBlock, Priority: 20, Enabled: true}
+	if err := e.UpdateRule(4, bumped); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := order(e.GetRules()), "low,high,high-b,default-a,default-b"; got != want {
+		t.Errorf("order after UpdateRule = %s, want %s", got, want)
+	}
+
+	// ReplaceRules sorts by priority and keeps the given order for ties.
+	var rules []*Rule
+	for i, name := range []string{"a", "b", "c"} {
+		r := &Rule{Name: name, Logic: `Domain == "x.example.com"`, Action: ActionBlock, Priority: []int{0, 1, 0}[i], Enabled: true}
+		if err := r.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, r)
+	}
+	e.ReplaceRules(rules)
+	if got, want := order(e.GetRules()), "b,a,c"; got != want {
+		t.Errorf("order after ReplaceRules = %s, want %s", got, want)
+	}
+}
@@ -217,6 +217,30 @@ func TestQueryTypeIn(t *testing.T) {
 			types:     []string{},
 			expected:  false,
 		},
+		{
+			name:      "RFC 3597 form of a known type",
+			queryType: "HTTPS",
+			types:     []string{"TYPE65"},
+			expected:  true,
+		},
+		{
+			name:      "unknown type label",
+			queryType: "TYPE65280",
+			types:     []string{"type65280"},
+			expected:  true,
+		},
+		{
+			name:      "unknown type with leading zeros",
+			queryType: "TYPE65280",
+			types:     []string{"TYPE065280"},
+			expected:  true,
+		},
+		{
+			name:      "different unknown type",
+			queryType: "TYPE65280",
+			types:     []string{"TYPE65281"},
+			expected:  false,
+		},
 	}
 
 	for _, tt := range tests {
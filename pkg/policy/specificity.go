@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+
+	"glory-hole/pkg/pattern"
+)
+
+// domainScope is the domain a whitelist/blacklist-shaped rule is limited to.
+// Derived once at compile time from the rule's logic.
+type domainScope struct {
+	name    string // lowercased, no trailing dot
+	subtree bool   // also matches subdomains of name
+	ranked  bool   // false for logic that isn't a plain domain scope
+}
+
+var (
+	exactScopeRe   = regexp.MustCompile(`^Domain\s*==\s*"([^"]+)"$`)
+	subtreeScopeRe = regexp.MustCompile(`^Domain\s*==\s*"([^"]+)"\s*\|\|\s*DomainEndsWith\(\s*Domain\s*,\s*"\.([^"]+)"\s*\)$`)
+	matchesScopeRe = regexp.MustCompile(`^DomainMatches\(\s*Domain\s*,\s*"([^"]+)"\s*\)$`)
+)
+
+// parseDomainScope recognises the logic shapes produced by the whitelist
+// migration, the Pi-hole importer, and the UI domain-list forms.
+func parseDomainScope(logic string) domainScope {
+	logic = strings.TrimSpace(logic)
+	if m := subtreeScopeRe.FindStringSubmatch(logic); m != nil {
+		if pattern.NormalizeDomain(m[1]) == pattern.NormalizeDomain(m[2]) {
+			return domainScope{name: pattern.NormalizeDomain(m[1]), subtree: true, ranked: true}
+		}
+		return domainScope{}
+	}
+	if m := exactScopeRe.FindStringSubmatch(logic); m != nil {
+		return domainScope{name: pattern.NormalizeDomain(m[1]), ranked: true}
+	}
+	if m := matchesScopeRe.FindStringSubmatch(logic); m != nil {
+		name := pattern.NormalizeDomain(strings.TrimPrefix(m[1], "."))
+		// Bare labels ("facebook") match anywhere in the name and regex-looking
+		// entries can't be ranked; both rank lowest.
+		if !strings.Contains(name, ".") || strings.ContainsAny(name, "()[]{}^$|\\+?*") {
+			return domainScope{ranked: true}
+		}
+		return domainScope{name: name, subtree: true, ranked: true}
+	}
+	return domainScope{}
+}
+
+// Specificity reports how narrowly the rule matches domain, on the same scale
+// as pattern.DomainSpecificity, so an ALLOW rule can be weighed against an
+// overlapping blocklist entry. ok is false when the rule's logic is not a
+// plain domain scope (e.g. it also tests ClientIP or Hour); such rules are
+// deliberate policy and always take precedence.
+func (r *Rule) Specificity(domain string) (score int, ok bool) {
+	if !r.scope.ranked {
+		return 0, false
+	}
+	if r.scope.name == "" {
+		return 0, true
+	}
+	exact := pattern.NormalizeDomain(domain) == r.scope.name
+	return pattern.DomainSpecificity(r.scope.name, exact || !r.scope.subtree), true
+}
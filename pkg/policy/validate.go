@@ -0,0 +1,72 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm"
+)
+
+// SyntaxError describes why a rule's logic does not compile. Line and Column
+// are 1-based and zero when the compiler reported no position.
+type SyntaxError struct {
+	Message string
+	Snippet string // offending line with a caret under the error, if known
+	Line    int
+	Column  int
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s (line %d, column %d)", e.Message, e.Line, e.Column)
+}
+
+// ValidateLogic compiles logic the way the engine does and additionally
+// requires it to produce a boolean, since a rule whose expression yields any
+// other type can never match. It returns nil when the logic is usable.
+func ValidateLogic(logic string) *SyntaxError {
+	if strings.TrimSpace(logic) == "" {
+		return &SyntaxError{Message: "logic expression is empty"}
+	}
+	_, err := compileRuleLogic(logic, expr.AsBool())
+	if err == nil {
+		return nil
+	}
+	var fe *file.Error
+	if !errors.As(err, &fe) {
+		return &SyntaxError{Message: err.Error()}
+	}
+	se := &SyntaxError{Message: fe.Message, Snippet: strings.TrimPrefix(fe.Snippet, "\n")}
+	if fe.Line > 0 {
+		se.Line = fe.Line
+		se.Column = fe.Column + 1
+	}
+	return se
+}
+
+// ValidateAction checks a rule's action, action_data and category without
+// compiling its logic. The rule is not modified.
+func ValidateAction(action, actionData, category string) error {
+	return validateAction(&Rule{Action: action, ActionData: actionData, Category: category})
+}
+
+// Test compiles logic and reports whether it matches ctx. Unlike the engine,
+// which skips a rule whose evaluation fails, it returns the runtime error
+// (for example an invalid DomainRegex pattern) so rule authors can see it.
+func Test(logic string, ctx Context) (bool, error) {
+	program, err := compileRuleLogic(logic, expr.AsBool())
+	if err != nil {
+		return false, err
+	}
+	out, err := vm.Run(program, ctx)
+	if err != nil {
+		return false, fmt.Errorf("evaluation failed: %w", err)
+	}
+	matched, _ := out.(bool)
+	return matched, nil
+}
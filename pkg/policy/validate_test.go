@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateLogic(t *testing.T) {
+	tests := []struct {
+		name    string
+		logic   string
+		wantMsg string
+		line    int
+		column  int
+	}{
+		{name: "valid", logic: `DomainEndsWith(Domain, ".example.com") && Hour >= 9`},
+		{name: "empty", logic: "  ", wantMsg: "empty"},
+		{name: "trailing operator", logic: `Domain == "a" &&`, wantMsg: "unexpected token", line: 1, column: 16},
+		{name: "unknown field on second line", logic: "Domain == \"a\" &&\n  Foo == 1", wantMsg: "unknown name Foo", line: 2, column: 3},
+		{name: "not boolean", logic: `Hour + 1`, wantMsg: "expected bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			se := ValidateLogic(tt.logic)
+			if tt.wantMsg == "" {
+				if se != nil {
+					t.Fatalf("ValidateLogic() = %v, want nil", se)
+				}
+				return
+			}
+			if se == nil {
+				t.Fatal("ValidateLogic() = nil, want an error")
+			}
+			if !strings.Contains(se.Message, tt.wantMsg) {
+				t.Errorf("message = %q, want it to contain %q", se.Message, tt.wantMsg)
+			}
+			if se.Line != tt.line || se.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", se.Line, se.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestValidateAction(t *testing.T) {
+	if err := ValidateAction("redirect", "10.0.0.1", ""); err != nil {
+		t.Errorf("lowercase REDIRECT with an IP should be valid: %v", err)
+	}
+	if err := ValidateAction("REDIRECT", "not-an-ip", ""); err == nil {
+		t.Error("REDIRECT with an invalid IP should fail")
+	}
+	if err := ValidateAction("DROP", "", ""); err == nil {
+		t.Error("unknown action should fail")
+	}
+	if err := ValidateAction("ALLOW", "", "malware"); err == nil {
+		t.Error("category on an ALLOW rule should fail")
+	}
+}
+
+func TestTest(t *testing.T) {
+	night := time.Date(2026, 1, 5, 23, 30, 0, 0, time.Local)
+	ctx := NewContextAt("ads.example.com", "192.168.1.10", "A", night)
+
+	matched, err := Test(`DomainEndsWith(Domain, ".example.com") && Hour >= 22`, ctx)
+	if err != nil || !matched {
+		t.Errorf("Test() = %v, %v; want match", matched, err)
+	}
+	matched, err = Test(`IPInCIDR(ClientIP, "10.0.0.0/8")`, ctx)
+	if err != nil || matched {
+		t.Errorf("Test() = %v, %v; want no match", matched, err)
+	}
+	// Runtime failures are reported instead of silently skipping the rule.
+	if _, err := Test(`DomainRegex(Domain, "[")`, ctx); err == nil {
+		t.Error("Test() with an invalid regex should return an error")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"time"
 
+	"glory-hole/pkg/dnscrypt"
 	"glory-hole/pkg/logging"
 )
 
@@ -39,6 +40,10 @@ func NewStrict(upstreams []string, logger *logging.Logger) *Resolver {
 }
 
 func newWithOptions(upstreams []string, logger *logging.Logger, strict bool) *Resolver {
+	// The resolver speaks plain DNS only; DNSCrypt upstreams are left to the
+	// forwarder.
+	upstreams = dnscrypt.PlainUpstreams(upstreams)
+
 	if len(upstreams) == 0 {
 		logger.Warn("No upstream DNS servers configured, using system default resolver")
 	} else {
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryCursor is a position in the newest-first query log, ordered by
+// (timestamp, id). Use the last row of a page as the cursor for the next.
+type QueryCursor struct {
+	Timestamp time.Time
+	ID        int64
+}
+
+// CursorAfter returns the cursor that continues after q.
+func CursorAfter(q *QueryLog) *QueryCursor {
+	return &QueryCursor{Timestamp: q.Timestamp, ID: q.ID}
+}
+
+// Encode returns an opaque, URL-safe form of the cursor.
+func (c QueryCursor) Encode() string {
+	raw := FormatTimestamp(c.Timestamp) + "|" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeQueryCursor parses a cursor produced by QueryCursor.Encode.
+func DecodeQueryCursor(s string) (*QueryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor timestamp: %w", err)
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor id: %w", err)
+	}
+	return &QueryCursor{Timestamp: t, ID: n}, nil
+}
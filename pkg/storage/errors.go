@@ -32,4 +32,10 @@ var (
 
 	// ErrClosed is returned when attempting to use a closed storage
 	ErrClosed = errors.New("storage is closed")
+
+	// ErrBackupUnsupported is returned when the database is not file-backed
+	ErrBackupUnsupported = errors.New("backup requires a file-backed database")
+
+	// ErrInvalidSnapshot is returned when an uploaded restore is not a usable database
+	ErrInvalidSnapshot = errors.New("invalid database snapshot")
 )
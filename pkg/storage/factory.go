@@ -52,6 +52,11 @@ func (n *NoOpStorage) GetRecentQueries(ctx context.Context, limit, offset int) (
 	return []*QueryLog{}, nil
 }
 
+// GetRecentBlocked returns an empty slice
+func (n *NoOpStorage) GetRecentBlocked(ctx context.Context, limit, offset int) ([]*QueryLog, error) {
+	return []*QueryLog{}, nil
+}
+
 // GetQueriesByDomain returns an empty slice
 func (n *NoOpStorage) GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*QueryLog, error) {
 	return []*QueryLog{}, nil
@@ -75,6 +80,10 @@ func (n *NoOpStorage) GetTopDomains(ctx context.Context, limit int, blocked bool
 	return []*DomainStats{}, nil
 }
 
+func (n *NoOpStorage) CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
 // GetBlockedCount returns zero
 func (n *NoOpStorage) GetBlockedCount(ctx context.Context, since time.Time) (int64, error) {
 	return 0, nil
@@ -90,6 +99,10 @@ func (n *NoOpStorage) GetQueriesFiltered(ctx context.Context, filter QueryFilter
 	return []*QueryLog{}, nil
 }
 
+func (n *NoOpStorage) CountQueriesFiltered(ctx context.Context, filter QueryFilter, limit int) (int64, error) {
+	return 0, nil
+}
+
 // GetTimeSeriesStats returns zero-filled time series data
 func (n *NoOpStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
 	if points < 1 {
@@ -119,6 +132,16 @@ func (n *NoOpStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Durati
 	return data, nil
 }
 
+// GetDomainTimeSeries returns zero-filled time series data
+func (n *NoOpStorage) GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
+	return n.GetTimeSeriesStats(ctx, bucket, points)
+}
+
+// GetClientTimeSeries returns zero-filled time series data
+func (n *NoOpStorage) GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
+	return n.GetTimeSeriesStats(ctx, bucket, points)
+}
+
 // GetTraceStatistics returns empty trace statistics
 func (n *NoOpStorage) GetTraceStatistics(ctx context.Context, since time.Time) (*TraceStatistics, error) {
 	return &TraceStatistics{
@@ -141,10 +164,22 @@ func (n *NoOpStorage) GetQueryTypeStats(ctx context.Context, limit int, since ti
 	return []*QueryTypeStats{}, nil
 }
 
-func (n *NoOpStorage) GetClientSummaries(ctx context.Context, limit, offset int) ([]*ClientSummary, error) {
+func (n *NoOpStorage) GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*ClientSummary, error) {
 	return []*ClientSummary{}, nil
 }
 
+func (n *NoOpStorage) CountClientSummaries(ctx context.Context, since time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (n *NoOpStorage) SetClientHostname(ctx context.Context, clientIP, hostname string) error {
+	return nil
+}
+
+func (n *NoOpStorage) ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error) {
+	return []string{}, nil
+}
+
 func (n *NoOpStorage) ListClientProfiles(ctx context.Context) ([]*ClientProfile, error) {
 	return []*ClientProfile{}, nil
 }
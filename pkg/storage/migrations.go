@@ -322,6 +322,120 @@ var migrations = []Migration{
 			DROP INDEX IF EXISTS idx_queries_blocked_timestamp;
 		`,
 	},
+	{
+		Version:     17,
+		Description: "Add discovered hostname to client_profiles",
+		SQL: `
+			-- Hostname found via DHCP leases or PTR lookup. Kept separate from
+			-- display_name so discovery never overwrites an operator-set name.
+			ALTER TABLE client_profiles ADD COLUMN hostname TEXT;
+		`,
+	},
+	{
+		Version:     18,
+		Description: "Add index for recent blocked queries (blocked, timestamp, id)",
+		SQL: `
+			-- Serves GetRecentBlocked: WHERE blocked = 1 ORDER BY timestamp
+			-- DESC, id DESC walks this index backwards with no sort step.
+			-- idx_queries_blocked_ts_domain has the same prefix, but its
+			-- domain column breaks the id tie-break, forcing a temp B-tree.
+			CREATE INDEX IF NOT EXISTS idx_queries_blocked_ts_id
+				ON queries(blocked, timestamp, id);
+		`,
+	},
+	{
+		Version:     19,
+		Description: "Ensure (domain, timestamp), (client_ip, timestamp) and (timestamp) indexes; drop duplicate client index",
+		SQL: `
+			-- Domain / client lookups (GetQueriesByDomain, GetQueriesByClientIP,
+			-- GetQueriesFiltered's client_ip filter) filter on equality and
+			-- sort newest first. These indexes date from migrations 3/4; the
+			-- IF NOT EXISTS statements make the guarantee explicit for
+			-- databases whose indexes were dropped or never built by hand.
+			CREATE INDEX IF NOT EXISTS idx_queries_domain_timestamp ON queries(domain, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_queries_client_timestamp ON queries(client_ip, timestamp);
+			CREATE INDEX IF NOT EXISTS idx_queries_timestamp ON queries(timestamp);
+
+			-- idx_queries_client_ip_timestamp_id duplicates
+			-- idx_queries_client_timestamp: every index entry already ends in
+			-- the rowid (id). Drop it to save one index write per query.
+			DROP INDEX IF EXISTS idx_queries_client_ip_timestamp_id;
+		`,
+	},
+	{
+		Version:     20,
+		Description: "Add priority to policy_rules",
+		SQL: `
+			-- Higher priority rules are evaluated first; sort_order (insertion
+			-- order) breaks ties. Existing rules keep their order at 0.
+			ALTER TABLE policy_rules ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+		`,
+	},
+	{
+		Version:     21,
+		Description: "Add covering index for windowed client aggregation (timestamp, client_ip, blocked, response_code)",
+		SQL: `
+			-- Serves GetTopClients and GetClientSummaries with a since window:
+			-- WHERE timestamp >= ? GROUP BY client_ip with blocked/NXDOMAIN
+			-- counts reads only this index, no row lookups.
+			CREATE INDEX IF NOT EXISTS idx_queries_ts_client_agg
+				ON queries(timestamp, client_ip, blocked, response_code);
+		`,
+	},
+	{
+		Version:     22,
+		Description: "Add matched_rule and matched_source columns to queries",
+		SQL: `
+			-- The list or policy rule that decided a query, so per-list
+			-- reports don't have to parse block_trace. NULL for everything
+			-- else, which the partial indexes leave out.
+			ALTER TABLE queries ADD COLUMN matched_rule TEXT;
+			ALTER TABLE queries ADD COLUMN matched_source TEXT;
+			CREATE INDEX IF NOT EXISTS idx_queries_matched_source_ts
+				ON queries(matched_source, timestamp) WHERE matched_source IS NOT NULL;
+			CREATE INDEX IF NOT EXISTS idx_queries_matched_rule_ts
+				ON queries(matched_rule, timestamp) WHERE matched_rule IS NOT NULL;
+		`,
+	},
+	{
+		Version:     23,
+		Description: "Add category column to policy_rules",
+		SQL: `
+			-- BLOCK rules used to carry their category in action_data.
+			-- Move it to its own column so action_data only holds the
+			-- redirect target or upstream list.
+			ALTER TABLE policy_rules ADD COLUMN category TEXT NOT NULL DEFAULT '';
+			UPDATE policy_rules SET category = action_data, action_data = ''
+				WHERE action = 'BLOCK' AND action_data != '';
+		`,
+	},
+	{
+		Version:     24,
+		Description: "Drop unused windowed client aggregation index",
+		SQL: `
+			-- EXPLAIN QUERY PLAN for the windowed GetTopClients and
+			-- GetClientSummaries aggregation (WHERE timestamp >= ? GROUP BY
+			-- client_ip) picks idx_queries_client_timestamp, which already
+			-- yields rows grouped by client, with or without ANALYZE stats.
+			-- idx_queries_ts_client_agg from v21 was never chosen; drop it
+			-- to save one index write per query.
+			DROP INDEX IF EXISTS idx_queries_ts_client_agg;
+		`,
+	},
+	{
+		Version:     25,
+		Description: "Replace (blocked, timestamp, id) index with (blocked, timestamp)",
+		SQL: `
+			-- Every index entry already ends in the rowid (id), so the
+			-- trailing id of idx_queries_blocked_ts_id from v18 was
+			-- redundant. (blocked, timestamp) still serves GetRecentBlocked's
+			-- ORDER BY timestamp DESC, id DESC with no sort step;
+			-- idx_queries_blocked_ts_domain can't, as its domain column
+			-- breaks the id tie-break and needs a temp B-tree.
+			CREATE INDEX IF NOT EXISTS idx_queries_blocked_ts ON queries(blocked, timestamp);
+			DROP INDEX IF EXISTS idx_queries_blocked_ts_id;
+		`,
+	},
 }
 
 // getMigrations returns all migrations sorted by version
@@ -7,8 +7,10 @@ import (
 	"database/sql"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -22,6 +24,7 @@ import (
 // This interface breaks the import cycle between storage and telemetry packages
 type MetricsRecorder interface {
 	AddDroppedQuery(ctx context.Context, count int64)
+	RecordBufferUsed(ctx context.Context, used int64)
 }
 
 //go:embed migrations/001_initial.sql
@@ -32,7 +35,8 @@ const defaultQueryTimeout = 30 * time.Second
 
 // SQLiteStorage implements the Storage interface using SQLite
 type SQLiteStorage struct {
-	db                  *sql.DB
+	db                  *sql.DB // Writer: inserts, cleanup, reset and other writes
+	readDB              *sql.DB // Read-only pool for Get*/List* queries; db itself when no separate pool is opened
 	cfg                 *Config
 	metrics             MetricsRecorder
 	buffer              chan *QueryLog
@@ -42,8 +46,12 @@ type SQLiteStorage struct {
 	wg                  sync.WaitGroup
 	mu                  sync.RWMutex
 	closed              bool
-	bufferHighWatermark int         // 80% of buffer capacity
-	warningLogged       atomic.Bool // Track if high watermark warning has been logged (lock-free)
+	bufferHighWatermark int           // 80% of buffer capacity
+	warningLogged       atomic.Bool   // Track if high watermark warning has been logged (lock-free)
+	bufferPeak          atomic.Int64  // Most entries seen queued at once
+	dropped             atomic.Uint64 // Entries dropped because the buffer was full
+	dropWarner          *DropWarner   // Rate-limits the buffer full warning
+	stopCh              chan struct{} // Closed on Close to stop ticker-driven workers
 }
 
 // withQueryTimeout returns a context with a timeout if one isn't already set.
@@ -62,6 +70,11 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 		return nil, ErrInvalidConfig
 	}
 
+	// Swap in a snapshot staged by StageRestore before anything opens the file.
+	if err := applyStagedRestore(cfg.SQLite.Path); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnectionFailed, err)
+	}
+
 	// Open database connection
 	db, err := sql.Open("sqlite", cfg.SQLite.Path)
 	if err != nil {
@@ -69,10 +82,17 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 	}
 
 	// Configure connection pool.
-	// WAL mode allows concurrent readers with a single writer.
-	// Multiple read connections improve throughput for dashboard/API queries.
-	db.SetMaxOpenConns(4)
-	db.SetMaxIdleConns(4)
+	// WAL mode allows concurrent readers with a single writer, so a file
+	// database gets one writer connection plus a separate read pool (opened
+	// below). Without WAL, or in memory, one shared pool serves both.
+	splitPools := cfg.SQLite.WALMode && cfg.SQLite.Path != ":memory:"
+	if splitPools {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	} else {
+		db.SetMaxOpenConns(4)
+		db.SetMaxIdleConns(4)
+	}
 	db.SetConnMaxLifetime(0)
 
 	// Test connection (also creates the file if it doesn't exist)
@@ -106,6 +126,10 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 		pragmas = append(pragmas, "PRAGMA journal_mode = WAL")
 	}
 
+	if cfg.SQLite.WALAutoCheckpoint > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA wal_autocheckpoint = %d", cfg.SQLite.WALAutoCheckpoint))
+	}
+
 	for _, pragma := range pragmas {
 		if _, pragmaErr := db.Exec(pragma); pragmaErr != nil {
 			_ = db.Close()
@@ -113,25 +137,39 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 		}
 	}
 
+	if vacuumErr := ensureIncrementalVacuum(db, cfg.SQLite.ConvertAutoVacuum); vacuumErr != nil {
+		slog.Default().Warn("Failed to enable incremental auto-vacuum", "error", vacuumErr)
+	}
+
 	// Apply migrations
 	if migrationErr := applyMigrations(db); migrationErr != nil {
 		_ = db.Close()
 		return nil, fmt.Errorf("failed to apply migrations: %w", migrationErr)
 	}
 
+	readDB := db
+	if splitPools {
+		readDB, err = openReadPool(cfg)
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
 	// Prepare statements
 	stmtInsert, err := db.Prepare(`
 		INSERT INTO queries
-		(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace, upstream_error, dnssec_validated, unbound_cached, unbound_duration_ms, unbound_resp_size)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace, upstream_error, dnssec_validated, unbound_cached, unbound_duration_ms, unbound_resp_size, matched_rule, matched_source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
-		_ = db.Close()
+		closeDBs(db, readDB)
 		return nil, fmt.Errorf("failed to prepare insert statement: %w", err)
 	}
 
 	storage := &SQLiteStorage{
 		db:                  db,
+		readDB:              readDB,
 		cfg:                 cfg,
 		metrics:             metrics,
 		buffer:              make(chan *QueryLog, cfg.BufferSize),
@@ -139,6 +177,8 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 		unboundBuffer:       make(chan *UnboundQueryLog, 1000), // Buffered channel for dnstap events
 		stmtInsertQuery:     stmtInsert,
 		bufferHighWatermark: int(float64(cfg.BufferSize) * 0.8), // 80% threshold
+		dropWarner:          NewDropWarner(DropWarnInterval),
+		stopCh:              make(chan struct{}),
 	}
 
 	// Start background flush worker
@@ -153,9 +193,87 @@ func NewSQLiteStorage(cfg *Config, metrics MetricsRecorder) (Storage, error) {
 	storage.wg.Add(1)
 	go storage.unboundFlushWorker()
 
+	// Start periodic WAL checkpoint worker
+	if cfg.SQLite.WALMode && cfg.SQLite.CheckpointInterval > 0 {
+		storage.wg.Add(1)
+		go storage.checkpointWorker(cfg.SQLite.CheckpointInterval)
+	}
+
 	return storage, nil
 }
 
+// openReadPool opens the read-only connection pool used by dashboard and API
+// queries, so long analytics scans never hold the writer connection that
+// flushes the query log. Pragmas go in the DSN because they are
+// per-connection and the pool opens connections on demand.
+func openReadPool(cfg *Config) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.SQLite.BusyTimeout))
+	params.Add("_pragma", fmt.Sprintf("cache_size(%d)", -cfg.SQLite.CacheSize))
+	params.Add("_pragma", "temp_store(MEMORY)")
+	params.Add("_pragma", "query_only(1)")
+	if cfg.SQLite.MMapSize > 0 {
+		params.Add("_pragma", fmt.Sprintf("mmap_size(%d)", cfg.SQLite.MMapSize))
+	}
+	sep := "?"
+	if strings.Contains(cfg.SQLite.Path, "?") {
+		sep = "&"
+	}
+
+	readDB, err := sql.Open("sqlite", cfg.SQLite.Path+sep+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("%w: read pool: %v", ErrConnectionFailed, err)
+	}
+	size := cfg.SQLite.ReadPoolSize
+	if size <= 0 {
+		size = DefaultReadPoolSize
+	}
+	readDB.SetMaxOpenConns(size)
+	readDB.SetMaxIdleConns(size)
+	readDB.SetConnMaxLifetime(0)
+
+	if err := readDB.Ping(); err != nil {
+		_ = readDB.Close()
+		return nil, fmt.Errorf("%w: read pool: %v", ErrConnectionFailed, err)
+	}
+	return readDB, nil
+}
+
+// closeDBs closes the writer and, when it is a separate pool, the read pool.
+func closeDBs(db, readDB *sql.DB) {
+	if readDB != db {
+		_ = readDB.Close()
+	}
+	_ = db.Close()
+}
+
+// ensureIncrementalVacuum switches a database created without auto-vacuum to
+// incremental mode. Setting the pragma only affects new databases; an
+// existing one needs a one-off VACUUM to rewrite it with the pointer-map
+// pages incremental vacuum relies on. That VACUUM blocks startup for as long
+// as it takes to copy the database, so it only runs when convert is set
+// (database.sqlite.convert_auto_vacuum).
+func ensureIncrementalVacuum(db *sql.DB, convert bool) error {
+	var mode int
+	if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return err
+	}
+	if mode == 2 { // INCREMENTAL
+		return nil
+	}
+	if !convert {
+		slog.Default().Info("Database was created without incremental auto-vacuum; free pages are not released until it is converted",
+			"hint", "set database.sqlite.convert_auto_vacuum: true for one restart")
+		return nil
+	}
+	slog.Default().Info("Converting database to incremental auto-vacuum (one-off VACUUM)")
+	if _, err := db.Exec("PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return err
+	}
+	_, err := db.Exec("VACUUM")
+	return err
+}
+
 // applyMigrations applies database schema migrations using the versioned migration system.
 // This function delegates to runMigrations() which handles:
 // - Detecting current database version
@@ -206,21 +324,74 @@ func (s *SQLiteStorage) LogQuery(ctx context.Context, query *QueryLog) error {
 	// Non-blocking write to buffer
 	select {
 	case s.buffer <- query:
+		s.notePeak()
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		// Buffer full, drop query and record metric
-		if s.metrics != nil {
-			s.metrics.AddDroppedQuery(ctx, 1)
+	}
+
+	// Buffer full. In block mode wait briefly for the flush worker to make
+	// room before giving up on the entry.
+	if s.cfg.Backpressure == BackpressureBlock {
+		timeout := s.cfg.BackpressureTimeout
+		if timeout <= 0 {
+			timeout = DefaultBackpressureTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case s.buffer <- query:
+			s.notePeak()
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	s.recordDrop(ctx, query)
+	return ErrBufferFull
+}
+
+// notePeak raises the buffer peak to the current queue length.
+func (s *SQLiteStorage) notePeak() {
+	n := int64(len(s.buffer))
+	for {
+		peak := s.bufferPeak.Load()
+		if n <= peak || s.bufferPeak.CompareAndSwap(peak, n) {
+			return
 		}
-		slog.Default().Error("Query buffer full - dropping entry",
-			"domain", query.Domain,
-			"client_ip", query.ClientIP)
-		return ErrBufferFull
 	}
 }
 
+// recordDrop counts an entry dropped on a full buffer and logs a warning at
+// most once per DropWarnInterval with the drops since the previous one.
+func (s *SQLiteStorage) recordDrop(ctx context.Context, query *QueryLog) {
+	total := s.dropped.Add(1)
+	s.bufferPeak.Store(int64(cap(s.buffer)))
+	if s.metrics != nil {
+		s.metrics.AddDroppedQuery(ctx, 1)
+		s.metrics.RecordBufferUsed(ctx, int64(len(s.buffer)))
+	}
+	if n := s.dropWarner.Drop(time.Now()); n > 0 {
+		slog.Default().Warn("Query buffer full - dropping entries",
+			"dropped", n,
+			"dropped_total", total,
+			"capacity", cap(s.buffer),
+			"backpressure", s.backpressureMode(),
+			"last_domain", query.Domain)
+	}
+}
+
+// backpressureMode returns the configured backpressure mode, defaulting to drop.
+func (s *SQLiteStorage) backpressureMode() string {
+	if s.cfg.Backpressure == "" {
+		return BackpressureDrop
+	}
+	return s.cfg.Backpressure
+}
+
 // flushWorker runs as a background goroutine that processes buffered DNS queries.
 // It batches queries together for efficient database writes and flushes them either
 // when the batch reaches cfg.BatchSize or when cfg.FlushInterval elapses.
@@ -273,6 +444,10 @@ func (s *SQLiteStorage) flushWorker() {
 
 		// Clear batch
 		batch = batch[:0]
+
+		if s.metrics != nil {
+			s.metrics.RecordBufferUsed(context.Background(), int64(len(s.buffer)))
+		}
 	}
 
 	for {
@@ -349,6 +524,8 @@ func (s *SQLiteStorage) flushBatch(queries []*QueryLog) error {
 			query.UnboundCached,
 			query.UnboundDurationMs,
 			query.UnboundRespSize,
+			nullIfEmpty(query.MatchedRule),
+			nullIfEmpty(query.MatchedSource),
 		)
 		if err != nil {
 			return fmt.Errorf("%w: %v", ErrQueryFailed, err)
@@ -659,11 +836,12 @@ func (s *SQLiteStorage) GetRecentQueries(ctx context.Context, limit, offset int)
 		return nil, ErrClosed
 	}
 
-	rows, err := s.db.QueryContext(ctx, `
+	rows, err := s.readDB.QueryContext(ctx, `
 		SELECT id, timestamp, client_ip, domain, query_type, response_code,
 		       blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace,
 		       upstream_error, dnssec_validated,
-		       unbound_cached, unbound_duration_ms, unbound_resp_size
+		       unbound_cached, unbound_duration_ms, unbound_resp_size,
+		       matched_rule, matched_source
 		FROM queries
 		ORDER BY timestamp DESC
 		LIMIT ? OFFSET ?
@@ -676,6 +854,36 @@ func (s *SQLiteStorage) GetRecentQueries(ctx context.Context, limit, offset int)
 	return scanQueryLogs(rows)
 }
 
+// GetRecentBlocked returns the most recent blocked queries, newest first,
+// with pagination support. Backed by idx_queries_blocked_ts so the
+// dashboard's blocked feed never scans allowed queries.
+func (s *SQLiteStorage) GetRecentBlocked(ctx context.Context, limit, offset int) ([]*QueryLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	rows, err := s.readDB.QueryContext(ctx, `
+		SELECT id, timestamp, client_ip, domain, query_type, response_code,
+		       blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace,
+		       upstream_error, dnssec_validated,
+		       unbound_cached, unbound_duration_ms, unbound_resp_size,
+		       matched_rule, matched_source
+		FROM queries
+		WHERE blocked = 1
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanQueryLogs(rows)
+}
+
 // GetQueriesByDomain returns queries for a specific domain
 func (s *SQLiteStorage) GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*QueryLog, error) {
 	s.mu.RLock()
@@ -685,11 +893,12 @@ func (s *SQLiteStorage) GetQueriesByDomain(ctx context.Context, domain string, l
 		return nil, ErrClosed
 	}
 
-	rows, err := s.db.QueryContext(ctx, `
+	rows, err := s.readDB.QueryContext(ctx, `
 		SELECT id, timestamp, client_ip, domain, query_type, response_code,
 		       blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace,
 		       upstream_error, dnssec_validated,
-		       unbound_cached, unbound_duration_ms, unbound_resp_size
+		       unbound_cached, unbound_duration_ms, unbound_resp_size,
+		       matched_rule, matched_source
 		FROM queries
 		WHERE domain = ?
 		ORDER BY timestamp DESC
@@ -712,11 +921,12 @@ func (s *SQLiteStorage) GetQueriesByClientIP(ctx context.Context, clientIP strin
 		return nil, ErrClosed
 	}
 
-	rows, err := s.db.QueryContext(ctx, `
+	rows, err := s.readDB.QueryContext(ctx, `
 		SELECT id, timestamp, client_ip, domain, query_type, response_code,
 		       blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace,
 		       upstream_error, dnssec_validated,
-		       unbound_cached, unbound_duration_ms, unbound_resp_size
+		       unbound_cached, unbound_duration_ms, unbound_resp_size,
+		       matched_rule, matched_source
 		FROM queries
 		WHERE client_ip = ?
 		ORDER BY timestamp DESC
@@ -756,7 +966,7 @@ func (s *SQLiteStorage) GetStatistics(ctx context.Context, since time.Time) (*St
 	// Falls back to scanning queries table if hourly_stats is empty (first run).
 	sinceStr := FormatTimestamp(since)
 
-	err := s.db.QueryRowContext(ctx, `
+	err := s.readDB.QueryRowContext(ctx, `
 		SELECT
 			COALESCE(SUM(total_queries), 0),
 			COALESCE(SUM(blocked_queries), 0),
@@ -781,7 +991,7 @@ func (s *SQLiteStorage) GetStatistics(ctx context.Context, since time.Time) (*St
 	// This uses the expensive COUNT(DISTINCT) queries but only runs until hourly_stats
 	// is populated by the write path.
 	if err != nil || stats.TotalQueries == 0 {
-		err = s.db.QueryRowContext(ctx, `
+		err = s.readDB.QueryRowContext(ctx, `
 			SELECT
 				COUNT(*) as total,
 				SUM(CASE WHEN blocked THEN 1 ELSE 0 END) as blocked,
@@ -862,7 +1072,7 @@ func (s *SQLiteStorage) GetTopDomains(ctx context.Context, limit int, blocked bo
 		LIMIT ?`
 	args = append(args, limit)
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
 	}
@@ -888,6 +1098,101 @@ func (s *SQLiteStorage) GetTopDomains(ctx context.Context, limit int, blocked bo
 	return domains, nil
 }
 
+// GetUpstreamLatency returns per-upstream exchange-time percentiles for
+// queries forwarded since the given time, busiest upstream first. Cache hits
+// are excluded: they carry the upstream of the original answer but no
+// exchange time.
+func (s *SQLiteStorage) GetUpstreamLatency(ctx context.Context, since time.Time) ([]*UpstreamLatency, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, defaultQueryTimeout)
+	defer cancel()
+
+	// Rank each upstream's samples once; the nearest-rank percentile p is
+	// the sample at rank ceil(n*p/100).
+	rows, err := s.readDB.QueryContext(ctx, `
+		WITH ranked AS (
+			SELECT
+				upstream,
+				upstream_time_ms AS ms,
+				ROW_NUMBER() OVER (PARTITION BY upstream ORDER BY upstream_time_ms) AS rn,
+				COUNT(*) OVER (PARTITION BY upstream) AS n
+			FROM queries
+			WHERE timestamp >= ? AND cached = 0 AND upstream IS NOT NULL AND upstream != ''
+		)
+		SELECT
+			upstream,
+			MAX(n) AS total,
+			AVG(ms),
+			MAX(CASE WHEN rn = (n * 50 + 99) / 100 THEN ms END),
+			MAX(CASE WHEN rn = (n * 95 + 99) / 100 THEN ms END),
+			MAX(CASE WHEN rn = (n * 99 + 99) / 100 THEN ms END)
+		FROM ranked
+		GROUP BY upstream
+		ORDER BY total DESC, upstream`, FormatTimestamp(since.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []*UpstreamLatency
+	for rows.Next() {
+		var u UpstreamLatency
+		if err := rows.Scan(&u.Upstream, &u.Queries, &u.AvgMs, &u.P50Ms, &u.P95Ms, &u.P99Ms); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+		}
+		out = append(out, &u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	return out, nil
+}
+
+// CountDomains counts the distinct domains GetTopDomains ranks for the same
+// blocked flag and since (a zero since means the last 7 days). A positive
+// limit stops counting there; a result equal to limit means "at least limit".
+func (s *SQLiteStorage) CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	if since.IsZero() {
+		since = time.Now().AddDate(0, 0, -7)
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, defaultQueryTimeout)
+	defer cancel()
+
+	blockedValue := 0
+	if blocked {
+		blockedValue = 1
+	}
+
+	// Same covering index as GetTopDomains; DISTINCT skips the per-domain
+	// aggregates and sort.
+	query := `SELECT DISTINCT domain FROM queries WHERE blocked = ? AND timestamp >= ?`
+	args := []any{blockedValue, FormatTimestamp(since)}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	var count int64
+	if err := s.readDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+query+")", args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	return count, nil
+}
+
 // GetBlockedCount returns the number of blocked queries since a given time
 func (s *SQLiteStorage) GetBlockedCount(ctx context.Context, since time.Time) (int64, error) {
 	s.mu.RLock()
@@ -898,7 +1203,7 @@ func (s *SQLiteStorage) GetBlockedCount(ctx context.Context, since time.Time) (i
 	}
 
 	var count int64
-	err := s.db.QueryRowContext(ctx, `
+	err := s.readDB.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM queries WHERE blocked = 1 AND timestamp >= ?
 	`, FormatTimestamp(since)).Scan(&count)
 
@@ -919,7 +1224,7 @@ func (s *SQLiteStorage) GetQueryCount(ctx context.Context, since time.Time) (int
 	}
 
 	var count int64
-	err := s.db.QueryRowContext(ctx, `
+	err := s.readDB.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM queries WHERE timestamp >= ?
 	`, FormatTimestamp(since)).Scan(&count)
 
@@ -932,6 +1237,32 @@ func (s *SQLiteStorage) GetQueryCount(ctx context.Context, since time.Time) (int
 
 // GetTimeSeriesStats returns aggregated statistics grouped by the specified bucket duration.
 func (s *SQLiteStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
+	return s.timeSeries(ctx, bucket, points, "", "")
+}
+
+// GetDomainTimeSeries returns the same buckets as GetTimeSeriesStats, counting
+// only queries for domain (exact match, as stored in the query log).
+func (s *SQLiteStorage) GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("domain is required")
+	}
+	return s.timeSeries(ctx, bucket, points, "domain", domain)
+}
+
+// GetClientTimeSeries returns the same buckets as GetTimeSeriesStats, counting
+// only queries from clientIP.
+func (s *SQLiteStorage) GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error) {
+	if clientIP == "" {
+		return nil, fmt.Errorf("client IP is required")
+	}
+	return s.timeSeries(ctx, bucket, points, "client_ip", clientIP)
+}
+
+// timeSeries buckets queries newer than the first of points buckets. When
+// column is set, only rows whose column equals value are counted; column is
+// always a constant from the callers above, never user input. Buckets with
+// no queries are zero-filled.
+func (s *SQLiteStorage) timeSeries(ctx context.Context, bucket time.Duration, points int, column, value string) ([]*TimeSeriesPoint, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -955,7 +1286,15 @@ func (s *SQLiteStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Dura
 	alignedEnd := truncateToBucket(time.Now().UTC(), bucket)
 	start := alignedEnd.Add(-bucket * time.Duration(points-1))
 
-	rows, err := s.db.QueryContext(ctx, `
+	where := "timestamp >= ?"
+	args := []any{bucketSeconds, bucketSeconds}
+	if column != "" {
+		where = column + " = ? AND timestamp >= ?"
+		args = append(args, value)
+	}
+	args = append(args, FormatTimestamp(start))
+
+	rows, err := s.readDB.QueryContext(ctx, `
 		WITH bucketed AS (
 			SELECT
 				strftime('%Y-%m-%d %H:%M:%S', datetime((strftime('%s', timestamp) / ?) * ?, 'unixepoch')) AS bucket_start,
@@ -963,7 +1302,7 @@ func (s *SQLiteStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Dura
 				cached,
 				response_time_ms
 			FROM queries
-			WHERE timestamp >= ?
+			WHERE `+where+`
 		)
 		SELECT
 			bucket_start,
@@ -974,7 +1313,7 @@ func (s *SQLiteStorage) GetTimeSeriesStats(ctx context.Context, bucket time.Dura
 		FROM bucketed
 		GROUP BY bucket_start
 		ORDER BY bucket_start ASC
-	`, bucketSeconds, bucketSeconds, FormatTimestamp(start))
+	`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
 	}
@@ -1073,7 +1412,7 @@ func (s *SQLiteStorage) GetQueryTypeStats(ctx context.Context, limit int, since
 	`
 	args = append(args, limit)
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
 	}
@@ -1104,9 +1443,73 @@ func (s *SQLiteStorage) GetQueriesFiltered(ctx context.Context, filter QueryFilt
 		SELECT id, timestamp, client_ip, domain, query_type, response_code,
 		       blocked, cached, response_time_ms, upstream, upstream_time_ms, block_trace,
 		       upstream_error, dnssec_validated,
-		       unbound_cached, unbound_duration_ms, unbound_resp_size
+		       unbound_cached, unbound_duration_ms, unbound_resp_size,
+		       matched_rule, matched_source
 		FROM queries
 	`
+	conditions, args := queryFilterConditions(filter)
+
+	// Keyset pagination: the row-value comparison is a range scan on
+	// idx_queries_timestamp (whose entries carry the rowid), so deep pages
+	// cost the same as the first.
+	if c := filter.Before; c != nil {
+		conditions = append(conditions, "(timestamp, id) < (?, ?)")
+		args = append(args, FormatTimestamp(c.Timestamp), c.ID)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// id breaks timestamp ties so pages never overlap or skip rows.
+	query += `
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+	args = append(args, limit, offset)
+
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanQueryLogs(rows)
+}
+
+// CountQueriesFiltered counts the queries matching filter, ignoring
+// filter.Before so the total describes the whole result set rather than the
+// rows after a cursor. A positive limit stops counting there, bounding the
+// cost on large tables; a result equal to limit means "at least limit".
+func (s *SQLiteStorage) CountQueriesFiltered(ctx context.Context, filter QueryFilter, limit int) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	conditions, args := queryFilterConditions(filter)
+	query := "SELECT 1 FROM queries"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	var count int64
+	if err := s.readDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+query+")", args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	return count, nil
+}
+
+// queryFilterConditions builds the WHERE conditions shared by
+// GetQueriesFiltered and CountQueriesFiltered. The keyset cursor is left to
+// the caller.
+func queryFilterConditions(filter QueryFilter) ([]string, []any) {
 	conditions := make([]string, 0)
 	args := make([]any, 0)
 
@@ -1135,6 +1538,16 @@ func (s *SQLiteStorage) GetQueriesFiltered(ctx context.Context, filter QueryFilt
 		args = append(args, filter.ResponseCode)
 	}
 
+	if filter.MatchedSource != "" {
+		conditions = append(conditions, "matched_source = ?")
+		args = append(args, filter.MatchedSource)
+	}
+
+	if filter.MatchedRule != "" {
+		conditions = append(conditions, "matched_rule = ?")
+		args = append(args, filter.MatchedRule)
+	}
+
 	if filter.Blocked != nil {
 		conditions = append(conditions, "blocked = ?")
 		if *filter.Blocked {
@@ -1163,23 +1576,7 @@ func (s *SQLiteStorage) GetQueriesFiltered(ctx context.Context, filter QueryFilt
 		args = append(args, FormatTimestamp(filter.End))
 	}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
-	}
-
-	query += `
-		ORDER BY timestamp DESC
-		LIMIT ? OFFSET ?
-	`
-	args = append(args, limit, offset)
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
-	}
-	defer func() { _ = rows.Close() }()
-
-	return scanQueryLogs(rows)
+	return conditions, args
 }
 
 // Cleanup removes old queries based on retention policy
@@ -1335,6 +1732,8 @@ type BufferStats struct {
 	Capacity    int     `json:"capacity"`    // Maximum capacity
 	Utilization float64 `json:"utilization"` // Percentage (0-100)
 	HighWater   int     `json:"high_water"`  // High watermark threshold
+	Peak        int     `json:"peak"`        // Most entries queued at once since start
+	Dropped     uint64  `json:"dropped"`     // Entries dropped because the buffer was full
 }
 
 // GetBufferStats returns current buffer statistics
@@ -1354,6 +1753,8 @@ func (s *SQLiteStorage) GetBufferStats() BufferStats {
 		Capacity:    capacity,
 		Utilization: utilization,
 		HighWater:   s.bufferHighWatermark,
+		Peak:        int(s.bufferPeak.Load()),
+		Dropped:     s.dropped.Load(),
 	}
 }
 
@@ -1378,6 +1779,7 @@ func (s *SQLiteStorage) Close() error {
 		"buffer_utilization_pct", fmt.Sprintf("%.1f", stats.Utilization))
 
 	// Close buffer channels (flush workers will drain and exit)
+	close(s.stopCh)
 	close(s.buffer)
 	close(s.unboundBuffer)
 
@@ -1389,10 +1791,84 @@ func (s *SQLiteStorage) Close() error {
 		_ = s.stmtInsertQuery.Close()
 	}
 
-	// Close database
+	// Close the read pool, then the writer
+	if s.readDB != s.db {
+		_ = s.readDB.Close()
+	}
 	return s.db.Close()
 }
 
+// checkpointWorker periodically truncates the WAL and reclaims free pages.
+func (s *SQLiteStorage) checkpointWorker(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), defaultQueryTimeout)
+			if err := s.checkpoint(ctx); err != nil && !errors.Is(err, ErrClosed) {
+				slog.Default().Warn("WAL checkpoint failed", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// checkpoint releases free pages with an incremental vacuum, then copies the
+// WAL into the database and truncates the -wal file to zero bytes. A busy
+// checkpoint (blocked by a long reader) is retried on the next tick.
+func (s *SQLiteStorage) checkpoint(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	if _, err := s.db.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		return fmt.Errorf("%w: incremental vacuum: %v", ErrQueryFailed, err)
+	}
+
+	var busy, logPages, checkpointed int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logPages, &checkpointed); err != nil {
+		return fmt.Errorf("%w: wal checkpoint: %v", ErrQueryFailed, err)
+	}
+	if busy != 0 {
+		slog.Default().Debug("WAL checkpoint could not complete, readers active",
+			"wal_pages", logPages,
+			"checkpointed_pages", checkpointed)
+	}
+	return nil
+}
+
+// DiskUsage returns the size of the database file and its -wal file. An
+// in-memory database reports zero.
+func (s *SQLiteStorage) DiskUsage() (DiskUsage, error) {
+	path := s.cfg.SQLite.Path
+	if path == ":memory:" {
+		return DiskUsage{}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return DiskUsage{}, err
+	}
+	usage := DiskUsage{DatabaseBytes: info.Size()}
+
+	// The -wal file only exists in WAL mode and may be removed on close.
+	if wal, walErr := os.Stat(path + "-wal"); walErr == nil {
+		usage.WALBytes = wal.Size()
+	} else if !os.IsNotExist(walErr) {
+		return DiskUsage{}, walErr
+	}
+	return usage, nil
+}
+
 // Ping checks if the storage is reachable
 func (s *SQLiteStorage) Ping(ctx context.Context) error {
 	s.mu.RLock()
@@ -1454,6 +1930,7 @@ func scanQueryLogs(rows *sql.Rows) ([]*QueryLog, error) {
 		var unboundCached sql.NullBool
 		var unboundDurationMs sql.NullFloat64
 		var unboundRespSize sql.NullInt64
+		var matchedRule, matchedSource sql.NullString
 
 		err := rows.Scan(
 			&q.ID,
@@ -1473,10 +1950,14 @@ func scanQueryLogs(rows *sql.Rows) ([]*QueryLog, error) {
 			&unboundCached,
 			&unboundDurationMs,
 			&unboundRespSize,
+			&matchedRule,
+			&matchedSource,
 		)
 		if err != nil {
 			return nil, err
 		}
+		q.MatchedRule = matchedRule.String
+		q.MatchedSource = matchedSource.String
 
 		if upstream.Valid {
 			q.Upstream = upstream.String
@@ -1664,7 +2145,7 @@ func (s *SQLiteStorage) GetUnboundQueries(ctx context.Context, filter UnboundQue
 	query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.readDB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrQueryFailed, err)
 	}
@@ -1711,7 +2192,7 @@ func (s *SQLiteStorage) GetUnboundQueryStats(ctx context.Context, since time.Tim
 	sinceStr := FormatTimestamp(since)
 
 	// Aggregate CLIENT_RESPONSE entries
-	row := s.db.QueryRowContext(ctx, `
+	row := s.readDB.QueryRowContext(ctx, `
 		SELECT
 			COUNT(*),
 			COALESCE(SUM(CASE WHEN cached_in_unbound = 1 THEN 1 ELSE 0 END), 0),
@@ -1745,7 +2226,7 @@ func (s *SQLiteStorage) GetUnboundQueryStats(ctx context.Context, since time.Tim
 	}
 
 	// Response code breakdown
-	rows, err := s.db.QueryContext(ctx, `
+	rows, err := s.readDB.QueryContext(ctx, `
 		SELECT response_code, COUNT(*)
 		FROM unbound_queries
 		WHERE message_type = 'CLIENT_RESPONSE' AND timestamp >= ? AND response_code IS NOT NULL
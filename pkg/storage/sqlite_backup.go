@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// restoreSuffix names the staged snapshot that replaces the database file on
+// the next start.
+const restoreSuffix = ".restore"
+
+// Backup writes a consistent, compacted copy of the database to destPath
+// using VACUUM INTO. It runs on its own connection (the read pool is
+// query_only, which VACUUM INTO rejects), so query logging continues while the
+// snapshot is taken; destPath must not already exist.
+//
+// s.mu is only held to check for Close: a pending writer (Close, Reset) on
+// the RWMutex would otherwise stall every reader for as long as the copy
+// takes. SQLite's own locking keeps the snapshot consistent.
+func (s *SQLiteStorage) Backup(ctx context.Context, destPath string) error {
+	if s.cfg.SQLite.Path == ":memory:" {
+		return ErrBackupUnsupported
+	}
+
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	db, err := sql.Open("sqlite", s.cfg.SQLite.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnectionFailed, err)
+	}
+	defer func() { _ = db.Close() }()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", s.cfg.SQLite.BusyTimeout)); err != nil {
+		return fmt.Errorf("%w: %v", ErrQueryFailed, err)
+	}
+	if _, err := db.ExecContext(ctx, "VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("%w: vacuum into: %v", ErrQueryFailed, err)
+	}
+	if err := os.Chmod(destPath, 0600); err != nil {
+		slog.Default().Warn("Failed to set backup file permissions", "error", err)
+	}
+	return nil
+}
+
+// StageRestore checks that srcPath is an intact glory-hole database and moves
+// it next to the live database as <path>.restore. The live database is left
+// untouched; the snapshot replaces it the next time storage is opened, so a
+// restart is required for the restore to take effect.
+func (s *SQLiteStorage) StageRestore(ctx context.Context, srcPath string) error {
+	if s.cfg.SQLite.Path == ":memory:" {
+		return ErrBackupUnsupported
+	}
+	if err := verifySnapshot(ctx, srcPath); err != nil {
+		return err
+	}
+
+	staged := s.cfg.SQLite.Path + restoreSuffix
+	if err := os.Rename(srcPath, staged); err != nil {
+		return fmt.Errorf("stage restore: %w", err)
+	}
+	if err := os.Chmod(staged, 0600); err != nil {
+		slog.Default().Warn("Failed to set staged restore permissions", "error", err)
+	}
+	return nil
+}
+
+// RestoreStagingDir returns the directory uploads should be written to so
+// StageRestore can rename them into place without crossing filesystems.
+func (s *SQLiteStorage) RestoreStagingDir() string {
+	return filepath.Dir(s.cfg.SQLite.Path)
+}
+
+// verifySnapshot opens path read-only and runs an integrity check, rejecting
+// files that are not SQLite databases or lack the query log table.
+func verifySnapshot(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("%w: open snapshot: %v", ErrInvalidSnapshot, err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var result string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check(1)").Scan(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check: %s", ErrInvalidSnapshot, result)
+	}
+
+	var n int
+	if err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'queries'").Scan(&n); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: no queries table", ErrInvalidSnapshot)
+	}
+	return nil
+}
+
+// applyStagedRestore swaps a snapshot staged by StageRestore into place before
+// the database is opened. The old -wal and -shm files belong to the replaced
+// database and are removed so SQLite does not replay them onto the snapshot.
+func applyStagedRestore(path string) error {
+	if path == ":memory:" || strings.Contains(path, "?") {
+		return nil
+	}
+	staged := path + restoreSuffix
+	if _, err := os.Stat(staged); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", path+suffix, err)
+		}
+	}
+	if err := os.Rename(staged, path); err != nil {
+		return fmt.Errorf("apply staged restore: %w", err)
+	}
+	slog.Default().Warn("Restored database from staged snapshot", "path", path)
+	return nil
+}
+
+// CheckSQLite reports whether the database at cfg.SQLite.Path can be opened
+// and how its schema compares with this build, without changing anything. The
+// file is opened read-only, so a staged restore, pending migrations and the
+// auto-vacuum conversion are all left for the next real start. A missing
+// file passes when its directory is writable, since startup creates it.
+func CheckSQLite(ctx context.Context, cfg *Config) (string, error) {
+	path := cfg.SQLite.Path
+	if path == ":memory:" {
+		return "in memory", nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		dir := filepath.Dir(path)
+		probe, err := os.CreateTemp(dir, ".glory-hole-check-*")
+		if err != nil {
+			return "", fmt.Errorf("database does not exist and %s is not writable: %w", dir, err)
+		}
+		_ = probe.Close()
+		_ = os.Remove(probe.Name())
+		return "not created yet; directory writable", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite", "file:"+path+sep+"mode=ro")
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrConnectionFailed, err)
+	}
+	defer func() { _ = db.Close() }()
+	if err := db.PingContext(ctx); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrConnectionFailed, err)
+	}
+
+	version, err := getCurrentVersion(db)
+	if err != nil {
+		return "", err
+	}
+	all := getMigrations()
+	latest := all[len(all)-1].Version
+	var detail string
+	switch {
+	case version > latest:
+		return "", fmt.Errorf("schema version %d is newer than this build supports (%d)", version, latest)
+	case version < latest:
+		detail = fmt.Sprintf("schema version %d, %d to migrate at startup", version, latest-version)
+	default:
+		detail = fmt.Sprintf("schema version %d", version)
+	}
+	if _, err := os.Stat(path + restoreSuffix); err == nil {
+		detail += "; restore staged for next start"
+	}
+	return detail, nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStorage_BackupAndStagedRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "live.db")
+	s := newFileStorage(t, dbPath, SQLiteConfig{WALMode: true})
+
+	if err := s.LogQuery(ctx, &QueryLog{Timestamp: time.Now(), ClientIP: "192.0.2.1", Domain: "before.example", QueryType: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForQueries(t, s, 1)
+
+	backup := filepath.Join(dir, "snapshot.db")
+	if err := s.Backup(ctx, backup); err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	// Writes after the snapshot must not appear once it is restored.
+	if err := s.LogQuery(ctx, &QueryLog{Timestamp: time.Now(), ClientIP: "192.0.2.1", Domain: "after.example", QueryType: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForQueries(t, s, 2)
+
+	if err := s.StageRestore(ctx, backup); err != nil {
+		t.Fatalf("StageRestore() error = %v", err)
+	}
+	if _, err := os.Stat(dbPath + restoreSuffix); err != nil {
+		t.Fatalf("staged snapshot missing: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newFileStorage(t, dbPath, SQLiteConfig{WALMode: true})
+	if _, err := os.Stat(dbPath + restoreSuffix); !os.IsNotExist(err) {
+		t.Errorf("staged snapshot should be consumed on open, stat err = %v", err)
+	}
+	queries, err := reopened.GetRecentQueries(ctx, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0].Domain != "before.example" {
+		t.Errorf("restored queries = %+v, want only before.example", queries)
+	}
+}
+
+func TestSQLiteStorage_StageRestoreRejectsInvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStorage(t, filepath.Join(dir, "live.db"), SQLiteConfig{WALMode: true})
+
+	junk := filepath.Join(dir, "junk.db")
+	if err := os.WriteFile(junk, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StageRestore(context.Background(), junk); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("StageRestore(junk) error = %v, want ErrInvalidSnapshot", err)
+	}
+	if _, err := os.Stat(s.cfg.SQLite.Path + restoreSuffix); !os.IsNotExist(err) {
+		t.Error("invalid snapshot must not be staged")
+	}
+}
+
+func waitForQueries(t *testing.T, s *SQLiteStorage, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, err := s.GetQueryCount(context.Background(), time.Time{}); err == nil && n >= want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queries to flush", want)
+}
+
+func TestCheckSQLite_LeavesDatabaseUntouched(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "live.db")
+	cfg := &Config{SQLite: SQLiteConfig{Path: dbPath}}
+
+	detail, err := CheckSQLite(ctx, cfg)
+	if err != nil || !strings.Contains(detail, "not created") {
+		t.Fatalf("missing database: detail %q, err %v", detail, err)
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Fatal("the check must not create the database")
+	}
+
+	s := newFileStorage(t, dbPath, SQLiteConfig{WALMode: true})
+	_ = s.Close()
+	staged := dbPath + restoreSuffix
+	if err := os.WriteFile(staged, []byte("pending"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err = CheckSQLite(ctx, cfg)
+	if err != nil {
+		t.Fatalf("CheckSQLite: %v", err)
+	}
+	if !strings.Contains(detail, "schema version") || !strings.Contains(detail, "restore staged") {
+		t.Errorf("unexpected detail %q", detail)
+	}
+	if data, err := os.ReadFile(staged); err != nil || string(data) != "pending" {
+		t.Error("the check must not apply a staged restore")
+	}
+}
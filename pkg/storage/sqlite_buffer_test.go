@@ -316,3 +316,84 @@ func BenchmarkBufferLogging(b *testing.B) {
 		}
 	})
 }
+
+// TestBufferBackpressure checks that drop mode gives up at once on a full
+// buffer while block mode waits for the flush worker to make room, and that
+// the peak and drop counters reach the buffer stats.
+func TestBufferBackpressure(t *testing.T) {
+	newStorage := func(t *testing.T, mode string) *SQLiteStorage {
+		t.Helper()
+		cfg := &Config{
+			Backend: BackendSQLite,
+			SQLite: SQLiteConfig{
+				Path:        t.TempDir() + "/test.db",
+				BusyTimeout: 5000,
+				WALMode:     true,
+				CacheSize:   4096,
+			},
+			BufferSize:          2,
+			FlushInterval:       50 * time.Millisecond,
+			BatchSize:           100,
+			Enabled:             true,
+			Backpressure:        mode,
+			BackpressureTimeout: 2 * time.Second,
+		}
+		stor, err := NewSQLiteStorage(cfg, nil)
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		t.Cleanup(func() { _ = stor.Close() })
+		return stor.(*SQLiteStorage)
+	}
+	logN := func(s *SQLiteStorage, n int) (dropped int) {
+		for i := 0; i < n; i++ {
+			if err := s.LogQuery(context.Background(), &QueryLog{Domain: "example.com", ClientIP: "1.2.3.4"}); err == ErrBufferFull {
+				dropped++
+			}
+		}
+		return dropped
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		s := newStorage(t, BackpressureDrop)
+		dropped := logN(s, 50)
+		if dropped == 0 {
+			t.Fatal("expected drops with a 2-entry buffer")
+		}
+		stats := s.GetBufferStats()
+		if stats.Dropped != uint64(dropped) {
+			t.Errorf("Dropped = %d, want %d", stats.Dropped, dropped)
+		}
+		if stats.Peak != stats.Capacity {
+			t.Errorf("Peak = %d, want capacity %d after drops", stats.Peak, stats.Capacity)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		s := newStorage(t, BackpressureBlock)
+		if dropped := logN(s, 10); dropped != 0 {
+			t.Fatalf("block mode dropped %d entries", dropped)
+		}
+		stats := s.GetBufferStats()
+		if stats.Dropped != 0 || stats.Peak == 0 {
+			t.Errorf("stats = %+v, want no drops and a non-zero peak", stats)
+		}
+	})
+}
+
+func TestDropWarner(t *testing.T) {
+	w := NewDropWarner(10 * time.Second)
+	start := time.Unix(1000, 0)
+
+	if n := w.Drop(start); n != 1 {
+		t.Fatalf("first drop reported %d, want 1", n)
+	}
+	for i := 1; i <= 5; i++ {
+		if n := w.Drop(start.Add(time.Duration(i) * time.Second)); n != 0 {
+			t.Fatalf("drop inside the interval reported %d, want 0", n)
+		}
+	}
+	if n := w.Drop(start.Add(11 * time.Second)); n != 6 {
+		t.Fatalf("drop after the interval reported %d, want 6", n)
+	}
+}
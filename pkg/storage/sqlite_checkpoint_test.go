@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFileStorage(t testing.TB, path string, sqliteCfg SQLiteConfig) *SQLiteStorage {
+	t.Helper()
+	sqliteCfg.Path = path
+	sqliteCfg.BusyTimeout = 5000
+	sqliteCfg.CacheSize = 1000
+	cfg := &Config{
+		Enabled:       true,
+		Backend:       BackendSQLite,
+		SQLite:        sqliteCfg,
+		BufferSize:    100,
+		FlushInterval: 50 * time.Millisecond,
+		BatchSize:     10,
+		RetentionDays: 7,
+	}
+	stor, err := NewSQLiteStorage(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error = %v", err)
+	}
+	t.Cleanup(func() { _ = stor.Close() })
+	return stor.(*SQLiteStorage)
+}
+
+func pragmaInt(t *testing.T, db *sql.DB, pragma string) int {
+	t.Helper()
+	var v int
+	if err := db.QueryRow("PRAGMA " + pragma).Scan(&v); err != nil {
+		t.Fatalf("PRAGMA %s: %v", pragma, err)
+	}
+	return v
+}
+
+func TestSQLiteStorage_WALTuningPragmas(t *testing.T) {
+	s := newFileStorage(t, filepath.Join(t.TempDir(), "tuning.db"), SQLiteConfig{
+		WALMode:           true,
+		WALAutoCheckpoint: 250,
+	})
+
+	// A single connection keeps per-connection pragmas observable.
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var autoCheckpoint, autoVacuum int
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA wal_autocheckpoint").Scan(&autoCheckpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		t.Fatal(err)
+	}
+	if autoCheckpoint != 250 {
+		t.Errorf("wal_autocheckpoint = %d, want 250", autoCheckpoint)
+	}
+	if autoVacuum != 2 {
+		t.Errorf("auto_vacuum = %d, want 2 (incremental)", autoVacuum)
+	}
+}
+
+func TestSQLiteStorage_ConvertsExistingDatabaseToIncrementalVacuum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Exec("CREATE TABLE legacy (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if got := pragmaInt(t, legacy, "auto_vacuum"); got != 0 {
+		t.Fatalf("legacy auto_vacuum = %d, want 0", got)
+	}
+	_ = legacy.Close()
+
+	// Without opt-in startup leaves the file alone.
+	s := newFileStorage(t, path, SQLiteConfig{WALMode: true})
+	if got := pragmaInt(t, s.db, "auto_vacuum"); got != 0 {
+		t.Errorf("auto_vacuum = %d, want 0 (unconverted without convert_auto_vacuum)", got)
+	}
+	_ = s.Close()
+
+	s = newFileStorage(t, path, SQLiteConfig{WALMode: true, ConvertAutoVacuum: true})
+	if got := pragmaInt(t, s.db, "auto_vacuum"); got != 2 {
+		t.Errorf("auto_vacuum = %d, want 2 (incremental)", got)
+	}
+}
+
+func TestSQLiteStorage_CheckpointTruncatesWAL(t *testing.T) {
+	s := newFileStorage(t, filepath.Join(t.TempDir(), "wal.db"), SQLiteConfig{WALMode: true})
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		if err := s.LogQuery(ctx, &QueryLog{ClientIP: "192.0.2.1", Domain: "example.com", QueryType: "A"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		usage, err := s.DiskUsage()
+		if err != nil {
+			t.Fatalf("DiskUsage() error = %v", err)
+		}
+		if usage.WALBytes > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("WAL file never grew after logging queries")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err := s.checkpoint(ctx); err != nil {
+		t.Fatalf("checkpoint() error = %v", err)
+	}
+	usage, err := s.DiskUsage()
+	if err != nil {
+		t.Fatalf("DiskUsage() error = %v", err)
+	}
+	if usage.WALBytes != 0 {
+		t.Errorf("WAL size after checkpoint = %d, want 0", usage.WALBytes)
+	}
+	if usage.DatabaseBytes == 0 {
+		t.Error("expected a non-zero database size")
+	}
+}
+
+func TestSQLiteStorage_CheckpointWorkerStopsOnClose(t *testing.T) {
+	s := newFileStorage(t, filepath.Join(t.TempDir(), "worker.db"), SQLiteConfig{
+		WALMode:            true,
+		CheckpointInterval: 10 * time.Millisecond,
+	})
+	time.Sleep(50 * time.Millisecond) // let a few checkpoints run
+
+	done := make(chan error, 1)
+	go func() { done <- s.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not return; checkpoint worker still running")
+	}
+}
+
+func TestSQLiteStorage_DiskUsageInMemory(t *testing.T) {
+	stor, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	usage, err := stor.(DiskUsageReporter).DiskUsage()
+	if err != nil {
+		t.Fatalf("DiskUsage() error = %v", err)
+	}
+	if usage != (DiskUsage{}) {
+		t.Errorf("in-memory DiskUsage() = %+v, want zero", usage)
+	}
+}
@@ -10,8 +10,45 @@ import (
 
 const defaultClientPageSize = 50
 
+// clientWindowedStats aggregates per-client counts from the queries table for
+// timestamp >= ?, standing in for client_stats (alias cs) over a window.
+const clientWindowedStats = `
+		WITH cs AS (
+			SELECT
+				client_ip,
+				COUNT(*) AS total_queries,
+				SUM(CASE WHEN blocked = 1 THEN 1 ELSE 0 END) AS blocked_queries,
+				SUM(CASE WHEN response_code = 3 THEN 1 ELSE 0 END) AS nxdomain_queries,
+				MIN(timestamp) AS first_seen,
+				MAX(timestamp) AS last_seen
+			FROM queries
+			WHERE timestamp >= ?
+			GROUP BY client_ip
+		)
+	`
+
+// clientSummaryColumns selects the columns scanClientSummaries reads from cs
+// joined with client_profiles (p) and client_groups (g).
+const clientSummaryColumns = `
+		SELECT
+			cs.client_ip,
+			COALESCE(p.display_name, p.hostname, cs.client_ip) AS display_name,
+			COALESCE(p.hostname, '') AS hostname,
+			COALESCE(p.notes, '') AS notes,
+			p.group_name,
+			COALESCE(g.color, '') AS group_color,
+			cs.first_seen,
+			cs.last_seen,
+			cs.total_queries,
+			cs.blocked_queries,
+			cs.nxdomain_queries
+	`
+
 // GetClientSummaries aggregates per-client statistics with optional pagination.
-func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset int) ([]*ClientSummary, error) {
+// A zero since returns lifetime totals from the client_stats summary table;
+// otherwise counts cover only queries logged at or after since (bounded by
+// query-log retention).
+func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*ClientSummary, error) {
 	if s == nil || s.db == nil {
 		return nil, ErrClosed
 	}
@@ -27,42 +64,31 @@ func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset in
 		offset = 0
 	}
 
-	// Read from the pre-aggregated client_stats summary table.
-	// Updated incrementally on every batch insert — O(clients) not O(queries).
-	const baseQuery = `
-		SELECT
-			cs.client_ip,
-			COALESCE(p.display_name, cs.client_ip) AS display_name,
-			COALESCE(p.notes, '') AS notes,
-			p.group_name,
-			COALESCE(g.color, '') AS group_color,
-			cs.first_seen,
-			cs.last_seen,
-			cs.total_queries,
-			cs.blocked_queries,
-			cs.nxdomain_queries
-		FROM client_stats cs
+	// Lifetime totals come from the pre-aggregated client_stats summary table,
+	// updated incrementally on every batch insert — O(clients) not O(queries).
+	// A time window has to aggregate the queries table instead, walking
+	// idx_queries_client_timestamp so rows arrive grouped by client.
+	var builder strings.Builder
+	args := make([]any, 0, 7)
+	if since.IsZero() {
+		builder.WriteString(clientSummaryColumns)
+		builder.WriteString(`
+		FROM client_stats cs`)
+	} else {
+		builder.WriteString(clientWindowedStats)
+		builder.WriteString(clientSummaryColumns)
+		builder.WriteString(`
+		FROM cs`)
+		args = append(args, FormatTimestamp(since))
+	}
+	builder.WriteString(`
 		LEFT JOIN client_profiles p ON p.client_ip = cs.client_ip
 		LEFT JOIN client_groups g ON p.group_name = g.name
-	`
-
-	var builder strings.Builder
-	builder.WriteString(baseQuery)
+	`)
 
-	searchTerm := ClientSearchFromContext(ctx)
-	args := make([]any, 0, 6)
-	if searchTerm != "" {
-		pattern := "%" + searchTerm + "%"
-		builder.WriteString(`
-		WHERE
-			LOWER(cs.client_ip) LIKE ?
-			OR LOWER(COALESCE(p.display_name, '')) LIKE ?
-			OR LOWER(COALESCE(p.notes, '')) LIKE ?
-			OR LOWER(COALESCE(p.group_name, '')) LIKE ?
-		`)
-		for i := 0; i < 4; i++ {
-			args = append(args, pattern)
-		}
+	if where, searchArgs := clientSearchClause(ClientSearchFromContext(ctx)); where != "" {
+		builder.WriteString(where)
+		args = append(args, searchArgs...)
 	}
 
 	builder.WriteString(`
@@ -71,12 +97,63 @@ func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset in
 	`)
 	args = append(args, limit, offset)
 
-	rows, err := s.db.QueryContext(ctx, builder.String(), args...)
+	rows, err := s.readDB.QueryContext(ctx, builder.String(), args...)
 	if err != nil {
 		return nil, fmt.Errorf("query clients failed: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
+	return scanClientSummaries(rows)
+}
+
+// GetTopClients returns the limit clients with the most queries, busiest
+// first. A zero since ranks lifetime totals from client_stats; otherwise only
+// queries logged at or after since count, aggregated the same way as
+// GetClientSummaries.
+func (s *SQLiteStorage) GetTopClients(ctx context.Context, limit int, since time.Time) ([]*ClientSummary, error) {
+	if s == nil || s.db == nil {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if limit <= 0 {
+		limit = defaultClientPageSize
+	}
+
+	var builder strings.Builder
+	args := make([]any, 0, 2)
+	if since.IsZero() {
+		builder.WriteString(clientSummaryColumns)
+		builder.WriteString(`
+		FROM client_stats cs`)
+	} else {
+		builder.WriteString(clientWindowedStats)
+		builder.WriteString(clientSummaryColumns)
+		builder.WriteString(`
+		FROM cs`)
+		args = append(args, FormatTimestamp(since))
+	}
+	builder.WriteString(`
+		LEFT JOIN client_profiles p ON p.client_ip = cs.client_ip
+		LEFT JOIN client_groups g ON p.group_name = g.name
+		ORDER BY cs.total_queries DESC, cs.client_ip
+		LIMIT ?;
+	`)
+	args = append(args, limit)
+
+	rows, err := s.readDB.QueryContext(ctx, builder.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query top clients failed: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	return scanClientSummaries(rows)
+}
+
+// scanClientSummaries reads rows selected with clientSummaryColumns.
+func scanClientSummaries(rows *sql.Rows) ([]*ClientSummary, error) {
 	var clients []*ClientSummary
 	for rows.Next() {
 		var summary ClientSummary
@@ -88,6 +165,7 @@ func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset in
 		if err := rows.Scan(
 			&summary.ClientIP,
 			&summary.DisplayName,
+			&summary.Hostname,
 			&notes,
 			&groupName,
 			&groupColor,
@@ -122,6 +200,64 @@ func (s *SQLiteStorage) GetClientSummaries(ctx context.Context, limit, offset in
 	return clients, nil
 }
 
+// CountClientSummaries counts the clients GetClientSummaries would page
+// through for the same since and context search term.
+func (s *SQLiteStorage) CountClientSummaries(ctx context.Context, since time.Time) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, ErrClosed
+	}
+
+	ctx, cancel := withQueryTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var builder strings.Builder
+	args := make([]any, 0, 6)
+	if since.IsZero() {
+		builder.WriteString(`
+		SELECT COUNT(*) FROM client_stats cs`)
+	} else {
+		builder.WriteString(`
+		SELECT COUNT(*) FROM (
+			SELECT DISTINCT client_ip FROM queries WHERE timestamp >= ?
+		) cs`)
+		args = append(args, FormatTimestamp(since))
+	}
+	builder.WriteString(`
+		LEFT JOIN client_profiles p ON p.client_ip = cs.client_ip
+	`)
+	if where, searchArgs := clientSearchClause(ClientSearchFromContext(ctx)); where != "" {
+		builder.WriteString(where)
+		args = append(args, searchArgs...)
+	}
+
+	var count int64
+	if err := s.readDB.QueryRowContext(ctx, builder.String(), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count clients failed: %w", err)
+	}
+	return count, nil
+}
+
+// clientSearchClause matches a lowercased search term against the client IP
+// and its profile (alias cs and p). It returns "" when there is no term.
+func clientSearchClause(term string) (string, []any) {
+	if term == "" {
+		return "", nil
+	}
+	pattern := "%" + term + "%"
+	args := make([]any, 5)
+	for i := range args {
+		args[i] = pattern
+	}
+	return `
+		WHERE
+			LOWER(cs.client_ip) LIKE ?
+			OR LOWER(COALESCE(p.display_name, '')) LIKE ?
+			OR LOWER(COALESCE(p.hostname, '')) LIKE ?
+			OR LOWER(COALESCE(p.notes, '')) LIKE ?
+			OR LOWER(COALESCE(p.group_name, '')) LIKE ?
+		`, args
+}
+
 // UpdateClientProfile upserts operator-provided metadata for a client.
 func (s *SQLiteStorage) UpdateClientProfile(ctx context.Context, profile *ClientProfile) error {
 	if s == nil || s.db == nil {
@@ -158,6 +294,90 @@ func (s *SQLiteStorage) UpdateClientProfile(ctx context.Context, profile *Client
 	return nil
 }
 
+// SetClientGroup moves a client into groupName, or out of any group when
+// groupName is empty, creating the profile row if needed. Display name,
+// notes and hostname are left untouched.
+func (s *SQLiteStorage) SetClientGroup(ctx context.Context, clientIP, groupName string) error {
+	if s == nil || s.db == nil {
+		return ErrClosed
+	}
+
+	const statement = `
+		INSERT INTO client_profiles (client_ip, group_name, created_at, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(client_ip) DO UPDATE SET
+			group_name = excluded.group_name,
+			updated_at = CURRENT_TIMESTAMP;
+	`
+
+	if _, err := s.db.ExecContext(ctx, statement, clientIP, nullify(groupName)); err != nil {
+		return fmt.Errorf("set client group failed: %w", err)
+	}
+	return nil
+}
+
+// SetClientHostname records a discovered hostname for a client, creating the
+// profile row if needed. Operator-set fields (display_name, notes, group) are
+// left untouched; summaries fall back to the hostname when display_name is unset.
+func (s *SQLiteStorage) SetClientHostname(ctx context.Context, clientIP, hostname string) error {
+	if s == nil || s.db == nil {
+		return ErrClosed
+	}
+
+	const statement = `
+		INSERT INTO client_profiles (client_ip, hostname, created_at, updated_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT(client_ip) DO UPDATE SET
+			hostname = excluded.hostname,
+			updated_at = CURRENT_TIMESTAMP;
+	`
+
+	if _, err := s.db.ExecContext(ctx, statement, clientIP, nullify(hostname)); err != nil {
+		return fmt.Errorf("set client hostname failed: %w", err)
+	}
+	return nil
+}
+
+// ListClientsWithoutHostname returns up to limit client IPs seen in the query
+// log that have neither a discovered hostname nor an operator-set name, most
+// recently active first.
+func (s *SQLiteStorage) ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error) {
+	if s == nil || s.db == nil {
+		return nil, ErrClosed
+	}
+	if limit <= 0 {
+		limit = defaultClientPageSize
+	}
+
+	const statement = `
+		SELECT cs.client_ip
+		FROM client_stats cs
+		LEFT JOIN client_profiles p ON p.client_ip = cs.client_ip
+		WHERE p.hostname IS NULL AND p.display_name IS NULL
+		ORDER BY cs.last_seen DESC
+		LIMIT ?;
+	`
+
+	rows, err := s.readDB.QueryContext(ctx, statement, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query clients without hostname failed: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("scan client ip failed: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate clients without hostname failed: %w", err)
+	}
+	return ips, nil
+}
+
 // ListClientProfiles returns every row in client_profiles, including those
 // with NULL group_name. Used by the policy ClientGroupResolver to build its
 // in-memory IP → groups cache. Returns rows ordered by client_ip ASC for
@@ -173,7 +393,7 @@ func (s *SQLiteStorage) ListClientProfiles(ctx context.Context) ([]*ClientProfil
 		ORDER BY client_ip ASC;
 	`
 
-	rows, err := s.db.QueryContext(ctx, statement)
+	rows, err := s.readDB.QueryContext(ctx, statement)
 	if err != nil {
 		return nil, fmt.Errorf("query client profiles failed: %w", err)
 	}
@@ -207,7 +427,7 @@ func (s *SQLiteStorage) GetClientGroups(ctx context.Context) ([]*ClientGroup, er
 		ORDER BY name ASC;
 	`
 
-	rows, err := s.db.QueryContext(ctx, statement)
+	rows, err := s.readDB.QueryContext(ctx, statement)
 	if err != nil {
 		return nil, fmt.Errorf("query client groups failed: %w", err)
 	}
@@ -292,3 +512,12 @@ func nullify(value string) any {
 	}
 	return v
 }
+
+// nullIfEmpty is nullify without the trimming, for values that are matched
+// exactly later, such as the matched_rule and matched_source filters.
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -7,7 +7,8 @@ import (
 	"time"
 )
 
-// GetPolicyRules returns all policy rules ordered by sort_order.
+// GetPolicyRules returns all policy rules in evaluation order: highest
+// priority first, then by sort_order.
 func (s *SQLiteStorage) GetPolicyRules(ctx context.Context) ([]*PolicyRule, error) {
 	if s == nil || s.db == nil {
 		return nil, ErrClosed
@@ -16,10 +17,10 @@ func (s *SQLiteStorage) GetPolicyRules(ctx context.Context) ([]*PolicyRule, erro
 	ctx, cancel := withQueryTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, name, logic, action, action_data, enabled, sort_order
+	rows, err := s.readDB.QueryContext(ctx, `
+		SELECT id, name, logic, action, action_data, category, enabled, sort_order, priority
 		FROM policy_rules
-		ORDER BY sort_order ASC, id ASC
+		ORDER BY priority DESC, sort_order ASC, id ASC
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("query policy_rules: %w", err)
@@ -29,7 +30,7 @@ func (s *SQLiteStorage) GetPolicyRules(ctx context.Context) ([]*PolicyRule, erro
 	var rules []*PolicyRule
 	for rows.Next() {
 		r := &PolicyRule{}
-		if err := rows.Scan(&r.ID, &r.Name, &r.Logic, &r.Action, &r.ActionData, &r.Enabled, &r.SortOrder); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.Logic, &r.Action, &r.ActionData, &r.Category, &r.Enabled, &r.SortOrder, &r.Priority); err != nil {
 			return nil, fmt.Errorf("scan policy_rules row: %w", err)
 		}
 		rules = append(rules, r)
@@ -47,9 +48,9 @@ func (s *SQLiteStorage) CreatePolicyRule(ctx context.Context, rule *PolicyRule)
 	defer cancel()
 
 	result, err := s.db.ExecContext(ctx, `
-		INSERT INTO policy_rules (name, logic, action, action_data, enabled, sort_order, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, rule.Name, rule.Logic, rule.Action, rule.ActionData, rule.Enabled, rule.SortOrder)
+		INSERT INTO policy_rules (name, logic, action, action_data, category, enabled, sort_order, priority, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, rule.Name, rule.Logic, rule.Action, rule.ActionData, rule.Category, rule.Enabled, rule.SortOrder, rule.Priority)
 	if err != nil {
 		return 0, fmt.Errorf("insert policy_rules: %w", err)
 	}
@@ -67,9 +68,9 @@ func (s *SQLiteStorage) UpdatePolicyRule(ctx context.Context, id int64, rule *Po
 
 	result, err := s.db.ExecContext(ctx, `
 		UPDATE policy_rules
-		SET name = ?, logic = ?, action = ?, action_data = ?, enabled = ?, sort_order = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, logic = ?, action = ?, action_data = ?, category = ?, enabled = ?, sort_order = ?, priority = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
-	`, rule.Name, rule.Logic, rule.Action, rule.ActionData, rule.Enabled, rule.SortOrder, id)
+	`, rule.Name, rule.Logic, rule.Action, rule.ActionData, rule.Category, rule.Enabled, rule.SortOrder, rule.Priority, id)
 	if err != nil {
 		return fmt.Errorf("update policy_rules: %w", err)
 	}
@@ -113,7 +114,7 @@ func (s *SQLiteStorage) GetDynamicConfig(ctx context.Context, key string) (strin
 	defer cancel()
 
 	var value string
-	err := s.db.QueryRowContext(ctx, `SELECT value FROM dynamic_config WHERE key = ?`, key).Scan(&value)
+	err := s.readDB.QueryRowContext(ctx, `SELECT value FROM dynamic_config WHERE key = ?`, key).Scan(&value)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStorage_ReadPoolIsSeparateAndReadOnly(t *testing.T) {
+	s := newFileStorage(t, filepath.Join(t.TempDir(), "pool.db"), SQLiteConfig{WALMode: true, ReadPoolSize: 2})
+
+	if s.readDB == s.db {
+		t.Fatal("expected a separate read pool in WAL mode")
+	}
+	if got := s.db.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("writer MaxOpenConnections = %d, want 1", got)
+	}
+	if got := s.readDB.Stats().MaxOpenConnections; got != 2 {
+		t.Errorf("read pool MaxOpenConnections = %d, want 2", got)
+	}
+	if _, err := s.readDB.Exec(`DELETE FROM queries`); err == nil {
+		t.Error("expected the read pool to reject writes")
+	}
+}
+
+func TestSQLiteStorage_SharedPoolWithoutWAL(t *testing.T) {
+	stor, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	s := stor.(*SQLiteStorage)
+	if s.readDB != s.db {
+		t.Error("expected in-memory storage to share one pool")
+	}
+}
+
+func TestSQLiteStorage_WritesProceedWithReadPoolExhausted(t *testing.T) {
+	s := newFileStorage(t, filepath.Join(t.TempDir(), "busy.db"), SQLiteConfig{WALMode: true, ReadPoolSize: 2})
+	ctx := context.Background()
+
+	if err := s.flushBatch([]*QueryLog{{Timestamp: time.Now(), ClientIP: "192.0.2.1", Domain: "before.example", QueryType: "A"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold every read connection inside an open read transaction.
+	var held []*sql.Rows
+	for i := 0; i < 2; i++ {
+		rows, err := s.readDB.QueryContext(ctx, `SELECT domain FROM queries`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, rows)
+	}
+	defer func() {
+		for _, rows := range held {
+			_ = rows.Close()
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.flushBatch([]*QueryLog{{Timestamp: time.Now(), ClientIP: "192.0.2.1", Domain: "during.example", QueryType: "A"}})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("flushBatch() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("write blocked while the read pool was busy")
+	}
+
+	for _, rows := range held {
+		_ = rows.Close()
+	}
+	held = nil
+	got, err := s.GetQueriesByDomain(ctx, "during.example", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("expected the committed write to be visible to readers, got %d rows", len(got))
+	}
+}
+
+// BenchmarkSQLiteStorage_FlushUnderReadLoad measures query-log batch insert
+// latency while dashboard-style analytics queries run concurrently, with one
+// shared pool versus a dedicated writer plus read pool:
+//
+//	go test ./pkg/storage -run '^$' -bench FlushUnderReadLoad
+func BenchmarkSQLiteStorage_FlushUnderReadLoad(b *testing.B) {
+	for _, split := range []bool{false, true} {
+		name := "pools=shared"
+		if split {
+			name = "pools=split"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := newFileStorage(b, filepath.Join(b.TempDir(), "bench.db"), SQLiteConfig{WALMode: true})
+			if !split {
+				// The layout before the read pool: one pool of four
+				// connections serving reads and writes alike.
+				_ = s.readDB.Close()
+				s.readDB = s.db
+				s.db.SetMaxOpenConns(4)
+				s.db.SetMaxIdleConns(4)
+			}
+
+			batch := make([]*QueryLog, 100)
+			for i := range batch {
+				batch[i] = &QueryLog{
+					Timestamp: time.Now(),
+					ClientIP:  fmt.Sprintf("192.0.2.%d", i%250),
+					Domain:    fmt.Sprintf("host%d.example", i%50),
+					QueryType: "A",
+				}
+			}
+			for i := 0; i < 50; i++ {
+				if err := s.flushBatch(batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						_, _ = s.GetTopDomains(ctx, 10, false, time.Time{})
+						_, _ = s.GetTimeSeriesStats(ctx, time.Minute, 60)
+					}
+				}()
+			}
+
+			// The shared pool applies busy_timeout to one connection only,
+			// so contended writes can fail with SQLITE_BUSY; count them.
+			failed := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.flushBatch(batch); err != nil {
+					failed++
+				}
+			}
+			b.StopTimer()
+			cancel()
+			wg.Wait()
+			b.ReportMetric(float64(failed)/float64(b.N), "failed/op")
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -372,6 +373,104 @@ func TestSQLiteStorage_GetTimeSeriesStats(t *testing.T) {
 	}
 }
 
+func TestSQLiteStorage_GetDomainTimeSeries(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	aligned := time.Now().UTC().Truncate(time.Hour)
+	rows := []struct {
+		timestamp time.Time
+		domain    string
+		blocked   bool
+	}{
+		{aligned.Add(-1 * time.Hour), "ads.example.com", true},
+		{aligned.Add(-1 * time.Hour), "ads.example.com", true},
+		{aligned.Add(-1 * time.Hour), "other.example.com", false},
+		{aligned, "ads.example.com", false},
+		{aligned, "other.example.com", false},
+		{aligned, "other.example.com", false},
+	}
+	for _, row := range rows {
+		_, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+			(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(row.timestamp), "10.0.0.1", row.domain, "A", 0, row.blocked, false, 10)
+		if err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	result, err := storage.GetDomainTimeSeries(ctx, "ads.example.com", time.Hour, 3)
+	if err != nil {
+		t.Fatalf("GetDomainTimeSeries() error = %v", err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("expected 3 buckets, got %d", len(result))
+	}
+	if result[0].TotalQueries != 0 {
+		t.Errorf("expected zero-filled earliest bucket, got %d", result[0].TotalQueries)
+	}
+	if result[1].TotalQueries != 2 || result[1].BlockedQueries != 2 {
+		t.Errorf("previous bucket = %d total / %d blocked, want 2/2", result[1].TotalQueries, result[1].BlockedQueries)
+	}
+	if result[2].TotalQueries != 1 {
+		t.Errorf("expected 1 query in most recent bucket, got %d", result[2].TotalQueries)
+	}
+
+	if _, err := storage.GetDomainTimeSeries(ctx, "", time.Hour, 3); err == nil {
+		t.Error("expected error for empty domain")
+	}
+}
+
+func TestSQLiteStorage_GetClientTimeSeries(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	aligned := time.Now().UTC().Truncate(time.Hour)
+	rows := []struct {
+		timestamp time.Time
+		clientIP  string
+		blocked   bool
+	}{
+		{aligned.Add(-1 * time.Hour), "10.0.0.5", false},
+		{aligned, "10.0.0.5", true},
+		{aligned, "10.0.0.5", true},
+		{aligned, "10.0.0.5", false},
+		{aligned, "10.0.0.6", true},
+	}
+	for _, row := range rows {
+		_, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+			(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(row.timestamp), row.clientIP, "example.com", "A", 0, row.blocked, false, 10)
+		if err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	result, err := storage.GetClientTimeSeries(ctx, "10.0.0.5", time.Hour, 2)
+	if err != nil {
+		t.Fatalf("GetClientTimeSeries() error = %v", err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("expected 2 buckets, got %d", len(result))
+	}
+	if result[0].TotalQueries != 1 || result[0].BlockedQueries != 0 {
+		t.Errorf("previous bucket = %d total / %d blocked, want 1/0", result[0].TotalQueries, result[0].BlockedQueries)
+	}
+	if result[1].TotalQueries != 3 || result[1].BlockedQueries != 2 {
+		t.Errorf("current bucket = %d total / %d blocked, want 3/2", result[1].TotalQueries, result[1].BlockedQueries)
+	}
+}
+
 func TestSQLiteStorage_GetQueryTypeStats(t *testing.T) {
 	storage, cleanup := setupTestStorage(t)
 	defer cleanup()
@@ -570,10 +669,355 @@ func TestSQLiteStorage_GetQueriesFiltered(t *testing.T) {
 			if len(results) != tt.expected {
 				t.Fatalf("expected %d results, got %d", tt.expected, len(results))
 			}
+
+			count, err := storage.CountQueriesFiltered(ctx, tt.filter, 0)
+			if err != nil {
+				t.Fatalf("CountQueriesFiltered() error = %v", err)
+			}
+			if count != int64(tt.expected) {
+				t.Errorf("CountQueriesFiltered() = %d, want %d", count, tt.expected)
+			}
+		})
+	}
+
+	// A cap stops the count early; a cursor doesn't narrow it.
+	if count, err := storage.CountQueriesFiltered(ctx, QueryFilter{}, 2); err != nil || count != 2 {
+		t.Errorf("capped count = %d, %v; want 2", count, err)
+	}
+	cursor := &QueryCursor{Timestamp: now.Add(-time.Hour), ID: 1}
+	if count, err := storage.CountQueriesFiltered(ctx, QueryFilter{Before: cursor}, 0); err != nil || count != int64(len(entries)) {
+		t.Errorf("count with cursor = %d, %v; want %d", count, err, len(entries))
+	}
+}
+
+func TestSQLiteStorage_GetQueriesFiltered_Matched(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	now := time.Now().UTC()
+	if err := sqlStorage.flushBatch([]*QueryLog{
+		{Timestamp: now, ClientIP: "10.0.0.1", Domain: "ads.example.com", QueryType: "A", Blocked: true, MatchedSource: "Ads", MatchedRule: "ads.example.com"},
+		{Timestamp: now, ClientIP: "10.0.0.1", Domain: "evil.example.com", QueryType: "A", Blocked: true, MatchedSource: "Malware", MatchedRule: "evil.example.com"},
+		{Timestamp: now, ClientIP: "10.0.0.2", Domain: "social.example.com", QueryType: "A", Blocked: true, MatchedSource: "policy", MatchedRule: "no-social"},
+		{Timestamp: now, ClientIP: "10.0.0.2", Domain: "video.example.com", QueryType: "A", Blocked: true, MatchedSource: "policy", MatchedRule: " no video "},
+		{Timestamp: now, ClientIP: "10.0.0.2", Domain: "example.org", QueryType: "A"},
+	}); err != nil {
+		t.Fatalf("flushBatch: %v", err)
+	}
+
+	results, err := storage.GetQueriesFiltered(ctx, QueryFilter{MatchedSource: "Malware"}, 10, 0)
+	if err != nil {
+		t.Fatalf("GetQueriesFiltered: %v", err)
+	}
+	if len(results) != 1 || results[0].Domain != "evil.example.com" || results[0].MatchedRule != "evil.example.com" {
+		t.Fatalf("matched_source filter returned %+v", results)
+	}
+
+	count, err := storage.CountQueriesFiltered(ctx, QueryFilter{MatchedSource: "policy", MatchedRule: "no-social"}, 0)
+	if err != nil {
+		t.Fatalf("CountQueriesFiltered: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 query for rule no-social, got %d", count)
+	}
+
+	// Rule names are stored exactly, so the exact-match filter finds them
+	count, err = storage.CountQueriesFiltered(ctx, QueryFilter{MatchedRule: " no video "}, 0)
+	if err != nil {
+		t.Fatalf("CountQueriesFiltered: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 query for rule %q, got %d", " no video ", count)
+	}
+
+	// Undecided queries store NULL and read back empty
+	results, err = storage.GetQueriesFiltered(ctx, QueryFilter{Domain: "example.org"}, 10, 0)
+	if err != nil {
+		t.Fatalf("GetQueriesFiltered: %v", err)
+	}
+	if len(results) != 1 || results[0].MatchedSource != "" || results[0].MatchedRule != "" {
+		t.Fatalf("expected an unmatched query, got %+v", results)
+	}
+	var nulls int
+	if err := sqlStorage.db.QueryRow(`SELECT COUNT(*) FROM queries WHERE matched_source IS NULL`).Scan(&nulls); err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 1 {
+		t.Errorf("expected one NULL matched_source, got %d", nulls)
+	}
+}
+
+func TestSQLiteStorage_GetQueriesFiltered_Cursor(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	insert := func(ts time.Time, domain string) {
+		t.Helper()
+		if _, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+			(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(ts), "10.0.0.1", domain, "A", 0, false, false, 5); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	// 25 queries, with runs of identical timestamps to exercise the id tie-break.
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 25; i++ {
+		insert(base.Add(time.Duration(i/3)*time.Second), fmt.Sprintf("q%02d.example.com", i))
+	}
+
+	var (
+		seen   []string
+		cursor *QueryCursor
+	)
+	for page := 0; page < 10; page++ {
+		queries, err := storage.GetQueriesFiltered(ctx, QueryFilter{Before: cursor}, 10, 0)
+		if err != nil {
+			t.Fatalf("GetQueriesFiltered() page %d error = %v", page, err)
+		}
+		for _, q := range queries {
+			seen = append(seen, q.Domain)
+		}
+		if len(queries) < 10 {
+			break
+		}
+
+		// Round-trip through the opaque form, as the API does.
+		next, err := DecodeQueryCursor(CursorAfter(queries[len(queries)-1]).Encode())
+		if err != nil {
+			t.Fatalf("DecodeQueryCursor() error = %v", err)
+		}
+		cursor = next
+
+		// Newer queries arriving between pages must not shift later pages.
+		insert(time.Now().UTC(), fmt.Sprintf("new%d.example.com", page))
+	}
+
+	if len(seen) != 25 {
+		t.Fatalf("expected 25 queries across pages, got %d: %v", len(seen), seen)
+	}
+	for i, domain := range seen {
+		if want := fmt.Sprintf("q%02d.example.com", 24-i); domain != want {
+			t.Fatalf("position %d: got %s, want %s (order must be newest-first and stable)", i, domain, want)
+		}
+	}
+
+	var plan strings.Builder
+	rows, err := sqlStorage.db.Query(`EXPLAIN QUERY PLAN
+		SELECT id FROM queries WHERE (timestamp, id) < (?, ?) ORDER BY timestamp DESC, id DESC LIMIT 10`,
+		FormatTimestamp(base), 1)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN error = %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	if strings.Contains(plan.String(), "TEMP B-TREE") || !strings.Contains(plan.String(), "INDEX") {
+		t.Errorf("cursor query should walk a timestamp index without sorting, plan:\n%s", plan.String())
+	}
+}
+
+func TestSQLiteStorage_GetRecentBlocked(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	// Alternate allowed and blocked queries; pairs share a timestamp to
+	// exercise the id tie-break.
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 20; i++ {
+		if _, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+			(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(base.Add(time.Duration(i/4)*time.Second)), "10.0.0.1",
+			fmt.Sprintf("q%02d.example.com", i), "A", 0, i%2 == 1, false, 5); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	var seen []string
+	for offset := 0; ; offset += 4 {
+		page, err := storage.GetRecentBlocked(ctx, 4, offset)
+		if err != nil {
+			t.Fatalf("GetRecentBlocked() error = %v", err)
+		}
+		for _, q := range page {
+			if !q.Blocked {
+				t.Fatalf("GetRecentBlocked() returned allowed query %s", q.Domain)
+			}
+			seen = append(seen, q.Domain)
+		}
+		if len(page) < 4 {
+			break
+		}
+	}
+
+	if len(seen) != 10 {
+		t.Fatalf("expected 10 blocked queries, got %d: %v", len(seen), seen)
+	}
+	for i, domain := range seen {
+		if want := fmt.Sprintf("q%02d.example.com", 19-2*i); domain != want {
+			t.Fatalf("position %d: got %s, want %s (newest first)", i, domain, want)
+		}
+	}
+
+	var plan strings.Builder
+	rows, err := sqlStorage.db.Query(`EXPLAIN QUERY PLAN
+		SELECT id FROM queries WHERE blocked = 1 ORDER BY timestamp DESC, id DESC LIMIT 10`)
+	if err != nil {
+		t.Fatalf("EXPLAIN QUERY PLAN error = %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("scan plan: %v", err)
+		}
+		plan.WriteString(detail + "\n")
+	}
+	if strings.Contains(plan.String(), "TEMP B-TREE") || !strings.Contains(plan.String(), "INDEX idx_queries_blocked_ts (") {
+		t.Errorf("recent blocked query should walk idx_queries_blocked_ts without sorting, plan:\n%s", plan.String())
+	}
+}
+
+func TestSQLiteStorage_FilteredQueriesUseIndexes(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	tests := []struct {
+		name  string
+		query string
+		index string
+	}{
+		{
+			name:  "GetQueriesByDomain",
+			query: `SELECT * FROM queries WHERE domain = ? ORDER BY timestamp DESC LIMIT 10`,
+			index: "idx_queries_domain_timestamp",
+		},
+		{
+			name:  "GetQueriesByClientIP",
+			query: `SELECT * FROM queries WHERE client_ip = ? ORDER BY timestamp DESC LIMIT 10`,
+			index: "idx_queries_client_timestamp",
+		},
+		{
+			name:  "GetQueriesFiltered by client",
+			query: `SELECT * FROM queries WHERE client_ip = ? ORDER BY timestamp DESC, id DESC LIMIT 10`,
+			index: "idx_queries_client_timestamp",
+		},
+		{
+			name:  "GetQueriesFiltered by client and time range",
+			query: `SELECT * FROM queries WHERE client_ip = ? AND timestamp >= ? ORDER BY timestamp DESC, id DESC LIMIT 10`,
+			index: "idx_queries_client_timestamp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{"x"}
+			if strings.Count(tt.query, "?") == 2 {
+				args = append(args, FormatTimestamp(time.Now()))
+			}
+			rows, err := sqlStorage.db.Query("EXPLAIN QUERY PLAN "+tt.query, args...)
+			if err != nil {
+				t.Fatalf("EXPLAIN QUERY PLAN error = %v", err)
+			}
+			defer func() { _ = rows.Close() }()
+
+			var plan strings.Builder
+			for rows.Next() {
+				var id, parent, notused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+					t.Fatalf("scan plan: %v", err)
+				}
+				plan.WriteString(detail + "\n")
+			}
+			if !strings.Contains(plan.String(), "SEARCH queries USING") || !strings.Contains(plan.String(), tt.index) {
+				t.Errorf("expected an index search on %s, plan:\n%s", tt.index, plan.String())
+			}
+			if strings.Contains(plan.String(), "TEMP B-TREE") {
+				t.Errorf("expected no sort step, plan:\n%s", plan.String())
+			}
 		})
 	}
 }
 
+func TestDecodeQueryCursor_Invalid(t *testing.T) {
+	for _, raw := range []string{"", "!!!", "bm9waXBl", "MjAyNC0wMS0wMVQwMDowMDowMFp8eA"} {
+		if _, err := DecodeQueryCursor(raw); err == nil {
+			t.Errorf("DecodeQueryCursor(%q) expected error", raw)
+		}
+	}
+}
+
+func TestSQLiteStorage_GetUpstreamLatency(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	sqlStorage := storage.(*SQLiteStorage)
+	insert := func(ts time.Time, upstream string, ms float64, cached bool) {
+		t.Helper()
+		_, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+				(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms, upstream, upstream_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(ts), "192.168.1.1", "example.com", "A", 0, false, cached, ms, upstream, ms)
+		if err != nil {
+			t.Fatalf("Failed to insert test query: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	for i := 1; i <= 100; i++ {
+		insert(now, "1.1.1.1:53", float64(i), false)
+	}
+	insert(now, "9.9.9.9:53", 40, false)
+	insert(now, "9.9.9.9:53", 20, false)
+	insert(now, "9.9.9.9:53", 0, true)                      // cache hit: no exchange
+	insert(now.Add(-2*time.Hour), "9.9.9.9:53", 900, false) // outside the window
+	insert(now, "", 0, false)                               // answered locally
+
+	got, err := sqlStorage.GetUpstreamLatency(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetUpstreamLatency() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 upstreams, got %d", len(got))
+	}
+
+	cf := got[0]
+	if cf.Upstream != "1.1.1.1:53" || cf.Queries != 100 {
+		t.Fatalf("first upstream = %s (%d queries), want 1.1.1.1:53 (100)", cf.Upstream, cf.Queries)
+	}
+	if cf.P50Ms != 50 || cf.P95Ms != 95 || cf.P99Ms != 99 || cf.AvgMs != 50.5 {
+		t.Errorf("1.1.1.1:53 avg/p50/p95/p99 = %v/%v/%v/%v, want 50.5/50/95/99", cf.AvgMs, cf.P50Ms, cf.P95Ms, cf.P99Ms)
+	}
+
+	q9 := got[1]
+	if q9.Queries != 2 || q9.P50Ms != 20 || q9.P99Ms != 40 {
+		t.Errorf("9.9.9.9:53 = %+v, want 2 queries with p50 20 and p99 40", *q9)
+	}
+}
+
 func TestSQLiteStorage_GetTopDomains(t *testing.T) {
 	storage, cleanup := setupTestStorage(t)
 	defer cleanup()
@@ -638,6 +1082,16 @@ func TestSQLiteStorage_GetTopDomains(t *testing.T) {
 	if topBlocked[0].Domain != "ads.com" {
 		t.Errorf("expected ads.com to be top blocked domain, got %s", topBlocked[0].Domain)
 	}
+
+	if count, err := storage.CountDomains(ctx, false, time.Time{}, 0); err != nil || count != 3 {
+		t.Errorf("CountDomains(allowed) = %d, %v; want 3", count, err)
+	}
+	if count, err := storage.CountDomains(ctx, true, time.Time{}, 0); err != nil || count != 2 {
+		t.Errorf("CountDomains(blocked) = %d, %v; want 2", count, err)
+	}
+	if count, err := storage.CountDomains(ctx, false, time.Time{}, 1); err != nil || count != 1 {
+		t.Errorf("capped CountDomains = %d, %v; want 1", count, err)
+	}
 }
 
 func TestSQLiteStorage_GetBlockedCount(t *testing.T) {
@@ -882,7 +1336,7 @@ func TestSQLiteStorage_ClientSummaries(t *testing.T) {
 		t.Fatalf("UpdateClientProfile() error = %v", err)
 	}
 
-	summaries, err := storage.GetClientSummaries(ctx, 10, 0)
+	summaries, err := storage.GetClientSummaries(ctx, 10, 0, time.Time{})
 	if err != nil {
 		t.Fatalf("GetClientSummaries() error = %v", err)
 	}
@@ -919,6 +1373,264 @@ func TestSQLiteStorage_ClientSummaries(t *testing.T) {
 	}
 }
 
+func TestSQLiteStorage_ClientSummaries_SinceWindow(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	entries := []struct {
+		ts      time.Time
+		ip      string
+		blocked bool
+		rcode   int
+	}{
+		{old, "192.168.1.10", false, dns.RcodeSuccess},
+		{old, "192.168.1.10", false, dns.RcodeSuccess},
+		{old, "192.168.1.30", true, dns.RcodeNameError},
+		{now, "192.168.1.10", true, dns.RcodeNameError},
+		{now, "192.168.1.20", false, dns.RcodeSuccess},
+	}
+	for _, e := range entries {
+		if _, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+				(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(e.ts), e.ip, "example.com", "A", e.rcode, e.blocked, false, 5); err != nil {
+			t.Fatalf("failed to insert query: %v", err)
+		}
+	}
+
+	if _, err := sqlStorage.db.Exec(`INSERT INTO client_groups (name, description, color) VALUES ('Office', '', '#22c55e')`); err != nil {
+		t.Fatalf("failed to insert client group: %v", err)
+	}
+	if err := storage.UpdateClientProfile(ctx, &ClientProfile{ClientIP: "192.168.1.10", DisplayName: "Laptop", GroupName: "Office"}); err != nil {
+		t.Fatalf("UpdateClientProfile() error = %v", err)
+	}
+
+	summaries, err := storage.GetClientSummaries(ctx, 10, 0, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetClientSummaries() error = %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 clients active in the window, got %d", len(summaries))
+	}
+
+	byIP := make(map[string]*ClientSummary, len(summaries))
+	for _, summary := range summaries {
+		byIP[summary.ClientIP] = summary
+	}
+	laptop := byIP["192.168.1.10"]
+	if laptop == nil {
+		t.Fatal("expected 192.168.1.10 in windowed summaries")
+	}
+	if laptop.TotalQueries != 1 || laptop.BlockedQueries != 1 || laptop.NXDomainCount != 1 {
+		t.Errorf("windowed counts = total %d blocked %d nxdomain %d, want 1/1/1",
+			laptop.TotalQueries, laptop.BlockedQueries, laptop.NXDomainCount)
+	}
+	if laptop.DisplayName != "Laptop" || laptop.GroupName != "Office" || laptop.GroupColor != "#22c55e" {
+		t.Errorf("profile join lost in windowed query: %+v", laptop)
+	}
+	if laptop.FirstSeen.Before(now.Add(-24 * time.Hour)) {
+		t.Errorf("first_seen %v should fall inside the window", laptop.FirstSeen)
+	}
+	if _, ok := byIP["192.168.1.30"]; ok {
+		t.Error("client only seen before the window should be excluded")
+	}
+
+	ctx = WithClientSearch(ctx, "laptop")
+	summaries, err = storage.GetClientSummaries(ctx, 10, 0, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetClientSummaries() with search error = %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].ClientIP != "192.168.1.10" {
+		t.Errorf("expected search to narrow windowed results to the laptop, got %d results", len(summaries))
+	}
+
+	if count, err := storage.CountClientSummaries(ctx, now.Add(-24*time.Hour)); err != nil || count != 1 {
+		t.Errorf("CountClientSummaries() with search = %d, %v; want 1", count, err)
+	}
+	if count, err := storage.CountClientSummaries(context.Background(), now.Add(-24*time.Hour)); err != nil || count != 2 {
+		t.Errorf("CountClientSummaries() = %d, %v; want 2", count, err)
+	}
+}
+
+func TestSQLiteStorage_SetClientGroup(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := storage.UpdateClientProfile(ctx, &ClientProfile{ClientIP: "192.168.1.10", DisplayName: "Laptop", Notes: "upstairs"}); err != nil {
+		t.Fatalf("UpdateClientProfile() error = %v", err)
+	}
+	if err := storage.(ClientGroupSetter).SetClientGroup(ctx, "192.168.1.10", "Kids"); err != nil {
+		t.Fatalf("SetClientGroup() error = %v", err)
+	}
+	if err := storage.(ClientGroupSetter).SetClientGroup(ctx, "192.168.1.20", "Kids"); err != nil {
+		t.Fatalf("SetClientGroup() new client error = %v", err)
+	}
+
+	profiles, err := storage.ListClientProfiles(ctx)
+	if err != nil {
+		t.Fatalf("ListClientProfiles() error = %v", err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("expected 2 profiles, got %d", len(profiles))
+	}
+	if p := profiles[0]; p.GroupName != "Kids" || p.DisplayName != "Laptop" || p.Notes != "upstairs" {
+		t.Errorf("SetClientGroup clobbered the profile: %+v", p)
+	}
+	if profiles[1].GroupName != "Kids" {
+		t.Errorf("expected new profile in Kids, got %+v", profiles[1])
+	}
+
+	if err := storage.(ClientGroupSetter).SetClientGroup(ctx, "192.168.1.10", ""); err != nil {
+		t.Fatalf("SetClientGroup() clear error = %v", err)
+	}
+	profiles, err = storage.ListClientProfiles(ctx)
+	if err != nil {
+		t.Fatalf("ListClientProfiles() error = %v", err)
+	}
+	if p := profiles[0]; p.GroupName != "" || p.DisplayName != "Laptop" {
+		t.Errorf("expected group cleared and name kept, got %+v", p)
+	}
+}
+
+func TestSQLiteStorage_TopClients(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	entries := []struct {
+		ts      time.Time
+		ip      string
+		blocked bool
+	}{
+		{old, "192.168.1.30", false},
+		{old, "192.168.1.30", false},
+		{old, "192.168.1.30", false},
+		{now, "192.168.1.10", true},
+		{now, "192.168.1.10", false},
+		{now, "192.168.1.20", false},
+	}
+	for _, e := range entries {
+		if _, err := sqlStorage.db.Exec(`
+			INSERT INTO queries
+				(timestamp, client_ip, domain, query_type, response_code, blocked, cached, response_time_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, FormatTimestamp(e.ts), e.ip, "example.com", "A", dns.RcodeSuccess, e.blocked, false, 5); err != nil {
+			t.Fatalf("failed to insert query: %v", err)
+		}
+	}
+	if err := storage.UpdateClientProfile(ctx, &ClientProfile{ClientIP: "192.168.1.10", DisplayName: "Laptop"}); err != nil {
+		t.Fatalf("UpdateClientProfile() error = %v", err)
+	}
+
+	top, err := sqlStorage.GetTopClients(ctx, 10, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetTopClients() error = %v", err)
+	}
+	if len(top) != 2 {
+		t.Fatalf("expected 2 clients active in the window, got %d", len(top))
+	}
+	if top[0].ClientIP != "192.168.1.10" || top[0].DisplayName != "Laptop" {
+		t.Errorf("expected the laptop to rank first, got %+v", top[0])
+	}
+	if top[0].TotalQueries != 2 || top[0].BlockedQueries != 1 {
+		t.Errorf("laptop counts = total %d blocked %d, want 2/1", top[0].TotalQueries, top[0].BlockedQueries)
+	}
+	if top[1].ClientIP != "192.168.1.20" || top[1].DisplayName != "192.168.1.20" {
+		t.Errorf("expected unnamed client to fall back to its IP, got %+v", top[1])
+	}
+
+	top, err = sqlStorage.GetTopClients(ctx, 1, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetTopClients() with limit error = %v", err)
+	}
+	if len(top) != 1 {
+		t.Errorf("expected limit to cap results at 1, got %d", len(top))
+	}
+}
+
+func TestSQLiteStorage_ClientHostnames(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	sqlStorage := storage.(*SQLiteStorage)
+
+	now := time.Now()
+	for i, ip := range []string{"192.168.1.10", "192.168.1.20", "192.168.1.30"} {
+		if _, err := sqlStorage.db.Exec(`
+			INSERT INTO client_stats (client_ip, total_queries, first_seen, last_seen)
+			VALUES (?, 1, ?, ?)
+		`, ip, FormatTimestamp(now), FormatTimestamp(now.Add(time.Duration(i)*time.Minute))); err != nil {
+			t.Fatalf("failed to insert client stats: %v", err)
+		}
+	}
+
+	if err := storage.UpdateClientProfile(ctx, &ClientProfile{ClientIP: "192.168.1.10", DisplayName: "Laptop"}); err != nil {
+		t.Fatalf("UpdateClientProfile() error = %v", err)
+	}
+
+	unnamed, err := storage.ListClientsWithoutHostname(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListClientsWithoutHostname() error = %v", err)
+	}
+	if len(unnamed) != 2 || unnamed[0] != "192.168.1.30" || unnamed[1] != "192.168.1.20" {
+		t.Fatalf("unnamed clients = %v, want [192.168.1.30 192.168.1.20]", unnamed)
+	}
+
+	if err := storage.SetClientHostname(ctx, "192.168.1.10", "laptop.lan"); err != nil {
+		t.Fatalf("SetClientHostname() error = %v", err)
+	}
+	if err := storage.SetClientHostname(ctx, "192.168.1.20", "phone.lan"); err != nil {
+		t.Fatalf("SetClientHostname() error = %v", err)
+	}
+
+	unnamed, err = storage.ListClientsWithoutHostname(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListClientsWithoutHostname() error = %v", err)
+	}
+	if len(unnamed) != 1 || unnamed[0] != "192.168.1.30" {
+		t.Fatalf("unnamed clients after discovery = %v, want [192.168.1.30]", unnamed)
+	}
+
+	summaries, err := storage.GetClientSummaries(ctx, 10, 0, time.Time{})
+	if err != nil {
+		t.Fatalf("GetClientSummaries() error = %v", err)
+	}
+	byIP := make(map[string]*ClientSummary, len(summaries))
+	for _, summary := range summaries {
+		byIP[summary.ClientIP] = summary
+	}
+	if got := byIP["192.168.1.10"]; got == nil || got.DisplayName != "Laptop" || got.Hostname != "laptop.lan" {
+		t.Errorf("operator name should win over discovered hostname: %+v", got)
+	}
+	if got := byIP["192.168.1.20"]; got == nil || got.DisplayName != "phone.lan" || got.Hostname != "phone.lan" {
+		t.Errorf("discovered hostname should be used as display name: %+v", got)
+	}
+	if got := byIP["192.168.1.30"]; got == nil || got.DisplayName != "192.168.1.30" {
+		t.Errorf("unnamed client should fall back to its IP: %+v", got)
+	}
+
+	ctx = WithClientSearch(ctx, "phone")
+	summaries, err = storage.GetClientSummaries(ctx, 10, 0, time.Time{})
+	if err != nil {
+		t.Fatalf("GetClientSummaries() with search error = %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].ClientIP != "192.168.1.20" {
+		t.Errorf("expected hostname search to match the phone, got %d results", len(summaries))
+	}
+}
+
 func TestSQLiteStorage_Persistence(t *testing.T) {
 	// Create a temporary database file
 	tmpfile, err := os.CreateTemp("", "test-*.db")
@@ -1011,3 +1723,75 @@ func setupTestStorage(t *testing.T) (Storage, func()) {
 
 	return storage, cleanup
 }
+
+func TestPolicyRules_PriorityOrder(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	for i, r := range []struct {
+		name     string
+		priority int
+	}{{"first", 0}, {"urgent", 5}, {"second", 0}} {
+		if _, err := storage.CreatePolicyRule(ctx, &PolicyRule{
+			Name: r.name, Logic: "true", Action: "BLOCK", Enabled: true,
+			SortOrder: i, Priority: r.priority,
+		}); err != nil {
+			t.Fatalf("CreatePolicyRule(%s): %v", r.name, err)
+		}
+	}
+
+	rules, err := storage.GetPolicyRules(ctx)
+	if err != nil {
+		t.Fatalf("GetPolicyRules: %v", err)
+	}
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	if got := strings.Join(names, ","); got != "urgent,first,second" {
+		t.Fatalf("order = %s, want urgent,first,second", got)
+	}
+	if rules[0].Priority != 5 {
+		t.Errorf("priority = %d, want 5", rules[0].Priority)
+	}
+
+	// Lowering the priority puts the rule back in sort_order position.
+	rules[0].Priority = 0
+	if err := storage.UpdatePolicyRule(ctx, rules[0].ID, rules[0]); err != nil {
+		t.Fatalf("UpdatePolicyRule: %v", err)
+	}
+	rules, _ = storage.GetPolicyRules(ctx)
+	if rules[0].Name != "first" || rules[1].Name != "urgent" {
+		t.Errorf("after update got %s,%s first, want first,urgent", rules[0].Name, rules[1].Name)
+	}
+}
+
+func TestPolicyRules_Category(t *testing.T) {
+	storage, cleanup := setupTestStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	id, err := storage.CreatePolicyRule(ctx, &PolicyRule{
+		Name: "no-games", Logic: "true", Action: "BLOCK", Category: "parental", Enabled: true,
+	})
+	if err != nil {
+		t.Fatalf("CreatePolicyRule: %v", err)
+	}
+	rules, err := storage.GetPolicyRules(ctx)
+	if err != nil {
+		t.Fatalf("GetPolicyRules: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Category != "parental" || rules[0].ActionData != "" {
+		t.Fatalf("got %+v, want category parental and no action_data", rules)
+	}
+
+	rules[0].Category = "malware"
+	if err := storage.UpdatePolicyRule(ctx, id, rules[0]); err != nil {
+		t.Fatalf("UpdatePolicyRule: %v", err)
+	}
+	rules, _ = storage.GetPolicyRules(ctx)
+	if rules[0].Category != "malware" {
+		t.Errorf("category = %q after update, want malware", rules[0].Category)
+	}
+}
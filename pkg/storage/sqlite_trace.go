@@ -20,7 +20,7 @@ func (s *SQLiteStorage) GetTraceStatistics(ctx context.Context, since time.Time)
 	}
 
 	// Get total blocked queries
-	err := s.db.QueryRowContext(ctx, `
+	err := s.readDB.QueryRowContext(ctx, `
 		SELECT COUNT(*)
 		FROM queries
 		WHERE timestamp >= ? AND blocked = 1 AND block_trace IS NOT NULL
@@ -40,7 +40,7 @@ func (s *SQLiteStorage) GetTraceStatistics(ctx context.Context, since time.Time)
 		}
 
 		// Query batch of block traces using cursor-based pagination
-		rows, err := s.db.QueryContext(ctx, `
+		rows, err := s.readDB.QueryContext(ctx, `
 			SELECT id, block_trace
 			FROM queries
 			WHERE timestamp >= ? AND blocked = 1 AND block_trace IS NOT NULL AND id > ?
@@ -121,7 +121,7 @@ func (s *SQLiteStorage) GetQueriesWithTraceFilter(ctx context.Context, filter Tr
 
 	// We need to filter in application code since SQLite doesn't have native JSON query functions
 	// in the version we're using. Limit the scan to prevent unbounded memory usage.
-	rows, err := s.db.QueryContext(ctx, query, maxScanRows)
+	rows, err := s.readDB.QueryContext(ctx, query, maxScanRows)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,16 +13,21 @@ type Storage interface {
 	// Query Logging
 	LogQuery(ctx context.Context, query *QueryLog) error
 	GetRecentQueries(ctx context.Context, limit, offset int) ([]*QueryLog, error)
+	GetRecentBlocked(ctx context.Context, limit, offset int) ([]*QueryLog, error)
 	GetQueriesByDomain(ctx context.Context, domain string, limit int) ([]*QueryLog, error)
 	GetQueriesByClientIP(ctx context.Context, clientIP string, limit int) ([]*QueryLog, error)
 	GetQueriesFiltered(ctx context.Context, filter QueryFilter, limit, offset int) ([]*QueryLog, error)
+	CountQueriesFiltered(ctx context.Context, filter QueryFilter, limit int) (int64, error)
 
 	// Statistics
 	GetStatistics(ctx context.Context, since time.Time) (*Statistics, error)
 	GetTopDomains(ctx context.Context, limit int, blocked bool, since time.Time) ([]*DomainStats, error)
+	CountDomains(ctx context.Context, blocked bool, since time.Time, limit int) (int64, error)
 	GetBlockedCount(ctx context.Context, since time.Time) (int64, error)
 	GetQueryCount(ctx context.Context, since time.Time) (int64, error)
 	GetTimeSeriesStats(ctx context.Context, bucket time.Duration, points int) ([]*TimeSeriesPoint, error)
+	GetDomainTimeSeries(ctx context.Context, domain string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error)
+	GetClientTimeSeries(ctx context.Context, clientIP string, bucket time.Duration, points int) ([]*TimeSeriesPoint, error)
 	GetQueryTypeStats(ctx context.Context, limit int, since time.Time) ([]*QueryTypeStats, error)
 
 	// Trace Analytics
@@ -29,9 +35,12 @@ type Storage interface {
 	GetQueriesWithTraceFilter(ctx context.Context, filter TraceFilter, limit, offset int) ([]*QueryLog, error)
 
 	// Client Management
-	GetClientSummaries(ctx context.Context, limit, offset int) ([]*ClientSummary, error)
+	GetClientSummaries(ctx context.Context, limit, offset int, since time.Time) ([]*ClientSummary, error)
+	CountClientSummaries(ctx context.Context, since time.Time) (int64, error)
 	ListClientProfiles(ctx context.Context) ([]*ClientProfile, error)
 	UpdateClientProfile(ctx context.Context, profile *ClientProfile) error
+	SetClientHostname(ctx context.Context, clientIP, hostname string) error
+	ListClientsWithoutHostname(ctx context.Context, limit int) ([]string, error)
 	GetClientGroups(ctx context.Context) ([]*ClientGroup, error)
 	UpsertClientGroup(ctx context.Context, group *ClientGroup) error
 	DeleteClientGroup(ctx context.Context, name string) error
@@ -75,6 +84,13 @@ type QueryLog struct {
 	DNSSECValidated bool              `json:"dnssec_validated,omitempty"`
 	BlockTrace      []BlockTraceEntry `json:"block_trace,omitempty"`
 
+	// The blocklist or policy rule that decided the query, recorded whether
+	// or not decision traces are on. MatchedSource is the list URL (or
+	// "policy" / "legacy"); MatchedRule is the matched entry, pattern or
+	// policy rule name. Both are empty for queries no list or rule decided.
+	MatchedRule   string `json:"matched_rule,omitempty"`
+	MatchedSource string `json:"matched_source,omitempty"`
+
 	// Unbound enrichment (populated when upstream is Unbound via dnstap correlation)
 	UnboundCached     *bool    `json:"unbound_cached,omitempty"`
 	UnboundDurationMs *float64 `json:"unbound_duration_ms,omitempty"`
@@ -88,6 +104,7 @@ type BlockTraceEntry struct {
 	Rule     string            `json:"rule,omitempty"`
 	Source   string            `json:"source,omitempty"`
 	Detail   string            `json:"detail,omitempty"`
+	Category string            `json:"category,omitempty"` // Block category of the matching list or rule (e.g. advertising, malware)
 	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
@@ -192,12 +209,23 @@ type QueryFilter struct {
 	Cached       *bool
 	Start        time.Time
 	End          time.Time
+
+	// Exact matches on QueryLog.MatchedSource / MatchedRule, both indexed
+	MatchedSource string
+	MatchedRule   string
+
+	// Before switches to keyset pagination: only queries strictly older than
+	// the cursor are returned, and offset should be 0. Each page costs the
+	// same regardless of depth, and rows inserted meanwhile never shift later
+	// pages. Preferred over offset for scrolling and export.
+	Before *QueryCursor
 }
 
 // ClientSummary aggregates per-client statistics for display.
 type ClientSummary struct {
 	ClientIP       string    `json:"client_ip"`
 	DisplayName    string    `json:"display_name"`
+	Hostname       string    `json:"hostname,omitempty"` // Discovered via DHCP leases / PTR
 	GroupName      string    `json:"group_name,omitempty"`
 	GroupColor     string    `json:"group_color,omitempty"`
 	Notes          string    `json:"notes,omitempty"`
@@ -245,6 +273,66 @@ type Config struct {
 	BatchSize     int              `yaml:"batch_size"`
 	RetentionDays int              `yaml:"retention_days"`
 	Enabled       bool             `yaml:"enabled"`
+	// SampleRate is the fraction of non-blocked queries written to the query
+	// log (0 < rate <= 1). Blocked queries are always logged.
+	SampleRate float64 `yaml:"sample_rate"`
+	// PreserveDomainCase logs domains exactly as the client sent them. By
+	// default they are lowercased so 0x20-randomized and mixed-case queries
+	// for the same name aggregate together.
+	PreserveDomainCase bool `yaml:"preserve_domain_case"`
+	// Backpressure is what LogQuery does when the write buffer is full:
+	// BackpressureDrop discards the entry, BackpressureBlock waits up to
+	// BackpressureTimeout for room and drops only then.
+	Backpressure        string        `yaml:"backpressure"`
+	BackpressureTimeout time.Duration `yaml:"backpressure_timeout"`
+	// MaxRestoreSize caps an uploaded restore, both as sent and after
+	// decompression, in MB.
+	MaxRestoreSize int `yaml:"max_restore_size"`
+}
+
+// Backpressure modes for Config.Backpressure.
+const (
+	BackpressureDrop  = "drop"
+	BackpressureBlock = "block"
+)
+
+// DefaultBackpressureTimeout bounds how long LogQuery waits for buffer room
+// in block mode when Config.BackpressureTimeout is unset.
+const DefaultBackpressureTimeout = 100 * time.Millisecond
+
+// DefaultMaxRestoreSize is the restore upload cap in MB when
+// Config.MaxRestoreSize is unset.
+const DefaultMaxRestoreSize = 4096
+
+// DropWarnInterval is the minimum gap between "buffer full" warnings; drops in
+// between are counted and reported with the next warning.
+const DropWarnInterval = 10 * time.Second
+
+// DropWarner rate-limits warnings about dropped query log entries so a
+// saturated buffer logs one line per interval instead of one per query.
+type DropWarner struct {
+	interval time.Duration
+	lastWarn atomic.Int64 // UnixNano of the last warning
+	pending  atomic.Int64 // Drops since the last warning
+}
+
+// NewDropWarner returns a DropWarner that warns at most once per interval.
+func NewDropWarner(interval time.Duration) *DropWarner {
+	return &DropWarner{interval: interval}
+}
+
+// Drop records one dropped entry. It returns the number of drops to report
+// when a warning is due, or 0 when the caller should stay quiet.
+func (w *DropWarner) Drop(now time.Time) int64 {
+	w.pending.Add(1)
+	last := w.lastWarn.Load()
+	if last != 0 && now.UnixNano()-last < int64(w.interval) {
+		return 0
+	}
+	if !w.lastWarn.CompareAndSwap(last, now.UnixNano()) {
+		return 0
+	}
+	return w.pending.Swap(0)
 }
 
 // SQLiteConfig represents SQLite-specific configuration
@@ -254,6 +342,81 @@ type SQLiteConfig struct {
 	WALMode     bool   `yaml:"wal_mode"`     // Enable WAL mode
 	CacheSize   int    `yaml:"cache_size"`   // Cache size in KB
 	MMapSize    int64  `yaml:"mmap_size"`    // mmap window in bytes
+
+	// WALAutoCheckpoint is the WAL size in pages that triggers an automatic
+	// checkpoint (PRAGMA wal_autocheckpoint). 0 keeps SQLite's default of 1000.
+	WALAutoCheckpoint int `yaml:"wal_autocheckpoint"`
+	// CheckpointInterval runs PRAGMA wal_checkpoint(TRUNCATE) and an
+	// incremental vacuum on this schedule so the -wal file and free pages
+	// don't keep the database large after bursts. 0 disables it.
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"`
+	// ReadPoolSize is the number of read-only connections serving dashboard
+	// and API queries in WAL mode, separate from the single writer.
+	// 0 uses DefaultReadPoolSize.
+	ReadPoolSize int `yaml:"read_pool_size"`
+	// ConvertAutoVacuum rewrites a database created without auto-vacuum into
+	// incremental mode with a one-off VACUUM at startup. Off by default: the
+	// VACUUM blocks startup and needs free space equal to the database size.
+	ConvertAutoVacuum bool `yaml:"convert_auto_vacuum"`
+}
+
+// DefaultReadPoolSize is the read-only connection count when
+// SQLiteConfig.ReadPoolSize is unset.
+const DefaultReadPoolSize = 4
+
+// DiskUsage is the on-disk size of a file-backed database.
+type DiskUsage struct {
+	DatabaseBytes int64 `json:"database_bytes"`
+	WALBytes      int64 `json:"wal_bytes"`
+}
+
+// DiskUsageReporter is implemented by backends that keep their data in local
+// files and can report how much disk they use.
+type DiskUsageReporter interface {
+	DiskUsage() (DiskUsage, error)
+}
+
+// BufferReporter is implemented by backends that queue writes in memory and
+// can report how full that queue is.
+type BufferReporter interface {
+	GetBufferStats() BufferStats
+}
+
+// Backupper is implemented by backends that can snapshot their database while
+// running and stage a snapshot to replace it on the next start.
+type Backupper interface {
+	Backup(ctx context.Context, destPath string) error
+	StageRestore(ctx context.Context, srcPath string) error
+	RestoreStagingDir() string
+}
+
+// UpstreamLatency summarizes the exchange times logged for one upstream.
+// Percentiles use the nearest-rank method over the logged upstream_time_ms.
+type UpstreamLatency struct {
+	Upstream string  `json:"upstream"`
+	Queries  int64   `json:"queries"`
+	AvgMs    float64 `json:"avg_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+// UpstreamLatencyReporter is implemented by backends that can summarize
+// upstream exchange times from the query log.
+type UpstreamLatencyReporter interface {
+	GetUpstreamLatency(ctx context.Context, since time.Time) ([]*UpstreamLatency, error)
+}
+
+// TopClientsReporter is implemented by backends that can rank clients by
+// query volume.
+type TopClientsReporter interface {
+	GetTopClients(ctx context.Context, limit int, since time.Time) ([]*ClientSummary, error)
+}
+
+// ClientGroupSetter is implemented by backends that can move a single client
+// into or out of a group without touching the rest of its profile.
+type ClientGroupSetter interface {
+	SetClientGroup(ctx context.Context, clientIP, groupName string) error
 }
 
 // StatisticsConfig represents statistics aggregation configuration
@@ -278,6 +441,7 @@ func DefaultConfig() Config {
 		FlushInterval: 5 * time.Second,
 		BatchSize:     100,
 		RetentionDays: 7,
+		SampleRate:    1,
 		Statistics: StatisticsConfig{
 			Enabled:             true,
 			AggregationInterval: 1 * time.Hour,
@@ -333,6 +497,18 @@ func (c *Config) Validate() error {
 		c.SQLite.MMapSize = 0
 	}
 
+	if c.SQLite.WALAutoCheckpoint < 0 {
+		c.SQLite.WALAutoCheckpoint = 0
+	}
+
+	if c.SQLite.CheckpointInterval < 0 {
+		c.SQLite.CheckpointInterval = 0
+	}
+
+	if c.SQLite.ReadPoolSize < 0 {
+		c.SQLite.ReadPoolSize = 0
+	}
+
 	return nil
 }
 
@@ -344,7 +520,9 @@ type PolicyRule struct {
 	Logic      string `json:"logic"`
 	Action     string `json:"action"`
 	ActionData string `json:"action_data"`
+	Category   string `json:"category"`
 	SortOrder  int    `json:"sort_order"`
+	Priority   int    `json:"priority"`
 	Enabled    bool   `json:"enabled"`
 }
 
@@ -0,0 +1,74 @@
+package telemetry
+
+import (
+	"strings"
+
+	"glory-hole/pkg/config"
+)
+
+// otherLabel is the bucket for query types outside the configured allowlist.
+const otherLabel = "other"
+
+// defaultQueryTypeLabels are the query types kept as their own label when
+// bucketing is enabled and no explicit list is configured.
+var defaultQueryTypeLabels = []string{
+	"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SOA", "PTR",
+	"SRV", "HTTPS", "SVCB", "CAA", "DS", "DNSKEY", "ANY",
+}
+
+// labelPolicy applies the metric_labels cardinality controls. The zero value
+// passes every label through unchanged, which keeps hand-built Metrics in
+// tests working.
+type labelPolicy struct {
+	queryTypes   map[string]struct{} // nil = no bucketing
+	dropUpstream bool
+	dropClient   bool
+}
+
+func newLabelPolicy(cfg config.MetricLabelsConfig) labelPolicy {
+	p := labelPolicy{
+		dropUpstream: !cfg.UpstreamEnabled(),
+		dropClient:   !cfg.ClientEnabled(),
+	}
+	if cfg.BucketQueryTypes {
+		types := cfg.QueryTypes
+		if len(types) == 0 {
+			types = defaultQueryTypeLabels
+		}
+		p.queryTypes = make(map[string]struct{}, len(types))
+		for _, t := range types {
+			p.queryTypes[strings.ToUpper(strings.TrimSpace(t))] = struct{}{}
+		}
+	}
+	return p
+}
+
+// QueryTypeLabel returns the label to record for a query type name, bucketing
+// types outside the allowlist into "other" when enabled.
+func (m *Metrics) QueryTypeLabel(qtype string) string {
+	if m == nil || m.labels.queryTypes == nil || qtype == "" {
+		return qtype
+	}
+	if _, ok := m.labels.queryTypes[qtype]; ok {
+		return qtype
+	}
+	return otherLabel
+}
+
+// UpstreamLabel returns upstream, or "" when the upstream label is disabled.
+// Callers omit empty labels.
+func (m *Metrics) UpstreamLabel(upstream string) string {
+	if m != nil && m.labels.dropUpstream {
+		return ""
+	}
+	return upstream
+}
+
+// ClientLabel returns client, or "" when the client label is disabled.
+// Callers omit empty labels.
+func (m *Metrics) ClientLabel(client string) string {
+	if m != nil && m.labels.dropClient {
+		return ""
+	}
+	return client
+}
@@ -0,0 +1,65 @@
+package telemetry
+
+import (
+	"testing"
+
+	"glory-hole/pkg/config"
+)
+
+func TestQueryTypeLabel_Bucketing(t *testing.T) {
+	m := &Metrics{labels: newLabelPolicy(config.MetricLabelsConfig{BucketQueryTypes: true})}
+
+	tests := map[string]string{
+		"A":         "A",
+		"HTTPS":     "HTTPS",
+		"TYPE65534": "other",
+		"NAPTR":     "other",
+		"":          "",
+	}
+	for in, want := range tests {
+		if got := m.QueryTypeLabel(in); got != want {
+			t.Errorf("QueryTypeLabel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestQueryTypeLabel_CustomList(t *testing.T) {
+	m := &Metrics{labels: newLabelPolicy(config.MetricLabelsConfig{
+		BucketQueryTypes: true,
+		QueryTypes:       []string{"a", " naptr "},
+	})}
+
+	if got := m.QueryTypeLabel("NAPTR"); got != "NAPTR" {
+		t.Errorf("expected NAPTR kept, got %q", got)
+	}
+	if got := m.QueryTypeLabel("AAAA"); got != "other" {
+		t.Errorf("expected AAAA bucketed, got %q", got)
+	}
+}
+
+func TestLabelPolicy_Defaults(t *testing.T) {
+	// Zero value (hand-built Metrics) and default config pass everything through.
+	for _, m := range []*Metrics{{}, {labels: newLabelPolicy(config.MetricLabelsConfig{})}, nil} {
+		if got := m.QueryTypeLabel("TYPE65534"); got != "TYPE65534" {
+			t.Errorf("QueryTypeLabel passthrough = %q", got)
+		}
+		if got := m.UpstreamLabel("1.1.1.1:53"); got != "1.1.1.1:53" {
+			t.Errorf("UpstreamLabel passthrough = %q", got)
+		}
+		if got := m.ClientLabel("10.0.0.1"); got != "10.0.0.1" {
+			t.Errorf("ClientLabel passthrough = %q", got)
+		}
+	}
+}
+
+func TestLabelPolicy_DisableHighCardinality(t *testing.T) {
+	off := false
+	m := &Metrics{labels: newLabelPolicy(config.MetricLabelsConfig{Upstream: &off, Client: &off})}
+
+	if got := m.UpstreamLabel("1.1.1.1:53"); got != "" {
+		t.Errorf("expected upstream label dropped, got %q", got)
+	}
+	if got := m.ClientLabel("10.0.0.1"); got != "" {
+		t.Errorf("expected client label dropped, got %q", got)
+	}
+}
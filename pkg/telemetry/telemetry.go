@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"glory-hole/pkg/config"
@@ -13,11 +14,14 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/noop"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
@@ -41,12 +45,41 @@ type Metrics struct {
 	DNSQueryDuration    metric.Float64Histogram
 	DNSCacheHits        metric.Int64Counter
 	DNSCacheMisses      metric.Int64Counter
+	DNSCacheEvictions   metric.Int64Counter
 	DNSBlockedQueries   metric.Int64Counter
 	DNSForwardedQueries metric.Int64Counter
+	DNSSlowQueries      metric.Int64Counter
+	DNSUpstreamDuration metric.Float64Histogram
+
+	// Anomaly detection (server.anomaly_detection)
+	DNSAnomalies         metric.Int64Counter
+	DNSPeakDomainQueries metric.Int64Gauge
+	DNSPeakClientDomains metric.Int64Gauge
+
+	// DNS rebinding protection (server.rebind_protection)
+	DNSRebindBlocked metric.Int64Counter
+
+	// Per-client daily quota (server.query_quota)
+	DNSQuotaRefused metric.Int64Counter
 
 	// SERVFAIL→TCP retry workaround (forwarder)
 	ServfailTCPRetryTotal metric.Int64Counter
 
+	// Upstream circuit breaker (forwarder)
+	CircuitBreakerTransitions metric.Int64Counter
+	CircuitBreakerRejected    metric.Int64Counter
+
+	// Upstream concurrency limit (forwarder.max_concurrent)
+	ForwarderInflight metric.Int64UpDownCounter
+	ForwarderRejected metric.Int64Counter
+
+	// Request coalescing (forwarder single-flight)
+	ForwarderCoalesced metric.Int64Counter
+
+	// TCP/DoT connection limit (server.max_tcp_connections)
+	DNSTCPConnections metric.Int64UpDownCounter
+	DNSTCPRejected    metric.Int64Counter
+
 	// Rate limiting metrics
 	RateLimitViolations metric.Int64Counter
 	RateLimitDropped    metric.Int64Counter
@@ -56,8 +89,18 @@ type Metrics struct {
 	BlocklistSize metric.Int64UpDownCounter
 	CacheSize     metric.Int64UpDownCounter
 
+	// BlocklistLoadPeakHeap is the largest live heap sampled during the
+	// most recent blocklist load.
+	BlocklistLoadPeakHeap metric.Int64Gauge
+
+	// BlocklistDownloaded counts bytes fetched by blocklist updates.
+	BlocklistDownloaded metric.Int64Counter
+
 	// Storage metrics
 	StorageQueriesDropped metric.Int64Counter
+	StorageBufferUsed     metric.Int64Gauge
+
+	labels labelPolicy // Cardinality controls (telemetry.metric_labels)
 }
 
 // New creates a new telemetry instance
@@ -146,14 +189,41 @@ func (t *Telemetry) setupMetrics(ctx context.Context, res *resource.Resource) er
 	return nil
 }
 
-// setupTracing initializes the tracer provider
+// setupTracing initializes the tracer provider with an OTLP/gRPC exporter.
+// tracing_endpoint accepts host:port (plaintext) or a full URL; when empty the
+// exporter falls back to OTEL_EXPORTER_OTLP_* env vars and then localhost:4317.
+// Root spans are sampled at tracing_sample_rate; children follow their parent.
 func (t *Telemetry) setupTracing(ctx context.Context, res *resource.Resource) error {
-	// For now, we'll use a no-op tracer
-	// In production, you would configure OTLP exporter here
-	t.tracerProvider = tracenoop.NewTracerProvider()
-	otel.SetTracerProvider(t.tracerProvider)
+	var opts []otlptracegrpc.Option
+	switch endpoint := strings.TrimSpace(t.cfg.TracingEndpoint); {
+	case endpoint == "":
+	case strings.Contains(endpoint, "://"):
+		opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+	default:
+		opts = append(opts, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	}
+
+	// The gRPC client connects lazily, so an unreachable collector doesn't
+	// block startup; spans are dropped by the batcher until it comes up.
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create otlp trace exporter: %w", err)
+	}
 
-	t.logger.Info("Tracing enabled", "endpoint", t.cfg.TracingEndpoint)
+	rate := t.cfg.TracingSampleRate
+	if rate <= 0 {
+		rate = 0.1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(rate))),
+	)
+	t.tracerProvider = provider
+	otel.SetTracerProvider(provider)
+
+	t.logger.Info("Tracing enabled", "endpoint", t.cfg.TracingEndpoint, "sample_rate", rate)
 	return nil
 }
 
@@ -226,6 +296,15 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create query duration histogram: %w", err)
 	}
 
+	upstreamDuration, err := meter.Float64Histogram(
+		"dns.upstream.duration",
+		metric.WithDescription("Upstream exchange duration in milliseconds, by upstream"),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream duration histogram: %w", err)
+	}
+
 	cacheHits, err := meter.Int64Counter(
 		"dns.cache.hits",
 		metric.WithDescription("Number of DNS cache hits"),
@@ -242,6 +321,14 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create cache misses counter: %w", err)
 	}
 
+	cacheEvictions, err := meter.Int64Counter(
+		"dns.cache.evictions",
+		metric.WithDescription("Number of DNS cache entries evicted, by reason (lru, expired)"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache evictions counter: %w", err)
+	}
+
 	blockedQueries, err := meter.Int64Counter(
 		"dns.queries.blocked",
 		metric.WithDescription("Number of blocked DNS queries"),
@@ -258,6 +345,54 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create forwarded queries counter: %w", err)
 	}
 
+	slowQueries, err := meter.Int64Counter(
+		"dns.queries.slow",
+		metric.WithDescription("Number of DNS queries exceeding server.slow_query_threshold"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slow queries counter: %w", err)
+	}
+
+	anomalies, err := meter.Int64Counter(
+		"dns.anomalies",
+		metric.WithDescription("Number of anomalous query patterns detected (tunneling, exfiltration, query floods)"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anomalies counter: %w", err)
+	}
+
+	peakDomainQueries, err := meter.Int64Gauge(
+		"dns.anomaly.peak_domain_queries",
+		metric.WithDescription("Highest query count for a single domain in the last anomaly window"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peak domain queries gauge: %w", err)
+	}
+
+	peakClientDomains, err := meter.Int64Gauge(
+		"dns.anomaly.peak_client_domains",
+		metric.WithDescription("Highest number of distinct names queried by one client in the last anomaly window"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peak client domains gauge: %w", err)
+	}
+
+	rebindBlocked, err := meter.Int64Counter(
+		"dns.rebind.blocked",
+		metric.WithDescription("Number of upstream answers stripped of private addresses by rebind protection"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rebind blocked counter: %w", err)
+	}
+
+	quotaRefused, err := meter.Int64Counter(
+		"dns.quota.refused",
+		metric.WithDescription("Number of queries refused because the client exceeded its daily query quota"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota refused counter: %w", err)
+	}
+
 	rateLimitViolations, err := meter.Int64Counter(
 		"rate_limit.violations",
 		metric.WithDescription("Number of rate limit violations"),
@@ -290,6 +425,24 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create blocklist size gauge: %w", err)
 	}
 
+	blocklistLoadPeakHeap, err := meter.Int64Gauge(
+		"blocklist.load.peak_heap",
+		metric.WithDescription("Largest live heap sampled during the last blocklist load"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blocklist load peak heap gauge: %w", err)
+	}
+
+	blocklistDownloaded, err := meter.Int64Counter(
+		"blocklist.download",
+		metric.WithDescription("Bytes downloaded by blocklist updates"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blocklist download counter: %w", err)
+	}
+
 	cacheSize, err := meter.Int64UpDownCounter(
 		"cache.size",
 		metric.WithDescription("Number of entries in DNS cache"),
@@ -306,6 +459,14 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create storage queries dropped counter: %w", err)
 	}
 
+	storageBufferUsed, err := meter.Int64Gauge(
+		"storage.buffer.used",
+		metric.WithDescription("Query log entries waiting in the storage write buffer"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage buffer used gauge: %w", err)
+	}
+
 	servfailTCPRetryTotal, err := meter.Int64Counter(
 		"forwarder.servfail_tcp_retry.total",
 		metric.WithDescription("Number of UDP→TCP retries triggered by SERVFAIL responses, labeled by outcome (recovered|still_servfail|tcp_error)"),
@@ -314,21 +475,101 @@ func (t *Telemetry) InitMetrics() (*Metrics, error) {
 		return nil, fmt.Errorf("failed to create servfail tcp retry counter: %w", err)
 	}
 
+	circuitBreakerTransitions, err := meter.Int64Counter(
+		"forwarder.circuit_breaker.transitions",
+		metric.WithDescription("Number of upstream circuit breaker state transitions, labeled by upstream and from/to state (closed|open|half-open)"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create circuit breaker transitions counter: %w", err)
+	}
+
+	circuitBreakerRejected, err := meter.Int64Counter(
+		"forwarder.circuit_breaker.rejected",
+		metric.WithDescription("Number of queries that failed fast because every candidate upstream's circuit breaker was open"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create circuit breaker rejected counter: %w", err)
+	}
+
+	forwarderInflight, err := meter.Int64UpDownCounter(
+		"forwarder.inflight",
+		metric.WithDescription("Number of upstream queries currently in flight"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forwarder inflight gauge: %w", err)
+	}
+
+	forwarderRejected, err := meter.Int64Counter(
+		"forwarder.concurrency.rejected",
+		metric.WithDescription("Number of queries rejected because forwarder.max_concurrent upstream queries were already in flight"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forwarder rejected counter: %w", err)
+	}
+
+	forwarderCoalesced, err := meter.Int64Counter(
+		"forwarder.coalesced",
+		metric.WithDescription("Number of queries answered by sharing an identical in-flight upstream query"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forwarder coalesced counter: %w", err)
+	}
+
+	tcpConnections, err := meter.Int64UpDownCounter(
+		"dns.tcp.connections",
+		metric.WithDescription("Number of open TCP and DoT client connections"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TCP connections gauge: %w", err)
+	}
+
+	tcpRejected, err := meter.Int64Counter(
+		"dns.tcp.rejected",
+		metric.WithDescription("Number of TCP and DoT connections closed on accept because server.max_tcp_connections were already open"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TCP rejected counter: %w", err)
+	}
+
 	return &Metrics{
 		DNSQueriesTotal:       queriesTotal,
 		DNSQueriesByType:      queriesByType,
 		DNSQueryDuration:      queryDuration,
+		DNSUpstreamDuration:   upstreamDuration,
 		DNSCacheHits:          cacheHits,
 		DNSCacheMisses:        cacheMisses,
+		DNSCacheEvictions:     cacheEvictions,
 		DNSBlockedQueries:     blockedQueries,
 		DNSForwardedQueries:   forwardedQueries,
+		DNSSlowQueries:        slowQueries,
+		DNSAnomalies:          anomalies,
+		DNSPeakDomainQueries:  peakDomainQueries,
+		DNSPeakClientDomains:  peakClientDomains,
+		DNSRebindBlocked:      rebindBlocked,
+		DNSQuotaRefused:       quotaRefused,
 		RateLimitViolations:   rateLimitViolations,
 		RateLimitDropped:      rateLimitDropped,
 		ActiveClients:         activeClients,
 		BlocklistSize:         blocklistSize,
+		BlocklistLoadPeakHeap: blocklistLoadPeakHeap,
+		BlocklistDownloaded:   blocklistDownloaded,
 		CacheSize:             cacheSize,
 		StorageQueriesDropped: storageQueriesDropped,
+		StorageBufferUsed:     storageBufferUsed,
 		ServfailTCPRetryTotal: servfailTCPRetryTotal,
+
+		CircuitBreakerTransitions: circuitBreakerTransitions,
+		CircuitBreakerRejected:    circuitBreakerRejected,
+
+		ForwarderInflight: forwarderInflight,
+		ForwarderRejected: forwarderRejected,
+
+		ForwarderCoalesced: forwarderCoalesced,
+
+		DNSTCPConnections: tcpConnections,
+		DNSTCPRejected:    tcpRejected,
+
+		labels: newLabelPolicy(t.cfg.MetricLabels),
 	}, nil
 }
 
@@ -350,6 +591,26 @@ func (m *Metrics) AddDroppedQuery(ctx context.Context, count int64) {
 	}
 }
 
+// RecordBufferUsed implements storage.MetricsRecorder interface
+func (m *Metrics) RecordBufferUsed(ctx context.Context, used int64) {
+	if m != nil && m.StorageBufferUsed != nil {
+		m.StorageBufferUsed.Record(ctx, used)
+	}
+}
+
+// Cache eviction reasons for the dns.cache.evictions reason attribute.
+const (
+	CacheEvictionLRU     = "lru"     // Removed to make room for a new entry
+	CacheEvictionExpired = "expired" // Removed after its TTL ran out
+)
+
+// AddCacheEvictions records count cache entries evicted for reason.
+func (m *Metrics) AddCacheEvictions(ctx context.Context, reason string, count int64) {
+	if m != nil && m.DNSCacheEvictions != nil && count > 0 {
+		m.DNSCacheEvictions.Add(ctx, count, metric.WithAttributes(attribute.String("reason", reason)))
+	}
+}
+
 // Shutdown gracefully shuts down telemetry
 func (t *Telemetry) Shutdown(ctx context.Context) error {
 	var errs []error
@@ -361,6 +622,13 @@ func (t *Telemetry) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Flush and shut down tracer provider if it's the SDK implementation
+	if provider, ok := t.tracerProvider.(*sdktrace.TracerProvider); ok {
+		if err := provider.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("tracer provider shutdown: %w", err))
+		}
+	}
+
 	// Shutdown meter provider if it's the SDK implementation
 	if provider, ok := t.meterProvider.(*sdkmetric.MeterProvider); ok {
 		if err := provider.Shutdown(ctx); err != nil {
@@ -105,6 +105,9 @@ func TestInitMetrics(t *testing.T) {
 	if metrics.DNSCacheHits == nil {
 		t.Error("DNSCacheHits not initialized")
 	}
+	if metrics.DNSCacheEvictions == nil {
+		t.Error("DNSCacheEvictions not initialized")
+	}
 	if metrics.ActiveClients == nil {
 		t.Error("ActiveClients not initialized")
 	}
@@ -138,6 +141,12 @@ func TestMetricsRecording(t *testing.T) {
 	metrics.DNSCacheHits.Add(ctx, 1, metric.WithAttributes())
 	metrics.DNSQueryDuration.Record(ctx, 5.5, metric.WithAttributes())
 	metrics.ActiveClients.Add(ctx, 1, metric.WithAttributes())
+	metrics.AddCacheEvictions(ctx, CacheEvictionLRU, 1)
+	metrics.AddCacheEvictions(ctx, CacheEvictionExpired, 3)
+
+	// Nil metrics (telemetry disabled in the caller) must be a no-op.
+	var nilMetrics *Metrics
+	nilMetrics.AddCacheEvictions(ctx, CacheEvictionLRU, 1)
 
 	// If we got here without panicking, the test passes
 }